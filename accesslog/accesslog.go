@@ -0,0 +1,128 @@
+// Package accesslog writes a JSON line per request and flow proxied to the origins, separately from the debug log,
+// so that they can be fed to a log pipeline.
+package accesslog
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const filePermMode = 0644 // rw-r--r--
+
+// TypeHTTP is the type of the entries of the HTTP requests, flows have the type of their protocol.
+const TypeHTTP = "http"
+
+// Entry is a request or flow that was proxied to an origin.
+type Entry struct {
+	// Time is when the request or flow started
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	ConnIndex uint8     `json:"connIndex"`
+	CFRay     string    `json:"cfRay,omitempty"`
+	RequestID string    `json:"requestID,omitempty"`
+	EyeballIP string    `json:"eyeballIP,omitempty"`
+
+	// The following are only reported for HTTP requests.
+	Hostname      string `json:"hostname,omitempty"`
+	Method        string `json:"method,omitempty"`
+	Path          string `json:"path,omitempty"`
+	OriginService string `json:"originService,omitempty"`
+	// Status is the status code of the response, zero if there is none
+	Status int `json:"status,omitempty"`
+
+	// The following are only reported for flows.
+	Src string `json:"src,omitempty"`
+	Dst string `json:"dst,omitempty"`
+
+	// BytesReceived are received from the eyeball and BytesSent are sent back to it
+	BytesReceived uint64 `json:"bytesReceived"`
+	BytesSent     uint64 `json:"bytesSent"`
+	// DurationMs is how long the request lasted, or the flow until its last activity, and ResponseMs how long it took
+	// to respond to the request, in milliseconds
+	DurationMs float64 `json:"durationMs"`
+	ResponseMs float64 `json:"responseMs,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Logger appends the entries to a file or a named pipe. A nil Logger logs nothing.
+type Logger struct {
+	lock       sync.Mutex
+	file       *os.File
+	redactions []*regexp.Regexp
+	failing    bool
+	log        *zerolog.Logger
+}
+
+// Open opens the access log at path, creating it if it doesn't exist. Opening a named pipe blocks until it has a
+// reader. The entries are redacted by the same rules as the logs, see logger.ParseRedactionRules.
+func Open(path string, redactions []*regexp.Regexp, log *zerolog.Logger) (*Logger, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, filePermMode)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{file: file, redactions: redactions, log: log}, nil
+}
+
+// Log writes the entry as a JSON line. A failing write is only reported once until the writes succeed again, so
+// that the debug log is not flooded.
+func (l *Logger) Log(entry *Entry) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		l.log.Err(err).Msg("Failed to encode an access log entry")
+		return
+	}
+	line = append(logger.Redact(l.redactions, line), '\n')
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := l.file.Write(line); err != nil {
+		if !l.failing {
+			l.log.Err(err).Str("path", l.file.Name()).Msg("Failed to write to the access log")
+		}
+		l.failing = true
+		return
+	}
+	l.failing = false
+}
+
+// LogFlow logs a flow once it is closed.
+func (l *Logger) LogFlow(info flow.Info) {
+	if l == nil {
+		return
+	}
+	l.Log(&Entry{
+		Time:          info.StartedAt,
+		Type:          string(info.Protocol),
+		ConnIndex:     info.ConnIndex,
+		Src:           info.Src,
+		Dst:           info.Dst,
+		BytesReceived: info.BytesToOrigin,
+		BytesSent:     info.BytesFromOrigin,
+		DurationMs:    Milliseconds(info.LastActiveAt.Sub(info.StartedAt)),
+	})
+}
+
+// Close closes the access log.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
+
+// Milliseconds converts d to milliseconds with a microsecond precision.
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
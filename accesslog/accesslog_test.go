@@ -0,0 +1,82 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/flow"
+	cfdlogger "github.com/cloudflare/cloudflared/logger"
+)
+
+func TestLogFlow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	log := zerolog.Nop()
+	logger, err := Open(path, nil, &log)
+	require.NoError(t, err)
+
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	logger.LogFlow(flow.Info{
+		ID:              "tcp-1",
+		Protocol:        flow.TCP,
+		Dst:             "10.0.0.1:22",
+		ConnIndex:       1,
+		StartedAt:       startedAt,
+		LastActiveAt:    startedAt.Add(1500 * time.Microsecond),
+		BytesToOrigin:   10,
+		BytesFromOrigin: 20,
+	})
+	logger.Log(&Entry{Time: startedAt, Type: TypeHTTP, Hostname: "app.example.com", Status: 200})
+	require.NoError(t, logger.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	var entry Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, Entry{
+		Time:          startedAt,
+		Type:          "tcp",
+		ConnIndex:     1,
+		Dst:           "10.0.0.1:22",
+		BytesReceived: 10,
+		BytesSent:     20,
+		DurationMs:    1.5,
+	}, entry)
+	assert.JSONEq(t, `{"time":"2024-05-01T10:00:00Z","type":"http","connIndex":0,"hostname":"app.example.com","status":200,"bytesReceived":0,"bytesSent":0,"durationMs":0}`, lines[1])
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	logger.Log(&Entry{Type: TypeHTTP})
+	logger.LogFlow(flow.Info{Protocol: flow.UDP})
+	assert.NoError(t, logger.Close())
+}
+
+func TestRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	log := zerolog.Nop()
+	redactions, err := cfdlogger.ParseRedactionRules([]string{`token=(\w+)`, `[a-z]+\.internal\.example\.com`})
+	require.NoError(t, err)
+	logger, err := Open(path, redactions, &log)
+	require.NoError(t, err)
+
+	logger.Log(&Entry{Type: TypeHTTP, Hostname: "db.internal.example.com", Path: "/login?token=secret", Status: 200})
+	require.NoError(t, logger.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var entry Entry
+	require.NoError(t, json.Unmarshal(content, &entry))
+	assert.Equal(t, "REDACTED", entry.Hostname)
+	assert.Equal(t, "/login?token=REDACTED", entry.Path)
+	assert.NotContains(t, string(content), "secret")
+}
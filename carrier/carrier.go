@@ -31,6 +31,18 @@ type StartOptions struct {
 	Headers         http.Header
 	Host            string
 	TLSClientConfig *tls.Config
+	// LoginOptions selects how the user logs in when there is no token yet. The token requests reach the origin with
+	// TLSClientConfig.
+	LoginOptions *token.LoginOptions
+}
+
+func (o *StartOptions) loginOptions() *token.LoginOptions {
+	var loginOptions token.LoginOptions
+	if o.LoginOptions != nil {
+		loginOptions = *o.LoginOptions
+	}
+	loginOptions.TLSClientConfig = o.TLSClientConfig
+	return &loginOptions
 }
 
 // Connection wraps up all the needed functions to forward over the tunnel
@@ -108,10 +120,12 @@ func Serve(remoteConn Connection, listener net.Listener, shutdownC <-chan struct
 	}
 }
 
-// serveConnection handles connections for the Serve() call
+// serveConnection handles connections for the Serve() call. Each connection gets its own copy of the options since
+// the Access app info is looked up and the token refreshed while connecting.
 func serveConnection(remoteConn Connection, c net.Conn, options *StartOptions) {
 	defer c.Close()
-	_ = remoteConn.ServeStream(options, c)
+	connOptions := *options
+	_ = remoteConn.ServeStream(&connOptions, c)
 }
 
 // IsAccessResponse checks the http Response to see if the url location
@@ -139,7 +153,7 @@ func BuildAccessRequest(options *StartOptions, log *zerolog.Logger) (*http.Reque
 		return nil, err
 	}
 
-	token, err := token.FetchTokenWithRedirect(req.URL, options.AppInfo, log)
+	token, err := token.FetchTokenWithRedirect(req.URL, options.AppInfo, options.loginOptions(), log)
 	if err != nil {
 		return nil, err
 	}
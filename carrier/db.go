@@ -0,0 +1,145 @@
+package carrier
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/stream"
+)
+
+// DatabaseProtocol is the protocol of the clients of a DBConnection
+type DatabaseProtocol string
+
+const (
+	DatabasePostgres DatabaseProtocol = "postgres"
+	DatabaseMySQL    DatabaseProtocol = "mysql"
+
+	// The codes of the Postgres requests sent before the startup message to negotiate the encryption
+	postgresSSLRequest    = 80877103
+	postgresGSSENCRequest = 80877104
+	postgresMaxStartup    = 10000
+	// postgresConnectionFailure is the SQLSTATE connection_failure
+	postgresConnectionFailure = "08006"
+	// mysqlHandshakeError is the ER_HANDSHAKE_ERROR error code
+	mysqlHandshakeError = 1043
+
+	dbErrorTimeout = 10 * time.Second
+)
+
+// ParseDatabaseProtocol returns the protocol with the name, postgres or mysql.
+func ParseDatabaseProtocol(name string) (DatabaseProtocol, error) {
+	switch protocol := DatabaseProtocol(name); protocol {
+	case DatabasePostgres, DatabaseMySQL:
+		return protocol, nil
+	default:
+		return "", fmt.Errorf("unsupported database protocol %q, expected %s or %s", name, DatabasePostgres, DatabaseMySQL)
+	}
+}
+
+// DBConnection forwards the connections of database clients to the edge. When the connection to the edge fails, e.g.
+// because the Access token expired, the client is answered with an error of its protocol, which it shows to the user,
+// rather than the connection being closed without an explanation.
+type DBConnection struct {
+	protocol DatabaseProtocol
+	log      *zerolog.Logger
+}
+
+// NewDBConnection returns a connection for the clients of the database protocol
+func NewDBConnection(protocol DatabaseProtocol, log *zerolog.Logger) Connection {
+	return &DBConnection{
+		protocol: protocol,
+		log:      log,
+	}
+}
+
+// ServeStream implements the Connection interface
+func (d *DBConnection) ServeStream(options *StartOptions, conn io.ReadWriter) error {
+	wsConn, err := createWebsocketStream(options, d.log)
+	if err != nil {
+		d.log.Err(err).Str(LogFieldOriginURL, options.OriginURL).Msg("failed to connect to origin")
+		message := fmt.Sprintf("cloudflared failed to connect to %s through Access: %v", options.OriginURL, err)
+		if err := d.writeError(conn, message); err != nil {
+			d.log.Debug().Err(err).Msg("failed to send the error to the database client")
+		}
+		return err
+	}
+	defer wsConn.Close()
+
+	stream.Pipe(wsConn, conn, d.log)
+	return nil
+}
+
+func (d *DBConnection) writeError(conn io.ReadWriter, message string) error {
+	if c, ok := conn.(net.Conn); ok {
+		_ = c.SetDeadline(time.Now().Add(dbErrorTimeout))
+	}
+	switch d.protocol {
+	case DatabasePostgres:
+		return writePostgresError(conn, message)
+	case DatabaseMySQL:
+		return writeMySQLError(conn, message)
+	}
+	return nil
+}
+
+// writePostgresError reads the startup message of the client, declining the encryption requests, and answers it with
+// a fatal ErrorResponse https://www.postgresql.org/docs/current/protocol-flow.html#PROTOCOL-FLOW-START-UP
+func writePostgresError(conn io.ReadWriter, message string) error {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return err
+		}
+		length := binary.BigEndian.Uint32(header)
+		if length < 8 || length > postgresMaxStartup {
+			return fmt.Errorf("invalid Postgres startup message length %d", length)
+		}
+		if _, err := io.CopyN(io.Discard, conn, int64(length-8)); err != nil {
+			return err
+		}
+		code := binary.BigEndian.Uint32(header[4:])
+		if code != postgresSSLRequest && code != postgresGSSENCRequest {
+			break
+		}
+		if _, err := conn.Write([]byte{'N'}); err != nil {
+			return err
+		}
+	}
+
+	var fields []byte
+	for _, field := range []struct {
+		code  byte
+		value string
+	}{
+		{'S', "FATAL"},
+		{'V', "FATAL"},
+		{'C', postgresConnectionFailure},
+		{'M', message},
+	} {
+		fields = append(fields, field.code)
+		fields = append(fields, field.value...)
+		fields = append(fields, 0)
+	}
+	fields = append(fields, 0)
+	response := []byte{'E', 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(response[1:], uint32(4+len(fields)))
+	_, err := conn.Write(append(response, fields...))
+	return err
+}
+
+// writeMySQLError sends an ERR packet in place of the handshake that the server sends first
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_err_packet.html
+func writeMySQLError(conn io.Writer, message string) error {
+	payload := []byte{0xff, 0, 0}
+	binary.LittleEndian.PutUint16(payload[1:], mysqlHandshakeError)
+	payload = append(payload, message...)
+	// The packet header is the 3 bytes length of the payload and the sequence number
+	packet := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), 0}
+	_, err := conn.Write(append(packet, payload...))
+	return err
+}
@@ -0,0 +1,59 @@
+package carrier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postgresMessage(code uint32, body []byte) []byte {
+	message := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(message, uint32(8+len(body)))
+	binary.BigEndian.PutUint32(message[4:], code)
+	return append(message, body...)
+}
+
+func TestWritePostgresError(t *testing.T) {
+	startup := postgresMessage(196608, []byte("user\x00app\x00database\x00app\x00\x00"))
+	client := &testClientConn{Reader: bytes.NewReader(append(postgresMessage(postgresSSLRequest, nil), startup...))}
+	require.NoError(t, writePostgresError(client, "token expired"))
+
+	received := client.received.Bytes()
+	require.Equal(t, byte('N'), received[0])
+	response := received[1:]
+	require.Equal(t, byte('E'), response[0])
+	assert.Equal(t, uint32(len(response)-1), binary.BigEndian.Uint32(response[1:]))
+	assert.Equal(t, "SFATAL\x00VFATAL\x00C08006\x00Mtoken expired\x00\x00", string(response[5:]))
+}
+
+func TestWritePostgresErrorInvalid(t *testing.T) {
+	client := &testClientConn{Reader: bytes.NewReader([]byte{0, 0, 0, 4, 0, 0, 0, 0})}
+	assert.Error(t, writePostgresError(client, "token expired"))
+	assert.Zero(t, client.received.Len())
+}
+
+func TestWriteMySQLError(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeMySQLError(&buf, "token expired"))
+	assert.Equal(t, append([]byte{16, 0, 0, 0, 0xff, 0x13, 0x04}, "token expired"...), buf.Bytes())
+}
+
+func TestDBConnectionFailure(t *testing.T) {
+	log := zerolog.Nop()
+	client := &testClientConn{Reader: bytes.NewReader(nil)}
+	conn := NewDBConnection(DatabaseMySQL, &log)
+	assert.Error(t, conn.ServeStream(&StartOptions{OriginURL: "http://127.0.0.1:1"}, client))
+	assert.Contains(t, client.received.String(), "cloudflared failed to connect to http://127.0.0.1:1")
+}
+
+func TestParseDatabaseProtocol(t *testing.T) {
+	protocol, err := ParseDatabaseProtocol("mysql")
+	require.NoError(t, err)
+	assert.Equal(t, DatabaseMySQL, protocol)
+	_, err = ParseDatabaseProtocol("oracle")
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package carrier
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/stream"
+)
+
+const (
+	DefaultMuxIdleTimeout = time.Minute
+
+	// muxSpareMaxAge is how long a warm connection is kept before being replaced, as the edge closes idle connections
+	muxSpareMaxAge = 30 * time.Second
+	// muxHandshakeTimeout is how long a client waits for the server to attach a connection to the edge
+	muxHandshakeTimeout = 30 * time.Second
+
+	// The client writes muxHello to ask for a connection, and the server answers with a status byte before the data of
+	// the connection
+	muxHello  byte = 0
+	muxReady  byte = 0
+	muxFailed byte = 1
+)
+
+type spareConn struct {
+	conn      io.ReadWriteCloser
+	createdAt time.Time
+}
+
+// MuxServer keeps a warm WebSocket connection to the edge so that successive clients, e.g. the ProxyCommand of each
+// SSH connection of an Ansible run, don't go through the Access token lookup and the handshake each time. A WebSocket
+// carries a single stream, so each client gets its own connection and a new spare one is dialed in the background.
+type MuxServer struct {
+	options     *StartOptions
+	idleTimeout time.Duration
+	log         *zerolog.Logger
+
+	// dialLock serializes the dials since they update the AppInfo of the options
+	dialLock sync.Mutex
+	spare    chan spareConn
+
+	lock     sync.Mutex
+	sessions int
+	idle     *time.Timer
+}
+
+// NewMuxServer creates a server that exits after no client has been connected for the idle timeout,
+// DefaultMuxIdleTimeout if zero.
+func NewMuxServer(options *StartOptions, idleTimeout time.Duration, log *zerolog.Logger) *MuxServer {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultMuxIdleTimeout
+	}
+	return &MuxServer{
+		options:     options,
+		idleTimeout: idleTimeout,
+		log:         log,
+		spare:       make(chan spareConn, 1),
+	}
+}
+
+// ListenMux listens on the Unix socket at path, unless another server already does in which case it returns an
+// error.
+func ListenMux(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, errors.Errorf("a multiplexing server is already listening on %s", path)
+	}
+	// The socket of a server that didn't exit cleanly is left behind
+	_ = os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen on the multiplexing socket")
+	}
+	return listener, nil
+}
+
+// Serve accepts clients until the server is idle, it always closes the listener.
+func (s *MuxServer) Serve(listener net.Listener) error {
+	defer listener.Close()
+	s.lock.Lock()
+	s.idle = time.AfterFunc(s.idleTimeout, func() { listener.Close() })
+	s.lock.Unlock()
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.refreshSpare(done)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// The listener is closed when the server is idle
+			if errors.Is(err, net.ErrClosed) {
+				s.discardSpare()
+				return nil
+			}
+			return err
+		}
+		s.startSession()
+		go func() {
+			defer s.endSession()
+			s.serveClient(conn)
+		}()
+	}
+}
+
+func (s *MuxServer) startSession() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sessions++
+	s.idle.Stop()
+}
+
+func (s *MuxServer) endSession() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sessions--
+	if s.sessions == 0 {
+		s.idle.Reset(s.idleTimeout)
+	}
+}
+
+func (s *MuxServer) serveClient(client net.Conn) {
+	defer client.Close()
+	// Connections that only check whether the server is listening don't need a connection to the edge
+	_ = client.SetReadDeadline(time.Now().Add(muxHandshakeTimeout))
+	hello := make([]byte, 1)
+	if _, err := io.ReadFull(client, hello); err != nil || hello[0] != muxHello {
+		return
+	}
+	_ = client.SetReadDeadline(time.Time{})
+
+	edgeConn, err := s.take()
+	if err != nil {
+		s.log.Err(err).Str(LogFieldOriginURL, s.options.OriginURL).Msg("failed to connect to origin")
+		_, _ = client.Write([]byte{muxFailed})
+		return
+	}
+	defer edgeConn.Close()
+	// The next client gets a connection that is already established
+	go s.fillSpare()
+
+	if _, err := client.Write([]byte{muxReady}); err != nil {
+		return
+	}
+	stream.Pipe(edgeConn, client, s.log)
+}
+
+// take returns the spare connection if it's recent enough, or a new connection.
+func (s *MuxServer) take() (io.ReadWriteCloser, error) {
+	select {
+	case spare := <-s.spare:
+		if time.Since(spare.createdAt) < muxSpareMaxAge {
+			return spare.conn, nil
+		}
+		spare.conn.Close()
+	default:
+	}
+	return s.dial()
+}
+
+func (s *MuxServer) dial() (io.ReadWriteCloser, error) {
+	s.dialLock.Lock()
+	defer s.dialLock.Unlock()
+	return createWebsocketStream(s.options, s.log)
+}
+
+func (s *MuxServer) fillSpare() {
+	if len(s.spare) > 0 {
+		return
+	}
+	conn, err := s.dial()
+	if err != nil {
+		s.log.Debug().Err(err).Msg("failed to create a spare connection to the origin")
+		return
+	}
+	s.putSpare(spareConn{conn: conn, createdAt: time.Now()})
+}
+
+// putSpare keeps the connection as the spare one, unless there is already one.
+func (s *MuxServer) putSpare(spare spareConn) {
+	select {
+	case s.spare <- spare:
+	default:
+		spare.conn.Close()
+	}
+}
+
+// refreshSpare replaces the spare connection before the edge closes it.
+func (s *MuxServer) refreshSpare(done <-chan struct{}) {
+	ticker := time.NewTicker(muxSpareMaxAge / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		select {
+		case spare := <-s.spare:
+			if time.Since(spare.createdAt) < muxSpareMaxAge/2 {
+				s.putSpare(spare)
+				continue
+			}
+			spare.conn.Close()
+			s.fillSpare()
+		default:
+		}
+	}
+}
+
+func (s *MuxServer) discardSpare() {
+	select {
+	case spare := <-s.spare:
+		spare.conn.Close()
+	default:
+	}
+}
+
+// DialMux connects to the multiplexing server listening at path and waits for it to attach a connection to the edge.
+func DialMux(path string) (net.Conn, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(muxHandshakeTimeout))
+	if _, err := conn.Write([]byte{muxHello}); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to write to the multiplexing server")
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to read the status of the multiplexing server")
+	}
+	if status[0] != muxReady {
+		conn.Close()
+		return nil, errors.New("the multiplexing server failed to connect to the origin")
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
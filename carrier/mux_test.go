@@ -0,0 +1,85 @@
+package carrier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func newEchoWebsocketServer(t *testing.T, upgrades *atomic.Int32) *httptest.Server {
+	upgrader := gws.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		upgrades.Add(1)
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMuxServer(t *testing.T) {
+	var upgrades atomic.Int32
+	origin := newEchoWebsocketServer(t, &upgrades)
+	log := zerolog.Nop()
+	path := filepath.Join(t.TempDir(), "mux.sock")
+
+	listener, err := ListenMux(path)
+	require.NoError(t, err)
+	server := NewMuxServer(&StartOptions{OriginURL: origin.URL, Headers: make(http.Header)}, 100*time.Millisecond, &log)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- server.Serve(listener)
+	}()
+
+	// A second server for the same socket doesn't start
+	_, err = ListenMux(path)
+	require.Error(t, err)
+
+	for i := 0; i < 2; i++ {
+		conn, err := DialMux(path)
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, "ping", string(buf))
+		require.NoError(t, conn.Close())
+
+		// The next client gets the spare connection
+		require.Eventually(t, func() bool { return len(server.spare) == 1 }, time.Second, 10*time.Millisecond)
+	}
+	require.Equal(t, int32(3), upgrades.Load())
+
+	// The server exits once idle
+	select {
+	case err := <-errC:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the multiplexing server didn't exit after the idle timeout")
+	}
+}
+
+func TestDialMuxWithoutServer(t *testing.T) {
+	_, err := DialMux(filepath.Join(t.TempDir(), "mux.sock"))
+	require.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package carrier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// RDP security protocols requested by the client in the X.224 Connection Request, see MS-RDPBCGR 2.2.1.1.1
+const (
+	rdpProtocolSSL      = 0x1
+	rdpProtocolHybrid   = 0x2
+	rdpProtocolHybridEx = 0x8
+
+	tpktHeaderLength     = 4
+	maxTPKTLength        = 8192
+	x224HeaderLength     = 7
+	x224ConnectionReq    = 0xe0
+	x224ConnectionConf   = 0xd0
+	rdpNegRequest        = 0x01
+	rdpNegFailure        = 0x03
+	rdpNegLength         = 8
+	hybridRequiredFailed = 0x5 // HYBRID_REQUIRED_BY_SERVER
+	// rdpCookiePrefix starts both the routing token (Cookie: msts=) and the cookie (Cookie: mstshash=), which end
+	// with CR LF
+	rdpCookiePrefix = "Cookie: "
+)
+
+// RDPConnection forwards RDP connections, optionally refusing the clients that don't negotiate Network Level
+// Authentication (CredSSP), so that the credentials are never sent within the legacy RDP security layer. Negotiated
+// connections are passed through untouched, the TLS and CredSSP handshakes are between the client and the server.
+type RDPConnection struct {
+	Connection
+	RequireNLA bool
+	Log        *zerolog.Logger
+}
+
+// ServeStream implements the Connection interface
+func (c *RDPConnection) ServeStream(options *StartOptions, conn io.ReadWriter) error {
+	if !c.RequireNLA {
+		return c.Connection.ServeStream(options, conn)
+	}
+	request, protocols, err := readRDPConnectionRequest(conn)
+	if err != nil {
+		c.Log.Err(err).Msg("failed to read the RDP connection request")
+		return err
+	}
+	if protocols&(rdpProtocolHybrid|rdpProtocolHybridEx) == 0 {
+		c.Log.Warn().Msg("Refusing an RDP client that doesn't use Network Level Authentication")
+		_, _ = conn.Write(rdpNegotiationFailure(hybridRequiredFailed))
+		return fmt.Errorf("RDP client requested protocols %#x without Network Level Authentication", protocols)
+	}
+	// The connection request is sent to the server along with the rest of the stream
+	return c.Connection.ServeStream(options, &prefixedReadWriter{
+		Reader: io.MultiReader(bytes.NewReader(request), conn),
+		Writer: conn,
+	})
+}
+
+type prefixedReadWriter struct {
+	io.Reader
+	io.Writer
+}
+
+// readRDPConnectionRequest reads the TPKT packet of the X.224 Connection Request that starts an RDP connection, and
+// returns it with the protocols requested by the client. The client requests the standard RDP security if the
+// request has no negotiation.
+func readRDPConnectionRequest(r io.Reader) ([]byte, uint32, error) {
+	header := make([]byte, tpktHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+	if header[0] != 3 {
+		return nil, 0, errors.New("not an RDP connection: invalid TPKT version")
+	}
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	if length < tpktHeaderLength+x224HeaderLength || length > maxTPKTLength {
+		return nil, 0, fmt.Errorf("not an RDP connection: invalid TPKT length %d", length)
+	}
+	packet := make([]byte, length)
+	copy(packet, header)
+	if _, err := io.ReadFull(r, packet[tpktHeaderLength:]); err != nil {
+		return nil, 0, err
+	}
+	if packet[tpktHeaderLength+1]&0xf0 != x224ConnectionReq {
+		return nil, 0, errors.New("not an RDP connection: expected an X.224 Connection Request")
+	}
+	// The variable part of the request is the optional routing token or cookie, then the optional negotiation request
+	// and the optional correlation info, see MS-RDPBCGR 2.2.1.1
+	variable := packet[tpktHeaderLength+x224HeaderLength:]
+	if bytes.HasPrefix(variable, []byte(rdpCookiePrefix)) {
+		end := bytes.Index(variable, []byte("\r\n"))
+		if end < 0 {
+			return nil, 0, errors.New("not an RDP connection: unterminated routing token or cookie")
+		}
+		variable = variable[end+2:]
+	}
+	if len(variable) >= rdpNegLength && variable[0] == rdpNegRequest &&
+		binary.LittleEndian.Uint16(variable[2:]) == rdpNegLength {
+		return packet, binary.LittleEndian.Uint32(variable[4:]), nil
+	}
+	return packet, 0, nil
+}
+
+// rdpNegotiationFailure builds the X.224 Connection Confirm with an RDP_NEG_FAILURE, clients show a message explaining
+// the failure code.
+func rdpNegotiationFailure(code uint32) []byte {
+	packet := make([]byte, tpktHeaderLength+x224HeaderLength+rdpNegLength)
+	packet[0] = 3
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+	packet[4] = byte(len(packet) - tpktHeaderLength - 1)
+	packet[5] = x224ConnectionConf
+	negotiation := packet[tpktHeaderLength+x224HeaderLength:]
+	negotiation[0] = rdpNegFailure
+	binary.LittleEndian.PutUint16(negotiation[2:], rdpNegLength)
+	binary.LittleEndian.PutUint32(negotiation[4:], code)
+	return packet
+}
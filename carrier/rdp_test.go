@@ -0,0 +1,150 @@
+package carrier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingConnection struct {
+	received []byte
+}
+
+func (c *recordingConnection) ServeStream(options *StartOptions, conn io.ReadWriter) error {
+	received, err := io.ReadAll(conn)
+	c.received = received
+	return err
+}
+
+// testClientConn sends the data of the reader, and records what it receives
+type testClientConn struct {
+	io.Reader
+	received bytes.Buffer
+}
+
+func (c *testClientConn) Write(p []byte) (int, error) {
+	return c.received.Write(p)
+}
+
+// rdpConnectionRequest builds an X.224 Connection Request with a cookie, and a negotiation request unless protocols
+// is negative.
+func rdpConnectionRequest(protocols int) []byte {
+	return rdpConnectionRequestWith("Cookie: mstshash=user\r\n", protocols, false)
+}
+
+// rdpConnectionRequestWith builds an X.224 Connection Request with the routing token or cookie, a negotiation request
+// unless protocols is negative, and the correlation info that follows the negotiation request.
+func rdpConnectionRequestWith(cookie string, protocols int, correlationInfo bool) []byte {
+	x224 := append([]byte{0, x224ConnectionReq, 0, 0, 0, 0, 0}, cookie...)
+	if protocols >= 0 {
+		negotiation := make([]byte, rdpNegLength)
+		negotiation[0] = rdpNegRequest
+		binary.LittleEndian.PutUint16(negotiation[2:], rdpNegLength)
+		binary.LittleEndian.PutUint32(negotiation[4:], uint32(protocols))
+		x224 = append(x224, negotiation...)
+	}
+	if correlationInfo {
+		// RDP_NEG_CORRELATION_INFO, see MS-RDPBCGR 2.2.1.1.2
+		correlation := make([]byte, 36)
+		correlation[0] = 0x06
+		binary.LittleEndian.PutUint16(correlation[2:], 36)
+		correlation[4] = 0x01
+		x224 = append(x224, correlation...)
+	}
+	x224[0] = byte(len(x224) - 1)
+	packet := []byte{3, 0, 0, 0}
+	binary.BigEndian.PutUint16(packet[2:], uint16(tpktHeaderLength+len(x224)))
+	return append(packet, x224...)
+}
+
+func TestRDPConnectionRequireNLA(t *testing.T) {
+	log := zerolog.Nop()
+	tests := []struct {
+		name      string
+		protocols int
+		allowed   bool
+	}{
+		{"no negotiation", -1, false},
+		{"standard security", 0, false},
+		{"tls", rdpProtocolSSL, false},
+		{"credssp", rdpProtocolSSL | rdpProtocolHybrid, true},
+		{"credssp with early user authorization", rdpProtocolSSL | rdpProtocolHybrid | rdpProtocolHybridEx, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := rdpConnectionRequest(test.protocols)
+			data := append(append([]byte{}, request...), []byte("client data")...)
+			client := &testClientConn{Reader: bytes.NewReader(data)}
+			next := &recordingConnection{}
+			conn := &RDPConnection{Connection: next, RequireNLA: true, Log: &log}
+
+			err := conn.ServeStream(&StartOptions{}, client)
+			if test.allowed {
+				require.NoError(t, err)
+				assert.Equal(t, data, next.received)
+				assert.Zero(t, client.received.Len())
+				return
+			}
+			assert.Error(t, err)
+			assert.Nil(t, next.received)
+			assert.Equal(t, rdpNegotiationFailure(hybridRequiredFailed), client.received.Bytes())
+		})
+	}
+}
+
+func TestRDPConnectionPassthrough(t *testing.T) {
+	log := zerolog.Nop()
+	data := []byte("not even RDP")
+	next := &recordingConnection{}
+	conn := &RDPConnection{Connection: next, Log: &log}
+	require.NoError(t, conn.ServeStream(&StartOptions{}, &testClientConn{Reader: bytes.NewReader(data)}))
+	assert.Equal(t, data, next.received)
+}
+
+func TestReadRDPConnectionRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+	}{
+		{"cookie", rdpConnectionRequestWith("Cookie: mstshash=user\r\n", rdpProtocolHybrid, false)},
+		{"routing token", rdpConnectionRequestWith("Cookie: msts=3640205228.15629.0000\r\n", rdpProtocolHybrid, false)},
+		{"no cookie", rdpConnectionRequestWith("", rdpProtocolHybrid, false)},
+		{"correlation info", rdpConnectionRequestWith("Cookie: mstshash=user\r\n", rdpProtocolHybrid, true)},
+		{"correlation info without cookie", rdpConnectionRequestWith("", rdpProtocolHybrid, true)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, protocols, err := readRDPConnectionRequest(bytes.NewReader(test.request))
+			require.NoError(t, err)
+			assert.Equal(t, test.request, request)
+			assert.Equal(t, uint32(rdpProtocolHybrid), protocols)
+		})
+	}
+
+	_, _, err := readRDPConnectionRequest(bytes.NewReader(rdpConnectionRequestWith("Cookie: mstshash=user", rdpProtocolHybrid, false)))
+	assert.Error(t, err)
+}
+
+func TestReadRDPConnectionRequestInvalid(t *testing.T) {
+	for _, data := range [][]byte{
+		{3, 0},
+		{4, 0, 0, 19, 14, x224ConnectionReq, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{3, 0, 0, 5, 0},
+		{3, 0, 0, 11, 6, x224ConnectionConf, 0, 0, 0, 0, 0},
+	} {
+		_, _, err := readRDPConnectionRequest(bytes.NewReader(data))
+		assert.Error(t, err)
+	}
+}
+
+func TestRDPNegotiationFailure(t *testing.T) {
+	assert.Equal(t, []byte{
+		3, 0, 0, 19, 14, x224ConnectionConf, 0, 0, 0, 0, 0,
+		rdpNegFailure, 0, 8, 0, 5, 0, 0, 0,
+	}, rdpNegotiationFailure(hybridRequiredFailed))
+}
@@ -0,0 +1,57 @@
+package carrier
+
+import (
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/socks"
+)
+
+// SocksConnection serves a SOCKS5 proxy on each connection, the destinations requested by the client are reached
+// through an Access application in bastion mode, which dials them on the origin side.
+type SocksConnection struct {
+	log *zerolog.Logger
+}
+
+// NewSocksConnection returns a connection serving SOCKS5 to its clients
+func NewSocksConnection(log *zerolog.Logger) Connection {
+	return &SocksConnection{
+		log: log,
+	}
+}
+
+// ServeStream implements the Connection interface
+func (s *SocksConnection) ServeStream(options *StartOptions, conn io.ReadWriter) error {
+	dialer := &bastionDialer{options: options, log: s.log}
+	handler := socks.NewConnectionHandler(socks.NewRequestHandler(dialer, nil))
+	if err := handler.Serve(conn); err != nil {
+		s.log.Debug().Err(err).Str(LogFieldOriginURL, options.OriginURL).Msg("SOCKS connection failed")
+		return err
+	}
+	return nil
+}
+
+// bastionDialer connects to the destinations of SOCKS requests with a WebSocket stream to a bastion.
+type bastionDialer struct {
+	options *StartOptions
+	log     *zerolog.Logger
+}
+
+// Dial implements the socks.Dialer interface
+func (d *bastionDialer) Dial(address string) (io.ReadWriteCloser, *socks.AddrSpec, error) {
+	options := *d.options
+	options.Headers = d.options.Headers.Clone()
+	if options.Headers == nil {
+		options.Headers = make(http.Header)
+	}
+	SetBastionDest(options.Headers, address)
+	wsConn, err := createWebsocketStream(&options, d.log)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Only the bastion knows the address it dialed from
+	return wsConn, &socks.AddrSpec{IP: net.IPv4zero}, nil
+}
@@ -0,0 +1,100 @@
+package carrier
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBastionServer echoes the messages of each stream, and sends the destinations to the channel
+func newTestBastionServer(destinations chan<- string) *httptest.Server {
+	upgrader := ws.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		destinations <- r.Header.Get(cfJumpDestinationHeader)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(mt, message); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func socksConnect(t *testing.T, conn net.Conn, host string, port uint16) {
+	_, err := conn.Write([]byte{5, 1, 0})
+	require.NoError(t, err)
+	method := make([]byte, 2)
+	_, err = io.ReadFull(conn, method)
+	require.NoError(t, err)
+	require.Equal(t, []byte{5, 0}, method)
+
+	request := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	request = binary.BigEndian.AppendUint16(request, port)
+	_, err = conn.Write(request)
+	require.NoError(t, err)
+	// The reply has the IPv4 address the bastion dialed from
+	reply := make([]byte, 10)
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	require.Equal(t, byte(0), reply[1], "SOCKS request failed")
+}
+
+func TestSocksConnection(t *testing.T) {
+	destinations := make(chan string, 2)
+	ts := newTestBastionServer(destinations)
+	defer ts.Close()
+
+	listener, err := net.Listen("tcp", "localhost:")
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	options := &StartOptions{
+		OriginURL: "http://" + ts.Listener.Addr().String(),
+		Headers:   http.Header{"User-Agent": []string{"test"}},
+	}
+	go func() {
+		_ = Serve(NewSocksConnection(&log), listener, shutdownC, options)
+	}()
+
+	for _, destination := range []struct {
+		host string
+		port uint16
+	}{
+		{"db.internal", 5432},
+		{"ssh.internal", 22},
+	} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		socksConnect(t, conn, destination.host, destination.port)
+		assert.Equal(t, net.JoinHostPort(destination.host, strconv.Itoa(int(destination.port))), <-destinations)
+
+		message := []byte("hello " + destination.host)
+		_, err = conn.Write(message)
+		require.NoError(t, err)
+		echo := make([]byte, len(message))
+		_, err = io.ReadFull(conn, echo)
+		require.NoError(t, err)
+		assert.Equal(t, message, echo)
+		conn.Close()
+	}
+	// The options shared by the connections are left untouched
+	assert.Empty(t, options.Headers.Get(cfJumpDestinationHeader))
+}
@@ -0,0 +1,199 @@
+package carrier
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/stream"
+)
+
+const (
+	DefaultUDPIdleTimeout = 2 * time.Minute
+
+	// udpSessionQueue is how many datagrams of a client are queued while its connection to the edge is established
+	udpSessionQueue = 64
+)
+
+// UDPForwarder listens for the datagrams of local clients, e.g. SNMP tools, and forwards them to a UDP origin behind
+// Access. Each client address gets its own WebSocket connection to the edge, which carries the datagrams framed with
+// their length, until the client has been idle for the idle timeout.
+type UDPForwarder struct {
+	conn        Connection
+	options     *StartOptions
+	idleTimeout time.Duration
+	log         *zerolog.Logger
+
+	lock     sync.Mutex
+	sessions map[string]*udpSession
+}
+
+// NewUDPForwarder creates a forwarder with DefaultUDPIdleTimeout if the idle timeout is zero.
+func NewUDPForwarder(conn Connection, options *StartOptions, idleTimeout time.Duration, log *zerolog.Logger) *UDPForwarder {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultUDPIdleTimeout
+	}
+	return &UDPForwarder{
+		conn:        conn,
+		options:     options,
+		idleTimeout: idleTimeout,
+		log:         log,
+		sessions:    make(map[string]*udpSession),
+	}
+}
+
+// ListenAndServe listens on the address until shutdownC is closed.
+func (f *UDPForwarder) ListenAndServe(address string, shutdownC <-chan struct{}) error {
+	listener, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return errors.Wrap(err, "failed to start UDP forwarding server")
+	}
+	go func() {
+		<-shutdownC
+		listener.Close()
+	}()
+	return f.Serve(listener)
+}
+
+// Serve forwards the datagrams received on the listener, it always closes the listener.
+func (f *UDPForwarder) Serve(listener net.PacketConn) error {
+	defer listener.Close()
+	defer f.closeSessions()
+
+	buf := make([]byte, stream.MaxDatagramSize)
+	for {
+		n, addr, err := listener.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		datagram := make([]byte, n)
+		copy(datagram, buf[:n])
+		f.session(listener, addr).enqueue(datagram, f.log)
+	}
+}
+
+// session returns the session of the client, starting it if it's a new client.
+func (f *UDPForwarder) session(listener net.PacketConn, addr net.Addr) *udpSession {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if session, ok := f.sessions[addr.String()]; ok {
+		return session
+	}
+	session := newUDPSession(listener, addr, f.idleTimeout)
+	f.sessions[addr.String()] = session
+	go func() {
+		defer f.removeSession(addr, session)
+		connOptions := *f.options
+		if err := f.conn.ServeStream(&connOptions, session); err != nil {
+			f.log.Debug().Err(err).Str("client", addr.String()).Msg("UDP session ended")
+		}
+	}()
+	return session
+}
+
+func (f *UDPForwarder) removeSession(addr net.Addr, session *udpSession) {
+	session.Close()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.sessions[addr.String()] == session {
+		delete(f.sessions, addr.String())
+	}
+}
+
+func (f *UDPForwarder) closeSessions() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, session := range f.sessions {
+		session.Close()
+	}
+}
+
+// udpSession is the stream of framed datagrams of a client, the datagrams from the edge are sent back to its address.
+type udpSession struct {
+	listener    net.PacketConn
+	addr        net.Addr
+	idleTimeout time.Duration
+
+	datagrams chan []byte
+	pending   []byte
+	decoder   stream.DatagramDecoder
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	activity  chan struct{}
+}
+
+func newUDPSession(listener net.PacketConn, addr net.Addr, idleTimeout time.Duration) *udpSession {
+	return &udpSession{
+		listener:    listener,
+		addr:        addr,
+		idleTimeout: idleTimeout,
+		datagrams:   make(chan []byte, udpSessionQueue),
+		closed:      make(chan struct{}),
+		activity:    make(chan struct{}, 1),
+	}
+}
+
+// enqueue queues a datagram of the client, it's dropped if the edge doesn't keep up like a full socket buffer would.
+func (s *udpSession) enqueue(datagram []byte, log *zerolog.Logger) {
+	select {
+	case s.datagrams <- datagram:
+	case <-s.closed:
+	default:
+		log.Debug().Str("client", s.addr.String()).Msg("Dropping a UDP datagram, the connection to the edge is not keeping up")
+	}
+}
+
+// Read returns the datagrams of the client framed with their length, and io.EOF once the session is idle.
+func (s *udpSession) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		idle := time.NewTimer(s.idleTimeout)
+		defer idle.Stop()
+		for len(s.pending) == 0 {
+			select {
+			case datagram := <-s.datagrams:
+				s.pending, _ = stream.EncodeDatagram(s.pending[:0], datagram)
+			case <-s.activity:
+				// The datagrams of the origin keep the session alive too
+				if !idle.Stop() {
+					<-idle.C
+				}
+				idle.Reset(s.idleTimeout)
+			case <-idle.C:
+				return 0, io.EOF
+			case <-s.closed:
+				return 0, io.EOF
+			}
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write sends the datagrams framed in p back to the client.
+func (s *udpSession) Write(p []byte) (int, error) {
+	err := s.decoder.Feed(p, func(datagram []byte) error {
+		select {
+		case s.activity <- struct{}{}:
+		default:
+		}
+		_, err := s.listener.WriteTo(datagram, s.addr)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *udpSession) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
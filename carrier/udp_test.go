@@ -0,0 +1,61 @@
+package carrier
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoConnection streams the data of the client back to it, like an origin echoing the datagrams would.
+type echoConnection struct {
+	streams chan struct{}
+}
+
+func (c *echoConnection) ServeStream(_ *StartOptions, conn io.ReadWriter) error {
+	c.streams <- struct{}{}
+	_, err := io.Copy(conn, conn)
+	return err
+}
+
+func TestUDPForwarder(t *testing.T) {
+	log := zerolog.Nop()
+	conn := &echoConnection{streams: make(chan struct{}, 10)}
+	forwarder := NewUDPForwarder(conn, &StartOptions{}, 100*time.Millisecond, &log)
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- forwarder.Serve(listener) }()
+
+	client, err := net.Dial("udp", listener.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	reply := make([]byte, 100)
+	for _, datagram := range []string{"get sysName", "get sysUpTime"} {
+		_, err = client.Write([]byte(datagram))
+		require.NoError(t, err)
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := client.Read(reply)
+		require.NoError(t, err)
+		assert.Equal(t, datagram, string(reply[:n]))
+	}
+	// Both datagrams were sent on the connection of the client
+	assert.Len(t, conn.streams, 1)
+
+	// A new connection is made once the client was idle
+	time.Sleep(300 * time.Millisecond)
+	_, err = client.Write([]byte("get sysName"))
+	require.NoError(t, err)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = client.Read(reply)
+	require.NoError(t, err)
+	assert.Len(t, conn.streams, 2)
+
+	listener.Close()
+	assert.NoError(t, <-done)
+}
@@ -75,7 +75,7 @@ func createWebsocketStream(options *StartOptions, log *zerolog.Logger) (*cfwebso
 			return nil, err
 		}
 
-		appInfo, err := token.GetAppInfo(originReq.URL)
+		appInfo, err := token.GetAppInfo(originReq.URL, options.TLSClientConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,36 @@
+package cfapi
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Account is a Cloudflare account the API token has access to.
+type Account struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ListAccounts lists the accounts the API token has access to.
+func (r *RESTClient) ListAccounts() ([]*Account, error) {
+	fetchFn := func(page int) (*http.Response, error) {
+		endpoint := r.baseEndpoints.accounts
+		endpoint.RawQuery = url.Values{
+			"page": {strconv.Itoa(page)},
+		}.Encode()
+		rsp, err := r.sendRequest("GET", endpoint, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "REST request failed")
+		}
+		if rsp.StatusCode != http.StatusOK {
+			rsp.Body.Close()
+			return nil, r.statusCodeToError("list accounts", rsp)
+		}
+		return rsp, nil
+	}
+
+	return fetchExhaustively[Account](fetchFn)
+}
@@ -29,6 +29,7 @@ var (
 
 type RESTClient struct {
 	baseEndpoints *baseEndpoints
+	accountTag    string
 	authToken     string
 	userAgent     string
 	client        http.Client
@@ -40,6 +41,8 @@ type baseEndpoints struct {
 	zoneLevel     url.URL
 	accountRoutes url.URL
 	accountVnets  url.URL
+	zones         url.URL
+	accounts      url.URL
 }
 
 var _ Client = (*RESTClient)(nil)
@@ -64,6 +67,14 @@ func NewRESTClient(baseURL, accountTag, zoneTag, authToken, userAgent string, lo
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create account level endpoint")
 	}
+	zonesEndpoint, err := url.Parse(fmt.Sprintf("%s/zones", baseURL))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create zones endpoint")
+	}
+	accountsEndpoint, err := url.Parse(fmt.Sprintf("%s/accounts", baseURL))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create accounts endpoint")
+	}
 	httpTransport := http.Transport{
 		TLSHandshakeTimeout:   defaultTimeout,
 		ResponseHeaderTimeout: defaultTimeout,
@@ -75,9 +86,12 @@ func NewRESTClient(baseURL, accountTag, zoneTag, authToken, userAgent string, lo
 			zoneLevel:     *zoneLevelEndpoint,
 			accountRoutes: *accountRoutesEndpoint,
 			accountVnets:  *accountVnetsEndpoint,
+			zones:         *zonesEndpoint,
+			accounts:      *accountsEndpoint,
 		},
-		authToken: authToken,
-		userAgent: userAgent,
+		accountTag: accountTag,
+		authToken:  authToken,
+		userAgent:  userAgent,
 		client: http.Client{
 			Transport: &httpTransport,
 			Timeout:   defaultTimeout,
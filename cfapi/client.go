@@ -1,24 +1,41 @@
 package cfapi
 
 import (
+	"encoding/json"
+
 	"github.com/google/uuid"
 )
 
 type TunnelClient interface {
-	CreateTunnel(name string, tunnelSecret []byte) (*TunnelWithToken, error)
+	CreateTunnel(name string, tunnelSecret []byte, labels map[string]string) (*TunnelWithToken, error)
 	GetTunnel(tunnelID uuid.UUID) (*Tunnel, error)
+	RotateTunnelSecret(tunnelID uuid.UUID, tunnelSecret []byte) (*Tunnel, error)
 	GetTunnelToken(tunnelID uuid.UUID) (string, error)
 	GetManagementToken(tunnelID uuid.UUID) (string, error)
 	DeleteTunnel(tunnelID uuid.UUID, cascade bool) error
 	ListTunnels(filter *TunnelFilter) ([]*Tunnel, error)
 	ListActiveClients(tunnelID uuid.UUID) ([]*ActiveClient, error)
 	CleanupConnections(tunnelID uuid.UUID, params *CleanupParams) error
+	GetTunnelConfiguration(tunnelID uuid.UUID) (*TunnelConfiguration, error)
+	UpdateTunnelConfiguration(tunnelID uuid.UUID, config json.RawMessage) (*TunnelConfiguration, error)
 }
 
 type HostnameClient interface {
 	RouteTunnel(tunnelID uuid.UUID, route HostnameRoute) (HostnameRouteResult, error)
 }
 
+type DNSClient interface {
+	ListZones() ([]*Zone, error)
+	ListCNAMERecords(zoneID string, target string) ([]*DNSRecord, error)
+	ListDNSRecords(zoneID string, name string) ([]*DNSRecord, error)
+	UpdateDNSRecord(zoneID string, recordID string, options DNSRecordOptions) error
+	DeleteDNSRecord(zoneID string, recordID string) error
+}
+
+type AccountClient interface {
+	ListAccounts() ([]*Account, error)
+}
+
 type IPRouteClient interface {
 	ListRoutes(filter *IpRouteFilter) ([]*DetailedRoute, error)
 	AddRoute(newRoute NewRoute) (Route, error)
@@ -36,6 +53,8 @@ type VnetClient interface {
 type Client interface {
 	TunnelClient
 	HostnameClient
+	DNSClient
+	AccountClient
 	IPRouteClient
 	VnetClient
 }
@@ -0,0 +1,147 @@
+package cfapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Zone is a zone of the account.
+type Zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// DNSRecord is a DNS record of a zone.
+type DNSRecord struct {
+	ID       string `json:"id"`
+	ZoneID   string `json:"zone_id"`
+	ZoneName string `json:"zone_name"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	Proxied  bool   `json:"proxied"`
+	TTL      int    `json:"ttl"`
+}
+
+// TunnelTarget is the target of the CNAME records routing hostnames to the tunnel.
+func TunnelTarget(tunnelID uuid.UUID) string {
+	return fmt.Sprintf("%s.cfargotunnel.com", tunnelID)
+}
+
+// ZoneOf returns the zone of hostname among zones, the most specific one if they are nested, nil if there is none.
+func ZoneOf(zones []*Zone, hostname string) *Zone {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	var match *Zone
+	for _, zone := range zones {
+		name := strings.ToLower(zone.Name)
+		if hostname != name && !strings.HasSuffix(hostname, "."+name) {
+			continue
+		}
+		if match == nil || len(name) > len(match.Name) {
+			match = zone
+		}
+	}
+	return match
+}
+
+// ListZones lists the zones of the account, or all the zones the token can access if the client has no account.
+func (r *RESTClient) ListZones() ([]*Zone, error) {
+	fetchFn := func(page int) (*http.Response, error) {
+		endpoint := r.baseEndpoints.zones
+		query := url.Values{"page": {strconv.Itoa(page)}}
+		if r.accountTag != "" {
+			query.Set("account.id", r.accountTag)
+		}
+		endpoint.RawQuery = query.Encode()
+		rsp, err := r.sendRequest("GET", endpoint, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "REST request failed")
+		}
+		if rsp.StatusCode != http.StatusOK {
+			rsp.Body.Close()
+			return nil, r.statusCodeToError("list zones", rsp)
+		}
+		return rsp, nil
+	}
+
+	return fetchExhaustively[Zone](fetchFn)
+}
+
+// ListCNAMERecords lists the CNAME records of the zone with the target.
+func (r *RESTClient) ListCNAMERecords(zoneID string, target string) ([]*DNSRecord, error) {
+	fetchFn := func(page int) (*http.Response, error) {
+		endpoint := r.baseEndpoints.zones
+		endpoint.Path = path.Join(endpoint.Path, url.PathEscape(zoneID), "dns_records")
+		endpoint.RawQuery = url.Values{
+			"type":    {"CNAME"},
+			"content": {target},
+			"page":    {strconv.Itoa(page)},
+		}.Encode()
+		rsp, err := r.sendRequest("GET", endpoint, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "REST request failed")
+		}
+		if rsp.StatusCode != http.StatusOK {
+			rsp.Body.Close()
+			return nil, r.statusCodeToError("list DNS records", rsp)
+		}
+		return rsp, nil
+	}
+
+	return fetchExhaustively[DNSRecord](fetchFn)
+}
+
+// ListDNSRecords lists the records of the zone named name, of any type.
+func (r *RESTClient) ListDNSRecords(zoneID string, name string) ([]*DNSRecord, error) {
+	fetchFn := func(page int) (*http.Response, error) {
+		endpoint := r.baseEndpoints.zones
+		endpoint.Path = path.Join(endpoint.Path, url.PathEscape(zoneID), "dns_records")
+		endpoint.RawQuery = url.Values{
+			"name": {name},
+			"page": {strconv.Itoa(page)},
+		}.Encode()
+		rsp, err := r.sendRequest("GET", endpoint, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "REST request failed")
+		}
+		if rsp.StatusCode != http.StatusOK {
+			rsp.Body.Close()
+			return nil, r.statusCodeToError("list DNS records", rsp)
+		}
+		return rsp, nil
+	}
+
+	return fetchExhaustively[DNSRecord](fetchFn)
+}
+
+// UpdateDNSRecord sets the TTL and proxied status of a record, those left unset in options are kept.
+func (r *RESTClient) UpdateDNSRecord(zoneID string, recordID string, options DNSRecordOptions) error {
+	endpoint := r.baseEndpoints.zones
+	endpoint.Path = path.Join(endpoint.Path, url.PathEscape(zoneID), "dns_records", url.PathEscape(recordID))
+	resp, err := r.sendRequest("PATCH", endpoint, options)
+	if err != nil {
+		return errors.Wrap(err, "REST request failed")
+	}
+	defer resp.Body.Close()
+
+	return r.statusCodeToError("update DNS record", resp)
+}
+
+func (r *RESTClient) DeleteDNSRecord(zoneID string, recordID string) error {
+	endpoint := r.baseEndpoints.zones
+	endpoint.Path = path.Join(endpoint.Path, url.PathEscape(zoneID), "dns_records", url.PathEscape(recordID))
+	resp, err := r.sendRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return errors.Wrap(err, "REST request failed")
+	}
+	defer resp.Body.Close()
+
+	return r.statusCodeToError("delete DNS record", resp)
+}
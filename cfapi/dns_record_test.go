@@ -0,0 +1,15 @@
+package cfapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneOf(t *testing.T) {
+	zones := []*Zone{{ID: "1", Name: "example.com"}, {ID: "2", Name: "eu.example.com"}, {ID: "3", Name: "ample.com"}}
+	assert.Equal(t, "1", ZoneOf(zones, "example.com").ID)
+	assert.Equal(t, "1", ZoneOf(zones, "App.Example.com.").ID)
+	assert.Equal(t, "2", ZoneOf(zones, "app.eu.example.com").ID)
+	assert.Nil(t, ZoneOf(zones, "app.example.org"))
+}
@@ -35,6 +35,15 @@ type HostnameRouteResult interface {
 type DNSRoute struct {
 	userHostname      string
 	overwriteExisting bool
+	options           DNSRecordOptions
+}
+
+// DNSRecordOptions are the settings of the CNAME record of a DNS route, the zone defaults apply to those left unset.
+// The tunnel routes API doesn't accept them, they are set on the record with the DNS API once it is routed.
+type DNSRecordOptions struct {
+	// TTL of the record in seconds, 1 is automatic
+	TTL     int   `json:"ttl,omitempty"`
+	Proxied *bool `json:"proxied,omitempty"`
 }
 
 type DNSRouteResult struct {
@@ -44,9 +53,14 @@ type DNSRouteResult struct {
 }
 
 func NewDNSRoute(userHostname string, overwriteExisting bool) HostnameRoute {
+	return NewDNSRouteWithOptions(userHostname, overwriteExisting, DNSRecordOptions{})
+}
+
+func NewDNSRouteWithOptions(userHostname string, overwriteExisting bool, options DNSRecordOptions) HostnameRoute {
 	return &DNSRoute{
 		userHostname:      userHostname,
 		overwriteExisting: overwriteExisting,
+		options:           options,
 	}
 }
 
@@ -74,6 +88,15 @@ func (dr *DNSRoute) RecordType() string {
 	return "dns"
 }
 
+func (dr *DNSRoute) Hostname() string {
+	return dr.userHostname
+}
+
+// RecordOptions are the settings to apply to the CNAME record once it is routed.
+func (dr *DNSRoute) RecordOptions() DNSRecordOptions {
+	return dr.options
+}
+
 func (dr *DNSRoute) String() string {
 	return fmt.Sprintf("%s %s", dr.RecordType(), dr.userHostname)
 }
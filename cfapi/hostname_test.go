@@ -1,6 +1,7 @@
 package cfapi
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -35,6 +36,18 @@ func TestDNSRouteUnmarshalResult(t *testing.T) {
 	}
 }
 
+func TestDNSRouteMarshalJSON(t *testing.T) {
+	body, err := json.Marshal(NewDNSRoute("example.com", true))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "dns", "user_hostname": "example.com", "overwrite_existing": true}`, string(body))
+
+	// The routes API doesn't accept the settings of the record
+	proxied := false
+	body, err = json.Marshal(NewDNSRouteWithOptions("example.com", false, DNSRecordOptions{TTL: 300, Proxied: &proxied}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "dns", "user_hostname": "example.com", "overwrite_existing": false}`, string(body))
+}
+
 func TestLBRouteUnmarshalResult(t *testing.T) {
 	route := &LBRoute{
 		lbName: "lb.example.com",
@@ -21,6 +21,13 @@ type Tunnel struct {
 	CreatedAt   time.Time    `json:"created_at"`
 	DeletedAt   time.Time    `json:"deleted_at"`
 	Connections []Connection `json:"connections"`
+	Metadata    Metadata     `json:"metadata"`
+}
+
+// Metadata is the free-form metadata the API stores along with a tunnel.
+type Metadata struct {
+	// Labels are the key=value pairs the tunnel was created with to organize tunnels
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type TunnelWithToken struct {
@@ -46,7 +53,12 @@ type ActiveClient struct {
 }
 
 type newTunnel struct {
-	Name         string `json:"name"`
+	Name         string    `json:"name"`
+	TunnelSecret []byte    `json:"tunnel_secret"`
+	Metadata     *Metadata `json:"metadata,omitempty"`
+}
+
+type updateTunnelSecret struct {
 	TunnelSecret []byte `json:"tunnel_secret"`
 }
 
@@ -72,7 +84,7 @@ func (cp CleanupParams) encode() string {
 	return cp.queryParams.Encode()
 }
 
-func (r *RESTClient) CreateTunnel(name string, tunnelSecret []byte) (*TunnelWithToken, error) {
+func (r *RESTClient) CreateTunnel(name string, tunnelSecret []byte, labels map[string]string) (*TunnelWithToken, error) {
 	if name == "" {
 		return nil, errors.New("tunnel name required")
 	}
@@ -83,6 +95,9 @@ func (r *RESTClient) CreateTunnel(name string, tunnelSecret []byte) (*TunnelWith
 		Name:         name,
 		TunnelSecret: tunnelSecret,
 	}
+	if len(labels) > 0 {
+		body.Metadata = &Metadata{Labels: labels}
+	}
 
 	resp, err := r.sendRequest("POST", r.baseEndpoints.accountLevel, body)
 	if err != nil {
@@ -120,6 +135,24 @@ func (r *RESTClient) GetTunnel(tunnelID uuid.UUID) (*Tunnel, error) {
 	return nil, r.statusCodeToError("get tunnel", resp)
 }
 
+// RotateTunnelSecret replaces the secret of the tunnel. Connectors that registered with the previous secret stay
+// connected, but they can't reconnect with it.
+func (r *RESTClient) RotateTunnelSecret(tunnelID uuid.UUID, tunnelSecret []byte) (*Tunnel, error) {
+	endpoint := r.baseEndpoints.accountLevel
+	endpoint.Path = path.Join(endpoint.Path, fmt.Sprintf("%v", tunnelID))
+	resp, err := r.sendRequest("PATCH", endpoint, &updateTunnelSecret{TunnelSecret: tunnelSecret})
+	if err != nil {
+		return nil, errors.Wrap(err, "REST request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return unmarshalTunnel(resp.Body)
+	}
+
+	return nil, r.statusCodeToError("rotate tunnel secret", resp)
+}
+
 func (r *RESTClient) GetTunnelToken(tunnelID uuid.UUID) (token string, err error) {
 	endpoint := r.baseEndpoints.accountLevel
 	endpoint.Path = path.Join(endpoint.Path, fmt.Sprintf("%v/token", tunnelID))
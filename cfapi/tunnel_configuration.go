@@ -0,0 +1,62 @@
+package cfapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// TunnelConfiguration is the remotely managed configuration of a tunnel. Config is kept as the JSON of the API, with
+// the ingress, warp-routing and originRequest settings.
+type TunnelConfiguration struct {
+	TunnelID  uuid.UUID       `json:"tunnel_id"`
+	Version   int             `json:"version"`
+	Config    json.RawMessage `json:"config"`
+	Source    string          `json:"source,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type updateTunnelConfiguration struct {
+	Config json.RawMessage `json:"config"`
+}
+
+func (r *RESTClient) GetTunnelConfiguration(tunnelID uuid.UUID) (*TunnelConfiguration, error) {
+	endpoint := r.baseEndpoints.accountLevel
+	endpoint.Path = path.Join(endpoint.Path, fmt.Sprintf("%v/configurations", tunnelID))
+	resp, err := r.sendRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "REST request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		var configuration TunnelConfiguration
+		return &configuration, parseResponse(resp.Body, &configuration)
+	}
+
+	return nil, r.statusCodeToError("get tunnel configuration", resp)
+}
+
+// UpdateTunnelConfiguration replaces the remote configuration of the tunnel, the edge then pushes the new version to
+// its connectors.
+func (r *RESTClient) UpdateTunnelConfiguration(tunnelID uuid.UUID, config json.RawMessage) (*TunnelConfiguration, error) {
+	endpoint := r.baseEndpoints.accountLevel
+	endpoint.Path = path.Join(endpoint.Path, fmt.Sprintf("%v/configurations", tunnelID))
+	resp, err := r.sendRequest("PUT", endpoint, &updateTunnelConfiguration{Config: config})
+	if err != nil {
+		return nil, errors.Wrap(err, "REST request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		var configuration TunnelConfiguration
+		return &configuration, parseResponse(resp.Body, &configuration)
+	}
+
+	return nil, r.statusCodeToError("update tunnel configuration", resp)
+}
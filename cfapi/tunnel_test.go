@@ -2,6 +2,7 @@ package cfapi
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net"
 	"reflect"
@@ -36,6 +37,16 @@ func Test_unmarshalTunnel(t *testing.T) {
 				Connections: nil,
 			},
 		},
+		{
+			name: "labels",
+			args: args{body: `{"success": true, "result": {"id":"b34cc7ce-925b-46ee-bc23-4cb5c18d8292","created_at":"2021-07-29T13:46:14.090955Z","name":"web","metadata":{"labels":{"env":"prod"}}}}`},
+			want: &Tunnel{
+				ID:        uuid.MustParse("b34cc7ce-925b-46ee-bc23-4cb5c18d8292"),
+				Name:      "web",
+				CreatedAt: time.Date(2021, 07, 29, 13, 46, 14, 90955000, loc),
+				Metadata:  Metadata{Labels: map[string]string{"env": "prod"}},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -100,3 +111,13 @@ func TestUnmarshalConnections(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []*ActiveClient{&expected}, actual)
 }
+
+func TestNewTunnelMetadata(t *testing.T) {
+	body, err := json.Marshal(newTunnel{Name: "web"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "metadata")
+
+	body, err = json.Marshal(newTunnel{Name: "web", Metadata: &Metadata{Labels: map[string]string{"env": "prod"}}})
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"metadata":{"labels":{"env":"prod"}}`)
+}
@@ -74,7 +74,11 @@ func (r *RESTClient) ListVirtualNetworks(filter *VnetFilter) ([]*VirtualNetwork,
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
-		return parseListVnets(resp.Body)
+		vnets, err := parseListVnets(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return filter.filter(vnets), nil
 	}
 
 	return nil, r.statusCodeToError("list virtual networks", resp)
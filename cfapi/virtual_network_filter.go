@@ -18,6 +18,10 @@ var (
 		Name:  "name",
 		Usage: "List virtual networks with the given `NAME`",
 	}
+	filterVnetByComment = cli.StringFlag{
+		Name:  "comment",
+		Usage: "List virtual networks with the given `COMMENT`",
+	}
 	filterDefaultVnet = cli.BoolFlag{
 		Name:  "is-default",
 		Usage: "If true, lists the virtual network that is the default one. If false, lists all non-default virtual networks for the account. If absent, all are included in the results regardless of their default status.",
@@ -29,6 +33,7 @@ var (
 	VnetFilterFlags = []cli.Flag{
 		&filterVnetId,
 		&filterVnetByName,
+		&filterVnetByComment,
 		&filterDefaultVnet,
 		&filterDeletedVnet,
 	}
@@ -37,6 +42,8 @@ var (
 // VnetFilter which virtual networks get queried.
 type VnetFilter struct {
 	queryParams url.Values
+	// comment is matched by the client, the API can't filter on it
+	comment string
 }
 
 func NewVnetFilter() *VnetFilter {
@@ -53,6 +60,10 @@ func (f *VnetFilter) ByName(name string) {
 	f.queryParams.Set("name", name)
 }
 
+func (f *VnetFilter) ByComment(comment string) {
+	f.comment = comment
+}
+
 func (f *VnetFilter) ByDefaultStatus(isDefault bool) {
 	f.queryParams.Set("is_default", strconv.FormatBool(isDefault))
 }
@@ -69,6 +80,20 @@ func (f VnetFilter) Encode() string {
 	return f.queryParams.Encode()
 }
 
+// filter returns the virtual networks matching the filters that the API doesn't apply.
+func (f VnetFilter) filter(vnets []*VirtualNetwork) []*VirtualNetwork {
+	if f.comment == "" {
+		return vnets
+	}
+	var filtered []*VirtualNetwork
+	for _, vnet := range vnets {
+		if vnet.Comment == f.comment {
+			filtered = append(filtered, vnet)
+		}
+	}
+	return filtered
+}
+
 // NewFromCLI parses CLI flags to discover which filters should get applied to list virtual networks.
 func NewFromCLI(c *cli.Context) (*VnetFilter, error) {
 	f := NewVnetFilter()
@@ -85,6 +110,10 @@ func NewFromCLI(c *cli.Context) (*VnetFilter, error) {
 		f.ByName(name)
 	}
 
+	if comment := c.String("comment"); comment != "" {
+		f.ByComment(comment)
+	}
+
 	if c.IsSet("is-default") {
 		f.ByDefaultStatus(c.Bool("is-default"))
 	}
@@ -2,12 +2,14 @@ package cfapi
 
 import (
 	"encoding/json"
+	"flag"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 )
 
 func TestVirtualNetworkJsonRoundtrip(t *testing.T) {
@@ -77,3 +79,22 @@ func TestVnetTableString(t *testing.T) {
 	require.True(t, strings.Contains(row, "true"))
 	require.True(t, strings.HasSuffix(row, "-\t"))
 }
+
+func TestVnetFilterFromCLI(t *testing.T) {
+	flagSet := flag.NewFlagSet("list", flag.PanicOnError)
+	for _, f := range VnetFilterFlags {
+		require.NoError(t, f.Apply(flagSet))
+	}
+	vnetID := uuid.New()
+	require.NoError(t, flagSet.Parse([]string{"--id", vnetID.String(), "--comment", "New York DC1", "--is-default=false"}))
+
+	filter, err := NewFromCLI(cli.NewContext(cli.NewApp(), flagSet, nil))
+	require.NoError(t, err)
+	// The comment isn't sent to the API, which doesn't support it
+	require.Equal(t, "id="+vnetID.String()+"&is_default=false&is_deleted=false", filter.Encode())
+
+	dc1 := &VirtualNetwork{Name: "dc1", Comment: "New York DC1"}
+	dc2 := &VirtualNetwork{Name: "dc2", Comment: "New York DC2"}
+	require.Equal(t, []*VirtualNetwork{dc1}, filter.filter([]*VirtualNetwork{dc1, dc2}))
+	require.Equal(t, []*VirtualNetwork{dc1, dc2}, NewVnetFilter().filter([]*VirtualNetwork{dc1, dc2}))
+}
@@ -5,22 +5,67 @@ import (
 	"sync"
 )
 
-const defaultBufferSize = 16 * 1024
+const (
+	smallBufferSize   = 4 * 1024
+	defaultBufferSize = 16 * 1024
+	largeBufferSize   = 64 * 1024
+)
+
+// bufferTier is a pool of buffers of the same size. It pools pointers to the buffers, so that putting them back
+// doesn't allocate.
+type bufferTier struct {
+	size int
+	pool sync.Pool
+}
+
+func newBufferTier(size int) *bufferTier {
+	return &bufferTier{
+		size: size,
+		pool: sync.Pool{
+			New: func() interface{} {
+				buffer := make([]byte, size)
+				return &buffer
+			},
+		},
+	}
+}
 
-var bufferPool = sync.Pool{
-	New: func() interface{} {
-		return make([]byte, defaultBufferSize)
-	},
+// bufferTiers are ordered by size, small bodies don't hold on to large buffers and large bodies are copied with
+// fewer reads and writes.
+var bufferTiers = []*bufferTier{
+	newBufferTier(smallBufferSize),
+	newBufferTier(defaultBufferSize),
+	newBufferTier(largeBufferSize),
+}
+
+// tierFor returns the smallest tier whose buffers fit sizeHint bytes, the default tier if the size is unknown.
+func tierFor(sizeHint int64) *bufferTier {
+	if sizeHint < 0 {
+		return bufferTiers[1]
+	}
+	for _, tier := range bufferTiers {
+		if sizeHint <= int64(tier.size) {
+			return tier
+		}
+	}
+	return bufferTiers[len(bufferTiers)-1]
 }
 
 func Copy(dst io.Writer, src io.Reader) (written int64, err error) {
+	return CopySized(dst, src, -1)
+}
+
+// CopySized is Copy with a buffer sized for sizeHint bytes, e.g. the Content-Length of a body, negative if unknown.
+func CopySized(dst io.Writer, src io.Reader, sizeHint int64) (written int64, err error) {
 	_, okWriteTo := src.(io.WriterTo)
 	_, okReadFrom := dst.(io.ReaderFrom)
 	var buffer []byte = nil
 
 	if !(okWriteTo || okReadFrom) {
-		buffer = bufferPool.Get().([]byte)
-		defer bufferPool.Put(buffer)
+		tier := tierFor(sizeHint)
+		pooled := tier.pool.Get().(*[]byte)
+		defer tier.pool.Put(pooled)
+		buffer = *pooled
 	}
 
 	return io.CopyBuffer(dst, src, buffer)
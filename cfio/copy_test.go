@@ -0,0 +1,58 @@
+package cfio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTierFor(t *testing.T) {
+	assert.Equal(t, defaultBufferSize, tierFor(-1).size)
+	assert.Equal(t, smallBufferSize, tierFor(0).size)
+	assert.Equal(t, smallBufferSize, tierFor(smallBufferSize).size)
+	assert.Equal(t, defaultBufferSize, tierFor(smallBufferSize+1).size)
+	assert.Equal(t, largeBufferSize, tierFor(defaultBufferSize+1).size)
+	assert.Equal(t, largeBufferSize, tierFor(1<<30).size)
+}
+
+// onlyReader and onlyWriter hide the io.WriterTo and io.ReaderFrom of strings.Reader and bytes.Buffer, so that
+// copying goes through a pooled buffer.
+type onlyReader struct {
+	r *strings.Reader
+}
+
+func (o onlyReader) Read(p []byte) (int, error) {
+	return o.r.Read(p)
+}
+
+type onlyWriter struct {
+	w *bytes.Buffer
+}
+
+func (o onlyWriter) Write(p []byte) (int, error) {
+	return o.w.Write(p)
+}
+
+func TestCopySized(t *testing.T) {
+	body := strings.Repeat("cloudflared", 10_000)
+	var out bytes.Buffer
+	written, err := CopySized(onlyWriter{&out}, onlyReader{strings.NewReader(body)}, int64(len(body)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(body)), written)
+	assert.Equal(t, body, out.String())
+}
+
+func TestCopySizedReusesBuffers(t *testing.T) {
+	var out bytes.Buffer
+	out.Grow(smallBufferSize)
+	src := strings.NewReader("hello")
+	allocs := testing.AllocsPerRun(100, func() {
+		out.Reset()
+		src.Reset("hello")
+		_, _ = CopySized(onlyWriter{&out}, onlyReader{src}, 5)
+	})
+	assert.Less(t, allocs, float64(1))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -15,13 +16,18 @@ import (
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/logger"
 	"github.com/cloudflare/cloudflared/stream"
+	"github.com/cloudflare/cloudflared/token"
 	"github.com/cloudflare/cloudflared/validation"
 )
 
 const (
 	LogFieldHost               = "host"
-	cfAccessClientIDHeader     = "Cf-Access-Client-Id"
-	cfAccessClientSecretHeader = "Cf-Access-Client-Secret"
+	cfAccessClientIDHeader     = token.AccessClientIDHeader
+	cfAccessClientSecretHeader = token.AccessClientSecretHeader
+
+	serviceTokenIDEnv     = "TUNNEL_SERVICE_TOKEN_ID"
+	serviceTokenSecretEnv = "TUNNEL_SERVICE_TOKEN_SECRET"
+	serviceTokenFileEnv   = "TUNNEL_SERVICE_TOKEN_FILE"
 )
 
 // StartForwarder starts a client side websocket forward
@@ -56,6 +62,14 @@ func StartForwarder(forwarder config.Forwarder, shutdown <-chan struct{}, log *z
 	return carrier.StartForwarder(wsConn, validURL.Host, shutdown, options)
 }
 
+// loadServiceToken returns the service token of the file if there is one, or the provided client ID and secret.
+func loadServiceToken(clientID, clientSecret, file string) (token.ServiceToken, error) {
+	if file != "" {
+		return token.LoadServiceTokenFile(file)
+	}
+	return token.ServiceToken{ClientID: clientID, ClientSecret: clientSecret}, nil
+}
+
 // ssh will start a WS proxy server for server mode
 // or copy from stdin/stdout for client mode
 // useful for proxying other protocols (like ssh) over websockets
@@ -76,22 +90,78 @@ func ssh(c *cli.Context) error {
 		return cli.ShowCommandHelp(c, "ssh")
 	}
 
+	options, err := carrierOptions(c, url, log)
+	if err != nil {
+		return err
+	}
+
+	// we could add a cmd line variable for this bool if we want the SOCK5 server to be on the client side
+	wsConn := carrier.NewWSConnection(log)
+
+	if c.NArg() > 0 || c.IsSet(sshURLFlag) {
+		forwarder, err := config.ValidateUrl(c, true)
+		if err != nil {
+			log.Err(err).Msg("Error validating origin URL")
+			return errors.Wrap(err, "error validating origin URL")
+		}
+		log.Info().Str(LogFieldHost, forwarder.Host).Msg("Start Websocket listener")
+		err = carrier.StartForwarder(wsConn, forwarder.Host, shutdownC, options)
+		if err != nil {
+			log.Err(err).Msg("Error on Websocket listener")
+		}
+		return err
+	}
+
+	if c.Bool(sshMultiplexServerFlag) {
+		return runMultiplexServer(url, options, c.Duration(sshMultiplexIdleTimeoutFlag), log)
+	}
+
+	var s io.ReadWriter
+	s = &carrier.StdinoutStream{}
+	if c.IsSet(sshDebugStream) {
+		maxMessages := c.Uint64(sshDebugStream)
+		if maxMessages == 0 {
+			// default to 10 if provided but unset
+			maxMessages = 10
+		}
+		logger := log.With().Str("host", url.Host).Logger()
+		s = stream.NewDebugStream(s, &logger, maxMessages)
+	}
+	if c.Bool(sshMultiplexFlag) {
+		err := serveMultiplexed(url, options, s, log)
+		if err == nil {
+			return nil
+		}
+		log.Debug().Err(err).Msg("Connecting without the multiplexing server")
+	}
+	carrier.StartClient(wsConn, s, options)
+	return nil
+}
+
+// carrierOptions returns the options to forward data to the application at appURL, from the headers, service token and
+// connection override flags.
+func carrierOptions(c *cli.Context, appURL *url.URL, log *zerolog.Logger) (*carrier.StartOptions, error) {
 	// get the headers from the cmdline and add them
 	headers := parseRequestHeaders(c.StringSlice(sshHeaderFlag))
-	if c.IsSet(sshTokenIDFlag) {
-		headers.Set(cfAccessClientIDHeader, c.String(sshTokenIDFlag))
+	serviceToken, err := loadServiceToken(c.String(sshTokenIDFlag), c.String(sshTokenSecretFlag), c.String(sshTokenFileFlag))
+	if err != nil {
+		log.Err(err).Send()
+		return nil, err
+	}
+	if serviceToken.ClientID != "" {
+		headers.Set(cfAccessClientIDHeader, serviceToken.ClientID)
 	}
-	if c.IsSet(sshTokenSecretFlag) {
-		headers.Set(cfAccessClientSecretHeader, c.String(sshTokenSecretFlag))
+	if serviceToken.ClientSecret != "" {
+		headers.Set(cfAccessClientSecretHeader, serviceToken.ClientSecret)
 	}
 	headers.Set("User-Agent", userAgent)
 
 	carrier.SetBastionDest(headers, c.String(sshDestinationFlag))
 
 	options := &carrier.StartOptions{
-		OriginURL: url.String(),
+		OriginURL: appURL.String(),
 		Headers:   headers,
-		Host:      url.Host,
+		Host:      appURL.Host,
 	}
 
 	if connectTo := c.String(sshConnectTo); connectTo != "" {
@@ -109,38 +179,81 @@ func ssh(c *cli.Context) error {
 			}
 			log.Warn().Msgf("Using insecure SSL connection because SNI overridden to %s", parts[0])
 		default:
-			return fmt.Errorf("invalid connection override: %s", connectTo)
+			return nil, fmt.Errorf("invalid connection override: %s", connectTo)
 		}
 	}
 
-	// we could add a cmd line variable for this bool if we want the SOCK5 server to be on the client side
-	wsConn := carrier.NewWSConnection(log)
-
-	if c.NArg() > 0 || c.IsSet(sshURLFlag) {
-		forwarder, err := config.ValidateUrl(c, true)
-		if err != nil {
-			log.Err(err).Msg("Error validating origin URL")
-			return errors.Wrap(err, "error validating origin URL")
-		}
-		log.Info().Str(LogFieldHost, forwarder.Host).Msg("Start Websocket listener")
-		err = carrier.StartForwarder(wsConn, forwarder.Host, shutdownC, options)
-		if err != nil {
-			log.Err(err).Msg("Error on Websocket listener")
+	clientTLS, err := clientCertSettingsFrom(c).tlsConfig(appURL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if clientTLS != nil {
+		if options.TLSClientConfig == nil {
+			options.TLSClientConfig = &tls.Config{}
 		}
+		options.TLSClientConfig.Certificates = clientTLS.Certificates
+	}
+	return options, nil
+}
+
+// serveLocalListener forwards the connections of the listener of the command to the application until cloudflared is
+// stopped. The listener must be a loopback address unless remote clients are allowed.
+func serveLocalListener(c *cli.Context, command string, conn carrier.Connection, log *zerolog.Logger) error {
+	address, options, err := localListenerOptions(c, command, log)
+	if err != nil || options == nil {
 		return err
 	}
 
-	var s io.ReadWriter
-	s = &carrier.StdinoutStream{}
-	if c.IsSet(sshDebugStream) {
-		maxMessages := c.Uint64(sshDebugStream)
-		if maxMessages == 0 {
-			// default to 10 if provided but unset
-			maxMessages = 10
+	log.Info().Str(LogFieldHost, address).Msgf("Start %s listener", command)
+	err = carrier.StartForwarder(conn, address, shutdownC, options)
+	if err != nil {
+		log.Err(err).Msgf("Error on %s listener", command)
+	}
+	return err
+}
+
+// localListenerOptions validates the address of the local listener of the command and returns it with the options
+// of the connections to the application. The options are nil if the usage of the command was shown instead.
+func localListenerOptions(c *cli.Context, command string, log *zerolog.Logger) (string, *carrier.StartOptions, error) {
+	url, err := parseURL(c.String(sshHostnameFlag))
+	if err != nil {
+		log.Err(err).Send()
+		return "", nil, cli.ShowCommandHelp(c, command)
+	}
+	if c.NArg() == 0 && !c.IsSet(sshURLFlag) {
+		log.Error().Msgf("--%s is required to listen for clients", sshURLFlag)
+		return "", nil, cli.ShowCommandHelp(c, command)
+	}
+	forwarder, err := config.ValidateUrl(c, true)
+	if err != nil {
+		log.Err(err).Msg("Error validating origin URL")
+		return "", nil, errors.Wrap(err, "error validating origin URL")
+	}
+	if err := checkLocalListener(forwarder.Host, c.Bool(allowRemoteFlag)); err != nil {
+		return "", nil, err
+	}
+
+	options, err := carrierOptions(c, url, log)
+	if err != nil {
+		return "", nil, err
+	}
+	// Clients give up before a login started by their connection could complete
+	if options.Headers.Get(cfAccessClientIDHeader) == "" {
+		if err := fetchTokenAhead(url, options.TLSClientConfig, log); err != nil {
+			log.Debug().Err(err).Msg("Not logging in before the first client connects")
 		}
-		logger := log.With().Str("host", url.Host).Logger()
-		s = stream.NewDebugStream(s, &logger, maxMessages)
 	}
-	carrier.StartClient(wsConn, s, options)
-	return nil
+	return forwarder.Host, options, nil
+}
+
+// fetchTokenAhead makes sure there is a token for the application, if it's behind Access.
+func fetchTokenAhead(appURL *url.URL, tlsConfig *tls.Config, log *zerolog.Logger) error {
+	// fetching the token mutates the URL
+	fetchTokenURL := *appURL
+	appInfo, err := token.GetAppInfo(&fetchTokenURL, tlsConfig)
+	if err != nil {
+		return err
+	}
+	_, err = token.FetchTokenWithRedirect(&fetchTokenURL, appInfo, &token.LoginOptions{TLSClientConfig: tlsConfig}, log)
+	return err
 }
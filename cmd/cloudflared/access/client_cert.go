@@ -0,0 +1,227 @@
+package access
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/token"
+)
+
+const (
+	clientCertFlag      = "client-cert"
+	clientKeyFlag       = "client-key"
+	clientCertsFileFlag = "client-certs-file"
+
+	clientCertEnv      = "TUNNEL_ACCESS_CLIENT_CERT"
+	clientKeyEnv       = "TUNNEL_ACCESS_CLIENT_KEY"
+	clientCertsFileEnv = "TUNNEL_ACCESS_CLIENT_CERTS_FILE"
+
+	clientCertNameFlag = "name"
+
+	// defaultClientCertsFile maps the hostnames of applications requiring mTLS to their client certificates, e.g.
+	//
+	//	ssh.example.com:
+	//	  cert: ~/certs/laptop.pem
+	//	  key: ~/certs/laptop-key.pem
+	//	rdp.example.com:
+	//	  cert: keychain:laptop
+	defaultClientCertsFile = "~/.cloudflared/client-certs.yml"
+
+	// keychainCertPrefix references a client certificate imported in the keychain of the OS by the
+	// import-client-cert command, instead of a file
+	keychainCertPrefix = "keychain:"
+)
+
+// readKeychainSecret is replaced by the tests, they don't have a keychain
+var readKeychainSecret = token.ReadKeychainSecret
+
+// clientCertificate is a PEM certificate and its key presented to applications that require mTLS. The key is read
+// from the certificate file if it's not set.
+type clientCertificate struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// clientCertSettings are the client certificate flags of an invocation.
+type clientCertSettings struct {
+	cert      string
+	key       string
+	certsFile string
+}
+
+// clientCertSettingsFrom reads the client certificate flags of the command, or the environment for the commands
+// passing their flags to another program, like curl.
+func clientCertSettingsFrom(c *cli.Context) clientCertSettings {
+	flagOrEnv := func(flag, env string) string {
+		if value := c.String(flag); value != "" {
+			return value
+		}
+		return os.Getenv(env)
+	}
+	return clientCertSettings{
+		cert:      flagOrEnv(clientCertFlag, clientCertEnv),
+		key:       flagOrEnv(clientKeyFlag, clientKeyEnv),
+		certsFile: flagOrEnv(clientCertsFileFlag, clientCertsFileEnv),
+	}
+}
+
+// tlsConfig returns the TLS config presenting the client certificate of the hostname, or nil if it has none.
+func (s clientCertSettings) tlsConfig(hostname string) (*tls.Config, error) {
+	clientCert, ok, err := clientCertificateFor(hostname, s.cert, s.key, s.certsFile)
+	if err != nil || !ok {
+		return nil, err
+	}
+	certificate, err := clientCert.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{certificate}}, nil
+}
+
+// clientCertificateFor returns the client certificate of the invocation if set, or the one of the hostname in the
+// client certificates file. It returns false if the application has no client certificate.
+func clientCertificateFor(hostname, cert, key, certsFile string) (clientCertificate, bool, error) {
+	if cert != "" {
+		return clientCertificate{Cert: cert, Key: key}, true, nil
+	}
+	if certsFile == "" {
+		certsFile = defaultClientCertsFile
+	}
+	path, err := homedir.Expand(certsFile)
+	if err != nil {
+		return clientCertificate{}, false, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return clientCertificate{}, false, nil
+	}
+	if err != nil {
+		return clientCertificate{}, false, errors.Wrap(err, "failed to read the client certificates file")
+	}
+	var certs map[string]clientCertificate
+	if err := yaml.Unmarshal(content, &certs); err != nil {
+		return clientCertificate{}, false, errors.Wrapf(err, "failed to parse the client certificates file %s", path)
+	}
+	c, ok := certs[hostname]
+	if ok && c.Cert == "" {
+		return clientCertificate{}, false, errors.Errorf("the client certificate of %s in %s has no cert", hostname, path)
+	}
+	return c, ok, nil
+}
+
+// keychainName returns the name of the client certificate in the keychain, if it's stored there.
+func (c clientCertificate) keychainName() (string, bool) {
+	if !strings.HasPrefix(c.Cert, keychainCertPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(c.Cert, keychainCertPrefix), true
+}
+
+// paths returns the expanded paths of the certificate and of the key.
+func (c clientCertificate) paths() (string, string, error) {
+	cert, err := homedir.Expand(c.Cert)
+	if err != nil {
+		return "", "", err
+	}
+	if c.Key == "" {
+		return cert, cert, nil
+	}
+	key, err := homedir.Expand(c.Key)
+	if err != nil {
+		return "", "", err
+	}
+	return cert, key, nil
+}
+
+func (c clientCertificate) load() (tls.Certificate, error) {
+	if name, ok := c.keychainName(); ok {
+		pemBlocks, err := readKeychainSecret(name)
+		if err != nil {
+			return tls.Certificate{}, errors.Wrapf(err, "failed to read the client certificate %s from the keychain", name)
+		}
+		certificate, err := tls.X509KeyPair(pemBlocks, pemBlocks)
+		if err != nil {
+			return tls.Certificate{}, errors.Wrapf(err, "failed to load the client certificate %s from the keychain", name)
+		}
+		return certificate, nil
+	}
+	cert, key, err := c.paths()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certificate, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "failed to load the client certificate")
+	}
+	return certificate, nil
+}
+
+// importClientCert stores a client certificate and its key in the keychain of the OS, so that they're referenced as
+// keychain:<name> instead of being read from files.
+func importClientCert(c *cli.Context) error {
+	name := c.String(clientCertNameFlag)
+	if name == "" || c.String(clientCertFlag) == "" {
+		return cli.ShowCommandHelp(c, "import-client-cert")
+	}
+	clientCert := clientCertificate{Cert: c.String(clientCertFlag), Key: c.String(clientKeyFlag)}
+	pemBlocks, err := clientCert.pem()
+	if err != nil {
+		return err
+	}
+	if err := token.WriteKeychainSecret(name, pemBlocks); err != nil {
+		return errors.Wrap(err, "failed to store the client certificate in the keychain")
+	}
+	fmt.Fprintf(os.Stdout, "Imported the client certificate, use it with --%s %s%s\n", clientCertFlag, keychainCertPrefix, name)
+	return nil
+}
+
+// pem returns the certificate followed by its key, after checking that they match.
+func (c clientCertificate) pem() ([]byte, error) {
+	cert, key, err := c.paths()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tls.LoadX509KeyPair(cert, key); err != nil {
+		return nil, errors.Wrap(err, "failed to load the client certificate")
+	}
+	certPEM, err := os.ReadFile(cert)
+	if err != nil {
+		return nil, err
+	}
+	if key == cert {
+		return certPEM, nil
+	}
+	keyPEM, err := os.ReadFile(key)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(certPEM, '\n'), keyPEM...), nil
+}
+
+// writeKeychainCertFile writes the client certificate stored in the keychain under the name to a file only the user
+// can read, for programs that only read certificates from files. The returned function removes it.
+func writeKeychainCertFile(name string) (string, func(), error) {
+	pemBlocks, err := readKeychainSecret(name)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to read the client certificate %s from the keychain", name)
+	}
+	dir, err := os.MkdirTemp("", "cloudflared-client-cert")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { _ = os.RemoveAll(dir) }
+	path := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(path, pemBlocks, 0600); err != nil {
+		remove()
+		return "", nil, err
+	}
+	return path, remove, nil
+}
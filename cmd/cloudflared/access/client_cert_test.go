@@ -0,0 +1,122 @@
+package access
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "laptop"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, "laptop.pem")
+	keyPath := filepath.Join(dir, "laptop-key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certPath, keyPath
+}
+
+func TestClientCertificateFor(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeClientCertificate(t, dir)
+	certsFile := filepath.Join(dir, "client-certs.yml")
+	require.NoError(t, os.WriteFile(certsFile, []byte(`
+ssh.example.com:
+  cert: `+certPath+`
+  key: `+keyPath+`
+broken.example.com:
+  key: `+keyPath+`
+`), 0600))
+
+	clientCert, ok, err := clientCertificateFor("ssh.example.com", "", "", certsFile)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, clientCertificate{Cert: certPath, Key: keyPath}, clientCert)
+	certificate, err := clientCert.load()
+	require.NoError(t, err)
+	assert.NotEmpty(t, certificate.Certificate)
+
+	// The certificate of the invocation wins over the file
+	clientCert, ok, err = clientCertificateFor("ssh.example.com", "/other.pem", "", certsFile)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "/other.pem", clientCert.Cert)
+	cert, key, err := clientCert.paths()
+	require.NoError(t, err)
+	assert.Equal(t, cert, key)
+
+	_, ok, err = clientCertificateFor("rdp.example.com", "", "", certsFile)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, _, err = clientCertificateFor("broken.example.com", "", "", certsFile)
+	assert.Error(t, err)
+	_, ok, err = clientCertificateFor("ssh.example.com", "", "", filepath.Join(dir, "missing.yml"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestKeychainClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeClientCertificate(t, dir)
+	pemBlocks, err := clientCertificate{Cert: certPath, Key: keyPath}.pem()
+	require.NoError(t, err)
+	previous := readKeychainSecret
+	readKeychainSecret = func(name string) ([]byte, error) {
+		if name != "laptop" {
+			return nil, errors.New("item not found in the keychain")
+		}
+		return pemBlocks, nil
+	}
+	t.Cleanup(func() { readKeychainSecret = previous })
+	certsFile := filepath.Join(dir, "client-certs.yml")
+	require.NoError(t, os.WriteFile(certsFile, []byte("rdp.example.com:\n  cert: keychain:laptop\n"), 0600))
+	settings := clientCertSettings{certsFile: certsFile}
+
+	tlsConfig, err := settings.tlsConfig("rdp.example.com")
+	require.NoError(t, err)
+	require.Len(t, tlsConfig.Certificates, 1)
+	tlsConfig, err = settings.tlsConfig("ssh.example.com")
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+	_, err = clientCertSettings{cert: "keychain:other"}.tlsConfig("rdp.example.com")
+	assert.Error(t, err)
+
+	// curl reads the certificate from a file that is removed once it exited
+	args, remove, err := curlClientCertArgs(nil, settings, "rdp.example.com")
+	require.NoError(t, err)
+	require.Len(t, args, 2)
+	assert.Equal(t, "--cert", args[0])
+	content, err := os.ReadFile(args[1])
+	require.NoError(t, err)
+	assert.Equal(t, pemBlocks, content)
+	remove()
+	assert.NoFileExists(t, args[1])
+
+	args, _, err = curlClientCertArgs([]string{"--cert", certPath}, settings, "rdp.example.com")
+	require.NoError(t, err)
+	assert.Empty(t, args)
+}
@@ -1,8 +1,10 @@
 package access
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -15,6 +17,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
+	gossh "golang.org/x/crypto/ssh"
 	"golang.org/x/net/idna"
 
 	"github.com/cloudflare/cloudflared/carrier"
@@ -26,25 +29,37 @@ import (
 )
 
 const (
-	appURLFlag         = "app"
-	loginQuietFlag     = "quiet"
-	sshHostnameFlag    = "hostname"
-	sshDestinationFlag = "destination"
-	sshURLFlag         = "url"
-	sshHeaderFlag      = "header"
-	sshTokenIDFlag     = "service-token-id"
-	sshTokenSecretFlag = "service-token-secret"
-	sshGenCertFlag     = "short-lived-cert"
-	sshConnectTo       = "connect-to"
-	sshDebugStream     = "debug-stream"
-	sshConfigTemplate  = `
-Add to your {{.Home}}/.ssh/config:
-
+	appURLFlag            = "app"
+	noKeychainFlag        = "no-keychain"
+	allowRemoteFlag       = "allow-remote"
+	loginQuietFlag        = "quiet"
+	loginListenerFlag     = "login-listener"
+	loginBrowserFlag      = "browser"
+	loginNoBrowserFlag    = "no-browser"
+	sshHostnameFlag       = "hostname"
+	sshDestinationFlag    = "destination"
+	sshURLFlag            = "url"
+	sshHeaderFlag         = "header"
+	sshTokenIDFlag        = "service-token-id"
+	sshTokenSecretFlag    = "service-token-secret"
+	sshTokenFileFlag      = "service-token-file"
+	sshGenCertFlag        = "short-lived-cert"
+	sshGenRenewBeforeFlag = "renew-before"
+	sshGenWatchFlag       = "watch"
+	sshPinHostCAFlag      = "pin-host-ca"
+	sshKnownHostsFlag     = "known-hosts"
+	sshConnectTo          = "connect-to"
+	sshDebugStream        = "debug-stream"
+	sshConfigHeader       = "\nAdd to your %s/.ssh/config:"
+	sshConfigTemplate     = `
 {{- if .ShortLivedCerts}}
-Match host {{.Hostname}} exec "{{.Cloudflared}} access ssh-gen --hostname %h"
+Match host {{.Hostname}} exec "{{.Cloudflared}} access ssh-gen --hostname %h{{if .PinHostCA}} --pin-host-ca{{end}}"
   ProxyCommand {{.Cloudflared}} access ssh --hostname %h
   IdentityFile ~/.cloudflared/%h-cf_key
   CertificateFile ~/.cloudflared/%h-cf_key-cert.pub
+{{- if .PinHostCA}}
+  UserKnownHostsFile ~/.ssh/known_hosts {{.KnownHosts}}
+{{- end}}
 {{- else}}
 Host {{.Hostname}}
   ProxyCommand {{.Cloudflared}} access ssh --hostname %h
@@ -52,6 +67,13 @@ Host {{.Hostname}}
 `
 )
 
+const (
+	// sshGenDefaultRenewBefore leaves time for the certificate to be used by ssh after it's generated
+	sshGenDefaultRenewBefore = 30 * time.Second
+	sshGenRetryInterval      = 10 * time.Second
+	sshDefaultKnownHosts     = "~/.cloudflared/known_hosts"
+)
+
 const sentryDSN = "https://56a9c9fa5c364ab28f34b14f35ea0f1b@sentry.io/189878"
 
 var (
@@ -65,9 +87,28 @@ func Init(shutdown chan struct{}, version string) {
 	userAgent = fmt.Sprintf("cloudflared/%s", version)
 }
 
-// Flags return the global flags for Access related commands (hopefully none)
+// Flags return the global flags for Access related commands
 func Flags() []cli.Flag {
-	return []cli.Flag{} // no flags yet.
+	return []cli.Flag{newNoKeychainFlag()}
+}
+
+// newNoKeychainFlag is a global flag, as the tokens are also used by the forwarders of the tunnel command and of the
+// service, and a flag of the access command.
+func newNoKeychainFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    noKeychainFlag,
+		Usage:   "store the Access tokens in files under ~/.cloudflared instead of the keychain of the OS (macOS Keychain, Windows Credential Manager or Secret Service).",
+		EnvVars: []string{"TUNNEL_ACCESS_NO_KEYCHAIN"},
+	}
+}
+
+// ConfigureKeychain stores the Access tokens in files if --no-keychain is set. It is run before every command, so
+// that the forwarders that aren't started by the access command don't use the keychain either.
+func ConfigureKeychain(c *cli.Context) error {
+	if c.Bool(noKeychainFlag) {
+		token.UseKeychain(false)
+	}
+	return nil
 }
 
 // Commands returns all the Access related subcommands
@@ -82,6 +123,8 @@ func Commands() []*cli.Command {
 			per-user and by application. With Cloudflare Access, only authenticated users with the required permissions are
 			able to reach sensitive resources. The commands provided here allow you to interact with Access protected
 			applications from the command line.`,
+			Flags:  []cli.Flag{newNoKeychainFlag()},
+			Before: ConfigureKeychain,
 			Subcommands: []*cli.Command{
 				{
 					Name:      "login",
@@ -93,7 +136,8 @@ func Commands() []*cli.Command {
 					Once authenticated with your identity provider, the login command will generate a JSON Web Token (JWT)
 					scoped to your identity, the application you intend to reach, and valid for a session duration set by your
 					administrator. cloudflared stores the token in local storage.`,
-					Flags: []cli.Flag{
+					Flags: append([]cli.Flag{
+						outputFormatFlag,
 						&cli.BoolFlag{
 							Name:    loginQuietFlag,
 							Aliases: []string{"q"},
@@ -103,98 +147,230 @@ func Commands() []*cli.Command {
 							Name:  "no-verbose",
 							Usage: "print only the jwt to stdout",
 						},
+						&cli.StringFlag{
+							Name:    loginListenerFlag,
+							Usage:   "listen on this local address, e.g. localhost:8099 forwarded with ssh -L, and redirect the browser opening it to the login. Use it when the identity provider requires a security key.",
+							EnvVars: []string{"TUNNEL_LOGIN_LISTENER"},
+						},
+						&cli.StringFlag{
+							Name:    loginBrowserFlag,
+							Usage:   "command opening the login URL, which replaces its %s or is appended to it, e.g. \"firefox -P work\".",
+							EnvVars: []string{"TUNNEL_LOGIN_BROWSER"},
+						},
+						&cli.BoolFlag{
+							Name:    loginNoBrowserFlag,
+							Usage:   "print the login URL with a QR code instead of opening a browser.",
+							EnvVars: []string{"TUNNEL_LOGIN_NO_BROWSER"},
+						},
 						&cli.StringFlag{
 							Name: appURLFlag,
 						},
-					},
+					}, clientCertFlags()...),
 				},
 				{
 					Name:   "curl",
 					Action: cliutil.Action(curl),
 					Usage:  "curl [--allow-request, -ar] <url> [<curl args>...]",
 					Description: `The curl subcommand wraps curl and automatically injects the JWT into a cf-access-token
-					header when using curl to reach an application behind Access.`,
+					header when using curl to reach an application behind Access. Non-interactive clients can authenticate with
+					a service token set in the TUNNEL_SERVICE_TOKEN_ID and TUNNEL_SERVICE_TOKEN_SECRET environment variables,
+					or in a file set in TUNNEL_SERVICE_TOKEN_FILE. To keep loops of requests fast, invocations reuse the
+					Access lookups and the token verified by a previous one, speak HTTP/2 and resume the TLS sessions
+					if curl supports it. Set TUNNEL_ACCESS_CURL_NO_REUSE=true to disable the reuse. For intranet
+					applications requiring Kerberos, set TUNNEL_ACCESS_CURL_NEGOTIATE=true to answer their Negotiate
+					challenges with the tickets of the user, the SPNEGO token is forwarded to the origin in the
+					Authorization header while Access reads its own header. Applications requiring mTLS get the client
+					certificate set in TUNNEL_ACCESS_CLIENT_CERT and TUNNEL_ACCESS_CLIENT_KEY, or the one of their hostname
+					in ~/.cloudflared/client-certs.yml.`,
 					ArgsUsage:       "allow-request will allow the curl request to continue even if the jwt is not present.",
 					SkipFlagParsing: true,
 				},
 				{
-					Name:        "token",
-					Action:      cliutil.Action(generateToken),
-					Usage:       "token <url of access application>",
-					ArgsUsage:   "url of Access application",
-					Description: `The token subcommand produces a JWT which can be used to authenticate requests.`,
-					Flags: []cli.Flag{
+					Name:      "exec",
+					Action:    cliutil.Action(execCommand),
+					Usage:     "exec --app <url of access application> -- <command> [<args>...]",
+					ArgsUsage: "command to run with the token",
+					Description: `The exec subcommand runs a command with the JWT of the application in its environment,
+					fetching a new one if the stored token is missing or expired. The raw JWT is in CF_ACCESS_TOKEN and
+					the header carrying it in CF_ACCESS_TOKEN_HEADER, e.g. for curl -H "$CF_ACCESS_TOKEN_HEADER". The
+					command exits with the status of the child.`,
+					Flags: append([]cli.Flag{
 						&cli.StringFlag{
-							Name: appURLFlag,
+							Name:  appURLFlag,
+							Usage: "url of the Access application.",
 						},
-					},
+					}, append(serviceTokenFlags(), clientCertFlags()...)...),
 				},
 				{
-					Name:        "tcp",
-					Action:      cliutil.Action(ssh),
-					Aliases:     []string{"rdp", "ssh", "smb"},
-					Usage:       "",
-					ArgsUsage:   "",
-					Description: `The tcp subcommand sends data over a proxy to the Cloudflare edge.`,
-					Flags: []cli.Flag{
-						&cli.StringFlag{
-							Name:    sshHostnameFlag,
-							Aliases: []string{"tunnel-host", "T"},
-							Usage:   "specify the hostname of your application.",
-							EnvVars: []string{"TUNNEL_SERVICE_HOSTNAME"},
-						},
-						&cli.StringFlag{
-							Name:    sshDestinationFlag,
-							Usage:   "specify the destination address of your SSH server.",
-							EnvVars: []string{"TUNNEL_SERVICE_DESTINATION"},
+					Name:      "token",
+					Action:    cliutil.Action(generateToken),
+					Usage:     "token <url of access application>...",
+					ArgsUsage: "url of Access application",
+					Description: `The token subcommand produces a JWT which can be used to authenticate requests.
+					With several applications, given as arguments, with --app or in --apps-file, it prints a JSON object
+					mapping each application to its token. Missing tokens are then fetched, logging in once per Access
+					organization.`,
+					Flags: append([]cli.Flag{
+						outputFormatFlag,
+						&cli.StringSliceFlag{
+							Name:  appURLFlag,
+							Usage: "url of an Access application, can be repeated.",
 						},
 						&cli.StringFlag{
-							Name:    sshURLFlag,
-							Aliases: []string{"listener", "L"},
-							Usage:   "specify the host:port to forward data to Cloudflare edge.",
-							EnvVars: []string{"TUNNEL_SERVICE_URL"},
+							Name:  tokenAppsFileFlag,
+							Usage: "file with the url of an Access application per line.",
 						},
+					}, clientCertFlags()...),
+				},
+				{
+					Name:      "token-daemon",
+					Action:    cliutil.Action(tokenDaemonCommand),
+					Usage:     "token-daemon [--app <url of access application>...] [--apps-file <file>]",
+					ArgsUsage: "url of Access application",
+					Description: `The token-daemon subcommand keeps the tokens of the applications valid, renewing them with
+					the org token before they expire, and serves them on a Unix socket only the user can connect to, so that
+					scripts and tools never wait for a login. GET /tokens returns the tokens of all the applications and
+					GET /token?app=<url> the token of one of them, e.g.
+					curl --unix-socket ~/.cloudflared/access-tokens.sock 'http://localhost/token?app=https://app.example.com'.
+					A login is only started once the org token expired and the token of an application can't be renewed.`,
+					Flags: append([]cli.Flag{
 						&cli.StringSliceFlag{
-							Name:    sshHeaderFlag,
-							Aliases: []string{"H"},
-							Usage:   "specify additional headers you wish to send.",
+							Name:  appURLFlag,
+							Usage: "url of an Access application, can be repeated.",
 						},
 						&cli.StringFlag{
-							Name:    sshTokenIDFlag,
-							Aliases: []string{"id"},
-							Usage:   "specify an Access service token ID you wish to use.",
-							EnvVars: []string{"TUNNEL_SERVICE_TOKEN_ID"},
+							Name:  tokenAppsFileFlag,
+							Usage: "file with the url of an Access application per line.",
 						},
 						&cli.StringFlag{
-							Name:    sshTokenSecretFlag,
-							Aliases: []string{"secret"},
-							Usage:   "specify an Access service token secret you wish to use.",
-							EnvVars: []string{"TUNNEL_SERVICE_TOKEN_SECRET"},
+							Name:    tokenDaemonSocketFlag,
+							Usage:   "path of the Unix socket the tokens are served on.",
+							Value:   tokenDaemonDefaultSocket,
+							EnvVars: []string{"TUNNEL_ACCESS_TOKEN_DAEMON_SOCKET"},
 						},
-						&cli.StringFlag{
-							Name:  logger.LogFileFlag,
-							Usage: "Save application log to this file for reporting issues.",
+						&cli.DurationFlag{
+							Name:    tokenDaemonRefreshBeforeFlag,
+							Usage:   "renew a token when it expires within this duration.",
+							Value:   tokenDaemonDefaultRefreshBefore,
+							EnvVars: []string{"TUNNEL_ACCESS_TOKEN_DAEMON_REFRESH_BEFORE"},
 						},
-						&cli.StringFlag{
-							Name:  logger.LogSSHDirectoryFlag,
-							Usage: "Save application log to this directory for reporting issues.",
+					}, clientCertFlags()...),
+				},
+				{
+					Name:      "tcp",
+					Action:    cliutil.Action(ssh),
+					Aliases:   []string{"ssh", "smb"},
+					Usage:     "",
+					ArgsUsage: "",
+					Description: `The tcp subcommand sends data over a proxy to the Cloudflare edge. The stream is forwarded
+					unchanged, so the SPNEGO tokens of Kerberos applications reach the origin. Clients must request their
+					tickets for the hostname of the application, e.g. by resolving it to the listener in their hosts file.`,
+					Flags: append(carrierFlags(),
+						&cli.BoolFlag{
+							Name:    sshMultiplexFlag,
+							Usage:   "reuse a connection to the edge kept by a background process across invocations, e.g. the SSH connections of an Ansible run.",
+							EnvVars: []string{"TUNNEL_SERVICE_MULTIPLEX"},
 						},
-						&cli.StringFlag{
-							Name:    logger.LogSSHLevelFlag,
-							Aliases: []string{"loglevel"}, //added to match the tunnel side
-							Usage:   "Application logging level {debug, info, warn, error, fatal}. ",
+						&cli.DurationFlag{
+							Name:    sshMultiplexIdleTimeoutFlag,
+							Usage:   "how long the background process of --multiplex waits for a new invocation before exiting.",
+							Value:   carrier.DefaultMuxIdleTimeout,
+							EnvVars: []string{"TUNNEL_SERVICE_MULTIPLEX_IDLE_TIMEOUT"},
+						},
+						&cli.BoolFlag{
+							Name:    sshMultiplexServerFlag,
+							Hidden:  true,
+							Usage:   "run as the background process of --multiplex.",
+							EnvVars: []string{sshMultiplexServerEnv},
+						},
+					),
+				},
+				{
+					Name:      "rdp",
+					Action:    cliutil.Action(rdp),
+					Usage:     "rdp --hostname <hostname> --url localhost:<port>",
+					ArgsUsage: "",
+					Description: `The rdp subcommand listens for Remote Desktop clients such as mstsc or FreeRDP and forwards each
+					connection to the Cloudflare edge. Each connection is authenticated on its own, so clients can reconnect
+					after the Access token expired without restarting cloudflared. The listener only accepts local clients
+					unless --allow-remote is set, and --require-nla refuses the clients that don't use Network Level
+					Authentication.`,
+					Flags: append(carrierFlags(),
+						&cli.BoolFlag{
+							Name:    rdpRequireNLAFlag,
+							Usage:   "refuse the RDP clients that don't use Network Level Authentication (CredSSP).",
+							EnvVars: []string{"TUNNEL_SERVICE_RDP_REQUIRE_NLA"},
+						},
+						&cli.BoolFlag{
+							Name:    allowRemoteFlag,
+							Usage:   "allow listening on a non-loopback address, any host that reaches it uses your Access session.",
+							EnvVars: []string{"TUNNEL_SERVICE_RDP_ALLOW_REMOTE"},
+						},
+					),
+				},
+				{
+					Name:      "socks",
+					Action:    cliutil.Action(socks),
+					Usage:     "socks --hostname <hostname> --url localhost:<port>",
+					ArgsUsage: "",
+					Description: `The socks subcommand runs a local SOCKS5 proxy, each destination requested by a client is reached
+					through the Access application at --hostname. The application must be served by a tunnel in bastion mode,
+					which connects to the destinations and resolves their names on the origin side. The listener only accepts
+					local clients unless --allow-remote is set. The streams are forwarded unchanged, so browsers answer the
+					Negotiate challenges of Kerberos applications with tickets for their real hostnames.`,
+					Flags: append(carrierFlags(),
+						&cli.BoolFlag{
+							Name:    allowRemoteFlag,
+							Usage:   "allow listening on a non-loopback address, any host that reaches it uses your Access session.",
+							EnvVars: []string{"TUNNEL_SERVICE_SOCKS_ALLOW_REMOTE"},
+						},
+					),
+				},
+				{
+					Name:      "udp",
+					Action:    cliutil.Action(udp),
+					Usage:     "udp --hostname <hostname> --url localhost:<port>",
+					ArgsUsage: "",
+					Description: `The udp subcommand listens for the datagrams of local clients of a UDP application behind
+					Access, e.g. SNMP tools, and forwards them over the tunnel, whose ingress rule must have a udp:// service.
+					Each client address gets its own connection to the edge until it's idle for --idle-timeout. The
+					listener only accepts local clients unless --allow-remote is set.`,
+					Flags: append(carrierFlags(),
+						&cli.DurationFlag{
+							Name:    udpIdleTimeoutFlag,
+							Usage:   "how long the connection of a client is kept without datagrams in either direction.",
+							Value:   carrier.DefaultUDPIdleTimeout,
+							EnvVars: []string{"TUNNEL_SERVICE_UDP_IDLE_TIMEOUT"},
+						},
+						&cli.BoolFlag{
+							Name:    allowRemoteFlag,
+							Usage:   "allow listening on a non-loopback address, any host that reaches it uses your Access session.",
+							EnvVars: []string{"TUNNEL_SERVICE_UDP_ALLOW_REMOTE"},
 						},
+					),
+				},
+				{
+					Name:      "db",
+					Action:    cliutil.Action(db),
+					Usage:     "db --hostname <hostname> --url localhost:<port> --protocol postgres|mysql",
+					ArgsUsage: "",
+					Description: `The db subcommand listens for the clients of a Postgres or MySQL database behind Access, so
+					that native clients connect to localhost:port while cloudflared authorizes each connection with Access.
+					When a connection can't be authorized, the client receives an error of its protocol explaining why. The
+					listener only accepts local clients unless --allow-remote is set.`,
+					Flags: append(carrierFlags(),
 						&cli.StringFlag{
-							Name:   sshConnectTo,
-							Hidden: true,
-							Usage:  "Connect to alternate location for testing, value is host, host:port, or sni:port:host",
+							Name:    dbProtocolFlag,
+							Usage:   "protocol of the database clients, postgres or mysql.",
+							Value:   string(carrier.DatabasePostgres),
+							EnvVars: []string{"TUNNEL_SERVICE_DB_PROTOCOL"},
 						},
-						&cli.Uint64Flag{
-							Name:   sshDebugStream,
-							Hidden: true,
-							Usage:  "Writes up-to the max provided stream payloads to the logger as debug statements.",
+						&cli.BoolFlag{
+							Name:    allowRemoteFlag,
+							Usage:   "allow listening on a non-loopback address, any host that reaches it uses your Access session.",
+							EnvVars: []string{"TUNNEL_SERVICE_DB_ALLOW_REMOTE"},
 						},
-					},
+					),
 				},
 				{
 					Name:        "ssh-config",
@@ -202,6 +378,7 @@ func Commands() []*cli.Command {
 					Usage:       "",
 					Description: `Prints an example configuration ~/.ssh/config`,
 					Flags: []cli.Flag{
+						outputFormatFlag,
 						&cli.StringFlag{
 							Name:  sshHostnameFlag,
 							Usage: "specify the hostname of your application.",
@@ -210,18 +387,74 @@ func Commands() []*cli.Command {
 							Name:  sshGenCertFlag,
 							Usage: "specify if you wish to generate short lived certs.",
 						},
+						&cli.BoolFlag{
+							Name:  sshPinHostCAFlag,
+							Usage: "with short lived certs, trust the host certificates signed by the CA of the host.",
+						},
 					},
 				},
 				{
-					Name:        "ssh-gen",
-					Action:      cliutil.Action(sshGen),
-					Usage:       "",
-					Description: `Generates a short lived certificate for given hostname`,
-					Flags: []cli.Flag{
+					Name:   "ssh-gen",
+					Action: cliutil.Action(sshGen),
+					Usage:  "",
+					Description: `Generates a short lived certificate for given hostname. The certificate is only
+					renewed when it expires within --renew-before, and with --watch cloudflared keeps running and renews it
+					before it expires, so that long running Ansible or Git sessions keep connecting. With --pin-host-ca the
+					CA that signed the host certificate of the hostname is fetched from the host through Access the first
+					time, and added to --known-hosts as a @cert-authority for the hostname, so ssh verifies the host
+					certificates signed by it. A CA that changes afterwards is reported by ssh instead of being trusted.`,
+					Flags: append([]cli.Flag{
+						outputFormatFlag,
 						&cli.StringFlag{
 							Name:  sshHostnameFlag,
 							Usage: "specify the hostname of your application.",
 						},
+						&cli.DurationFlag{
+							Name:    sshGenRenewBeforeFlag,
+							Usage:   "renew the certificate when it expires within this duration.",
+							Value:   sshGenDefaultRenewBefore,
+							EnvVars: []string{"TUNNEL_SSH_GEN_RENEW_BEFORE"},
+						},
+						&cli.BoolFlag{
+							Name:    sshGenWatchFlag,
+							Usage:   "keep running and renew the certificate before it expires.",
+							EnvVars: []string{"TUNNEL_SSH_GEN_WATCH"},
+						},
+						&cli.BoolFlag{
+							Name:    sshPinHostCAFlag,
+							Usage:   "pin the CA of the host certificate of the hostname for its host keys.",
+							EnvVars: []string{"TUNNEL_SSH_PIN_HOST_CA"},
+						},
+						&cli.StringFlag{
+							Name:    sshKnownHostsFlag,
+							Usage:   "known hosts file the CA is pinned in.",
+							Value:   sshDefaultKnownHosts,
+							EnvVars: []string{"TUNNEL_SSH_KNOWN_HOSTS"},
+						},
+					}, clientCertFlags()...),
+				},
+				{
+					Name:      "import-client-cert",
+					Action:    cliutil.Action(importClientCert),
+					Usage:     "import-client-cert --name <name> --client-cert <cert file> [--client-key <key file>]",
+					ArgsUsage: " ",
+					Description: `The import-client-cert subcommand stores a client certificate and its key in the keychain
+					of the OS (macOS Keychain, Windows Credential Manager or Secret Service), so that the key isn't left in
+					a file. Applications requiring mTLS then reference it as keychain:<name> in --client-cert or in the
+					client certificates file.`,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  clientCertNameFlag,
+							Usage: "name the certificate is referenced by, as keychain:<name>.",
+						},
+						&cli.StringFlag{
+							Name:  clientCertFlag,
+							Usage: "PEM client certificate to import.",
+						},
+						&cli.StringFlag{
+							Name:  clientKeyFlag,
+							Usage: "PEM key of the certificate, if it's not in the certificate file.",
+						},
 					},
 				},
 			},
@@ -247,12 +480,16 @@ func login(c *cli.Context) error {
 		return err
 	}
 
-	appInfo, err := token.GetAppInfo(appURL)
+	clientTLS, err := clientCertSettingsFrom(c).tlsConfig(appURL.Hostname())
+	if err != nil {
+		return err
+	}
+	appInfo, err := token.GetAppInfo(appURL, clientTLS)
 	if err != nil {
 		return err
 	}
 
-	if err := verifyTokenAtEdge(appURL, appInfo, c, log); err != nil {
+	if err := verifyTokenAtEdge(appURL, appInfo, clientTLS, c, log); err != nil {
 		log.Err(err).Msg("Could not verify token")
 		return err
 	}
@@ -266,6 +503,9 @@ func login(c *cli.Context) error {
 		return errors.New("empty application token")
 	}
 
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, newTokenOutput(appURL.String(), appInfo, cfdToken))
+	}
 	if c.Bool(loginQuietFlag) {
 		return nil
 	}
@@ -304,16 +544,70 @@ func curl(c *cli.Context) error {
 		return err
 	}
 
-	appInfo, err := token.GetAppInfo(appURL)
+	// Flags are passed to curl, the client certificate can only be set in the environment
+	clientCerts := clientCertSettingsFrom(c)
+	clientTLS, err := clientCerts.tlsConfig(appURL.Hostname())
 	if err != nil {
 		return err
 	}
+	reuse := curlReuseEnabled()
+	var appInfo *token.AppInfo
+	if reuse {
+		appInfo, err = token.GetCachedAppInfo(appURL, curlAppInfoMaxAge, clientTLS)
+	} else {
+		appInfo, err = token.GetAppInfo(appURL, clientTLS)
+	}
+	if err != nil {
+		return err
+	}
+	clientCertArgs, removeClientCert, err := curlClientCertArgs(cmdArgs, clientCerts, appURL.Hostname())
+	if err != nil {
+		return err
+	}
+	defer removeClientCert()
+	cmdArgs = append(clientCertArgs, cmdArgs...)
 
-	// Verify that the existing token is still good; if not fetch a new one
-	if err := verifyTokenAtEdge(appURL, appInfo, c, log); err != nil {
-		log.Err(err).Msg("Could not verify token")
+	if reuse || curlNegotiateEnabled() {
+		features := detectCurlFeatures()
+		if curlNegotiateEnabled() {
+			negotiateArgs, err := curlNegotiateArgs(cmdArgs, features)
+			if err != nil {
+				return err
+			}
+			cmdArgs = append(negotiateArgs, cmdArgs...)
+		}
+		if reuse {
+			cmdArgs = append(curlReuseArgs(cmdArgs, appURL, features), cmdArgs...)
+		}
+	}
+
+	// Flags are passed to curl, the service token can only be set in the environment
+	serviceToken, err := loadServiceToken(os.Getenv(serviceTokenIDEnv), os.Getenv(serviceTokenSecretEnv), os.Getenv(serviceTokenFileEnv))
+	if err != nil {
 		return err
 	}
+	if serviceToken.IsSet() {
+		tok, err := token.FetchServiceToken(appURL, appInfo, serviceToken, clientTLS)
+		if err != nil {
+			log.Err(err).Msg("Failed to fetch a token with the service token")
+			return err
+		}
+		cmdArgs = append(cmdArgs, "-H", fmt.Sprintf("%s: %s", carrier.CFAccessTokenHeader, tok))
+		return run("curl", cmdArgs...)
+	}
+
+	// Verify that the existing token is still good; if not fetch a new one. A token verified by a recent invocation
+	// is used as is.
+	if !reuse || !tokenVerifiedRecently(appInfo) {
+		if err := verifyTokenAtEdge(appURL, appInfo, clientTLS, c, log); err != nil {
+			log.Err(err).Msg("Could not verify token")
+			if reuse {
+				// The application may have changed since its info was stored
+				_ = token.RemoveCachedAppInfo(appURL)
+			}
+			return err
+		}
+	}
 
 	tok, err := token.GetAppTokenIfExists(appInfo)
 	if err != nil || tok == "" {
@@ -321,12 +615,15 @@ func curl(c *cli.Context) error {
 			log.Info().Msg("You don't have an Access token set. Please run access token <access application> to fetch one.")
 			return run("curl", cmdArgs...)
 		}
-		tok, err = token.FetchToken(appURL, appInfo, log)
+		tok, err = token.FetchToken(appURL, appInfo, &token.LoginOptions{TLSClientConfig: clientTLS}, log)
 		if err != nil {
 			log.Err(err).Msg("Failed to refresh token")
 			return err
 		}
 	}
+	if reuse {
+		markTokenVerified(appInfo)
+	}
 
 	cmdArgs = append(cmdArgs, "-H")
 	cmdArgs = append(cmdArgs, fmt.Sprintf("%s: %s", carrier.CFAccessTokenHeader, tok))
@@ -375,13 +672,24 @@ func generateToken(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	appURL, err := getAppURLFromArgs(c)
+	apps, err := tokenApps(c)
+	if err != nil {
+		return err
+	}
+	if len(apps) != 1 || c.IsSet(tokenAppsFileFlag) {
+		return generateTokens(c, apps)
+	}
+	appURL, err := parseURL(apps[0])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Please provide a url.")
 		return err
 	}
 
-	appInfo, err := token.GetAppInfo(appURL)
+	clientTLS, err := clientCertSettingsFrom(c).tlsConfig(appURL.Hostname())
+	if err != nil {
+		return err
+	}
+	appInfo, err := token.GetAppInfo(appURL, clientTLS)
 	if err != nil {
 		return err
 	}
@@ -391,6 +699,9 @@ func generateToken(c *cli.Context) error {
 		return err
 	}
 
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, newTokenOutput(apps[0], appInfo, tok))
+	}
 	if _, err := fmt.Fprint(os.Stdout, tok); err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to write token to stdout.")
 		return err
@@ -409,12 +720,64 @@ func sshConfig(c *cli.Context) error {
 	type config struct {
 		Home            string
 		ShortLivedCerts bool
+		PinHostCA       bool
+		KnownHosts      string
 		Hostname        string
 		Cloudflared     string
 	}
 
+	cfg := config{
+		Home:            os.Getenv("HOME"),
+		ShortLivedCerts: genCertBool,
+		PinHostCA:       c.Bool(sshPinHostCAFlag),
+		KnownHosts:      sshDefaultKnownHosts,
+		Hostname:        hostname,
+		Cloudflared:     cloudflaredPath(),
+	}
 	t := template.Must(template.New("sshConfig").Parse(sshConfigTemplate))
-	return t.Execute(os.Stdout, config{Home: os.Getenv("HOME"), ShortLivedCerts: genCertBool, Hostname: hostname, Cloudflared: cloudflaredPath()})
+	outputFormat := c.String(outputFormatFlag.Name)
+	if outputFormat == "" {
+		fmt.Fprintf(os.Stdout, sshConfigHeader, cfg.Home)
+		return t.Execute(os.Stdout, cfg)
+	}
+
+	var rendered strings.Builder
+	if err := t.Execute(&rendered, cfg); err != nil {
+		return err
+	}
+	output := sshConfigOutput{
+		Hostname:       hostname,
+		ShortLivedCert: genCertBool,
+		ProxyCommand:   fmt.Sprintf("%s access ssh --hostname %%h", cfg.Cloudflared),
+		Config:         strings.TrimSpace(rendered.String()) + "\n",
+	}
+	if genCertBool {
+		output.IdentityFile = "~/.cloudflared/%h-cf_key"
+		output.CertificateFile = "~/.cloudflared/%h-cf_key-cert.pub"
+		if cfg.PinHostCA {
+			output.KnownHostsFile = cfg.KnownHosts
+		}
+	}
+	return renderOutput(outputFormat, output)
+}
+
+// sshConfigOutput is the SSH configuration as printed with --output.
+type sshConfigOutput struct {
+	Hostname        string `json:"hostname" yaml:"hostname"`
+	ShortLivedCert  bool   `json:"short_lived_cert" yaml:"short_lived_cert"`
+	ProxyCommand    string `json:"proxy_command" yaml:"proxy_command"`
+	IdentityFile    string `json:"identity_file,omitempty" yaml:"identity_file,omitempty"`
+	CertificateFile string `json:"certificate_file,omitempty" yaml:"certificate_file,omitempty"`
+	KnownHostsFile  string `json:"user_known_hosts_file,omitempty" yaml:"user_known_hosts_file,omitempty"`
+	Config          string `json:"config" yaml:"config"`
+}
+
+// sshGenOutput is the short lived certificate as printed by ssh-gen with --output.
+type sshGenOutput struct {
+	Hostname        string    `json:"hostname" yaml:"hostname"`
+	CertificateFile string    `json:"certificate_file" yaml:"certificate_file"`
+	ValidUntil      time.Time `json:"valid_until" yaml:"valid_until"`
+	HostCA          string    `json:"host_ca,omitempty" yaml:"host_ca,omitempty"`
 }
 
 // sshGen generates a short lived certificate for provided hostname
@@ -433,24 +796,133 @@ func sshGen(c *cli.Context) error {
 		return err
 	}
 
+	clientTLS, err := clientCertSettingsFrom(c).tlsConfig(originURL.Hostname())
+	if err != nil {
+		return err
+	}
+	renewBefore := c.Duration(sshGenRenewBeforeFlag)
+	watch := c.Bool(sshGenWatchFlag)
+	// ssh runs ssh-gen for each connection, the certificate is only renewed when it's about to expire
+	hasCertificate := true
+	if validUntil, err := sshgen.CertificateValidUntil(originURL); err == nil && time.Until(validUntil) > renewBefore {
+		log.Debug().Msgf("The short lived certificate is valid until %s", validUntil)
+	} else if _, err := generateShortLivedCertificate(originURL, clientTLS, log); err != nil {
+		// The watch loop retries until it gets a certificate
+		if !watch {
+			return err
+		}
+		hasCertificate = false
+	}
+
+	var hostCA gossh.PublicKey
+	if hasCertificate && c.Bool(sshPinHostCAFlag) {
+		if hostCA, err = pinHostCA(c, originURL, c.String(sshKnownHostsFlag), log); err != nil {
+			return err
+		}
+	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" && hasCertificate {
+		if err := renderSSHGenOutput(outputFormat, originURL, hostCA); err != nil {
+			return err
+		}
+	}
+	if watch {
+		return watchShortLivedCertificate(originURL, renewBefore, clientTLS, log)
+	}
+	return nil
+}
+
+func renderSSHGenOutput(outputFormat string, originURL *url.URL, hostCA gossh.PublicKey) error {
+	certificateFile, err := sshgen.CertificateFile(originURL)
+	if err != nil {
+		return err
+	}
+	validUntil, err := sshgen.CertificateValidUntil(originURL)
+	if err != nil {
+		return err
+	}
+	output := sshGenOutput{
+		Hostname:        originURL.Hostname(),
+		CertificateFile: certificateFile,
+		ValidUntil:      validUntil.UTC(),
+	}
+	if hostCA != nil {
+		output.HostCA = gossh.FingerprintSHA256(hostCA)
+	}
+	return renderOutput(outputFormat, output)
+}
+
+// pinHostCA trusts the CA that signed the host certificate of the application for its host keys, and returns it. The
+// CA is only fetched from the host until it's pinned, ssh rejects the host certificates signed by another CA
+// afterwards.
+func pinHostCA(c *cli.Context, originURL *url.URL, knownHosts string, log *zerolog.Logger) (gossh.PublicKey, error) {
+	hostname := originURL.Hostname()
+	if pinned, ok, err := sshgen.PinnedHostCA(knownHosts, hostname); err != nil || ok {
+		return pinned, err
+	}
+
+	options, err := carrierOptions(c, originURL, log)
+	if err != nil {
+		return nil, err
+	}
+	conn, stream := net.Pipe()
+	defer conn.Close()
+	go func() {
+		defer stream.Close()
+		_ = carrier.NewWSConnection(log).ServeStream(options, stream)
+	}()
+	ca, err := sshgen.HostCertificateAuthority(conn, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := sshgen.PinHostCA(knownHosts, hostname, ca); err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Pinned the host CA %s for the host keys of %s in %s", gossh.FingerprintSHA256(ca), hostname, knownHosts)
+	return ca, nil
+}
+
+// generateShortLivedCertificate mints a certificate for the application and returns when it expires.
+func generateShortLivedCertificate(originURL *url.URL, clientTLS *tls.Config, log *zerolog.Logger) (time.Time, error) {
 	// this fetchToken function mutates the appURL param. We should refactor that
 	fetchTokenURL := &url.URL{}
 	*fetchTokenURL = *originURL
 
-	appInfo, err := token.GetAppInfo(fetchTokenURL)
+	appInfo, err := token.GetAppInfo(fetchTokenURL, clientTLS)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
-	cfdToken, err := token.FetchTokenWithRedirect(fetchTokenURL, appInfo, log)
+	cfdToken, err := token.FetchTokenWithRedirect(fetchTokenURL, appInfo, &token.LoginOptions{TLSClientConfig: clientTLS}, log)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
 
 	if err := sshgen.GenerateShortLivedCertificate(originURL, cfdToken); err != nil {
-		return err
+		return time.Time{}, err
 	}
+	return sshgen.CertificateValidUntil(originURL)
+}
 
-	return nil
+// watchShortLivedCertificate renews the certificate of the application before it expires until cloudflared is
+// stopped, so that the new connections of long running sessions keep finding a valid certificate.
+func watchShortLivedCertificate(originURL *url.URL, renewBefore time.Duration, clientTLS *tls.Config, log *zerolog.Logger) error {
+	for {
+		validUntil, err := sshgen.CertificateValidUntil(originURL)
+		if err != nil || time.Until(validUntil) <= renewBefore {
+			validUntil, err = generateShortLivedCertificate(originURL, clientTLS, log)
+			if err != nil {
+				log.Err(err).Msgf("Failed to renew the short lived certificate, retrying in %s", sshGenRetryInterval)
+				validUntil = time.Now().Add(renewBefore + sshGenRetryInterval)
+			} else {
+				log.Info().Msgf("Renewed the short lived certificate, valid until %s", validUntil)
+			}
+		}
+		select {
+		case <-shutdownC:
+			return nil
+		case <-time.After(time.Until(validUntil) - renewBefore):
+		}
+	}
 }
 
 // getAppURL will pull the request URL needed for fetching a user's Access token
@@ -532,8 +1004,8 @@ func isFileThere(candidate string) bool {
 
 // verifyTokenAtEdge checks for a token on disk, or generates a new one.
 // Then makes a request to to the origin with the token to ensure it is valid.
-// Returns nil if token is valid.
-func verifyTokenAtEdge(appUrl *url.URL, appInfo *token.AppInfo, c *cli.Context, log *zerolog.Logger) error {
+// Returns nil if token is valid. clientTLS holds the client certificate of applications that require mTLS.
+func verifyTokenAtEdge(appUrl *url.URL, appInfo *token.AppInfo, clientTLS *tls.Config, c *cli.Context, log *zerolog.Logger) error {
 	headers := parseRequestHeaders(c.StringSlice(sshHeaderFlag))
 	if c.IsSet(sshTokenIDFlag) {
 		headers.Add(cfAccessClientIDHeader, c.String(sshTokenIDFlag))
@@ -541,7 +1013,18 @@ func verifyTokenAtEdge(appUrl *url.URL, appInfo *token.AppInfo, c *cli.Context,
 	if c.IsSet(sshTokenSecretFlag) {
 		headers.Add(cfAccessClientSecretHeader, c.String(sshTokenSecretFlag))
 	}
-	options := &carrier.StartOptions{AppInfo: appInfo, OriginURL: appUrl.String(), Headers: headers}
+	loginOptions := &token.LoginOptions{
+		ListenerAddress: c.String(loginListenerFlag),
+		NoBrowser:       c.Bool(loginNoBrowserFlag),
+		BrowserCommand:  c.String(loginBrowserFlag),
+	}
+	options := &carrier.StartOptions{
+		AppInfo:         appInfo,
+		OriginURL:       appUrl.String(),
+		Headers:         headers,
+		TLSClientConfig: clientTLS,
+		LoginOptions:    loginOptions,
+	}
 
 	if valid, err := isTokenValid(options, log); err != nil {
 		return err
@@ -581,6 +1064,11 @@ func isTokenValid(options *carrier.StartOptions, log *zerolog.Logger) (bool, err
 		},
 		Timeout: time.Second * 5,
 	}
+	if options.TLSClientConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = options.TLSClientConfig
+		client.Transport = transport
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return false, err
@@ -590,3 +1078,103 @@ func isTokenValid(options *carrier.StartOptions, log *zerolog.Logger) (bool, err
 	// A redirect to login means the token was invalid.
 	return !carrier.IsAccessResponse(resp), nil
 }
+
+// serviceTokenFlags are the flags of the commands that can authenticate with an Access service token.
+func serviceTokenFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    sshTokenIDFlag,
+			Aliases: []string{"id"},
+			Usage:   "specify an Access service token ID you wish to use.",
+			EnvVars: []string{serviceTokenIDEnv},
+		},
+		&cli.StringFlag{
+			Name:    sshTokenSecretFlag,
+			Aliases: []string{"secret"},
+			Usage:   "specify an Access service token secret you wish to use.",
+			EnvVars: []string{serviceTokenSecretEnv},
+		},
+		&cli.StringFlag{
+			Name:    sshTokenFileFlag,
+			Usage:   "specify a file with the Cf-Access-Client-Id and Cf-Access-Client-Secret headers of an Access service token.",
+			EnvVars: []string{serviceTokenFileEnv},
+		},
+	}
+}
+
+// clientCertFlags are the flags of the commands reaching applications that may require mTLS.
+func clientCertFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    clientCertFlag,
+			Usage:   "PEM client certificate presented to an application requiring mTLS, or keychain:<name> for one imported with import-client-cert, instead of the one of its hostname in --client-certs-file.",
+			EnvVars: []string{clientCertEnv},
+		},
+		&cli.StringFlag{
+			Name:    clientCertsFileFlag,
+			Usage:   "YAML file mapping the hostnames of applications requiring mTLS to the cert and key of their client certificate.",
+			Value:   defaultClientCertsFile,
+			EnvVars: []string{clientCertsFileEnv},
+		},
+		&cli.StringFlag{
+			Name:    clientKeyFlag,
+			Usage:   "PEM key of --client-cert, if it's not in the certificate file.",
+			EnvVars: []string{clientKeyEnv},
+		},
+	}
+}
+
+// carrierFlags are the flags of the subcommands forwarding data to the Cloudflare edge.
+func carrierFlags() []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    sshHostnameFlag,
+			Aliases: []string{"tunnel-host", "T"},
+			Usage:   "specify the hostname of your application.",
+			EnvVars: []string{"TUNNEL_SERVICE_HOSTNAME"},
+		},
+		&cli.StringFlag{
+			Name:    sshDestinationFlag,
+			Usage:   "specify the destination address of your SSH server.",
+			EnvVars: []string{"TUNNEL_SERVICE_DESTINATION"},
+		},
+		&cli.StringFlag{
+			Name:    sshURLFlag,
+			Aliases: []string{"listener", "L"},
+			Usage:   "specify the host:port to forward data to Cloudflare edge.",
+			EnvVars: []string{"TUNNEL_SERVICE_URL"},
+		},
+		&cli.StringSliceFlag{
+			Name:    sshHeaderFlag,
+			Aliases: []string{"H"},
+			Usage:   "specify additional headers you wish to send.",
+		},
+	}
+	flags = append(flags, serviceTokenFlags()...)
+	flags = append(flags, clientCertFlags()...)
+	return append(flags,
+		&cli.StringFlag{
+			Name:  logger.LogFileFlag,
+			Usage: "Save application log to this file for reporting issues.",
+		},
+		&cli.StringFlag{
+			Name:  logger.LogSSHDirectoryFlag,
+			Usage: "Save application log to this directory for reporting issues.",
+		},
+		&cli.StringFlag{
+			Name:    logger.LogSSHLevelFlag,
+			Aliases: []string{"loglevel"}, //added to match the tunnel side
+			Usage:   "Application logging level {debug, info, warn, error, fatal}. ",
+		},
+		&cli.StringFlag{
+			Name:   sshConnectTo,
+			Hidden: true,
+			Usage:  "Connect to alternate location for testing, value is host, host:port, or sni:port:host",
+		},
+		&cli.Uint64Flag{
+			Name:   sshDebugStream,
+			Hidden: true,
+			Usage:  "Writes up-to the max provided stream payloads to the logger as debug statements.",
+		},
+	)
+}
@@ -0,0 +1,203 @@
+package access
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/token"
+)
+
+const (
+	// curlNoReuseEnv disables the reuse of lookups, tokens and TLS sessions across invocations of access curl
+	curlNoReuseEnv = "TUNNEL_ACCESS_CURL_NO_REUSE"
+	// curlNegotiateEnv makes curl authenticate to the origin with Kerberos through SPNEGO
+	curlNegotiateEnv = "TUNNEL_ACCESS_CURL_NEGOTIATE"
+	// curlVerifyInterval is how long a token verified at the edge is used without being verified again
+	curlVerifyInterval = 5 * time.Minute
+	// curlAppInfoMaxAge is how long the Access app info of a URL is stored
+	curlAppInfoMaxAge = time.Hour
+
+	curlVerifiedSuffix    = "curl-verified"
+	curlTLSSessionsSuffix = "curl-tls-sessions"
+)
+
+// curlFeatures is what the installed curl supports
+type curlFeatures struct {
+	http2 bool
+	// spnego is whether curl was built with a GSS-API library, which --negotiate requires
+	spnego bool
+	// tlsSessions is whether curl can store TLS sessions in a file with --ssl-sessions, which depends on the TLS
+	// backend curl was built with
+	tlsSessions bool
+}
+
+func curlReuseEnabled() bool {
+	disabled, _ := strconv.ParseBool(os.Getenv(curlNoReuseEnv))
+	return !disabled
+}
+
+func detectCurlFeatures() curlFeatures {
+	output, err := exec.Command("curl", "--version").Output()
+	if err != nil {
+		return curlFeatures{}
+	}
+	return parseCurlVersion(string(output))
+}
+
+// parseCurlVersion parses the features in the output of curl --version, e.g.
+//
+//	curl 8.12.1 (x86_64-pc-linux-gnu) libcurl/8.12.1 OpenSSL/3.0.13 nghttp2/1.64.0
+//	Features: alt-svc AsynchDNS HSTS HTTP2 HTTPS-proxy IPv6 Largefile libz SSL SSLS-EXPORT threadsafe UnixSockets
+func parseCurlVersion(output string) curlFeatures {
+	var features curlFeatures
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "Features:" {
+			continue
+		}
+		for _, feature := range fields[1:] {
+			switch feature {
+			case "HTTP2":
+				features.http2 = true
+			case "SPNEGO", "GSS-API":
+				features.spnego = true
+			case "SSLS-EXPORT":
+				features.tlsSessions = true
+			}
+		}
+	}
+	return features
+}
+
+// curlReuseArgs returns the arguments making curl speak HTTP/2 and resume the TLS sessions of previous invocations,
+// unless the user already chose the HTTP version or the TLS sessions file.
+func curlReuseArgs(args []string, appURL *url.URL, features curlFeatures) []string {
+	var reuseArgs []string
+	if features.http2 && !hasCurlOption(args, "--http0.9", "--http1.0", "--http1.1", "--http2", "--http2-prior-knowledge",
+		"--http3", "--http3-only", "-0") {
+		reuseArgs = append(reuseArgs, "--http2")
+	}
+	if features.tlsSessions && !hasCurlOption(args, "--ssl-sessions") {
+		if path, err := token.GenerateSSHCertFilePathFromURL(appURL, curlTLSSessionsSuffix); err == nil {
+			reuseArgs = append(reuseArgs, "--ssl-sessions", path)
+		}
+	}
+	return reuseArgs
+}
+
+func curlNegotiateEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(curlNegotiateEnv))
+	return enabled
+}
+
+// curlNegotiateArgs returns the arguments making curl answer the Negotiate challenges of the origin with the
+// Kerberos tickets of the user. The Access token is sent in its own header, so the origin gets the SPNEGO token in
+// the Authorization header as if it wasn't behind Access.
+func curlNegotiateArgs(args []string, features curlFeatures) ([]string, error) {
+	if !features.spnego {
+		return nil, errors.New("curl doesn't support SPNEGO, it must be built with a GSS-API library for " + curlNegotiateEnv)
+	}
+	var negotiateArgs []string
+	if !hasCurlOption(args, "--negotiate") {
+		negotiateArgs = append(negotiateArgs, "--negotiate")
+	}
+	// curl only negotiates with a user, the empty one uses the credentials of the Kerberos cache
+	if !hasCurlOption(args, "-u", "--user") {
+		negotiateArgs = append(negotiateArgs, "-u", ":")
+	}
+	return negotiateArgs, nil
+}
+
+// curlClientCertArgs returns the arguments presenting the client certificate of the application, unless the user
+// already passed one to curl. A certificate stored in the keychain is written to a temporary file, the returned
+// function removes it once curl exited.
+func curlClientCertArgs(args []string, settings clientCertSettings, hostname string) ([]string, func(), error) {
+	noCleanup := func() {}
+	if hasCurlOption(args, "-E", "--cert") {
+		return nil, noCleanup, nil
+	}
+	clientCert, ok, err := clientCertificateFor(hostname, settings.cert, settings.key, settings.certsFile)
+	if err != nil || !ok {
+		return nil, noCleanup, err
+	}
+	if name, ok := clientCert.keychainName(); ok {
+		path, remove, err := writeKeychainCertFile(name)
+		if err != nil {
+			return nil, noCleanup, err
+		}
+		return []string{"--cert", path}, remove, nil
+	}
+	cert, key, err := clientCert.paths()
+	if err != nil {
+		return nil, noCleanup, err
+	}
+	return []string{"--cert", cert, "--key", key}, noCleanup, nil
+}
+
+// curlShortOptionsWithValue are the short options of curl taking a value, which is the rest of their argument when
+// they are grouped like -uuser:password.
+const curlShortOptionsWithValue = "ACDEFHKPQTUXYbcdehmortuwxyz"
+
+// hasCurlOption returns whether one of the options is in args. Long options must match a whole argument, short
+// options also match inside a group like -sSL.
+func hasCurlOption(args []string, options ...string) bool {
+	for _, arg := range args {
+		for _, option := range options {
+			if arg == option || isShortOption(option) && inShortOptionGroup(arg, option[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isShortOption(option string) bool {
+	return len(option) == 2 && option[0] == '-' && option[1] != '-'
+}
+
+// inShortOptionGroup returns whether the group of short options in arg has the option, stopping at the first option
+// taking a value.
+func inShortOptionGroup(arg string, option byte) bool {
+	if len(arg) < 2 || arg[0] != '-' || arg[1] == '-' {
+		return false
+	}
+	for i := 1; i < len(arg); i++ {
+		if arg[i] == option {
+			return true
+		}
+		if strings.IndexByte(curlShortOptionsWithValue, arg[i]) >= 0 {
+			return false
+		}
+	}
+	return false
+}
+
+// tokenVerifiedRecently returns whether the token of the app was verified at the edge less than curlVerifyInterval
+// ago.
+func tokenVerifiedRecently(appInfo *token.AppInfo) bool {
+	path, err := token.GenerateAppTokenFilePathFromURL(appInfo.AppDomain, appInfo.AppAUD, curlVerifiedSuffix)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) < curlVerifyInterval
+}
+
+func markTokenVerified(appInfo *token.AppInfo) {
+	path, err := token.GenerateAppTokenFilePathFromURL(appInfo.AppDomain, appInfo.AppAUD, curlVerifiedSuffix)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, nil, 0600); err == nil {
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+	}
+}
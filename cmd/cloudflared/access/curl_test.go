@@ -0,0 +1,72 @@
+package access
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCurlVersion(t *testing.T) {
+	features := parseCurlVersion(`curl 8.12.1 (x86_64-pc-linux-gnu) libcurl/8.12.1 OpenSSL/3.0.13 nghttp2/1.64.0
+Release-Date: 2025-02-13
+Protocols: dict file ftp ftps gopher gophers http https imap imaps mqtt pop3 pop3s rtsp smb smbs smtp smtps telnet tftp
+Features: alt-svc AsynchDNS HSTS HTTP2 HTTPS-proxy IPv6 Largefile libz SSL SSLS-EXPORT threadsafe UnixSockets
+`)
+	assert.Equal(t, curlFeatures{http2: true, tlsSessions: true}, features)
+
+	// curl 8.12 can't export TLS sessions with a TLS backend that doesn't support it
+	features = parseCurlVersion(`curl 8.12.1 (x86_64-pc-linux-gnu) libcurl/8.12.1 GnuTLS/3.8.3 nghttp2/1.64.0
+Features: alt-svc AsynchDNS HSTS HTTP2 HTTPS-proxy IPv6 Largefile libz SSL threadsafe UnixSockets
+`)
+	assert.Equal(t, curlFeatures{http2: true}, features)
+
+	features = parseCurlVersion(`curl 7.68.0 (x86_64-pc-linux-gnu) libcurl/7.68.0 OpenSSL/1.1.1f
+Features: AsynchDNS IPv6 Largefile SSL UnixSockets
+`)
+	assert.Equal(t, curlFeatures{}, features)
+
+	features = parseCurlVersion(`curl 8.5.0 (x86_64-pc-linux-gnu) libcurl/8.5.0 OpenSSL/3.0.13 libssh/0.10.6/openssl/zlib nghttp2/1.59.0
+Features: alt-svc AsynchDNS brotli GSS-API HSTS HTTP2 HTTPS-proxy IDN IPv6 Kerberos Largefile libz NTLM PSL SPNEGO SSL threadsafe TLS-SRP UnixSockets zstd
+`)
+	assert.Equal(t, curlFeatures{http2: true, spnego: true}, features)
+
+	assert.Equal(t, curlFeatures{}, parseCurlVersion(""))
+}
+
+func TestCurlReuseArgs(t *testing.T) {
+	appURL, _ := url.Parse("https://app.example.com/api")
+	features := curlFeatures{http2: true}
+
+	assert.Equal(t, []string{"--http2"}, curlReuseArgs([]string{"https://app.example.com/api", "-s"}, appURL, features))
+	assert.Empty(t, curlReuseArgs([]string{"--http1.1", "https://app.example.com/api"}, appURL, features))
+	assert.Empty(t, curlReuseArgs([]string{"--http2-prior-knowledge", "https://app.example.com/api"}, appURL, features))
+	assert.Empty(t, curlReuseArgs([]string{"https://app.example.com/api"}, appURL, curlFeatures{}))
+}
+
+func TestCurlNegotiateArgs(t *testing.T) {
+	features := curlFeatures{spnego: true}
+
+	args, err := curlNegotiateArgs([]string{"https://intranet.example.com", "-s"}, features)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--negotiate", "-u", ":"}, args)
+
+	args, err = curlNegotiateArgs([]string{"https://intranet.example.com", "--negotiate", "--user", "alice:"}, features)
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+
+	_, err = curlNegotiateArgs([]string{"https://intranet.example.com"}, curlFeatures{})
+	assert.Error(t, err)
+}
+
+func TestHasCurlOption(t *testing.T) {
+	assert.True(t, hasCurlOption([]string{"--cert", "client.pem"}, "-E", "--cert"))
+	assert.False(t, hasCurlOption([]string{"--cert-type", "P12"}, "-E", "--cert"))
+	assert.False(t, hasCurlOption([]string{"--key", "client.key"}, "-k"))
+	assert.True(t, hasCurlOption([]string{"-sSL", "https://app.example.com"}, "-L"))
+	assert.True(t, hasCurlOption([]string{"-uuser:password"}, "-u", "--user"))
+	// the rest of a group after an option taking a value is the value
+	assert.False(t, hasCurlOption([]string{"-HX-Debug: 1"}, "-X"))
+	assert.False(t, hasCurlOption([]string{"--user", "alice:"}, "-u"))
+	assert.False(t, hasCurlOption([]string{"https://app.example.com/-u"}, "-u"))
+}
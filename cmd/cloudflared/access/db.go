@@ -0,0 +1,22 @@
+package access
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const dbProtocolFlag = "protocol"
+
+// db listens for the clients of a database behind Access, so that they connect to localhost:port without handling
+// the Access authorization themselves.
+func db(c *cli.Context) error {
+	log := logger.CreateSSHLoggerFromContext(c, logger.EnableTerminalLog)
+	protocol, err := carrier.ParseDatabaseProtocol(c.String(dbProtocolFlag))
+	if err != nil {
+		log.Err(err).Send()
+		return err
+	}
+	return serveLocalListener(c, "db", carrier.NewDBConnection(protocol, log), log)
+}
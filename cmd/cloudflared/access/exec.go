@@ -0,0 +1,93 @@
+package access
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/token"
+)
+
+const (
+	// execTokenEnv is the raw JWT of the application in the environment of the command
+	execTokenEnv = "CF_ACCESS_TOKEN"
+	// execHeaderEnv is the header carrying the JWT, e.g. for curl -H "$CF_ACCESS_TOKEN_HEADER"
+	execHeaderEnv = "CF_ACCESS_TOKEN_HEADER"
+)
+
+// execCommand runs the command with the token of the application in its environment, fetching a new token if the
+// stored one is missing or expired. The command exits with the status of the child.
+func execCommand(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	app := c.String(appURLFlag)
+	if app == "" || c.Args().Len() == 0 {
+		return cli.ShowCommandHelp(c, "exec")
+	}
+	appURL, err := parseURL(app)
+	if err != nil {
+		return err
+	}
+
+	serviceToken, err := loadServiceToken(c.String(sshTokenIDFlag), c.String(sshTokenSecretFlag), c.String(sshTokenFileFlag))
+	if err != nil {
+		return err
+	}
+	clientCerts := clientCertSettingsFrom(c)
+	clientTLS, err := clientCerts.tlsConfig(appURL.Hostname())
+	if err != nil {
+		return err
+	}
+	var tok string
+	if serviceToken.IsSet() {
+		appInfo, err := token.GetAppInfo(appURL, clientTLS)
+		if err != nil {
+			return err
+		}
+		tok, err = token.FetchServiceToken(appURL, appInfo, serviceToken, clientTLS)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch a token with the service token")
+		}
+	} else {
+		tok, _, err = fetchAppToken(app, clientCerts, log)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get a token for %s", app)
+		}
+	}
+
+	args := c.Args().Slice()
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = execEnv(os.Environ(), tok)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return cli.Exit("", exitErr.ExitCode())
+		}
+		return err
+	}
+	return nil
+}
+
+// execEnv returns the environment with the token variables, replacing the ones inherited from the parent.
+func execEnv(environ []string, tok string) []string {
+	env := make([]string, 0, len(environ)+2)
+	for _, variable := range environ {
+		if strings.HasPrefix(variable, execTokenEnv+"=") || strings.HasPrefix(variable, execHeaderEnv+"=") {
+			continue
+		}
+		env = append(env, variable)
+	}
+	return append(env,
+		fmt.Sprintf("%s=%s", execTokenEnv, tok),
+		fmt.Sprintf("%s=%s: %s", execHeaderEnv, carrier.CFAccessTokenHeader, tok),
+	)
+}
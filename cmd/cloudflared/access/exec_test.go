@@ -0,0 +1,16 @@
+package access
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecEnv(t *testing.T) {
+	env := execEnv([]string{"HOME=/home/alice", "CF_ACCESS_TOKEN=stale", "CF_ACCESS_TOKEN_HEADER=stale"}, "eyJhbGciOi")
+	assert.Equal(t, []string{
+		"HOME=/home/alice",
+		"CF_ACCESS_TOKEN=eyJhbGciOi",
+		"CF_ACCESS_TOKEN_HEADER=Cf-Access-Token: eyJhbGciOi",
+	}, env)
+}
@@ -0,0 +1,110 @@
+package access
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/stream"
+	"github.com/cloudflare/cloudflared/token"
+)
+
+const (
+	sshMultiplexFlag            = "multiplex"
+	sshMultiplexIdleTimeoutFlag = "multiplex-idle-timeout"
+	sshMultiplexServerFlag      = "multiplex-server"
+	sshMultiplexServerEnv       = "TUNNEL_SERVICE_MULTIPLEX_SERVER"
+)
+
+// multiplexSocketPath returns the path of the socket shared by the invocations for the same application, destination
+// and identity. The key of the socket hashes everything the connections are dialed with, the headers carrying the
+// destination and the service token, and the client certificate, so that an invocation never gets a connection
+// dialed for another destination or identity.
+func multiplexSocketPath(appURL *url.URL, options *carrier.StartOptions) (string, error) {
+	key := sha256.New()
+	write := func(value string) {
+		_, _ = key.Write([]byte(value))
+		_, _ = key.Write([]byte{0})
+	}
+	write(appURL.String())
+	write(options.OriginURL)
+	names := make([]string, 0, len(options.Headers))
+	for name := range options.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write(name)
+		for _, value := range options.Headers.Values(name) {
+			write(value)
+		}
+	}
+	if options.TLSClientConfig != nil {
+		for _, certificate := range options.TLSClientConfig.Certificates {
+			for _, der := range certificate.Certificate {
+				write(string(der))
+			}
+		}
+	}
+	return token.GenerateSSHCertFilePathFromURL(appURL, fmt.Sprintf("mux-%x.sock", key.Sum(nil)[:8]))
+}
+
+// serveMultiplexed serves the stream through the multiplexing server of the application. If there is no server yet,
+// one is started in the background for the next invocations and an error is returned so that this invocation connects
+// directly.
+func serveMultiplexed(appURL *url.URL, options *carrier.StartOptions, s io.ReadWriter, log *zerolog.Logger) error {
+	path, err := multiplexSocketPath(appURL, options)
+	if err != nil {
+		return err
+	}
+	conn, err := carrier.DialMux(path)
+	if err != nil {
+		if startErr := startMultiplexServer(); startErr != nil {
+			log.Err(startErr).Msg("Failed to start the multiplexing server")
+		}
+		return err
+	}
+	defer conn.Close()
+	stream.Pipe(conn, s, log)
+	return nil
+}
+
+// startMultiplexServer runs the same command in the background as a multiplexing server. The server doesn't share the
+// standard streams of this process, so that the parent of this process doesn't wait for them to be closed.
+func startMultiplexServer() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), sshMultiplexServerEnv+"=true")
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "failed to start the multiplexing server")
+	}
+	return cmd.Process.Release()
+}
+
+// runMultiplexServer serves the connections to the application until no invocation used it for the idle timeout.
+func runMultiplexServer(appURL *url.URL, options *carrier.StartOptions, idleTimeout time.Duration, log *zerolog.Logger) error {
+	path, err := multiplexSocketPath(appURL, options)
+	if err != nil {
+		return err
+	}
+	listener, err := carrier.ListenMux(path)
+	if err != nil {
+		log.Debug().Err(err).Msg("Not starting the multiplexing server")
+		return nil
+	}
+	log.Info().Str(LogFieldHost, appURL.Host).Str("socket", path).Msg("Start multiplexing server")
+	return carrier.NewMuxServer(options, idleTimeout, log).Serve(listener)
+}
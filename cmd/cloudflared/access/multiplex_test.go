@@ -0,0 +1,37 @@
+package access
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/carrier"
+)
+
+func TestMultiplexSocketPath(t *testing.T) {
+	appURL, err := url.Parse("https://bastion.example.com")
+	require.NoError(t, err)
+	options := func(destination, clientID string) *carrier.StartOptions {
+		headers := http.Header{}
+		headers.Set(cfAccessClientIDHeader, clientID)
+		carrier.SetBastionDest(headers, destination)
+		return &carrier.StartOptions{OriginURL: appURL.String(), Headers: headers, Host: appURL.Host}
+	}
+
+	first, err := multiplexSocketPath(appURL, options("first.internal:22", "id"))
+	require.NoError(t, err)
+	again, err := multiplexSocketPath(appURL, options("first.internal:22", "id"))
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	// The invocations for another destination or identity through the same bastion don't share the connections
+	second, err := multiplexSocketPath(appURL, options("second.internal:22", "id"))
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	otherID, err := multiplexSocketPath(appURL, options("first.internal:22", "other-id"))
+	require.NoError(t, err)
+	assert.NotEqual(t, first, otherID)
+}
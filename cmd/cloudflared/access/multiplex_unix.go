@@ -0,0 +1,10 @@
+//go:build !windows
+
+package access
+
+import "syscall"
+
+// detachedProcAttr starts the process in its own session so that it outlives the terminal of its parent
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,57 @@
+package access
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/token"
+)
+
+var outputFormatFlag = &cli.StringFlag{
+	Name:    "output",
+	Aliases: []string{"o"},
+	Usage:   "Render output using given `FORMAT`. Valid options are 'json' or 'yaml'",
+}
+
+// tokenOutput is the token of an application as printed with --output.
+type tokenOutput struct {
+	App        string     `json:"app" yaml:"app"`
+	AppAUD     string     `json:"app_aud,omitempty" yaml:"app_aud,omitempty"`
+	AuthDomain string     `json:"auth_domain,omitempty" yaml:"auth_domain,omitempty"`
+	Email      string     `json:"email,omitempty" yaml:"email,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	Token      string     `json:"token,omitempty" yaml:"token,omitempty"`
+	Error      string     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newTokenOutput(app string, appInfo *token.AppInfo, tok string) tokenOutput {
+	output := tokenOutput{App: app, Token: tok}
+	if appInfo != nil {
+		output.AppAUD = appInfo.AppAUD
+		output.AuthDomain = appInfo.AuthDomain
+	}
+	if claims, err := token.ParseClaims(tok); err == nil {
+		output.Email = claims.Email
+		expiresAt := claims.ExpiresAt.UTC()
+		output.ExpiresAt = &expiresAt
+	}
+	return output
+}
+
+func renderOutput(format string, v interface{}) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "yaml":
+		return yaml.NewEncoder(os.Stdout).Encode(v)
+	default:
+		return errors.Errorf("Unknown output format '%s'", format)
+	}
+}
@@ -0,0 +1,22 @@
+package access
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const rdpRequireNLAFlag = "require-nla"
+
+// rdp listens for Remote Desktop clients and forwards each of their connections to the edge until cloudflared is
+// stopped.
+func rdp(c *cli.Context) error {
+	log := logger.CreateSSHLoggerFromContext(c, logger.EnableTerminalLog)
+	conn := &carrier.RDPConnection{
+		Connection: carrier.NewWSConnection(log),
+		RequireNLA: c.Bool(rdpRequireNLAFlag),
+		Log:        log,
+	}
+	return serveLocalListener(c, "rdp", conn, log)
+}
@@ -0,0 +1,15 @@
+package access
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+// socks listens for SOCKS5 clients, each destination they connect to is reached through the bastion behind the Access
+// application.
+func socks(c *cli.Context) error {
+	log := logger.CreateSSHLoggerFromContext(c, logger.EnableTerminalLog)
+	return serveLocalListener(c, "socks", carrier.NewSocksConnection(log), log)
+}
@@ -0,0 +1,295 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/token"
+)
+
+const (
+	tokenDaemonSocketFlag        = "socket"
+	tokenDaemonRefreshBeforeFlag = "refresh-before"
+
+	tokenDaemonDefaultSocket        = "~/.cloudflared/access-tokens.sock"
+	tokenDaemonDefaultRefreshBefore = 5 * time.Minute
+	// tokenDaemonCheckInterval is how often the daemon looks for tokens to refresh
+	tokenDaemonCheckInterval = 30 * time.Second
+)
+
+// daemonApp is the token of an application kept by the token daemon.
+type daemonApp struct {
+	app       string
+	appInfo   *token.AppInfo
+	token     string
+	expiresAt time.Time
+	err       error
+}
+
+// tokenDaemon keeps the tokens of the applications valid, refreshing them before they expire, and serves them to
+// local consumers over a Unix socket so that they never wait for a login.
+type tokenDaemon struct {
+	refreshBefore time.Duration
+	clientCerts   clientCertSettings
+	log           *zerolog.Logger
+
+	lock sync.RWMutex
+	apps map[string]*daemonApp
+	// order is the order of the applications in the configuration
+	order []string
+}
+
+func newTokenDaemon(apps []string, refreshBefore time.Duration, log *zerolog.Logger) *tokenDaemon {
+	d := &tokenDaemon{
+		refreshBefore: refreshBefore,
+		log:           log,
+		apps:          make(map[string]*daemonApp, len(apps)),
+	}
+	for _, app := range apps {
+		if _, ok := d.apps[app]; ok {
+			continue
+		}
+		d.apps[app] = &daemonApp{app: app}
+		d.order = append(d.order, app)
+	}
+	return d
+}
+
+// tokenDaemonCommand runs the token daemon until cloudflared is stopped.
+func tokenDaemonCommand(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+	apps, err := tokenApps(c)
+	if err != nil {
+		return err
+	}
+	d := newTokenDaemon(apps, c.Duration(tokenDaemonRefreshBeforeFlag), log)
+	d.clientCerts = clientCertSettingsFrom(c)
+
+	socketPath, err := homedir.Expand(c.String(tokenDaemonSocketFlag))
+	if err != nil {
+		return err
+	}
+	listener, err := listenTokenSocket(socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketPath)
+	log.Info().Msgf("Serving the tokens of %d Access applications on %s", len(d.order), socketPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-shutdownC
+		cancel()
+	}()
+	go d.run(ctx)
+
+	server := &http.Server{Handler: d.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// listenTokenSocket listens on a Unix socket only the user can connect to, since it hands out their tokens.
+func listenTokenSocket(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, errors.Errorf("a token daemon is already listening on %s", path)
+	}
+	// The socket of a daemon that didn't exit cleanly is left behind
+	_ = os.Remove(path)
+	// The socket is restricted to the user in a directory only they can enter before it's moved in place, so that
+	// other users can't connect in between
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".token-daemon-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the directory of the token socket")
+	}
+	defer os.RemoveAll(dir)
+	tempPath := filepath.Join(dir, "socket")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tempPath, Net: "unix"})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen on the token socket")
+	}
+	// The listener would remove its temporary path when closed, instead of the socket moved in place
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(tempPath, 0600); err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "failed to restrict the token socket to the user")
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "failed to move the token socket in place")
+	}
+	return &tokenSocketListener{UnixListener: listener, path: path}, nil
+}
+
+// tokenSocketListener removes the token socket when it's closed.
+type tokenSocketListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *tokenSocketListener) Close() error {
+	err := l.UnixListener.Close()
+	_ = os.Remove(l.path)
+	return err
+}
+
+// run refreshes the tokens until the context is cancelled, one application after the other so that a login is
+// shared by the applications of an organization.
+func (d *tokenDaemon) run(ctx context.Context) {
+	ticker := time.NewTicker(tokenDaemonCheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, app := range d.order {
+			if ctx.Err() != nil {
+				return
+			}
+			d.refresh(app)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh renews the token of the application if it expires within the refresh window. The token is renewed
+// without prompting while the org token is valid, and with a login once the token expired otherwise.
+func (d *tokenDaemon) refresh(app string) {
+	d.lock.RLock()
+	current := *d.apps[app]
+	d.lock.RUnlock()
+	if current.token != "" && time.Until(current.expiresAt) > d.refreshBefore {
+		return
+	}
+
+	updated := current
+	tok, appInfo, err := d.fetch(current)
+	if err != nil {
+		d.log.Err(err).Str("app", app).Msg("Failed to refresh the Access token")
+		updated.err = err
+	} else {
+		updated.token, updated.appInfo, updated.err = tok, appInfo, nil
+		if claims, err := token.ParseClaims(tok); err == nil {
+			updated.expiresAt = claims.ExpiresAt
+		}
+		d.log.Info().Str("app", app).Msgf("Refreshed the Access token, valid until %s", updated.expiresAt)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.apps[app] = &updated
+}
+
+func (d *tokenDaemon) fetch(current daemonApp) (string, *token.AppInfo, error) {
+	appURL, err := parseURL(current.app)
+	if err != nil {
+		return "", nil, err
+	}
+	clientTLS, err := d.clientCerts.tlsConfig(appURL.Hostname())
+	if err != nil {
+		return "", nil, err
+	}
+	appInfo := current.appInfo
+	if appInfo == nil {
+		if appInfo, err = token.GetAppInfo(appURL, clientTLS); err != nil {
+			return "", nil, err
+		}
+	}
+	// The stored token is used until it needs to be refreshed
+	if tok, err := token.GetAppTokenIfExists(appInfo); err == nil && tok != "" {
+		if claims, err := token.ParseClaims(tok); err == nil && time.Until(claims.ExpiresAt) > d.refreshBefore {
+			return tok, appInfo, nil
+		}
+	}
+	tok, err := token.RefreshAppToken(appURL, appInfo, clientTLS)
+	if err == nil {
+		return tok, appInfo, nil
+	}
+	if current.token != "" && time.Now().Before(current.expiresAt) {
+		// The current token is still served until it expires, logging in only then
+		return "", nil, err
+	}
+	// The stored token is returned while it's valid, a login only starts once it expired
+	tok, err = token.FetchToken(appURL, appInfo, &token.LoginOptions{TLSClientConfig: clientTLS}, d.log)
+	return tok, appInfo, err
+}
+
+// handler serves GET /tokens with the tokens of all the applications, and GET /token?app=<url> with the token of an
+// application.
+func (d *tokenDaemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tokens", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		d.lock.RLock()
+		outputs := make([]tokenOutput, 0, len(d.order))
+		for _, app := range d.order {
+			outputs = append(outputs, d.apps[app].output())
+		}
+		d.lock.RUnlock()
+		writeDaemonJSON(w, http.StatusOK, outputs)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		app := r.URL.Query().Get("app")
+		d.lock.RLock()
+		state, ok := d.apps[app]
+		var output tokenOutput
+		if ok {
+			output = state.output()
+		}
+		d.lock.RUnlock()
+		switch {
+		case !ok:
+			writeDaemonJSON(w, http.StatusNotFound, tokenOutput{App: app, Error: "application is not managed by the token daemon"})
+		case output.Token == "":
+			writeDaemonJSON(w, http.StatusServiceUnavailable, output)
+		default:
+			writeDaemonJSON(w, http.StatusOK, output)
+		}
+	})
+	return mux
+}
+
+// output returns the token of the application, without it if it expired.
+func (a *daemonApp) output() tokenOutput {
+	if a.token == "" || time.Now().After(a.expiresAt) {
+		output := tokenOutput{App: a.app, Error: "no valid token yet"}
+		if a.err != nil {
+			output.Error = a.err.Error()
+		}
+		return output
+	}
+	return newTokenOutput(a.app, a.appInfo, a.token)
+}
+
+func writeDaemonJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,93 @@
+package access
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/token"
+)
+
+func TestTokenDaemonHandler(t *testing.T) {
+	log := zerolog.Nop()
+	d := newTokenDaemon([]string{"https://app.example.com", "https://wiki.example.com", "https://app.example.com"}, time.Minute, &log)
+	require.Equal(t, []string{"https://app.example.com", "https://wiki.example.com"}, d.order)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	tok, err := jwt.Signed(signer).Claims(jwt.Claims{Expiry: jwt.NewNumericDate(expiresAt)}).Serialize()
+	require.NoError(t, err)
+	d.apps["https://app.example.com"] = &daemonApp{
+		app:       "https://app.example.com",
+		appInfo:   &token.AppInfo{AuthDomain: "team.cloudflareaccess.com", AppAUD: "aud", AppDomain: "app.example.com"},
+		token:     tok,
+		expiresAt: expiresAt,
+	}
+	handler := d.handler()
+
+	get := func(path string) (int, []byte) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code, recorder.Body.Bytes()
+	}
+
+	status, body := get("/token?app=https://app.example.com")
+	assert.Equal(t, http.StatusOK, status)
+	var output tokenOutput
+	require.NoError(t, json.Unmarshal(body, &output))
+	assert.Equal(t, tok, output.Token)
+	assert.Equal(t, "aud", output.AppAUD)
+	require.NotNil(t, output.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*output.ExpiresAt))
+
+	status, _ = get("/token?app=https://wiki.example.com")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	status, _ = get("/token?app=https://unknown.example.com")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body = get("/tokens")
+	assert.Equal(t, http.StatusOK, status)
+	var outputs []tokenOutput
+	require.NoError(t, json.Unmarshal(body, &outputs))
+	require.Len(t, outputs, 2)
+	assert.Equal(t, tok, outputs[0].Token)
+	assert.Empty(t, outputs[1].Token)
+	assert.NotEmpty(t, outputs[1].Error)
+}
+
+func TestListenTokenSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the token socket is restricted by its file mode")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access-tokens.sock")
+	listener, err := listenTokenSocket(path)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	_, err = listenTokenSocket(path)
+	assert.Error(t, err, "a daemon is already listening")
+	require.NoError(t, listener.Close())
+	assert.NoFileExists(t, path)
+}
@@ -0,0 +1,116 @@
+package access
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/token"
+)
+
+const tokenAppsFileFlag = "apps-file"
+
+// tokenApps returns the applications of the token command, from its arguments, --app flags and apps file.
+func tokenApps(c *cli.Context) ([]string, error) {
+	apps := append(c.Args().Slice(), c.StringSlice(appURLFlag)...)
+	if path := c.String(tokenAppsFileFlag); path != "" {
+		fromFile, err := readAppsFile(path)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, fromFile...)
+	}
+	if len(apps) == 0 {
+		fmt.Fprintln(os.Stderr, "Please provide a url.")
+		return nil, errors.New("no Access application provided")
+	}
+	return apps, nil
+}
+
+// readAppsFile reads a file with an application per line, empty lines and lines starting with # are skipped.
+func readAppsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the apps file")
+	}
+	defer file.Close()
+
+	var apps []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		apps = append(apps, line)
+	}
+	return apps, errors.Wrap(scanner.Err(), "failed to read the apps file")
+}
+
+// generateTokens prints a JSON object mapping each application to its token. The missing tokens are fetched one
+// application after the other, so that the org token of the first login is exchanged for the tokens of the other
+// applications of the organization instead of prompting again. The tokens that could be fetched are printed even if
+// some applications failed. With --output, it prints a list with the details of the token of each application
+// instead.
+func generateTokens(c *cli.Context, apps []string) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+	tokens := make(map[string]string, len(apps))
+	outputs := make([]tokenOutput, 0, len(apps))
+	clientCerts := clientCertSettingsFrom(c)
+	var failed []string
+	for _, app := range apps {
+		tok, appInfo, err := fetchAppToken(app, clientCerts, log)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get a token for %s: %v\n", app, err)
+			failed = append(failed, app)
+			outputs = append(outputs, tokenOutput{App: app, Error: err.Error()})
+			continue
+		}
+		tokens[app] = tok
+		outputs = append(outputs, newTokenOutput(app, appInfo, tok))
+	}
+
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		if err := renderOutput(outputFormat, outputs); err != nil {
+			return err
+		}
+	} else {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(tokens); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write tokens to stdout.")
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to get tokens for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func fetchAppToken(app string, clientCerts clientCertSettings, log *zerolog.Logger) (string, *token.AppInfo, error) {
+	appURL, err := parseURL(app)
+	if err != nil {
+		return "", nil, err
+	}
+	clientTLS, err := clientCerts.tlsConfig(appURL.Hostname())
+	if err != nil {
+		return "", nil, err
+	}
+	appInfo, err := token.GetAppInfo(appURL, clientTLS)
+	if err != nil {
+		return "", nil, err
+	}
+	if tok, err := token.GetAppTokenIfExists(appInfo); err == nil && tok != "" {
+		return tok, appInfo, nil
+	}
+	tok, err := token.FetchToken(appURL, appInfo, &token.LoginOptions{TLSClientConfig: clientTLS}, log)
+	return tok, appInfo, err
+}
@@ -0,0 +1,21 @@
+package access
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAppsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apps")
+	require.NoError(t, os.WriteFile(path, []byte("# staging\nstaging.example.com\n\n  https://grafana.example.com/d  \n"), 0600))
+	apps, err := readAppsFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"staging.example.com", "https://grafana.example.com/d"}, apps)
+
+	_, err = readAppsFile(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,28 @@
+package access
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const udpIdleTimeoutFlag = "idle-timeout"
+
+// udp listens for the datagrams of local clients of a UDP application behind Access, e.g. SNMP tools, and forwards
+// them over the tunnel without WARP.
+func udp(c *cli.Context) error {
+	log := logger.CreateSSHLoggerFromContext(c, logger.EnableTerminalLog)
+	address, options, err := localListenerOptions(c, "udp", log)
+	if err != nil || options == nil {
+		return err
+	}
+
+	forwarder := carrier.NewUDPForwarder(carrier.NewWSConnection(log), options, c.Duration(udpIdleTimeoutFlag), log)
+	log.Info().Str(LogFieldHost, address).Msg("Start udp listener")
+	err = forwarder.ListenAndServe(address, shutdownC)
+	if err != nil {
+		log.Err(err).Msg("Error on udp listener")
+	}
+	return err
+}
@@ -3,6 +3,7 @@ package access
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -53,3 +54,22 @@ func parseURL(input string) (*url.URL, error) {
 	url.Host = host
 	return url, nil
 }
+
+// checkLocalListener refuses to listen on addresses reachable from other hosts unless it's allowed, since anyone
+// connecting to the listener reaches the application with the Access session of the user.
+func checkLocalListener(address string, allowRemote bool) error {
+	if allowRemote {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid listener address: %w", err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("refusing to listen on %s, which other hosts can reach: use a loopback address or set --%s", address, allowRemoteFlag)
+}
@@ -78,3 +78,14 @@ func TestParseURL(t *testing.T) {
 		assert.ErrorContains(t, err, "failed to parse as URL")
 	})
 }
+
+func TestCheckLocalListener(t *testing.T) {
+	for _, address := range []string{"localhost:3389", "127.0.0.1:3389", "[::1]:1080"} {
+		assert.NoError(t, checkLocalListener(address, false), address)
+	}
+	for _, address := range []string{"0.0.0.0:3389", ":1080", "192.0.2.1:3389", "[::]:1080"} {
+		assert.Error(t, checkLocalListener(address, false), address)
+		assert.NoError(t, checkLocalListener(address, true), address)
+	}
+	assert.Error(t, checkLocalListener("localhost", false))
+}
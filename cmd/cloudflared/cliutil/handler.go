@@ -5,9 +5,13 @@ import (
 	"github.com/urfave/cli/v2/altsrc"
 
 	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/credentials"
 	"github.com/cloudflare/cloudflared/logger"
 )
 
+// ProfileFlag selects a profile of the configuration file.
+const ProfileFlag = "profile"
+
 func Action(actionFunc cli.ActionFunc) cli.ActionFunc {
 	return WithErrorHandler(actionFunc)
 }
@@ -34,6 +38,9 @@ func ConfiguredActionWithWarnings(actionFunc func(*cli.Context, string) error) c
 
 func setFlagsFromConfigFile(c *cli.Context) (configWarnings string, err error) {
 	const errorExitCode = 1
+	if err := applyProfile(c); err != nil {
+		return "", cli.Exit(err, errorExitCode)
+	}
 	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
 	inputSource, warnings, err := config.ReadConfigFile(c, log)
 	if err != nil {
@@ -48,3 +55,36 @@ func setFlagsFromConfigFile(c *cli.Context) (configWarnings string, err error) {
 	}
 	return warnings, nil
 }
+
+// applyProfile sets the configuration file, origin certificate and credentials file flags to those of the profile
+// selected with --profile, unless they are set explicitly.
+func applyProfile(c *cli.Context) error {
+	name := c.String(ProfileFlag)
+	if name == "" {
+		return nil
+	}
+	profile, err := config.FindProfile(c.String("config"), name)
+	if err != nil {
+		return err
+	}
+	for flagName, value := range map[string]string{
+		"config":                   profile.ConfigFile,
+		credentials.OriginCertFlag: profile.OriginCert,
+		"credentials-file":         profile.CredentialsFile,
+	} {
+		if value == "" || c.IsSet(flagName) {
+			continue
+		}
+		setInLineage(c, flagName, value)
+	}
+	return nil
+}
+
+// setInLineage sets the flag in the closest context that defines it, flags no context defines are ignored.
+func setInLineage(c *cli.Context, name, value string) {
+	for _, ctx := range c.Lineage() {
+		if ctx.Set(name, value) == nil {
+			return
+		}
+	}
+}
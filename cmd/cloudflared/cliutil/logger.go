@@ -1,6 +1,8 @@
 package cliutil
 
 import (
+	"time"
+
 	"github.com/urfave/cli/v2"
 	"github.com/urfave/cli/v2/altsrc"
 
@@ -41,6 +43,50 @@ func ConfigureLoggingFlags(shouldHide bool) []cli.Flag {
 			EnvVars: []string{"TUNNEL_LOGDIRECTORY"},
 			Hidden:  shouldHide,
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    logger.LogSyslogFlag,
+			Usage:   "Send the application log to syslog as RFC 5424 messages, at udp://HOST:PORT, tcp://HOST:PORT, unix:///PATH or local for the syslog daemon of this host.",
+			EnvVars: []string{"TUNNEL_LOG_SYSLOG"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    logger.LogSyslogFacilityFlag,
+			Usage:   "Facility of the messages sent to --log-syslog, e.g. daemon or local0.",
+			Value:   "daemon",
+			EnvVars: []string{"TUNNEL_LOG_SYSLOG_FACILITY"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    logger.LogJournaldFlag,
+			Usage:   "Send the application log to the systemd journal, with the fields of each event as fields of the journal entry.",
+			EnvVars: []string{"TUNNEL_LOG_JOURNALD"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    logger.LogRateLimitFlag,
+			Usage:   "Maximum number of times the same message is logged at the same level per --log-rate-limit-period, the count of the messages over it is logged at the end of the period. N applies to all the levels and LEVEL=N to a single level, e.g. 10 and debug=0 to not limit the debug messages. Can be repeated.",
+			EnvVars: []string{"TUNNEL_LOG_RATE_LIMIT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    logger.LogRateLimitPeriodFlag,
+			Usage:   "Period of the --log-rate-limit.",
+			Value:   time.Second,
+			EnvVars: []string{"TUNNEL_LOG_RATE_LIMIT_PERIOD"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    logger.LogSampleRateFlag,
+			Usage:   "Still log 1 out of every N messages over the --log-rate-limit. Default is 0 which logs none of them.",
+			EnvVars: []string{"TUNNEL_LOG_SAMPLE_RATE"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    logger.LogRedactFlag,
+			Usage:   "Regular expression whose matches are replaced by REDACTED in all the log output, including the streamed logs and the access log, e.g. to hide tokens, cookies or internal hostnames. When it has groups, only the groups are replaced, e.g. token=(\\w+). Can be repeated.",
+			EnvVars: []string{"TUNNEL_LOG_REDACT"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    "trace-output",
 			Usage:   "Name of trace output file, generated when cloudflared stops.",
@@ -5,11 +5,15 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/tunnel"
+	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/logger"
 )
 
@@ -17,20 +21,36 @@ const (
 	launchdIdentifier = "com.cloudflare.cloudflared"
 )
 
+// launchdScope is whether cloudflared is installed as a launch agent of the user, which only runs while the user is
+// logged in, or as a launch daemon of the system, which runs at boot as root.
+type launchdScope string
+
+const (
+	launchdUserScope   launchdScope = "user"
+	launchdSystemScope launchdScope = "system"
+)
+
+var launchdScopeFlag = &cli.StringFlag{
+	Name:  "scope",
+	Usage: "Install cloudflared as a launch agent of the current user (user) or as a launch daemon of the system running at boot (system). Defaults to system when run as root, user otherwise.",
+}
+
 func runApp(app *cli.App, graceShutdownC chan struct{}) {
 	app.Commands = append(app.Commands, &cli.Command{
 		Name:  "service",
-		Usage: "Manages the cloudflared launch agent",
+		Usage: "Manages the cloudflared launch agent or launch daemon",
 		Subcommands: []*cli.Command{
 			{
 				Name:   "install",
-				Usage:  "Install cloudflared as an user launch agent",
+				Usage:  "Install cloudflared as an user launch agent or a system launch daemon",
 				Action: cliutil.ConfiguredAction(installLaunchd),
+				Flags:  []cli.Flag{launchdScopeFlag},
 			},
 			{
 				Name:   "uninstall",
-				Usage:  "Uninstall the cloudflared launch agent",
+				Usage:  "Uninstall the cloudflared launch agent or launch daemon",
 				Action: cliutil.ConfiguredAction(uninstallLaunchd),
+				Flags:  []cli.Flag{launchdScopeFlag},
 			},
 		},
 	})
@@ -75,44 +95,144 @@ func isRootUser() bool {
 	return os.Geteuid() == 0
 }
 
-func installPath() (string, error) {
-	// User is root, use /Library/LaunchDaemons instead of home directory
-	if isRootUser() {
-		return fmt.Sprintf("/Library/LaunchDaemons/%s.plist", launchdIdentifier), nil
+func launchdScopeFromContext(c *cli.Context) (launchdScope, error) {
+	scope := launchdScope(c.String(launchdScopeFlag.Name))
+	switch scope {
+	case "":
+		if isRootUser() {
+			return launchdSystemScope, nil
+		}
+		return launchdUserScope, nil
+	case launchdSystemScope:
+		if !isRootUser() {
+			return "", cliutil.UsageError("Installing cloudflared as a system launch daemon requires root permission, run the command with sudo.")
+		}
+		return scope, nil
+	case launchdUserScope:
+		if isRootUser() {
+			return "", cliutil.UsageError("The user launch agent can't be managed as root, run the command without sudo.")
+		}
+		return scope, nil
+	default:
+		return "", cliutil.UsageError("--%s must be either %s or %s", launchdScopeFlag.Name, launchdUserScope, launchdSystemScope)
+	}
+}
+
+// baseDir is the directory under which the plist and the logs of the scope are.
+func (s launchdScope) baseDir() (string, error) {
+	if s == launchdSystemScope {
+		return "/Library", nil
 	}
 	userHomeDir, err := userHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%s/Library/LaunchAgents/%s.plist", userHomeDir, launchdIdentifier), nil
+	return filepath.Join(userHomeDir, "Library"), nil
 }
 
-func stdoutPath() (string, error) {
-	if isRootUser() {
-		return fmt.Sprintf("/Library/Logs/%s.out.log", launchdIdentifier), nil
-	}
-	userHomeDir, err := userHomeDir()
+func (s launchdScope) installPath() (string, error) {
+	baseDir, err := s.baseDir()
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%s/Library/Logs/%s.out.log", userHomeDir, launchdIdentifier), nil
+	if s == launchdSystemScope {
+		return filepath.Join(baseDir, "LaunchDaemons", launchdIdentifier+".plist"), nil
+	}
+	return filepath.Join(baseDir, "LaunchAgents", launchdIdentifier+".plist"), nil
 }
 
-func stderrPath() (string, error) {
-	if isRootUser() {
-		return fmt.Sprintf("/Library/Logs/%s.err.log", launchdIdentifier), nil
+func (s launchdScope) stdoutPath() (string, error) {
+	baseDir, err := s.baseDir()
+	if err != nil {
+		return "", err
 	}
-	userHomeDir, err := userHomeDir()
+	return filepath.Join(baseDir, "Logs", launchdIdentifier+".out.log"), nil
+}
+
+func (s launchdScope) stderrPath() (string, error) {
+	baseDir, err := s.baseDir()
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%s/Library/Logs/%s.err.log", userHomeDir, launchdIdentifier), nil
+	return filepath.Join(baseDir, "Logs", launchdIdentifier+".err.log"), nil
+}
+
+func (s launchdScope) template() (*ServiceTemplate, error) {
+	installPath, err := s.installPath()
+	if err != nil {
+		return nil, errors.Wrap(err, "error determining install path")
+	}
+	stdoutPath, err := s.stdoutPath()
+	if err != nil {
+		return nil, errors.Wrap(err, "error determining stdout path")
+	}
+	stderrPath, err := s.stderrPath()
+	if err != nil {
+		return nil, errors.Wrap(err, "error determining stderr path")
+	}
+	return newLaunchdTemplate(installPath, stdoutPath, stderrPath), nil
+}
+
+// launchdExtraArgs returns the arguments of cloudflared in the plist. Launchd doesn't set the home directory of the
+// launch daemons, so a system launch daemon runs with a copy of the configuration and of the credentials in the
+// default configuration directory instead of the ones of the user installing it.
+func launchdExtraArgs(c *cli.Context, scope launchdScope, log *zerolog.Logger) ([]string, error) {
+	if c.NArg() > 0 {
+		return buildArgsForToken(c, log)
+	}
+	src, _, err := config.ReadConfigFile(c, log)
+	if err != nil {
+		if err == config.ErrNoConfigFile {
+			// cloudflared searches the default configuration directories when it starts
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	srcPath, err := filepath.Abs(src.Source())
+	if err != nil {
+		return nil, err
+	}
+	if scope == launchdUserScope {
+		return []string{"--config", srcPath}, nil
+	}
+
+	credentialsFile, err := src.String(tunnel.CredFileFlag)
+	if err != nil || src.TunnelID == "" || credentialsFile == "" {
+		return nil, fmt.Errorf(`Configuration file %s must contain entries for the tunnel to run and its associated credentials:
+tunnel: TUNNEL-UUID
+credentials-file: CREDENTIALS-FILE
+`, src.Source())
+	}
+	if err := ensureConfigDirExists(config.DefaultUnixConfigLocation); err != nil {
+		return nil, err
+	}
+	configPath := filepath.Join(config.DefaultUnixConfigLocation, config.DefaultConfigFiles[0])
+	if srcPath != configPath {
+		if exists, err := config.FileExists(configPath); err != nil || exists {
+			return nil, fmt.Errorf("Possible conflicting configuration in %[1]s and %[2]s. Either remove %[2]s or run `cloudflared --config %[2]s service install`", srcPath, configPath)
+		}
+		if err := copyFile(srcPath, configPath); err != nil {
+			return nil, fmt.Errorf("failed to copy %s to %s: %w", srcPath, configPath, err)
+		}
+		log.Info().Msgf("Copied the configuration file %s to %s", srcPath, configPath)
+	}
+	credentialsPath := filepath.Join(config.DefaultUnixConfigLocation, src.TunnelID+".json")
+	if err := copyCredential(credentialsFile, credentialsPath); err != nil {
+		return nil, fmt.Errorf("failed to copy the credentials file %s to %s: %w", credentialsFile, credentialsPath, err)
+	}
+	return []string{
+		"--config", configPath, "tunnel", "run", "--" + tunnel.CredFileFlag, credentialsPath,
+	}, nil
 }
 
 func installLaunchd(c *cli.Context) error {
 	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
 
-	if isRootUser() {
+	scope, err := launchdScopeFromContext(c)
+	if err != nil {
+		return err
+	}
+	if scope == launchdSystemScope {
 		log.Info().Msg("Installing cloudflared client as a system launch daemon. " +
 			"cloudflared client will run at boot")
 	} else {
@@ -126,29 +246,18 @@ func installLaunchd(c *cli.Context) error {
 		log.Err(err).Msg("Error determining executable path")
 		return fmt.Errorf("Error determining executable path: %v", err)
 	}
-	installPath, err := installPath()
-	if err != nil {
-		log.Err(err).Msg("Error determining install path")
-		return errors.Wrap(err, "Error determining install path")
-	}
-	extraArgs, err := getServiceExtraArgsFromCliArgs(c, log)
+	extraArgs, err := launchdExtraArgs(c, scope, log)
 	if err != nil {
 		errMsg := "Unable to determine extra arguments for launch daemon"
 		log.Err(err).Msg(errMsg)
 		return errors.Wrap(err, errMsg)
 	}
 
-	stdoutPath, err := stdoutPath()
-	if err != nil {
-		log.Err(err).Msg("error determining stdout path")
-		return errors.Wrap(err, "error determining stdout path")
-	}
-	stderrPath, err := stderrPath()
+	launchdTemplate, err := scope.template()
 	if err != nil {
-		log.Err(err).Msg("error determining stderr path")
-		return errors.Wrap(err, "error determining stderr path")
+		log.Err(err).Msg("error determining launchd template paths")
+		return err
 	}
-	launchdTemplate := newLaunchdTemplate(installPath, stdoutPath, stderrPath)
 	templateArgs := ServiceTemplateArgs{Path: etPath, ExtraArgs: extraArgs}
 	err = launchdTemplate.Generate(&templateArgs)
 	if err != nil {
@@ -161,6 +270,8 @@ func installLaunchd(c *cli.Context) error {
 		return err
 	}
 
+	stdoutPath, _ := scope.stdoutPath()
+	stderrPath, _ := scope.stderrPath()
 	log.Info().Msgf("Outputs are logged to %s and %s", stderrPath, stdoutPath)
 	err = runCommand("launchctl", "load", plistPath)
 	if err == nil {
@@ -172,24 +283,19 @@ func installLaunchd(c *cli.Context) error {
 func uninstallLaunchd(c *cli.Context) error {
 	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
 
-	if isRootUser() {
+	scope, err := launchdScopeFromContext(c)
+	if err != nil {
+		return err
+	}
+	if scope == launchdSystemScope {
 		log.Info().Msg("Uninstalling cloudflared as a system launch daemon")
 	} else {
 		log.Info().Msg("Uninstalling cloudflared as a user launch agent")
 	}
-	installPath, err := installPath()
-	if err != nil {
-		return errors.Wrap(err, "error determining install path")
-	}
-	stdoutPath, err := stdoutPath()
+	launchdTemplate, err := scope.template()
 	if err != nil {
-		return errors.Wrap(err, "error determining stdout path")
-	}
-	stderrPath, err := stderrPath()
-	if err != nil {
-		return errors.Wrap(err, "error determining stderr path")
+		return err
 	}
-	launchdTemplate := newLaunchdTemplate(installPath, stdoutPath, stderrPath)
 	plistPath, err := launchdTemplate.ResolvePath()
 	if err != nil {
 		log.Err(err).Msg("error resolving launchd template path")
@@ -86,6 +86,7 @@ func main() {
 
 	See https://developers.cloudflare.com/cloudflare-one/connections/connect-apps for more in-depth documentation.`
 	app.Flags = flags()
+	app.Before = access.ConfigureKeychain
 	app.Action = action(graceShutdownC)
 	app.Commands = commands(cli.ShowVersion)
 
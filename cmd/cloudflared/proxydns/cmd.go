@@ -41,12 +41,156 @@ func Command(hidden bool) *cli.Command {
 				Value:   53,
 				EnvVars: []string{"TUNNEL_DNS_PORT"},
 			},
+			&cli.IntFlag{
+				Name:    "dot-port",
+				Usage:   "Also listen on given port for DNS over TLS, with the certificate of --tls-cert. Setting to 0 disables the DNS over TLS listener.",
+				EnvVars: []string{"TUNNEL_DNS_DOT_PORT"},
+			},
+			&cli.IntFlag{
+				Name:    "doh-port",
+				Usage:   "Also listen on given port for DNS over HTTPS on the /dns-query path, with the certificate of --tls-cert. Setting to 0 disables the DNS over HTTPS listener.",
+				EnvVars: []string{"TUNNEL_DNS_DOH_PORT"},
+			},
+			&cli.StringFlag{
+				Name:    "unix-socket",
+				Usage:   "Path of a Unix domain socket to serve DNS on as well, with the DNS over TCP framing.",
+				EnvVars: []string{"TUNNEL_DNS_UNIX_SOCKET"},
+			},
+			&cli.BoolFlag{
+				Name:    "systemd-socket-activation",
+				Usage:   "Serve DNS on the sockets passed by systemd socket activation instead of listening on --address and --port.",
+				EnvVars: []string{"TUNNEL_DNS_SYSTEMD_SOCKET_ACTIVATION"},
+			},
+			&cli.StringFlag{
+				Name:    "tls-cert",
+				Usage:   "Certificate file of the DNS over TLS and DNS over HTTPS listeners.",
+				EnvVars: []string{"TUNNEL_DNS_TLS_CERT"},
+			},
+			&cli.StringFlag{
+				Name:    "tls-key",
+				Usage:   "Private key file of the certificate of --tls-cert.",
+				EnvVars: []string{"TUNNEL_DNS_TLS_KEY"},
+			},
 			&cli.StringSliceFlag{
 				Name:    "upstream",
-				Usage:   "Upstream endpoint URL, you can specify multiple endpoints for redundancy.",
+				Usage:   "Upstream endpoint URL, you can specify multiple endpoints for redundancy. DNS over QUIC endpoints use the quic:// scheme (e.g. quic://dns.example:853) and fall back to the next upstream when they can't be reached.",
 				Value:   cli.NewStringSlice("https://1.1.1.1/dns-query", "https://1.0.0.1/dns-query"),
 				EnvVars: []string{"TUNNEL_DNS_UPSTREAM"},
 			},
+			&cli.StringSliceFlag{
+				Name:    "zone-upstream",
+				Usage:   "Forward the queries for a zone and its subdomains to dedicated upstreams in the zone=upstream[,upstream...] format, e.g. corp.example=10.0.0.53. Upstreams without a scheme are plain DNS resolvers. You can specify multiple zones, the most specific one is used.",
+				EnvVars: []string{"TUNNEL_DNS_ZONE_UPSTREAM"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "local-record",
+				Usage:   "Answer a static A, AAAA, CNAME or TXT record in the zone file format instead of resolving the name upstream, e.g. \"host.lab. 300 IN A 10.0.0.1\". You can specify multiple records.",
+				EnvVars: []string{"TUNNEL_DNS_LOCAL_RECORD"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "hosts-file",
+				Usage:   "Answer the names of a file in the /etc/hosts format instead of resolving them upstream. You can specify multiple files.",
+				EnvVars: []string{"TUNNEL_DNS_HOSTS_FILE"},
+			},
+			&cli.BoolFlag{
+				Name:    "dnssec",
+				Usage:   "Validate the DNSSEC signatures of the responses locally instead of trusting the upstream. Bogus responses are answered with SERVFAIL.",
+				EnvVars: []string{"TUNNEL_DNS_DNSSEC"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "dnssec-trust-anchor",
+				Usage:   "DS record of a root zone key trusted for DNSSEC validation, e.g. \". IN DS 20326 8 2 E06D...\". Defaults to the IANA root trust anchors.",
+				EnvVars: []string{"TUNNEL_DNS_DNSSEC_TRUST_ANCHOR"},
+			},
+			&cli.BoolFlag{
+				Name:    "dns64",
+				Usage:   "Synthesize AAAA records from the A records of names without IPv6 addresses, for IPv6-only networks behind NAT64.",
+				EnvVars: []string{"TUNNEL_DNS_DNS64"},
+			},
+			&cli.StringFlag{
+				Name:    "dns64-prefix",
+				Usage:   "NAT64 prefix of the synthesized AAAA records.",
+				Value:   tunneldns.DefaultDNS64Prefix,
+				EnvVars: []string{"TUNNEL_DNS_DNS64_PREFIX"},
+			},
+			&cli.StringFlag{
+				Name:    "ecs",
+				Usage:   "EDNS Client Subnet of the queries sent upstream: forward sends the subnet of the client query as is, strip removes it and set replaces it with --ecs-prefix.",
+				Value:   string(tunneldns.ECSForward),
+				EnvVars: []string{"TUNNEL_DNS_ECS"},
+			},
+			&cli.StringFlag{
+				Name:    "ecs-prefix",
+				Usage:   "EDNS Client Subnet sent upstream when --ecs is set, e.g. 203.0.113.0/24.",
+				EnvVars: []string{"TUNNEL_DNS_ECS_PREFIX"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "blocklist",
+				Usage:   "File or http(s) URL of a list of names to block, in the hosts format, the adblock format (||example.com^) or with one domain per line. You can specify multiple lists.",
+				EnvVars: []string{"TUNNEL_DNS_BLOCKLIST"},
+			},
+			&cli.DurationFlag{
+				Name:    "blocklist-refresh",
+				Usage:   "How often the blocklists are reloaded.",
+				Value:   tunneldns.DefaultBlocklistRefresh,
+				EnvVars: []string{"TUNNEL_DNS_BLOCKLIST_REFRESH"},
+			},
+			&cli.StringFlag{
+				Name:    "blocklist-answer",
+				Usage:   "Answer to the queries for blocked names: nxdomain answers that they don't exist and null answers 0.0.0.0 or ::.",
+				Value:   string(tunneldns.BlockNXDomain),
+				EnvVars: []string{"TUNNEL_DNS_BLOCKLIST_ANSWER"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "client-policy",
+				Usage:   "Resolve the queries of some clients with their own upstreams or blocklists, in the clients=client[,client...];upstreams=upstream[,upstream...];blocklists=source[,source...] format, e.g. \"clients=10.0.1.0/24;upstreams=https://family.cloudflare-dns.com/dns-query\". Clients are addresses or prefixes, an optional name=name field identifies the policy in the logs. You can specify multiple policies, the most specific one is used.",
+				EnvVars: []string{"TUNNEL_DNS_CLIENT_POLICY"},
+			},
+			&cli.BoolFlag{
+				Name:    "upstream-ordered",
+				Usage:   "Try the upstreams in the configured order instead of the fastest healthy one first.",
+				EnvVars: []string{"TUNNEL_DNS_UPSTREAM_ORDERED"},
+			},
+			&cli.DurationFlag{
+				Name:    "upstream-health-check-interval",
+				Usage:   "How often the upstreams are probed to measure their latency and health. Setting to 0 disables the probes.",
+				Value:   tunneldns.DefaultHealthCheckInterval,
+				EnvVars: []string{"TUNNEL_DNS_UPSTREAM_HEALTH_CHECK_INTERVAL"},
+			},
+			&cli.DurationFlag{
+				Name:    "upstream-hedge-delay",
+				Usage:   "How long to wait for an upstream before sending the query to the next one as well, the first response is used. Setting to 0 disables hedging.",
+				Value:   tunneldns.DefaultHedgeDelay,
+				EnvVars: []string{"TUNNEL_DNS_UPSTREAM_HEDGE_DELAY"},
+			},
+			&cli.StringFlag{
+				Name:    "query-log",
+				Usage:   "File the DNS queries are logged to as JSON lines with the client, name, type, response code, latency and upstream of each query.",
+				EnvVars: []string{"TUNNEL_DNS_QUERY_LOG"},
+			},
+			&cli.Float64Flag{
+				Name:    "query-log-sample-ratio",
+				Usage:   "Ratio of the DNS queries that are logged to --query-log, greater than 0 and at most 1.",
+				Value:   1,
+				EnvVars: []string{"TUNNEL_DNS_QUERY_LOG_SAMPLE_RATIO"},
+			},
+			&cli.IntFlag{
+				Name:    "query-log-max-size",
+				Usage:   "Size in megabytes after which --query-log is rotated.",
+				Value:   tunneldns.DefaultQueryLogMaxSize,
+				EnvVars: []string{"TUNNEL_DNS_QUERY_LOG_MAX_SIZE"},
+			},
+			&cli.IntFlag{
+				Name:    "query-log-max-backups",
+				Usage:   "Number of rotated query logs that are kept.",
+				Value:   tunneldns.DefaultQueryLogMaxBackups,
+				EnvVars: []string{"TUNNEL_DNS_QUERY_LOG_MAX_BACKUPS"},
+			},
+			&cli.IntFlag{
+				Name:    "query-log-max-age",
+				Usage:   "Number of days after which rotated query logs are removed. Setting to 0 keeps them regardless of their age.",
+				EnvVars: []string{"TUNNEL_DNS_QUERY_LOG_MAX_AGE"},
+			},
 			&cli.StringSliceFlag{
 				Name:    "bootstrap",
 				Usage:   "bootstrap endpoint URL, you can specify multiple endpoints for redundancy.",
@@ -59,6 +203,39 @@ func Command(hidden bool) *cli.Command {
 				Value:   tunneldns.MaxUpstreamConnsDefault,
 				EnvVars: []string{"TUNNEL_DNS_MAX_UPSTREAM_CONNS"},
 			},
+			&cli.BoolFlag{
+				Name:    "no-cache",
+				Usage:   "Disable the cache of DNS responses, every query is sent upstream.",
+				EnvVars: []string{"TUNNEL_DNS_NO_CACHE"},
+			},
+			&cli.IntFlag{
+				Name:    "cache-size",
+				Usage:   "Maximum number of cached DNS responses.",
+				Value:   tunneldns.DefaultCacheSize,
+				EnvVars: []string{"TUNNEL_DNS_CACHE_SIZE"},
+			},
+			&cli.DurationFlag{
+				Name:    "cache-min-ttl",
+				Usage:   "Minimum time a positive DNS response is cached for, regardless of its TTL.",
+				EnvVars: []string{"TUNNEL_DNS_CACHE_MIN_TTL"},
+			},
+			&cli.DurationFlag{
+				Name:    "cache-max-ttl",
+				Usage:   "Maximum time a positive DNS response is cached for, regardless of its TTL.",
+				Value:   tunneldns.DefaultCacheMaxTTL,
+				EnvVars: []string{"TUNNEL_DNS_CACHE_MAX_TTL"},
+			},
+			&cli.DurationFlag{
+				Name:    "cache-negative-ttl",
+				Usage:   "Maximum time NXDOMAIN and NODATA responses are cached for. Setting to a negative value disables negative caching.",
+				Value:   tunneldns.DefaultCacheNegativeTTL,
+				EnvVars: []string{"TUNNEL_DNS_CACHE_NEGATIVE_TTL"},
+			},
+			&cli.IntFlag{
+				Name:    "cache-prefetch",
+				Usage:   "Number of hits after which a cached DNS response is refreshed before it expires. Setting to 0 disables prefetching.",
+				EnvVars: []string{"TUNNEL_DNS_CACHE_PREFETCH"},
+			},
 		},
 		ArgsUsage: " ", // can't be the empty string or we get the default output
 		Hidden:    hidden,
@@ -76,15 +253,79 @@ func Run(c *cli.Context) error {
 
 	go metrics.ServeMetrics(metricsListener, context.Background(), metrics.Config{}, log)
 
-	listener, err := tunneldns.CreateListener(
-		c.String("address"),
+	zones, err := tunneldns.ParseZoneConfigs(c.StringSlice("zone-upstream"))
+	if err != nil {
+		log.Err(err).Msg("Failed to parse the forwarding zones")
+		return err
+	}
+
+	clientPolicies, err := tunneldns.ParseClientPolicyConfigs(c.StringSlice("client-policy"))
+	if err != nil {
+		log.Err(err).Msg("Failed to parse the client policies")
+		return err
+	}
+
+	listener, err := tunneldns.CreateListener(tunneldns.ListenerConfig{
+		Address: c.String("address"),
 		// Note TUN-3758 , we use Int because UInt is not supported with altsrc
-		uint16(c.Int("port")),
-		c.StringSlice("upstream"),
-		c.StringSlice("bootstrap"),
-		c.Int("max-upstream-conns"),
-		log,
-	)
+		Port:                   uint16(c.Int("port")),
+		Upstreams:              c.StringSlice("upstream"),
+		Bootstraps:             c.StringSlice("bootstrap"),
+		MaxUpstreamConnections: c.Int("max-upstream-conns"),
+		Cache: tunneldns.CacheConfig{
+			Disabled:    c.Bool("no-cache"),
+			Size:        c.Int("cache-size"),
+			MinTTL:      c.Duration("cache-min-ttl"),
+			MaxTTL:      c.Duration("cache-max-ttl"),
+			NegativeTTL: c.Duration("cache-negative-ttl"),
+			Prefetch:    c.Int("cache-prefetch"),
+		},
+		Zones: zones,
+		Local: tunneldns.LocalConfig{
+			Records:    c.StringSlice("local-record"),
+			HostsFiles: c.StringSlice("hosts-file"),
+		},
+		DNSSEC: tunneldns.DNSSECConfig{
+			Enabled:      c.Bool("dnssec"),
+			TrustAnchors: c.StringSlice("dnssec-trust-anchor"),
+		},
+		DNS64: tunneldns.DNS64Config{
+			Enabled: c.Bool("dns64"),
+			Prefix:  c.String("dns64-prefix"),
+		},
+		ECS: tunneldns.ECSConfig{
+			Mode:   tunneldns.ECSMode(c.String("ecs")),
+			Prefix: c.String("ecs-prefix"),
+		},
+		Blocklist: tunneldns.BlocklistConfig{
+			Sources: c.StringSlice("blocklist"),
+			Refresh: c.Duration("blocklist-refresh"),
+			Answer:  tunneldns.BlockAnswer(c.String("blocklist-answer")),
+		},
+		Selection: tunneldns.SelectionConfig{
+			Ordered:             c.Bool("upstream-ordered"),
+			HealthCheckInterval: c.Duration("upstream-health-check-interval"),
+			HedgeDelay:          c.Duration("upstream-hedge-delay"),
+		},
+		ClientPolicies: clientPolicies,
+		Encrypted: tunneldns.EncryptedListenerConfig{
+			CertFile: c.String("tls-cert"),
+			KeyFile:  c.String("tls-key"),
+			DoTPort:  uint16(c.Int("dot-port")),
+			DoHPort:  uint16(c.Int("doh-port")),
+		},
+		Socket: tunneldns.SocketConfig{
+			UnixSocket:        c.String("unix-socket"),
+			SystemdActivation: c.Bool("systemd-socket-activation"),
+		},
+		QueryLog: tunneldns.QueryLogConfig{
+			File:        c.String("query-log"),
+			SampleRatio: c.Float64("query-log-sample-ratio"),
+			MaxSize:     c.Int("query-log-max-size"),
+			MaxBackups:  c.Int("query-log-max-backups"),
+			MaxAge:      c.Int("query-log-max-age"),
+		},
+	}, log)
 
 	if err != nil {
 		log.Err(err).Msg("Failed to create the listeners")
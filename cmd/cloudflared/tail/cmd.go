@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -93,6 +95,26 @@ func buildTailCommand(subcommands []*cli.Command) *cli.Command {
 				EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_SAMPLE"},
 				Value:   1.0,
 			},
+			&cli.StringSliceFlag{
+				Name:    "hostname",
+				Usage:   "Filter the HTTP events by the hostnames of the requests, which can start with a *. wildcard",
+				EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_HOSTNAME"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "status",
+				Usage:   "Filter the HTTP events by the status class of the origin responses (1xx, 2xx, 3xx, 4xx, 5xx)",
+				EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_STATUS"},
+			},
+			&cli.IntSliceFlag{
+				Name:    "conn-index",
+				Usage:   "Filter the events by the index of the edge connection they relate to",
+				EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_CONN_INDEX"},
+			},
+			&cli.StringFlag{
+				Name:    "message",
+				Usage:   "Filter the events by a regular expression their messages must match",
+				EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_MESSAGE"},
+			},
 			&cli.StringFlag{
 				Name:    "token",
 				Usage:   "Access token for a specific tunnel",
@@ -105,6 +127,28 @@ func buildTailCommand(subcommands []*cli.Command) *cli.Command {
 				Value:   "default",
 				EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT"},
 			},
+			&cli.StringFlag{
+				Name:    outputFileFlag,
+				Usage:   "Write the logs to this file as newline-delimited JSON instead of printing them",
+				EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT_FILE"},
+			},
+			&cli.IntFlag{
+				Name:    outputFileMaxSizeFlag,
+				Usage:   "Maximum size in megabytes of the --output-file before it is rotated",
+				Value:   100,
+				EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT_FILE_MAX_SIZE"},
+			},
+			&cli.IntFlag{
+				Name:    outputFileMaxBackupsFlag,
+				Usage:   "Number of rotated --output-file files to keep, 0 keeps all of them",
+				Value:   5,
+				EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT_FILE_MAX_BACKUPS"},
+			},
+			&cli.DurationFlag{
+				Name:    outputFileRotateIntervalFlag,
+				Usage:   "Also rotate the --output-file at this interval, e.g. 1h. Only rotated by size by default.",
+				EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT_FILE_ROTATE_INTERVAL"},
+			},
 			&cli.StringFlag{
 				Name:    "management-hostname",
 				Usage:   "Management hostname to signify incoming management requests",
@@ -211,16 +255,52 @@ func parseFilters(c *cli.Context) (*management.StreamingFilters, error) {
 	}
 	sample = argSample
 
-	if level == nil && len(events) == 0 && argSample != 1.0 {
+	var statusClasses []int
+	for _, v := range c.StringSlice("status") {
+		class, ok := parseStatusClass(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid --status filter provided, please use one of the following status classes: 1xx, 2xx, 3xx, 4xx, 5xx")
+		}
+		statusClasses = append(statusClasses, class)
+	}
+
+	connIndexes := c.IntSlice("conn-index")
+	for _, v := range connIndexes {
+		if v < 0 || v > math.MaxUint8 {
+			return nil, fmt.Errorf("invalid --conn-index filter provided, please make sure it is in the range (0 .. %d)", math.MaxUint8)
+		}
+	}
+
+	hostnames := c.StringSlice("hostname")
+	message := c.String("message")
+
+	if level == nil && len(events) == 0 && argSample != 1.0 && len(hostnames) == 0 && len(statusClasses) == 0 && len(connIndexes) == 0 && message == "" {
 		// When no filters are provided, do not return a StreamingFilters struct
 		return nil, nil
 	}
 
-	return &management.StreamingFilters{
-		Level:    level,
-		Events:   events,
-		Sampling: sample,
-	}, nil
+	filters := &management.StreamingFilters{
+		Level:         level,
+		Events:        events,
+		Sampling:      sample,
+		Hostnames:     hostnames,
+		StatusClasses: statusClasses,
+		ConnIndexes:   connIndexes,
+		Message:       message,
+	}
+	if _, err := management.NewFieldFilter(filters); err != nil {
+		return nil, fmt.Errorf("invalid --message filter provided: %w", err)
+	}
+	return filters, nil
+}
+
+// parseStatusClass parses a status class such as 5xx, or 5, into its first digit.
+func parseStatusClass(s string) (int, bool) {
+	s = strings.TrimSuffix(strings.ToLower(s), "xx")
+	if len(s) != 1 || s[0] < '1' || s[0] > '5' {
+		return 0, false
+	}
+	return int(s[0] - '0'), true
 }
 
 // getManagementToken will make a call to the Cloudflare API to acquire a management token for the requested tunnel.
@@ -318,6 +398,18 @@ func Run(c *cli.Context) error {
 		return nil
 	}
 
+	file, err := newFileOutput(c)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid output file provided")
+		return nil
+	}
+	if file != nil {
+		defer file.Close()
+	}
+
+	// The connectors that predate the field filters ignore them, so they're also applied to the events received
+	fieldFilter, _ := management.NewFieldFilter(filters)
+
 	u, err := buildURL(c, log)
 	if err != nil {
 		log.Err(err).Msg("unable to construct management request URL")
@@ -392,7 +484,14 @@ func Run(c *cli.Context) error {
 					}
 					// Output all the logs received to stdout
 					for _, l := range logs.Logs {
-						if output == "json" {
+						if !fieldFilter.Match(l) {
+							continue
+						}
+						if file != nil {
+							if err := file.Write(l); err != nil {
+								log.Err(err).Msg("unable to write event to the output file")
+							}
+						} else if output == "json" {
 							printJSON(l, log)
 						} else {
 							printLine(l, log)
@@ -0,0 +1,84 @@
+package tail
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	outputFileFlag               = "output-file"
+	outputFileMaxSizeFlag        = "output-file-max-size"
+	outputFileMaxBackupsFlag     = "output-file-max-backups"
+	outputFileRotateIntervalFlag = "output-file-rotate-interval"
+)
+
+// fileOutput writes the log events as newline-delimited JSON to a file, which is rotated once it reaches its maximum
+// size and, if set, at every rotation interval.
+type fileOutput struct {
+	writer *lumberjack.Logger
+	done   chan struct{}
+}
+
+// newFileOutput returns the output to the file of --output-file, nil if it isn't set.
+func newFileOutput(c *cli.Context) (*fileOutput, error) {
+	path := c.String(outputFileFlag)
+	if path == "" {
+		return nil, nil
+	}
+	maxSize, maxBackups, interval := c.Int(outputFileMaxSizeFlag), c.Int(outputFileMaxBackupsFlag), c.Duration(outputFileRotateIntervalFlag)
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid --%s value provided, please make sure it is a positive number of megabytes", outputFileMaxSizeFlag)
+	}
+	if maxBackups < 0 {
+		return nil, fmt.Errorf("invalid --%s value provided, please make sure it is not negative", outputFileMaxBackupsFlag)
+	}
+	if interval < 0 {
+		return nil, fmt.Errorf("invalid --%s value provided, please make sure it is not negative", outputFileRotateIntervalFlag)
+	}
+	f := &fileOutput{
+		writer: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSize,
+			MaxBackups: maxBackups,
+		},
+		done: make(chan struct{}),
+	}
+	if interval > 0 {
+		go f.rotate(interval)
+	}
+	return f, nil
+}
+
+func (f *fileOutput) rotate(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			_ = f.writer.Rotate()
+		}
+	}
+}
+
+// Write appends the log event to the file as a line of JSON.
+func (f *fileOutput) Write(log *management.Log) error {
+	line, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+	_, err = f.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (f *fileOutput) Close() error {
+	close(f.done)
+	return f.writer.Close()
+}
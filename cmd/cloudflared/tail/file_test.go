@@ -0,0 +1,63 @@
+package tail
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func newTestContext(t *testing.T, args ...string) *cli.Context {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range buildTailCommand(nil).Flags {
+		require.NoError(t, f.Apply(flags))
+	}
+	require.NoError(t, flags.Parse(args))
+	return cli.NewContext(cli.NewApp(), flags, nil)
+}
+
+func TestFileOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.json")
+	file, err := newFileOutput(newTestContext(t, "--"+outputFileFlag, path))
+	require.NoError(t, err)
+
+	logs := []*management.Log{
+		{Time: "2024-01-01T00:00:00Z", Level: management.Info, Message: "first", Event: management.HTTP},
+		{Time: "2024-01-01T00:00:01Z", Level: management.Error, Message: "second", Fields: map[string]interface{}{"connIndex": float64(1)}},
+	}
+	for _, l := range logs {
+		require.NoError(t, file.Write(l))
+	}
+	require.NoError(t, file.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var read []*management.Log
+	for scanner.Scan() {
+		var l management.Log
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &l))
+		read = append(read, &l)
+	}
+	assert.Equal(t, logs, read)
+}
+
+func TestFileOutputNotSet(t *testing.T) {
+	file, err := newFileOutput(newTestContext(t))
+	require.NoError(t, err)
+	assert.Nil(t, file)
+}
+
+func TestFileOutputInvalidMaxSize(t *testing.T) {
+	_, err := newFileOutput(newTestContext(t, "--"+outputFileFlag, "tail.json", "--"+outputFileMaxSizeFlag, "0"))
+	require.Error(t, err)
+}
@@ -0,0 +1,558 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+)
+
+var (
+	applyDryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the changes needed to reconcile the account with the manifest without making them.",
+	}
+	applyPruneFlag = &cli.BoolFlag{
+		Name:  "prune",
+		Usage: "Delete the IP routes of the tunnels of the manifest that the manifest doesn't list.",
+	}
+)
+
+// manifest describes the tunnels of an account and their routes, for "cloudflared tunnel apply".
+type manifest struct {
+	VirtualNetworks []manifestVnet   `yaml:"virtual-networks"`
+	Tunnels         []manifestTunnel `yaml:"tunnels"`
+}
+
+type manifestVnet struct {
+	Name    string `yaml:"name"`
+	Comment string `yaml:"comment"`
+	Default bool   `yaml:"default"`
+}
+
+type manifestTunnel struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels"`
+	// CredentialsFile is where the credentials of the tunnel are written when it's created
+	CredentialsFile string            `yaml:"credentials-file"`
+	DNS             []string          `yaml:"dns"`
+	IPRoutes        []manifestIPRoute `yaml:"ip-routes"`
+}
+
+type manifestIPRoute struct {
+	Network string `yaml:"network"`
+	// VirtualNetwork is the name of the virtual network of the route, the default one if it's empty
+	VirtualNetwork string `yaml:"virtual-network"`
+	Comment        string `yaml:"comment"`
+}
+
+func buildApplyCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "apply",
+		Action:    cliutil.ConfiguredAction(applyCommand),
+		Usage:     "Reconcile the tunnels, routes and virtual networks of the account with a manifest",
+		UsageText: "cloudflared tunnel [tunnel command options] apply [subcommand options] MANIFEST",
+		Description: `Creates the virtual networks, tunnels, DNS routes and IP routes described in the manifest that are missing
+  from the account, and updates the virtual networks that differ. The changes are printed before they are made,
+  use --dry-run to only print them. Tunnels and virtual networks that aren't in the manifest are left as they are,
+  use --prune to delete the IP routes of the tunnels of the manifest that it doesn't list. DNS records aren't
+  overwritten: a hostname that points to something else than its tunnel is a conflict, and nothing is changed until
+  it is solved. For example:
+
+  virtual-networks:
+    - name: staging
+      comment: Staging network
+  tunnels:
+    - name: web
+      labels:
+        env: prod
+      credentials-file: /etc/cloudflared/web.json
+      dns:
+        - web.example.com
+      ip-routes:
+        - network: 10.0.0.0/16
+          virtual-network: staging
+
+  $ cloudflared tunnel apply --dry-run manifest.yaml`,
+		Flags:              []cli.Flag{applyDryRunFlag, applyPruneFlag, encryptCredentialsFlag, credentialsPassphraseFileFlag},
+		CustomHelpTemplate: commandHelpTemplate(),
+	}
+}
+
+func applyCommand(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cliutil.UsageError(`"cloudflared tunnel apply" requires exactly 1 argument, the path to the manifest.`)
+	}
+	m, err := readManifest(c.Args().First())
+	if err != nil {
+		return err
+	}
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+
+	changes, err := sc.planManifest(m, c.Bool(applyPruneFlag.Name))
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("The account matches the manifest, there is nothing to change.")
+		return nil
+	}
+	printChanges(os.Stdout, changes)
+	if c.Bool(applyDryRunFlag.Name) {
+		return nil
+	}
+	return sc.applyChanges(changes)
+}
+
+func readManifest(path string) (*manifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the manifest")
+	}
+	var m manifest
+	if err := yaml.Unmarshal(content, &m); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the manifest %s", path)
+	}
+	if err := m.validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid manifest %s", path)
+	}
+	return &m, nil
+}
+
+func (m *manifest) validate() error {
+	vnets := make(map[string]bool, len(m.VirtualNetworks))
+	defaults := 0
+	for _, vnet := range m.VirtualNetworks {
+		if vnet.Name == "" {
+			return errors.New("a virtual network has no name")
+		}
+		if vnets[vnet.Name] {
+			return fmt.Errorf("virtual network %s is listed more than once", vnet.Name)
+		}
+		vnets[vnet.Name] = true
+		if vnet.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return errors.New("only one virtual network can be the default one")
+	}
+	tunnels := make(map[string]bool, len(m.Tunnels))
+	routes := make(map[ipRouteKey]string)
+	for _, tunnel := range m.Tunnels {
+		if tunnel.Name == "" {
+			return errors.New("a tunnel has no name")
+		}
+		if tunnels[tunnel.Name] {
+			return fmt.Errorf("tunnel %s is listed more than once", tunnel.Name)
+		}
+		tunnels[tunnel.Name] = true
+		if _, err := parseLabels(labelsAsFlags(tunnel.Labels)); err != nil {
+			return errors.Wrapf(err, "tunnel %s", tunnel.Name)
+		}
+		for _, route := range tunnel.IPRoutes {
+			_, network, err := net.ParseCIDR(route.Network)
+			if err != nil {
+				return fmt.Errorf("tunnel %s: invalid network %s, it should be a CIDR like 10.0.0.0/16", tunnel.Name, route.Network)
+			}
+			key := ipRouteKey{network: network.String(), vnet: route.VirtualNetwork}
+			if other, ok := routes[key]; ok {
+				return fmt.Errorf("the route to %s is listed by both tunnel %s and tunnel %s", key, other, tunnel.Name)
+			}
+			routes[key] = tunnel.Name
+		}
+	}
+	return nil
+}
+
+// labelsAsFlags returns the labels in the key=value form of --label, so that they are validated the same way.
+func labelsAsFlags(labels map[string]string) []string {
+	flags := make([]string, 0, len(labels))
+	for key, value := range labels {
+		flags = append(flags, key+"="+value)
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// ipRouteKey identifies a route by its network and the name of its virtual network, empty for the default one.
+type ipRouteKey struct {
+	network string
+	vnet    string
+}
+
+func (k ipRouteKey) String() string {
+	if k.vnet == "" {
+		return k.network
+	}
+	return fmt.Sprintf("%s in virtual network %s", k.network, k.vnet)
+}
+
+// applyState holds the IDs of the resources the changes refer to by name, including those created by earlier
+// changes.
+type applyState struct {
+	vnetIDs   map[string]uuid.UUID
+	tunnelIDs map[string]uuid.UUID
+}
+
+// manifestChange is a change needed to reconcile the account with the manifest.
+type manifestChange struct {
+	// op is "+" for a creation, "~" for an update, "-" for a deletion and "!" for a conflict, which can't be applied
+	op          string
+	description string
+	apply       func(sc *subcommandContext, state *applyState) error
+}
+
+func printChanges(w io.Writer, changes []manifestChange) {
+	for _, change := range changes {
+		fmt.Fprintf(w, "%s %s\n", change.op, change.description)
+	}
+}
+
+// applyChanges makes the changes in order, stopping at the first one that fails. Nothing is changed if there is a
+// conflict.
+func (sc *subcommandContext) applyChanges(changes []manifestChange) error {
+	conflicts := 0
+	for _, change := range changes {
+		if change.op == "!" {
+			conflicts++
+		}
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("%d conflicts prevent applying the manifest, nothing was changed", conflicts)
+	}
+	state, err := sc.currentApplyState()
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if err := change.apply(sc, state); err != nil {
+			return errors.Wrapf(err, "failed to %s", change.description)
+		}
+		sc.log.Info().Msgf("Applied: %s %s", change.op, change.description)
+	}
+	return nil
+}
+
+func (sc *subcommandContext) currentApplyState() (*applyState, error) {
+	vnets, err := sc.activeVirtualNetworks()
+	if err != nil {
+		return nil, err
+	}
+	tunnels, err := sc.activeTunnels()
+	if err != nil {
+		return nil, err
+	}
+	state := &applyState{
+		vnetIDs:   make(map[string]uuid.UUID, len(vnets)),
+		tunnelIDs: make(map[string]uuid.UUID, len(tunnels)),
+	}
+	for name, vnet := range vnets {
+		state.vnetIDs[name] = vnet.ID
+	}
+	for name, tunnel := range tunnels {
+		state.tunnelIDs[name] = tunnel.ID
+	}
+	return state, nil
+}
+
+func (sc *subcommandContext) activeVirtualNetworks() (map[string]*cfapi.VirtualNetwork, error) {
+	filter := cfapi.NewVnetFilter()
+	filter.WithDeleted(false)
+	vnets, err := sc.listVirtualNetworks(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the virtual networks")
+	}
+	byName := make(map[string]*cfapi.VirtualNetwork, len(vnets))
+	for _, vnet := range vnets {
+		byName[vnet.Name] = vnet
+	}
+	return byName, nil
+}
+
+func (sc *subcommandContext) activeTunnels() (map[string]*cfapi.Tunnel, error) {
+	filter := cfapi.NewTunnelFilter()
+	filter.NoDeleted()
+	tunnels, err := sc.list(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the tunnels")
+	}
+	byName := make(map[string]*cfapi.Tunnel, len(tunnels))
+	for _, tunnel := range tunnels {
+		byName[tunnel.Name] = tunnel
+	}
+	return byName, nil
+}
+
+// planManifest compares the manifest with the account and returns the changes to make, in the order they can be
+// made: virtual networks, then tunnels, then their routes.
+func (sc *subcommandContext) planManifest(m *manifest, prune bool) ([]manifestChange, error) {
+	vnets, err := sc.activeVirtualNetworks()
+	if err != nil {
+		return nil, err
+	}
+	tunnels, err := sc.activeTunnels()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []manifestChange
+	for _, vnet := range m.VirtualNetworks {
+		changes = append(changes, planVirtualNetwork(vnet, vnets[vnet.Name])...)
+	}
+	for _, vnet := range ipRouteVnets(m) {
+		if _, ok := vnets[vnet]; !ok && !m.hasVirtualNetwork(vnet) {
+			return nil, fmt.Errorf("virtual network %s of the IP routes is neither in the account nor in the manifest", vnet)
+		}
+	}
+
+	// The routes in the default virtual network have no virtual network ID
+	vnetNames := map[uuid.UUID]string{}
+	for name, vnet := range vnets {
+		if !vnet.IsDefault {
+			vnetNames[vnet.ID] = name
+		}
+	}
+	var routeChanges []manifestChange
+	for _, tunnel := range m.Tunnels {
+		existing, ok := tunnels[tunnel.Name]
+		if !ok {
+			changes = append(changes, planTunnelCreation(tunnel))
+		} else if len(tunnel.Labels) > 0 && !reflect.DeepEqual(tunnel.Labels, existing.Metadata.Labels) {
+			sc.log.Warn().Msgf("The labels of tunnel %s differ from the manifest, labels can only be set when a tunnel is created", tunnel.Name)
+		}
+		for _, hostname := range tunnel.DNS {
+			change, err := sc.planDNSRoute(tunnel.Name, existing, hostname)
+			if err != nil {
+				return nil, err
+			}
+			if change != nil {
+				routeChanges = append(routeChanges, *change)
+			}
+		}
+
+		current := map[ipRouteKey]*cfapi.DetailedRoute{}
+		if ok {
+			filter := cfapi.NewIPRouteFilter()
+			filter.NotDeleted()
+			filter.TunnelID(existing.ID)
+			routes, err := sc.listRoutes(filter)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to list the IP routes of tunnel %s", tunnel.Name)
+			}
+			for _, route := range routes {
+				key := ipRouteKey{network: route.Network.String()}
+				if route.VNetID != nil {
+					if name, ok := vnetNames[*route.VNetID]; ok {
+						key.vnet = name
+					} else if !isDefaultVnet(vnets, *route.VNetID) {
+						key.vnet = route.VNetID.String()
+					}
+				}
+				current[key] = route
+			}
+		}
+		wanted := map[ipRouteKey]bool{}
+		for _, route := range tunnel.IPRoutes {
+			_, network, _ := net.ParseCIDR(route.Network)
+			key := ipRouteKey{network: network.String(), vnet: route.VirtualNetwork}
+			if vnet, ok := vnets[route.VirtualNetwork]; ok && vnet.IsDefault {
+				key.vnet = ""
+			}
+			wanted[key] = true
+			if _, ok := current[key]; !ok {
+				routeChanges = append(routeChanges, planIPRouteCreation(tunnel.Name, *network, route))
+			}
+		}
+		if prune {
+			var stale []ipRouteKey
+			for key := range current {
+				if !wanted[key] {
+					stale = append(stale, key)
+				}
+			}
+			sort.Slice(stale, func(i, j int) bool { return stale[i].String() < stale[j].String() })
+			for _, key := range stale {
+				routeChanges = append(routeChanges, planIPRouteDeletion(tunnel.Name, key, current[key].ID))
+			}
+		}
+	}
+	// Deleting the routes first lets a route move from a tunnel to another
+	sort.SliceStable(routeChanges, func(i, j int) bool {
+		return routeChanges[i].op == "-" && routeChanges[j].op != "-"
+	})
+	return append(changes, routeChanges...), nil
+}
+
+func isDefaultVnet(vnets map[string]*cfapi.VirtualNetwork, id uuid.UUID) bool {
+	for _, vnet := range vnets {
+		if vnet.ID == id {
+			return vnet.IsDefault
+		}
+	}
+	return false
+}
+
+func (m *manifest) hasVirtualNetwork(name string) bool {
+	for _, vnet := range m.VirtualNetworks {
+		if vnet.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ipRouteVnets returns the names of the virtual networks the IP routes of the manifest are in.
+func ipRouteVnets(m *manifest) []string {
+	var vnets []string
+	seen := map[string]bool{"": true}
+	for _, tunnel := range m.Tunnels {
+		for _, route := range tunnel.IPRoutes {
+			if !seen[route.VirtualNetwork] {
+				seen[route.VirtualNetwork] = true
+				vnets = append(vnets, route.VirtualNetwork)
+			}
+		}
+	}
+	return vnets
+}
+
+func planVirtualNetwork(vnet manifestVnet, existing *cfapi.VirtualNetwork) []manifestChange {
+	if existing == nil {
+		return []manifestChange{{
+			op:          "+",
+			description: fmt.Sprintf("create virtual network %s", vnet.Name),
+			apply: func(sc *subcommandContext, state *applyState) error {
+				created, err := sc.addVirtualNetwork(cfapi.NewVirtualNetwork{Name: vnet.Name, Comment: vnet.Comment, IsDefault: vnet.Default})
+				if err != nil {
+					return err
+				}
+				state.vnetIDs[vnet.Name] = created.ID
+				return nil
+			},
+		}}
+	}
+	var updates cfapi.UpdateVirtualNetwork
+	var changed []string
+	if vnet.Comment != existing.Comment {
+		updates.Comment = &vnet.Comment
+		changed = append(changed, fmt.Sprintf("comment %q", vnet.Comment))
+	}
+	// A virtual network stops being the default one when another one becomes it
+	if vnet.Default && !existing.IsDefault {
+		updates.IsDefault = &vnet.Default
+		changed = append(changed, "default")
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	id := existing.ID
+	return []manifestChange{{
+		op:          "~",
+		description: fmt.Sprintf("update virtual network %s: %s", vnet.Name, strings.Join(changed, ", ")),
+		apply: func(sc *subcommandContext, _ *applyState) error {
+			return sc.updateVirtualNetwork(id, updates)
+		},
+	}}
+}
+
+func planTunnelCreation(tunnel manifestTunnel) manifestChange {
+	description := fmt.Sprintf("create tunnel %s", tunnel.Name)
+	if len(tunnel.Labels) > 0 {
+		description += fmt.Sprintf(" with labels %s", fmtLabels(tunnel.Labels))
+	}
+	return manifestChange{
+		op:          "+",
+		description: description,
+		apply: func(sc *subcommandContext, state *applyState) error {
+			created, err := sc.create(tunnel.Name, tunnel.CredentialsFile, "", tunnel.Labels)
+			if err != nil {
+				return err
+			}
+			state.tunnelIDs[tunnel.Name] = created.ID
+			return nil
+		},
+	}
+}
+
+// planDNSRoute returns the change routing hostname to the tunnel, nil if its CNAME record already does. A hostname
+// with a record to anything else is a conflict, since the manifest doesn't overwrite records.
+func (sc *subcommandContext) planDNSRoute(tunnelName string, existing *cfapi.Tunnel, hostname string) (*manifestChange, error) {
+	client, err := sc.client()
+	if err != nil {
+		return nil, err
+	}
+	_, records, err := sc.hostnameDNSRecords(client, hostname)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find the DNS records of %s", hostname)
+	}
+	for _, record := range records {
+		if record.Type != "A" && record.Type != "AAAA" && record.Type != "CNAME" {
+			continue
+		}
+		if existing != nil && record.Type == "CNAME" && record.Content == cfapi.TunnelTarget(existing.ID) {
+			return nil, nil
+		}
+		return &manifestChange{
+			op:          "!",
+			description: fmt.Sprintf("DNS %s already points to %s (%s record), it can't be routed to tunnel %s", hostname, record.Content, record.Type, tunnelName),
+		}, nil
+	}
+	return &manifestChange{
+		op:          "+",
+		description: fmt.Sprintf("route DNS %s to tunnel %s", hostname, tunnelName),
+		apply: func(sc *subcommandContext, state *applyState) error {
+			result, err := sc.route(state.tunnelIDs[tunnelName], cfapi.NewDNSRoute(hostname, false))
+			if err != nil {
+				return err
+			}
+			sc.log.Info().Msg(result.SuccessSummary())
+			return nil
+		},
+	}, nil
+}
+
+func planIPRouteCreation(tunnelName string, network net.IPNet, route manifestIPRoute) manifestChange {
+	key := ipRouteKey{network: network.String(), vnet: route.VirtualNetwork}
+	return manifestChange{
+		op:          "+",
+		description: fmt.Sprintf("route %s to tunnel %s", key, tunnelName),
+		apply: func(sc *subcommandContext, state *applyState) error {
+			newRoute := cfapi.NewRoute{
+				Network:  network,
+				TunnelID: state.tunnelIDs[tunnelName],
+				Comment:  route.Comment,
+			}
+			if route.VirtualNetwork != "" {
+				vnetID := state.vnetIDs[route.VirtualNetwork]
+				newRoute.VNetID = &vnetID
+			}
+			_, err := sc.addRoute(newRoute)
+			return err
+		},
+	}
+}
+
+func planIPRouteDeletion(tunnelName string, key ipRouteKey, routeID uuid.UUID) manifestChange {
+	return manifestChange{
+		op:          "-",
+		description: fmt.Sprintf("delete the route %s of tunnel %s", key, tunnelName),
+		apply: func(sc *subcommandContext, _ *applyState) error {
+			return sc.deleteRoute(routeID)
+		},
+	}
+}
@@ -0,0 +1,244 @@
+package tunnel
+
+import (
+	"bytes"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+// applyMockClient is an account with virtual networks, tunnels and IP routes.
+type applyMockClient struct {
+	cfapi.Client
+	vnets         []*cfapi.VirtualNetwork
+	tunnels       []*cfapi.Tunnel
+	routes        []*cfapi.DetailedRoute
+	dnsRoutes     []string
+	dnsRecords    []*cfapi.DNSRecord
+	deletedRoutes []uuid.UUID
+}
+
+func (m *applyMockClient) ListVirtualNetworks(*cfapi.VnetFilter) ([]*cfapi.VirtualNetwork, error) {
+	return m.vnets, nil
+}
+
+func (m *applyMockClient) CreateVirtualNetwork(newVnet cfapi.NewVirtualNetwork) (cfapi.VirtualNetwork, error) {
+	vnet := cfapi.VirtualNetwork{ID: uuid.New(), Name: newVnet.Name, Comment: newVnet.Comment, IsDefault: newVnet.IsDefault}
+	m.vnets = append(m.vnets, &vnet)
+	return vnet, nil
+}
+
+func (m *applyMockClient) UpdateVirtualNetwork(id uuid.UUID, updates cfapi.UpdateVirtualNetwork) error {
+	for _, vnet := range m.vnets {
+		if vnet.ID == id && updates.Comment != nil {
+			vnet.Comment = *updates.Comment
+		}
+	}
+	return nil
+}
+
+func (m *applyMockClient) ListTunnels(*cfapi.TunnelFilter) ([]*cfapi.Tunnel, error) {
+	return m.tunnels, nil
+}
+
+func (m *applyMockClient) ListRoutes(*cfapi.IpRouteFilter) ([]*cfapi.DetailedRoute, error) {
+	// The routes of all the tunnels are returned, the mock only has routes of tunnel web
+	return m.routes, nil
+}
+
+func (m *applyMockClient) AddRoute(newRoute cfapi.NewRoute) (cfapi.Route, error) {
+	m.routes = append(m.routes, &cfapi.DetailedRoute{ID: uuid.New(), Network: cfapi.CIDR(newRoute.Network), TunnelID: newRoute.TunnelID, VNetID: newRoute.VNetID})
+	return cfapi.Route{}, nil
+}
+
+func (m *applyMockClient) DeleteRoute(id uuid.UUID) error {
+	m.deletedRoutes = append(m.deletedRoutes, id)
+	return nil
+}
+
+func (m *applyMockClient) ListZones() ([]*cfapi.Zone, error) {
+	return []*cfapi.Zone{{ID: "zone", Name: "example.com"}}, nil
+}
+
+func (m *applyMockClient) ListDNSRecords(zoneID string, name string) ([]*cfapi.DNSRecord, error) {
+	var records []*cfapi.DNSRecord
+	for _, record := range m.dnsRecords {
+		if record.Name == name {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m *applyMockClient) RouteTunnel(tunnelID uuid.UUID, route cfapi.HostnameRoute) (cfapi.HostnameRouteResult, error) {
+	m.dnsRoutes = append(m.dnsRoutes, route.String())
+	return &cfapi.DNSRouteResult{CName: cfapi.ChangeNew, Name: "web.example.com"}, nil
+}
+
+func mustParseCIDR(t *testing.T, cidr string) net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	return *network
+}
+
+func TestApplyManifest(t *testing.T) {
+	defaultVnet := &cfapi.VirtualNetwork{ID: uuid.New(), Name: "default", IsDefault: true}
+	prodVnet := &cfapi.VirtualNetwork{ID: uuid.New(), Name: "prod", Comment: "Production"}
+	web := &cfapi.Tunnel{ID: uuid.New(), Name: "web"}
+	staleRoute := &cfapi.DetailedRoute{ID: uuid.New(), Network: cfapi.CIDR(mustParseCIDR(t, "10.9.0.0/16")), TunnelID: web.ID}
+	client := &applyMockClient{
+		vnets:   []*cfapi.VirtualNetwork{defaultVnet, prodVnet},
+		tunnels: []*cfapi.Tunnel{web},
+		routes: []*cfapi.DetailedRoute{
+			{ID: uuid.New(), Network: cfapi.CIDR(mustParseCIDR(t, "10.0.0.0/16")), TunnelID: web.ID, VNetID: &prodVnet.ID},
+			staleRoute,
+		},
+		dnsRecords: []*cfapi.DNSRecord{
+			{Name: "app.example.com", Type: "CNAME", Content: cfapi.TunnelTarget(web.ID)},
+			{Name: "app.example.com", Type: "TXT", Content: "verification"},
+			{Name: "legacy.example.com", Type: "A", Content: "192.0.2.1"},
+		},
+	}
+	log := zerolog.Nop()
+	sc := &subcommandContext{
+		c:                 cli.NewContext(cli.NewApp(), flag.NewFlagSet("apply", flag.PanicOnError), nil),
+		log:               &log,
+		tunnelstoreClient: client,
+	}
+
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+virtual-networks:
+  - name: prod
+    comment: Production network
+  - name: staging
+tunnels:
+  - name: web
+    dns:
+      - web.example.com
+      - app.example.com
+    ip-routes:
+      - network: 10.0.0.0/16
+        virtual-network: prod
+      - network: 10.1.0.0/16
+        virtual-network: staging
+      - network: 10.2.0.0/16
+`), 0600))
+	m, err := readManifest(path)
+	require.NoError(t, err)
+
+	changes, err := sc.planManifest(m, true)
+	require.NoError(t, err)
+	var diff bytes.Buffer
+	printChanges(&diff, changes)
+	assert.Equal(t, `~ update virtual network prod: comment "Production network"
++ create virtual network staging
+- delete the route 10.9.0.0/16 of tunnel web
++ route DNS web.example.com to tunnel web
++ route 10.1.0.0/16 in virtual network staging to tunnel web
++ route 10.2.0.0/16 to tunnel web
+`, diff.String())
+
+	require.NoError(t, sc.applyChanges(changes))
+	assert.Equal(t, "Production network", prodVnet.Comment)
+	require.Len(t, client.vnets, 3)
+	staging := client.vnets[2]
+	assert.Equal(t, "staging", staging.Name)
+	assert.Equal(t, []uuid.UUID{staleRoute.ID}, client.deletedRoutes)
+	assert.Equal(t, []string{"dns web.example.com"}, client.dnsRoutes)
+	require.Len(t, client.routes, 4)
+	assert.Equal(t, "10.1.0.0/16", client.routes[2].Network.String())
+	assert.Equal(t, &staging.ID, client.routes[2].VNetID)
+	assert.Equal(t, web.ID, client.routes[2].TunnelID)
+	assert.Nil(t, client.routes[3].VNetID)
+
+	// Without --prune the routes the manifest doesn't list are kept
+	changes, err = sc.planManifest(&manifest{Tunnels: []manifestTunnel{{Name: "web"}}}, false)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = sc.planManifest(&manifest{Tunnels: []manifestTunnel{{Name: "web", IPRoutes: []manifestIPRoute{{Network: "10.3.0.0/16", VirtualNetwork: "dev"}}}}}, false)
+	assert.Error(t, err)
+
+	// The records to anything else than the tunnel aren't overwritten
+	changes, err = sc.planManifest(&manifest{Tunnels: []manifestTunnel{
+		{Name: "web", DNS: []string{"legacy.example.com"}},
+		{Name: "api", DNS: []string{"app.example.com"}},
+	}}, false)
+	require.NoError(t, err)
+	diff.Reset()
+	printChanges(&diff, changes)
+	assert.Equal(t, `+ create tunnel api
+! DNS legacy.example.com already points to 192.0.2.1 (A record), it can't be routed to tunnel web
+! DNS app.example.com already points to `+cfapi.TunnelTarget(web.ID)+` (CNAME record), it can't be routed to tunnel api
+`, diff.String())
+	assert.ErrorContains(t, sc.applyChanges(changes), "2 conflicts")
+}
+
+func TestManifestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest manifest
+		wantErr  bool
+	}{
+		{
+			name: "valid",
+			manifest: manifest{
+				VirtualNetworks: []manifestVnet{{Name: "staging", Default: true}},
+				Tunnels: []manifestTunnel{{
+					Name:     "web",
+					Labels:   map[string]string{"env": "prod"},
+					IPRoutes: []manifestIPRoute{{Network: "10.0.0.0/16"}, {Network: "10.0.0.0/16", VirtualNetwork: "staging"}},
+				}},
+			},
+		},
+		{
+			name:     "duplicate tunnel",
+			manifest: manifest{Tunnels: []manifestTunnel{{Name: "web"}, {Name: "web"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "several default virtual networks",
+			manifest: manifest{VirtualNetworks: []manifestVnet{{Name: "a", Default: true}, {Name: "b", Default: true}}},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid network",
+			manifest: manifest{Tunnels: []manifestTunnel{{Name: "web", IPRoutes: []manifestIPRoute{{Network: "10.0.0.1"}}}}},
+			wantErr:  true,
+		},
+		{
+			name: "route of two tunnels",
+			manifest: manifest{Tunnels: []manifestTunnel{
+				{Name: "web", IPRoutes: []manifestIPRoute{{Network: "10.0.0.0/16"}}},
+				{Name: "ssh", IPRoutes: []manifestIPRoute{{Network: "10.0.0.0/16"}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name:     "invalid label",
+			manifest: manifest{Tunnels: []manifestTunnel{{Name: "web", Labels: map[string]string{"": "prod"}}}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.manifest.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
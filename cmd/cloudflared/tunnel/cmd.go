@@ -4,6 +4,10 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"maps"
+	"math/rand"
+	"net"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -12,7 +16,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/coreos/go-systemd/v22/daemon"
 	"github.com/facebookgo/grace/gracenet"
 	"github.com/getsentry/sentry-go"
 	"github.com/google/uuid"
@@ -22,12 +25,14 @@ import (
 	"github.com/urfave/cli/v2"
 	"github.com/urfave/cli/v2/altsrc"
 
+	"github.com/cloudflare/cloudflared/accesslog"
 	"github.com/cloudflare/cloudflared/cfapi"
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/proxydns"
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/updater"
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/controlapi"
 	"github.com/cloudflare/cloudflared/credentials"
 	"github.com/cloudflare/cloudflared/diagnostic"
 	"github.com/cloudflare/cloudflared/edgediscovery"
@@ -40,6 +45,7 @@ import (
 	"github.com/cloudflare/cloudflared/signal"
 	"github.com/cloudflare/cloudflared/supervisor"
 	"github.com/cloudflare/cloudflared/tlsconfig"
+	"github.com/cloudflare/cloudflared/tracing"
 	"github.com/cloudflare/cloudflared/tunneldns"
 	"github.com/cloudflare/cloudflared/tunnelstate"
 	"github.com/cloudflare/cloudflared/validation"
@@ -51,6 +57,51 @@ const (
 	// ha-Connections specifies how many connections to make to the edge
 	haConnectionsFlag = "ha-connections"
 
+	// startupTimeoutFlag is how long the tunnels have to establish their connections before cloudflared exits
+	startupTimeoutFlag = "startup-timeout"
+
+	// startupMinConnectionsFlag is how many connections each tunnel must establish before the startup timeout
+	startupMinConnectionsFlag = "startup-min-connections"
+
+	// drainCutFlag lists the traffic classes that are cut when the graceful shutdown starts instead of being drained
+	drainCutFlag = "drain-cut"
+
+	// drainProgressIntervalFlag is how often the traffic left to drain is reported during a graceful shutdown
+	drainProgressIntervalFlag = "drain-progress-interval"
+
+	// metricsSocketActivationFlag serves the metrics on the socket passed by systemd instead of --metrics
+	metricsSocketActivationFlag = "metrics-socket-activation"
+
+	// metricsPprofFlag exposes all the profiles of net/http/pprof on the metrics server
+	metricsPprofFlag = "metrics-pprof"
+
+	// readyMinConnectionsFlag is how many edge connections a tunnel needs for /ready to report it as ready
+	readyMinConnectionsFlag = "ready-min-connections"
+
+	// readyCheckOriginsFlag requires the origins of a tunnel to resolve for /ready to report it as ready
+	readyCheckOriginsFlag = "ready-check-origins"
+
+	// controlAPIFlag is the Unix socket or loopback address the control API is served on
+	controlAPIFlag = "control-api"
+
+	// accessLogFlag is the file or named pipe the proxied requests and flows are logged to as JSON lines
+	accessLogFlag = "access-log"
+
+	// requestIDHeaderFlag is the header the ID of each proxied request is generated in or propagated from
+	requestIDHeaderFlag = "request-id-header"
+
+	// maxConcurrentRequestsFlag is how many requests and flows are proxied at once before the next ones are queued
+	maxConcurrentRequestsFlag = "max-concurrent-requests"
+
+	// maxQueuedRequestsFlag is how many requests and flows wait for the --max-concurrent-requests before they are shed
+	maxQueuedRequestsFlag = "max-queued-requests"
+
+	// queuedRequestTimeoutFlag is how long a queued request or flow waits before it is shed
+	queuedRequestTimeoutFlag = "queued-request-timeout"
+
+	// cryptoPolicyFlag restricts the TLS versions, cipher suites and curves of the connections to the edge and the origins
+	cryptoPolicyFlag = "crypto-policy"
+
 	// sshPortFlag is the port on localhost the cloudflared ssh server will run on
 	sshPortFlag = "local-ssh-port"
 
@@ -92,6 +143,11 @@ const (
 	// Note that this may result in packet drops for UDP proxying, since we expect being able to send at least 1280 bytes of inner packets.
 	quicDisablePathMTUDiscovery = "quic-disable-pmtu-discovery"
 
+	// udpPassthrough sets if UDP flows should be proxied in site-to-site passthrough mode. Encapsulated payloads
+	// (e.g. WireGuard or ESP-in-UDP) are then proxied up to the datagram size allowed by the QUIC path MTU instead of
+	// being limited to 1280 bytes.
+	udpPassthrough = "udp-passthrough"
+
 	// quicConnLevelFlowControlLimit controls the max flow control limit allocated for a QUIC connection. This controls how much data is the
 	// receiver willing to buffer. Once the limit is reached, the sender will send a DATA_BLOCKED frame to indicate it has more data to write,
 	// but it's blocked by flow control
@@ -118,6 +174,9 @@ Please note that Quick Tunnels are meant to be ephemeral and should only be used
 For production usage, we recommend creating Named Tunnels. (https://developers.cloudflare.com/cloudflare-one/connections/connect-apps/install-and-setup/tunnel-guide/)
 `
 	connectorLabelFlag = "label"
+
+	// configHistorySize is how many of the remote configurations applied are retained for the management service
+	configHistorySize = 20
 )
 
 var (
@@ -135,7 +194,22 @@ var (
 		"autoupdate-freq",
 		"no-autoupdate",
 		"metrics",
+		"metrics-socket-activation",
+		"metrics-pprof",
+		"control-api",
+		"ready-min-connections",
+		"ready-check-origins",
+		"metrics-tls-cert",
+		"metrics-tls-key",
+		"metrics-tls-client-ca",
+		"metrics-push-interval",
+		"metrics-push-label",
 		"pidfile",
+		"hook-timeout",
+		"event-hook",
+		"otlp-endpoint",
+		"otlp-sample-ratio",
+		"otlp-trust-traceparent",
 		"url",
 		"hello-world",
 		"socks5",
@@ -154,6 +228,7 @@ var (
 		"no-tls-verify",
 		"no-chunked-encoding",
 		"http2-origin",
+		"http3-origin",
 		"management-hostname",
 		"service-op-ip",
 		"local-ssh-port",
@@ -171,6 +246,16 @@ var (
 		"transport-loglevel",
 		"logfile",
 		"log-directory",
+		"log-syslog-facility",
+		"log-journald",
+		"log-rate-limit",
+		"log-rate-limit-period",
+		"log-sample-rate",
+		"access-log",
+		"request-id-header",
+		"max-concurrent-requests",
+		"max-queued-requests",
+		"queued-request-timeout",
 		"trace-output",
 		"proxy-dns",
 		"proxy-dns-port",
@@ -178,6 +263,12 @@ var (
 		"proxy-dns-upstream",
 		"proxy-dns-max-upstream-conns",
 		"proxy-dns-bootstrap",
+		"proxy-dns-no-cache",
+		"proxy-dns-cache-size",
+		"proxy-dns-cache-min-ttl",
+		"proxy-dns-cache-max-ttl",
+		"proxy-dns-cache-negative-ttl",
+		"proxy-dns-cache-prefetch",
 		"is-autoupdated",
 		"edge",
 		"region",
@@ -202,6 +293,14 @@ var (
 		"quic-stream-level-flow-control-limit",
 		"label",
 		"grace-period",
+		"drain-cut",
+		"drain-progress-interval",
+		"watchdog-interval",
+		"watchdog-max-goroutines",
+		"watchdog-max-heap-mb",
+		"watchdog-restart",
+		"startup-timeout",
+		"startup-min-connections",
 		"compression-quality",
 		"use-reconnect-token",
 		"dial-edge-timeout",
@@ -209,8 +308,10 @@ var (
 		"name",
 		"ui",
 		"quick-service",
+		"output",
 		"max-fetch-size",
 		"post-quantum",
+		"crypto-policy",
 		"management-diagnostics",
 		"protocol",
 		"overwrite-dns",
@@ -235,8 +336,14 @@ func Commands() []*cli.Command {
 		buildIngressSubcommand(),
 		buildDeleteCommand(),
 		buildCleanupCommand(),
+		buildApplyCommand(),
+		buildRemoteConfigCommand(),
+		buildRotateCredentialsCommand(),
+		buildEncryptCredentialsCommand(),
 		buildTokenCommand(),
-		buildDiagCommand(),
+		buildWhoamiCommand(),
+		buildDiagCommand("cloudflared tunnel [tunnel command options]"),
+		buildHealthCommand("cloudflared tunnel [tunnel command options]"),
 		// for compatibility, allow following as tunnel subcommands
 		proxydns.Command(true),
 		cliutil.RemovedCommand("db-connect"),
@@ -246,6 +353,8 @@ func Commands() []*cli.Command {
 		buildTunnelCommand(subcommands),
 		// for compatibility, allow following as top-level subcommands
 		buildLoginSubcommand(true),
+		buildDiagCommand("cloudflared"),
+		buildHealthCommand("cloudflared"),
 		cliutil.RemovedCommand("db-connect"),
 	}
 }
@@ -352,7 +461,7 @@ func runAdhocNamedTunnel(sc *subcommandContext, name, credentialsOutputPath stri
 	tunnel, ok, err := sc.tunnelActive(name)
 	if err != nil || !ok {
 		// pass empty string as secret to generate one
-		tunnel, err = sc.create(name, credentialsOutputPath, "")
+		tunnel, err = sc.create(name, credentialsOutputPath, "", nil)
 		if err != nil {
 			return errors.Wrap(err, "failed to create tunnel")
 		}
@@ -390,6 +499,35 @@ func StartServer(
 	info *cliutil.BuildInfo,
 	namedTunnel *connection.TunnelProperties,
 	log *zerolog.Logger,
+) error {
+	return startServer(c, info, []tunnelInstance{{properties: namedTunnel, config: config.GetConfiguration()}}, log)
+}
+
+// tunnelInstance is a tunnel run by the process with the configuration of its ingress. The name is only set when the
+// process runs several tunnels.
+type tunnelInstance struct {
+	name       string
+	properties *connection.TunnelProperties
+	config     *config.Configuration
+}
+
+// runningTunnel is a tunnel prepared to connect to the edge, with the orchestrator of its ingress.
+type runningTunnel struct {
+	tunnelInstance
+	tunnelConfig   *supervisor.TunnelConfig
+	orchestrator   *orchestration.Orchestrator
+	observer       *connection.Observer
+	clientID       uuid.UUID
+	quickTunnelURL string
+}
+
+// startServer runs the tunnels until cloudflared is stopped. The tunnels share the process-wide components, such as
+// the metrics server, the DNS proxy and the autoupdater.
+func startServer(
+	c *cli.Context,
+	info *cliutil.BuildInfo,
+	tunnels []tunnelInstance,
+	log *zerolog.Logger,
 ) error {
 	err := sentry.Init(sentry.ClientOptions{
 		Dsn:     sentryDSN,
@@ -461,7 +599,8 @@ func StartServer(
 	}
 
 	connectedSignal := signal.New(make(chan struct{}))
-	go notifySystemd(connectedSignal)
+	notifier := newSystemdNotifier(log)
+	go notifier.run(ctx, connectedSignal, graceShutdownC)
 	if c.IsSet("pidfile") {
 		go writePidFile(connectedSignal, c.String("pidfile"), log)
 	}
@@ -477,7 +616,7 @@ func StartServer(
 	}()
 
 	// Serve DNS proxy stand-alone if no tunnel type (quick, adhoc, named) is going to run
-	if dnsProxyStandAlone(c, namedTunnel) {
+	if dnsProxyStandAlone(c, tunnels[0].properties) {
 		connectedSignal.Notify()
 		// no grace period, handle SIGINT/SIGTERM immediately
 		return waitToShutdown(&wg, cancel, errC, graceShutdownC, 0, log)
@@ -485,21 +624,303 @@ func StartServer(
 
 	logTransport := logger.CreateTransportLoggerFromContext(c, logger.EnableTerminalLog)
 
+	traces, err := newOTLPExporter(c)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The spans of the last requests are exported on the way out
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := traces.Shutdown(shutdownCtx); err != nil {
+			log.Err(err).Msg("Failed to export the last spans")
+		}
+	}()
+
+	var accessLog *accesslog.Logger
+	if path := c.String(accessLogFlag); path != "" {
+		// The invalid redaction rules were already reported when creating the logger
+		redactions, _ := logger.ParseRedactionRules(c.StringSlice(logger.LogRedactFlag))
+		if accessLog, err = accesslog.Open(path, redactions, log); err != nil {
+			return errors.Wrapf(err, "failed to open the --%s", accessLogFlag)
+		}
+		defer accessLog.Close()
+	}
+
+	running := make([]*runningTunnel, 0, len(tunnels))
+	for _, tunnel := range tunnels {
+		tunnelLog := log
+		if tunnel.name != "" {
+			l := log.With().Str(LogFieldTunnelID, tunnel.properties.Credentials.TunnelID.String()).Logger()
+			tunnelLog = &l
+		}
+		var reloads orchestration.ReloadObserver
+		events := newEventHooks(ctx, c, tunnel.properties.Credentials.TunnelID, info.UserAgent(), tunnelLog)
+		if events != nil {
+			reloads = events
+		}
+		rt, err := prepareTunnel(ctx, c, info, tunnel, reloads, traces, accessLog, tunnelLog, logTransport)
+		if err != nil {
+			return err
+		}
+		if events != nil {
+			rt.observer.RegisterSink(events)
+		}
+		if logger.ServiceEventLog != nil {
+			rt.observer.RegisterSink(serviceEventLogSink{eventLog: logger.ServiceEventLog, tunnelName: tunnel.name})
+		}
+		running = append(running, rt)
+	}
+
+	trackers := make([]*tunnelstate.ConnTracker, len(running))
+	for i, rt := range running {
+		trackers[i] = tunnelstate.NewConnTracker(rt.tunnelConfig.Log)
+		rt.observer.RegisterSink(trackers[i])
+	}
+	notifier.watch(trackers)
+	if address := c.String(controlAPIFlag); address != "" {
+		listener, err := controlapi.Listen(address)
+		if err != nil {
+			return errors.Wrap(err, "Error opening the control API listener")
+		}
+		defer listener.Close()
+		apiTunnels := make([]controlapi.Tunnel, len(running))
+		for i, rt := range running {
+			apiTunnels[i] = controlapi.Tunnel{
+				ID:          rt.tunnelConfig.NamedTunnel.Credentials.TunnelID,
+				Name:        rt.name,
+				Connections: trackers[i],
+				Flows:       rt.tunnelConfig.Flows,
+				Config:      rt.orchestrator,
+				Drainer:     rt.tunnelConfig.ConnectionDrainer,
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errC <- controlapi.Serve(ctx, listener, apiTunnels, log)
+		}()
+	}
+	drainer, err := newDrainer(running, c.StringSlice(drainCutFlag), c.Duration(drainProgressIntervalFlag), log)
+	if err != nil {
+		return err
+	}
+	watchdog, err := newWatchdog(c, log)
+	if err != nil {
+		return err
+	}
+	var tunnelsShutdownC <-chan struct{} = graceShutdownC
+	if watchdog != nil {
+		// A restart by the watchdog shuts down gracefully, like a signal
+		tunnelsShutdownC = mergeShutdown(graceShutdownC, watchdog.restartC)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errC <- watchdog.run(ctx)
+		}()
+	}
+	// The tunnels only shut down once the pre stop hook ran
+	shutdownC := newLifecycleHooks(c, running, log).run(ctx, connectedSignal, tunnelsShutdownC)
+	var gate *startupGate
+	if c.Duration(startupTimeoutFlag) > 0 {
+		if gate, err = newStartupGate(running, trackers, c.Int(startupMinConnectionsFlag), c.Int(haConnectionsFlag)); err != nil {
+			return err
+		}
+	}
+
+	if readyMinConnections := c.Int(readyMinConnectionsFlag); readyMinConnections < 1 || readyMinConnections > c.Int(haConnectionsFlag) {
+		return cliutil.UsageError("--%s must be between 1 and --%s", readyMinConnectionsFlag, haConnectionsFlag)
+	}
+	metricsTLSConfig, err := newMetricsTLSConfig(c)
+	if err != nil {
+		return errors.Wrap(err, "Error configuring the TLS of the metrics server")
+	}
+	metricsCredentials, err := newMetricsCredentials(c, metricsTLSConfig != nil, log)
+	if err != nil {
+		return err
+	}
+
+	metricsPusher, err := newMetricsPusher(c, info, log)
+	if err != nil {
+		return errors.Wrap(err, "Error configuring the metrics push")
+	}
+	if metricsPusher != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metricsPusher.Run(ctx)
+		}()
+	}
+
+	var metricsListener net.Listener
+	if c.Bool(metricsSocketActivationFlag) {
+		metricsListener, err = systemdMetricsListener()
+	} else {
+		metricsListener, err = metrics.CreateMetricsListener(&listeners, c.String("metrics"))
+	}
+	if err != nil {
+		log.Err(err).Msg("Error opening metrics server listener")
+		return errors.Wrap(err, "Error opening metrics server listener")
+	}
+
+	defer metricsListener.Close()
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ipv4, ipv6, err := determineICMPSources(c, log)
+		sources := make([]string, 0)
+		if err == nil {
+			sources = append(sources, ipv4.String())
+			sources = append(sources, ipv6.String())
+		}
+		cliFlags := nonSecretCliFlags(log, c, nonSecretFlagsList)
+		settings := effectiveSettings(c, os.Args[1:], os.LookupEnv)
+
+		var metricsConfig metrics.Config
+		for i, rt := range running {
+			tracker := trackers[i]
+			readiness := metrics.ReadinessConfig{MinConnections: uint(c.Int(readyMinConnectionsFlag))}
+			if c.Bool(readyCheckOriginsFlag) {
+				readiness.Origins = rt.orchestrator
+			}
+			readinessServer := metrics.NewReadyServer(rt.clientID, tracker, readiness)
+			diagnosticHandler := diagnostic.NewDiagnosticHandler(
+				rt.tunnelConfig.Log,
+				0,
+				diagnostic.NewSystemCollectorImpl(buildInfo.CloudflaredVersion),
+				rt.tunnelConfig.NamedTunnel.Credentials.TunnelID,
+				rt.clientID,
+				tracker,
+				rt.tunnelConfig.Flows,
+				maps.Clone(cliFlags),
+				sources,
+				effectiveConfiguration(settings, newLocalConfigurationSources(rt.config), rt.orchestrator),
+			)
+			if rt.name == "" {
+				metricsConfig = metrics.Config{
+					ReadyServer:         readinessServer,
+					DiagnosticHandler:   diagnosticHandler,
+					QuickTunnelHostname: rt.quickTunnelURL,
+					Orchestrator:        rt.orchestrator,
+				}
+				continue
+			}
+			metricsConfig.Tunnels = append(metricsConfig.Tunnels, metrics.TunnelEndpoints{
+				Name:              rt.name,
+				ReadyServer:       readinessServer,
+				DiagnosticHandler: diagnosticHandler,
+				Orchestrator:      rt.orchestrator,
+			})
+		}
+		metricsConfig.TLSConfig = metricsTLSConfig
+		metricsConfig.Credentials = metricsCredentials
+		metricsConfig.Pprof = c.Bool(metricsPprofFlag)
+		errC <- metrics.ServeMetrics(metricsListener, ctx, metricsConfig, log)
+	}()
+
+	reconnectChs := make([]chan supervisor.ReconnectSignal, len(running))
+	for i := range running {
+		reconnectChs[i] = make(chan supervisor.ReconnectSignal, c.Int(haConnectionsFlag))
+	}
+	if c.IsSet("stdin-control") {
+		log.Info().Msg("Enabling control through stdin")
+		if len(running) == 1 {
+			go stdinControl(reconnectChs[0], log)
+		} else {
+			reconnectCh := make(chan supervisor.ReconnectSignal)
+			go stdinControl(reconnectCh, log)
+			go func() {
+				// The connection to restart is chosen randomly, among all the tunnels
+				for reconnect := range reconnectCh {
+					reconnectChs[rand.Intn(len(reconnectChs))] <- reconnect
+				}
+			}()
+		}
+	}
+
+	tunnelsConnected := make([]*signal.Signal, len(running))
+	for i, rt := range running {
+		tunnelConnected := connectedSignal
+		if len(running) > 1 {
+			tunnelConnected = signal.New(make(chan struct{}))
+		}
+		tunnelsConnected[i] = tunnelConnected
+		wg.Add(1)
+		go func(rt *runningTunnel, reconnectCh chan supervisor.ReconnectSignal) {
+			defer func() {
+				wg.Done()
+				rt.tunnelConfig.Log.Info().Msg("Tunnel server stopped")
+			}()
+			errC <- supervisor.StartTunnelDaemon(ctx, rt.tunnelConfig, rt.orchestrator, tunnelConnected, reconnectCh, shutdownC)
+		}(rt, reconnectChs[i])
+	}
+	if len(running) > 1 {
+		// The process is only ready, e.g. for systemd, once all of its tunnels are connected
+		go func() {
+			for _, tunnelConnected := range tunnelsConnected {
+				select {
+				case <-tunnelConnected.Wait():
+				case <-ctx.Done():
+					return
+				}
+			}
+			connectedSignal.Notify()
+		}()
+	}
+
+	go drainer.run(ctx, shutdownC)
+
+	if gate != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := gate.wait(ctx, c.Duration(startupTimeoutFlag)); err != nil {
+				errC <- err
+			}
+		}()
+	}
+
+	gracePeriod, err := gracePeriod(c)
+	if err != nil {
+		return err
+	}
+	err = waitToShutdown(&wg, cancel, errC, shutdownC, gracePeriod, log)
+	if err == nil && watchdog != nil && watchdog.restarting != nil {
+		return watchdog.restarting
+	}
+	return err
+}
+
+// prepareTunnel creates the configuration and the orchestrator of a tunnel.
+func prepareTunnel(
+	ctx context.Context,
+	c *cli.Context,
+	info *cliutil.BuildInfo,
+	tunnel tunnelInstance,
+	reloads orchestration.ReloadObserver,
+	traces *tracing.OTLPExporter,
+	accessLog *accesslog.Logger,
+	log, logTransport *zerolog.Logger,
+) (*runningTunnel, error) {
 	observer := connection.NewObserver(log, logTransport)
 
 	// Send Quick Tunnel URL to UI if applicable
 	var quickTunnelURL string
-	if namedTunnel != nil {
-		quickTunnelURL = namedTunnel.QuickTunnelUrl
+	if tunnel.properties != nil {
+		quickTunnelURL = tunnel.properties.QuickTunnelUrl
 	}
 	if quickTunnelURL != "" {
 		observer.SendURL(quickTunnelURL)
+		notifier := newQuickTunnelNotifier(c, tunnel.properties, log)
+		notifier.notify(quickTunnelAssigned)
+		observer.RegisterSink(notifier)
 	}
 
-	tunnelConfig, orchestratorConfig, err := prepareTunnelConfig(ctx, c, info, log, logTransport, observer, namedTunnel)
+	tunnelConfig, orchestratorConfig, err := prepareTunnelConfig(ctx, c, info, log, logTransport, observer, tunnel.properties, tunnel.config)
 	if err != nil {
 		log.Err(err).Msg("Couldn't start tunnel")
-		return err
+		return nil, err
 	}
 	var clientID uuid.UUID
 	if tunnelConfig.NamedTunnel != nil {
@@ -515,6 +936,7 @@ func StartServer(
 		tunnelConfig.ICMPRouterServer = nil
 	}
 
+	orchestratorConfig.History = orchestration.NewConfigHistory(configHistorySize)
 	internalRules := []ingress.Rule{}
 	if features.Contains(features.FeatureManagementLogs) {
 		serviceIP := c.String("service-op-ip")
@@ -530,78 +952,38 @@ func StartServer(
 			serviceIP,
 			clientID,
 			c.String(connectorLabelFlag),
+			orchestratorConfig.History,
+			tunnelConfig.Flows,
 			logger.ManagementLogger.Log,
 			logger.ManagementLogger,
 		)
 		internalRules = []ingress.Rule{ingress.NewManagementRule(mgmt)}
 	}
-	orchestrator, err := orchestration.NewOrchestrator(ctx, orchestratorConfig, tunnelConfig.Tags, internalRules, tunnelConfig.Log)
-	if err != nil {
-		return err
-	}
-
-	metricsListener, err := metrics.CreateMetricsListener(&listeners, c.String("metrics"))
-	if err != nil {
-		log.Err(err).Msg("Error opening metrics server listener")
-		return errors.Wrap(err, "Error opening metrics server listener")
-	}
-
-	defer metricsListener.Close()
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		tracker := tunnelstate.NewConnTracker(log)
-		observer.RegisterSink(tracker)
-
-		ipv4, ipv6, err := determineICMPSources(c, log)
-		sources := make([]string, 0)
-		if err == nil {
-			sources = append(sources, ipv4.String())
-			sources = append(sources, ipv6.String())
+	if tunnelConfig.ICMPRouterServer != nil && tunnelConfig.NamedTunnel != nil {
+		sc := &subcommandContext{c: c, log: log, fs: realFileSystem{}}
+		tunnelID := tunnelConfig.NamedTunnel.Credentials.TunnelID
+		orchestratorConfig.VirtualNetworkRoutes = func(vnets []string) ([]netip.Prefix, error) {
+			return sc.tunnelVirtualNetworkRoutes(tunnelID, vnets)
 		}
-
-		readinessServer := metrics.NewReadyServer(clientID, tracker)
-		cliFlags := nonSecretCliFlags(log, c, nonSecretFlagsList)
-		diagnosticHandler := diagnostic.NewDiagnosticHandler(
-			log,
-			0,
-			diagnostic.NewSystemCollectorImpl(buildInfo.CloudflaredVersion),
-			tunnelConfig.NamedTunnel.Credentials.TunnelID,
-			clientID,
-			tracker,
-			cliFlags,
-			sources,
-		)
-		metricsConfig := metrics.Config{
-			ReadyServer:         readinessServer,
-			DiagnosticHandler:   diagnosticHandler,
-			QuickTunnelHostname: quickTunnelURL,
-			Orchestrator:        orchestrator,
-		}
-		errC <- metrics.ServeMetrics(metricsListener, ctx, metricsConfig, log)
-	}()
-
-	reconnectCh := make(chan supervisor.ReconnectSignal, c.Int(haConnectionsFlag))
-	if c.IsSet("stdin-control") {
-		log.Info().Msg("Enabling control through stdin")
-		go stdinControl(reconnectCh, log)
 	}
-
-	wg.Add(1)
-	go func() {
-		defer func() {
-			wg.Done()
-			log.Info().Msg("Tunnel server stopped")
-		}()
-		errC <- supervisor.StartTunnelDaemon(ctx, tunnelConfig, orchestrator, connectedSignal, reconnectCh, graceShutdownC)
-	}()
-
-	gracePeriod, err := gracePeriod(c)
+	orchestratorConfig.Reloads = reloads
+	orchestratorConfig.Traces = traces
+	orchestratorConfig.AccessLog = accessLog
+	if accessLog != nil {
+		tunnelConfig.Flows.OnClose(accessLog.LogFlow)
+	}
+	orchestrator, err := orchestration.NewOrchestrator(ctx, orchestratorConfig, tunnelConfig.Tags, internalRules, tunnelConfig.Log)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return waitToShutdown(&wg, cancel, errC, graceShutdownC, gracePeriod, log)
+	return &runningTunnel{
+		tunnelInstance: tunnel,
+		tunnelConfig:   tunnelConfig,
+		orchestrator:   orchestrator,
+		observer:       observer,
+		clientID:       clientID,
+		quickTunnelURL: quickTunnelURL,
+	}, nil
 }
 
 func waitToShutdown(wg *sync.WaitGroup,
@@ -646,11 +1028,6 @@ func waitToShutdown(wg *sync.WaitGroup,
 	return err
 }
 
-func notifySystemd(waitForSignal *signal.Signal) {
-	<-waitForSignal.Wait()
-	daemon.SdNotify(false, "READY=1")
-}
-
 func writePidFile(waitForSignal *signal.Signal, pidPathname string, log *zerolog.Logger) {
 	<-waitForSignal.Wait()
 	expandedPath, err := homedir.Expand(pidPathname)
@@ -807,25 +1184,25 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 		altsrc.NewIntFlag(&cli.IntFlag{
 			Name:   "max-edge-addr-retries",
 			Usage:  "Maximum number of times to retry on edge addrs before falling back to a lower protocol",
-			Value:  8,
+			Value:  supervisor.DefaultMaxEdgeAddrRetries,
 			Hidden: true,
 		}),
 		// Note TUN-3758 , we use Int because UInt is not supported with altsrc
 		altsrc.NewIntFlag(&cli.IntFlag{
 			Name:    "retries",
-			Value:   5,
+			Value:   supervisor.DefaultRetries,
 			Usage:   "Maximum number of retries for connection/protocol errors.",
 			EnvVars: []string{"TUNNEL_RETRIES"},
 			Hidden:  shouldHide,
 		}),
 		altsrc.NewIntFlag(&cli.IntFlag{
 			Name:   haConnectionsFlag,
-			Value:  4,
+			Value:  supervisor.DefaultHAConnections,
 			Hidden: true,
 		}),
 		altsrc.NewDurationFlag(&cli.DurationFlag{
 			Name:   rpcTimeout,
-			Value:  5 * time.Second,
+			Value:  supervisor.DefaultRPCTimeout,
 			Hidden: true,
 		}),
 		altsrc.NewDurationFlag(&cli.DurationFlag{
@@ -842,18 +1219,24 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 			Value:   false,
 			Hidden:  true,
 		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    udpPassthrough,
+			EnvVars: []string{"TUNNEL_UDP_PASSTHROUGH"},
+			Usage:   "Proxy UDP flows in site-to-site passthrough mode. Encapsulated payloads (e.g. WireGuard or ESP-in-UDP) larger than 1280 bytes are proxied as long as the QUIC path MTU allows it. Only applies to datagram v3 connections.",
+			Value:   false,
+		}),
 		altsrc.NewIntFlag(&cli.IntFlag{
 			Name:    quicConnLevelFlowControlLimit,
 			EnvVars: []string{"TUNNEL_QUIC_CONN_LEVEL_FLOW_CONTROL_LIMIT"},
 			Usage:   "Use this option to change the connection-level flow control limit for QUIC transport.",
-			Value:   30 * (1 << 20), // 30 MB
+			Value:   supervisor.DefaultQUICConnectionLevelFlowControlLimit,
 			Hidden:  true,
 		}),
 		altsrc.NewIntFlag(&cli.IntFlag{
 			Name:    quicStreamLevelFlowControlLimit,
 			EnvVars: []string{"TUNNEL_QUIC_STREAM_LEVEL_FLOW_CONTROL_LIMIT"},
 			Usage:   "Use this option to change the connection-level flow control limit for QUIC transport.",
-			Value:   6 * (1 << 20), // 6 MB
+			Value:   supervisor.DefaultQUICStreamLevelFlowControlLimit,
 			Hidden:  true,
 		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
@@ -864,10 +1247,94 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 		altsrc.NewDurationFlag(&cli.DurationFlag{
 			Name:    "grace-period",
 			Usage:   "When cloudflared receives SIGINT/SIGTERM it will stop accepting new requests, wait for in-progress requests to terminate, then shutdown. Waiting for in-progress requests will timeout after this grace period, or when a second SIGTERM/SIGINT is received.",
-			Value:   time.Second * 30,
+			Value:   supervisor.DefaultGracePeriod,
 			EnvVars: []string{"TUNNEL_GRACE_PERIOD"},
 			Hidden:  shouldHide,
 		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    drainCutFlag,
+			Usage:   "Traffic classes to cut as soon as the graceful shutdown starts instead of draining them during the grace period, among tcp (WARP routing flows) and udp (UDP sessions). HTTP requests are always drained.",
+			EnvVars: []string{"TUNNEL_DRAIN_CUT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    drainProgressIntervalFlag,
+			Usage:   "How often to report the HTTP requests, TCP flows and UDP sessions left to drain during the graceful shutdown. 0 only reports them when the shutdown starts.",
+			Value:   5 * time.Second,
+			EnvVars: []string{"TUNNEL_DRAIN_PROGRESS_INTERVAL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    startupTimeoutFlag,
+			Usage:   "Exit with an error if the tunnel doesn't establish --startup-min-connections connections to the edge within this timeout, e.g. because of invalid credentials or no connectivity. Default is 0 which keeps retrying forever.",
+			EnvVars: []string{"TUNNEL_STARTUP_TIMEOUT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    startupMinConnectionsFlag,
+			Usage:   "Number of edge connections the tunnel must establish within --startup-timeout.",
+			Value:   1,
+			EnvVars: []string{"TUNNEL_STARTUP_MIN_CONNECTIONS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    otlpEndpointFlag,
+			Usage:   "Export a span per proxied HTTP request, with its origin dial and response, to the OpenTelemetry collector at this OTLP/HTTP URL, e.g. http://localhost:4318. The trace is propagated to the origin in the traceparent header.",
+			EnvVars: []string{"TUNNEL_OTLP_ENDPOINT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    otlpHeaderFlag,
+			Usage:   "KEY=VALUE header sent to the --otlp-endpoint, e.g. to authenticate. Can be repeated.",
+			EnvVars: []string{"TUNNEL_OTLP_HEADERS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewFloat64Flag(&cli.Float64Flag{
+			Name:    otlpSampleRatioFlag,
+			Usage:   "Ratio of the requests traced to the --otlp-endpoint. The requests with a traceparent header continue its trace, but are sampled at this ratio too unless --otlp-trust-traceparent is set.",
+			Value:   1,
+			EnvVars: []string{"TUNNEL_OTLP_SAMPLE_RATIO"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    otlpTrustTraceparentFlag,
+			Usage:   "Follow the sampling decision of the traceparent header of the requests instead of --otlp-sample-ratio. Only set it if the eyeballs are trusted, since any client can ask for its requests to be traced.",
+			EnvVars: []string{"TUNNEL_OTLP_TRUST_TRACEPARENT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    accessLogFlag,
+			Usage:   "Append a JSON line per proxied request and flow to this file or named pipe, with its hostname, method, path, status, bytes, durations and eyeball IP. This is separate from the --logfile.",
+			EnvVars: []string{"TUNNEL_ACCESS_LOG"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    requestIDHeaderFlag,
+			Usage:   "Header carrying the ID of each proxied HTTP request, e.g. X-Request-Id. The ID sent by the client is kept, otherwise one is generated. It is forwarded to the origin and reported in the logs, the --access-log and the exemplars of the metrics.",
+			EnvVars: []string{"TUNNEL_REQUEST_ID_HEADER"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    maxConcurrentRequestsFlag,
+			Usage:   "Maximum number of HTTP requests and TCP flows proxied at once, 0 for no limit. Past it, requests wait in a queue of --max-queued-requests for up to --queued-request-timeout, and are answered with 503 Service Unavailable once it is full or the wait is over.",
+			Value:   0,
+			EnvVars: []string{"TUNNEL_MAX_CONCURRENT_REQUESTS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    maxQueuedRequestsFlag,
+			Usage:   "Maximum number of requests and flows waiting for the --max-concurrent-requests.",
+			Value:   1000,
+			EnvVars: []string{"TUNNEL_MAX_QUEUED_REQUESTS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    queuedRequestTimeoutFlag,
+			Usage:   "Maximum time a request or flow waits for the --max-concurrent-requests before it is shed.",
+			Value:   time.Second,
+			EnvVars: []string{"TUNNEL_QUEUED_REQUEST_TIMEOUT"},
+			Hidden:  shouldHide,
+		}),
 		// Note TUN-3758 , we use Int because UInt is not supported with altsrc
 		altsrc.NewIntFlag(&cli.IntFlag{
 			Name:    "compression-quality",
@@ -916,6 +1383,17 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 			Value:  "https://api.trycloudflare.com",
 			Hidden: true,
 		}),
+		&cli.StringFlag{
+			Name:   quickTunnelOutputFlag,
+			Usage:  "Print the URL of a quick tunnel to stdout in the given `FORMAT` when it is assigned and when the tunnel connects. Only json is supported.",
+			Hidden: shouldHide,
+		},
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    quickTunnelHookFlag,
+			Usage:   "Command run when the URL of a quick tunnel is assigned and when the tunnel connects. %s is replaced by the URL, which is appended to the command otherwise, and $QUICK_TUNNEL_EVENT is either assigned or connected.",
+			EnvVars: []string{"TUNNEL_URL_HOOK"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewIntFlag(&cli.IntFlag{
 			Name:    "max-fetch-size",
 			Usage:   `The maximum number of results that cloudflared can fetch from Cloudflare API for any listing operations needed`,
@@ -929,9 +1407,16 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 			EnvVars: []string{"TUNNEL_POST_QUANTUM"},
 			Hidden:  FipsEnabled,
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    cryptoPolicyFlag,
+			Usage:   "Restricts the TLS connections to the edge and the origins: none, strict for TLS 1.2 and up with forward secret AEAD cipher suites, or fips for the AES-GCM cipher suites and P-256 and P-384 curves approved by FIPS 140 on top of it. Connections negotiating anything else are rejected. The parameters negotiated by the active connections are reported on /diag/tls of the --metrics server.",
+			Value:   tlsconfig.CryptoPolicyNone,
+			EnvVars: []string{"TUNNEL_CRYPTO_POLICY"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewBoolFlag(&cli.BoolFlag{
 			Name:    "management-diagnostics",
-			Usage:   "Enables the in-depth diagnostic routes to be made available over the management service (/debug/pprof, /metrics, etc.)",
+			Usage:   "Enables the in-depth diagnostic routes to be made available over the management service (/debug/pprof, /metrics, /flows, etc.)",
 			EnvVars: []string{"TUNNEL_MANAGEMENT_DIAGNOSTICS"},
 			Value:   true,
 		}),
@@ -951,6 +1436,12 @@ func configureCloudflaredFlags(shouldHide bool) []cli.Flag {
 			Value:  config.FindDefaultConfigPath(),
 			Hidden: shouldHide,
 		},
+		&cli.StringFlag{
+			Name:    cliutil.ProfileFlag,
+			Usage:   "Use the origin certificate, credentials file and config file of this profile of the profiles section of the config file.",
+			EnvVars: []string{"TUNNEL_PROFILE"},
+			Hidden:  shouldHide,
+		},
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    credentials.OriginCertFlag,
 			Usage:   "Path to the certificate generated for your origin when you run cloudflared login.",
@@ -984,12 +1475,147 @@ and virtualized host network stacks from each other`,
 			EnvVars: []string{"TUNNEL_METRICS"},
 			Hidden:  shouldHide,
 		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    metricsSocketActivationFlag,
+			Usage:   "Serve the metrics on the socket passed by systemd socket activation instead of listening on --metrics. The socket unit must name it with FileDescriptorName=metrics.",
+			EnvVars: []string{"TUNNEL_METRICS_SOCKET_ACTIVATION"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    metricsPprofFlag,
+			Usage:   "Expose the CPU, heap, goroutine, mutex, block and trace profiles under /debug/pprof/ on the metrics server. Only the heap and goroutine profiles collected by tunnel diag are exposed otherwise.",
+			EnvVars: []string{"TUNNEL_METRICS_PPROF"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    controlAPIFlag,
+			Usage:   "Serve a REST API reporting the edge connections, flows, ingress rule stats and configuration version of the tunnels, on a Unix socket (unix:PATH) or a loopback address (HOST:PORT). The tunnels are only controlled, e.g. to drain their connections or cut their flows, on a Unix socket.",
+			EnvVars: []string{"TUNNEL_CONTROL_API"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    readyMinConnectionsFlag,
+			Usage:   "Number of edge connections a tunnel needs for the /ready endpoint of the metrics server to report it as ready. /healthz only reports that the process is alive.",
+			Value:   1,
+			EnvVars: []string{"TUNNEL_READY_MIN_CONNECTIONS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    readyCheckOriginsFlag,
+			Usage:   "Only report a tunnel as ready on /ready if the hostnames of all the origins of its ingress rules resolve.",
+			EnvVars: []string{"TUNNEL_READY_CHECK_ORIGINS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    metricsTLSCertFlag,
+			Usage:   "Serve the metrics over HTTPS with the certificate in this PEM file, e.g. when the metrics port is reachable from a shared network.",
+			EnvVars: []string{"TUNNEL_METRICS_TLS_CERT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    metricsTLSKeyFlag,
+			Usage:   "Private key of the --metrics-tls-cert, in a PEM file.",
+			EnvVars: []string{"TUNNEL_METRICS_TLS_KEY"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    metricsTLSClientCAFlag,
+			Usage:   "Only accept the clients of the metrics server with a certificate issued by a CA in this PEM file.",
+			EnvVars: []string{"TUNNEL_METRICS_TLS_CLIENT_CA"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    metricsBasicAuthFlag,
+			Usage:   "USERNAME:PASSWORD required with basic auth to access the metrics server, except its /healthz and /ready probes. Prefer setting it in the environment than on the command line.",
+			EnvVars: []string{"TUNNEL_METRICS_BASIC_AUTH"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    metricsBearerTokenFlag,
+			Usage:   "Token required in an Authorization: Bearer header to access the metrics server, except its /healthz and /ready probes. Prefer setting it in the environment than on the command line.",
+			EnvVars: []string{"TUNNEL_METRICS_BEARER_TOKEN"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    metricsPushURLFlag,
+			Usage:   "Push the metrics to a Prometheus remote_write URL, whose user info is sent as basic auth, or to statsd://HOST:PORT or dogstatsd://HOST:PORT, e.g. when the metrics server can't be scraped from behind a NAT.",
+			EnvVars: []string{"TUNNEL_METRICS_PUSH_URL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    metricsPushIntervalFlag,
+			Usage:   "Interval between the pushes of the metrics to --metrics-push-url.",
+			Value:   15 * time.Second,
+			EnvVars: []string{"TUNNEL_METRICS_PUSH_INTERVAL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    metricsPushLabelFlag,
+			Usage:   "Label NAME=VALUE added to the pushed metrics. The job and instance labels default to cloudflared and the hostname.",
+			EnvVars: []string{"TUNNEL_METRICS_PUSH_LABEL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    watchdogIntervalFlag,
+			Usage:   "Sample the goroutines and the heap of cloudflared at this interval, and log a dump of the goroutines when --watchdog-max-goroutines or --watchdog-max-heap-mb is exceeded. 0 disables the watchdog.",
+			EnvVars: []string{"TUNNEL_WATCHDOG_INTERVAL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    watchdogMaxGoroutinesFlag,
+			Usage:   "Number of goroutines over which the watchdog dumps them. 0 means no limit.",
+			EnvVars: []string{"TUNNEL_WATCHDOG_MAX_GOROUTINES"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    watchdogMaxHeapFlag,
+			Usage:   "Megabytes of heap in use over which the watchdog dumps the goroutines. 0 means no limit.",
+			EnvVars: []string{"TUNNEL_WATCHDOG_MAX_HEAP_MB"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    watchdogRestartFlag,
+			Usage:   fmt.Sprintf("Shut down when a watchdog threshold is exceeded, exiting with status code %d so that the service manager restarts cloudflared.", watchdogRestartExitCode),
+			EnvVars: []string{"TUNNEL_WATCHDOG_RESTART"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    "pidfile",
 			Usage:   "Write the application's PID to this file after first successful connection.",
 			EnvVars: []string{"TUNNEL_PIDFILE"},
 			Hidden:  shouldHide,
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    postStartHookFlag,
+			Usage:   "Command run once the tunnel is connected, e.g. to register the origin with a service discovery. $TUNNEL_HOOK_EVENT is post-start and $TUNNEL_IDS lists the IDs of the tunnels.",
+			EnvVars: []string{"TUNNEL_POST_START_HOOK"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    preStopHookFlag,
+			Usage:   "Command run when a graceful shutdown starts, before the tunnel stops accepting requests. $TUNNEL_HOOK_EVENT is pre-stop and $TUNNEL_IDS lists the IDs of the tunnels.",
+			EnvVars: []string{"TUNNEL_PRE_STOP_HOOK"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    eventWebhookFlag,
+			Usage:   "URL the connections going up and down, the protocol fallbacks and the remote configuration updates of the tunnel are posted to as JSON.",
+			EnvVars: []string{"TUNNEL_EVENT_WEBHOOK"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    eventHookFlag,
+			Usage:   "Command run on each connection going up or down, protocol fallback and remote configuration update of the tunnel. $TUNNEL_HOOK_EVENT is connected, disconnected, protocol-fallback or config-updated and the event is written to its stdin as JSON.",
+			EnvVars: []string{"TUNNEL_EVENT_HOOK"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    hookTimeoutFlag,
+			Usage:   "Maximum time the --post-start-hook, --pre-stop-hook and --event-hook commands and the --event-webhook requests can run for before they are killed, 0 to wait for the lifecycle hooks forever.",
+			Value:   30 * time.Second,
+			EnvVars: []string{"TUNNEL_HOOK_TIMEOUT"},
+			Hidden:  shouldHide,
+		}),
 	}
 }
 
@@ -1106,6 +1732,12 @@ func configureProxyFlags(shouldHide bool) []cli.Flag {
 			Hidden:  shouldHide,
 			Value:   false,
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    ingress.Http3OriginFlag,
+			Usage:   "Sends the requests to https origin servers over HTTP/3: always, or alt-svc once the origin advertises h3 in an Alt-Svc header, falling back to TCP when it can't be reached over QUIC.",
+			EnvVars: []string{"TUNNEL_ORIGIN_HTTP3"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    "management-hostname",
 			Usage:   "Management hostname to signify incoming management requests",
@@ -1252,7 +1884,7 @@ func configureProxyDNSFlags(shouldHide bool) []cli.Flag {
 		}),
 		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
 			Name:    "proxy-dns-upstream",
-			Usage:   "Upstream endpoint URL, you can specify multiple endpoints for redundancy.",
+			Usage:   "Upstream endpoint URL, you can specify multiple endpoints for redundancy. DNS over QUIC endpoints use the quic:// scheme (e.g. quic://dns.example:853) and fall back to the next upstream when they can't be reached.",
 			Value:   cli.NewStringSlice("https://1.1.1.1/dns-query", "https://1.0.0.1/dns-query"),
 			EnvVars: []string{"TUNNEL_DNS_UPSTREAM"},
 			Hidden:  shouldHide,
@@ -1276,6 +1908,45 @@ func configureProxyDNSFlags(shouldHide bool) []cli.Flag {
 			EnvVars: []string{"TUNNEL_DNS_BOOTSTRAP"},
 			Hidden:  shouldHide,
 		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    "proxy-dns-no-cache",
+			Usage:   "Disable the cache of DNS responses of the DNS over HTTPS proxy server, every query is sent upstream.",
+			EnvVars: []string{"TUNNEL_DNS_NO_CACHE"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "proxy-dns-cache-size",
+			Usage:   "Maximum number of DNS responses cached by the DNS over HTTPS proxy server.",
+			Value:   tunneldns.DefaultCacheSize,
+			EnvVars: []string{"TUNNEL_DNS_CACHE_SIZE"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "proxy-dns-cache-min-ttl",
+			Usage:   "Minimum time a positive DNS response is cached for by the DNS over HTTPS proxy server, regardless of its TTL.",
+			EnvVars: []string{"TUNNEL_DNS_CACHE_MIN_TTL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "proxy-dns-cache-max-ttl",
+			Usage:   "Maximum time a positive DNS response is cached for by the DNS over HTTPS proxy server, regardless of its TTL.",
+			Value:   tunneldns.DefaultCacheMaxTTL,
+			EnvVars: []string{"TUNNEL_DNS_CACHE_MAX_TTL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "proxy-dns-cache-negative-ttl",
+			Usage:   "Maximum time NXDOMAIN and NODATA responses are cached for by the DNS over HTTPS proxy server. Setting to a negative value disables negative caching.",
+			Value:   tunneldns.DefaultCacheNegativeTTL,
+			EnvVars: []string{"TUNNEL_DNS_CACHE_NEGATIVE_TTL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "proxy-dns-cache-prefetch",
+			Usage:   "Number of hits after which a DNS response cached by the DNS over HTTPS proxy server is refreshed before it expires. Setting to 0 disables prefetching.",
+			EnvVars: []string{"TUNNEL_DNS_CACHE_PREFETCH"},
+			Hidden:  shouldHide,
+		}),
 	}
 }
 
@@ -1329,7 +2000,7 @@ func nonSecretCliFlags(log *zerolog.Logger, cli *cli.Context, flagInclusionList
 		}
 
 		switch flag {
-		case logger.LogDirectoryFlag, logger.LogFileFlag:
+		case logger.LogDirectoryFlag, logger.LogFileFlag, accessLogFlag:
 			{
 				absolute, err := filepath.Abs(value)
 				if err != nil {
@@ -23,8 +23,11 @@ import (
 	"github.com/cloudflare/cloudflared/edgediscovery"
 	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
 	"github.com/cloudflare/cloudflared/features"
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/orchestration"
+	"github.com/cloudflare/cloudflared/overload"
+	quicpogs "github.com/cloudflare/cloudflared/quic"
 	"github.com/cloudflare/cloudflared/supervisor"
 	"github.com/cloudflare/cloudflared/tlsconfig"
 	"github.com/cloudflare/cloudflared/tunnelrpc/pogs"
@@ -122,6 +125,7 @@ func prepareTunnelConfig(
 	log, logTransport *zerolog.Logger,
 	observer *connection.Observer,
 	namedTunnel *connection.TunnelProperties,
+	cfg *config.Configuration,
 ) (*supervisor.TunnelConfig, *orchestration.Config, error) {
 	clientID, err := uuid.NewRandom()
 	if err != nil {
@@ -139,13 +143,25 @@ func prepareTunnelConfig(
 
 	clientFeatures := features.Dedup(append(c.StringSlice("features"), features.DefaultFeatures...))
 
+	cryptoPolicy, err := tlsconfig.NewCryptoPolicy(c.String(cryptoPolicyFlag))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid --%s", cryptoPolicyFlag)
+	}
+
 	staticFeatures := features.StaticFeatures{}
 	if c.Bool("post-quantum") {
 		if FipsEnabled {
 			return nil, nil, fmt.Errorf("post-quantum not supported in FIPS mode")
 		}
+		if cryptoPolicy != nil && len(cryptoPolicy.CurvePreferences) > 0 {
+			return nil, nil, fmt.Errorf("post-quantum not supported with the %s crypto policy", cryptoPolicy.Name)
+		}
 		pqMode := features.PostQuantumStrict
 		staticFeatures.PostQuantumMode = &pqMode
+	} else if cryptoPolicy != nil && len(cryptoPolicy.CurvePreferences) > 0 {
+		// The post-quantum key agreements are not among the curves the policy allows
+		pqMode := features.PostQuantumDisabled
+		staticFeatures.PostQuantumMode = &pqMode
 	}
 	featureSelector, err := features.NewFeatureSelector(ctx, namedTunnel.Credentials.AccountTag, staticFeatures, log)
 	if err != nil {
@@ -172,7 +188,6 @@ func prepareTunnelConfig(
 		Version:  info.Version(),
 		Arch:     info.OSArch(),
 	}
-	cfg := config.GetConfiguration()
 	ingressRules, err := ingress.ParseIngressFromConfigAndCLI(cfg, c, log)
 	if err != nil {
 		return nil, nil, err
@@ -184,20 +199,16 @@ func prepareTunnelConfig(
 	}
 	log.Info().Msgf("Initial protocol %s", protocolSelector.Current())
 
-	edgeTLSConfigs := make(map[connection.Protocol]*tls.Config, len(connection.ProtocolList))
-	for _, p := range connection.ProtocolList {
-		tlsSettings := p.TLSSettings()
-		if tlsSettings == nil {
-			return nil, nil, fmt.Errorf("%s has unknown TLS settings", p)
-		}
-		edgeTLSConfig, err := tlsconfig.CreateTunnelConfig(c, tlsSettings.ServerName)
+	edgeTLSConfigs, err := supervisor.NewEdgeTLSConfigs(func(serverName string) (*tls.Config, error) {
+		edgeTLSConfig, err := tlsconfig.CreateTunnelConfig(c, serverName)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "unable to create TLS config to connect with edge")
+			return nil, err
 		}
-		if len(tlsSettings.NextProtos) > 0 {
-			edgeTLSConfig.NextProtos = tlsSettings.NextProtos
-		}
-		edgeTLSConfigs[p] = edgeTLSConfig
+		cryptoPolicy.Apply(edgeTLSConfig)
+		return edgeTLSConfig, nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
 	gracePeriod, err := gracePeriod(c)
@@ -249,20 +260,41 @@ func prepareTunnelConfig(
 		RPCTimeout:                          c.Duration(rpcTimeout),
 		WriteStreamTimeout:                  c.Duration(writeStreamTimeout),
 		DisableQUICPathMTUDiscovery:         c.Bool(quicDisablePathMTUDiscovery),
+		UDPPassthrough:                      c.Bool(udpPassthrough),
 		QUICConnectionLevelFlowControlLimit: c.Uint64(quicConnLevelFlowControlLimit),
 		QUICStreamLevelFlowControlLimit:     c.Uint64(quicStreamLevelFlowControlLimit),
+		Flows:                               flow.NewTable(),
+	}
+	// The RTT of the QUIC connection carrying a datagram session estimates the RTT of the session towards the edge
+	tunnelConfig.Flows.SetEdgeRTT(func(connIndex uint8) (time.Duration, bool) {
+		return quicpogs.SmoothedRTT(namedTunnel.Credentials.TunnelID, connIndex)
+	})
+	if c.IsSet(controlAPIFlag) {
+		tunnelConfig.ConnectionDrainer = supervisor.NewConnectionDrainer()
 	}
-	icmpRouter, err := newICMPRouter(c, log)
+	if tunnelConfig.UDPPassthrough && tunnelConfig.DisableQUICPathMTUDiscovery {
+		log.Warn().Msgf("--%s limits the datagram size, UDP payloads larger than the QUIC packet size will be dropped in passthrough mode", quicDisablePathMTUDiscovery)
+	}
+	icmpRouter, err := newICMPRouter(c, log, tunnelConfig.Flows)
 	if err != nil {
 		log.Warn().Err(err).Msg("ICMP proxy feature is disabled")
 	} else {
 		tunnelConfig.ICMPRouterServer = icmpRouter
 	}
+	warpRoutingConfig, err := ingress.NewWarpRoutingConfig(&cfg.WarpRouting)
+	if err != nil {
+		return nil, nil, err
+	}
 	orchestratorConfig := &orchestration.Config{
 		Ingress:            &ingressRules,
-		WarpRouting:        ingress.NewWarpRoutingConfig(&cfg.WarpRouting),
+		WarpRouting:        warpRoutingConfig,
 		ConfigurationFlags: parseConfigFlags(c),
 		WriteTimeout:       c.Duration(writeStreamTimeout),
+		Flows:              tunnelConfig.Flows,
+		ICMPRouter:         tunnelConfig.ICMPRouterServer,
+		RequestIDHeader:    c.String(requestIDHeaderFlag),
+		Limiter:            overload.NewLimiter(c.Int(maxConcurrentRequestsFlag), c.Int(maxQueuedRequestsFlag), c.Duration(queuedRequestTimeoutFlag)),
+		CryptoPolicy:       cryptoPolicy,
 	}
 	return tunnelConfig, orchestratorConfig, nil
 }
@@ -351,13 +383,13 @@ func adjustIPVersionByBindAddress(ipVersion allregions.ConfigIPVersion, ip net.I
 	}
 }
 
-func newICMPRouter(c *cli.Context, logger *zerolog.Logger) (ingress.ICMPRouterServer, error) {
+func newICMPRouter(c *cli.Context, logger *zerolog.Logger, flows *flow.Table) (ingress.ICMPRouterServer, error) {
 	ipv4Src, ipv6Src, err := determineICMPSources(c, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	icmpRouter, err := ingress.NewICMPRouter(ipv4Src, ipv6Src, logger, icmpFunnelTimeout)
+	icmpRouter, err := ingress.NewICMPRouter(ipv4Src, ipv6Src, logger, icmpFunnelTimeout, flows)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,55 @@
+package tunnel
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+// runConfiguredTunnels runs all the tunnels of the tunnels section of the configuration file in this process.
+func runConfiguredTunnels(sc *subcommandContext, conf *config.Configuration) error {
+	tunnels, err := sc.configuredTunnels(conf)
+	if err != nil {
+		return err
+	}
+	for _, tunnel := range tunnels {
+		sc.log.Info().Str(LogFieldTunnelID, tunnel.properties.Credentials.TunnelID.String()).Msgf("Starting tunnel %s", tunnel.name)
+	}
+	return startServer(sc.c, buildInfo, tunnels, sc.log)
+}
+
+// configuredTunnels resolves the tunnels of the configuration file and finds their credentials.
+func (sc *subcommandContext) configuredTunnels(conf *config.Configuration) ([]tunnelInstance, error) {
+	if sc.c.String(CredFileFlag) != "" || sc.c.String(CredContentsFlag) != "" {
+		return nil, cliutil.UsageError(`--%s and --%s can't be used with the "tunnels" section of the configuration file, set the "credentials-file" of each tunnel instead.`, CredFileFlag, CredContentsFlag)
+	}
+	tunnels := make([]tunnelInstance, 0, len(conf.Tunnels))
+	seen := make(map[uuid.UUID]bool, len(conf.Tunnels))
+	for i, tunnel := range conf.Tunnels {
+		if tunnel.TunnelID == "" {
+			return nil, cliutil.UsageError(`Tunnel %d of the "tunnels" section of the configuration file has no "tunnel".`, i+1)
+		}
+		tunnelID, err := sc.findID(tunnel.TunnelID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing tunnel ID of %s", tunnel.TunnelID)
+		}
+		if seen[tunnelID] {
+			return nil, cliutil.UsageError(`Tunnel %s is listed more than once in the "tunnels" section of the configuration file.`, tunnel.TunnelID)
+		}
+		seen[tunnelID] = true
+
+		credentials, err := sc.findCredentialsIn(tunnelID, tunnel.CredentialsFile, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find the credentials of tunnel %s", tunnel.TunnelID)
+		}
+		tunnels = append(tunnels, tunnelInstance{
+			name:       tunnel.TunnelID,
+			properties: &connection.TunnelProperties{Credentials: credentials},
+			config:     conf.ForTunnel(tunnel),
+		})
+	}
+	return tunnels, nil
+}
@@ -0,0 +1,95 @@
+package tunnel
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func Test_subcommandContext_configuredTunnels(t *testing.T) {
+	accountTag := "0000d4d14e84bd4ae5a6a02e0000ac63"
+	webID := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	sshID := uuid.MustParse("5f4e0a4c-61a0-4bc5-8f0b-0a2b7bb1d03e")
+	fs := mockFileSystem{
+		rf: func(filePath string) ([]byte, error) {
+			switch filePath {
+			case "web.json":
+				return []byte(fmt.Sprintf(`{"AccountTag":"%s","TunnelSecret":"c2VjcmV0","TunnelID":"%s"}`, accountTag, webID)), nil
+			case "ssh.json":
+				return []byte(fmt.Sprintf(`{"AccountTag":"%s","TunnelSecret":"c2VjcmV0","TunnelID":"%s"}`, accountTag, sshID)), nil
+			}
+			return nil, errors.New("file not found")
+		},
+		vfp: func(string) bool { return true },
+	}
+	log := zerolog.Nop()
+	newContext := func(credFile string) *subcommandContext {
+		flagSet := flag.NewFlagSet("test", flag.PanicOnError)
+		flagSet.String(CredFileFlag, "", "")
+		flagSet.String(CredContentsFlag, "", "")
+		c := cli.NewContext(cli.NewApp(), flagSet, nil)
+		if credFile != "" {
+			_ = c.Set(CredFileFlag, credFile)
+		}
+		return &subcommandContext{c: c, log: &log, fs: fs}
+	}
+	webIngress := []config.UnvalidatedIngressRule{{Service: "http://localhost:8000"}}
+
+	conf := &config.Configuration{
+		Tunnels: []config.TunnelConfiguration{
+			{TunnelID: webID.String(), CredentialsFile: "web.json", Ingress: webIngress},
+			{TunnelID: sshID.String(), CredentialsFile: "ssh.json"},
+		},
+	}
+	tunnels, err := newContext("").configuredTunnels(conf)
+	require.NoError(t, err)
+	require.Len(t, tunnels, 2)
+	assert.Equal(t, webID.String(), tunnels[0].name)
+	assert.Equal(t, webID, tunnels[0].properties.Credentials.TunnelID)
+	assert.Equal(t, accountTag, tunnels[0].properties.Credentials.AccountTag)
+	assert.Equal(t, webIngress, tunnels[0].config.Ingress)
+	assert.Equal(t, sshID, tunnels[1].properties.Credentials.TunnelID)
+	assert.Empty(t, tunnels[1].config.Ingress)
+
+	tests := []struct {
+		name     string
+		credFile string
+		tunnels  []config.TunnelConfiguration
+	}{
+		{
+			name:     "credentials file flag applies to a single tunnel",
+			credFile: "web.json",
+			tunnels:  conf.Tunnels,
+		},
+		{
+			name:    "tunnel without ID",
+			tunnels: []config.TunnelConfiguration{{CredentialsFile: "web.json"}},
+		},
+		{
+			name: "tunnel listed twice",
+			tunnels: []config.TunnelConfiguration{
+				{TunnelID: webID.String(), CredentialsFile: "web.json"},
+				{TunnelID: webID.String(), CredentialsFile: "web.json"},
+			},
+		},
+		{
+			name:    "missing credentials",
+			tunnels: []config.TunnelConfiguration{{TunnelID: webID.String(), CredentialsFile: "db.json"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newContext(tt.credFile).configuredTunnels(&config.Configuration{Tunnels: tt.tunnels})
+			assert.Error(t, err)
+		})
+	}
+}
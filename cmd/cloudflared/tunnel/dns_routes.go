@@ -0,0 +1,151 @@
+package tunnel
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+)
+
+var (
+	dnsTTLFlag = &cli.IntFlag{
+		Name:  "ttl",
+		Usage: "TTL of the DNS records in seconds, 1 for automatic. Defaults to the one of the zone.",
+	}
+	dnsProxiedFlag = &cli.BoolFlag{
+		Name:  "proxied",
+		Usage: "Whether the DNS records are proxied by Cloudflare. Defaults to proxied, use --proxied=false for DNS only records.",
+	}
+	dnsHostnamesFileFlag = &cli.StringFlag{
+		Name: "hostnames-file",
+		Usage: "Route the hostnames listed in the file too. A .json file holds a list of hostnames, or of objects with " +
+			`"hostname", "ttl" and "proxied". Other files are CSV with a hostname, and optionally a TTL and a proxied status, per line.`,
+	}
+)
+
+// dnsHostname is a hostname to route with the settings of its record.
+type dnsHostname struct {
+	Hostname string `json:"hostname"`
+	cfapi.DNSRecordOptions
+}
+
+// UnmarshalJSON accepts a bare hostname too.
+func (h *dnsHostname) UnmarshalJSON(data []byte) error {
+	var hostname string
+	if err := json.Unmarshal(data, &hostname); err == nil {
+		*h = dnsHostname{Hostname: hostname}
+		return nil
+	}
+	type plain dnsHostname
+	return json.Unmarshal(data, (*plain)(h))
+}
+
+// dnsRoutesFromArgs returns the DNS routes of the hostnames given as arguments, after the tunnel, and in the
+// hostnames file. The record settings of the flags apply to the hostnames that don't set their own.
+func dnsRoutesFromArgs(c *cli.Context, overwriteExisting bool) ([]cfapi.HostnameRoute, error) {
+	defaults := cfapi.DNSRecordOptions{TTL: c.Int(dnsTTLFlag.Name)}
+	if c.IsSet(dnsProxiedFlag.Name) {
+		proxied := c.Bool(dnsProxiedFlag.Name)
+		defaults.Proxied = &proxied
+	}
+
+	var hostnames []dnsHostname
+	for _, hostname := range c.Args().Tail() {
+		hostnames = append(hostnames, dnsHostname{Hostname: hostname})
+	}
+	if path := c.String(dnsHostnamesFileFlag.Name); path != "" {
+		fromFile, err := readHostnamesFile(path)
+		if err != nil {
+			return nil, err
+		}
+		hostnames = append(hostnames, fromFile...)
+	}
+	if len(hostnames) == 0 {
+		return nil, cliutil.UsageError("The hostnames to route should be given after the tunnel or with --%s", dnsHostnamesFileFlag.Name)
+	}
+
+	routes := make([]cfapi.HostnameRoute, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		if !validateHostname(hostname.Hostname, true) {
+			return nil, errors.Errorf("%s is not a valid hostname", hostname.Hostname)
+		}
+		options := hostname.DNSRecordOptions
+		if options.TTL == 0 {
+			options.TTL = defaults.TTL
+		}
+		if options.Proxied == nil {
+			options.Proxied = defaults.Proxied
+		}
+		if options.TTL < 0 {
+			return nil, errors.Errorf("the TTL of %s can't be negative", hostname.Hostname)
+		}
+		routes = append(routes, cfapi.NewDNSRouteWithOptions(hostname.Hostname, overwriteExisting, options))
+	}
+	return routes, nil
+}
+
+func readHostnamesFile(path string) ([]dnsHostname, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the hostnames file")
+	}
+	defer file.Close()
+	var hostnames []dnsHostname
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.NewDecoder(file).Decode(&hostnames)
+	} else {
+		hostnames, err = parseHostnamesCSV(file)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the hostnames file %s", path)
+	}
+	return hostnames, nil
+}
+
+// parseHostnamesCSV parses lines of hostname[,ttl[,proxied]], a first line with the "hostname" header is skipped.
+func parseHostnamesCSV(r io.Reader) ([]dnsHostname, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var hostnames []dnsHostname
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "hostname") {
+			continue
+		}
+		if len(record) > 3 {
+			return nil, errors.Errorf("line %d has %d fields, expected hostname[,ttl[,proxied]]", i+1, len(record))
+		}
+		hostname := dnsHostname{Hostname: strings.TrimSpace(record[0])}
+		if hostname.Hostname == "" {
+			continue
+		}
+		if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+			if hostname.TTL, err = strconv.Atoi(strings.TrimSpace(record[1])); err != nil {
+				return nil, errors.Errorf("line %d: invalid TTL %s", i+1, record[1])
+			}
+		}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			proxied, err := strconv.ParseBool(strings.TrimSpace(record[2]))
+			if err != nil {
+				return nil, errors.Errorf("line %d: invalid proxied status %s", i+1, record[2])
+			}
+			hostname.Proxied = &proxied
+		}
+		hostnames = append(hostnames, hostname)
+	}
+	return hostnames, nil
+}
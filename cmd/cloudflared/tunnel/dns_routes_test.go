@@ -0,0 +1,70 @@
+package tunnel
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+func TestParseHostnamesCSV(t *testing.T) {
+	hostnames, err := parseHostnamesCSV(strings.NewReader(`hostname,ttl,proxied
+app.example.com
+# the API is DNS only
+api.example.com, 300, false
+www.example.com,,true
+`))
+	require.NoError(t, err)
+	require.Len(t, hostnames, 3)
+	assert.Equal(t, dnsHostname{Hostname: "app.example.com"}, hostnames[0])
+	assert.Equal(t, "api.example.com", hostnames[1].Hostname)
+	assert.Equal(t, 300, hostnames[1].TTL)
+	assert.False(t, *hostnames[1].Proxied)
+	assert.Zero(t, hostnames[2].TTL)
+	assert.True(t, *hostnames[2].Proxied)
+
+	for _, invalid := range []string{"app.example.com,abc", "app.example.com,300,maybe", "app.example.com,300,true,extra"} {
+		_, err := parseHostnamesCSV(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDNSRoutesFromArgs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hostnames.json")
+	require.NoError(t, os.WriteFile(path, []byte(`["www.example.com", {"hostname": "api.example.com", "ttl": 60, "proxied": true}]`), 0600))
+
+	flagSet := flag.NewFlagSet("dns", flag.PanicOnError)
+	flagSet.Int(dnsTTLFlag.Name, 0, "")
+	flagSet.Bool(dnsProxiedFlag.Name, false, "")
+	flagSet.String(dnsHostnamesFileFlag.Name, "", "")
+	require.NoError(t, flagSet.Parse([]string{"--ttl", "300", "--proxied=false", "--hostnames-file", path, "my-tunnel", "app.example.com"}))
+	c := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+	routes, err := dnsRoutesFromArgs(c, true)
+	require.NoError(t, err)
+	proxied, notProxied := true, false
+	expected := []*cfapi.DNSRoute{
+		cfapi.NewDNSRouteWithOptions("app.example.com", true, cfapi.DNSRecordOptions{TTL: 300, Proxied: &notProxied}).(*cfapi.DNSRoute),
+		cfapi.NewDNSRouteWithOptions("www.example.com", true, cfapi.DNSRecordOptions{TTL: 300, Proxied: &notProxied}).(*cfapi.DNSRoute),
+		// The settings of the file take precedence over the flags
+		cfapi.NewDNSRouteWithOptions("api.example.com", true, cfapi.DNSRecordOptions{TTL: 60, Proxied: &proxied}).(*cfapi.DNSRoute),
+	}
+	require.Len(t, routes, len(expected))
+	for i, route := range routes {
+		assert.Equal(t, expected[i].Hostname(), route.(*cfapi.DNSRoute).Hostname())
+		assert.Equal(t, expected[i].RecordOptions(), route.(*cfapi.DNSRoute).RecordOptions())
+	}
+
+	flagSet = flag.NewFlagSet("dns", flag.PanicOnError)
+	flagSet.String(dnsHostnamesFileFlag.Name, "", "")
+	require.NoError(t, flagSet.Parse([]string{"my-tunnel", "not a hostname"}))
+	_, err = dnsRoutesFromArgs(cli.NewContext(cli.NewApp(), flagSet, nil), false)
+	assert.Error(t, err)
+}
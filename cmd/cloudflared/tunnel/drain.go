@@ -0,0 +1,112 @@
+package tunnel
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/proxy"
+)
+
+// drainer reports how much traffic is left to drain during a graceful shutdown, after cutting the traffic classes
+// that shouldn't hold the shutdown, e.g. long lived UDP sessions.
+type drainer struct {
+	flows    []*flow.Table
+	cut      []flow.Protocol
+	interval time.Duration
+	log      *zerolog.Logger
+	// inFlightHTTP returns the HTTP requests being proxied, it is a function so that tests don't depend on the proxy
+	inFlightHTTP func() int64
+}
+
+// drainProgress is the traffic left to drain.
+type drainProgress struct {
+	httpRequests int64
+	tcpFlows     int
+	udpSessions  int
+}
+
+func (p drainProgress) done() bool {
+	return p.httpRequests == 0 && p.tcpFlows == 0 && p.udpSessions == 0
+}
+
+func newDrainer(running []*runningTunnel, cut []string, interval time.Duration, log *zerolog.Logger) (*drainer, error) {
+	d := &drainer{interval: interval, log: log, inFlightHTTP: proxy.InFlightHTTPRequests}
+	for _, class := range cut {
+		switch protocol := flow.Protocol(class); protocol {
+		case flow.TCP, flow.UDP:
+			d.cut = append(d.cut, protocol)
+		case "http":
+			return nil, cliutil.UsageError("--%s doesn't accept http, set --grace-period to 0 to stop without draining the HTTP requests", drainCutFlag)
+		default:
+			return nil, cliutil.UsageError("--%s only accepts tcp and udp, not %q", drainCutFlag, class)
+		}
+	}
+	for _, rt := range running {
+		d.flows = append(d.flows, rt.tunnelConfig.Flows)
+	}
+	return d, nil
+}
+
+// run waits for the graceful shutdown to start, cuts the traffic that isn't drained, then reports the traffic left
+// every interval until the shutdown is over.
+func (d *drainer) run(ctx context.Context, graceShutdownC <-chan struct{}) {
+	select {
+	case <-graceShutdownC:
+	case <-ctx.Done():
+		return
+	}
+	for _, protocol := range d.cut {
+		cut := 0
+		for _, flows := range d.flows {
+			cut += flows.Cut(protocol)
+		}
+		if cut > 0 {
+			d.log.Info().Int("flows", cut).Msgf("Cut the %s flows instead of draining them", protocol)
+		}
+	}
+	progress := d.progress()
+	if progress.done() {
+		d.log.Info().Msg("No in-flight traffic to drain")
+		return
+	}
+	d.report(progress)
+	if d.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			progress := d.progress()
+			if progress.done() {
+				d.log.Info().Msg("All in-flight traffic drained")
+				return
+			}
+			d.report(progress)
+		}
+	}
+}
+
+func (d *drainer) progress() drainProgress {
+	progress := drainProgress{httpRequests: d.inFlightHTTP()}
+	for _, flows := range d.flows {
+		progress.tcpFlows += flows.Count(flow.TCP)
+		progress.udpSessions += flows.Count(flow.UDP)
+	}
+	return progress
+}
+
+func (d *drainer) report(progress drainProgress) {
+	d.log.Info().
+		Int64("httpRequests", progress.httpRequests).
+		Int("tcpFlows", progress.tcpFlows).
+		Int("udpSessions", progress.udpSessions).
+		Msgf("Draining %d HTTP requests, %d TCP flows and %d UDP sessions", progress.httpRequests, progress.tcpFlows, progress.udpSessions)
+}
@@ -0,0 +1,56 @@
+package tunnel
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/supervisor"
+)
+
+func TestDrainer(t *testing.T) {
+	log := zerolog.Nop()
+	flows := flow.NewTable()
+	running := []*runningTunnel{{tunnelConfig: &supervisor.TunnelConfig{Flows: flows}}}
+
+	_, err := newDrainer(running, []string{"http"}, time.Second, &log)
+	assert.Error(t, err)
+	_, err = newDrainer(running, []string{"icmp"}, time.Second, &log)
+	assert.Error(t, err)
+	d, err := newDrainer(running, []string{"udp"}, 10*time.Millisecond, &log)
+	require.NoError(t, err)
+	var httpRequests atomic.Int64
+	httpRequests.Store(1)
+	d.inFlightHTTP = httpRequests.Load
+
+	tcpFlow := flows.Open(flow.TCP, "", "", "localhost:80", 0)
+	tcpFlow.OnCut(tcpFlow.Close)
+	udpFlow := flows.Open(flow.UDP, "session", "127.0.0.1:5000", "1.1.1.1:53", 0)
+	udpFlow.OnCut(udpFlow.Close)
+	assert.Equal(t, drainProgress{httpRequests: 1, tcpFlows: 1, udpSessions: 1}, d.progress())
+
+	graceShutdownC := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.run(context.Background(), graceShutdownC)
+	}()
+	close(graceShutdownC)
+
+	// The UDP sessions are cut right away while the rest is drained
+	require.Eventually(t, func() bool { return flows.Count(flow.UDP) == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, flows.Count(flow.TCP))
+	httpRequests.Store(0)
+	tcpFlow.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the drainer didn't stop once all the traffic was drained")
+	}
+}
@@ -0,0 +1,96 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+var dryRunFlag = &cli.BoolFlag{
+	Name:  "dry-run",
+	Usage: "List the resources that would be deleted without deleting anything.",
+}
+
+const (
+	resourceTunnel          = "tunnel"
+	resourceConnector       = "connector"
+	resourceIPRoute         = "ip route"
+	resourceCredentialsFile = "credentials file"
+	resourceDNSRecord       = "DNS record"
+)
+
+// affectedResource is a resource that a destructive command would delete.
+type affectedResource struct {
+	Kind        string     `json:"kind"`
+	ID          string     `json:"id"`
+	Description string     `json:"description,omitempty"`
+	TunnelID    *uuid.UUID `json:"tunnel_id,omitempty"`
+}
+
+// renderDryRun prints the resources a command would delete, in the output format if one is set.
+func renderDryRun(c *cli.Context, resources []affectedResource) error {
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		if resources == nil {
+			resources = []affectedResource{}
+		}
+		return renderOutput(outputFormat, resources)
+	}
+	printAffectedResources(os.Stdout, resources)
+	return nil
+}
+
+func printAffectedResources(w io.Writer, resources []affectedResource) {
+	if len(resources) == 0 {
+		_, _ = fmt.Fprintln(w, "Nothing would be deleted.")
+		return
+	}
+	_, _ = fmt.Fprintln(w, "The following would be deleted (dry run, nothing was changed):")
+	for _, resource := range resources {
+		line := fmt.Sprintf("- %s %s", resource.Kind, resource.ID)
+		if resource.Description != "" {
+			line += " (" + resource.Description + ")"
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
+
+func connectorResource(tunnelID uuid.UUID, client *cfapi.ActiveClient) affectedResource {
+	details := []string{fmt.Sprintf("%d connections", len(client.Connections))}
+	if len(client.Connections) > 0 {
+		details = append(details, "from "+client.Connections[0].OriginIP.String())
+	}
+	if client.Version != "" {
+		details = append(details, "version "+client.Version)
+	}
+	return affectedResource{
+		Kind:        resourceConnector,
+		ID:          client.ID.String(),
+		Description: strings.Join(details, ", "),
+		TunnelID:    &tunnelID,
+	}
+}
+
+func routeResource(route *cfapi.DetailedRoute) affectedResource {
+	tunnelID := route.TunnelID
+	return affectedResource{
+		Kind:        resourceIPRoute,
+		ID:          route.ID.String(),
+		Description: route.Network.String(),
+		TunnelID:    &tunnelID,
+	}
+}
+
+func dnsRecordResource(tunnelID uuid.UUID, record *cfapi.DNSRecord) affectedResource {
+	return affectedResource{
+		Kind:        resourceDNSRecord,
+		ID:          record.ID,
+		Description: fmt.Sprintf("%s CNAME %s in zone %s", record.Name, record.Content, record.ZoneName),
+		TunnelID:    &tunnelID,
+	}
+}
@@ -0,0 +1,212 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/diagnostic"
+	"github.com/cloudflare/cloudflared/orchestration"
+)
+
+const redactedSettingValue = "REDACTED"
+
+// effectiveSettings returns the value of every flag of the command and where it comes from. A flag takes its value
+// from the command line args over the environment, and from the environment over the configuration file. The string
+// values of the flags that aren't known to be free of secrets are redacted.
+func effectiveSettings(c *cli.Context, args []string, lookupEnv func(string) (string, bool)) map[string]diagnostic.EffectiveSetting {
+	settings := make(map[string]diagnostic.EffectiveSetting)
+	for _, ctx := range c.Lineage() {
+		if ctx.Command == nil {
+			continue
+		}
+		flags := ctx.Command.Flags
+		if ctx.Command.Name == "" && ctx.App != nil {
+			flags = ctx.App.Flags
+		}
+		for _, flag := range flags {
+			names := flag.Names()
+			if _, ok := settings[names[0]]; ok {
+				continue
+			}
+			source := settingSource(c, flag, args, lookupEnv)
+			value := settingValue(c.Value(names[0]))
+			if source != diagnostic.SourceDefault && !slices.Contains(nonSecretFlagsList, names[0]) {
+				value = redactSetting(value)
+			}
+			settings[names[0]] = diagnostic.EffectiveSetting{Value: value, Source: source}
+		}
+	}
+	return settings
+}
+
+func settingSource(c *cli.Context, flag cli.Flag, args []string, lookupEnv func(string) (string, bool)) string {
+	names := flag.Names()
+	switch {
+	case onCommandLine(args, names):
+		return diagnostic.SourceFlag
+	case inEnvironment(flagEnvVars(flag), lookupEnv):
+		return diagnostic.SourceEnvironment
+	case config.IsSetInFile(names[0]):
+		return diagnostic.SourceFile
+	case c.IsSet(names[0]):
+		return diagnostic.SourceFlag
+	default:
+		return diagnostic.SourceDefault
+	}
+}
+
+// onCommandLine returns whether the args, up to the terminating "--", set the flag with one of its names.
+func onCommandLine(args []string, names []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if slices.Contains(names, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func inEnvironment(envVars []string, lookupEnv func(string) (string, bool)) bool {
+	for _, envVar := range envVars {
+		if _, ok := lookupEnv(envVar); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// flagEnvVars returns the environment variables of the flag. The flags don't expose them in an interface, so they are
+// read from the EnvVars field of the flag, which the altsrc flags embed.
+func flagEnvVars(flag cli.Flag) []string {
+	v := reflect.ValueOf(flag)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	field := v.FieldByName("EnvVars")
+	if !field.IsValid() {
+		return nil
+	}
+	envVars, _ := field.Interface().([]string)
+	return envVars
+}
+
+// settingValue returns the value of a flag in a form that encodes to JSON as it is written on the command line.
+func settingValue(value any) any {
+	switch v := value.(type) {
+	case cli.StringSlice:
+		return v.Value()
+	case cli.IntSlice:
+		return v.Value()
+	case cli.Int64Slice:
+		return v.Value()
+	case cli.Float64Slice:
+		return v.Value()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func redactSetting(value any) any {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return redactedSettingValue
+		}
+	case []string:
+		if len(v) > 0 {
+			return []string{redactedSettingValue}
+		}
+	}
+	return value
+}
+
+// localConfigurationSources are the sources of the sections of the configuration of a tunnel before a remote
+// configuration is applied.
+type localConfigurationSources struct {
+	ingress       string
+	warpRouting   string
+	originRequest string
+}
+
+func newLocalConfigurationSources(conf *config.Configuration) localConfigurationSources {
+	sources := localConfigurationSources{
+		ingress:       diagnostic.SourceFlag,
+		warpRouting:   diagnostic.SourceDefault,
+		originRequest: diagnostic.SourceFlag,
+	}
+	if conf == nil {
+		return sources
+	}
+	if len(conf.Ingress) > 0 {
+		sources.ingress = diagnostic.SourceFile
+	}
+	if !reflect.ValueOf(conf.WarpRouting).IsZero() {
+		sources.warpRouting = diagnostic.SourceFile
+	}
+	if !reflect.ValueOf(conf.OriginRequest).IsZero() {
+		sources.originRequest = diagnostic.SourceFile
+	}
+	return sources
+}
+
+// effectiveConfiguration returns the function reporting the configuration the tunnel of the orchestrator runs with,
+// its ingress being the one of the remote configuration once one is applied.
+func effectiveConfiguration(
+	settings map[string]diagnostic.EffectiveSetting,
+	local localConfigurationSources,
+	orchestrator *orchestration.Orchestrator,
+) func() (*diagnostic.EffectiveConfiguration, error) {
+	return func() (*diagnostic.EffectiveConfiguration, error) {
+		versioned, err := orchestrator.GetVersionedConfigJSON()
+		if err != nil {
+			return nil, err
+		}
+		var current struct {
+			Version int32 `json:"version"`
+			Config  struct {
+				Ingress       json.RawMessage `json:"ingress"`
+				WarpRouting   json.RawMessage `json:"warp-routing"`
+				OriginRequest json.RawMessage `json:"originRequest"`
+			} `json:"config"`
+		}
+		if err := json.Unmarshal(versioned, &current); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the configuration of the orchestrator")
+		}
+		sources := local
+		if current.Version >= 0 {
+			sources = localConfigurationSources{
+				ingress:       diagnostic.SourceRemote,
+				warpRouting:   diagnostic.SourceRemote,
+				originRequest: diagnostic.SourceRemote,
+			}
+		}
+		return &diagnostic.EffectiveConfiguration{
+			Version:       current.Version,
+			Settings:      settings,
+			Ingress:       diagnostic.EffectiveSetting{Value: current.Config.Ingress, Source: sources.ingress},
+			WarpRouting:   diagnostic.EffectiveSetting{Value: current.Config.WarpRouting, Source: sources.warpRouting},
+			OriginRequest: diagnostic.EffectiveSetting{Value: current.Config.OriginRequest, Source: sources.originRequest},
+		}, nil
+	}
+}
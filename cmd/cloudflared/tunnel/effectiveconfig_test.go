@@ -0,0 +1,61 @@
+package tunnel
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/diagnostic"
+)
+
+func TestEffectiveSettings(t *testing.T) {
+	t.Setenv("TEST_EFFECTIVE_PROTOCOL", "http2")
+	t.Setenv("TEST_EFFECTIVE_TOKEN", "secret-token")
+	args := []string{"cloudflared", "--grace-period=10s", "--url", "http://localhost:8080", "--", "--loglevel"}
+	var settings map[string]diagnostic.EffectiveSetting
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.DurationFlag{Name: "grace-period", Value: 30 * time.Second},
+			&cli.StringFlag{Name: "url", Aliases: []string{"u"}},
+			&cli.StringFlag{Name: "protocol", Value: "auto", EnvVars: []string{"TEST_EFFECTIVE_PROTOCOL"}},
+			&cli.StringFlag{Name: "token", EnvVars: []string{"TEST_EFFECTIVE_TOKEN"}},
+			&cli.StringFlag{Name: "loglevel", Value: "info"},
+			&cli.StringSliceFlag{Name: "tag"},
+		},
+		Action: func(c *cli.Context) error {
+			settings = effectiveSettings(c, args[1:], os.LookupEnv)
+			return nil
+		},
+	}
+	require.NoError(t, app.Run(args))
+
+	assert.Equal(t, diagnostic.EffectiveSetting{Value: "10s", Source: diagnostic.SourceFlag}, settings["grace-period"])
+	assert.Equal(t, diagnostic.EffectiveSetting{Value: "http://localhost:8080", Source: diagnostic.SourceFlag}, settings["url"])
+	assert.Equal(t, diagnostic.EffectiveSetting{Value: "http2", Source: diagnostic.SourceEnvironment}, settings["protocol"])
+	assert.Equal(t, diagnostic.EffectiveSetting{Value: redactedSettingValue, Source: diagnostic.SourceEnvironment}, settings["token"])
+	assert.Equal(t, diagnostic.EffectiveSetting{Value: "info", Source: diagnostic.SourceDefault}, settings["loglevel"])
+	assert.Equal(t, diagnostic.EffectiveSetting{Value: []string(nil), Source: diagnostic.SourceDefault}, settings["tag"])
+}
+
+func TestLocalConfigurationSources(t *testing.T) {
+	assert.Equal(t, localConfigurationSources{
+		ingress:       diagnostic.SourceFlag,
+		warpRouting:   diagnostic.SourceDefault,
+		originRequest: diagnostic.SourceFlag,
+	}, newLocalConfigurationSources(nil))
+
+	noTLSVerify := true
+	assert.Equal(t, localConfigurationSources{
+		ingress:       diagnostic.SourceFile,
+		warpRouting:   diagnostic.SourceDefault,
+		originRequest: diagnostic.SourceFile,
+	}, newLocalConfigurationSources(&config.Configuration{
+		Ingress:       []config.UnvalidatedIngressRule{{Service: "http_status:404"}},
+		OriginRequest: config.OriginRequestConfig{NoTLSVerify: &noTLSVerify},
+	}))
+}
@@ -0,0 +1,180 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+	"golang.org/x/term"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/secretstore"
+)
+
+// credentialsPassphraseEnv holds the passphrase of encrypted credentials files, for services that can't be prompted
+const credentialsPassphraseEnv = "TUNNEL_CRED_PASSPHRASE"
+
+var (
+	encryptCredentialsFlag = &cli.StringFlag{
+		Name:    "encrypt-credentials",
+		Usage:   "Encrypt the tunnel credentials file with `KEY`: passphrase, tpm to seal it to the TPM of this machine, or an AWS KMS key as awskms://<key ID, ARN or alias>?region=<region>",
+		EnvVars: []string{"TUNNEL_ENCRYPT_CREDENTIALS"},
+	}
+	credentialsPassphraseFileFlag = altsrc.NewStringFlag(&cli.StringFlag{
+		Name:    "credentials-passphrase-file",
+		Usage:   "Read the passphrase of the encrypted tunnel credentials file from `FILE`. The passphrase can also be set with " + credentialsPassphraseEnv + ", it's prompted for otherwise",
+		EnvVars: []string{"TUNNEL_CRED_PASSPHRASE_FILE"},
+	})
+	encryptionKeyFlag = &cli.StringFlag{
+		Name:  "key",
+		Usage: "Encrypt with `KEY`: passphrase, tpm to seal it to the TPM of this machine, or an AWS KMS key as awskms://<key ID, ARN or alias>?region=<region>",
+		Value: secretstore.PassphraseKey,
+	}
+)
+
+// validateEncryptionKey checks the key of --encrypt-credentials before the tunnel is changed.
+func validateEncryptionKey(c *cli.Context) error {
+	if key := c.String(encryptCredentialsFlag.Name); key != "" && !secretstore.IsEncryptionKey(key) {
+		return cliutil.UsageError("--%s should be %s, %s or awskms://<key>, got %q", encryptCredentialsFlag.Name, secretstore.PassphraseKey, secretstore.TPMKey, key)
+	}
+	return nil
+}
+
+// encodeCredentials returns the JSON of the credentials file, encrypted if --encrypt-credentials is set.
+func (sc *subcommandContext) encodeCredentials(credentials *connection.Credentials) ([]byte, error) {
+	body, err := json.Marshal(credentials)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to marshal tunnel credentials to JSON")
+	}
+	key := sc.c.String(encryptCredentialsFlag.Name)
+	if key == "" {
+		return body, nil
+	}
+	body, err = secretstore.Encrypt(sc.c.Context, body, key, sc.passphrase)
+	return body, errors.Wrap(err, "Unable to encrypt tunnel credentials")
+}
+
+// decryptCredentials returns the JSON of the credentials file, decrypting it if it's encrypted.
+func (sc *subcommandContext) decryptCredentials(body []byte) ([]byte, error) {
+	if !secretstore.IsEncrypted(body) {
+		return body, nil
+	}
+	return secretstore.Decrypt(sc.c.Context, body, sc.passphrase)
+}
+
+// passphrase returns the passphrase of the credentials file from the environment, the passphrase file, or the
+// terminal. It's only prompted for once.
+func (sc *subcommandContext) passphrase(confirm bool) (string, error) {
+	if sc.credentialsPassphrase != "" {
+		return sc.credentialsPassphrase, nil
+	}
+	passphrase := os.Getenv(credentialsPassphraseEnv)
+	if path := sc.c.String(credentialsPassphraseFileFlag.Name); passphrase == "" && path != "" {
+		path, err := homedir.Expand(path)
+		if err != nil {
+			return "", err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrap(err, "couldn't read the credentials passphrase file")
+		}
+		passphrase = strings.TrimRight(string(content), "\r\n")
+	}
+	if passphrase == "" {
+		var err error
+		if passphrase, err = promptPassphrase(confirm); err != nil {
+			return "", err
+		}
+	}
+	sc.credentialsPassphrase = passphrase
+	return passphrase, nil
+}
+
+func promptPassphrase(confirm bool) (string, error) {
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		return "", fmt.Errorf("the tunnel credentials are encrypted with a passphrase, set it with %s or --%s", credentialsPassphraseEnv, credentialsPassphraseFileFlag.Name)
+	}
+	fmt.Fprint(os.Stderr, "Passphrase of the tunnel credentials: ")
+	passphrase, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm the passphrase: ")
+		confirmation, err := term.ReadPassword(stdin)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(confirmation) != string(passphrase) {
+			return "", errors.New("the passphrases don't match")
+		}
+	}
+	return string(passphrase), nil
+}
+
+func buildEncryptCredentialsCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "encrypt-credentials",
+		Action:    cliutil.ConfiguredAction(encryptCredentialsCommand),
+		Usage:     "Encrypt an existing tunnel credentials file",
+		UsageText: "cloudflared tunnel [tunnel command options] encrypt-credentials [subcommand options] FILE",
+		Description: `Encrypts the tunnel credentials file in place, "cloudflared tunnel run" decrypts it at startup. The file is
+  encrypted with a key derived from a passphrase, which is read from ` + credentialsPassphraseEnv + `, --credentials-passphrase-file or the terminal,
+  with a data key sealed to the TPM of the machine with --key tpm, which only this machine can decrypt,
+  or with a data key of an AWS KMS key, which is decrypted with the AWS credentials of the host:
+
+  $ cloudflared tunnel encrypt-credentials --key awskms://alias/cloudflared?region=eu-west-1 ~/.cloudflared/<tunnel ID>.json
+
+  Use --encrypt-credentials with "cloudflared tunnel create" to encrypt the credentials file of a new tunnel.`,
+		Flags:              []cli.Flag{encryptionKeyFlag, credentialsPassphraseFileFlag},
+		CustomHelpTemplate: commandHelpTemplate(),
+	}
+}
+
+func encryptCredentialsCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() != 1 {
+		return cliutil.UsageError(`"cloudflared tunnel encrypt-credentials" requires exactly 1 argument, the path of the credentials file to encrypt.`)
+	}
+	path, err := homedir.Expand(c.Args().First())
+	if err != nil {
+		return err
+	}
+	key := c.String(encryptionKeyFlag.Name)
+	if !secretstore.IsEncryptionKey(key) {
+		return cliutil.UsageError("--%s should be %s, %s or awskms://<key>, got %q", encryptionKeyFlag.Name, secretstore.PassphraseKey, secretstore.TPMKey, key)
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read tunnel credentials from %v", path)
+	}
+	if secretstore.IsEncrypted(body) {
+		return fmt.Errorf("%s is already encrypted", path)
+	}
+	var credentials connection.Credentials
+	if err := json.Unmarshal(body, &credentials); err != nil || credentials.TunnelSecret == nil {
+		return errInvalidJSONCredential{path: path, err: err}
+	}
+	encrypted, err := secretstore.Encrypt(c.Context, body, key, sc.passphrase)
+	if err != nil {
+		return errors.Wrap(err, "Unable to encrypt tunnel credentials")
+	}
+	if err := replaceTunnelCredentials(path, encrypted); err != nil {
+		return errors.Wrapf(err, "couldn't write the encrypted tunnel credentials to %v", path)
+	}
+	fmt.Printf("Encrypted the tunnel credentials in %s\n", path)
+	return nil
+}
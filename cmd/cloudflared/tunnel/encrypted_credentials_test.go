@@ -0,0 +1,48 @@
+package tunnel
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/secretstore"
+)
+
+func TestEncryptedCredentialsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	passphraseFile := filepath.Join(dir, "passphrase")
+	require.NoError(t, os.WriteFile(passphraseFile, []byte("correct horse\n"), 0600))
+	credentialsPath := filepath.Join(dir, "credentials.json")
+	log := zerolog.Nop()
+
+	newContext := func() *subcommandContext {
+		flagSet := flag.NewFlagSet("encrypted", flag.PanicOnError)
+		flagSet.String(encryptCredentialsFlag.Name, secretstore.PassphraseKey, "")
+		flagSet.String(credentialsPassphraseFileFlag.Name, passphraseFile, "")
+		flagSet.String(CredFileFlag, credentialsPath, "")
+		flagSet.String(CredContentsFlag, "", "")
+		return &subcommandContext{c: cli.NewContext(cli.NewApp(), flagSet, nil), log: &log, fs: realFileSystem{}}
+	}
+
+	credentials := connection.Credentials{AccountTag: "account", TunnelSecret: []byte("0123456789abcdef0123456789abcdef"), TunnelID: uuid.New()}
+	body, err := newContext().encodeCredentials(&credentials)
+	require.NoError(t, err)
+	assert.True(t, secretstore.IsEncrypted(body))
+	require.NoError(t, writeTunnelCredentials(credentialsPath, body))
+
+	found, err := newContext().findCredentials(credentials.TunnelID)
+	require.NoError(t, err)
+	assert.Equal(t, credentials, found)
+
+	t.Setenv(credentialsPassphraseEnv, "battery staple")
+	_, err = newContext().findCredentials(credentials.TunnelID)
+	assert.ErrorIs(t, err, secretstore.ErrWrongPassphrase)
+}
@@ -0,0 +1,32 @@
+package tunnel
+
+import (
+	"fmt"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+// serviceEventLogSink writes the connections of a tunnel registered with and lost from the edge to the event log of
+// the service cloudflared runs as.
+type serviceEventLogSink struct {
+	eventLog   logger.EventLog
+	tunnelName string
+}
+
+func (s serviceEventLogSink) OnTunnelEvent(event connection.Event) {
+	switch event.EventType {
+	case connection.Connected:
+		_ = s.eventLog.Info(logger.EventIDConnectionRegistered, fmt.Sprintf("%sconnection %d registered with %s using %s",
+			s.prefix(), event.Index, event.Location, event.Protocol))
+	case connection.Disconnected:
+		_ = s.eventLog.Warning(logger.EventIDConnectionLost, fmt.Sprintf("%sconnection %d lost", s.prefix(), event.Index))
+	}
+}
+
+func (s serviceEventLogSink) prefix() string {
+	if s.tunnelName == "" {
+		return ""
+	}
+	return fmt.Sprintf("tunnel %s: ", s.tunnelName)
+}
@@ -0,0 +1,196 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+const (
+	eventWebhookFlag = "event-webhook"
+	eventHookFlag    = "event-hook"
+
+	eventConnected        = "connected"
+	eventDisconnected     = "disconnected"
+	eventProtocolFallback = "protocol-fallback"
+	eventConfigUpdated    = "config-updated"
+
+	// eventQueueSize is the number of events waiting to be delivered, the new events are dropped once it is reached
+	eventQueueSize = 64
+	// defaultEventTimeout bounds the delivery of an event when --hook-timeout is 0, so that an unresponsive webhook
+	// doesn't hold back all the following events
+	defaultEventTimeout = 30 * time.Second
+)
+
+// tunnelEvent is posted as JSON to the --event-webhook, and written to the stdin of the --event-hook command.
+type tunnelEvent struct {
+	Event         string    `json:"event"`
+	Time          time.Time `json:"time"`
+	TunnelID      uuid.UUID `json:"tunnelID"`
+	ConnIndex     *uint8    `json:"connIndex,omitempty"`
+	Protocol      string    `json:"protocol,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	EdgeAddress   string    `json:"edgeAddress,omitempty"`
+	ConfigVersion *int32    `json:"configVersion,omitempty"`
+}
+
+// eventHooks pushes the connections and configuration updates of a tunnel to a webhook and a command, so that
+// monitoring systems don't have to poll the metrics or scrape the logs. The events are delivered in order by a
+// single goroutine, a failed delivery is only logged.
+type eventHooks struct {
+	tunnelID  uuid.UUID
+	webhook   string
+	hook      string
+	timeout   time.Duration
+	userAgent string
+	client    *http.Client
+	log       *zerolog.Logger
+	events    chan tunnelEvent
+
+	// connected are the indexes of the connections that are up, so that a connection failing to connect again
+	// isn't reported as disconnected on every retry. It is only used by OnTunnelEvent, which the observer calls
+	// from a single goroutine.
+	connected map[uint8]bool
+}
+
+// newEventHooks returns the event hooks of the tunnel, nil if neither --event-webhook nor --event-hook is set. The
+// events are delivered until ctx is done.
+func newEventHooks(ctx context.Context, c *cli.Context, tunnelID uuid.UUID, userAgent string, log *zerolog.Logger) *eventHooks {
+	webhook, hook := c.String(eventWebhookFlag), c.String(eventHookFlag)
+	if webhook == "" && hook == "" {
+		return nil
+	}
+	timeout := c.Duration(hookTimeoutFlag)
+	if timeout <= 0 {
+		timeout = defaultEventTimeout
+	}
+	h := &eventHooks{
+		tunnelID:  tunnelID,
+		webhook:   webhook,
+		hook:      hook,
+		timeout:   timeout,
+		userAgent: userAgent,
+		client:    &http.Client{},
+		log:       log,
+		events:    make(chan tunnelEvent, eventQueueSize),
+		connected: make(map[uint8]bool),
+	}
+	go h.deliver(ctx)
+	return h
+}
+
+// OnTunnelEvent reports the connections going up and down, and switching to the fallback protocol.
+func (h *eventHooks) OnTunnelEvent(event connection.Event) {
+	index := event.Index
+	e := tunnelEvent{ConnIndex: &index}
+	switch event.EventType {
+	case connection.Connected:
+		h.connected[index] = true
+		e.Event = eventConnected
+		e.Protocol = event.Protocol.String()
+		e.Location = event.Location
+		if event.EdgeAddress != nil {
+			e.EdgeAddress = event.EdgeAddress.String()
+		}
+	case connection.Disconnected, connection.Reconnecting:
+		if !h.connected[index] {
+			return
+		}
+		delete(h.connected, index)
+		e.Event = eventDisconnected
+	case connection.ProtocolFallback:
+		e.Event = eventProtocolFallback
+		e.Protocol = event.Protocol.String()
+	default:
+		return
+	}
+	h.send(e)
+}
+
+// Reloading is a no-op, only the configurations that were applied are reported.
+func (h *eventHooks) Reloading(int32) {}
+
+// Reloaded reports that the remote configuration was updated to version.
+func (h *eventHooks) Reloaded(version int32) {
+	h.send(tunnelEvent{Event: eventConfigUpdated, ConfigVersion: &version})
+}
+
+func (h *eventHooks) send(e tunnelEvent) {
+	e.Time = time.Now().UTC()
+	e.TunnelID = h.tunnelID
+	select {
+	case h.events <- e:
+	default:
+		h.log.Warn().Str("event", e.Event).Msg("Dropped the tunnel event, the event hooks are too slow to deliver them")
+	}
+}
+
+func (h *eventHooks) deliver(ctx context.Context) {
+	for {
+		select {
+		case e := <-h.events:
+			body, err := json.Marshal(e)
+			if err != nil {
+				h.log.Err(err).Msg("Failed to encode the tunnel event")
+				continue
+			}
+			if h.webhook != "" {
+				if err := h.post(ctx, body); err != nil {
+					h.log.Err(err).Str("event", e.Event).Msgf("Failed to send the tunnel event to the --%s", eventWebhookFlag)
+				}
+			}
+			if h.hook != "" {
+				h.exec(ctx, e.Event, body)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *eventHooks) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", h.userAgent)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// exec runs the hook with the event on its stdin, $TUNNEL_HOOK_EVENT is the name of the event.
+func (h *eventHooks) exec(ctx context.Context, event string, body []byte) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	cmd, err := hookCmd(ctx, h.hook, event, []string{h.tunnelID.String()})
+	if err != nil {
+		h.log.Err(err).Msgf("The --%s command is not valid", eventHookFlag)
+		return
+	}
+	if cmd == nil {
+		return
+	}
+	cmd.Stdin = bytes.NewReader(append(body, '\n'))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		h.log.Err(err).Str("event", event).Str("output", string(output)).Msgf("The --%s command failed", eventHookFlag)
+	}
+}
@@ -0,0 +1,91 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+func TestEventHooksWebhook(t *testing.T) {
+	received := make(chan tunnelEvent, eventQueueSize)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var event tunnelEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received <- event
+	}))
+	defer server.Close()
+
+	flagSet := flag.NewFlagSet("events", flag.PanicOnError)
+	flagSet.String(eventWebhookFlag, server.URL, "")
+	flagSet.Duration(hookTimeoutFlag, time.Second, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := zerolog.Nop()
+	tunnelID := uuid.New()
+	hooks := newEventHooks(ctx, cli.NewContext(cli.NewApp(), flagSet, nil), tunnelID, "cloudflared/test", &log)
+	require.NotNil(t, hooks)
+
+	// A connection failing before it connected isn't reported as disconnected
+	hooks.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Reconnecting})
+	hooks.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.ProtocolFallback, Protocol: connection.HTTP2})
+	hooks.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Connected, Protocol: connection.HTTP2, Location: "lis01", EdgeAddress: net.IPv4(198, 41, 200, 1)})
+	hooks.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Unregistering})
+	hooks.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Disconnected})
+	hooks.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Reconnecting})
+	hooks.Reloading(3)
+	hooks.Reloaded(3)
+
+	expected := []tunnelEvent{
+		{Event: eventProtocolFallback, Protocol: "http2"},
+		{Event: eventConnected, Protocol: "http2", Location: "lis01", EdgeAddress: "198.41.200.1"},
+		{Event: eventDisconnected},
+		{Event: eventConfigUpdated},
+	}
+	for _, e := range expected {
+		select {
+		case event := <-received:
+			assert.Equal(t, e.Event, event.Event)
+			assert.Equal(t, tunnelID, event.TunnelID)
+			assert.Equal(t, e.Protocol, event.Protocol)
+			assert.Equal(t, e.Location, event.Location)
+			assert.Equal(t, e.EdgeAddress, event.EdgeAddress)
+			assert.False(t, event.Time.IsZero())
+			if e.Event == eventConfigUpdated {
+				require.NotNil(t, event.ConfigVersion)
+				assert.Equal(t, int32(3), *event.ConfigVersion)
+				assert.Nil(t, event.ConnIndex)
+			} else {
+				require.NotNil(t, event.ConnIndex)
+				assert.Equal(t, uint8(1), *event.ConnIndex)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the %s event wasn't posted", e.Event)
+		}
+	}
+	select {
+	case event := <-received:
+		t.Fatalf("unexpected %s event", event.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEventHooksDisabled(t *testing.T) {
+	log := zerolog.Nop()
+	c := cli.NewContext(cli.NewApp(), flag.NewFlagSet("events", flag.PanicOnError), nil)
+	assert.Nil(t, newEventHooks(context.Background(), c, uuid.New(), "cloudflared/test", &log))
+}
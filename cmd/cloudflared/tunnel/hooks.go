@@ -0,0 +1,109 @@
+package tunnel
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/shellwords"
+	"github.com/cloudflare/cloudflared/signal"
+)
+
+const (
+	postStartHookFlag = "post-start-hook"
+	preStopHookFlag   = "pre-stop-hook"
+	hookTimeoutFlag   = "hook-timeout"
+	// hookEventEnv and hookTunnelIDsEnv tell the hooks why they are run and for which tunnels
+	hookEventEnv     = "TUNNEL_HOOK_EVENT"
+	hookTunnelIDsEnv = "TUNNEL_IDS"
+
+	hookPostStart = "post-start"
+	hookPreStop   = "pre-stop"
+)
+
+// lifecycleHooks runs user commands once the tunnels are connected and before they shut down, e.g. to register the
+// origin with a service discovery.
+type lifecycleHooks struct {
+	postStart string
+	preStop   string
+	timeout   time.Duration
+	tunnelIDs []string
+	log       *zerolog.Logger
+}
+
+func newLifecycleHooks(c *cli.Context, running []*runningTunnel, log *zerolog.Logger) *lifecycleHooks {
+	tunnelIDs := make([]string, len(running))
+	for i, rt := range running {
+		tunnelIDs[i] = rt.tunnelConfig.NamedTunnel.Credentials.TunnelID.String()
+	}
+	return &lifecycleHooks{
+		postStart: c.String(postStartHookFlag),
+		preStop:   c.String(preStopHookFlag),
+		timeout:   c.Duration(hookTimeoutFlag),
+		tunnelIDs: tunnelIDs,
+		log:       log,
+	}
+}
+
+// run runs the post start hook once connectedSignal is notified. It returns the channel closed to shut the tunnels
+// down, which is graceShutdownC delayed until the pre stop hook completes.
+func (h *lifecycleHooks) run(ctx context.Context, connectedSignal *signal.Signal, graceShutdownC <-chan struct{}) <-chan struct{} {
+	if h.postStart != "" {
+		go func() {
+			select {
+			case <-connectedSignal.Wait():
+				h.exec(ctx, hookPostStart, postStartHookFlag, h.postStart)
+			case <-ctx.Done():
+			}
+		}()
+	}
+	if h.preStop == "" {
+		return graceShutdownC
+	}
+	shutdownC := make(chan struct{})
+	go func() {
+		select {
+		case <-graceShutdownC:
+			h.exec(ctx, hookPreStop, preStopHookFlag, h.preStop)
+			close(shutdownC)
+		case <-ctx.Done():
+		}
+	}()
+	return shutdownC
+}
+
+// exec runs the hook to completion or until the hook timeout, a failing hook is only logged.
+func (h *lifecycleHooks) exec(ctx context.Context, event, flag, hook string) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	cmd, err := hookCmd(ctx, hook, event, h.tunnelIDs)
+	if err != nil {
+		h.log.Err(err).Msgf("The --%s command is not valid", flag)
+		return
+	}
+	if cmd == nil {
+		return
+	}
+	h.log.Info().Msgf("Running the --%s command", flag)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		h.log.Err(err).Str("output", string(output)).Msgf("The --%s command failed", flag)
+	}
+}
+
+func hookCmd(ctx context.Context, hook, event string, tunnelIDs []string) (*exec.Cmd, error) {
+	args, err := shellwords.Split(hook)
+	if err != nil || len(args) == 0 {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), hookEventEnv+"="+event, hookTunnelIDsEnv+"="+strings.Join(tunnelIDs, ","))
+	return cmd, nil
+}
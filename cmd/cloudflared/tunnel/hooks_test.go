@@ -0,0 +1,58 @@
+//go:build !windows
+
+package tunnel
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/signal"
+)
+
+func TestLifecycleHooks(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hook.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nsleep 0.1\necho \"$TUNNEL_HOOK_EVENT $TUNNEL_IDS\" > \"$1/$TUNNEL_HOOK_EVENT\"\n"), 0700))
+	log := zerolog.Nop()
+	hooks := &lifecycleHooks{
+		postStart: script + " " + dir,
+		preStop:   script + " " + dir,
+		timeout:   time.Minute,
+		tunnelIDs: []string{"id1", "id2"},
+		log:       &log,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	connectedSignal := signal.New(make(chan struct{}))
+	graceShutdownC := make(chan struct{})
+	shutdownC := hooks.run(ctx, connectedSignal, graceShutdownC)
+
+	connectedSignal.Notify()
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(filepath.Join(dir, hookPostStart))
+		return err == nil && string(content) == "post-start id1,id2\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(graceShutdownC)
+	select {
+	case <-shutdownC:
+		t.Fatal("the tunnels shut down before the pre stop hook completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-shutdownC
+	content, err := os.ReadFile(filepath.Join(dir, hookPreStop))
+	require.NoError(t, err)
+	assert.Equal(t, "pre-stop id1,id2\n", string(content))
+
+	// Without a pre stop hook the tunnels shut down right away
+	hooks.preStop = ""
+	assert.Equal(t, (<-chan struct{})(graceShutdownC), hooks.run(ctx, connectedSignal, graceShutdownC))
+}
@@ -0,0 +1,83 @@
+package tunnel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+// labelSelector matches the tunnels with the label key, and with the value if it's set.
+type labelSelector struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// parseLabels parses the KEY=VALUE labels of a tunnel.
+func parseLabels(labels []string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]string, len(labels))
+	for _, label := range labels {
+		key, value, ok := strings.Cut(label, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q, labels are KEY=VALUE pairs", label)
+		}
+		if _, ok := parsed[key]; ok {
+			return nil, fmt.Errorf("label %s is set more than once", key)
+		}
+		parsed[key] = strings.TrimSpace(value)
+	}
+	return parsed, nil
+}
+
+// parseLabelSelectors parses the KEY=VALUE and KEY selectors of tunnel list.
+func parseLabelSelectors(selectors []string) ([]labelSelector, error) {
+	parsed := make([]labelSelector, 0, len(selectors))
+	for _, selector := range selectors {
+		key, value, hasValue := strings.Cut(selector, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid label %q, labels are selected with KEY=VALUE or KEY", selector)
+		}
+		parsed = append(parsed, labelSelector{key: key, value: strings.TrimSpace(value), hasValue: hasValue})
+	}
+	return parsed, nil
+}
+
+func (s labelSelector) matches(labels map[string]string) bool {
+	value, ok := labels[s.key]
+	return ok && (!s.hasValue || value == s.value)
+}
+
+// filterByLabels returns the tunnels matching all the selectors.
+func filterByLabels(tunnels []*cfapi.Tunnel, selectors []labelSelector) []*cfapi.Tunnel {
+	if len(selectors) == 0 {
+		return tunnels
+	}
+	filtered := make([]*cfapi.Tunnel, 0, len(tunnels))
+	for _, t := range tunnels {
+		matches := true
+		for _, selector := range selectors {
+			matches = matches && selector.matches(t.Metadata.Labels)
+		}
+		if matches {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+// fmtLabels formats the labels sorted by key, e.g. env=prod,site=ams.
+func fmtLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
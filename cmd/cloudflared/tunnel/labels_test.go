@@ -0,0 +1,56 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels([]string{"env=prod", "site = ams", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "site": "ams", "empty": ""}, labels)
+
+	labels, err = parseLabels(nil)
+	require.NoError(t, err)
+	assert.Nil(t, labels)
+
+	for _, invalid := range [][]string{{"env"}, {"=prod"}, {"env=prod", "env=dev"}} {
+		_, err := parseLabels(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFilterByLabels(t *testing.T) {
+	prodAms := &cfapi.Tunnel{Name: "prod-ams", Metadata: cfapi.Metadata{Labels: map[string]string{"env": "prod", "site": "ams"}}}
+	prodLax := &cfapi.Tunnel{Name: "prod-lax", Metadata: cfapi.Metadata{Labels: map[string]string{"env": "prod", "site": "lax"}}}
+	unlabeled := &cfapi.Tunnel{Name: "unlabeled"}
+	tunnels := []*cfapi.Tunnel{prodAms, prodLax, unlabeled}
+
+	testCases := []struct {
+		selectors []string
+		expected  []*cfapi.Tunnel
+	}{
+		{selectors: nil, expected: tunnels},
+		{selectors: []string{"env=prod"}, expected: []*cfapi.Tunnel{prodAms, prodLax}},
+		{selectors: []string{"env=prod", "site=lax"}, expected: []*cfapi.Tunnel{prodLax}},
+		{selectors: []string{"site"}, expected: []*cfapi.Tunnel{prodAms, prodLax}},
+		{selectors: []string{"env=dev"}, expected: []*cfapi.Tunnel{}},
+	}
+	for _, testCase := range testCases {
+		selectors, err := parseLabelSelectors(testCase.selectors)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, filterByLabels(tunnels, selectors), testCase.selectors)
+	}
+
+	_, err := parseLabelSelectors([]string{"=prod"})
+	assert.Error(t, err)
+}
+
+func TestFmtLabels(t *testing.T) {
+	assert.Equal(t, "env=prod,site=ams", fmtLabels(map[string]string{"site": "ams", "env": "prod"}))
+	assert.Equal(t, "", fmtLabels(nil))
+}
@@ -5,12 +5,15 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 
+	"github.com/cloudflare/cloudflared/cfapi"
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/credentials"
@@ -21,6 +24,13 @@ import (
 const (
 	baseLoginURL     = "https://dash.cloudflare.com/argotunnel"
 	callbackStoreURL = "https://login.cloudflareaccess.org/"
+
+	loginListenerFlag  = "login-listener"
+	loginBrowserFlag   = "browser"
+	loginNoBrowserFlag = "no-browser"
+	loginAccountFlag   = "account"
+	loginAPITokenFlag  = "api-token"
+	loginZoneFlag      = "zone"
 )
 
 func buildLoginSubcommand(hidden bool) *cli.Command {
@@ -30,13 +40,50 @@ func buildLoginSubcommand(hidden bool) *cli.Command {
 		Usage:     "Generate a configuration file with your login details",
 		ArgsUsage: " ",
 		Hidden:    hidden,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    loginListenerFlag,
+				Usage:   "listen on this local address, e.g. localhost:8099 forwarded with ssh -L, and redirect the browser opening it to the login. Use it when the identity provider requires a security key.",
+				EnvVars: []string{"TUNNEL_LOGIN_LISTENER"},
+			},
+			&cli.StringFlag{
+				Name:    loginBrowserFlag,
+				Usage:   "command opening the login URL, which replaces its %s or is appended to it, e.g. \"firefox -P work\".",
+				EnvVars: []string{"TUNNEL_LOGIN_BROWSER"},
+			},
+			&cli.BoolFlag{
+				Name:    loginNoBrowserFlag,
+				Usage:   "print the login URL with a QR code instead of opening a browser.",
+				EnvVars: []string{"TUNNEL_LOGIN_NO_BROWSER"},
+			},
+			&cli.StringFlag{
+				Name:    loginAccountFlag,
+				Usage:   "ID of the Cloudflare account to authorize with --api-token, required if the token has access to several accounts.",
+				EnvVars: []string{"TUNNEL_LOGIN_ACCOUNT"},
+			},
+			&cli.StringFlag{
+				Name:    loginAPITokenFlag,
+				Usage:   "write the certificate for this API token instead of logging in with a browser, for automated provisioning. The token needs to be allowed to edit Cloudflare Tunnel and DNS. Prefer the environment variable to keep the token out of the process list.",
+				EnvVars: []string{"TUNNEL_LOGIN_API_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:    loginZoneFlag,
+				Usage:   "name of the zone to authorize with --api-token, required if the token has access to several zones.",
+				EnvVars: []string{"TUNNEL_LOGIN_ZONE"},
+			},
+		},
 	}
 }
 
 func login(c *cli.Context) error {
 	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
 
-	path, ok, err := checkForExistingCert()
+	// The certificate of a profile is saved where the profile expects it
+	var certPath string
+	if c.String(cliutil.ProfileFlag) != "" {
+		certPath = c.String(credentials.OriginCertFlag)
+	}
+	path, ok, err := checkForExistingCert(certPath)
 	if ok {
 		fmt.Fprintf(os.Stdout, "You have an existing certificate at %s which login would overwrite.\nIf this is intentional, please move or delete that file then run this command again.\n", path)
 		return nil
@@ -44,6 +91,18 @@ func login(c *cli.Context) error {
 		return err
 	}
 
+	if apiToken := c.String(loginAPITokenFlag); apiToken != "" {
+		cert, err := originCertForAPIToken(c, apiToken, log)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, cert, 0600); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("error writing cert to %s", path))
+		}
+		fmt.Fprintf(os.Stdout, "You have successfully logged in with the API token.\nIf you wish to copy your credentials to a server, they have been saved to:\n%s\n", path)
+		return nil
+	}
+
 	loginURL, err := url.Parse(baseLoginURL)
 	if err != nil {
 		// shouldn't happen, URL is hardcoded
@@ -58,6 +117,11 @@ func login(c *cli.Context) error {
 		callbackStoreURL,
 		false,
 		false,
+		&token.LoginOptions{
+			ListenerAddress: c.String(loginListenerFlag),
+			NoBrowser:       c.Bool(loginNoBrowserFlag),
+			BrowserCommand:  c.String(loginBrowserFlag),
+		},
 		log,
 	)
 	if err != nil {
@@ -73,20 +137,24 @@ func login(c *cli.Context) error {
 	return nil
 }
 
-func checkForExistingCert() (string, bool, error) {
-	configPath, err := homedir.Expand(config.DefaultConfigSearchDirectories()[0])
-	if err != nil {
-		return "", false, err
+// checkForExistingCert checks if there is a certificate at the path, the default one if empty.
+func checkForExistingCert(path string) (string, bool, error) {
+	configPath := filepath.Dir(path)
+	if path == "" {
+		var err error
+		if configPath, err = homedir.Expand(config.DefaultConfigSearchDirectories()[0]); err != nil {
+			return "", false, err
+		}
+		path = filepath.Join(configPath, credentials.DefaultCredentialFile)
 	}
 	ok, err := config.FileExists(configPath)
 	if !ok && err == nil {
 		// create config directory if doesn't already exist
-		err = os.Mkdir(configPath, 0700)
+		err = os.MkdirAll(configPath, 0700)
 	}
 	if err != nil {
 		return "", false, err
 	}
-	path := filepath.Join(configPath, credentials.DefaultCredentialFile)
 	fileInfo, err := os.Stat(path)
 	if err == nil && fileInfo.Size() > 0 {
 		return path, true, nil
@@ -97,3 +165,75 @@ func checkForExistingCert() (string, bool, error) {
 
 	return path, false, nil
 }
+
+// originCertForAPIToken encodes an origin certificate for the API token, with the account and the zone it has
+// access to, so that a fleet can be provisioned without the browser login.
+func originCertForAPIToken(c *cli.Context, apiToken string, log *zerolog.Logger) ([]byte, error) {
+	accountID := c.String(loginAccountFlag)
+	client, err := cfapi.NewRESTClient(c.String("api-url"), accountID, "", apiToken, buildInfo.UserAgent(), log)
+	if err != nil {
+		return nil, err
+	}
+	if accountID == "" {
+		accounts, err := client.ListAccounts()
+		if err != nil {
+			return nil, errors.Wrap(err, "error listing the accounts of the API token")
+		}
+		if accountID, err = selectLoginAccount(accounts); err != nil {
+			return nil, err
+		}
+		if client, err = cfapi.NewRESTClient(c.String("api-url"), accountID, "", apiToken, buildInfo.UserAgent(), log); err != nil {
+			return nil, err
+		}
+	}
+	zones, err := client.ListZones()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the zones of the API token")
+	}
+	zone, err := selectLoginZone(zones, c.String(loginZoneFlag))
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Authorizing account %s and zone %s", accountID, zone.Name)
+	return credentials.EncodeOriginCert(&credentials.OriginCert{
+		ZoneID:    zone.ID,
+		AccountID: accountID,
+		APIToken:  apiToken,
+	})
+}
+
+func selectLoginAccount(accounts []*cfapi.Account) (string, error) {
+	switch len(accounts) {
+	case 0:
+		return "", errors.New("the API token doesn't have access to any account")
+	case 1:
+		return accounts[0].ID, nil
+	}
+	ids := make([]string, len(accounts))
+	for i, account := range accounts {
+		ids[i] = fmt.Sprintf("%s (%s)", account.ID, account.Name)
+	}
+	return "", cliutil.UsageError("The API token has access to several accounts, select one with --%s: %s", loginAccountFlag, strings.Join(ids, ", "))
+}
+
+func selectLoginZone(zones []*cfapi.Zone, name string) (*cfapi.Zone, error) {
+	if name != "" {
+		for _, zone := range zones {
+			if strings.EqualFold(zone.Name, name) {
+				return zone, nil
+			}
+		}
+		return nil, fmt.Errorf("the API token doesn't have access to the zone %s", name)
+	}
+	switch len(zones) {
+	case 0:
+		return nil, errors.New("the API token doesn't have access to any zone")
+	case 1:
+		return zones[0], nil
+	}
+	names := make([]string, len(zones))
+	for i, zone := range zones {
+		names[i] = zone.Name
+	}
+	return nil, cliutil.UsageError("The API token has access to several zones, select one with --%s: %s", loginZoneFlag, strings.Join(names, ", "))
+}
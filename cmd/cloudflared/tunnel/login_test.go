@@ -0,0 +1,36 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+func TestSelectLoginAccount(t *testing.T) {
+	_, err := selectLoginAccount(nil)
+	assert.Error(t, err)
+	id, err := selectLoginAccount([]*cfapi.Account{{ID: "abc", Name: "Personal"}})
+	require.NoError(t, err)
+	assert.Equal(t, "abc", id)
+	_, err = selectLoginAccount([]*cfapi.Account{{ID: "abc", Name: "Personal"}, {ID: "def", Name: "Work"}})
+	assert.EqualError(t, err, "The API token has access to several accounts, select one with --account: abc (Personal), def (Work)")
+}
+
+func TestSelectLoginZone(t *testing.T) {
+	zones := []*cfapi.Zone{{ID: "1", Name: "example.com"}, {ID: "2", Name: "example.org"}}
+	_, err := selectLoginZone(zones, "")
+	assert.EqualError(t, err, "The API token has access to several zones, select one with --zone: example.com, example.org")
+	zone, err := selectLoginZone(zones, "Example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "2", zone.ID)
+	_, err = selectLoginZone(zones, "example.net")
+	assert.Error(t, err)
+	zone, err = selectLoginZone(zones[:1], "")
+	require.NoError(t, err)
+	assert.Equal(t, "1", zone.ID)
+	_, err = selectLoginZone(nil, "")
+	assert.Error(t, err)
+}
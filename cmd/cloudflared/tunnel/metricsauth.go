@@ -0,0 +1,144 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/diagnostic"
+	"github.com/cloudflare/cloudflared/metrics"
+	"github.com/cloudflare/cloudflared/tlsconfig"
+)
+
+const (
+	metricsTLSCertFlag     = "metrics-tls-cert"
+	metricsTLSKeyFlag      = "metrics-tls-key"
+	metricsTLSClientCAFlag = "metrics-tls-client-ca"
+	metricsBasicAuthFlag   = "metrics-basic-auth"
+	metricsBearerTokenFlag = "metrics-bearer-token"
+
+	// The flags of the subcommands reaching the metrics server of a local instance
+	metricsTLSFlag           = "metrics-tls"
+	metricsTLSCAFlag         = "metrics-tls-ca"
+	metricsTLSClientCertFlag = "metrics-tls-client-cert"
+	metricsTLSClientKeyFlag  = "metrics-tls-client-key"
+)
+
+// metricsClientFlags are the flags of the subcommands reaching the metrics server of a local instance, to match its
+// TLS configuration and credentials.
+func metricsClientFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    metricsTLSFlag,
+			Usage:   "Reach the metrics server over HTTPS, when it's served with --metrics-tls-cert.",
+			EnvVars: []string{"TUNNEL_METRICS_TLS"},
+		},
+		&cli.StringFlag{
+			Name:    metricsTLSCAFlag,
+			Usage:   "Verify the certificate of the metrics server with the CAs in this PEM file instead of the system CAs, implies --metrics-tls.",
+			EnvVars: []string{"TUNNEL_METRICS_TLS_CA"},
+		},
+		&cli.StringFlag{
+			Name:    metricsTLSClientCertFlag,
+			Usage:   "Certificate in a PEM file presented to a metrics server served with --metrics-tls-client-ca.",
+			EnvVars: []string{"TUNNEL_METRICS_TLS_CLIENT_CERT"},
+		},
+		&cli.StringFlag{
+			Name:    metricsTLSClientKeyFlag,
+			Usage:   "Private key of the --metrics-tls-client-cert, in a PEM file.",
+			EnvVars: []string{"TUNNEL_METRICS_TLS_CLIENT_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    metricsBasicAuthFlag,
+			Usage:   "USERNAME:PASSWORD sent with basic auth to the metrics server. Prefer setting it in the environment than on the command line.",
+			EnvVars: []string{"TUNNEL_METRICS_BASIC_AUTH"},
+		},
+		&cli.StringFlag{
+			Name:    metricsBearerTokenFlag,
+			Usage:   "Token sent in an Authorization: Bearer header to the metrics server. Prefer setting it in the environment than on the command line.",
+			EnvVars: []string{"TUNNEL_METRICS_BEARER_TOKEN"},
+		},
+	}
+}
+
+// newMetricsTLSConfig returns the TLS configuration of the metrics server, nil if it serves plain HTTP.
+func newMetricsTLSConfig(c *cli.Context) (*tls.Config, error) {
+	cert, key := c.String(metricsTLSCertFlag), c.String(metricsTLSKeyFlag)
+	if cert == "" && key == "" {
+		if c.IsSet(metricsTLSClientCAFlag) {
+			return nil, cliutil.UsageError("--%s requires --%s and --%s", metricsTLSClientCAFlag, metricsTLSCertFlag, metricsTLSKeyFlag)
+		}
+		return nil, nil
+	}
+	if cert == "" || key == "" {
+		return nil, cliutil.UsageError("--%s and --%s must be set together", metricsTLSCertFlag, metricsTLSKeyFlag)
+	}
+	reloader, err := tlsconfig.NewCertReloader(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	params := &tlsconfig.TLSParameters{
+		GetCertificate: reloader,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if clientCA := c.String(metricsTLSClientCAFlag); clientCA != "" {
+		params.ClientCAs = []string{clientCA}
+	}
+	return tlsconfig.GetConfig(params)
+}
+
+// newMetricsCredentials returns the credentials required by the metrics server, nil if it doesn't require any.
+func newMetricsCredentials(c *cli.Context, secure bool, log *zerolog.Logger) (*metrics.Credentials, error) {
+	basicAuth, bearerToken := c.String(metricsBasicAuthFlag), c.String(metricsBearerTokenFlag)
+	if basicAuth == "" && bearerToken == "" {
+		return nil, nil
+	}
+	credentials := &metrics.Credentials{BearerToken: bearerToken}
+	if basicAuth != "" {
+		username, password, err := parseMetricsBasicAuth(basicAuth)
+		if err != nil {
+			return nil, err
+		}
+		credentials.Username, credentials.Password = username, password
+	}
+	if !secure {
+		log.Warn().Msgf("The metrics server credentials are sent in clear text, set --%s and --%s to serve it over TLS", metricsTLSCertFlag, metricsTLSKeyFlag)
+	}
+	return credentials, nil
+}
+
+func parseMetricsBasicAuth(basicAuth string) (string, string, error) {
+	username, password, ok := strings.Cut(basicAuth, ":")
+	if !ok || username == "" {
+		return "", "", cliutil.UsageError("--%s must be USERNAME:PASSWORD", metricsBasicAuthFlag)
+	}
+	return username, password, nil
+}
+
+// newMetricsClientOptions returns the options of the client reaching the metrics server of a local instance.
+func newMetricsClientOptions(c *cli.Context) (diagnostic.ClientOptions, error) {
+	options := diagnostic.ClientOptions{
+		TLS:         c.Bool(metricsTLSFlag) || c.String(metricsTLSCAFlag) != "",
+		CAFile:      c.String(metricsTLSCAFlag),
+		CertFile:    c.String(metricsTLSClientCertFlag),
+		KeyFile:     c.String(metricsTLSClientKeyFlag),
+		BearerToken: c.String(metricsBearerTokenFlag),
+	}
+	if (options.CertFile == "") != (options.KeyFile == "") {
+		return options, cliutil.UsageError("--%s and --%s must be set together", metricsTLSClientCertFlag, metricsTLSClientKeyFlag)
+	}
+	if options.CertFile != "" && !options.TLS {
+		return options, cliutil.UsageError("--%s requires --%s", metricsTLSClientCertFlag, metricsTLSFlag)
+	}
+	if basicAuth := c.String(metricsBasicAuthFlag); basicAuth != "" {
+		username, password, err := parseMetricsBasicAuth(basicAuth)
+		if err != nil {
+			return options, err
+		}
+		options.Username, options.Password = username, password
+	}
+	return options, nil
+}
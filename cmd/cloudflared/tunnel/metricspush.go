@@ -0,0 +1,40 @@
+package tunnel
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/metrics"
+)
+
+const (
+	metricsPushURLFlag      = "metrics-push-url"
+	metricsPushIntervalFlag = "metrics-push-interval"
+	metricsPushLabelFlag    = "metrics-push-label"
+)
+
+// newMetricsPusher returns the pusher of the metrics to --metrics-push-url, nil if it isn't set.
+func newMetricsPusher(c *cli.Context, info *cliutil.BuildInfo, log *zerolog.Logger) (*metrics.Pusher, error) {
+	pushURL := c.String(metricsPushURLFlag)
+	if pushURL == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, label := range c.StringSlice(metricsPushLabelFlag) {
+		name, value, ok := strings.Cut(label, "=")
+		if !ok || name == "" {
+			return nil, cliutil.UsageError("--%s must be NAME=VALUE, not %q", metricsPushLabelFlag, label)
+		}
+		labels[name] = value
+	}
+	return metrics.NewPusher(metrics.PushConfig{
+		URL:       pushURL,
+		Interval:  c.Duration(metricsPushIntervalFlag),
+		Labels:    labels,
+		UserAgent: info.UserAgent(),
+	}, prometheus.DefaultGatherer, log)
+}
@@ -0,0 +1,39 @@
+package tunnel
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/tracing"
+)
+
+const (
+	otlpEndpointFlag    = "otlp-endpoint"
+	otlpHeaderFlag      = "otlp-header"
+	otlpSampleRatioFlag = "otlp-sample-ratio"
+	// otlpTrustTraceparentFlag follows the sampling decision of the traceparent header sent by the eyeballs
+	otlpTrustTraceparentFlag = "otlp-trust-traceparent"
+)
+
+// newOTLPExporter returns the exporter of the spans of the proxied requests, nil if there is no --otlp-endpoint.
+func newOTLPExporter(c *cli.Context) (*tracing.OTLPExporter, error) {
+	endpoint := c.String(otlpEndpointFlag)
+	if endpoint == "" {
+		return nil, nil
+	}
+	ratio := c.Float64(otlpSampleRatioFlag)
+	if ratio < 0 || ratio > 1 {
+		return nil, cliutil.UsageError("--%s must be between 0 and 1", otlpSampleRatioFlag)
+	}
+	headers := make(map[string]string)
+	for _, header := range c.StringSlice(otlpHeaderFlag) {
+		key, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, cliutil.UsageError("--%s %s must be a KEY=VALUE pair", otlpHeaderFlag, header)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return tracing.NewOTLPExporter(endpoint, headers, ratio, c.Bool(otlpTrustTraceparentFlag))
+}
@@ -5,23 +5,43 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
 
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/shellwords"
 )
 
 const httpTimeout = 15 * time.Second
 
+const (
+	quickTunnelOutputFlag = "output"
+	quickTunnelHookFlag   = "url-hook"
+	// quickTunnelEventEnv is the environment variable telling the URL hook why it is run
+	quickTunnelEventEnv = "QUICK_TUNNEL_EVENT"
+
+	quickTunnelAssigned  = "assigned"
+	quickTunnelConnected = "connected"
+)
+
 const disclaimer = "Thank you for trying Cloudflare Tunnel. Doing so, without a Cloudflare account, is a quick way to experiment and try it out. However, be aware that these account-less Tunnels have no uptime guarantee, are subject to the Cloudflare Online Services Terms of Use (https://www.cloudflare.com/website-terms/), and Cloudflare reserves the right to investigate your use of Tunnels for violations of such terms. If you intend to use Tunnels in production you should use a pre-created named tunnel by following: https://developers.cloudflare.com/cloudflare-one/connections/connect-apps"
 
 // RunQuickTunnel requests a tunnel from the specified service.
 // We use this to power quick tunnels on trycloudflare.com, but the
 // service is open-source and could be used by anyone.
 func RunQuickTunnel(sc *subcommandContext) error {
+	if output := sc.c.String(quickTunnelOutputFlag); output != "" && output != "json" {
+		return cliutil.UsageError("--%s only supports json for quick tunnels", quickTunnelOutputFlag)
+	}
 	sc.log.Info().Msg(disclaimer)
 	sc.log.Info().Msg("Requesting new quick Tunnel on trycloudflare.com...")
 
@@ -97,6 +117,77 @@ func RunQuickTunnel(sc *subcommandContext) error {
 	)
 }
 
+// quickTunnelEvent is printed to stdout with --output json, one per line.
+type quickTunnelEvent struct {
+	Event    string    `json:"event"`
+	URL      string    `json:"url"`
+	TunnelID uuid.UUID `json:"tunnelID"`
+}
+
+// quickTunnelNotifier reports the URL of a quick tunnel to scripts when it is assigned and once the tunnel is
+// connected, so that they don't have to scrape the logs.
+type quickTunnelNotifier struct {
+	event     quickTunnelEvent
+	json      bool
+	hook      string
+	out       io.Writer
+	log       *zerolog.Logger
+	connected sync.Once
+}
+
+func newQuickTunnelNotifier(c *cli.Context, properties *connection.TunnelProperties, log *zerolog.Logger) *quickTunnelNotifier {
+	url := properties.QuickTunnelUrl
+	if !strings.HasPrefix(url, "https://") {
+		url = "https://" + url
+	}
+	return &quickTunnelNotifier{
+		event: quickTunnelEvent{URL: url, TunnelID: properties.Credentials.TunnelID},
+		json:  c.String(quickTunnelOutputFlag) == "json",
+		hook:  c.String(quickTunnelHookFlag),
+		out:   os.Stdout,
+		log:   log,
+	}
+}
+
+// OnTunnelEvent notifies that the tunnel is reachable on its first connection.
+func (n *quickTunnelNotifier) OnTunnelEvent(event connection.Event) {
+	if event.EventType == connection.Connected {
+		n.connected.Do(func() { n.notify(quickTunnelConnected) })
+	}
+}
+
+func (n *quickTunnelNotifier) notify(event string) {
+	e := n.event
+	e.Event = event
+	if n.json {
+		if err := json.NewEncoder(n.out).Encode(e); err != nil {
+			n.log.Err(err).Msg("Failed to print the quick tunnel URL")
+		}
+	}
+	cmd, err := quickTunnelHookCmd(n.hook, e)
+	if err != nil {
+		n.log.Err(err).Msgf("The --%s command is not valid", quickTunnelHookFlag)
+	} else if cmd != nil {
+		go func() {
+			if output, err := cmd.CombinedOutput(); err != nil {
+				n.log.Err(err).Str("output", string(output)).Msgf("The --%s command failed", quickTunnelHookFlag)
+			}
+		}()
+	}
+}
+
+// quickTunnelHookCmd returns the hook command with the URL replacing its %s or appended to it, nil if there is no
+// hook.
+func quickTunnelHookCmd(hook string, event quickTunnelEvent) (*exec.Cmd, error) {
+	args, err := shellwords.SplitWithArg(hook, event.URL)
+	if err != nil || len(args) == 0 {
+		return nil, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), quickTunnelEventEnv+"="+event.Event)
+	return cmd, nil
+}
+
 type QuickTunnelResponse struct {
 	Success bool
 	Result  QuickTunnel
@@ -0,0 +1,51 @@
+package tunnel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+func TestQuickTunnelNotifier(t *testing.T) {
+	var out bytes.Buffer
+	log := zerolog.Nop()
+	n := &quickTunnelNotifier{
+		event: quickTunnelEvent{URL: "https://quick.trycloudflare.com", TunnelID: uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")},
+		json:  true,
+		out:   &out,
+		log:   &log,
+	}
+	n.notify(quickTunnelAssigned)
+	n.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	// Only the first connection is reported
+	n.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Reconnecting})
+	n.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	assert.Equal(t, `{"event":"assigned","url":"https://quick.trycloudflare.com","tunnelID":"df5ed608-b8b4-4109-89f3-9f2cf199df64"}
+{"event":"connected","url":"https://quick.trycloudflare.com","tunnelID":"df5ed608-b8b4-4109-89f3-9f2cf199df64"}
+`, out.String())
+}
+
+func TestQuickTunnelHookCmd(t *testing.T) {
+	event := quickTunnelEvent{Event: quickTunnelConnected, URL: "https://quick.trycloudflare.com"}
+	cmd, err := quickTunnelHookCmd("", event)
+	require.NoError(t, err)
+	assert.Nil(t, cmd)
+
+	cmd, err = quickTunnelHookCmd("notify-send 'Quick tunnel'", event)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"notify-send", "Quick tunnel", "https://quick.trycloudflare.com"}, cmd.Args)
+	assert.Contains(t, cmd.Env, "QUICK_TUNNEL_EVENT=connected")
+
+	cmd, err = quickTunnelHookCmd("curl -d url=%s http://localhost:9000", event)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"curl", "-d", "url=https://quick.trycloudflare.com", "http://localhost:9000"}, cmd.Args)
+
+	_, err = quickTunnelHookCmd(`notify-send "Quick tunnel`, event)
+	assert.Error(t, err)
+}
@@ -0,0 +1,267 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+const remoteConfigVersionComment = "cloudflared remote configuration version:"
+
+var (
+	remoteConfigForceFlag = &cli.BoolFlag{
+		Name:    "force",
+		Aliases: []string{"f"},
+		Usage:   "Import the file even if the remote configuration changed since it was exported.",
+	}
+
+	remoteConfigVersionRegexp = regexp.MustCompile(`(?m)^#\s*` + regexp.QuoteMeta(remoteConfigVersionComment) + `\s*(\d+)\s*$`)
+)
+
+// remoteConfigFile is the remote configuration of a tunnel as a configuration file, that can also run the tunnel
+// locally.
+type remoteConfigFile struct {
+	TunnelID      string                          `yaml:"tunnel"`
+	Ingress       []config.UnvalidatedIngressRule `yaml:"ingress"`
+	WarpRouting   config.WarpRoutingConfig        `yaml:"warp-routing,omitempty"`
+	OriginRequest config.OriginRequestConfig      `yaml:"originRequest,omitempty"`
+}
+
+func buildRemoteConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "remote-config",
+		Usage:     "Export and import the remotely managed configuration of a tunnel",
+		UsageText: "cloudflared tunnel [tunnel command options] remote-config COMMAND [arguments...]",
+		Description: `The configuration of a remotely managed tunnel is edited from the dashboard. These commands download it into a
+  configuration file, to edit it locally or keep it in version control, and upload the file back.
+
+  The exported file records the version of the remote configuration it was exported from. The import fails if the
+  remote configuration changed since then, unless --force is used.
+
+  $ cloudflared tunnel remote-config export my-tunnel config.yaml
+  $ cloudflared tunnel remote-config import my-tunnel config.yaml`,
+		Subcommands: []*cli.Command{
+			{
+				Name:               "export",
+				Action:             cliutil.ConfiguredAction(exportRemoteConfigCommand),
+				Usage:              "Download the remote configuration of a tunnel into a YAML file",
+				UsageText:          "cloudflared tunnel [tunnel command options] remote-config export TUNNEL [FILE]",
+				Description:        "Writes the remote configuration of the tunnel to the file, or to stdout if no file is given.",
+				CustomHelpTemplate: commandHelpTemplate(),
+			},
+			{
+				Name:               "import",
+				Action:             cliutil.ConfiguredAction(importRemoteConfigCommand),
+				Usage:              "Replace the remote configuration of a tunnel with a YAML file",
+				UsageText:          "cloudflared tunnel [tunnel command options] remote-config import [subcommand options] TUNNEL FILE",
+				Description:        "Validates the ingress rules of the file and uploads its ingress, warp-routing and originRequest settings.",
+				Flags:              []cli.Flag{remoteConfigForceFlag, outputFormatFlag},
+				CustomHelpTemplate: commandHelpTemplate(),
+			},
+		},
+	}
+}
+
+func exportRemoteConfigCommand(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return cliutil.UsageError(`"cloudflared tunnel remote-config export" requires the tunnel, and optionally the file to write.`)
+	}
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	tunnelID, err := sc.findID(c.Args().First())
+	if err != nil {
+		return errors.Wrap(err, "error parsing tunnel ID")
+	}
+
+	data, version, err := sc.exportRemoteConfig(tunnelID)
+	if err != nil {
+		return err
+	}
+	path := c.Args().Get(1)
+	if path == "" || path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write the configuration file")
+	}
+	sc.log.Info().Msgf("Exported version %d of the remote configuration of tunnel %s to %s", version, tunnelID, path)
+	return nil
+}
+
+func importRemoteConfigCommand(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cliutil.UsageError(`"cloudflared tunnel remote-config import" requires the tunnel and the file to import.`)
+	}
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	tunnelID, err := sc.findID(c.Args().First())
+	if err != nil {
+		return errors.Wrap(err, "error parsing tunnel ID")
+	}
+	data, err := os.ReadFile(c.Args().Get(1))
+	if err != nil {
+		return errors.Wrap(err, "failed to read the configuration file")
+	}
+
+	updated, err := sc.importRemoteConfig(tunnelID, data, c.Bool(remoteConfigForceFlag.Name))
+	if err != nil {
+		return err
+	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, updated)
+	}
+	fmt.Printf("Updated the remote configuration of tunnel %s to version %d\n", tunnelID, updated.Version)
+	return nil
+}
+
+// exportRemoteConfig returns the remote configuration of the tunnel as YAML, and its version.
+func (sc *subcommandContext) exportRemoteConfig(tunnelID uuid.UUID) ([]byte, int, error) {
+	client, err := sc.client()
+	if err != nil {
+		return nil, 0, err
+	}
+	remote, err := client.GetTunnelConfiguration(tunnelID)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get the remote configuration")
+	}
+
+	var rawConfig ingress.RemoteConfigJSON
+	if len(remote.Config) > 0 {
+		if err := json.Unmarshal(remote.Config, &rawConfig); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to parse the remote configuration")
+		}
+	}
+	file := remoteConfigFile{
+		TunnelID:    tunnelID.String(),
+		Ingress:     rawConfig.IngressRules,
+		WarpRouting: rawConfig.WarpRouting,
+	}
+	if rawConfig.GlobalOriginRequest != nil {
+		file.OriginRequest = *rawConfig.GlobalOriginRequest
+	}
+
+	var node yaml.Node
+	if err := node.Encode(&file); err != nil {
+		return nil, 0, err
+	}
+	pruneEmptyYAML(&node)
+	node.HeadComment = fmt.Sprintf("%s %d", remoteConfigVersionComment, remote.Version)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), remote.Version, nil
+}
+
+// importRemoteConfig replaces the remote configuration of the tunnel with the one of the file. Unless forced, the
+// file must have been exported from the current version of the remote configuration.
+func (sc *subcommandContext) importRemoteConfig(tunnelID uuid.UUID, data []byte, force bool) (*cfapi.TunnelConfiguration, error) {
+	var file remoteConfigFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the configuration file")
+	}
+	if id, err := uuid.Parse(file.TunnelID); err == nil && id != tunnelID && !force {
+		return nil, errors.Errorf("the file is the configuration of tunnel %s, use --force to import it into tunnel %s", id, tunnelID)
+	}
+	if _, err := ingress.ParseIngress(&config.Configuration{Ingress: file.Ingress, OriginRequest: file.OriginRequest}); err != nil {
+		return nil, errors.Wrap(err, "the ingress rules of the file are invalid")
+	}
+
+	client, err := sc.client()
+	if err != nil {
+		return nil, err
+	}
+	if !force {
+		exportedVersion, ok := remoteConfigVersion(data)
+		if !ok {
+			return nil, errors.New("the file doesn't record the version of the remote configuration it was exported from, use --force to import it anyway")
+		}
+		current, err := client.GetTunnelConfiguration(tunnelID)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the remote configuration")
+		}
+		if current.Version != exportedVersion {
+			return nil, errors.Errorf("the remote configuration of tunnel %s is at version %d but the file was exported from version %d, export it again or use --force to overwrite it", tunnelID, current.Version, exportedVersion)
+		}
+	}
+
+	rawConfig := ingress.RemoteConfigJSON{
+		IngressRules: file.Ingress,
+		WarpRouting:  file.WarpRouting,
+	}
+	if !reflect.ValueOf(file.OriginRequest).IsZero() {
+		rawConfig.GlobalOriginRequest = &file.OriginRequest
+	}
+	body, err := json.Marshal(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := client.UpdateTunnelConfiguration(tunnelID, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to update the remote configuration")
+	}
+	return updated, nil
+}
+
+// remoteConfigVersion returns the version recorded in the comment of an exported configuration file.
+func remoteConfigVersion(data []byte) (int, bool) {
+	match := remoteConfigVersionRegexp.FindSubmatch(data)
+	if match == nil {
+		return 0, false
+	}
+	version, err := strconv.Atoi(string(match[1]))
+	return version, err == nil
+}
+
+// pruneEmptyYAML removes the null and empty values of the mappings, the settings that aren't set.
+func pruneEmptyYAML(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			pruneEmptyYAML(child)
+		}
+	case yaml.MappingNode:
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			pruneEmptyYAML(value)
+			if isEmptyYAML(value) {
+				continue
+			}
+			content = append(content, key, value)
+		}
+		node.Content = content
+	}
+}
+
+func isEmptyYAML(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Tag == "!!null" || (node.Tag == "!!str" && node.Value == "")
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	}
+	return false
+}
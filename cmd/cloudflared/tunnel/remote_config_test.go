@@ -0,0 +1,88 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"flag"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+// remoteConfigMockClient holds the remote configuration of a single tunnel.
+type remoteConfigMockClient struct {
+	cfapi.Client
+	configuration cfapi.TunnelConfiguration
+}
+
+func (m *remoteConfigMockClient) GetTunnelConfiguration(uuid.UUID) (*cfapi.TunnelConfiguration, error) {
+	configuration := m.configuration
+	return &configuration, nil
+}
+
+func (m *remoteConfigMockClient) UpdateTunnelConfiguration(tunnelID uuid.UUID, config json.RawMessage) (*cfapi.TunnelConfiguration, error) {
+	m.configuration = cfapi.TunnelConfiguration{TunnelID: tunnelID, Version: m.configuration.Version + 1, Config: config}
+	return m.GetTunnelConfiguration(tunnelID)
+}
+
+func TestExportImportRemoteConfig(t *testing.T) {
+	tunnelID := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	client := &remoteConfigMockClient{configuration: cfapi.TunnelConfiguration{
+		TunnelID: tunnelID,
+		Version:  3,
+		Config: json.RawMessage(`{
+			"ingress": [
+				{"hostname": "app.example.com", "service": "http://localhost:8000", "originRequest": {"connectTimeout": 10}},
+				{"service": "http_status:404"}
+			],
+			"warp-routing": {}
+		}`),
+	}}
+	log := zerolog.Nop()
+	sc := &subcommandContext{
+		c:                 cli.NewContext(cli.NewApp(), flag.NewFlagSet("remote-config", flag.PanicOnError), nil),
+		log:               &log,
+		tunnelstoreClient: client,
+	}
+
+	exported, version, err := sc.exportRemoteConfig(tunnelID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.Equal(t, `# cloudflared remote configuration version: 3
+tunnel: df5ed608-b8b4-4109-89f3-9f2cf199df64
+ingress:
+  - hostname: app.example.com
+    service: http://localhost:8000
+    originRequest:
+      connectTimeout: 10s
+  - service: http_status:404
+`, string(exported))
+
+	updated, err := sc.importRemoteConfig(tunnelID, exported, false)
+	require.NoError(t, err)
+	assert.Equal(t, 4, updated.Version)
+	assert.JSONEq(t, `{
+		"ingress": [
+			{"hostname": "app.example.com", "service": "http://localhost:8000", "originRequest": {"connectTimeout": 10}},
+			{"service": "http_status:404", "originRequest": {}}
+		],
+		"warp-routing": {}
+	}`, string(updated.Config))
+
+	// The remote configuration changed since the export
+	_, err = sc.importRemoteConfig(tunnelID, exported, false)
+	assert.Error(t, err)
+	updated, err = sc.importRemoteConfig(tunnelID, exported, true)
+	require.NoError(t, err)
+	assert.Equal(t, 5, updated.Version)
+
+	_, err = sc.importRemoteConfig(tunnelID, []byte("ingress:\n  - hostname: app.example.com\n    service: http://localhost:8000\n"), true)
+	assert.Error(t, err, "the last rule must be a catch-all")
+	_, err = sc.importRemoteConfig(uuid.New(), exported, false)
+	assert.Error(t, err, "the file is the configuration of another tunnel")
+}
@@ -19,7 +19,21 @@ func runDNSProxyServer(c *cli.Context, dnsReadySignal chan struct{}, shutdownC <
 	if maxUpstreamConnections < 0 {
 		return fmt.Errorf("'%s' must be 0 or higher", "proxy-dns-max-upstream-conns")
 	}
-	listener, err := tunneldns.CreateListener(c.String("proxy-dns-address"), uint16(port), c.StringSlice("proxy-dns-upstream"), c.StringSlice("proxy-dns-bootstrap"), maxUpstreamConnections, log)
+	listener, err := tunneldns.CreateListener(tunneldns.ListenerConfig{
+		Address:                c.String("proxy-dns-address"),
+		Port:                   uint16(port),
+		Upstreams:              c.StringSlice("proxy-dns-upstream"),
+		Bootstraps:             c.StringSlice("proxy-dns-bootstrap"),
+		MaxUpstreamConnections: maxUpstreamConnections,
+		Cache: tunneldns.CacheConfig{
+			Disabled:    c.Bool("proxy-dns-no-cache"),
+			Size:        c.Int("proxy-dns-cache-size"),
+			MinTTL:      c.Duration("proxy-dns-cache-min-ttl"),
+			MaxTTL:      c.Duration("proxy-dns-cache-max-ttl"),
+			NegativeTTL: c.Duration("proxy-dns-cache-negative-ttl"),
+			Prefetch:    c.Int("proxy-dns-cache-prefetch"),
+		},
+	}, log)
 	if err != nil {
 		close(dnsReadySignal)
 		listener.Stop()
@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+const startupCheckInterval = 250 * time.Millisecond
+
+// startupGate fails the startup of cloudflared if its tunnels don't establish enough connections in time, so that a
+// supervisor sees the process exiting instead of retrying forever, e.g. with invalid credentials.
+type startupGate struct {
+	names          []string
+	trackers       []*tunnelstate.ConnTracker
+	minConnections uint
+}
+
+func newStartupGate(running []*runningTunnel, trackers []*tunnelstate.ConnTracker, minConnections, haConnections int) (*startupGate, error) {
+	if minConnections < 1 || minConnections > haConnections {
+		return nil, cliutil.UsageError("--%s must be between 1 and the %d connections of a tunnel", startupMinConnectionsFlag, haConnections)
+	}
+	names := make([]string, len(running))
+	for i, rt := range running {
+		names[i] = rt.name
+	}
+	return &startupGate{names: names, trackers: trackers, minConnections: uint(minConnections)}, nil
+}
+
+// wait returns an error if a tunnel doesn't have the minimum number of active connections once the timeout expires.
+// It returns nil as soon as all the tunnels have them, or if the context is done.
+func (g *startupGate) wait(ctx context.Context, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(startupCheckInterval)
+	defer ticker.Stop()
+	for {
+		if g.pending() < 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline.C:
+			i := g.pending()
+			if i < 0 {
+				return nil
+			}
+			tunnel := "the tunnel"
+			if g.names[i] != "" {
+				tunnel = fmt.Sprintf("tunnel %s", g.names[i])
+			}
+			return errors.Errorf("%s established %d of the %d required connections to the edge within the startup timeout of %s",
+				tunnel, g.trackers[i].CountActiveConns(), g.minConnections, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// pending returns the index of the first tunnel without the minimum number of active connections, -1 if there is none.
+func (g *startupGate) pending() int {
+	for i, tracker := range g.trackers {
+		if tracker.CountActiveConns() < g.minConnections {
+			return i
+		}
+	}
+	return -1
+}
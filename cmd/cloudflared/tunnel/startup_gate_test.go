@@ -0,0 +1,43 @@
+package tunnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+func TestStartupGate(t *testing.T) {
+	log := zerolog.Nop()
+	running := []*runningTunnel{{tunnelInstance: tunnelInstance{name: "web"}}, {tunnelInstance: tunnelInstance{name: "ssh"}}}
+	web, ssh := tunnelstate.NewConnTracker(&log), tunnelstate.NewConnTracker(&log)
+
+	_, err := newStartupGate(running, []*tunnelstate.ConnTracker{web, ssh}, 5, 4)
+	assert.Error(t, err)
+	gate, err := newStartupGate(running, []*tunnelstate.ConnTracker{web, ssh}, 2, 4)
+	require.NoError(t, err)
+
+	web.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	web.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Connected})
+	ssh.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	err = gate.wait(context.Background(), 10*time.Millisecond)
+	assert.EqualError(t, err, "tunnel ssh established 1 of the 2 required connections to the edge within the startup timeout of 10ms")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ssh.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Connected})
+	}()
+	assert.NoError(t, gate.wait(context.Background(), 5*time.Second))
+
+	// The gate doesn't fail a tunnel being shut down
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ssh.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Disconnected})
+	assert.NoError(t, gate.wait(ctx, time.Hour))
+}
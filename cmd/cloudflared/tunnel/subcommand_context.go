@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -17,6 +18,7 @@ import (
 	"github.com/cloudflare/cloudflared/connection"
 	"github.com/cloudflare/cloudflared/credentials"
 	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/secretstore"
 )
 
 type errInvalidJSONCredential struct {
@@ -36,8 +38,9 @@ type subcommandContext struct {
 	fs  fileSystem
 
 	// These fields should be accessed using their respective Getter
-	tunnelstoreClient cfapi.Client
-	userCredential    *credentials.User
+	tunnelstoreClient     cfapi.Client
+	userCredential        *credentials.User
+	credentialsPassphrase string
 }
 
 func newSubcommandContext(c *cli.Context) (*subcommandContext, error) {
@@ -50,7 +53,12 @@ func newSubcommandContext(c *cli.Context) (*subcommandContext, error) {
 
 // Returns something that can find the given tunnel's credentials file.
 func (sc *subcommandContext) credentialFinder(tunnelID uuid.UUID) CredFinder {
-	if path := sc.c.String(CredFileFlag); path != "" {
+	return sc.credentialFinderFor(tunnelID, sc.c.String(CredFileFlag))
+}
+
+// credentialFinderFor finds the credentials of the tunnel at path, or in the default directories if it's empty.
+func (sc *subcommandContext) credentialFinderFor(tunnelID uuid.UUID, path string) CredFinder {
+	if path != "" {
 		return newStaticPath(path, sc.fs)
 	}
 	return newSearchByID(tunnelID, sc.c, sc.log, sc.fs)
@@ -91,6 +99,9 @@ func (sc *subcommandContext) readTunnelCredentials(credFinder CredFinder) (conne
 	if err != nil {
 		return connection.Credentials{}, errors.Wrapf(err, "couldn't read tunnel credentials from %v", filePath)
 	}
+	if body, err = sc.decryptCredentials(body); err != nil {
+		return connection.Credentials{}, errors.Wrapf(err, "couldn't decrypt tunnel credentials from %v", filePath)
+	}
 
 	var credentials connection.Credentials
 	if err = json.Unmarshal(body, &credentials); err != nil {
@@ -105,30 +116,18 @@ func (sc *subcommandContext) readTunnelCredentials(credFinder CredFinder) (conne
 	return credentials, nil
 }
 
-func (sc *subcommandContext) create(name string, credentialsFilePath string, secret string) (*cfapi.Tunnel, error) {
+func (sc *subcommandContext) create(name string, credentialsFilePath string, secret string, labels map[string]string) (*cfapi.Tunnel, error) {
 	client, err := sc.client()
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't create client to talk to Cloudflare Tunnel backend")
 	}
 
-	var tunnelSecret []byte
-	if secret == "" {
-		tunnelSecret, err = generateTunnelSecret()
-		if err != nil {
-			return nil, errors.Wrap(err, "couldn't generate the secret for your new tunnel")
-		}
-	} else {
-		decodedSecret, err := base64.StdEncoding.DecodeString(secret)
-		if err != nil {
-			return nil, errors.Wrap(err, "Couldn't decode tunnel secret from base64")
-		}
-		tunnelSecret = []byte(decodedSecret)
-		if len(tunnelSecret) < 32 {
-			return nil, errors.New("Decoded tunnel secret must be at least 32 bytes long")
-		}
+	tunnelSecret, err := tunnelSecretFromFlag(secret)
+	if err != nil {
+		return nil, err
 	}
 
-	tunnel, err := client.CreateTunnel(name, tunnelSecret)
+	tunnel, err := client.CreateTunnel(name, tunnelSecret, labels)
 	if err != nil {
 		return nil, errors.Wrap(err, "Create Tunnel API call failed")
 	}
@@ -151,7 +150,10 @@ func (sc *subcommandContext) create(name string, credentialsFilePath string, sec
 		}
 		usedCertPath = true
 	}
-	writeFileErr := writeTunnelCredentials(credentialsFilePath, &tunnelCredentials)
+	body, writeFileErr := sc.encodeCredentials(&tunnelCredentials)
+	if writeFileErr == nil {
+		writeFileErr = writeTunnelCredentials(credentialsFilePath, body)
+	}
 	if writeFileErr != nil {
 		var errorLines []string
 		errorLines = append(errorLines, fmt.Sprintf("Your tunnel '%v' was created with ID %v. However, cloudflared couldn't write tunnel credentials to %s.", tunnel.Name, tunnel.ID, credentialsFilePath))
@@ -180,6 +182,128 @@ func (sc *subcommandContext) create(name string, credentialsFilePath string, sec
 	return &tunnel.Tunnel, nil
 }
 
+// tunnelSecretFromFlag decodes the base64 secret given with --secret, or generates one if it's empty.
+func tunnelSecretFromFlag(secret string) ([]byte, error) {
+	if secret == "" {
+		tunnelSecret, err := generateTunnelSecret()
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't generate the secret for your tunnel")
+		}
+		return tunnelSecret, nil
+	}
+	tunnelSecret, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't decode tunnel secret from base64")
+	}
+	if len(tunnelSecret) < 32 {
+		return nil, errors.New("Decoded tunnel secret must be at least 32 bytes long")
+	}
+	return tunnelSecret, nil
+}
+
+// rotatedCredentials is the outcome of rotating the credentials of a tunnel.
+type rotatedCredentials struct {
+	TunnelID        uuid.UUID `json:"tunnel_id"`
+	CredentialsFile string    `json:"credentials_file"`
+	// DisconnectedConnectors are the connectors still running with the previous secret after the grace period
+	DisconnectedConnectors []uuid.UUID `json:"disconnected_connectors,omitempty"`
+}
+
+// rotateCredentials gives the tunnel a new secret and replaces its credentials file, keeping its ID and therefore its
+// routes. The connectors running with the previous secret are disconnected after the grace period, unless it's zero.
+func (sc *subcommandContext) rotateCredentials(tunnelID uuid.UUID, secret string, gracePeriod time.Duration) (*rotatedCredentials, error) {
+	client, err := sc.client()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create client to talk to Cloudflare Tunnel backend")
+	}
+	tunnel, err := client.GetTunnel(tunnelID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can't get tunnel information. Please check tunnel id: %s", tunnelID)
+	}
+	if !tunnel.DeletedAt.IsZero() {
+		return nil, fmt.Errorf("Tunnel %s has been deleted", tunnel.ID)
+	}
+	// Connectors that start after the rotation get a new connector ID, which tells them apart from these
+	previousConnectors, err := client.ListActiveClients(tunnelID)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list the connectors of the tunnel")
+	}
+
+	tunnelSecret, err := tunnelSecretFromFlag(secret)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := sc.credential()
+	if err != nil {
+		return nil, err
+	}
+	credentialsFilePath := sc.c.String(CredFileFlag)
+	if credentialsFilePath == "" {
+		// The credentials file is replaced where it's found, or written next to the origin certificate like create does
+		if credentialsFilePath, err = sc.credentialFinder(tunnelID).Path(); err != nil {
+			if credentialsFilePath, err = tunnelFilePath(tunnelID, filepath.Dir(credential.CertPath())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, err := client.RotateTunnelSecret(tunnelID, tunnelSecret); err != nil {
+		return nil, errors.Wrap(err, "Rotate Tunnel Secret API call failed")
+	}
+	tunnelCredentials := connection.Credentials{
+		AccountTag:   credential.AccountID(),
+		TunnelSecret: tunnelSecret,
+		TunnelID:     tunnelID,
+	}
+	body, err := sc.encodeCredentials(&tunnelCredentials)
+	if err == nil {
+		err = replaceTunnelCredentials(credentialsFilePath, body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("The secret of tunnel %s was rotated, but cloudflared couldn't write the new credentials to %s: %v. "+
+			"Use `cloudflared tunnel token --cred-file %s %s` to write them.", tunnelID, credentialsFilePath, err, credentialsFilePath, tunnelID)
+	}
+	sc.log.Info().Str(LogFieldTunnelID, tunnelID.String()).Msgf("Rotated the tunnel secret and wrote the new credentials to %s", credentialsFilePath)
+
+	rotated := &rotatedCredentials{TunnelID: tunnelID, CredentialsFile: credentialsFilePath}
+	if gracePeriod <= 0 || len(previousConnectors) == 0 {
+		return rotated, nil
+	}
+	sc.log.Info().Msgf("Waiting %s for the %d running connectors to restart with the new credentials", gracePeriod, len(previousConnectors))
+	time.Sleep(gracePeriod)
+
+	currentConnectors, err := client.ListActiveClients(tunnelID)
+	if err != nil {
+		return rotated, errors.Wrap(err, "couldn't list the connectors of the tunnel")
+	}
+	for _, connectorID := range staleConnectors(previousConnectors, currentConnectors) {
+		params := cfapi.NewCleanupParams()
+		params.ForClient(connectorID)
+		if err := client.CleanupConnections(tunnelID, params); err != nil {
+			sc.log.Error().Msgf("Error disconnecting connector %s running with the previous credentials: %v", connectorID, err)
+			continue
+		}
+		sc.log.Info().Msgf("Disconnected connector %s running with the previous credentials", connectorID)
+		rotated.DisconnectedConnectors = append(rotated.DisconnectedConnectors, connectorID)
+	}
+	return rotated, nil
+}
+
+// staleConnectors returns the connectors that were running before the rotation and still are.
+func staleConnectors(previous, current []*cfapi.ActiveClient) []uuid.UUID {
+	previousIDs := make(map[uuid.UUID]bool, len(previous))
+	for _, connector := range previous {
+		previousIDs[connector.ID] = true
+	}
+	var stale []uuid.UUID
+	for _, connector := range current {
+		if previousIDs[connector.ID] {
+			stale = append(stale, connector.ID)
+		}
+	}
+	return stale
+}
+
 func (sc *subcommandContext) list(filter *cfapi.TunnelFilter) ([]*cfapi.Tunnel, error) {
 	client, err := sc.client()
 	if err != nil {
@@ -190,6 +314,7 @@ func (sc *subcommandContext) list(filter *cfapi.TunnelFilter) ([]*cfapi.Tunnel,
 
 func (sc *subcommandContext) delete(tunnelIDs []uuid.UUID) error {
 	forceFlagSet := sc.c.Bool("force")
+	cleanupDNS := sc.c.Bool("cleanup-dns")
 
 	client, err := sc.client()
 	if err != nil {
@@ -217,22 +342,145 @@ func (sc *subcommandContext) delete(tunnelIDs []uuid.UUID) error {
 				sc.log.Info().Msgf("Tunnel %v was deleted, but we could not remove its credentials file  %s: %s. Consider deleting this file manually.", id, tunnelCredentialsPath, err)
 			}
 		}
+
+		if cleanupDNS {
+			sc.cleanupDNSRecords(client, id)
+		}
 	}
 	return nil
 }
 
+// tunnelDNSRecords finds the CNAME records routing hostnames to the tunnel in the zones of the account.
+func (sc *subcommandContext) tunnelDNSRecords(client cfapi.Client, tunnelID uuid.UUID) ([]*cfapi.DNSRecord, error) {
+	zones, err := client.ListZones()
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't list the zones of the account")
+	}
+	var records []*cfapi.DNSRecord
+	for _, zone := range zones {
+		zoneRecords, err := client.ListCNAMERecords(zone.ID, cfapi.TunnelTarget(tunnelID))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't list the DNS records of zone %s", zone.Name)
+		}
+		for _, record := range zoneRecords {
+			if record.ZoneID == "" {
+				record.ZoneID, record.ZoneName = zone.ID, zone.Name
+			}
+		}
+		records = append(records, zoneRecords...)
+	}
+	return records, nil
+}
+
+// cleanupDNSRecords deletes the CNAME records routing hostnames to the deleted tunnel, the failures are only logged
+// since the tunnel is already deleted.
+func (sc *subcommandContext) cleanupDNSRecords(client cfapi.Client, tunnelID uuid.UUID) {
+	records, err := sc.tunnelDNSRecords(client, tunnelID)
+	if err != nil {
+		sc.log.Err(err).Msgf("Tunnel %s was deleted, but its DNS records couldn't be found. Consider deleting the CNAME records to %s manually.", tunnelID, cfapi.TunnelTarget(tunnelID))
+		return
+	}
+	for _, record := range records {
+		if err := client.DeleteDNSRecord(record.ZoneID, record.ID); err != nil {
+			sc.log.Err(err).Msgf("Tunnel %s was deleted, but its DNS record %s couldn't be deleted. Consider deleting it manually.", tunnelID, record.Name)
+			continue
+		}
+		sc.log.Info().Msgf("Deleted the DNS record %s routed to tunnel %s", record.Name, tunnelID)
+	}
+}
+
+// deletionPlan returns the resources that deleting the tunnels would delete: the tunnels, their connectors and IP
+// routes, that are only deleted with --force, their credentials files and, with --cleanup-dns, their DNS records.
+func (sc *subcommandContext) deletionPlan(tunnelIDs []uuid.UUID) ([]affectedResource, error) {
+	forceFlagSet := sc.c.Bool("force")
+
+	client, err := sc.client()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []affectedResource
+	for _, id := range tunnelIDs {
+		tunnel, err := client.GetTunnel(id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't get tunnel information. Please check tunnel id: %s", id)
+		}
+		if !tunnel.DeletedAt.IsZero() {
+			return nil, fmt.Errorf("Tunnel %s has already been deleted", tunnel.ID)
+		}
+		resources = append(resources, affectedResource{Kind: resourceTunnel, ID: tunnel.ID.String(), Description: tunnel.Name})
+
+		activeClients, err := client.ListActiveClients(id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't list the connectors of tunnel %s", id)
+		}
+		filter := cfapi.NewIPRouteFilter()
+		filter.NotDeleted()
+		filter.TunnelID(id)
+		routes, err := client.ListRoutes(filter)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't list the IP routes of tunnel %s", id)
+		}
+		if !forceFlagSet && (len(activeClients) > 0 || len(routes) > 0) {
+			sc.log.Warn().Msgf("Tunnel %s has %d connectors and %d IP routes, it can only be deleted with --force", id, len(activeClients), len(routes))
+		}
+		for _, activeClient := range activeClients {
+			resources = append(resources, connectorResource(id, activeClient))
+		}
+		for _, route := range routes {
+			resources = append(resources, routeResource(route))
+		}
+
+		if path, err := sc.credentialFinder(id).Path(); err == nil {
+			resources = append(resources, affectedResource{Kind: resourceCredentialsFile, ID: path, TunnelID: &tunnel.ID})
+		}
+		if !sc.c.Bool("cleanup-dns") {
+			sc.log.Info().Msgf("The DNS records routed to %s are not deleted with the tunnel without --cleanup-dns", cfapi.TunnelTarget(id))
+			continue
+		}
+		records, err := sc.tunnelDNSRecords(client, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			resources = append(resources, dnsRecordResource(id, record))
+		}
+	}
+	return resources, nil
+}
+
 // findCredentials will choose the right way to find the credentials file, find it,
 // and add the TunnelID into any old credentials (generated before TUN-3581 added the `TunnelID`
 // field to credentials files)
 func (sc *subcommandContext) findCredentials(tunnelID uuid.UUID) (connection.Credentials, error) {
+	return sc.findCredentialsIn(tunnelID, sc.c.String(CredFileFlag), sc.c.String(CredContentsFlag))
+}
+
+// findCredentialsIn finds the credentials of the tunnel in the credentials contents if set, or in the credentials
+// file.
+func (sc *subcommandContext) findCredentialsIn(tunnelID uuid.UUID, credentialsFile, credentialsContents string) (connection.Credentials, error) {
 	var credentials connection.Credentials
 	var err error
-	if credentialsContents := sc.c.String(CredContentsFlag); credentialsContents != "" {
-		if err = json.Unmarshal([]byte(credentialsContents), &credentials); err != nil {
-			err = errInvalidJSONCredential{path: "TUNNEL_CRED_CONTENTS", err: err}
+	credentialsSource := "TUNNEL_CRED_CONTENTS"
+	// The credentials file can reference a secret store so that the credentials never touch the disk
+	if credentialsContents == "" && secretstore.IsReference(credentialsFile) {
+		credentialsContents, credentialsSource = credentialsFile, credentialsFile
+	}
+	if secretstore.IsReference(credentialsContents) {
+		if credentialsContents, err = secretstore.ResolveString(sc.c.Context, credentialsContents); err != nil {
+			return credentials, errors.Wrap(err, "failed to read the tunnel credentials")
+		}
+	}
+	if credentialsContents != "" {
+		var body []byte
+		if body, err = sc.decryptCredentials([]byte(credentialsContents)); err != nil {
+			return credentials, errors.Wrapf(err, "couldn't decrypt tunnel credentials from %v", credentialsSource)
+		}
+		if err = json.Unmarshal(body, &credentials); err != nil {
+			err = errInvalidJSONCredential{path: credentialsSource, err: err}
 		}
 	} else {
-		credFinder := sc.credentialFinder(tunnelID)
+		credFinder := sc.credentialFinderFor(tunnelID, credentialsFile)
 		credentials, err = sc.readTunnelCredentials(credFinder)
 	}
 	// This line ensures backwards compatibility with credentials files generated before
@@ -266,29 +514,161 @@ func (sc *subcommandContext) runWithCredentials(credentials connection.Credentia
 	)
 }
 
-func (sc *subcommandContext) cleanupConnections(tunnelIDs []uuid.UUID) error {
+// cleanupResult is the outcome of cleaning up the connections of a tunnel.
+type cleanupResult struct {
+	TunnelID    uuid.UUID  `json:"tunnel_id"`
+	ConnectorID *uuid.UUID `json:"connector_id,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+func (sc *subcommandContext) cleanupConnections(tunnelIDs []uuid.UUID) ([]cleanupResult, error) {
 	params := cfapi.NewCleanupParams()
 	extraLog := ""
+	var connectorID *uuid.UUID
 	if connector := sc.c.String("connector-id"); connector != "" {
-		connectorID, err := uuid.Parse(connector)
+		id, err := uuid.Parse(connector)
 		if err != nil {
-			return errors.Wrapf(err, "%s is not a valid client ID (must be a UUID)", connector)
+			return nil, errors.Wrapf(err, "%s is not a valid client ID (must be a UUID)", connector)
 		}
-		params.ForClient(connectorID)
-		extraLog = fmt.Sprintf(" for connector-id %s", connectorID.String())
+		connectorID = &id
+		params.ForClient(id)
+		extraLog = fmt.Sprintf(" for connector-id %s", id.String())
 	}
 
 	client, err := sc.client()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	olderThan := sc.c.Duration("older-than")
+	results := make([]cleanupResult, 0, len(tunnelIDs))
 	for _, tunnelID := range tunnelIDs {
+		if olderThan > 0 {
+			results = append(results, sc.cleanupStaleConnectors(client, tunnelID, connectorID, time.Now().Add(-olderThan))...)
+			continue
+		}
+		result := cleanupResult{TunnelID: tunnelID, ConnectorID: connectorID}
 		sc.log.Info().Msgf("Cleanup connection for tunnel %s%s", tunnelID, extraLog)
 		if err := client.CleanupConnections(tunnelID, params); err != nil {
 			sc.log.Error().Msgf("Error cleaning up connections for tunnel %v, error :%v", tunnelID, err)
+			result.Error = err.Error()
 		}
+		results = append(results, result)
 	}
-	return nil
+	return results, nil
+}
+
+// cleanupStaleConnectors cleans up the connections of the connectors of the tunnel that are stale at the cutoff, only
+// those of the connector if it's set.
+func (sc *subcommandContext) cleanupStaleConnectors(client cfapi.Client, tunnelID uuid.UUID, connectorID *uuid.UUID, cutoff time.Time) []cleanupResult {
+	clients, err := client.ListActiveClients(tunnelID)
+	if err != nil {
+		sc.log.Error().Msgf("Error listing the connectors of tunnel %v, error :%v", tunnelID, err)
+		return []cleanupResult{{TunnelID: tunnelID, ConnectorID: connectorID, Error: err.Error()}}
+	}
+	var results []cleanupResult
+	for _, activeClient := range clients {
+		if !cleanupApplies(activeClient, connectorID, cutoff) {
+			continue
+		}
+		id := activeClient.ID
+		result := cleanupResult{TunnelID: tunnelID, ConnectorID: &id}
+		sc.log.Info().Msgf("Cleanup connection for tunnel %s for connector-id %s, last connected at %s", tunnelID, id, lastConnectedAt(activeClient).Format(time.RFC3339))
+		params := cfapi.NewCleanupParams()
+		params.ForClient(id)
+		if err := client.CleanupConnections(tunnelID, params); err != nil {
+			sc.log.Error().Msgf("Error cleaning up connections for tunnel %v, error :%v", tunnelID, err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		sc.log.Info().Msgf("No connector of tunnel %s is disconnected since before %s", tunnelID, cutoff.Format(time.RFC3339))
+	}
+	return results
+}
+
+// cleanupPlan returns the connectors whose connections cleaning up the tunnels would delete.
+func (sc *subcommandContext) cleanupPlan(tunnelIDs []uuid.UUID) ([]affectedResource, error) {
+	var connectorID *uuid.UUID
+	if connector := sc.c.String("connector-id"); connector != "" {
+		id, err := uuid.Parse(connector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid client ID (must be a UUID)", connector)
+		}
+		connectorID = &id
+	}
+	var cutoff time.Time
+	if olderThan := sc.c.Duration("older-than"); olderThan > 0 {
+		cutoff = time.Now().Add(-olderThan)
+	}
+
+	client, err := sc.client()
+	if err != nil {
+		return nil, err
+	}
+	var resources []affectedResource
+	for _, tunnelID := range tunnelIDs {
+		clients, err := client.ListActiveClients(tunnelID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't list the connectors of tunnel %s", tunnelID)
+		}
+		for _, activeClient := range clients {
+			if cleanupApplies(activeClient, connectorID, cutoff) {
+				resources = append(resources, connectorResource(tunnelID, activeClient))
+			}
+		}
+	}
+	return resources, nil
+}
+
+// cleanupApplies tells if the connections of the connector are cleaned up, when it's the given connector if set and
+// it is stale if the cutoff is set.
+func cleanupApplies(client *cfapi.ActiveClient, connectorID *uuid.UUID, cutoff time.Time) bool {
+	if connectorID != nil && client.ID != *connectorID {
+		return false
+	}
+	return cutoff.IsZero() || isStale(client, cutoff)
+}
+
+// isStale tells if the connector has no live connection, and hasn't connected since the cutoff. The API doesn't
+// report when a connection went down, so a connector with a live connection is never stale, however long ago it
+// connected.
+func isStale(client *cfapi.ActiveClient, cutoff time.Time) bool {
+	for _, conn := range client.Connections {
+		if !conn.IsPendingReconnect {
+			return false
+		}
+	}
+	return !lastConnectedAt(client).After(cutoff)
+}
+
+// lastConnectedAt returns when the most recent connection of the connector was opened, or when it started running
+// if it has no connection.
+func lastConnectedAt(client *cfapi.ActiveClient) time.Time {
+	last := client.RunAt
+	for _, conn := range client.Connections {
+		if conn.OpenedAt.After(last) {
+			last = conn.OpenedAt
+		}
+	}
+	return last
+}
+
+// connectedTunnelIDs returns the tunnels of the account that have connections.
+func (sc *subcommandContext) connectedTunnelIDs() ([]uuid.UUID, error) {
+	filter := cfapi.NewTunnelFilter()
+	filter.NoDeleted()
+	tunnels, err := sc.list(filter)
+	if err != nil {
+		return nil, err
+	}
+	var tunnelIDs []uuid.UUID
+	for _, tunnel := range tunnels {
+		if len(tunnel.Connections) > 0 {
+			tunnelIDs = append(tunnelIDs, tunnel.ID)
+		}
+	}
+	return tunnelIDs, nil
 }
 
 func (sc *subcommandContext) getTunnelTokenCredentials(tunnelID uuid.UUID) (*connection.TunnelToken, error) {
@@ -312,7 +692,47 @@ func (sc *subcommandContext) route(tunnelID uuid.UUID, r cfapi.HostnameRoute) (c
 		return nil, err
 	}
 
-	return client.RouteTunnel(tunnelID, r)
+	result, err := client.RouteTunnel(tunnelID, r)
+	if err != nil {
+		return nil, err
+	}
+	if dnsRoute, ok := r.(*cfapi.DNSRoute); ok && dnsRoute.RecordOptions() != (cfapi.DNSRecordOptions{}) {
+		if err := sc.setDNSRecordOptions(client, tunnelID, dnsRoute.Hostname(), dnsRoute.RecordOptions()); err != nil {
+			return nil, errors.Wrapf(err, "%s routes to the tunnel, but the TTL and proxied status of its record couldn't be set", dnsRoute.Hostname())
+		}
+	}
+	return result, nil
+}
+
+// hostnameDNSRecords finds the zone of the account that hostname is in, and the records of hostname in it.
+func (sc *subcommandContext) hostnameDNSRecords(client cfapi.Client, hostname string) (*cfapi.Zone, []*cfapi.DNSRecord, error) {
+	zones, err := client.ListZones()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Can't list the zones of the account")
+	}
+	zone := cfapi.ZoneOf(zones, hostname)
+	if zone == nil {
+		return nil, nil, fmt.Errorf("%s isn't in any zone of the account", hostname)
+	}
+	records, err := client.ListDNSRecords(zone.ID, hostname)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Can't list the DNS records of %s", hostname)
+	}
+	return zone, records, nil
+}
+
+// setDNSRecordOptions applies the options to the CNAME record routing hostname to the tunnel.
+func (sc *subcommandContext) setDNSRecordOptions(client cfapi.Client, tunnelID uuid.UUID, hostname string, options cfapi.DNSRecordOptions) error {
+	zone, records, err := sc.hostnameDNSRecords(client, hostname)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record.Type == "CNAME" && record.Content == cfapi.TunnelTarget(tunnelID) {
+			return client.UpdateDNSRecord(zone.ID, record.ID, options)
+		}
+	}
+	return fmt.Errorf("there is no CNAME record of %s to %s", hostname, cfapi.TunnelTarget(tunnelID))
 }
 
 // Query Tunnelstore to find the active tunnel with the given name.
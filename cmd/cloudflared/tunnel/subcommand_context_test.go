@@ -1,9 +1,12 @@
 package tunnel
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"flag"
 	"fmt"
+	"net"
 	"reflect"
 	"testing"
 	"time"
@@ -12,13 +15,21 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
 
 	"github.com/cloudflare/cloudflared/cfapi"
 	"github.com/cloudflare/cloudflared/connection"
 	"github.com/cloudflare/cloudflared/credentials"
+	"github.com/cloudflare/cloudflared/secretstore"
 )
 
+type staticSecretStore map[string]string
+
+func (s staticSecretStore) Fetch(_ context.Context, ref *secretstore.Reference) ([]byte, error) {
+	return []byte(s[ref.Name]), nil
+}
+
 type mockFileSystem struct {
 	rf  func(string) ([]byte, error)
 	vfp func(string) bool
@@ -162,7 +173,33 @@ func Test_subcommandContext_findCredentials(t *testing.T) {
 				TunnelSecret: secret,
 			},
 		},
+		{
+			name: "TUNNEL_CRED_FILE referencing a secret store",
+			fields: fields{
+				log: &log,
+				fs:  fs,
+				c: func() *cli.Context {
+					flagSet := flag.NewFlagSet("test0", flag.PanicOnError)
+					flagSet.String(CredFileFlag, "", "")
+					flagSet.String(CredContentsFlag, "", "")
+					c := cli.NewContext(cli.NewApp(), flagSet, nil)
+					_ = c.Set(CredFileFlag, "test://tunnel")
+					return c
+				}(),
+			},
+			args: args{
+				tunnelID: tunnelID,
+			},
+			want: connection.Credentials{
+				AccountTag:   accountTag,
+				TunnelID:     tunnelID,
+				TunnelSecret: secret,
+			},
+		},
 	}
+	secretstore.Register("test", staticSecretStore{
+		"tunnel": fmt.Sprintf(`{"AccountTag":"%s","TunnelSecret":"%s","TunnelID":"%s"}`, accountTag, secretB64, tunnelID),
+	})
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			sc := &subcommandContext{
@@ -188,12 +225,17 @@ type deleteMockTunnelStore struct {
 	cfapi.Client
 	mockTunnels      map[uuid.UUID]mockTunnelBehaviour
 	deletedTunnelIDs []uuid.UUID
+	// dnsRecords are the records of zone example.com
+	dnsRecords       []*cfapi.DNSRecord
+	deletedRecordIDs []string
 }
 
 type mockTunnelBehaviour struct {
-	tunnel     cfapi.Tunnel
-	deleteErr  error
-	cleanupErr error
+	tunnel        cfapi.Tunnel
+	deleteErr     error
+	cleanupErr    error
+	activeClients []*cfapi.ActiveClient
+	routes        []*cfapi.DetailedRoute
 }
 
 func newDeleteMockTunnelStore(tunnels ...mockTunnelBehaviour) *deleteMockTunnelStore {
@@ -243,6 +285,42 @@ func (d *deleteMockTunnelStore) CleanupConnections(tunnelID uuid.UUID, _ *cfapi.
 	return tunnel.cleanupErr
 }
 
+func (d *deleteMockTunnelStore) ListActiveClients(tunnelID uuid.UUID) ([]*cfapi.ActiveClient, error) {
+	tunnel, ok := d.mockTunnels[tunnelID]
+	if !ok {
+		return nil, fmt.Errorf("Couldn't find tunnel: %v", tunnelID)
+	}
+	return tunnel.activeClients, nil
+}
+
+func (d *deleteMockTunnelStore) ListRoutes(*cfapi.IpRouteFilter) ([]*cfapi.DetailedRoute, error) {
+	// The filter isn't applied, each tunnel of the mock has its own routes
+	var routes []*cfapi.DetailedRoute
+	for _, tunnel := range d.mockTunnels {
+		routes = append(routes, tunnel.routes...)
+	}
+	return routes, nil
+}
+
+func (d *deleteMockTunnelStore) ListZones() ([]*cfapi.Zone, error) {
+	return []*cfapi.Zone{{ID: "zone", Name: "example.com"}}, nil
+}
+
+func (d *deleteMockTunnelStore) ListCNAMERecords(zoneID string, target string) ([]*cfapi.DNSRecord, error) {
+	var records []*cfapi.DNSRecord
+	for _, record := range d.dnsRecords {
+		if record.Content == target {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (d *deleteMockTunnelStore) DeleteDNSRecord(zoneID string, recordID string) error {
+	d.deletedRecordIDs = append(d.deletedRecordIDs, recordID)
+	return nil
+}
+
 func Test_subcommandContext_Delete(t *testing.T) {
 	type fields struct {
 		c                 *cli.Context
@@ -324,6 +402,151 @@ func Test_subcommandContext_Delete(t *testing.T) {
 	}
 }
 
+func Test_subcommandContext_CleanupConnections(t *testing.T) {
+	tunnelID1 := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	tunnelID2 := uuid.MustParse("af5ed608-b8b4-4109-89f3-9f2cf199df64")
+	connectorID := uuid.MustParse("cf5ed608-b8b4-4109-89f3-9f2cf199df64")
+	log := zerolog.Nop()
+
+	flagSet := flag.NewFlagSet("cleanup", flag.PanicOnError)
+	flagSet.String("connector-id", connectorID.String(), "")
+	sc := &subcommandContext{
+		c:   cli.NewContext(cli.NewApp(), flagSet, nil),
+		log: &log,
+		tunnelstoreClient: newDeleteMockTunnelStore(
+			mockTunnelBehaviour{tunnel: cfapi.Tunnel{ID: tunnelID1}},
+			mockTunnelBehaviour{tunnel: cfapi.Tunnel{ID: tunnelID2}, cleanupErr: errors.New("tunnel has active connections")},
+		),
+	}
+
+	results, err := sc.cleanupConnections([]uuid.UUID{tunnelID1, tunnelID2})
+	assert.NoError(t, err)
+	assert.Equal(t, []cleanupResult{
+		{TunnelID: tunnelID1, ConnectorID: &connectorID},
+		{TunnelID: tunnelID2, ConnectorID: &connectorID, Error: "tunnel has active connections"},
+	}, results)
+}
+
+func Test_subcommandContext_CleanupStaleConnectors(t *testing.T) {
+	tunnelID1 := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	tunnelID2 := uuid.MustParse("af5ed608-b8b4-4109-89f3-9f2cf199df64")
+	staleID := uuid.MustParse("cf5ed608-b8b4-4109-89f3-9f2cf199df64")
+	reconnectedID := uuid.MustParse("bf5ed608-b8b4-4109-89f3-9f2cf199df64")
+	recentID := uuid.MustParse("ef5ed608-b8b4-4109-89f3-9f2cf199df64")
+	healthyID := uuid.MustParse("0f5ed608-b8b4-4109-89f3-9f2cf199df64")
+	goneID := uuid.MustParse("1f5ed608-b8b4-4109-89f3-9f2cf199df64")
+	now := time.Now()
+	log := zerolog.Nop()
+
+	flagSet := flag.NewFlagSet("cleanup", flag.PanicOnError)
+	flagSet.String("connector-id", "", "")
+	flagSet.Duration("older-than", 72*time.Hour, "")
+	sc := &subcommandContext{
+		c:   cli.NewContext(cli.NewApp(), flagSet, nil),
+		log: &log,
+		tunnelstoreClient: newDeleteMockTunnelStore(
+			mockTunnelBehaviour{
+				tunnel: cfapi.Tunnel{ID: tunnelID1},
+				activeClients: []*cfapi.ActiveClient{
+					{ID: staleID, RunAt: now.Add(-30 * 24 * time.Hour), Connections: []cfapi.Connection{{OpenedAt: now.Add(-7 * 24 * time.Hour), IsPendingReconnect: true}}},
+					// Disconnected, but connected recently
+					{ID: reconnectedID, RunAt: now.Add(-30 * 24 * time.Hour), Connections: []cfapi.Connection{{OpenedAt: now.Add(-time.Hour), IsPendingReconnect: true}}},
+					{ID: recentID, RunAt: now.Add(-time.Hour)},
+					// Running and connected for long
+					{ID: healthyID, RunAt: now.Add(-30 * 24 * time.Hour), Connections: []cfapi.Connection{
+						{OpenedAt: now.Add(-30 * 24 * time.Hour)},
+						{OpenedAt: now.Add(-20 * 24 * time.Hour), IsPendingReconnect: true},
+					}},
+					{ID: goneID, RunAt: now.Add(-7 * 24 * time.Hour)},
+				},
+			},
+			mockTunnelBehaviour{tunnel: cfapi.Tunnel{ID: tunnelID2}},
+		),
+	}
+
+	results, err := sc.cleanupConnections([]uuid.UUID{tunnelID1, tunnelID2})
+	assert.NoError(t, err)
+	assert.Equal(t, []cleanupResult{{TunnelID: tunnelID1, ConnectorID: &staleID}, {TunnelID: tunnelID1, ConnectorID: &goneID}}, results)
+
+	// Only the given connector is considered, it connected recently
+	_ = sc.c.Set("connector-id", recentID.String())
+	results, err = sc.cleanupConnections([]uuid.UUID{tunnelID1})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func Test_subcommandContext_DryRun(t *testing.T) {
+	tunnelID := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	connectorID := uuid.MustParse("cf5ed608-b8b4-4109-89f3-9f2cf199df64")
+	routeID := uuid.MustParse("bf5ed608-b8b4-4109-89f3-9f2cf199df64")
+	_, network, err := net.ParseCIDR("10.0.0.0/16")
+	require.NoError(t, err)
+	log := zerolog.Nop()
+
+	flagSet := flag.NewFlagSet("delete", flag.PanicOnError)
+	flagSet.Bool("force", false, "")
+	flagSet.Bool("cleanup-dns", false, "")
+	flagSet.String("connector-id", "", "")
+	flagSet.Duration("older-than", 0, "")
+	flagSet.String(CredFileFlag, "", "")
+	flagSet.String(CredContentsFlag, "", "")
+	store := newDeleteMockTunnelStore(mockTunnelBehaviour{
+		tunnel: cfapi.Tunnel{ID: tunnelID, Name: "web"},
+		activeClients: []*cfapi.ActiveClient{
+			{ID: connectorID, Version: "2024.1.0", RunAt: time.Now(), Connections: []cfapi.Connection{{OriginIP: net.ParseIP("10.1.2.3")}}},
+		},
+		routes: []*cfapi.DetailedRoute{{ID: routeID, Network: cfapi.CIDR(*network), TunnelID: tunnelID}},
+	})
+	sc := &subcommandContext{
+		c:                 cli.NewContext(cli.NewApp(), flagSet, nil),
+		log:               &log,
+		fs:                mockFileSystem{vfp: func(string) bool { return false }},
+		tunnelstoreClient: store,
+	}
+
+	resources, err := sc.deletionPlan([]uuid.UUID{tunnelID})
+	require.NoError(t, err)
+	var printed bytes.Buffer
+	printAffectedResources(&printed, resources)
+	assert.Equal(t, `The following would be deleted (dry run, nothing was changed):
+- tunnel df5ed608-b8b4-4109-89f3-9f2cf199df64 (web)
+- connector cf5ed608-b8b4-4109-89f3-9f2cf199df64 (1 connections, from 10.1.2.3, version 2024.1.0)
+- ip route bf5ed608-b8b4-4109-89f3-9f2cf199df64 (10.0.0.0/16)
+`, printed.String())
+	assert.Empty(t, store.deletedTunnelIDs)
+
+	resources, err = sc.cleanupPlan([]uuid.UUID{tunnelID})
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	assert.Equal(t, resourceConnector, resources[0].Kind)
+	assert.Equal(t, connectorID.String(), resources[0].ID)
+
+	// The connector connected recently
+	_ = sc.c.Set("older-than", "1h")
+	resources, err = sc.cleanupPlan([]uuid.UUID{tunnelID})
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+
+	store.dnsRecords = []*cfapi.DNSRecord{
+		{ID: "web", Name: "web.example.com", Type: "CNAME", Content: cfapi.TunnelTarget(tunnelID)},
+		{ID: "other", Name: "other.example.com", Type: "CNAME", Content: cfapi.TunnelTarget(uuid.New())},
+	}
+	_ = sc.c.Set("cleanup-dns", "true")
+	resources, err = sc.deletionPlan([]uuid.UUID{tunnelID})
+	require.NoError(t, err)
+	require.Len(t, resources, 4)
+	assert.Equal(t, affectedResource{
+		Kind:        resourceDNSRecord,
+		ID:          "web",
+		Description: "web.example.com CNAME df5ed608-b8b4-4109-89f3-9f2cf199df64.cfargotunnel.com in zone example.com",
+		TunnelID:    &tunnelID,
+	}, resources[3])
+
+	require.NoError(t, sc.delete([]uuid.UUID{tunnelID}))
+	assert.Equal(t, []uuid.UUID{tunnelID}, store.deletedTunnelIDs)
+	assert.Equal(t, []string{"web"}, store.deletedRecordIDs)
+}
+
 func Test_subcommandContext_ValidateIngressCommand(t *testing.T) {
 	var tests = []struct {
 		name        string
@@ -368,3 +591,55 @@ func Test_subcommandContext_ValidateIngressCommand(t *testing.T) {
 		})
 	}
 }
+
+// routeMockClient is a zone with DNS records, routing a hostname adds a CNAME record to the tunnel.
+type routeMockClient struct {
+	cfapi.Client
+	records []*cfapi.DNSRecord
+	updates map[string]cfapi.DNSRecordOptions
+}
+
+func (m *routeMockClient) RouteTunnel(tunnelID uuid.UUID, route cfapi.HostnameRoute) (cfapi.HostnameRouteResult, error) {
+	hostname := route.(*cfapi.DNSRoute).Hostname()
+	m.records = append(m.records, &cfapi.DNSRecord{ID: hostname, Name: hostname, Type: "CNAME", Content: cfapi.TunnelTarget(tunnelID)})
+	return &cfapi.DNSRouteResult{CName: cfapi.ChangeNew, Name: hostname}, nil
+}
+
+func (m *routeMockClient) ListZones() ([]*cfapi.Zone, error) {
+	return []*cfapi.Zone{{ID: "zone", Name: "example.com"}, {ID: "other-zone", Name: "example.org"}}, nil
+}
+
+func (m *routeMockClient) ListDNSRecords(zoneID string, name string) ([]*cfapi.DNSRecord, error) {
+	var records []*cfapi.DNSRecord
+	for _, record := range m.records {
+		if record.Name == name {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m *routeMockClient) UpdateDNSRecord(zoneID string, recordID string, options cfapi.DNSRecordOptions) error {
+	m.updates[recordID] = options
+	return nil
+}
+
+func Test_subcommandContext_RouteDNSRecordOptions(t *testing.T) {
+	tunnelID := uuid.New()
+	log := zerolog.Nop()
+	client := &routeMockClient{updates: make(map[string]cfapi.DNSRecordOptions)}
+	sc := &subcommandContext{log: &log, tunnelstoreClient: client}
+
+	_, err := sc.route(tunnelID, cfapi.NewDNSRoute("app.example.com", false))
+	require.NoError(t, err)
+	assert.Empty(t, client.updates, "the record is left as the routes API created it")
+
+	proxied := false
+	options := cfapi.DNSRecordOptions{TTL: 300, Proxied: &proxied}
+	_, err = sc.route(tunnelID, cfapi.NewDNSRouteWithOptions("api.example.com", false, options))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]cfapi.DNSRecordOptions{"api.example.com": options}, client.updates)
+
+	_, err = sc.route(tunnelID, cfapi.NewDNSRouteWithOptions("app.example.net", false, options))
+	assert.ErrorContains(t, err, "isn't in any zone of the account")
+}
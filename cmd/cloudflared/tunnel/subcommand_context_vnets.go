@@ -1,6 +1,9 @@
 package tunnel
 
 import (
+	"fmt"
+	"net/netip"
+
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
@@ -38,3 +41,42 @@ func (sc *subcommandContext) updateVirtualNetwork(vnetId uuid.UUID, updates cfap
 	}
 	return client.UpdateVirtualNetwork(vnetId, updates)
 }
+
+// tunnelVirtualNetworkRoutes returns the routes to the tunnel in the virtual networks, given by name or ID.
+func (sc *subcommandContext) tunnelVirtualNetworkRoutes(tunnelID uuid.UUID, vnets []string) ([]netip.Prefix, error) {
+	filter := cfapi.NewVnetFilter()
+	filter.WithDeleted(false)
+	existing, err := sc.listVirtualNetworks(filter)
+	if err != nil {
+		return nil, err
+	}
+	var routes []netip.Prefix
+	for _, vnet := range vnets {
+		var vnetID *uuid.UUID
+		for _, candidate := range existing {
+			if candidate.Name == vnet || candidate.ID.String() == vnet {
+				vnetID = &candidate.ID
+				break
+			}
+		}
+		if vnetID == nil {
+			return nil, fmt.Errorf("there is no virtual network %s", vnet)
+		}
+		routeFilter := cfapi.NewIPRouteFilter()
+		routeFilter.NotDeleted()
+		routeFilter.TunnelID(tunnelID)
+		routeFilter.VNetID(*vnetID)
+		vnetRoutes, err := sc.listRoutes(routeFilter)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list the routes of virtual network %s", vnet)
+		}
+		for _, route := range vnetRoutes {
+			prefix, err := netip.ParsePrefix(route.Network.String())
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, prefix)
+		}
+	}
+	return routes, nil
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/cloudflare/cloudflared/connection"
 	"github.com/cloudflare/cloudflared/diagnostic"
 	"github.com/cloudflare/cloudflared/metrics"
+	"github.com/cloudflare/cloudflared/secretstore"
 )
 
 const (
@@ -39,6 +40,8 @@ const (
 	CredFileFlag            = "credentials-file"
 	CredContentsFlag        = "credentials-contents"
 	TunnelTokenFlag         = "token"
+	TunnelTokenFileFlag     = "token-file"
+	TunnelTokenFDFlag       = "token-fd"
 	overwriteDNSFlagName    = "overwrite-dns"
 	noDiagLogsFlagName      = "no-diag-logs"
 	noDiagMetricsFlagName   = "no-diag-metrics"
@@ -85,6 +88,11 @@ var (
 		Aliases: []string{"i"},
 		Usage:   "List tunnel by `ID`",
 	}
+	listLabelFlag = &cli.StringSliceFlag{
+		Name:    "label",
+		Aliases: []string{"l"},
+		Usage:   "List tunnels with the label `KEY=VALUE`, or with the label KEY whatever its value. Tunnels must have all the labels when repeated",
+	}
 	showRecentlyDisconnected = &cli.BoolFlag{
 		Name:    "show-recently-disconnected",
 		Aliases: []string{"rd"},
@@ -114,20 +122,30 @@ var (
 	credentialsFileFlagCLIOnly = &cli.StringFlag{
 		Name:    CredFileFlag,
 		Aliases: []string{CredFileFlagAlias},
-		Usage:   "Filepath at which to read/write the tunnel credentials",
+		Usage:   "Filepath at which to read/write the tunnel credentials. When running a tunnel, the credentials can instead be read from a secret store with a vault:// or awssm:// reference",
 		EnvVars: []string{"TUNNEL_CRED_FILE"},
 	}
 	credentialsFileFlag     = altsrc.NewStringFlag(credentialsFileFlagCLIOnly)
 	credentialsContentsFlag = altsrc.NewStringFlag(&cli.StringFlag{
 		Name:    CredContentsFlag,
-		Usage:   "Contents of the tunnel credentials JSON file to use. When provided along with credentials-file, this will take precedence.",
+		Usage:   "Contents of the tunnel credentials JSON file to use, or a vault:// or awssm:// reference to read them from a secret store. When provided along with credentials-file, this will take precedence.",
 		EnvVars: []string{"TUNNEL_CRED_CONTENTS"},
 	})
 	tunnelTokenFlag = altsrc.NewStringFlag(&cli.StringFlag{
 		Name:    TunnelTokenFlag,
-		Usage:   "The Tunnel token. When provided along with credentials, this will take precedence.",
+		Usage:   "The Tunnel token, or a vault:// or awssm:// reference to read it from a secret store. When provided along with credentials, this will take precedence.",
 		EnvVars: []string{"TUNNEL_TOKEN"},
 	})
+	tunnelTokenFileFlag = altsrc.NewStringFlag(&cli.StringFlag{
+		Name:    TunnelTokenFileFlag,
+		Usage:   "Read the Tunnel token from `FILE`, or from stdin if -, so that it isn't visible in process listings.",
+		EnvVars: []string{"TUNNEL_TOKEN_FILE"},
+	})
+	tunnelTokenFDFlag = &cli.IntFlag{
+		Name:  TunnelTokenFDFlag,
+		Usage: "Read the Tunnel token from the file descriptor `FD` inherited from the parent process, e.g. --token-fd 3 3<<<\"$TOKEN\".",
+		Value: -1,
+	}
 	forceDeleteFlag = &cli.BoolFlag{
 		Name:    "force",
 		Aliases: []string{"f"},
@@ -135,6 +153,10 @@ var (
 			" It is not possible to delete tunnels that have connections or non-deleted dependencies, without this flag.",
 		EnvVars: []string{"TUNNEL_RUN_FORCE_OVERWRITE"},
 	}
+	cleanupDNSFlag = &cli.BoolFlag{
+		Name:  "cleanup-dns",
+		Usage: "Also delete the CNAME records of the zones of the account that route hostnames to the tunnel.",
+	}
 	selectProtocolFlag = altsrc.NewStringFlag(&cli.StringFlag{
 		Name:    "protocol",
 		Value:   connection.AutoSelectFlag,
@@ -167,6 +189,15 @@ var (
 		Usage:   `Constraints the cleanup to stop the connections of a single Connector (by its ID). You can find the various Connectors (and their IDs) currently connected to your tunnel via 'cloudflared tunnel info <name>'.`,
 		EnvVars: []string{"TUNNEL_CLEANUP_CONNECTOR"},
 	}
+	cleanupOlderThanFlag = &cli.DurationFlag{
+		Name:    "older-than",
+		Usage:   "Only cleanup the connections of the Connectors that have no live connection and haven't connected for longer than the duration, e.g. 72h. The Connectors with a live connection are kept, however long ago they connected.",
+		EnvVars: []string{"TUNNEL_CLEANUP_OLDER_THAN"},
+	}
+	cleanupAllTunnelsFlag = &cli.BoolFlag{
+		Name:  "all-tunnels",
+		Usage: "Cleanup the connections of all the tunnels of the account instead of the given ones. Requires --older-than, so that the running Connectors are kept.",
+	}
 	overwriteDNSFlag = &cli.BoolFlag{
 		Name:    overwriteDNSFlagName,
 		Aliases: []string{"f"},
@@ -179,6 +210,15 @@ var (
 		Usage:   "Base64 encoded secret to set for the tunnel. The decoded secret must be at least 32 bytes long. If not specified, a random 32-byte secret will be generated.",
 		EnvVars: []string{"TUNNEL_CREATE_SECRET"},
 	}
+	rotateGracePeriodFlag = &cli.DurationFlag{
+		Name:  "grace-period",
+		Usage: "Disconnect the connectors still running with the previous credentials after this `DURATION`. They stay connected until they restart if 0",
+	}
+	createLabelFlag = &cli.StringSliceFlag{
+		Name:    "label",
+		Aliases: []string{"l"},
+		Usage:   "Label the tunnel with a `KEY=VALUE` pair to organize tunnels, can be repeated",
+	}
 	icmpv4SrcFlag = &cli.StringFlag{
 		Name:    "icmpv4-src",
 		Usage:   "Source address to send/receive ICMPv4 messages. If not provided cloudflared will dial a local address to determine the source IP or fallback to 0.0.0.0.",
@@ -242,8 +282,12 @@ func buildCreateCommand() *cli.Command {
 
   For example, to create a tunnel named 'my-tunnel' run:
 
-  $ cloudflared tunnel create my-tunnel`,
-		Flags:              []cli.Flag{outputFormatFlag, credentialsFileFlagCLIOnly, createSecretFlag},
+  $ cloudflared tunnel create my-tunnel
+
+  Tunnels can be labeled to find them with "cloudflared tunnel list --label":
+
+  $ cloudflared tunnel create --label env=prod --label site=ams my-tunnel`,
+		Flags:              []cli.Flag{outputFormatFlag, credentialsFileFlagCLIOnly, createSecretFlag, createLabelFlag, encryptCredentialsFlag, credentialsPassphraseFileFlag},
 		CustomHelpTemplate: commandHelpTemplate(),
 	}
 }
@@ -265,11 +309,18 @@ func createCommand(c *cli.Context) error {
 		return cliutil.UsageError(`"cloudflared tunnel create" requires exactly 1 argument, the name of tunnel to create.`)
 	}
 	name := c.Args().First()
+	labels, err := parseLabels(c.StringSlice(createLabelFlag.Name))
+	if err != nil {
+		return err
+	}
+	if err := validateEncryptionKey(c); err != nil {
+		return err
+	}
 
 	warningChecker := updater.StartWarningCheck(c)
 	defer warningChecker.LogWarningIfAny(sc.log)
 
-	_, err = sc.create(name, c.String(CredFileFlag), c.String(createSecretFlag.Name))
+	_, err = sc.create(name, c.String(CredFileFlag), c.String(createSecretFlag.Name), labels)
 	return errors.Wrap(err, "failed to create tunnel")
 }
 
@@ -279,20 +330,37 @@ func tunnelFilePath(tunnelID uuid.UUID, directory string) (string, error) {
 	return homedir.Expand(filePath)
 }
 
-// writeTunnelCredentials saves `credentials` as a JSON into `filePath`, only if
+// writeTunnelCredentials saves the encoded credentials `body` into `filePath`, only if
 // the file does not exist already
-func writeTunnelCredentials(filePath string, credentials *connection.Credentials) error {
+func writeTunnelCredentials(filePath string, body []byte) error {
 	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
 		if err == nil {
 			return fmt.Errorf("%s already exists", filePath)
 		}
 		return err
 	}
-	body, err := json.Marshal(credentials)
+	return os.WriteFile(filePath, body, 0400)
+}
+
+// replaceTunnelCredentials saves the encoded credentials `body` into `filePath`, replacing the existing file at once
+// so that a connector starting meanwhile never reads a partial file
+func replaceTunnelCredentials(filePath string, body []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".tmp")
 	if err != nil {
-		return errors.Wrap(err, "Unable to marshal tunnel credentials to JSON")
+		return err
 	}
-	return os.WriteFile(filePath, body, 0400)
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0400); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
 }
 
 func buildListCommand() *cli.Command {
@@ -310,6 +378,7 @@ func buildListCommand() *cli.Command {
 			listExcludeNamePrefixFlag,
 			listExistedAtFlag,
 			listIDFlag,
+			listLabelFlag,
 			showRecentlyDisconnected,
 			sortByFlag,
 			invertSortFlag,
@@ -353,11 +422,16 @@ func listCommand(c *cli.Context) error {
 	if maxFetch := c.Int("max-fetch-size"); maxFetch > 0 {
 		filter.MaxFetchSize(uint(maxFetch))
 	}
+	selectors, err := parseLabelSelectors(c.StringSlice(listLabelFlag.Name))
+	if err != nil {
+		return err
+	}
 
 	tunnels, err := sc.list(filter)
 	if err != nil {
 		return err
 	}
+	tunnels = filterByLabels(tunnels, selectors)
 
 	// Sort the tunnels
 	sortBy := c.String("sort-by")
@@ -408,8 +482,18 @@ func formatAndPrintTunnelList(tunnels []*cfapi.Tunnel, showRecentlyDisconnected
 
 	_, _ = fmt.Fprintln(writer, "You can obtain more detailed information for each tunnel with `cloudflared tunnel info <name/uuid>`")
 
+	// The labels column is only shown when tunnels are labeled
+	showLabels := false
+	for _, t := range tunnels {
+		showLabels = showLabels || len(t.Metadata.Labels) > 0
+	}
+
 	// Print column headers with tabbed columns
-	_, _ = fmt.Fprintln(writer, "ID\tNAME\tCREATED\tCONNECTIONS\t")
+	if showLabels {
+		_, _ = fmt.Fprintln(writer, "ID\tNAME\tCREATED\tCONNECTIONS\tLABELS\t")
+	} else {
+		_, _ = fmt.Fprintln(writer, "ID\tNAME\tCREATED\tCONNECTIONS\t")
+	}
 
 	// Loop through tunnels, create formatted string for each, and print using tabwriter
 	for _, t := range tunnels {
@@ -420,6 +504,9 @@ func formatAndPrintTunnelList(tunnels []*cfapi.Tunnel, showRecentlyDisconnected
 			t.CreatedAt.Format(time.RFC3339),
 			fmtConnections(t.Connections, showRecentlyDisconnected),
 		)
+		if showLabels {
+			formattedStr += fmtLabels(t.Metadata.Labels) + "\t"
+		}
 		_, _ = fmt.Fprintln(writer, formattedStr)
 	}
 }
@@ -649,8 +736,8 @@ func buildDeleteCommand() *cli.Command {
 		Action:             cliutil.ConfiguredAction(deleteCommand),
 		Usage:              "Delete existing tunnel by UUID or name",
 		UsageText:          "cloudflared tunnel [tunnel command options] delete [subcommand options] TUNNEL",
-		Description:        "cloudflared tunnel delete will delete tunnels with the given tunnel UUIDs or names. A tunnel cannot be deleted if it has active connections. To delete the tunnel unconditionally, use -f flag.",
-		Flags:              []cli.Flag{credentialsFileFlagCLIOnly, forceDeleteFlag},
+		Description:        "cloudflared tunnel delete will delete tunnels with the given tunnel UUIDs or names. A tunnel cannot be deleted if it has active connections. To delete the tunnel unconditionally, use -f flag. Use --cleanup-dns to delete the DNS records routed to the tunnel too, and --dry-run to list what would be deleted first.",
+		Flags:              []cli.Flag{outputFormatFlag, credentialsFileFlagCLIOnly, forceDeleteFlag, cleanupDNSFlag, dryRunFlag},
 		CustomHelpTemplate: commandHelpTemplate(),
 	}
 }
@@ -673,7 +760,31 @@ func deleteCommand(c *cli.Context) error {
 		return err
 	}
 
-	return sc.delete(tunnelIDs)
+	if c.Bool(dryRunFlag.Name) {
+		resources, err := sc.deletionPlan(tunnelIDs)
+		if err != nil {
+			return err
+		}
+		return renderDryRun(c, resources)
+	}
+
+	if err := sc.delete(tunnelIDs); err != nil {
+		return err
+	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		deleted := make([]deletedOutput, 0, len(tunnelIDs))
+		for _, id := range tunnelIDs {
+			deleted = append(deleted, deletedOutput{ID: id, Deleted: true})
+		}
+		return renderOutput(outputFormat, deleted)
+	}
+	return nil
+}
+
+// deletedOutput is the structured output of the commands deleting tunnels, routes and virtual networks.
+type deletedOutput struct {
+	ID      uuid.UUID `json:"id"`
+	Deleted bool      `json:"deleted"`
 }
 
 func renderOutput(format string, v interface{}) error {
@@ -693,10 +804,13 @@ func buildRunCommand() *cli.Command {
 	flags := []cli.Flag{
 		credentialsFileFlag,
 		credentialsContentsFlag,
+		credentialsPassphraseFileFlag,
 		postQuantumFlag,
 		selectProtocolFlag,
 		featuresFlag,
 		tunnelTokenFlag,
+		tunnelTokenFileFlag,
+		tunnelTokenFDFlag,
 		icmpv4SrcFlag,
 		icmpv6SrcFlag,
 	}
@@ -714,6 +828,10 @@ func buildRunCommand() *cli.Command {
   however it does not need access to cert.pem from "cloudflared login" if you identify the tunnel by UUID.
   If you experience other problems running the tunnel, "cloudflared tunnel cleanup" may help by removing
   any old connection records.
+
+  Several tunnels can be run by a single process by listing them in the "tunnels" section of the
+  configuration file, each with its own "tunnel", "credentials-file" and "ingress". The tunnels share
+  the metrics server, which serves the readiness and diagnostics of each of them under /tunnels/TUNNEL/.
 `,
 		Flags:              flags,
 		CustomHelpTemplate: commandHelpTemplate(),
@@ -736,8 +854,16 @@ func runCommand(c *cli.Context) error {
 			"your origin will not be reachable. You should remove the `hostname` property to avoid this warning.")
 	}
 
+	tokenStr, err := readTunnelToken(c)
+	if err != nil {
+		return err
+	}
 	// Check if token is provided and if not use default tunnelID flag method
-	if tokenStr := c.String(TunnelTokenFlag); tokenStr != "" {
+	if tokenStr != "" {
+		tokenStr, err := secretstore.ResolveString(c.Context, tokenStr)
+		if err != nil {
+			return errors.Wrap(err, "failed to read the tunnel token")
+		}
 		if token, err := ParseToken(tokenStr); err == nil {
 			return sc.runWithCredentials(token.Credentials())
 		}
@@ -747,7 +873,14 @@ func runCommand(c *cli.Context) error {
 		tunnelRef := c.Args().First()
 		if tunnelRef == "" {
 			// see if tunnel id was in the config file
-			tunnelRef = config.GetConfiguration().TunnelID
+			conf := config.GetConfiguration()
+			tunnelRef = conf.TunnelID
+			if len(conf.Tunnels) > 0 {
+				if tunnelRef != "" {
+					return cliutil.UsageError(`The configuration file can set either "tunnel" or "tunnels", not both.`)
+				}
+				return runConfiguredTunnels(sc, conf)
+			}
 			if tunnelRef == "" {
 				return cliutil.UsageError(`"cloudflared tunnel run" requires the ID or name of the tunnel to run as the last command line argument or in the configuration file.`)
 			}
@@ -757,6 +890,60 @@ func runCommand(c *cli.Context) error {
 	}
 }
 
+// readTunnelToken returns the token given with --token, or read from --token-file or --token-fd. The token read is
+// set as --token, since the rest of the run command looks at it.
+func readTunnelToken(c *cli.Context) (string, error) {
+	sources := 0
+	for _, flag := range []string{TunnelTokenFlag, TunnelTokenFileFlag} {
+		if c.String(flag) != "" {
+			sources++
+		}
+	}
+	fd := c.Int(TunnelTokenFDFlag)
+	if fd >= 0 {
+		sources++
+	}
+	if sources > 1 {
+		return "", cliutil.UsageError("Only one of --%s, --%s and --%s can be provided.", TunnelTokenFlag, TunnelTokenFileFlag, TunnelTokenFDFlag)
+	}
+
+	var reader io.Reader
+	switch path := c.String(TunnelTokenFileFlag); {
+	case path == "-":
+		reader = os.Stdin
+	case path != "":
+		file, err := os.Open(path)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to open the tunnel token file")
+		}
+		defer file.Close()
+		reader = file
+	case fd >= 0:
+		file := os.NewFile(uintptr(fd), TunnelTokenFDFlag)
+		if file == nil {
+			return "", cliutil.UsageError("--%s %d is not a valid file descriptor.", TunnelTokenFDFlag, fd)
+		}
+		defer file.Close()
+		reader = file
+	default:
+		return c.String(TunnelTokenFlag), nil
+	}
+
+	// A token is far smaller than this, the limit only guards against reading e.g. a device
+	content, err := io.ReadAll(io.LimitReader(reader, 64*1024))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the tunnel token")
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", cliutil.UsageError("The tunnel token read is empty.")
+	}
+	if err := c.Set(TunnelTokenFlag, token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
 func ParseToken(tokenStr string) (*connection.TunnelToken, error) {
 	content, err := base64.StdEncoding.DecodeString(tokenStr)
 	if err != nil {
@@ -780,18 +967,33 @@ func runNamedTunnel(sc *subcommandContext, tunnelRef string) error {
 
 func buildCleanupCommand() *cli.Command {
 	return &cli.Command{
-		Name:               "cleanup",
-		Action:             cliutil.ConfiguredAction(cleanupCommand),
-		Usage:              "Cleanup tunnel connections",
-		UsageText:          "cloudflared tunnel [tunnel command options] cleanup [subcommand options] TUNNEL",
-		Description:        "Delete connections for tunnels with the given UUIDs or names.",
-		Flags:              []cli.Flag{cleanupClientFlag},
+		Name:      "cleanup",
+		Action:    cliutil.ConfiguredAction(cleanupCommand),
+		Usage:     "Cleanup tunnel connections",
+		UsageText: "cloudflared tunnel [tunnel command options] cleanup [subcommand options] [TUNNEL...]",
+		Description: `Delete connections for tunnels with the given UUIDs or names.
+
+  Use --older-than to only delete the connections of the disconnected Connectors that haven't connected for some time, and
+  --all-tunnels to do so across all the tunnels of the account:
+
+  $ cloudflared tunnel cleanup --all-tunnels --older-than 72h
+
+  Use --dry-run to list the Connectors whose connections would be deleted.`,
+		Flags:              []cli.Flag{outputFormatFlag, cleanupClientFlag, cleanupOlderThanFlag, cleanupAllTunnelsFlag, dryRunFlag},
 		CustomHelpTemplate: commandHelpTemplate(),
 	}
 }
 
 func cleanupCommand(c *cli.Context) error {
-	if c.NArg() < 1 {
+	allTunnels := c.Bool(cleanupAllTunnelsFlag.Name)
+	if allTunnels {
+		if c.NArg() > 0 {
+			return cliutil.UsageError(`"cloudflared tunnel cleanup --%s" doesn't accept tunnels as arguments.`, cleanupAllTunnelsFlag.Name)
+		}
+		if c.Duration(cleanupOlderThanFlag.Name) <= 0 {
+			return cliutil.UsageError(`"cloudflared tunnel cleanup --%s" requires --%s.`, cleanupAllTunnelsFlag.Name, cleanupOlderThanFlag.Name)
+		}
+	} else if c.NArg() < 1 {
 		return cliutil.UsageError(`"cloudflared tunnel cleanup" requires at least 1 argument, the IDs of the tunnels to cleanup connections.`)
 	}
 
@@ -800,12 +1002,81 @@ func cleanupCommand(c *cli.Context) error {
 		return err
 	}
 
-	tunnelIDs, err := sc.findIDs(c.Args().Slice())
+	var tunnelIDs []uuid.UUID
+	if allTunnels {
+		tunnelIDs, err = sc.connectedTunnelIDs()
+	} else {
+		tunnelIDs, err = sc.findIDs(c.Args().Slice())
+	}
 	if err != nil {
 		return err
 	}
 
-	return sc.cleanupConnections(tunnelIDs)
+	if c.Bool(dryRunFlag.Name) {
+		resources, err := sc.cleanupPlan(tunnelIDs)
+		if err != nil {
+			return err
+		}
+		return renderDryRun(c, resources)
+	}
+
+	results, err := sc.cleanupConnections(tunnelIDs)
+	if err != nil {
+		return err
+	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, results)
+	}
+	return nil
+}
+
+func buildRotateCredentialsCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "rotate-credentials",
+		Action:    cliutil.ConfiguredAction(rotateCredentialsCommand),
+		Usage:     "Issue a new secret for an existing tunnel (by name or UUID) and replace its credentials file",
+		UsageText: "cloudflared tunnel [tunnel command options] rotate-credentials [subcommand options] TUNNEL",
+		Description: `Gives the tunnel a new secret and writes the new credentials file, keeping the tunnel and its routes. The
+  tunnel token changes too, use "cloudflared tunnel token" to fetch the new one.
+
+  Running connectors stay connected with the previous secret, but can't reconnect with it. Use --grace-period to
+  disconnect the connectors that didn't restart with the new credentials after some time:
+
+  $ cloudflared tunnel rotate-credentials --grace-period 10m my-tunnel`,
+		Flags:              []cli.Flag{outputFormatFlag, credentialsFileFlagCLIOnly, createSecretFlag, rotateGracePeriodFlag, encryptCredentialsFlag, credentialsPassphraseFileFlag},
+		CustomHelpTemplate: commandHelpTemplate(),
+	}
+}
+
+func rotateCredentialsCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return errors.Wrap(err, "error setting up logger")
+	}
+
+	if c.NArg() != 1 {
+		return cliutil.UsageError(`"cloudflared tunnel rotate-credentials" requires exactly 1 argument, the name or UUID of the tunnel to rotate the credentials of.`)
+	}
+	tunnelID, err := sc.findID(c.Args().First())
+	if err != nil {
+		return errors.Wrap(err, "error parsing tunnel ID")
+	}
+	if err := validateEncryptionKey(c); err != nil {
+		return err
+	}
+
+	warningChecker := updater.StartWarningCheck(c)
+	defer warningChecker.LogWarningIfAny(sc.log)
+
+	rotated, err := sc.rotateCredentials(tunnelID, c.String(createSecretFlag.Name), c.Duration(rotateGracePeriodFlag.Name))
+	if err != nil {
+		return errors.Wrap(err, "failed to rotate tunnel credentials")
+	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, rotated)
+	}
+	fmt.Printf("Tunnel credentials written to %v. Keep this file secret, the previous credentials can't be used anymore.\n", rotated.CredentialsFile)
+	return nil
 }
 
 func buildTokenCommand() *cli.Command {
@@ -813,9 +1084,9 @@ func buildTokenCommand() *cli.Command {
 		Name:               "token",
 		Action:             cliutil.ConfiguredAction(tokenCommand),
 		Usage:              "Fetch the credentials token for an existing tunnel (by name or UUID) that allows to run it",
-		UsageText:          "cloudflared tunnel [tunnel command options] token [subcommand options] TUNNEL",
-		Description:        "cloudflared tunnel token will fetch the credentials token for a given tunnel (by its name or UUID), which is then used to run the tunnel. This command fails if the tunnel does not exist or has been deleted. Use the flag `cloudflared tunnel token --cred-file /my/path/file.json TUNNEL` to output the token to the credentials JSON file. Note: this command only works for Tunnels created since cloudflared version 2022.3.0",
-		Flags:              []cli.Flag{credentialsFileFlagCLIOnly},
+		UsageText:          "cloudflared tunnel [tunnel command options] token [subcommand options] [TUNNEL]",
+		Description:        "cloudflared tunnel token will fetch the credentials token for a given tunnel (by its name or UUID), which is then used to run the tunnel. This command fails if the tunnel does not exist or has been deleted. Use the flag `cloudflared tunnel token --cred-file /my/path/file.json TUNNEL` to output the token to the credentials JSON file. Use `cloudflared tunnel token --inspect TUNNEL` to print which tunnel and account a token is for, or `--inspect` without a tunnel to decode the token of TUNNEL_TOKEN or --token-file instead, and `--qr` to scan the token from a remote device. Note: this command only works for Tunnels created since cloudflared version 2022.3.0",
+		Flags:              []cli.Flag{credentialsFileFlagCLIOnly, encryptCredentialsFlag, credentialsPassphraseFileFlag, tokenInspectFlag, tokenQRFlag, outputFormatFlag, tunnelTokenFlag, tunnelTokenFileFlag, tunnelTokenFDFlag},
 		CustomHelpTemplate: commandHelpTemplate(),
 	}
 }
@@ -829,23 +1100,53 @@ func tokenCommand(c *cli.Context) error {
 	warningChecker := updater.StartWarningCheck(c)
 	defer warningChecker.LogWarningIfAny(sc.log)
 
-	if c.NArg() != 1 {
-		return cliutil.UsageError(`"cloudflared tunnel token" requires exactly 1 argument, the name or UUID of tunnel to fetch the credentials token for.`)
-	}
-	tunnelID, err := sc.findID(c.Args().First())
-	if err != nil {
-		return errors.Wrap(err, "error parsing tunnel ID")
+	var (
+		token  *connection.TunnelToken
+		tunnel *cfapi.Tunnel
+	)
+	if c.Bool(tokenInspectFlag.Name) && c.NArg() == 0 {
+		// The token is decoded as is, without fetching it
+		if token, err = readInspectedToken(c); err != nil {
+			return err
+		}
+	} else {
+		if c.NArg() != 1 {
+			return cliutil.UsageError(`"cloudflared tunnel token" requires exactly 1 argument, the name or UUID of tunnel to fetch the credentials token for.`)
+		}
+		tunnelID, err := sc.findID(c.Args().First())
+		if err != nil {
+			return errors.Wrap(err, "error parsing tunnel ID")
+		}
+		if token, err = sc.getTunnelTokenCredentials(tunnelID); err != nil {
+			return err
+		}
+		if c.Bool(tokenInspectFlag.Name) {
+			client, err := sc.client()
+			if err != nil {
+				return err
+			}
+			if tunnel, err = client.GetTunnel(tunnelID); err != nil {
+				return errors.Wrap(err, "error getting the tunnel of the token")
+			}
+		}
 	}
 
-	token, err := sc.getTunnelTokenCredentials(tunnelID)
-	if err != nil {
-		return err
+	if c.Bool(tokenInspectFlag.Name) {
+		info := newTokenInfo(token, tunnel)
+		if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+			return renderOutput(outputFormat, info)
+		}
+		info.print(os.Stdout)
+		return nil
 	}
 
 	if path := c.String(CredFileFlag); path != "" {
 		credentials := token.Credentials()
-		err := writeTunnelCredentials(path, &credentials)
+		body, err := sc.encodeCredentials(&credentials)
 		if err != nil {
+			return err
+		}
+		if err := writeTunnelCredentials(path, body); err != nil {
 			return errors.Wrapf(err, "error writing token credentials to JSON file in path %s", path)
 		}
 
@@ -858,9 +1159,34 @@ func tokenCommand(c *cli.Context) error {
 	}
 
 	fmt.Println(encodedToken)
+	if c.Bool(tokenQRFlag.Name) {
+		return printTokenQR(os.Stdout, encodedToken)
+	}
 	return nil
 }
 
+// readInspectedToken reads the token to inspect from TUNNEL_TOKEN, --token-file or --token-fd. It isn't taken as an
+// argument, where it'd be visible in process listings.
+func readInspectedToken(c *cli.Context) (*connection.TunnelToken, error) {
+	tokenStr, err := readTunnelToken(c)
+	if err != nil {
+		return nil, err
+	}
+	if tokenStr == "" {
+		return nil, cliutil.UsageError(`"cloudflared tunnel token --inspect" requires the name or UUID of a tunnel, or a token in TUNNEL_TOKEN, --%s or --%s.`, TunnelTokenFileFlag, TunnelTokenFDFlag)
+	}
+	if secretstore.IsReference(tokenStr) {
+		if tokenStr, err = secretstore.ResolveString(c.Context, tokenStr); err != nil {
+			return nil, err
+		}
+	}
+	token, err := ParseToken(tokenStr)
+	if err != nil || token.TunnelID == uuid.Nil {
+		return nil, errors.New("the tunnel token is not valid")
+	}
+	return token, nil
+}
+
 func buildRouteCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "route",
@@ -884,12 +1210,17 @@ Further information about managing Cloudflare WARP traffic to your tunnel is ava
 		CustomHelpTemplate: commandHelpTemplate(),
 		Subcommands: []*cli.Command{
 			{
-				Name:        "dns",
-				Action:      cliutil.ConfiguredAction(routeDnsCommand),
-				Usage:       "HostnameRoute a hostname by creating a DNS CNAME record to a tunnel",
-				UsageText:   "cloudflared tunnel route dns [TUNNEL] [HOSTNAME]",
-				Description: `Creates a DNS CNAME record hostname that points to the tunnel.`,
-				Flags:       []cli.Flag{overwriteDNSFlag},
+				Name:      "dns",
+				Action:    cliutil.ConfiguredAction(routeDnsCommand),
+				Usage:     "HostnameRoute a hostname by creating a DNS CNAME record to a tunnel",
+				UsageText: "cloudflared tunnel route dns [TUNNEL] [HOSTNAME...]",
+				Description: `Creates a DNS CNAME record hostname that points to the tunnel.
+
+  Several hostnames can be routed at once, given as arguments or listed in a CSV or JSON file:
+
+  $ cloudflared tunnel route dns --ttl 300 my-tunnel app.example.com api.example.com
+  $ cloudflared tunnel route dns --hostnames-file hostnames.csv my-tunnel`,
+				Flags: []cli.Flag{outputFormatFlag, overwriteDNSFlag, dnsTTLFlag, dnsProxiedFlag, dnsHostnamesFileFlag},
 			},
 			{
 				Name:        "lb",
@@ -897,29 +1228,13 @@ Further information about managing Cloudflare WARP traffic to your tunnel is ava
 				Usage:       "Use this tunnel as a load balancer origin, creating pool and load balancer if necessary",
 				UsageText:   "cloudflared tunnel route lb [TUNNEL] [HOSTNAME] [LB-POOL-NAME]",
 				Description: `Creates Load Balancer with an origin pool that points to the tunnel.`,
+				Flags:       []cli.Flag{outputFormatFlag},
 			},
 			buildRouteIPSubcommand(),
 		},
 	}
 }
 
-func dnsRouteFromArg(c *cli.Context, overwriteExisting bool) (cfapi.HostnameRoute, error) {
-	const (
-		userHostnameIndex = 1
-		expectedNArgs     = 2
-	)
-	if c.NArg() != expectedNArgs {
-		return nil, cliutil.UsageError("Expected %d arguments, got %d", expectedNArgs, c.NArg())
-	}
-	userHostname := c.Args().Get(userHostnameIndex)
-	if userHostname == "" {
-		return nil, cliutil.UsageError("The third argument should be the hostname")
-	} else if !validateHostname(userHostname, true) {
-		return nil, errors.Errorf("%s is not a valid hostname", userHostname)
-	}
-	return cfapi.NewDNSRoute(userHostname, overwriteExisting), nil
-}
-
 func lbRouteFromArg(c *cli.Context) (cfapi.HostnameRoute, error) {
 	const (
 		lbNameIndex   = 1
@@ -969,8 +1284,8 @@ func validateHostname(s string, allowWildcardSubdomain bool) bool {
 }
 
 func routeDnsCommand(c *cli.Context) error {
-	if c.NArg() != 2 {
-		return cliutil.UsageError(`This command expects the format "cloudflared tunnel route dns <tunnel name/id> <hostname>"`)
+	if c.NArg() < 1 || (c.NArg() < 2 && c.String(dnsHostnamesFileFlag.Name) == "") {
+		return cliutil.UsageError(`This command expects the format "cloudflared tunnel route dns <tunnel name/id> <hostname> [<hostname>...]"`)
 	}
 	return routeCommand(c, "dns")
 }
@@ -992,26 +1307,73 @@ func routeCommand(c *cli.Context, routeType string) error {
 	if err != nil {
 		return err
 	}
-	var route cfapi.HostnameRoute
+	var routes []cfapi.HostnameRoute
 	switch routeType {
 	case "dns":
-		route, err = dnsRouteFromArg(c, c.Bool(overwriteDNSFlagName))
+		routes, err = dnsRoutesFromArgs(c, c.Bool(overwriteDNSFlagName))
 	case "lb":
+		var route cfapi.HostnameRoute
 		route, err = lbRouteFromArg(c)
+		routes = []cfapi.HostnameRoute{route}
 	}
 	if err != nil {
 		return err
 	}
 
-	res, err := sc.route(tunnelID, route)
-	if err != nil {
-		return err
+	if len(routes) == 1 {
+		res, err := sc.route(tunnelID, routes[0])
+		if err != nil {
+			return err
+		}
+		if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+			return renderOutput(outputFormat, &hostnameRouteOutput{
+				TunnelID: tunnelID,
+				Type:     routes[0].RecordType(),
+				Route:    routes[0].String(),
+				Result:   res,
+			})
+		}
+		sc.log.Info().Str(LogFieldTunnelID, tunnelID.String()).Msg(res.SuccessSummary())
+		return nil
 	}
 
-	sc.log.Info().Str(LogFieldTunnelID, tunnelID.String()).Msg(res.SuccessSummary())
+	// The hostnames are routed independently, the failure of one doesn't stop the others
+	outputs := make([]hostnameRouteOutput, 0, len(routes))
+	failed := 0
+	for _, route := range routes {
+		output := hostnameRouteOutput{TunnelID: tunnelID, Type: route.RecordType(), Route: route.String()}
+		res, err := sc.route(tunnelID, route)
+		if err != nil {
+			failed++
+			output.Error = err.Error()
+			sc.log.Err(err).Str(LogFieldTunnelID, tunnelID.String()).Msgf("Failed to route %s", route)
+		} else {
+			output.Result = res
+			sc.log.Info().Str(LogFieldTunnelID, tunnelID.String()).Msg(res.SuccessSummary())
+		}
+		outputs = append(outputs, output)
+	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		if err := renderOutput(outputFormat, outputs); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to route %d of the %d hostnames", failed, len(routes))
+	}
 	return nil
 }
 
+// hostnameRouteOutput is the structured output of route dns and route lb, the result has the changes made to the
+// records.
+type hostnameRouteOutput struct {
+	TunnelID uuid.UUID                 `json:"tunnel_id"`
+	Type     string                    `json:"type"`
+	Route    string                    `json:"route"`
+	Result   cfapi.HostnameRouteResult `json:"result,omitempty"`
+	Error    string                    `json:"error,omitempty"`
+}
+
 func commandHelpTemplate() string {
 	var parentFlagsHelp string
 	for _, f := range configureCloudflaredFlags(false) {
@@ -1038,14 +1400,15 @@ SUBCOMMAND OPTIONS:
 	return fmt.Sprintf(template, parentFlagsHelp)
 }
 
-func buildDiagCommand() *cli.Command {
-	return &cli.Command{
+// buildDiagCommand builds the diag command of the tunnel command, or the top-level one when command is "cloudflared".
+func buildDiagCommand(command string) *cli.Command {
+	diagCmd := &cli.Command{
 		Name:        "diag",
 		Action:      cliutil.ConfiguredAction(diagCommand),
 		Usage:       "Creates a diagnostic report from a local cloudflared instance",
-		UsageText:   "cloudflared tunnel [tunnel command options] diag [subcommand options]",
-		Description: "cloudflared tunnel diag will create a diagnostic report of a local cloudflared instance. The diagnostic procedure collects: logs, metrics, system information, traceroute to Cloudflare Edge, and runtime information. Since there may be multiple instances of cloudflared running the --metrics option may be provided to target a specific instance.",
-		Flags: []cli.Flag{
+		UsageText:   command + " diag [subcommand options]",
+		Description: command + " diag will create a diagnostic bundle of a local cloudflared instance to attach to support cases. The diagnostic procedure collects: logs, metrics, goroutine and heap profiles, the configuration with its secrets left out, the state of the connections, the flows, system and environment information, and traceroute to Cloudflare Edge. Since there may be multiple instances of cloudflared running the --metrics option may be provided to target a specific instance.",
+		Flags: append([]cli.Flag{
 			metricsFlag,
 			diagContainerFlag,
 			diagPodFlag,
@@ -1054,9 +1417,162 @@ func buildDiagCommand() *cli.Command {
 			noDiagSystemFlag,
 			noDiagRuntimeFlag,
 			noDiagNetworkFlag,
-		},
-		CustomHelpTemplate: commandHelpTemplate(),
+		}, metricsClientFlags()...),
+		Subcommands: []*cli.Command{buildDiagFlowsCommand(command)},
+	}
+	if command != "cloudflared" {
+		diagCmd.CustomHelpTemplate = commandHelpTemplate()
+	}
+	return diagCmd
+}
+
+func buildDiagFlowsCommand(command string) *cli.Command {
+	diagCmd := &cli.Command{
+		Name:        "flows",
+		Action:      cliutil.ConfiguredAction(diagFlowsCommand),
+		Usage:       "List the flows being proxied by a local cloudflared instance",
+		UsageText:   command + " diag flows [subcommand options]",
+		Description: command + " diag flows lists the TCP, UDP and ICMP flows that a local cloudflared instance is proxying to origins, with their endpoints, age and byte counts. Since there may be multiple instances of cloudflared running the --metrics option may be provided to target a specific instance.",
+		Flags: append([]cli.Flag{
+			metricsFlag,
+			outputFormatFlag,
+		}, metricsClientFlags()...),
+	}
+	if command != "cloudflared" {
+		diagCmd.CustomHelpTemplate = commandHelpTemplate()
+	}
+	return diagCmd
+}
+
+func diagFlowsCommand(ctx *cli.Context) error {
+	sctx, err := newSubcommandContext(ctx)
+	if err != nil {
+		return err
+	}
+	log := sctx.log
+	clientOptions, err := newMetricsClientOptions(sctx.c)
+	if err != nil {
+		return err
+	}
+
+	flows, states, err := diagnostic.ListFlows(
+		log,
+		sctx.c.String(metricsFlagName),
+		metrics.GetMetricsKnownAddresses(metrics.Runtime),
+		clientOptions,
+	)
+	if errors.Is(err, diagnostic.ErrMetricsServerNotFound) {
+		log.Warn().Msg("No instances found")
+		return nil
+	}
+	if errors.Is(err, diagnostic.ErrMultipleMetricsServerFound) {
+		log.Info().Msgf("Found multiple instances running:")
+		for _, state := range states {
+			log.Info().Msgf("Instance: tunnel-id=%s connector-id=%s metrics-address=%s", state.TunnelID, state.ConnectorID, state.URL.String())
+		}
+		log.Info().Msgf("To select one instance use the option --metrics")
+		return nil
 	}
+	if err != nil {
+		return err
+	}
+
+	if outputFormat := ctx.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, flows.Flows)
+	}
+
+	if len(flows.Flows) == 0 {
+		fmt.Println("No active flows")
+		return nil
+	}
+	formatAndPrintFlows(flows)
+	return nil
+}
+
+func formatAndPrintFlows(flows *diagnostic.FlowsResponse) {
+	writer := tabWriter()
+	defer writer.Flush()
+
+	_, _ = fmt.Fprintln(writer, "PROTOCOL\tSRC\tDST\tCONN\tAGE\tBYTES TO ORIGIN\tBYTES FROM ORIGIN\tEDGE RTT\tDROPS\t")
+	for _, f := range flows.Flows {
+		formattedStr := fmt.Sprintf(
+			"%s\t%s\t%s\t%d\t%s\t%d\t%d\t%s\t%d\t",
+			f.Protocol,
+			f.Src,
+			f.Dst,
+			f.ConnIndex,
+			f.Age(flows.CollectedAt).Truncate(time.Second),
+			f.BytesToOrigin,
+			f.BytesFromOrigin,
+			formatRTT(f.EdgeRTT),
+			f.DropsToOrigin+f.DropsFromOrigin,
+		)
+		_, _ = fmt.Fprintln(writer, formattedStr)
+	}
+}
+
+// formatRTT formats a round trip time, - if it wasn't estimated.
+func formatRTT(rtt time.Duration) string {
+	if rtt <= 0 {
+		return "-"
+	}
+	return rtt.Round(time.Microsecond).String()
+}
+
+// buildHealthCommand builds the health command of the tunnel command, or the top-level one when command is "cloudflared".
+func buildHealthCommand(command string) *cli.Command {
+	healthCmd := &cli.Command{
+		Name:        "health",
+		Aliases:     []string{"status"},
+		Action:      cliutil.ConfiguredAction(healthCommand),
+		Usage:       "Checks the health of a local cloudflared instance",
+		UsageText:   command + " health [subcommand options]",
+		Description: command + " health checks the connections to the edge and the origins of a local cloudflared instance through its metrics server, and exits with 0 when it is healthy, 1 when it is degraded and 2 when it can't serve traffic or can't be reached, e.g. for container HEALTHCHECKs and Nagios probes. Since there may be multiple instances of cloudflared running the --metrics option may be provided to target a specific instance.",
+		Flags:       append([]cli.Flag{metricsFlag}, metricsClientFlags()...),
+	}
+	if command != "cloudflared" {
+		healthCmd.CustomHelpTemplate = commandHelpTemplate()
+	}
+	return healthCmd
+}
+
+func healthCommand(ctx *cli.Context) error {
+	sctx, err := newSubcommandContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	clientOptions, err := newMetricsClientOptions(sctx.c)
+	if err != nil {
+		return err
+	}
+
+	health, states, err := diagnostic.CheckHealth(
+		sctx.log,
+		sctx.c.String(metricsFlagName),
+		metrics.GetMetricsKnownAddresses(metrics.Runtime),
+		clientOptions,
+	)
+	if errors.Is(err, diagnostic.ErrMultipleMetricsServerFound) {
+		var instances []string
+		for _, state := range states {
+			instances = append(instances, state.URL.Host)
+		}
+		err = fmt.Errorf("found multiple instances running at %s, to select one instance use the option --metrics", strings.Join(instances, ", "))
+	}
+	if err != nil {
+		health = &diagnostic.Health{Status: diagnostic.HealthCritical, Reasons: []string{err.Error()}}
+	}
+
+	if len(health.Reasons) == 0 {
+		fmt.Printf("cloudflared %s\n", health.Status)
+	} else {
+		fmt.Printf("cloudflared %s - %s\n", health.Status, strings.Join(health.Reasons, "; "))
+	}
+	if health.Status != diagnostic.HealthOK {
+		return cli.Exit("", int(health.Status))
+	}
+	return nil
 }
 
 func diagCommand(ctx *cli.Context) error {
@@ -1065,6 +1581,10 @@ func diagCommand(ctx *cli.Context) error {
 		return err
 	}
 	log := sctx.log
+	clientOptions, err := newMetricsClientOptions(sctx.c)
+	if err != nil {
+		return err
+	}
 	options := diagnostic.Options{
 		KnownAddresses: metrics.GetMetricsKnownAddresses(metrics.Runtime),
 		Address:        sctx.c.String(metricsFlagName),
@@ -1077,6 +1597,7 @@ func diagCommand(ctx *cli.Context) error {
 			NoDiagRuntime: sctx.c.Bool(noDiagRuntimeFlagName),
 			NoDiagNetwork: sctx.c.Bool(noDiagNetworkFlagName),
 		},
+		Client: clientOptions,
 	}
 
 	if options.Address == "" {
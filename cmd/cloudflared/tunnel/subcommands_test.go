@@ -3,13 +3,17 @@ package tunnel
 import (
 	"encoding/base64"
 	"encoding/json"
+	"flag"
+	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/google/uuid"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 
 	"github.com/cloudflare/cloudflared/cfapi"
 	"github.com/cloudflare/cloudflared/connection"
@@ -202,3 +206,125 @@ func Test_TunnelToken(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, token, expectedToken)
 }
+
+func TestReplaceTunnelCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	previous := connection.Credentials{AccountTag: "account", TunnelSecret: []byte("previous"), TunnelID: uuid.New()}
+	body, err := json.Marshal(&previous)
+	require.NoError(t, err)
+	require.NoError(t, writeTunnelCredentials(path, body))
+	assert.Error(t, writeTunnelCredentials(path, body), "the credentials file should not be overwritten")
+
+	rotated := previous
+	rotated.TunnelSecret = []byte("rotated")
+	body, err = json.Marshal(&rotated)
+	require.NoError(t, err)
+	require.NoError(t, replaceTunnelCredentials(path, body))
+
+	body, err = os.ReadFile(path)
+	require.NoError(t, err)
+	var written connection.Credentials
+	require.NoError(t, json.Unmarshal(body, &written))
+	assert.Equal(t, rotated, written)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the temporary file should be renamed")
+}
+
+func TestTunnelSecretFromFlag(t *testing.T) {
+	generated, err := tunnelSecretFromFlag("")
+	require.NoError(t, err)
+	assert.Len(t, generated, 32)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	decoded, err := tunnelSecretFromFlag(base64.StdEncoding.EncodeToString(secret))
+	require.NoError(t, err)
+	assert.Equal(t, secret, decoded)
+
+	_, err = tunnelSecretFromFlag(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
+
+func TestStaleConnectors(t *testing.T) {
+	restarted, stale, started := uuid.New(), uuid.New(), uuid.New()
+	previous := []*cfapi.ActiveClient{{ID: restarted}, {ID: stale}}
+	current := []*cfapi.ActiveClient{{ID: stale}, {ID: started}}
+	assert.Equal(t, []uuid.UUID{stale}, staleConnectors(previous, current))
+	assert.Empty(t, staleConnectors(previous, nil))
+}
+
+func TestReadTunnelToken(t *testing.T) {
+	newContext := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("run", flag.ContinueOnError)
+		flagSet.String(TunnelTokenFlag, "", "")
+		flagSet.String(TunnelTokenFileFlag, "", "")
+		flagSet.Int(TunnelTokenFDFlag, -1, "")
+		require.NoError(t, flagSet.Parse(args))
+		return cli.NewContext(cli.NewApp(), flagSet, nil)
+	}
+
+	c := newContext("--token", "eyJhIjoi")
+	token, err := readTunnelToken(c)
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", token)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("eyJhIjoi\n"), 0600))
+	c = newContext("--token-file", tokenFile)
+	token, err = readTunnelToken(c)
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", token)
+	assert.Equal(t, "eyJhIjoi", c.String(TunnelTokenFlag), "the token should be set as --token")
+	assert.True(t, c.IsSet(TunnelTokenFlag))
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.WriteString("eyJhIjoi")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	token, err = readTunnelToken(newContext("--token-fd", strconv.Itoa(int(r.Fd()))))
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", token)
+
+	token, err = readTunnelToken(newContext())
+	require.NoError(t, err)
+	assert.Empty(t, token)
+
+	_, err = readTunnelToken(newContext("--token", "eyJhIjoi", "--token-file", tokenFile))
+	assert.Error(t, err)
+
+	emptyFile := filepath.Join(t.TempDir(), "empty")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("\n"), 0600))
+	_, err = readTunnelToken(newContext("--token-file", emptyFile))
+	assert.Error(t, err)
+}
+
+func TestReadInspectedToken(t *testing.T) {
+	newContext := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("token", flag.ContinueOnError)
+		flagSet.String(TunnelTokenFlag, "", "")
+		flagSet.String(TunnelTokenFileFlag, "", "")
+		flagSet.Int(TunnelTokenFDFlag, -1, "")
+		require.NoError(t, flagSet.Parse(args))
+		return cli.NewContext(cli.NewApp(), flagSet, nil)
+	}
+
+	expected := connection.TunnelToken{AccountTag: "account", TunnelSecret: []byte("secret"), TunnelID: uuid.New()}
+	encoded, err := expected.Encode()
+	require.NoError(t, err)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte(encoded), 0600))
+
+	token, err := readInspectedToken(newContext("--token-file", tokenFile))
+	require.NoError(t, err)
+	assert.Equal(t, expected, *token)
+
+	_, err = readInspectedToken(newContext())
+	assert.Error(t, err, "a token should be required without a tunnel")
+
+	invalidFile := filepath.Join(t.TempDir(), "invalid")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("not a token"), 0600))
+	_, err = readInspectedToken(newContext("--token-file", invalidFile))
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/signal"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+// systemdMetricsSocketName is the FileDescriptorName of the socket passed by systemd to serve the metrics on.
+const systemdMetricsSocketName = "metrics"
+
+// systemdNotifier reports the state of cloudflared to systemd with sd_notify, so that a service with Type=notify is
+// only considered started once the tunnels are connected, and a service with WatchdogSec is restarted when
+// cloudflared hangs. It does nothing when cloudflared isn't run by systemd.
+type systemdNotifier struct {
+	log *zerolog.Logger
+
+	lock     sync.Mutex
+	trackers []*tunnelstate.ConnTracker
+}
+
+func newSystemdNotifier(log *zerolog.Logger) *systemdNotifier {
+	return &systemdNotifier{log: log}
+}
+
+// watch sets the connections of the tunnels that the watchdog checks.
+func (n *systemdNotifier) watch(trackers []*tunnelstate.ConnTracker) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.trackers = trackers
+}
+
+// run notifies systemd that cloudflared is ready once connected, then pings the watchdog if it is enabled until
+// cloudflared shuts down. The watchdog is pinged as long as cloudflared is alive, even while the tunnels are
+// disconnected: they reconnect on their own, and restarting cloudflared wouldn't bring the edge back sooner.
+func (n *systemdNotifier) run(ctx context.Context, connectedSignal *signal.Signal, graceShutdownC <-chan struct{}) {
+	select {
+	case <-connectedSignal.Wait():
+	case <-ctx.Done():
+		return
+	}
+	n.notify(daemon.SdNotifyReady, n.status())
+
+	var watchdogC <-chan time.Time
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		n.log.Warn().Err(err).Msg("The systemd watchdog is disabled")
+	}
+	if interval > 0 {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		watchdogC = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			n.notify(daemon.SdNotifyStopping)
+			return
+		case <-graceShutdownC:
+			n.notify(daemon.SdNotifyStopping, "STATUS=Shutting down gracefully")
+			graceShutdownC = nil
+		case <-watchdogC:
+			n.notify(daemon.SdNotifyWatchdog, n.status())
+		}
+	}
+}
+
+func (n *systemdNotifier) notify(state ...string) {
+	if _, err := daemon.SdNotify(false, strings.Join(state, "\n")); err != nil {
+		n.log.Debug().Err(err).Msg("Failed to notify systemd")
+	}
+}
+
+func (n *systemdNotifier) status() string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	var connections uint
+	for _, tracker := range n.trackers {
+		connections += tracker.CountActiveConns()
+	}
+	if len(n.trackers) == 1 {
+		return fmt.Sprintf("STATUS=Connected with %d connections to the edge", connections)
+	}
+	return fmt.Sprintf("STATUS=%d tunnels connected with %d connections to the edge", len(n.trackers), connections)
+}
+
+// systemdMetricsListener returns the socket passed by systemd socket activation to serve the metrics on, which is
+// the one named by FileDescriptorName=metrics in the socket unit.
+func systemdMetricsListener() (net.Listener, error) {
+	listeners, err := activation.ListenersWithNames()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the sockets passed by systemd")
+	}
+	metricsListeners := listeners[systemdMetricsSocketName]
+	if len(metricsListeners) == 0 {
+		return nil, fmt.Errorf("--%s is set but systemd didn't pass a stream socket named %s to the process", metricsSocketActivationFlag, systemdMetricsSocketName)
+	}
+	for _, listener := range metricsListeners[1:] {
+		_ = listener.Close()
+	}
+	return metricsListeners[0], nil
+}
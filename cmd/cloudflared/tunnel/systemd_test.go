@@ -0,0 +1,72 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/signal"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+// notifySocket listens on the socket of sd_notify like systemd does.
+func notifySocket(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func readNotification(t *testing.T, conn *net.UnixConn) []string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestSystemdNotifier(t *testing.T) {
+	conn := notifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	log := zerolog.Nop()
+	tracker := tunnelstate.NewConnTracker(&log)
+	notifier := newSystemdNotifier(&log)
+	notifier.watch([]*tunnelstate.ConnTracker{tracker})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	connectedSignal := signal.New(make(chan struct{}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		notifier.run(ctx, connectedSignal, nil)
+	}()
+
+	tracker.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	connectedSignal.Notify()
+	assert.Equal(t, []string{"READY=1", "STATUS=Connected with 1 connections to the edge"}, readNotification(t, conn))
+	assert.Equal(t, []string{"WATCHDOG=1", "STATUS=Connected with 1 connections to the edge"}, readNotification(t, conn))
+
+	// The watchdog is still pinged while the tunnel is disconnected, since cloudflared is alive and reconnecting
+	tracker.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Disconnected})
+	for notification := readNotification(t, conn); notification[1] != "STATUS=Connected with 0 connections to the edge"; notification = readNotification(t, conn) {
+		assert.Equal(t, "WATCHDOG=1", notification[0])
+	}
+	cancel()
+	<-done
+	for notification := readNotification(t, conn); notification[0] != "STOPPING=1"; notification = readNotification(t, conn) {
+		assert.Equal(t, "WATCHDOG=1", notification[0])
+	}
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err := conn.Read(make([]byte, 1024))
+	assert.Error(t, err)
+}
@@ -55,7 +55,7 @@ Tunnels, then you have to manage those IP routes with virtual networks (see
 "cloudflared tunnel vnet --help)". In those cases, you then have to tell
 which virtual network's routing table you want to add the route to with:
 "cloudflared tunnel route ip add --vnet [ID/name] [CIDR] [TUNNEL]".`,
-				Flags: []cli.Flag{vnetFlag},
+				Flags: []cli.Flag{vnetFlag, outputFormatFlag},
 			},
 			{
 				Name:        "show",
@@ -72,8 +72,8 @@ which virtual network's routing table you want to add the route to with:
 				Usage:     "Delete a row from your organization's private routing table",
 				UsageText: "cloudflared tunnel [--config FILEPATH] route ip delete [flags] [Route ID or CIDR]",
 				Description: `Deletes the row for the given route ID from your routing table. That portion of your network
-will no longer be reachable.`,
-				Flags: []cli.Flag{vnetFlag},
+will no longer be reachable. Use --dry-run to check which route would be deleted.`,
+				Flags: []cli.Flag{vnetFlag, outputFormatFlag, dryRunFlag},
 			},
 			{
 				Name:      "get",
@@ -83,7 +83,7 @@ will no longer be reachable.`,
 				Description: `Checks which row of the routing table will be used to proxy a given IP. This helps check
 and validate your config. Note that if you use virtual networks, then you have
 to tell which virtual network whose routing table you want to use.`,
-				Flags: []cli.Flag{vnetFlag},
+				Flags: []cli.Flag{vnetFlag, outputFormatFlag},
 			},
 		},
 	}
@@ -167,7 +167,7 @@ func addRouteCommand(c *cli.Context) error {
 		vnetId = &id
 	}
 
-	_, err = sc.addRoute(cfapi.NewRoute{
+	route, err := sc.addRoute(cfapi.NewRoute{
 		Comment:  comment,
 		Network:  *network,
 		TunnelID: tunnelID,
@@ -176,6 +176,9 @@ func addRouteCommand(c *cli.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "API error")
 	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, &route)
+	}
 	fmt.Printf("Successfully added route for %s over tunnel %s\n", network, tunnelID)
 	return nil
 }
@@ -191,6 +194,7 @@ func deleteRouteCommand(c *cli.Context) error {
 	}
 
 	var routeId uuid.UUID
+	var routeNetwork string
 	routeId, err = uuid.Parse(c.Args().First())
 	if err != nil {
 		_, network, err := net.ParseCIDR(c.Args().First())
@@ -211,11 +215,19 @@ func deleteRouteCommand(c *cli.Context) error {
 		if err != nil {
 			return err
 		}
+		routeNetwork = network.String()
+	}
+
+	if c.Bool(dryRunFlag.Name) {
+		return renderDryRun(c, []affectedResource{{Kind: resourceIPRoute, ID: routeId.String(), Description: routeNetwork}})
 	}
 
 	if err := sc.deleteRoute(routeId); err != nil {
 		return errors.Wrap(err, "API error")
 	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, &deletedOutput{ID: routeId, Deleted: true})
+	}
 	fmt.Printf("Successfully deleted route with ID %s\n", routeId)
 	return nil
 }
@@ -251,6 +263,13 @@ func getRouteByIPCommand(c *cli.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "API error")
 	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		// No route matching the IP is rendered as null
+		if route.IsZero() {
+			return renderOutput(outputFormat, nil)
+		}
+		return renderOutput(outputFormat, &route)
+	}
 	if route.IsZero() {
 		fmt.Printf("No route matches the IP %s\n", ip)
 	} else {
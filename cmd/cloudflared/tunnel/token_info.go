@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/qrcode"
+)
+
+var (
+	tokenInspectFlag = &cli.BoolFlag{
+		Name:  "inspect",
+		Usage: "Print the tunnel and the account of the token instead of the token. Without a tunnel, the token of TUNNEL_TOKEN, --token-file or --token-fd is decoded instead, without contacting Cloudflare.",
+	}
+	tokenQRFlag = &cli.BoolFlag{
+		Name:  "qr",
+		Usage: "Print the token as a QR code as well, to provision a remote device by scanning it.",
+	}
+)
+
+// TokenInfo is the metadata of a tunnel token, without its secret.
+type TokenInfo struct {
+	TunnelID   uuid.UUID `json:"tunnelID"`
+	TunnelName string    `json:"tunnelName,omitempty"`
+	AccountTag string    `json:"accountTag"`
+	// IssuedAt is when the tunnel was created. Tokens don't carry their issue time, so it is only known when the
+	// tunnel is fetched from Cloudflare.
+	IssuedAt *time.Time `json:"issuedAt,omitempty"`
+}
+
+func newTokenInfo(token *connection.TunnelToken, tunnel *cfapi.Tunnel) TokenInfo {
+	info := TokenInfo{TunnelID: token.TunnelID, AccountTag: token.AccountTag}
+	if tunnel != nil {
+		info.TunnelName = tunnel.Name
+		if !tunnel.CreatedAt.IsZero() {
+			createdAt := tunnel.CreatedAt
+			info.IssuedAt = &createdAt
+		}
+	}
+	return info
+}
+
+func (info TokenInfo) print(w io.Writer) {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer writer.Flush()
+	_, _ = fmt.Fprintf(writer, "TUNNEL ID:\t%s\n", info.TunnelID)
+	if info.TunnelName != "" {
+		_, _ = fmt.Fprintf(writer, "TUNNEL NAME:\t%s\n", info.TunnelName)
+	}
+	_, _ = fmt.Fprintf(writer, "ACCOUNT:\t%s\n", info.AccountTag)
+	if info.IssuedAt != nil {
+		_, _ = fmt.Fprintf(writer, "ISSUED:\t%s\n", info.IssuedAt.Format(time.RFC3339))
+	} else {
+		_, _ = fmt.Fprintf(writer, "ISSUED:\tunknown, the token doesn't record it\n")
+	}
+}
+
+// printTokenQR prints the encoded token as a QR code, or explains why it can't.
+func printTokenQR(w io.Writer, encodedToken string) error {
+	code, err := qrcode.Encode(encodedToken)
+	if err != nil {
+		return fmt.Errorf("the token can't be rendered as a QR code: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "\nScan this QR code to provision the token on another device:\n\n%s\n", code.Terminal())
+	return err
+}
@@ -0,0 +1,47 @@
+package tunnel
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+func TestTokenInfo(t *testing.T) {
+	token := &connection.TunnelToken{
+		AccountTag:   "699d98642c564d2e855e9661899b7252",
+		TunnelSecret: []byte("secret"),
+		TunnelID:     uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64"),
+	}
+	encoded, err := token.Encode()
+	require.NoError(t, err)
+	decoded, err := ParseToken(encoded)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	newTokenInfo(decoded, nil).print(&out)
+	assert.Equal(t, `TUNNEL ID:  df5ed608-b8b4-4109-89f3-9f2cf199df64
+ACCOUNT:    699d98642c564d2e855e9661899b7252
+ISSUED:     unknown, the token doesn't record it
+`, out.String())
+
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	out.Reset()
+	newTokenInfo(decoded, &cfapi.Tunnel{ID: token.TunnelID, Name: "web", CreatedAt: createdAt}).print(&out)
+	assert.Equal(t, `TUNNEL ID:    df5ed608-b8b4-4109-89f3-9f2cf199df64
+TUNNEL NAME:  web
+ACCOUNT:      699d98642c564d2e855e9661899b7252
+ISSUED:       2024-03-01T12:00:00Z
+`, out.String())
+	assert.NotContains(t, out.String(), encoded)
+
+	out.Reset()
+	require.NoError(t, printTokenQR(&out, encoded))
+	assert.Contains(t, out.String(), "Scan this QR code")
+}
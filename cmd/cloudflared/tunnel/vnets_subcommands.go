@@ -30,7 +30,7 @@ var (
 	}
 	newCommentFlag = &cli.StringFlag{
 		Name:    "comment",
-		Aliases: []string{"c"},
+		Aliases: []string{"c", "description"},
 		Usage:   "A new comment describing the purpose of the virtual network.",
 	}
 	vnetForceDeleteFlag = &cli.BoolFlag{
@@ -68,8 +68,8 @@ routes exist within some virtual network. If you do not specify any, then the sy
 network to which all routes belong. That is fine if you do not have overlapping IPs within different physical
 private networks in your infrastructure exposed via Cloudflare Tunnel. Note: if a virtual network is added as
 the new default, then the previous existing default virtual network will be automatically modified to no longer
-be the current default.`,
-				Flags:  []cli.Flag{makeDefaultFlag},
+be the current default. The comment can be given as the second argument or with --comment.`,
+				Flags:  []cli.Flag{makeDefaultFlag, newCommentFlag, outputFormatFlag},
 				Hidden: hidden,
 			},
 			{
@@ -77,7 +77,7 @@ be the current default.`,
 				Action:      cliutil.ConfiguredAction(listVirtualNetworksCommand),
 				Usage:       "Lists the virtual networks",
 				UsageText:   "cloudflared tunnel [--config FILEPATH] network list [flags]",
-				Description: "Lists the virtual networks based on the given filter flags.",
+				Description: "Lists the virtual networks based on the given filter flags, e.g. by ID, name or comment.",
 				Flags:       listVirtualNetworksFlags(),
 				Hidden:      hidden,
 			},
@@ -88,7 +88,7 @@ be the current default.`,
 				UsageText: "cloudflared tunnel [--config FILEPATH] network delete VIRTUAL_NETWORK",
 				Description: `Deletes the virtual network (given its ID or name). This is only possible if that virtual network is unused. 
 A virtual network may be used by IP routes or by WARP devices.`,
-				Flags:  []cli.Flag{vnetForceDeleteFlag},
+				Flags:  []cli.Flag{vnetForceDeleteFlag, outputFormatFlag},
 				Hidden: hidden,
 			},
 			{
@@ -100,7 +100,7 @@ A virtual network may be used by IP routes or by WARP devices.`,
 default, then the previously existing default virtual network will also be modified to no longer be the default.
 You cannot update a virtual network to not be the default anymore directly. Instead, you should create a new
 default or update an existing one to become the default.`,
-				Flags:  []cli.Flag{newNameFlag, newCommentFlag, makeDefaultFlag},
+				Flags:  []cli.Flag{newNameFlag, newCommentFlag, makeDefaultFlag, outputFormatFlag},
 				Hidden: hidden,
 			},
 		},
@@ -130,8 +130,11 @@ func addVirtualNetworkCommand(c *cli.Context) error {
 
 	name := args.Get(0)
 
-	comment := ""
+	comment := c.String(newCommentFlag.Name)
 	if c.NArg() >= 2 {
+		if c.IsSet(newCommentFlag.Name) {
+			return cliutil.UsageError("The comment can be given either as an argument or with --%s, not both", newCommentFlag.Name)
+		}
 		comment = args.Get(1)
 	}
 
@@ -145,6 +148,9 @@ func addVirtualNetworkCommand(c *cli.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "Could not add virtual network")
 	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, &createdVnet)
+	}
 
 	extraMsg := ""
 	if createdVnet.IsDefault {
@@ -213,6 +219,9 @@ func deleteVirtualNetworkCommand(c *cli.Context) error {
 	if err := sc.deleteVirtualNetwork(vnetId, forceDelete); err != nil {
 		return errors.Wrap(err, "API error")
 	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, &deletedOutput{ID: vnetId, Deleted: true})
+	}
 	fmt.Printf("Successfully deleted virtual network '%s'\n", input)
 	return nil
 }
@@ -246,14 +255,26 @@ func updateVirtualNetworkCommand(c *cli.Context) error {
 		isDefault := c.Bool(makeDefaultFlag.Name)
 		updates.IsDefault = &isDefault
 	}
+	if updates.Name == nil && updates.Comment == nil && updates.IsDefault == nil {
+		return cliutil.UsageError("Nothing to update, use --%s, --%s or --%s", newNameFlag.Name, newCommentFlag.Name, makeDefaultFlag.Name)
+	}
 
 	if err := sc.updateVirtualNetwork(vnetId, updates); err != nil {
 		return errors.Wrap(err, "API error")
 	}
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		return renderOutput(outputFormat, &updatedVnetOutput{ID: vnetId, UpdateVirtualNetwork: updates})
+	}
 	fmt.Printf("Successfully updated virtual network '%s'\n", input)
 	return nil
 }
 
+// updatedVnetOutput is the structured output of vnet update, with the fields that were updated.
+type updatedVnetOutput struct {
+	ID uuid.UUID `json:"id"`
+	cfapi.UpdateVirtualNetwork
+}
+
 func getVnetId(sc *subcommandContext, input string) (uuid.UUID, error) {
 	val, err := uuid.Parse(input)
 	if err == nil {
@@ -0,0 +1,157 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+)
+
+const (
+	watchdogIntervalFlag      = "watchdog-interval"
+	watchdogMaxGoroutinesFlag = "watchdog-max-goroutines"
+	watchdogMaxHeapFlag       = "watchdog-max-heap-mb"
+	watchdogRestartFlag       = "watchdog-restart"
+
+	// watchdogRestartExitCode is the exit code of cloudflared when the watchdog restarts it, next to the ones of the
+	// autoupdater
+	watchdogRestartExitCode = 12
+)
+
+// watchdogRestart implements ExitCoder, cloudflared exits with watchdogRestartExitCode so that its service manager
+// restarts it.
+type watchdogRestart struct {
+	reason string
+}
+
+func (r *watchdogRestart) Error() string {
+	return fmt.Sprintf("cloudflared is restarting because %s", r.reason)
+}
+
+func (r *watchdogRestart) ExitCode() int {
+	return watchdogRestartExitCode
+}
+
+// watchdog samples the number of goroutines and the heap in use, to catch the slow leaks of long-running connectors
+// before they exhaust the host. When a threshold is exceeded it logs a dump of the goroutines, and if configured to
+// restart it closes restartC to shut down gracefully.
+type watchdog struct {
+	interval      time.Duration
+	maxGoroutines int
+	maxHeapBytes  uint64
+	restart       bool
+	log           *zerolog.Logger
+
+	// sample returns the number of goroutines and the bytes of heap in use
+	sample func() (goroutines int, heapBytes uint64)
+	// exceeded is whether the last sample exceeded a threshold, so that the dump is only logged once per excess
+	exceeded bool
+	// restartC is closed when the watchdog restarts cloudflared
+	restartC chan struct{}
+	// restarting is the error cloudflared exits with once restartC is closed, it is only read after run returned
+	restarting *watchdogRestart
+}
+
+// newWatchdog returns the watchdog configured by the flags, nil if it is disabled or has no threshold.
+func newWatchdog(c *cli.Context, log *zerolog.Logger) (*watchdog, error) {
+	interval := c.Duration(watchdogIntervalFlag)
+	maxGoroutines := c.Int(watchdogMaxGoroutinesFlag)
+	maxHeapMB := c.Int(watchdogMaxHeapFlag)
+	if maxGoroutines < 0 || maxHeapMB < 0 {
+		return nil, cliutil.UsageError("--%s and --%s can't be negative", watchdogMaxGoroutinesFlag, watchdogMaxHeapFlag)
+	}
+	if interval <= 0 || (maxGoroutines == 0 && maxHeapMB == 0) {
+		return nil, nil
+	}
+	return &watchdog{
+		interval:      interval,
+		maxGoroutines: maxGoroutines,
+		maxHeapBytes:  uint64(maxHeapMB) * 1024 * 1024,
+		restart:       c.Bool(watchdogRestartFlag),
+		log:           log,
+		sample:        sampleRuntime,
+		restartC:      make(chan struct{}),
+	}, nil
+}
+
+func sampleRuntime() (int, uint64) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return runtime.NumGoroutine(), memStats.HeapInuse
+}
+
+// run samples the runtime every interval until ctx is done or the watchdog restarts cloudflared. It only returns once
+// ctx is done, so that a restart goes through the graceful shutdown rather than cancelling everything.
+func (w *watchdog) run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for w.restarting == nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if restart := w.check(); restart != nil {
+			w.log.Warn().Msgf("Initiating graceful shutdown: %s", restart.Error())
+			w.restarting = restart
+			close(w.restartC)
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// check samples the runtime and logs a dump when a threshold starts being exceeded. It returns the restart to
+// perform, if any.
+func (w *watchdog) check() *watchdogRestart {
+	goroutines, heapBytes := w.sample()
+	var reason string
+	switch {
+	case w.maxGoroutines > 0 && goroutines > w.maxGoroutines:
+		reason = fmt.Sprintf("%d goroutines exceed --%s %d", goroutines, watchdogMaxGoroutinesFlag, w.maxGoroutines)
+	case w.maxHeapBytes > 0 && heapBytes > w.maxHeapBytes:
+		reason = fmt.Sprintf("%d MB of heap in use exceed --%s %d", heapBytes/1024/1024, watchdogMaxHeapFlag, w.maxHeapBytes/1024/1024)
+	default:
+		if w.exceeded {
+			w.log.Info().Int("goroutines", goroutines).Uint64("heapInuseBytes", heapBytes).Msg("Watchdog thresholds are no longer exceeded")
+		}
+		w.exceeded = false
+		return nil
+	}
+	if !w.exceeded {
+		var dump bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&dump, 1); err != nil {
+			w.log.Err(err).Msg("Failed to dump the goroutines")
+		}
+		w.log.Warn().
+			Int("goroutines", goroutines).
+			Uint64("heapInuseBytes", heapBytes).
+			Str("goroutineDump", dump.String()).
+			Msgf("Watchdog threshold exceeded: %s", reason)
+	}
+	w.exceeded = true
+	if w.restart {
+		return &watchdogRestart{reason: reason}
+	}
+	return nil
+}
+
+// mergeShutdown returns a channel closed when either a or b is closed.
+func mergeShutdown(a, b <-chan struct{}) <-chan struct{} {
+	merged := make(chan struct{})
+	go func() {
+		select {
+		case <-a:
+		case <-b:
+		}
+		close(merged)
+	}()
+	return merged
+}
@@ -0,0 +1,82 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdogCheck(t *testing.T) {
+	var output bytes.Buffer
+	log := zerolog.New(&output)
+	goroutines := 10
+	w := &watchdog{
+		maxGoroutines: 100,
+		maxHeapBytes:  1024 * 1024,
+		log:           &log,
+		sample: func() (int, uint64) {
+			return goroutines, 1024
+		},
+	}
+
+	assert.Nil(t, w.check())
+	assert.Empty(t, output.String())
+
+	goroutines = 200
+	assert.Nil(t, w.check())
+	assert.Contains(t, output.String(), "200 goroutines exceed --watchdog-max-goroutines 100")
+	assert.Contains(t, output.String(), "goroutineDump")
+
+	// The dump is only logged when the threshold starts being exceeded
+	output.Reset()
+	assert.Nil(t, w.check())
+	assert.Empty(t, output.String())
+
+	goroutines = 10
+	assert.Nil(t, w.check())
+	assert.Contains(t, output.String(), "no longer exceeded")
+}
+
+func TestWatchdogRestart(t *testing.T) {
+	var output bytes.Buffer
+	log := zerolog.New(&output)
+	w := &watchdog{
+		interval:     time.Millisecond,
+		maxHeapBytes: 1024 * 1024,
+		restart:      true,
+		log:          &log,
+		sample: func() (int, uint64) {
+			return 10, 2 * 1024 * 1024
+		},
+		restartC: make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error)
+	go func() {
+		errC <- w.run(ctx)
+	}()
+
+	select {
+	case <-w.restartC:
+	case <-time.After(time.Second):
+		t.Fatal("the watchdog didn't restart")
+	}
+	// run only returns once the graceful shutdown cancels the context
+	select {
+	case <-errC:
+		t.Fatal("the watchdog returned before the context is done")
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	assert.ErrorIs(t, <-errC, context.Canceled)
+
+	require.NotNil(t, w.restarting)
+	assert.Equal(t, watchdogRestartExitCode, w.restarting.ExitCode())
+	assert.Contains(t, w.restarting.Error(), "2 MB of heap in use exceed --watchdog-max-heap-mb 1")
+}
@@ -0,0 +1,388 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/credentials"
+	"github.com/cloudflare/cloudflared/secretstore"
+)
+
+const (
+	sourceDefault         = "default"
+	sourceDefaultSearch   = "default search"
+	sourceArgument        = "command line argument"
+	sourceConfigFile      = "configuration file"
+	sourceTunnelsSection  = "tunnels section of the configuration file"
+	credentialsKindToken  = "token"
+	credentialsKindFile   = "credentials file"
+	credentialsKindInline = "credentials contents"
+)
+
+// WhoamiReport is what the credentials of cloudflared resolve to with the current flags, environment and
+// configuration file.
+type WhoamiReport struct {
+	ConfigFile resolvedFile     `json:"configFile"`
+	OriginCert originCertReport `json:"originCert"`
+	Tunnels    []tunnelReport   `json:"tunnels"`
+	// AccountTag is the account the tunnels run in, or the account of the origin certificate without tunnels.
+	AccountTag string   `json:"accountTag,omitempty"`
+	Problems   []string `json:"problems,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+type resolvedFile struct {
+	Path   string `json:"path,omitempty"`
+	Source string `json:"source"`
+}
+
+type originCertReport struct {
+	Path       string `json:"path,omitempty"`
+	Source     string `json:"source"`
+	AccountTag string `json:"accountTag,omitempty"`
+	ZoneID     string `json:"zoneID,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type tunnelReport struct {
+	Tunnel            string    `json:"tunnel"`
+	Source            string    `json:"source"`
+	TunnelID          uuid.UUID `json:"tunnelID,omitempty"`
+	CredentialsKind   string    `json:"credentialsKind,omitempty"`
+	Credentials       string    `json:"credentials,omitempty"`
+	CredentialsSource string    `json:"credentialsSource,omitempty"`
+	AccountTag        string    `json:"accountTag,omitempty"`
+	Error             string    `json:"error,omitempty"`
+}
+
+// flagSources tells where the flags resolving the credentials got their values from. It's captured before the
+// profile and the configuration file are applied, since they set the flags as if they were on the command line.
+type flagSources struct {
+	commandLine map[string]bool
+	profileName string
+	profile     *config.Profile
+	settings    interface{ String(string) (string, error) }
+}
+
+func newFlagSources(c *cli.Context) *flagSources {
+	sources := &flagSources{commandLine: make(map[string]bool), profileName: c.String(cliutil.ProfileFlag)}
+	for _, name := range c.FlagNames() {
+		sources.commandLine[name] = true
+	}
+	if sources.profileName != "" {
+		// An unknown profile fails when the configuration is applied
+		sources.profile, _ = config.FindProfile(c.String("config"), sources.profileName)
+	}
+	return sources
+}
+
+// of returns where the flag got its value from, in the order of precedence of cloudflared.
+func (s *flagSources) of(name string, envVars ...string) string {
+	if s.commandLine[name] {
+		return "command line --" + name
+	}
+	for _, env := range envVars {
+		if os.Getenv(env) != "" {
+			return "environment variable " + env
+		}
+	}
+	if s.profile != nil {
+		if value := map[string]string{
+			"config":                   s.profile.ConfigFile,
+			credentials.OriginCertFlag: s.profile.OriginCert,
+			CredFileFlag:               s.profile.CredentialsFile,
+		}[name]; value != "" {
+			return "profile " + s.profileName
+		}
+	}
+	if s.settings != nil {
+		if value, _ := s.settings.String(name); value != "" {
+			return sourceConfigFile
+		}
+	}
+	return sourceDefault
+}
+
+func buildWhoamiCommand() *cli.Command {
+	return &cli.Command{
+		Name: "whoami",
+		Action: cliutil.Action(func(c *cli.Context) error {
+			sources := newFlagSources(c)
+			return cliutil.ConfiguredAction(func(c *cli.Context) error {
+				return whoamiCommand(c, sources)
+			})(c)
+		}),
+		Usage:              "Print which origin certificate, tunnel credentials and account cloudflared would use, and validate them",
+		UsageText:          "cloudflared tunnel [tunnel command options] whoami [subcommand options] [TUNNEL]",
+		Description:        "cloudflared tunnel whoami resolves the origin certificate, the tunnel token or credentials file and the account from the same flags, environment variables, profile and configuration file as the other commands, prints where each of them came from, and checks that they can be read and belong together. It exits with an error if any of them is invalid.",
+		Flags:              []cli.Flag{credentialsFileFlag, credentialsContentsFlag, credentialsPassphraseFileFlag, tunnelTokenFlag, tunnelTokenFileFlag, tunnelTokenFDFlag, outputFormatFlag},
+		CustomHelpTemplate: commandHelpTemplate(),
+	}
+}
+
+func whoamiCommand(c *cli.Context, sources *flagSources) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return errors.Wrap(err, "error setting up logger")
+	}
+	if c.NArg() > 1 {
+		return cliutil.UsageError(`"cloudflared tunnel whoami" accepts only one argument, the ID or name of the tunnel.`)
+	}
+	// Failures are reported rather than logged
+	log := zerolog.Nop()
+	sc.log = &log
+	if settings, _, err := config.ReadConfigFile(c, sc.log); err == nil {
+		sources.settings = settings
+	}
+
+	report := sc.whoami(sources, c.Args().First())
+	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
+		if err := renderOutput(outputFormat, report); err != nil {
+			return err
+		}
+	} else {
+		report.print(os.Stdout)
+	}
+	if len(report.Problems) > 0 {
+		return errors.New("the credentials are not valid")
+	}
+	return nil
+}
+
+// whoami resolves the credentials the way "cloudflared tunnel run" does.
+func (sc *subcommandContext) whoami(sources *flagSources, tunnelRef string) *WhoamiReport {
+	report := &WhoamiReport{}
+	conf := config.GetConfiguration()
+	report.ConfigFile = resolvedFile{Path: conf.Source(), Source: sources.of("config")}
+	if report.ConfigFile.Source == sourceDefault {
+		report.ConfigFile.Source = sourceDefaultSearch
+	}
+
+	certSource := sources.of(credentials.OriginCertFlag, "TUNNEL_ORIGIN_CERT")
+	if certSource == sourceDefault {
+		certSource = sourceDefaultSearch
+	}
+	report.OriginCert = originCertReport{Path: sc.c.String(credentials.OriginCertFlag), Source: certSource}
+	if report.OriginCert.Path == "" {
+		// A missing default origin certificate is fine as long as nothing needs it
+		report.OriginCert.Error = fmt.Sprintf("no %s in %v", credentials.DefaultCredentialFile, config.DefaultConfigSearchDirectories())
+	} else if user, err := sc.credential(); err != nil {
+		report.OriginCert.Error = err.Error()
+		report.Problems = append(report.Problems, "origin certificate: "+err.Error())
+	} else {
+		report.OriginCert.Path = user.CertPath()
+		report.OriginCert.AccountTag = user.AccountID()
+		report.OriginCert.ZoneID = user.ZoneID()
+	}
+
+	switch tunnel, isToken := sc.whoamiToken(sources); {
+	case isToken:
+		if tunnelRef != "" {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("the token takes precedence over the tunnel %s of the command line", tunnelRef))
+		}
+		report.Tunnels = []tunnelReport{tunnel}
+	case tunnelRef != "":
+		report.Tunnels = []tunnelReport{sc.whoamiTunnel(sources, tunnelRef, sourceArgument)}
+	case conf.TunnelID != "":
+		report.Tunnels = []tunnelReport{sc.whoamiTunnel(sources, conf.TunnelID, sourceConfigFile)}
+	default:
+		for _, tunnel := range conf.Tunnels {
+			report.Tunnels = append(report.Tunnels, sc.whoamiConfiguredTunnel(tunnel))
+		}
+	}
+
+	report.AccountTag = report.OriginCert.AccountTag
+	for _, tunnel := range report.Tunnels {
+		if tunnel.Error != "" {
+			report.Problems = append(report.Problems, fmt.Sprintf("tunnel %s: %s", tunnel.Tunnel, tunnel.Error))
+			continue
+		}
+		if report.OriginCert.AccountTag != "" && tunnel.AccountTag != report.OriginCert.AccountTag {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("tunnel %s is in account %s but the origin certificate is for account %s, commands managing the tunnel will fail",
+				tunnel.Tunnel, tunnel.AccountTag, report.OriginCert.AccountTag))
+		}
+		report.AccountTag = tunnel.AccountTag
+	}
+	return report
+}
+
+// whoamiToken resolves the tunnel token, it returns false if there is none.
+func (sc *subcommandContext) whoamiToken(sources *flagSources) (tunnelReport, bool) {
+	report := tunnelReport{Tunnel: credentialsKindToken, CredentialsKind: credentialsKindToken}
+	switch {
+	case sc.c.Int(TunnelTokenFDFlag) >= 0:
+		report.CredentialsSource = sources.of(TunnelTokenFDFlag)
+	case sc.c.String(TunnelTokenFileFlag) != "":
+		report.Credentials = sc.c.String(TunnelTokenFileFlag)
+		report.CredentialsSource = sources.of(TunnelTokenFileFlag, "TUNNEL_TOKEN_FILE")
+	case sc.c.String(TunnelTokenFlag) != "":
+		report.CredentialsSource = sources.of(TunnelTokenFlag, "TUNNEL_TOKEN")
+	default:
+		return report, false
+	}
+	report.Source = report.CredentialsSource
+
+	tokenStr, err := readTunnelToken(sc.c)
+	if err == nil && secretstore.IsReference(tokenStr) {
+		report.Credentials = tokenStr
+		tokenStr, err = secretstore.ResolveString(sc.c.Context, tokenStr)
+	}
+	if err != nil {
+		report.Error = err.Error()
+		return report, true
+	}
+	token, err := ParseToken(tokenStr)
+	if err != nil || token.TunnelID == uuid.Nil {
+		report.Error = "the tunnel token is not valid"
+		return report, true
+	}
+	report.TunnelID = token.TunnelID
+	report.AccountTag = token.AccountTag
+	return report, true
+}
+
+// whoamiTunnel resolves the tunnel and finds its credentials.
+func (sc *subcommandContext) whoamiTunnel(sources *flagSources, tunnelRef, source string) tunnelReport {
+	report := tunnelReport{Tunnel: tunnelRef, Source: source}
+	tunnelID, err := sc.findID(tunnelRef)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.TunnelID = tunnelID
+
+	credentialsFile, credentialsContents := sc.c.String(CredFileFlag), sc.c.String(CredContentsFlag)
+	if credentialsContents != "" || secretstore.IsReference(credentialsFile) {
+		report.CredentialsKind = credentialsKindInline
+		if credentialsContents != "" {
+			report.CredentialsSource = sources.of(CredContentsFlag, "TUNNEL_CRED_CONTENTS")
+			if secretstore.IsReference(credentialsContents) {
+				report.Credentials = credentialsContents
+			}
+		} else {
+			report.Credentials = credentialsFile
+			report.CredentialsSource = sources.of(CredFileFlag, "TUNNEL_CRED_FILE")
+		}
+		credentials, err := sc.findCredentialsIn(tunnelID, credentialsFile, credentialsContents)
+		report.setCredentials(credentials, err)
+		return report
+	}
+
+	report.CredentialsKind = credentialsKindFile
+	if credentialsFile != "" {
+		report.CredentialsSource = sources.of(CredFileFlag, "TUNNEL_CRED_FILE")
+	}
+	sc.whoamiCredentialsFile(&report, credentialsFile)
+	return report
+}
+
+// whoamiConfiguredTunnel resolves one of the tunnels of the tunnels section of the configuration file.
+func (sc *subcommandContext) whoamiConfiguredTunnel(tunnel config.TunnelConfiguration) tunnelReport {
+	report := tunnelReport{Tunnel: tunnel.TunnelID, Source: sourceTunnelsSection, CredentialsKind: credentialsKindFile}
+	tunnelID, err := sc.findID(tunnel.TunnelID)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.TunnelID = tunnelID
+	if tunnel.CredentialsFile != "" {
+		report.CredentialsSource = sourceTunnelsSection
+	}
+	sc.whoamiCredentialsFile(&report, tunnel.CredentialsFile)
+	return report
+}
+
+// whoamiCredentialsFile finds the credentials file of the tunnel at path, or searches for it if path is empty.
+func (sc *subcommandContext) whoamiCredentialsFile(report *tunnelReport, path string) {
+	if path == "" {
+		report.CredentialsSource = fmt.Sprintf("%s for %s.json", sourceDefaultSearch, report.TunnelID)
+	}
+	report.Credentials = path
+	filePath, err := sc.credentialFinderFor(report.TunnelID, path).Path()
+	if err != nil {
+		report.Error = err.Error()
+		return
+	}
+	report.Credentials = filePath
+	credentials, err := sc.readTunnelCredentials(newStaticPath(filePath, sc.fs))
+	if err == nil && credentials.TunnelID != uuid.Nil && credentials.TunnelID != report.TunnelID {
+		err = errors.Errorf("the credentials file %s is for tunnel %s", filePath, credentials.TunnelID)
+	}
+	report.setCredentials(credentials, err)
+}
+
+func (r *tunnelReport) setCredentials(credentials connection.Credentials, err error) {
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	r.AccountTag = credentials.AccountTag
+}
+
+func (r *WhoamiReport) print(w io.Writer) {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(writer, "CONFIG FILE:\t%s\n", describeResolved(r.ConfigFile.Path, r.ConfigFile.Source))
+	_, _ = fmt.Fprintf(writer, "ORIGIN CERT:\t%s\n", describeResolved(r.OriginCert.Path, r.OriginCert.Source))
+	if r.OriginCert.Path == "" {
+		_, _ = fmt.Fprintf(writer, "\t%s\n", r.OriginCert.Error)
+	} else if r.OriginCert.Error != "" {
+		_, _ = fmt.Fprintf(writer, "\tinvalid: %s\n", r.OriginCert.Error)
+	} else {
+		_, _ = fmt.Fprintf(writer, "\taccount %s, zone %s\n", r.OriginCert.AccountTag, r.OriginCert.ZoneID)
+	}
+	if len(r.Tunnels) == 0 {
+		_, _ = fmt.Fprintf(writer, "TUNNEL:\tnone, no token nor tunnel in the command line or the configuration file\n")
+	}
+	for _, tunnel := range r.Tunnels {
+		if tunnel.TunnelID != uuid.Nil && tunnel.Tunnel != tunnel.TunnelID.String() {
+			_, _ = fmt.Fprintf(writer, "TUNNEL:\t%s = %s (%s)\n", tunnel.Tunnel, tunnel.TunnelID, tunnel.Source)
+		} else {
+			_, _ = fmt.Fprintf(writer, "TUNNEL:\t%s (%s)\n", tunnel.Tunnel, tunnel.Source)
+		}
+		if tunnel.CredentialsKind != "" {
+			credentials := tunnel.Credentials
+			if credentials == "" {
+				credentials = tunnel.CredentialsKind
+			}
+			_, _ = fmt.Fprintf(writer, "CREDENTIALS:\t%s (%s)\n", credentials, tunnel.CredentialsSource)
+		}
+		if tunnel.Error != "" {
+			_, _ = fmt.Fprintf(writer, "\tinvalid: %s\n", tunnel.Error)
+		} else {
+			_, _ = fmt.Fprintf(writer, "\taccount %s\n", tunnel.AccountTag)
+		}
+	}
+	if r.AccountTag != "" {
+		_, _ = fmt.Fprintf(writer, "ACCOUNT:\t%s\n", r.AccountTag)
+	}
+	_ = writer.Flush()
+
+	for _, warning := range r.Warnings {
+		_, _ = fmt.Fprintf(w, "\nWarning: %s\n", warning)
+	}
+	if len(r.Problems) == 0 {
+		_, _ = fmt.Fprintln(w, "\nThe credentials are valid.")
+		return
+	}
+	_, _ = fmt.Fprintln(w, "\nProblems:")
+	for _, problem := range r.Problems {
+		_, _ = fmt.Fprintf(w, "- %s\n", problem)
+	}
+}
+
+func describeResolved(path, source string) string {
+	if path == "" {
+		return fmt.Sprintf("none (%s)", source)
+	}
+	return fmt.Sprintf("%s (%s)", path, source)
+}
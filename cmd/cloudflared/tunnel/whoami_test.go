@@ -0,0 +1,81 @@
+package tunnel
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/credentials"
+)
+
+func TestWhoami(t *testing.T) {
+	dir := t.TempDir()
+	tunnelID := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	certPath := filepath.Join(dir, "cert.pem")
+	cert, err := credentials.EncodeOriginCert(&credentials.OriginCert{ZoneID: "zone", APIToken: "token", AccountID: "account"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certPath, cert, 0600))
+	credentialsPath := filepath.Join(dir, tunnelID.String()+".json")
+	require.NoError(t, os.WriteFile(credentialsPath, []byte(`{"AccountTag":"account","TunnelSecret":"c2VjcmV0","TunnelID":"df5ed608-b8b4-4109-89f3-9f2cf199df64"}`), 0600))
+
+	whoami := func(args ...string) *WhoamiReport {
+		flagSet := flag.NewFlagSet("whoami", flag.PanicOnError)
+		flagSet.String(credentials.OriginCertFlag, "", "")
+		flagSet.String(CredFileFlag, "", "")
+		flagSet.String(CredContentsFlag, "", "")
+		flagSet.String(TunnelTokenFlag, "", "")
+		flagSet.String(TunnelTokenFileFlag, "", "")
+		flagSet.Int(TunnelTokenFDFlag, -1, "")
+		require.NoError(t, flagSet.Parse(args))
+		c := cli.NewContext(cli.NewApp(), flagSet, nil)
+		log := zerolog.Nop()
+		sc := &subcommandContext{c: c, log: &log, fs: realFileSystem{}}
+		return sc.whoami(newFlagSources(c), c.Args().First())
+	}
+
+	// The credentials file is found next to the origin certificate
+	report := whoami("--origincert", certPath, tunnelID.String())
+	assert.Empty(t, report.Problems)
+	assert.Equal(t, originCertReport{Path: certPath, Source: "command line --origincert", AccountTag: "account", ZoneID: "zone"}, report.OriginCert)
+	require.Len(t, report.Tunnels, 1)
+	assert.Equal(t, tunnelReport{
+		Tunnel:            tunnelID.String(),
+		Source:            sourceArgument,
+		TunnelID:          tunnelID,
+		CredentialsKind:   credentialsKindFile,
+		Credentials:       credentialsPath,
+		CredentialsSource: "default search for df5ed608-b8b4-4109-89f3-9f2cf199df64.json",
+		AccountTag:        "account",
+	}, report.Tunnels[0])
+	assert.Equal(t, "account", report.AccountTag)
+
+	// The token takes precedence
+	token := "eyJhIjoib3RoZXIiLCJ0IjoiZGY1ZWQ2MDgtYjhiNC00MTA5LTg5ZjMtOWYyY2YxOTlkZjY0IiwicyI6ImMyVmpjbVYwIn0="
+	report = whoami("--origincert", certPath, "--token", token, tunnelID.String())
+	assert.Empty(t, report.Problems)
+	require.Len(t, report.Tunnels, 1)
+	assert.Equal(t, "command line --token", report.Tunnels[0].Source)
+	assert.Equal(t, tunnelID, report.Tunnels[0].TunnelID)
+	assert.Equal(t, "other", report.AccountTag)
+	assert.Len(t, report.Warnings, 2, "the tunnel argument is ignored and the origin certificate is for another account")
+
+	// The credentials file of another tunnel
+	report = whoami("--origincert", certPath, "--credentials-file", credentialsPath, uuid.New().String())
+	require.Len(t, report.Problems, 1)
+	assert.Contains(t, report.Problems[0], "is for tunnel df5ed608-b8b4-4109-89f3-9f2cf199df64")
+
+	// A missing default origin certificate is only a problem if it's needed
+	report = whoami()
+	assert.Empty(t, report.Problems)
+	assert.Empty(t, report.Tunnels)
+	assert.Equal(t, sourceDefaultSearch, report.OriginCert.Source)
+	report = whoami("--origincert", filepath.Join(dir, "missing.pem"))
+	assert.Len(t, report.Problems, 1)
+}
@@ -8,11 +8,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
@@ -42,20 +45,56 @@ const (
 	LogFieldWindowsServiceName = "windowsServiceName"
 )
 
+var (
+	windowsServiceNameFlag = &cli.StringFlag{
+		Name:  "name",
+		Usage: "Name of the service, to install several services each running its own tunnel. The service is named Cloudflared-NAME.",
+	}
+	windowsServiceTunnelFlag = &cli.StringFlag{
+		Name:  "tunnel",
+		Usage: "Name or ID of the tunnel of the config file the service runs.",
+	}
+	windowsServiceRestartDelayFlag = &cli.DurationFlag{
+		Name:  "restart-delay",
+		Usage: "How long the service manager waits before restarting the service when it fails.",
+		Value: recoverActionDelay,
+	}
+	windowsServiceFailureResetFlag = &cli.DurationFlag{
+		Name:  "failure-reset-period",
+		Usage: "How long the service has to run without failing for the service manager to reset its failure count.",
+		Value: failureCountResetPeriod,
+	}
+
+	windowsServiceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
 func runApp(app *cli.App, graceShutdownC chan struct{}) {
 	app.Commands = append(app.Commands, &cli.Command{
 		Name:  "service",
 		Usage: "Manages the cloudflared Windows service",
 		Subcommands: []*cli.Command{
 			{
-				Name:   "install",
-				Usage:  "Install cloudflared as a Windows service",
+				Name:      "install",
+				Usage:     "Install cloudflared as a Windows service",
+				UsageText: "cloudflared [--config FILEPATH] service install [--name NAME] [--tunnel TUNNEL] [TOKEN]",
+				Description: `Installs a service running the tunnel of the token, or the one of the config file. To run several tunnels
+on the same machine, install a named service for each of them, e.g.:
+
+  cloudflared --config C:\cloudflared\web.yml service install --name web
+  cloudflared service install --name ssh TOKEN`,
 				Action: cliutil.ConfiguredAction(installWindowsService),
+				Flags: []cli.Flag{
+					windowsServiceNameFlag,
+					windowsServiceTunnelFlag,
+					windowsServiceRestartDelayFlag,
+					windowsServiceFailureResetFlag,
+				},
 			},
 			{
 				Name:   "uninstall",
 				Usage:  "Uninstall the cloudflared service",
 				Action: cliutil.ConfiguredAction(uninstallWindowsService),
+				Flags:  []cli.Flag{windowsServiceNameFlag},
 			},
 		},
 	})
@@ -105,16 +144,26 @@ type windowsService struct {
 // of the service will be set to Stopped when this function returns.
 func (s *windowsService) Execute(serviceArgs []string, r <-chan svc.ChangeRequest, statusChan chan<- svc.Status) (ssec bool, errno uint32) {
 	log := logger.Create(nil)
-	elog, err := eventlog.Open(windowsServiceName)
+	// The service manager passes the name of the service first, one of the named services if several are installed
+	serviceName := windowsServiceName
+	if len(serviceArgs) > 0 && serviceArgs[0] != "" {
+		serviceName = serviceArgs[0]
+	}
+	elog, err := eventlog.Open(serviceName)
 	if err != nil {
-		log.Err(err).Msgf("Cannot open event log for %s", windowsServiceName)
+		log.Err(err).Msgf("Cannot open event log for %s", serviceName)
 		return
 	}
 	defer elog.Close()
+	// The loggers created by the app write the errors and the connections of the tunnels to the event log
+	logger.ServiceEventLog = elog
+	defer func() {
+		logger.ServiceEventLog = nil
+	}()
 
-	elog.Info(1, fmt.Sprintf("%s service starting", windowsServiceName))
+	elog.Info(logger.EventIDServiceStarting, fmt.Sprintf("%s service starting", serviceName))
 	defer func() {
-		elog.Info(1, fmt.Sprintf("%s service stopped", windowsServiceName))
+		elog.Info(logger.EventIDServiceStopped, fmt.Sprintf("%s service stopped", serviceName))
 	}()
 
 	// the arguments passed here are only meaningful if they were manually
@@ -128,7 +177,7 @@ func (s *windowsService) Execute(serviceArgs []string, r <-chan svc.ChangeReques
 		// fall back to the arguments from ImagePath (or, as sc calls it, binPath)
 		args = os.Args
 	}
-	elog.Info(1, fmt.Sprintf("%s service arguments: %v", windowsServiceName, args))
+	elog.Info(logger.EventIDServiceArguments, fmt.Sprintf("%s service arguments: %v", serviceName, args))
 
 	statusChan <- svc.Status{State: svc.StartPending}
 	errC := make(chan error)
@@ -146,26 +195,26 @@ func (s *windowsService) Execute(serviceArgs []string, r <-chan svc.ChangeReques
 			case svc.Stop, svc.Shutdown:
 				if s.graceShutdownC != nil {
 					// start graceful shutdown
-					elog.Info(1, "cloudflared starting graceful shutdown")
+					elog.Info(logger.EventIDGracefulShutdown, "cloudflared starting graceful shutdown")
 					close(s.graceShutdownC)
 					s.graceShutdownC = nil
 					statusChan <- svc.Status{State: svc.StopPending}
 					continue
 				}
 				// repeated attempts at graceful shutdown forces immediate stop
-				elog.Info(1, "cloudflared terminating immediately")
+				elog.Info(logger.EventIDImmediateShutdown, "cloudflared terminating immediately")
 				statusChan <- svc.Status{State: svc.StopPending}
 				return false, 0
 			default:
-				elog.Error(1, fmt.Sprintf("unexpected control request #%d", c))
+				elog.Error(logger.EventIDUnexpectedControl, fmt.Sprintf("unexpected control request #%d", c))
 			}
 		case err := <-errC:
 			if err != nil {
-				elog.Error(1, fmt.Sprintf("cloudflared terminated with error %v", err))
+				elog.Error(logger.EventIDServiceFailed, fmt.Sprintf("cloudflared terminated with error %v", err))
 				ssec = true
 				errno = 1
 			} else {
-				elog.Info(1, "cloudflared terminated without error")
+				elog.Info(logger.EventIDTerminated, "cloudflared terminated without error")
 				errno = 0
 			}
 			return
@@ -176,7 +225,12 @@ func (s *windowsService) Execute(serviceArgs []string, r <-chan svc.ChangeReques
 func installWindowsService(c *cli.Context) error {
 	zeroLogger := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
 
-	zeroLogger.Info().Msg("Installing cloudflared Windows service")
+	serviceName, displayName, err := windowsServiceIdentity(c)
+	if err != nil {
+		return err
+	}
+
+	zeroLogger.Info().Msgf("Installing cloudflared Windows service %s", serviceName)
 	exepath, err := os.Executable()
 	if err != nil {
 		return errors.Wrap(err, "Cannot find path name that start the process")
@@ -186,33 +240,33 @@ func installWindowsService(c *cli.Context) error {
 		return errors.Wrap(err, "Cannot establish a connection to the service control manager")
 	}
 	defer m.Disconnect()
-	s, err := m.OpenService(windowsServiceName)
-	log := zeroLogger.With().Str(LogFieldWindowsServiceName, windowsServiceName).Logger()
+	s, err := m.OpenService(serviceName)
+	log := zeroLogger.With().Str(LogFieldWindowsServiceName, serviceName).Logger()
 	if err == nil {
 		s.Close()
-		return fmt.Errorf(serviceAlreadyExistsWarn(windowsServiceName))
+		return fmt.Errorf(serviceAlreadyExistsWarn(serviceName))
 	}
-	extraArgs, err := getServiceExtraArgsFromCliArgs(c, &log)
+	extraArgs, err := windowsServiceArgs(c, &log)
 	if err != nil {
 		errMsg := "Unable to determine extra arguments for windows service"
 		log.Err(err).Msg(errMsg)
 		return errors.Wrap(err, errMsg)
 	}
 
-	config := mgr.Config{StartType: mgr.StartAutomatic, DisplayName: windowsServiceDescription}
-	s, err = m.CreateService(windowsServiceName, exepath, config, extraArgs...)
+	config := mgr.Config{StartType: mgr.StartAutomatic, DisplayName: displayName}
+	s, err = m.CreateService(serviceName, exepath, config, extraArgs...)
 	if err != nil {
 		return errors.Wrap(err, "Cannot install service")
 	}
 	defer s.Close()
 	log.Info().Msg("cloudflared agent service is installed")
-	err = eventlog.InstallAsEventCreate(windowsServiceName, eventlog.Error|eventlog.Warning|eventlog.Info)
+	err = eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info)
 	if err != nil {
 		s.Delete()
 		return errors.Wrap(err, "Cannot install event logger")
 	}
 
-	err = configRecoveryOption(s.Handle)
+	err = configRecoveryOption(s.Handle, c.Duration(windowsServiceRestartDelayFlag.Name), c.Duration(windowsServiceFailureResetFlag.Name))
 	if err != nil {
 		log.Err(err).Msg("Cannot set service recovery actions")
 		log.Info().Msgf("See %s to manually configure service recovery actions", windowsServiceUrl)
@@ -225,10 +279,53 @@ func installWindowsService(c *cli.Context) error {
 	return err
 }
 
+// windowsServiceIdentity returns the name and the display name of the service, those of the named service if --name is
+// set.
+func windowsServiceIdentity(c *cli.Context) (string, string, error) {
+	name := c.String(windowsServiceNameFlag.Name)
+	if name == "" {
+		return windowsServiceName, windowsServiceDescription, nil
+	}
+	if !windowsServiceNameRegexp.MatchString(name) {
+		return "", "", cliutil.UsageError("The service name %s can only contain letters, digits, - and _", name)
+	}
+	return fmt.Sprintf("%s-%s", windowsServiceName, name), fmt.Sprintf("%s (%s)", windowsServiceDescription, name), nil
+}
+
+// windowsServiceArgs returns the arguments of the service: it runs the tunnel of the token, or the tunnel of the
+// config file given with --config.
+func windowsServiceArgs(c *cli.Context, log *zerolog.Logger) ([]string, error) {
+	if c.NArg() > 0 {
+		return getServiceExtraArgsFromCliArgs(c, log)
+	}
+	var args []string
+	if c.IsSet("config") {
+		configPath, err := filepath.Abs(c.String("config"))
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot find the absolute path of the config file")
+		}
+		args = append(args, "--config", configPath)
+	} else if c.String(windowsServiceNameFlag.Name) != "" {
+		// Otherwise all the named services would run the tunnel of the default config file
+		return nil, cliutil.UsageError("A named service runs the tunnel of a token, or of the config file given with --config")
+	}
+	if tunnel := c.String(windowsServiceTunnelFlag.Name); tunnel != "" {
+		return append(args, "tunnel", "run", tunnel), nil
+	}
+	if len(args) > 0 {
+		args = append(args, "tunnel", "run")
+	}
+	return args, nil
+}
+
 func uninstallWindowsService(c *cli.Context) error {
+	serviceName, _, err := windowsServiceIdentity(c)
+	if err != nil {
+		return err
+	}
 	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog).
 		With().
-		Str(LogFieldWindowsServiceName, windowsServiceName).Logger()
+		Str(LogFieldWindowsServiceName, serviceName).Logger()
 
 	log.Info().Msg("Uninstalling cloudflared agent service")
 	m, err := mgr.Connect()
@@ -236,9 +333,9 @@ func uninstallWindowsService(c *cli.Context) error {
 		return errors.Wrap(err, "Cannot establish a connection to the service control manager")
 	}
 	defer m.Disconnect()
-	s, err := m.OpenService(windowsServiceName)
+	s, err := m.OpenService(serviceName)
 	if err != nil {
-		return fmt.Errorf("Agent service %s is not installed, so it could not be uninstalled", windowsServiceName)
+		return fmt.Errorf("Agent service %s is not installed, so it could not be uninstalled", serviceName)
 	}
 	defer s.Close()
 
@@ -254,7 +351,7 @@ func uninstallWindowsService(c *cli.Context) error {
 		return errors.Wrap(err, "Cannot delete agent service")
 	}
 	log.Info().Msg("Agent service for cloudflared was uninstalled successfully")
-	err = eventlog.Remove(windowsServiceName)
+	err = eventlog.Remove(serviceName)
 	if err != nil {
 		return errors.Wrap(err, "Cannot remove event logger")
 	}
@@ -300,12 +397,12 @@ type recoveryAction struct {
 
 // until https://github.com/golang/go/issues/23239 is release, we will need to
 // configure through ChangeServiceConfig2
-func configRecoveryOption(handle windows.Handle) error {
+func configRecoveryOption(handle windows.Handle, restartDelay, resetPeriod time.Duration) error {
 	actions := []recoveryAction{
-		{recoveryType: uint32(scActionRestart), delay: uint32(recoverActionDelay / time.Millisecond)},
+		{recoveryType: uint32(scActionRestart), delay: uint32(restartDelay / time.Millisecond)},
 	}
 	serviceRecoveryActions := serviceFailureActions{
-		resetPeriod: uint32(failureCountResetPeriod / time.Second),
+		resetPeriod: uint32(resetPeriod / time.Second),
 		actionCount: uint32(len(actions)),
 		actions:     uintptr(unsafe.Pointer(&actions[0])),
 	}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
 	"time"
@@ -229,6 +230,18 @@ type OriginRequestConfig struct {
 	IPRules []IngressIPRule `yaml:"ipRules" json:"ipRules,omitempty"`
 	// Attempt to connect to origin with HTTP/2
 	Http2Origin *bool `yaml:"http2Origin" json:"http2Origin,omitempty"`
+	// Send the requests to an https origin over HTTP/3: "always", or "alt-svc" once the origin advertises h3
+	Http3Origin *string `yaml:"http3Origin" json:"http3Origin,omitempty"`
+	// Flush the streamed response body to the edge at least this often
+	FlushInterval *CustomDuration `yaml:"flushInterval" json:"flushInterval,omitempty"`
+	// Flush the response body to the edge after every write, e.g. for Server-Sent Events or long polls
+	FlushImmediately *bool `yaml:"flushImmediately" json:"flushImmediately,omitempty"`
+	// Maximum size of the request headers in bytes, larger requests are answered with 431
+	MaxRequestHeaderBytes *int `yaml:"maxRequestHeaderBytes" json:"maxRequestHeaderBytes,omitempty"`
+	// Maximum length of the request URL, longer ones are answered with 431
+	MaxURLLength *int `yaml:"maxURLLength" json:"maxURLLength,omitempty"`
+	// Maximum number of request headers, requests with more are answered with 431
+	MaxRequestHeaderCount *int `yaml:"maxRequestHeaderCount" json:"maxRequestHeaderCount,omitempty"`
 	// Access holds all access related configs
 	Access *AccessConfig `yaml:"access" json:"access,omitempty"`
 }
@@ -255,12 +268,66 @@ type Configuration struct {
 	Ingress       []UnvalidatedIngressRule
 	WarpRouting   WarpRoutingConfig   `yaml:"warp-routing"`
 	OriginRequest OriginRequestConfig `yaml:"originRequest"`
-	sourceFile    string
+	// Tunnels are the named tunnels run together by a single cloudflared process, each with its own ingress
+	Tunnels []TunnelConfiguration `yaml:"tunnels"`
+	// Profiles are selected with --profile to operate the tunnels of another account
+	Profiles   map[string]Profile `yaml:"profiles"`
+	sourceFile string
+}
+
+// TunnelConfiguration is one of the tunnels of a configuration file that runs several of them.
+type TunnelConfiguration struct {
+	TunnelID        string `yaml:"tunnel"`
+	CredentialsFile string `yaml:"credentials-file"`
+	Ingress         []UnvalidatedIngressRule
+	WarpRouting     WarpRoutingConfig   `yaml:"warp-routing"`
+	OriginRequest   OriginRequestConfig `yaml:"originRequest"`
+}
+
+// Profile is a set of origin certificate, credentials and configuration file, e.g. those of one account.
+type Profile struct {
+	ConfigFile      string `yaml:"config"`
+	OriginCert      string `yaml:"origincert"`
+	CredentialsFile string `yaml:"credentials-file"`
+}
+
+// FindProfile returns the profile with the given name of the configuration file, with its paths expanded.
+func FindProfile(configFile, name string) (*Profile, error) {
+	if configFile == "" {
+		return nil, errors.Errorf("profile %s can't be found without a configuration file listing the profiles", name)
+	}
+	file, err := os.Open(configFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the configuration file with the profiles")
+	}
+	defer file.Close()
+	var configuration Configuration
+	if err := yaml.NewDecoder(file).Decode(&configuration); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "error parsing YAML in config file at "+configFile)
+	}
+	profile, ok := configuration.Profiles[name]
+	if !ok {
+		return nil, errors.Errorf("there is no profile %s in the configuration file %s", name, configFile)
+	}
+	for _, path := range []*string{&profile.ConfigFile, &profile.OriginCert, &profile.CredentialsFile} {
+		if *path == "" {
+			continue
+		}
+		if *path, err = homedir.Expand(*path); err != nil {
+			return nil, err
+		}
+	}
+	return &profile, nil
 }
 
 type WarpRoutingConfig struct {
 	ConnectTimeout *CustomDuration `yaml:"connectTimeout" json:"connectTimeout,omitempty"`
 	TCPKeepAlive   *CustomDuration `yaml:"tcpKeepAlive" json:"tcpKeepAlive,omitempty"`
+	// DisableICMP lists the routes (CIDRs) towards which ICMP packets are not proxied.
+	DisableICMP []string `yaml:"disableICMP" json:"disableICMP,omitempty"`
+	// DisableICMPVirtualNetworks lists the virtual networks, by name or ID, towards whose routes to the tunnel ICMP
+	// packets are not proxied. The routes are looked up with the API, which requires the origin certificate.
+	DisableICMPVirtualNetworks []string `yaml:"disableICMPVirtualNetworks" json:"disableICMPVirtualNetworks,omitempty"`
 }
 
 type configFileSettings struct {
@@ -273,6 +340,25 @@ func (c *Configuration) Source() string {
 	return c.sourceFile
 }
 
+// ForTunnel returns the configuration of one of the tunnels of the configuration file. The top-level warp-routing
+// and originRequest apply to the tunnels that don't set their own.
+func (c *Configuration) ForTunnel(tunnel TunnelConfiguration) *Configuration {
+	conf := &Configuration{
+		TunnelID:      tunnel.TunnelID,
+		Ingress:       tunnel.Ingress,
+		WarpRouting:   tunnel.WarpRouting,
+		OriginRequest: tunnel.OriginRequest,
+		sourceFile:    c.sourceFile,
+	}
+	if reflect.ValueOf(conf.WarpRouting).IsZero() {
+		conf.WarpRouting = c.WarpRouting
+	}
+	if reflect.ValueOf(conf.OriginRequest).IsZero() {
+		conf.OriginRequest = c.OriginRequest
+	}
+	return conf
+}
+
 func (c *configFileSettings) Int(name string) (int, error) {
 	if raw, ok := c.Settings[name]; ok {
 		if v, ok := raw.(int); ok {
@@ -375,6 +461,12 @@ func GetConfiguration() *Configuration {
 	return &configuration.Configuration
 }
 
+// IsSetInFile returns whether the configuration file that was read sets the flag of the given name.
+func IsSetInFile(name string) bool {
+	_, ok := configuration.Settings[name]
+	return ok
+}
+
 // ReadConfigFile returns InputSourceContext initialized from the configuration file.
 // On repeat calls returns with the same file, returns without reading the file again; however,
 // if value of "config" flag changes, will read the new config file
@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -115,6 +117,75 @@ counters:
 
 }
 
+func TestFindProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+tunnel: my-tunnel
+profiles:
+  work:
+    config: /etc/cloudflared/work.yml
+    origincert: /etc/cloudflared/work.pem
+    credentials-file: /etc/cloudflared/work.json
+  personal:
+    origincert: /etc/cloudflared/personal.pem
+`), 0600))
+
+	profile, err := FindProfile(path, "work")
+	require.NoError(t, err)
+	assert.Equal(t, &Profile{
+		ConfigFile:      "/etc/cloudflared/work.yml",
+		OriginCert:      "/etc/cloudflared/work.pem",
+		CredentialsFile: "/etc/cloudflared/work.json",
+	}, profile)
+
+	profile, err = FindProfile(path, "personal")
+	require.NoError(t, err)
+	assert.Equal(t, &Profile{OriginCert: "/etc/cloudflared/personal.pem"}, profile)
+
+	_, err = FindProfile(path, "other")
+	assert.Error(t, err)
+	_, err = FindProfile("", "work")
+	assert.Error(t, err)
+}
+
+func TestConfigFileTunnels(t *testing.T) {
+	rawYAML := `
+originRequest:
+  connectTimeout: 10s
+tunnels:
+ - tunnel: 5f4e0a4c-61a0-4bc5-8f0b-0a2b7bb1d03e
+   credentials-file: /etc/cloudflared/web.json
+   ingress:
+    - hostname: web.example.com
+      service: http://localhost:8000
+    - service: http_status:404
+ - tunnel: ssh
+   originRequest:
+     connectTimeout: 2s
+   ingress:
+    - service: ssh://localhost:22
+`
+	var config configFileSettings
+	require.NoError(t, yaml.Unmarshal([]byte(rawYAML), &config))
+	config.sourceFile = "/etc/cloudflared/config.yml"
+	require.Len(t, config.Tunnels, 2)
+
+	web := config.ForTunnel(config.Tunnels[0])
+	assert.Equal(t, "5f4e0a4c-61a0-4bc5-8f0b-0a2b7bb1d03e", web.TunnelID)
+	assert.Equal(t, "/etc/cloudflared/web.json", config.Tunnels[0].CredentialsFile)
+	assert.Equal(t, UnvalidatedIngressRule{Hostname: "web.example.com", Service: "http://localhost:8000"}, web.Ingress[0])
+	assert.Len(t, web.Ingress, 2)
+	// The top-level originRequest applies to the tunnel that doesn't set its own
+	assert.Equal(t, 10*time.Second, web.OriginRequest.ConnectTimeout.Duration)
+	assert.Equal(t, "/etc/cloudflared/config.yml", web.Source())
+	assert.Empty(t, web.Tunnels)
+
+	ssh := config.ForTunnel(config.Tunnels[1])
+	assert.Equal(t, "ssh", ssh.TunnelID)
+	assert.Equal(t, "", config.Tunnels[1].CredentialsFile)
+	assert.Equal(t, 2*time.Second, ssh.OriginRequest.ConnectTimeout.Duration)
+}
+
 var rawJsonConfig = []byte(`
 {
 	"connectTimeout": 10,
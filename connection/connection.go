@@ -47,6 +47,9 @@ type Orchestrator interface {
 	UpdateConfig(version int32, config []byte) *pogs.UpdateConfigurationResponse
 	GetConfigJSON() ([]byte, error)
 	GetOriginProxy() (OriginProxy, error)
+	// MaxRequestHeaderBytes is the largest request header limit of the ingress rules, 0 if a rule doesn't limit the
+	// header size
+	MaxRequestHeaderBytes() int
 }
 
 type TunnelProperties struct {
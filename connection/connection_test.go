@@ -40,7 +40,8 @@ type testRequest struct {
 }
 
 type mockOrchestrator struct {
-	originProxy OriginProxy
+	originProxy           OriginProxy
+	maxRequestHeaderBytes int
 }
 
 func (mcr *mockOrchestrator) GetConfigJSON() ([]byte, error) {
@@ -57,6 +58,10 @@ func (mcr *mockOrchestrator) GetOriginProxy() (OriginProxy, error) {
 	return mcr.originProxy, nil
 }
 
+func (mcr *mockOrchestrator) MaxRequestHeaderBytes() int {
+	return mcr.maxRequestHeaderBytes
+}
+
 func (mcr *mockOrchestrator) WarpRoutingEnabled() (enabled bool) {
 	return true
 }
@@ -1,6 +1,10 @@
 package connection
 
-import "net"
+import (
+	"net"
+
+	"github.com/cloudflare/cloudflared/tlsconfig"
+)
 
 // Event is something that happened to a connection, e.g. disconnection or registration.
 type Event struct {
@@ -10,6 +14,8 @@ type Event struct {
 	Protocol    Protocol
 	URL         string
 	EdgeAddress net.IP
+	// TLS are the parameters negotiated with the edge, set for Connected events
+	TLS *tlsconfig.ConnectionParameters
 }
 
 // Status is the status of a connection.
@@ -28,4 +34,7 @@ const (
 	RegisteringTunnel
 	// We're unregistering tunnel from the edge in preparation for a disconnect
 	Unregistering
+	// ProtocolFallback means the connection switched to the fallback protocol after failing to connect with the
+	// current one.
+	ProtocolFallback
 )
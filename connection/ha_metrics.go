@@ -0,0 +1,104 @@
+package connection
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	quicpogs "github.com/cloudflare/cloudflared/quic"
+)
+
+var haConnectionLabels = []string{"tunnel_id", "conn_index", "edge_location", "edge_ip_version", "protocol"}
+
+var (
+	haConnectionUptime = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, TunnelSubsystem, "ha_connection_uptime_seconds"),
+		"How long each HA connection has been registered with the edge, by edge location, IP version and protocol",
+		haConnectionLabels, nil,
+	)
+	haConnectionRTT = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, TunnelSubsystem, "ha_connection_rtt_seconds"),
+		"Smoothed RTT to the edge of each HA connection, by edge location, IP version and protocol. Only QUIC connections measure it.",
+		haConnectionLabels, nil,
+	)
+)
+
+// haConnection is a connection registered with the edge.
+type haConnection struct {
+	location    string
+	ipVersion   string
+	protocol    Protocol
+	connectedAt time.Time
+}
+
+// haConnectionKey identifies a connection among those of all the tunnels running in the process.
+type haConnectionKey struct {
+	tunnelID  uuid.UUID
+	connIndex uint8
+}
+
+// haConnections collects the uptime and RTT of the registered connections, labeled by where they are connected to.
+type haConnections struct {
+	lock        sync.Mutex
+	connections map[haConnectionKey]haConnection
+	// rtt returns the RTT of the connection of the index of the tunnel, false if it isn't measured
+	rtt func(tunnelID uuid.UUID, connIndex uint8) (time.Duration, bool)
+}
+
+func newHAConnections() *haConnections {
+	return &haConnections{
+		connections: make(map[haConnectionKey]haConnection),
+		rtt:         quicpogs.SmoothedRTT,
+	}
+}
+
+func (h *haConnections) connected(tunnelID uuid.UUID, connIndex uint8, protocol Protocol, location string, edgeAddress net.IP) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.connections[haConnectionKey{tunnelID: tunnelID, connIndex: connIndex}] = haConnection{
+		location:    location,
+		ipVersion:   edgeIPVersion(edgeAddress),
+		protocol:    protocol,
+		connectedAt: time.Now(),
+	}
+}
+
+func (h *haConnections) disconnected(tunnelID uuid.UUID, connIndex uint8) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.connections, haConnectionKey{tunnelID: tunnelID, connIndex: connIndex})
+}
+
+func (h *haConnections) Describe(ch chan<- *prometheus.Desc) {
+	ch <- haConnectionUptime
+	ch <- haConnectionRTT
+}
+
+func (h *haConnections) Collect(ch chan<- prometheus.Metric) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for key, conn := range h.connections {
+		labels := []string{key.tunnelID.String(), uint8ToString(key.connIndex), conn.location, conn.ipVersion, conn.protocol.String()}
+		ch <- prometheus.MustNewConstMetric(haConnectionUptime, prometheus.GaugeValue, time.Since(conn.connectedAt).Seconds(), labels...)
+		if conn.protocol != QUIC {
+			continue
+		}
+		if rtt, ok := h.rtt(key.tunnelID, key.connIndex); ok {
+			ch <- prometheus.MustNewConstMetric(haConnectionRTT, prometheus.GaugeValue, rtt.Seconds(), labels...)
+		}
+	}
+}
+
+func edgeIPVersion(address net.IP) string {
+	switch {
+	case address == nil:
+		return ""
+	case address.To4() != nil:
+		return "4"
+	default:
+		return "6"
+	}
+}
@@ -0,0 +1,56 @@
+package connection
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHAConnectionsCollect(t *testing.T) {
+	connections := newHAConnections()
+	tunnelID := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	otherTunnelID := uuid.MustParse("af5ed608-b8b4-4109-89f3-9f2cf199df64")
+	connections.rtt = func(id uuid.UUID, connIndex uint8) (time.Duration, bool) {
+		if id == otherTunnelID {
+			return 40 * time.Millisecond, true
+		}
+		return 25 * time.Millisecond, connIndex == 0
+	}
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(connections))
+
+	connections.connected(tunnelID, 0, QUIC, "lhr01", net.ParseIP("198.41.192.7"))
+	connections.connected(tunnelID, 1, HTTP2, "ams01", net.ParseIP("2606:4700:a0::1"))
+	connections.connected(tunnelID, 2, QUIC, "lhr01", net.ParseIP("198.41.200.7"))
+	connections.disconnected(tunnelID, 2)
+	// Another tunnel of the process has its own connections of the same index
+	connections.connected(otherTunnelID, 0, QUIC, "cdg01", net.ParseIP("198.41.192.8"))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	metrics := make(map[string]map[string]float64)
+	for _, family := range families {
+		values := make(map[string]float64)
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			key := labels["tunnel_id"][:2] + "/" + labels["conn_index"] + "/" + labels["edge_location"] + "/" + labels["edge_ip_version"] + "/" + labels["protocol"]
+			values[key] = metric.GetGauge().GetValue()
+		}
+		metrics[family.GetName()] = values
+	}
+
+	uptime := metrics["cloudflared_tunnel_ha_connection_uptime_seconds"]
+	require.Len(t, uptime, 3)
+	assert.Contains(t, uptime, "df/0/lhr01/4/quic")
+	assert.Contains(t, uptime, "df/1/ams01/6/http2")
+	assert.Contains(t, uptime, "af/0/cdg01/4/quic")
+	assert.Equal(t, map[string]float64{"df/0/lhr01/4/quic": 0.025, "af/0/cdg01/4/quic": 0.04}, metrics["cloudflared_tunnel_ha_connection_rtt_seconds"])
+}
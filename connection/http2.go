@@ -29,8 +29,19 @@ const (
 	ConfigurationUpdate       = "update-configuration"
 )
 
+// unlimitedHeaderBytes is the header size the HTTP/2 server accepts when a rule doesn't limit it, the HTTP/2 settings
+// can't advertise an unlimited header list
+const unlimitedHeaderBytes = 64 << 20
+
 var errEdgeConnectionClosed = fmt.Errorf("connection with edge closed")
 
+func http2MaxHeaderBytes(maxRequestHeaderBytes int) int {
+	if maxRequestHeaderBytes <= 0 {
+		return unlimitedHeaderBytes
+	}
+	return maxRequestHeaderBytes
+}
+
 // HTTP2Connection represents a net.Conn that uses HTTP2 frames to proxy traffic from the edge to cloudflared on the
 // origin.
 type HTTP2Connection struct {
@@ -81,6 +92,9 @@ func (c *HTTP2Connection) Serve(ctx context.Context) error {
 	c.server.ServeConn(c.conn, &http2.ServeConnOpts{
 		Context: ctx,
 		Handler: c,
+		// The ingress rules check the header limits of the requests, the server only has to accept the largest one.
+		// The limit of a connection is advertised when it starts, a configuration raising it applies to the next ones.
+		BaseConfig: &http.Server{MaxHeaderBytes: http2MaxHeaderBytes(c.orchestrator.MaxRequestHeaderBytes())},
 	})
 
 	switch {
@@ -116,7 +130,7 @@ func (c *HTTP2Connection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var requestErr error
 	switch connType {
 	case TypeControlStream:
-		requestErr = c.controlStreamHandler.ServeControlStream(r.Context(), respWriter, c.connOptions, c.orchestrator)
+		requestErr = c.controlStreamHandler.ServeControlStream(r.Context(), respWriter, r.TLS, c.connOptions, c.orchestrator)
 		if requestErr != nil {
 			c.controlStreamErr = requestErr
 		}
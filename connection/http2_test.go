@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -163,6 +164,38 @@ func TestServeHTTP(t *testing.T) {
 	wg.Wait()
 }
 
+func TestServeHTTPMaxHeaderBytes(t *testing.T) {
+	http2Conn, edgeConn := newTestHTTP2Connection()
+	http2Conn.orchestrator = &mockOrchestrator{originProxy: &mockOriginProxy{}, maxRequestHeaderBytes: 4 << 20}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		http2Conn.Serve(ctx)
+	}()
+
+	edgeHTTP2Conn, err := testTransport.NewClientConn(edgeConn)
+	require.NoError(t, err)
+	// Headers over the 1 MiB default of net/http are accepted up to the limit of the rules
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8080/ok", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", strings.Repeat("a", 2<<20))
+	resp, err := edgeHTTP2Conn.RoundTrip(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	cancel()
+	wg.Wait()
+}
+
+func TestHTTP2MaxHeaderBytes(t *testing.T) {
+	require.Equal(t, 4<<20, http2MaxHeaderBytes(4<<20))
+	require.Equal(t, unlimitedHeaderBytes, http2MaxHeaderBytes(0))
+}
+
 type mockNamedTunnelRPCClient struct {
 	shouldFail   error
 	registered   chan struct{}
@@ -31,6 +31,7 @@ type tunnelMetrics struct {
 
 	tunnelsHA           tunnelsForHA
 	userHostnamesCounts *prometheus.CounterVec
+	haConnections       *haConnections
 
 	localConfigMetrics *localConfigMetrics
 }
@@ -134,6 +135,9 @@ func initTunnelMetrics() *tunnelMetrics {
 	)
 	prometheus.MustRegister(registerSuccess)
 
+	haConnections := newHAConnections()
+	prometheus.MustRegister(haConnections)
+
 	return &tunnelMetrics{
 		serverLocations:     serverLocations,
 		oldServerLocations:  make(map[string]string),
@@ -142,6 +146,7 @@ func initTunnelMetrics() *tunnelMetrics {
 		regFail:             registerFail,
 		rpcFail:             rpcFail,
 		userHostnamesCounts: userHostnamesCounts,
+		haConnections:       haConnections,
 		localConfigMetrics:  newLocalConfigMetrics(),
 	}
 }
@@ -3,11 +3,13 @@ package connection
 import (
 	"net"
 	"strings"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 
 	"github.com/cloudflare/cloudflared/management"
+	"github.com/cloudflare/cloudflared/tlsconfig"
 )
 
 const (
@@ -24,6 +26,8 @@ type Observer struct {
 	metrics         *tunnelMetrics
 	tunnelEventChan chan Event
 	addSinkChan     chan EventSink
+	// tunnelID is the tunnel whose connections registered, it keys the metrics of the connections
+	tunnelID atomic.Pointer[uuid.UUID]
 }
 
 type EventSink interface {
@@ -62,8 +66,10 @@ func (o *Observer) sendRegisteringEvent(connIndex uint8) {
 	o.sendEvent(Event{Index: connIndex, EventType: RegisteringTunnel})
 }
 
-func (o *Observer) sendConnectedEvent(connIndex uint8, protocol Protocol, location string, edgeAddress net.IP) {
-	o.sendEvent(Event{Index: connIndex, EventType: Connected, Protocol: protocol, Location: location, EdgeAddress: edgeAddress})
+func (o *Observer) sendConnectedEvent(tunnelID uuid.UUID, connIndex uint8, protocol Protocol, location string, edgeAddress net.IP, tlsParams *tlsconfig.ConnectionParameters) {
+	o.tunnelID.Store(&tunnelID)
+	o.metrics.haConnections.connected(tunnelID, connIndex, protocol, location, edgeAddress)
+	o.sendEvent(Event{Index: connIndex, EventType: Connected, Protocol: protocol, Location: location, EdgeAddress: edgeAddress, TLS: tlsParams})
 }
 
 func (o *Observer) SendURL(url string) {
@@ -78,6 +84,7 @@ func (o *Observer) SendURL(url string) {
 }
 
 func (o *Observer) SendReconnect(connIndex uint8) {
+	o.disconnected(connIndex)
 	o.sendEvent(Event{Index: connIndex, EventType: Reconnecting})
 }
 
@@ -85,10 +92,21 @@ func (o *Observer) sendUnregisteringEvent(connIndex uint8) {
 	o.sendEvent(Event{Index: connIndex, EventType: Unregistering})
 }
 
+func (o *Observer) SendProtocolFallback(connIndex uint8, protocol Protocol) {
+	o.sendEvent(Event{Index: connIndex, EventType: ProtocolFallback, Protocol: protocol})
+}
+
 func (o *Observer) SendDisconnect(connIndex uint8) {
+	o.disconnected(connIndex)
 	o.sendEvent(Event{Index: connIndex, EventType: Disconnected})
 }
 
+func (o *Observer) disconnected(connIndex uint8) {
+	if tunnelID := o.tunnelID.Load(); tunnelID != nil {
+		o.metrics.haConnections.disconnected(*tunnelID, connIndex)
+	}
+}
+
 func (o *Observer) sendEvent(e Event) {
 	select {
 	case o.tunnelEventChan <- e:
@@ -124,7 +124,8 @@ func (q *quicConnection) Serve(ctx context.Context) error {
 
 // serveControlStream will serve the RPC; blocking until the control plane is done.
 func (q *quicConnection) serveControlStream(ctx context.Context, controlStream quic.Stream) error {
-	return q.controlStreamHandler.ServeControlStream(ctx, controlStream, q.connOptions, q.orchestrator)
+	tlsState := q.conn.ConnectionState().TLS
+	return q.controlStreamHandler.ServeControlStream(ctx, controlStream, &tlsState, q.connOptions, q.orchestrator)
 }
 
 // Close the connection with no errors specified.
@@ -14,6 +14,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/cloudflare/cloudflared/datagramsession"
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/management"
 	"github.com/cloudflare/cloudflared/packet"
@@ -45,6 +46,10 @@ type datagramV2Connection struct {
 	// datagramMuxer mux/demux datagrams from quic connection
 	datagramMuxer *cfdquic.DatagramMuxerV2
 	packetRouter  *ingress.PacketRouter
+	flows         *flow.Table
+	// dscp preserves the DSCP sent by the edge on the packets sent to the origins
+	dscp  bool
+	index uint8
 
 	rpcTimeout         time.Duration
 	streamWriteTimeout time.Duration
@@ -58,6 +63,8 @@ func NewDatagramV2Connection(ctx context.Context,
 	index uint8,
 	rpcTimeout time.Duration,
 	streamWriteTimeout time.Duration,
+	flows *flow.Table,
+	dscp bool,
 	logger *zerolog.Logger,
 ) DatagramSessionHandler {
 	sessionDemuxChan := make(chan *packet.Session, demuxChanCapacity)
@@ -70,6 +77,9 @@ func NewDatagramV2Connection(ctx context.Context,
 		sessionManager,
 		datagramMuxer,
 		packetRouter,
+		flows,
+		dscp,
+		index,
 		rpcTimeout,
 		streamWriteTimeout,
 		logger,
@@ -122,8 +132,16 @@ func (q *datagramV2Connection) RegisterUdpSession(ctx context.Context, sessionID
 		attribute.String("src", originProxy.LocalAddr().String()),
 	)
 
-	session, err := q.sessionManager.RegisterSession(ctx, sessionID, originProxy)
+	flowEntry := q.flows.Open(flow.UDP, sessionID.String(), originProxy.LocalAddr().String(), fmt.Sprintf("%s:%d", dstIP, dstPort), q.index)
+	// Closing the socket ends the session, which unregisters it from the edge
+	flowEntry.OnCut(func() { _ = originProxy.Close() })
+	origin := flow.WrapOrigin(originProxy, flowEntry)
+	if conn, ok := originProxy.(net.Conn); ok && q.dscp {
+		origin = ingress.NewDSCPOrigin(origin, conn)
+	}
+	session, err := q.sessionManager.RegisterSession(ctx, sessionID, origin)
 	if err != nil {
+		flowEntry.Close()
 		originProxy.Close()
 		log.Err(err).Str(datagramsession.LogFieldSessionID, datagramsession.FormatSessionID(sessionID)).Msgf("Failed to register udp session")
 		tracing.EndWithErrorStatus(registerSpan, err)
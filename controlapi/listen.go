@@ -0,0 +1,70 @@
+package controlapi
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Listen listens on the address of the API, which is either unix:PATH for a Unix socket only the user can connect
+// to, or HOST:PORT for a loopback address. The API controls the tunnels, so it isn't served on other addresses.
+func Listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return listenUnix(strings.TrimPrefix(path, "//"))
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a control API address, it must be unix:PATH or HOST:PORT: %w", address, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("the control API is only served on loopback addresses or Unix sockets, not on %s", address)
+	}
+	return net.Listen("tcp", address)
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("the control API socket has no path")
+	}
+	// A socket left behind by a previous run would make the listener fail
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	// The socket is created in a directory only the user can enter, and moved in place once it's restricted to the
+	// user, so that other users can't connect in between
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".controlapi-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the directory of the control API socket: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	tempPath := filepath.Join(dir, "socket")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tempPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The listener would remove its temporary path when closed, instead of the socket moved in place
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(tempPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict the control API socket to the user: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to move the control API socket in place: %w", err)
+	}
+	return &unixListener{UnixListener: listener, path: path}, nil
+}
+
+// unixListener removes its socket when it's closed.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	_ = os.Remove(l.path)
+	return err
+}
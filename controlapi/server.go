@@ -0,0 +1,246 @@
+// Package controlapi serves a local REST API reporting the state of the tunnels of the process, such as their edge
+// connections, flows and ingress rule stats, and controlling them, e.g. to drain an edge connection. It is the
+// building block for external controllers, so it is only served on a Unix socket or a loopback address. Any local
+// user can connect to a loopback address, so the tunnels are only controlled through a Unix socket restricted to the
+// user, and the requests of browsers are rejected so that web pages can't reach the API.
+package controlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/proxy"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+// ConfigVersioner reports the version of the configuration applied to a tunnel.
+type ConfigVersioner interface {
+	ConfigVersion() int32
+}
+
+// Drainer drains the edge connections of a tunnel.
+type Drainer interface {
+	Drain(connIndex uint8) bool
+}
+
+// Tunnel is a tunnel of the process, identified in the paths of the API by its ID or name.
+type Tunnel struct {
+	ID          uuid.UUID
+	Name        string
+	Connections *tunnelstate.ConnTracker
+	Flows       *flow.Table
+	Config      ConfigVersioner
+	// Drainer, if not nil, drains the edge connections on POST /v1/tunnels/{tunnel}/connections/{index}/drain
+	Drainer Drainer
+}
+
+// tunnelStatus is the response of /v1/tunnels.
+type tunnelStatus struct {
+	ID            uuid.UUID                           `json:"id"`
+	Name          string                              `json:"name,omitempty"`
+	ConfigVersion int32                               `json:"configVersion"`
+	Connections   []tunnelstate.IndexedConnectionInfo `json:"connections"`
+	Flows         map[flow.Protocol]int               `json:"flows"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type server struct {
+	tunnels []Tunnel
+	// control serves the endpoints controlling the tunnels, only on a Unix socket
+	control bool
+	log     *zerolog.Logger
+}
+
+// Serve serves the API on the listener until the context is cancelled.
+func Serve(ctx context.Context, listener net.Listener, tunnels []Tunnel, log *zerolog.Logger) error {
+	s := &server{tunnels: tunnels, control: listener.Addr().Network() == "unix", log: log}
+	httpServer := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+	log.Info().Msgf("Serving the control API on %s", listener.Addr())
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *server) handler() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("GET /v1/tunnels", s.listTunnels)
+	router.HandleFunc("GET /v1/tunnels/{tunnel}", s.withTunnel(s.getTunnel))
+	router.HandleFunc("GET /v1/tunnels/{tunnel}/connections", s.withTunnel(s.listConnections))
+	router.HandleFunc("POST /v1/tunnels/{tunnel}/connections/{index}/drain", s.controlling(s.withTunnel(s.drainConnection)))
+	router.HandleFunc("GET /v1/tunnels/{tunnel}/flows", s.withTunnel(s.listFlows))
+	router.HandleFunc("POST /v1/tunnels/{tunnel}/flows/{protocol}/cut", s.controlling(s.withTunnel(s.cutFlows)))
+	router.HandleFunc("GET /v1/rules", s.listRules)
+	return s.rejectBrowsers(router)
+}
+
+// rejectBrowsers rejects the requests of web pages, which carry an Origin header, and on a loopback address the
+// requests for another host, as a page rebinding its domain to the loopback address sends them without an Origin.
+func (s *server) rejectBrowsers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			s.writeError(w, http.StatusForbidden, errors.New("the control API doesn't serve browsers"))
+			return
+		}
+		if !s.control && !isLoopbackHost(r.Host) {
+			s.writeError(w, http.StatusForbidden, fmt.Errorf("the control API doesn't serve the host %s", r.Host))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// controlling only serves the handler on a Unix socket.
+func (s *server) controlling(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.control {
+			s.writeError(w, http.StatusForbidden, errors.New("the tunnels are only controlled through the control API on a Unix socket"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func isLoopbackHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *server) withTunnel(handler func(http.ResponseWriter, *http.Request, *Tunnel)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("tunnel")
+		for i := range s.tunnels {
+			if tunnel := &s.tunnels[i]; tunnel.ID.String() == key || (tunnel.Name != "" && tunnel.Name == key) {
+				handler(w, r, tunnel)
+				return
+			}
+		}
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("there is no tunnel %s", key))
+	}
+}
+
+func (s *server) listTunnels(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]tunnelStatus, 0, len(s.tunnels))
+	for i := range s.tunnels {
+		statuses = append(statuses, status(&s.tunnels[i]))
+	}
+	s.writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *server) getTunnel(w http.ResponseWriter, r *http.Request, tunnel *Tunnel) {
+	s.writeJSON(w, http.StatusOK, status(tunnel))
+}
+
+func (s *server) listConnections(w http.ResponseWriter, r *http.Request, tunnel *Tunnel) {
+	s.writeJSON(w, http.StatusOK, connections(tunnel))
+}
+
+func (s *server) drainConnection(w http.ResponseWriter, r *http.Request, tunnel *Tunnel) {
+	index, err := strconv.ParseUint(r.PathValue("index"), 10, 8)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("%s is not a connection index", r.PathValue("index")))
+		return
+	}
+	if tunnel.Drainer == nil {
+		s.writeError(w, http.StatusNotImplemented, errors.New("the connections of the tunnel can't be drained"))
+		return
+	}
+	if !tunnel.Drainer.Drain(uint8(index)) {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("connection %d isn't served or is already draining", index))
+		return
+	}
+	s.log.Info().Str("tunnelID", tunnel.ID.String()).Uint8("connIndex", uint8(index)).Msg("Draining connection on request of the control API")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *server) listFlows(w http.ResponseWriter, r *http.Request, tunnel *Tunnel) {
+	protocol := flow.Protocol(r.URL.Query().Get("protocol"))
+	flows := make([]flow.Info, 0)
+	for _, info := range tunnel.Flows.Flows() {
+		if protocol == "" || info.Protocol == protocol {
+			flows = append(flows, info)
+		}
+	}
+	s.writeJSON(w, http.StatusOK, flows)
+}
+
+func (s *server) cutFlows(w http.ResponseWriter, r *http.Request, tunnel *Tunnel) {
+	protocol := flow.Protocol(r.PathValue("protocol"))
+	if protocol != flow.TCP && protocol != flow.UDP {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("only the %s and %s flows can be cut, not %s", flow.TCP, flow.UDP, protocol))
+		return
+	}
+	cut := tunnel.Flows.Cut(protocol)
+	s.log.Info().Str("tunnelID", tunnel.ID.String()).Int("flows", cut).Msgf("Cut the %s flows on request of the control API", protocol)
+	s.writeJSON(w, http.StatusOK, struct {
+		Cut int `json:"cut"`
+	}{Cut: cut})
+}
+
+func (s *server) listRules(w http.ResponseWriter, r *http.Request) {
+	stats := proxy.IngressRuleStats()
+	if stats == nil {
+		stats = []proxy.RuleStats{}
+	}
+	s.writeJSON(w, http.StatusOK, stats)
+}
+
+func status(tunnel *Tunnel) tunnelStatus {
+	return tunnelStatus{
+		ID:            tunnel.ID,
+		Name:          tunnel.Name,
+		ConfigVersion: tunnel.Config.ConfigVersion(),
+		Connections:   connections(tunnel),
+		Flows: map[flow.Protocol]int{
+			flow.TCP:  tunnel.Flows.Count(flow.TCP),
+			flow.UDP:  tunnel.Flows.Count(flow.UDP),
+			flow.ICMP: tunnel.Flows.Count(flow.ICMP),
+		},
+	}
+}
+
+func connections(tunnel *Tunnel) []tunnelstate.IndexedConnectionInfo {
+	connections := tunnel.Connections.GetActiveConnections()
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].Index < connections[j].Index
+	})
+	return connections
+}
+
+func (s *server) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.log.Err(err).Msg("Failed to write the control API response")
+	}
+}
+
+func (s *server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
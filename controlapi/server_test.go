@@ -0,0 +1,189 @@
+package controlapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+type configVersion int32
+
+func (v configVersion) ConfigVersion() int32 {
+	return int32(v)
+}
+
+type mockDrainer struct {
+	drained []uint8
+}
+
+func (d *mockDrainer) Drain(connIndex uint8) bool {
+	if connIndex > 3 {
+		return false
+	}
+	d.drained = append(d.drained, connIndex)
+	return true
+}
+
+func newTestServer(t *testing.T) (*server, *mockDrainer) {
+	log := zerolog.Nop()
+	tracker := tunnelstate.NewConnTracker(&log)
+	tracker.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Connected, Protocol: connection.QUIC, EdgeAddress: net.IPv4(198, 41, 192, 7)})
+	tracker.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected, Protocol: connection.HTTP2, EdgeAddress: net.IPv4(198, 41, 200, 13)})
+	flows := flow.NewTable()
+	flows.Open(flow.UDP, "1", "10.0.0.1:53000", "10.0.0.2:53", 1)
+	flows.Open(flow.TCP, "", "", "10.0.0.2:22", 0)
+	drainer := &mockDrainer{}
+	return &server{
+		tunnels: []Tunnel{{
+			ID:          uuid.MustParse("5b6d8c36-3a0e-4a43-8b44-5b0f1f1e1f1e"),
+			Name:        "web",
+			Connections: tracker,
+			Flows:       flows,
+			Config:      configVersion(3),
+			Drainer:     drainer,
+		}},
+		control: true,
+		log:     &log,
+	}, drainer
+}
+
+func request[T any](t *testing.T, handler http.Handler, method, path string, expectedStatus int) T {
+	req := httptest.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, expectedStatus, w.Code, w.Body.String())
+	var body T
+	if w.Header().Get("Content-Type") == "application/json" {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	}
+	return body
+}
+
+func TestListTunnels(t *testing.T) {
+	s, _ := newTestServer(t)
+	tunnels := request[[]tunnelStatus](t, s.handler(), http.MethodGet, "/v1/tunnels", http.StatusOK)
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, "web", tunnels[0].Name)
+	assert.Equal(t, int32(3), tunnels[0].ConfigVersion)
+	assert.Equal(t, map[flow.Protocol]int{flow.TCP: 1, flow.UDP: 1, flow.ICMP: 0}, tunnels[0].Flows)
+	require.Len(t, tunnels[0].Connections, 2)
+	assert.Equal(t, uint8(0), tunnels[0].Connections[0].Index)
+	assert.Equal(t, connection.QUIC, tunnels[0].Connections[1].Protocol)
+}
+
+func TestGetTunnel(t *testing.T) {
+	s, _ := newTestServer(t)
+	byName := request[tunnelStatus](t, s.handler(), http.MethodGet, "/v1/tunnels/web", http.StatusOK)
+	byID := request[tunnelStatus](t, s.handler(), http.MethodGet, "/v1/tunnels/5b6d8c36-3a0e-4a43-8b44-5b0f1f1e1f1e", http.StatusOK)
+	assert.Equal(t, byName, byID)
+	request[errorResponse](t, s.handler(), http.MethodGet, "/v1/tunnels/other", http.StatusNotFound)
+}
+
+func TestListFlows(t *testing.T) {
+	s, _ := newTestServer(t)
+	flows := request[[]flow.Info](t, s.handler(), http.MethodGet, "/v1/tunnels/web/flows?protocol=udp", http.StatusOK)
+	require.Len(t, flows, 1)
+	assert.Equal(t, "10.0.0.2:53", flows[0].Dst)
+	flows = request[[]flow.Info](t, s.handler(), http.MethodGet, "/v1/tunnels/web/flows", http.StatusOK)
+	assert.Len(t, flows, 2)
+}
+
+func TestCutFlows(t *testing.T) {
+	s, _ := newTestServer(t)
+	cut := request[struct {
+		Cut int `json:"cut"`
+	}](t, s.handler(), http.MethodPost, "/v1/tunnels/web/flows/tcp/cut", http.StatusOK)
+	// The flow of the test can't be cut, as it has no owner to close it
+	assert.Equal(t, 0, cut.Cut)
+	request[errorResponse](t, s.handler(), http.MethodPost, "/v1/tunnels/web/flows/icmp/cut", http.StatusBadRequest)
+}
+
+func TestDrainConnection(t *testing.T) {
+	s, drainer := newTestServer(t)
+	request[any](t, s.handler(), http.MethodPost, "/v1/tunnels/web/connections/1/drain", http.StatusAccepted)
+	assert.Equal(t, []uint8{1}, drainer.drained)
+	request[errorResponse](t, s.handler(), http.MethodPost, "/v1/tunnels/web/connections/4/drain", http.StatusNotFound)
+	request[errorResponse](t, s.handler(), http.MethodPost, "/v1/tunnels/web/connections/256/drain", http.StatusBadRequest)
+	request[any](t, s.handler(), http.MethodGet, "/v1/tunnels/web/connections/1/drain", http.StatusMethodNotAllowed)
+}
+
+func TestControlOnlyOnUnixSocket(t *testing.T) {
+	s, drainer := newTestServer(t)
+	s.control = false
+	request[errorResponse](t, s.handler(), http.MethodPost, "/v1/tunnels/web/connections/1/drain", http.StatusForbidden)
+	request[errorResponse](t, s.handler(), http.MethodPost, "/v1/tunnels/web/flows/tcp/cut", http.StatusForbidden)
+	assert.Empty(t, drainer.drained)
+
+	for _, host := range []string{"127.0.0.1:8080", "localhost:8080", "[::1]:8080", "localhost"} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/tunnels", nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		s.handler().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, host)
+	}
+	// A web page rebinding its domain to the loopback address
+	req := httptest.NewRequest(http.MethodGet, "http://attacker.example.com:8080/v1/tunnels", nil)
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRejectBrowsers(t *testing.T) {
+	s, drainer := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/v1/tunnels/web/connections/1/drain", nil)
+	req.Header.Set("Origin", "https://attacker.example.com")
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, drainer.drained)
+}
+
+func TestListRules(t *testing.T) {
+	s, _ := newTestServer(t)
+	request[[]any](t, s.handler(), http.MethodGet, "/v1/rules", http.StatusOK)
+}
+
+func TestListen(t *testing.T) {
+	listener, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	listener.Close()
+
+	_, err = Listen("0.0.0.0:0")
+	require.Error(t, err, "the API can't be served on all the interfaces")
+	_, err = Listen("example.com:8080")
+	require.Error(t, err)
+
+	if runtime.GOOS != "windows" {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "api.sock")
+		listener, err = Listen("unix:" + path)
+		require.NoError(t, err)
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		// Only the socket is left in the directory
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		conn, err := net.Dial("unix", path)
+		require.NoError(t, err)
+		conn.Close()
+
+		listener.Close()
+		require.NoFileExists(t, path)
+	}
+}
@@ -81,6 +81,22 @@ func decodeOriginCert(blocks []byte) (*OriginCert, error) {
 	return &originCert, nil
 }
 
+// EncodeOriginCert encodes the origin certificate in the PEM format written by cloudflared login.
+func EncodeOriginCert(cert *OriginCert) ([]byte, error) {
+	if cert.ZoneID == "" || cert.APIToken == "" {
+		return nil, fmt.Errorf("Missing token in the certificate")
+	}
+	token, err := json.Marshal(namedTunnelToken{
+		ZoneID:    cert.ZoneID,
+		AccountID: cert.AccountID,
+		APIToken:  cert.APIToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ARGO TUNNEL TOKEN", Bytes: token}), nil
+}
+
 func readOriginCert(originCertPath string) ([]byte, error) {
 	originCert, err := os.ReadFile(originCertPath)
 	if err != nil {
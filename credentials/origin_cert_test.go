@@ -50,6 +50,22 @@ func TestJSONArgoTunnelToken(t *testing.T) {
 	CloudflareTunnelTokenTest(t, "test-cloudflare-tunnel-cert-json.pem")
 }
 
+func TestEncodeOriginCert(t *testing.T) {
+	cert := &OriginCert{
+		ZoneID:    "7b0a4d77dfb881c1a3b7d61ea9443e19",
+		APIToken:  "test-service-key",
+		AccountID: "abcdabcdabcdabcd1234567890abcdef",
+	}
+	blocks, err := EncodeOriginCert(cert)
+	assert.NoError(t, err)
+	decoded, err := decodeOriginCert(blocks)
+	assert.NoError(t, err)
+	assert.Equal(t, cert, decoded)
+
+	_, err = EncodeOriginCert(&OriginCert{AccountID: cert.AccountID, APIToken: cert.APIToken})
+	assert.Error(t, err)
+}
+
 func CloudflareTunnelTokenTest(t *testing.T, path string) {
 	blocks, err := os.ReadFile(path)
 	assert.NoError(t, err)
@@ -135,6 +135,23 @@ func (s *Session) transportToDst(payload []byte) (int, error) {
 	return n, err
 }
 
+// dscpMarker is implemented by the destinations that mark their packets with the DSCP of the eyeball packets.
+type dscpMarker interface {
+	MarkDSCP(dscp uint8) error
+}
+
+// markDSCP marks the packets sent to the destination with dscp, if the destination supports it.
+func (s *Session) markDSCP(dscp uint8) {
+	marker, ok := s.dstConn.(dscpMarker)
+	if !ok {
+		return
+	}
+	// Failing to mark the socket is not fatal for the session, the packets are still sent as best effort
+	if err := marker.MarkDSCP(dscp); err != nil {
+		s.log.Debug().Err(err).Uint8("dscp", dscp).Msg("Failed to preserve DSCP marking of session")
+	}
+}
+
 // Sends the last active time to the idle checker loop without blocking. activeAtChan will only be full when there
 // are many concurrent read/write. It is fine to lose some precision
 func (s *Session) markActive() {
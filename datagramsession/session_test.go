@@ -231,6 +231,39 @@ func TestZeroBytePayload(t *testing.T) {
 	require.NoError(t, errGroup.Wait())
 }
 
+type dscpConn struct {
+	io.ReadWriteCloser
+	marked []uint8
+}
+
+func (c *dscpConn) MarkDSCP(dscp uint8) error {
+	c.marked = append(c.marked, dscp)
+	return nil
+}
+
+func TestSendToSessionMarksDSCP(t *testing.T) {
+	sessionID := uuid.New()
+	cfdConn, originConn := net.Pipe()
+	defer originConn.Close()
+	dstConn := &dscpConn{ReadWriteCloser: cfdConn}
+
+	mg := NewManager(&nopLogger, nil, nil)
+	mg.sessions[sessionID] = mg.newSession(sessionID, dstConn)
+
+	go func() {
+		buf := make([]byte, 8)
+		for {
+			if _, err := originConn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	mg.sendToSession(&packet.Session{ID: sessionID, Payload: []byte("a")})
+	mg.sendToSession(&packet.Session{ID: sessionID, Payload: []byte("b"), DSCP: 46, Marked: true})
+	mg.sendToSession(&packet.Session{ID: sessionID, Payload: []byte("c"), Marked: true})
+	require.Equal(t, []uint8{46, 0}, dstConn.marked)
+}
+
 type mockTransportSender struct {
 	expectedSessionID uuid.UUID
 	expectedPayload   []byte
@@ -2,6 +2,7 @@ package diagnostic
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,11 +11,29 @@ import (
 	"strconv"
 
 	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/tlsconfig"
 )
 
+// ClientOptions configure how the client reaches a metrics server served over TLS or requiring credentials.
+type ClientOptions struct {
+	// TLS makes the client reach the metrics server over HTTPS
+	TLS bool
+	// CAFile is a PEM file with the CAs of the certificate of the metrics server, the system CAs are used otherwise
+	CAFile string
+	// CertFile and KeyFile are the certificate presented to a metrics server that requires a client certificate
+	CertFile string
+	KeyFile  string
+	// Username and Password are sent with basic auth
+	Username string
+	Password string
+	// BearerToken is sent in an Authorization: Bearer header
+	BearerToken string
+}
+
 type httpClient struct {
 	http.Client
 	baseURL *url.URL
+	options ClientOptions
 }
 
 func NewHTTPClient() *httpClient {
@@ -29,7 +48,40 @@ func NewHTTPClient() *httpClient {
 			Timeout:   defaultTimeout,
 		},
 		nil,
+		ClientOptions{},
+	}
+}
+
+// NewHTTPClientWithOptions returns a client that reaches the metrics servers with the TLS configuration and the
+// credentials of the options.
+func NewHTTPClientWithOptions(options ClientOptions) (*httpClient, error) {
+	client := NewHTTPClient()
+	client.options = options
+	if !options.TLS {
+		return client, nil
+	}
+	params := &tlsconfig.TLSParameters{
+		Cert:       options.CertFile,
+		Key:        options.KeyFile,
+		MinVersion: tls.VersionTLS12,
+	}
+	if options.CAFile != "" {
+		params.RootCAs = []string{options.CAFile}
+	}
+	tlsConfig, err := tlsconfig.GetConfig(params)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the TLS configuration of the metrics client: %w", err)
 	}
+	client.Transport.(*http.Transport).TLSClientConfig = tlsConfig
+	return client, nil
+}
+
+// scheme returns the scheme of the URLs of the metrics servers.
+func (client *httpClient) scheme() string {
+	if client.options.TLS {
+		return "https"
+	}
+	return "http"
 }
 
 func (client *httpClient) SetBaseURL(baseURL *url.URL) {
@@ -48,6 +100,11 @@ func (client *httpClient) GET(ctx context.Context, endpoint string) (*http.Respo
 	}
 
 	req.Header.Add("Accept", "application/json;version=1")
+	if client.options.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+client.options.BearerToken)
+	} else if client.options.Username != "" {
+		req.SetBasicAuth(client.options.Username, client.options.Password)
+	}
 
 	response, err := client.Do(req)
 	if err != nil {
@@ -144,6 +201,15 @@ func (client *httpClient) GetSystemInformation(ctx context.Context, writer io.Wr
 	return copyJSONToWriter(response, writer)
 }
 
+func (client *httpClient) GetEnvironment(ctx context.Context, writer io.Writer) error {
+	response, err := client.GET(ctx, environmentEndpoint)
+	if err != nil {
+		return err
+	}
+
+	return copyJSONToWriter(response, writer)
+}
+
 func (client *httpClient) GetMetrics(ctx context.Context, writer io.Writer) error {
 	response, err := client.GET(ctx, metricsEndpoint)
 	if err != nil {
@@ -171,6 +237,75 @@ func (client *httpClient) GetCliConfiguration(ctx context.Context, writer io.Wri
 	return copyJSONToWriter(response, writer)
 }
 
+func (client *httpClient) GetEffectiveConfiguration(ctx context.Context, writer io.Writer) error {
+	response, err := client.GET(ctx, effectiveConfigurationEndpoint)
+	if err != nil {
+		return err
+	}
+
+	return copyJSONToWriter(response, writer)
+}
+
+func (client *httpClient) GetFlows(ctx context.Context) (*FlowsResponse, error) {
+	response, err := client.GET(ctx, flowsEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	var flows FlowsResponse
+	if err := json.NewDecoder(response.Body).Decode(&flows); err != nil {
+		return nil, fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	return &flows, nil
+}
+
+// GetReadiness returns the readiness of the instance, which its /ready endpoint reports with HTTP 503 when it isn't
+// ready.
+func (client *httpClient) GetReadiness(ctx context.Context) (*Readiness, error) {
+	response, err := client.GET(ctx, readyEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	var readiness Readiness
+	if err := json.NewDecoder(response.Body).Decode(&readiness); err != nil {
+		return nil, fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	return &readiness, nil
+}
+
+func (client *httpClient) GetFlowsToWriter(ctx context.Context, writer io.Writer) error {
+	response, err := client.GET(ctx, flowsEndpoint)
+	if err != nil {
+		return err
+	}
+
+	return copyJSONToWriter(response, writer)
+}
+
+func (client *httpClient) GetTLSToWriter(ctx context.Context, writer io.Writer) error {
+	response, err := client.GET(ctx, tlsEndpoint)
+	if err != nil {
+		return err
+	}
+
+	return copyJSONToWriter(response, writer)
+}
+
 func copyToWriter(response *http.Response, writer io.Writer) error {
 	defer response.Body.Close()
 
@@ -213,4 +348,5 @@ type HTTPClient interface {
 	GetMetrics(ctx context.Context, writer io.Writer) error
 	GetCliConfiguration(ctx context.Context, writer io.Writer) error
 	GetTunnelConfiguration(ctx context.Context, writer io.Writer) error
+	GetFlows(ctx context.Context) (*FlowsResponse, error)
 }
@@ -19,19 +19,23 @@ import (
 )
 
 const (
-	taskSuccess                  = "success"
-	taskFailure                  = "failure"
-	jobReportName                = "job report"
-	tunnelStateJobName           = "tunnel state"
-	systemInformationJobName     = "system information"
-	goroutineJobName             = "goroutine profile"
-	heapJobName                  = "heap profile"
-	metricsJobName               = "metrics"
-	logInformationJobName        = "log information"
-	rawNetworkInformationJobName = "raw network information"
-	networkInformationJobName    = "network information"
-	cliConfigurationJobName      = "cli configuration"
-	configurationJobName         = "configuration"
+	taskSuccess                   = "success"
+	taskFailure                   = "failure"
+	jobReportName                 = "job report"
+	tunnelStateJobName            = "tunnel state"
+	systemInformationJobName      = "system information"
+	environmentJobName            = "environment information"
+	goroutineJobName              = "goroutine profile"
+	heapJobName                   = "heap profile"
+	metricsJobName                = "metrics"
+	logInformationJobName         = "log information"
+	rawNetworkInformationJobName  = "raw network information"
+	networkInformationJobName     = "network information"
+	cliConfigurationJobName       = "cli configuration"
+	configurationJobName          = "configuration"
+	effectiveConfigurationJobName = "effective configuration"
+	flowsJobName                  = "flows"
+	tlsJobName                    = "tls connections"
 )
 
 // Struct used to hold the results of different routines executing the network collection.
@@ -93,6 +97,7 @@ type Options struct {
 	ContainerID    string
 	PodID          string
 	Toggles        Toggles
+	Client         ClientOptions
 }
 
 func collectLogs(
@@ -346,8 +351,8 @@ func resolveInstanceBaseURL(
 	addresses []string,
 ) (*url.URL, *TunnelState, []*AddressableTunnelState, error) {
 	if metricsServerAddress != "" {
-		if !strings.HasPrefix(metricsServerAddress, "http://") {
-			metricsServerAddress = "http://" + metricsServerAddress
+		if !strings.HasPrefix(metricsServerAddress, "http://") && !strings.HasPrefix(metricsServerAddress, "https://") {
+			metricsServerAddress = client.scheme() + "://" + metricsServerAddress
 		}
 		url, err := url.Parse(metricsServerAddress)
 		if err != nil {
@@ -388,6 +393,11 @@ func createJobs(
 			fn:      collectFromEndpointAdapter(client.GetSystemInformation, systemInformationBaseName),
 			bypass:  noDiagSystem,
 		},
+		{
+			jobName: environmentJobName,
+			fn:      collectFromEndpointAdapter(client.GetEnvironment, environmentBaseName),
+			bypass:  noDiagSystem,
+		},
 		{
 			jobName: goroutineJobName,
 			fn:      collectFromEndpointAdapter(client.GetGoroutineDump, goroutinePprofBaseName),
@@ -430,6 +440,21 @@ func createJobs(
 			fn:      collectFromEndpointAdapter(client.GetTunnelConfiguration, configurationBaseName),
 			bypass:  false,
 		},
+		{
+			jobName: effectiveConfigurationJobName,
+			fn:      collectFromEndpointAdapter(client.GetEffectiveConfiguration, effectiveConfigurationBaseName),
+			bypass:  false,
+		},
+		{
+			jobName: flowsJobName,
+			fn:      collectFromEndpointAdapter(client.GetFlowsToWriter, flowsBaseName),
+			bypass:  false,
+		},
+		{
+			jobName: tlsJobName,
+			fn:      collectFromEndpointAdapter(client.GetTLSToWriter, tlsBaseName),
+			bypass:  false,
+		},
 	}
 
 	return jobs
@@ -504,7 +529,10 @@ func RunDiagnostic(
 	log *zerolog.Logger,
 	options Options,
 ) ([]*AddressableTunnelState, error) {
-	client := NewHTTPClient()
+	client, err := NewHTTPClientWithOptions(options.Client)
+	if err != nil {
+		return nil, err
+	}
 
 	baseURL, tunnel, foundTunnels, err := resolveInstanceBaseURL(options.Address, log, client, options.KnownAddresses)
 	if err != nil {
@@ -559,3 +587,34 @@ func RunDiagnostic(
 
 	return nil, gerr
 }
+
+// ListFlows retrieves the flows being proxied by a local cloudflared instance. The instance is resolved in the same
+// way as RunDiagnostic does.
+func ListFlows(
+	log *zerolog.Logger,
+	address string,
+	knownAddresses []string,
+	clientOptions ClientOptions,
+) (*FlowsResponse, []*AddressableTunnelState, error) {
+	client, err := NewHTTPClientWithOptions(clientOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	baseURL, _, foundTunnels, err := resolveInstanceBaseURL(address, log, client, knownAddresses)
+	if err != nil {
+		return nil, foundTunnels, err
+	}
+
+	client.SetBaseURL(baseURL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	flows, err := client.GetFlows(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error retrieving flows from %s: %w", baseURL.String(), err)
+	}
+
+	return flows, nil, nil
+}
@@ -112,7 +112,7 @@ func FindMetricsServer(
 	instances := make([]*AddressableTunnelState, 0)
 
 	for _, address := range addresses {
-		url, err := url.Parse("http://" + address)
+		url, err := url.Parse(client.scheme() + "://" + address)
 		if err != nil {
 			log.Debug().Err(err).Msgf("error parsing address %s", address)
 
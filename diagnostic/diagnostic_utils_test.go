@@ -2,8 +2,19 @@ package diagnostic_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -25,7 +36,7 @@ func helperCreateServer(t *testing.T, listeners *gracenet.Net, tunnelID uuid.UUI
 	require.NoError(t, err)
 	log := zerolog.Nop()
 	tracker := tunnelstate.NewConnTracker(&log)
-	handler := diagnostic.NewDiagnosticHandler(&log, 0, nil, tunnelID, connectorID, tracker, map[string]string{}, []string{})
+	handler := diagnostic.NewDiagnosticHandler(&log, 0, nil, tunnelID, connectorID, tracker, nil, map[string]string{}, []string{}, nil)
 	router := http.NewServeMux()
 	router.HandleFunc("/diag/tunnel", handler.TunnelStateHandler)
 	server := &http.Server{
@@ -56,6 +67,69 @@ func helperCreateServer(t *testing.T, listeners *gracenet.Net, tunnelID uuid.UUI
 	return cleanUp
 }
 
+// helperServeMetricsTLS serves the metrics over TLS, requiring the bearer token "token", and returns the address of
+// the server and the PEM file of its self-signed certificate.
+func helperServeMetricsTLS(t *testing.T, config metrics.Config) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	config.TLSConfig = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	config.Credentials = &metrics.Credentials{BearerToken: "token"}
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error)
+	go func() {
+		errC <- metrics.ServeMetrics(listener, ctx, config, &log)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-errC
+	})
+	return listener.Addr().String(), caFile
+}
+
+func TestFindMetricsServer_WithTLSAndCredentials(t *testing.T) {
+	log := zerolog.Nop()
+	tracker := tunnelstate.NewConnTracker(&log)
+	tunnelID, connectorID := uuid.New(), uuid.New()
+	handler := diagnostic.NewDiagnosticHandler(&log, 0, nil, tunnelID, connectorID, tracker, nil, map[string]string{}, []string{}, nil)
+	address, caFile := helperServeMetricsTLS(t, metrics.Config{DiagnosticHandler: handler})
+
+	client, err := diagnostic.NewHTTPClientWithOptions(diagnostic.ClientOptions{TLS: true, CAFile: caFile, BearerToken: "token"})
+	require.NoError(t, err)
+	state, _, err := diagnostic.FindMetricsServer(&log, client, []string{address})
+	require.NoError(t, err)
+	assert.Equal(t, "https://"+address, state.URL.String())
+	assert.Equal(t, tunnelID, state.TunnelID)
+	assert.Equal(t, connectorID, state.ConnectorID)
+
+	for _, options := range []diagnostic.ClientOptions{
+		{},
+		{TLS: true, CAFile: caFile},
+		{TLS: true, CAFile: caFile, BearerToken: "other"},
+		{TLS: true, BearerToken: "token"},
+	} {
+		client, err := diagnostic.NewHTTPClientWithOptions(options)
+		require.NoError(t, err)
+		_, _, err = diagnostic.FindMetricsServer(&log, client, []string{address})
+		assert.ErrorIs(t, err, diagnostic.ErrMetricsServerNotFound, "%+v", options)
+	}
+}
+
 func TestFindMetricsServer_WhenSingleServerIsRunning_ReturnState(t *testing.T) {
 	listeners := gracenet.Net{}
 	tid1 := uuid.New()
@@ -0,0 +1,27 @@
+package diagnostic
+
+// Sources of the values of the effective configuration, from the lowest to the highest precedence.
+const (
+	SourceDefault     = "default"
+	SourceFile        = "file"
+	SourceEnvironment = "env"
+	SourceFlag        = "flag"
+	SourceRemote      = "remote"
+)
+
+// EffectiveSetting is the value a setting of cloudflared has once all of its sources are merged, and the source it
+// comes from.
+type EffectiveSetting struct {
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// EffectiveConfiguration is the configuration a tunnel runs with. The values of the secret settings are redacted.
+type EffectiveConfiguration struct {
+	// Version is the version of the remote configuration applied, -1 if the tunnel runs its local configuration
+	Version       int32                       `json:"version"`
+	Settings      map[string]EffectiveSetting `json:"settings"`
+	Ingress       EffectiveSetting            `json:"ingress"`
+	WarpRouting   EffectiveSetting            `json:"warp-routing"`
+	OriginRequest EffectiveSetting            `json:"originRequest"`
+}
@@ -0,0 +1,100 @@
+package diagnostic
+
+import (
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+const redactedValue = "REDACTED"
+
+// processStartTime is approximately when cloudflared started, to report its uptime.
+var processStartTime = time.Now()
+
+// environmentVariablePrefixes are the prefixes of the variables configuring cloudflared, their values are redacted
+// since they can hold tokens and secrets. The values of the non-secret flags are in the cli configuration.
+var environmentVariablePrefixes = []string{"TUNNEL_", "CLOUDFLARED_"}
+
+// environmentVariables are the other variables changing the behavior of cloudflared, reported as they are apart from
+// the credentials of the proxy URLs.
+var environmentVariables = []string{
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "ALL_PROXY",
+	"http_proxy", "https_proxy", "no_proxy", "all_proxy",
+	"GOMAXPROCS", "GOMEMLIMIT", "GOGC", "GODEBUG",
+	"SSL_CERT_FILE", "SSL_CERT_DIR", "TZ",
+	"KUBERNETES_SERVICE_HOST", "container",
+}
+
+// EnvironmentInformation describes the cloudflared process and the environment it runs in.
+type EnvironmentInformation struct {
+	Executable       string            `json:"executable"`
+	WorkingDirectory string            `json:"workingDirectory"`
+	PID              int               `json:"pid"`
+	UID              int               `json:"uid"`
+	StartTime        time.Time         `json:"startTime"`
+	Uptime           string            `json:"uptime"`
+	GoVersion        string            `json:"goVersion"`
+	GoMaxProcs       int               `json:"goMaxProcs"`
+	Goroutines       int               `json:"goroutines"`
+	Variables        map[string]string `json:"variables"`
+}
+
+func collectEnvironment() *EnvironmentInformation {
+	executable, _ := os.Executable()
+	workingDirectory, _ := os.Getwd()
+	return &EnvironmentInformation{
+		Executable:       executable,
+		WorkingDirectory: workingDirectory,
+		PID:              os.Getpid(),
+		UID:              os.Getuid(),
+		StartTime:        processStartTime,
+		Uptime:           time.Since(processStartTime).Round(time.Second).String(),
+		GoVersion:        runtime.Version(),
+		GoMaxProcs:       runtime.GOMAXPROCS(0),
+		Goroutines:       runtime.NumGoroutine(),
+		Variables:        redactEnvironment(os.Environ()),
+	}
+}
+
+// redactEnvironment returns the variables of environ that configure cloudflared, the values of its flags redacted.
+func redactEnvironment(environ []string) map[string]string {
+	variables := make(map[string]string)
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		switch {
+		case hasAnyPrefix(name, environmentVariablePrefixes):
+			variables[name] = redactedValue
+		case slices.Contains(environmentVariables, name):
+			variables[name] = redactURL(value)
+		}
+	}
+	return variables
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL hides the password of the value if it is a URL with credentials, e.g. the URL of a proxy.
+func redactURL(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		return u.Redacted()
+	}
+	u.User = url.User(redactedValue)
+	return u.String()
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/tunnelstate"
 )
 
@@ -21,8 +23,10 @@ type Handler struct {
 	tunnelID        uuid.UUID
 	connectorID     uuid.UUID
 	tracker         *tunnelstate.ConnTracker
+	flows           *flow.Table
 	cliFlags        map[string]string
 	icmpSources     []string
+	effectiveConfig func() (*EffectiveConfiguration, error)
 }
 
 func NewDiagnosticHandler(
@@ -32,8 +36,10 @@ func NewDiagnosticHandler(
 	tunnelID uuid.UUID,
 	connectorID uuid.UUID,
 	tracker *tunnelstate.ConnTracker,
+	flows *flow.Table,
 	cliFlags map[string]string,
 	icmpSources []string,
+	effectiveConfig func() (*EffectiveConfiguration, error),
 ) *Handler {
 	logger := log.With().Logger()
 	if timeout == 0 {
@@ -48,8 +54,10 @@ func NewDiagnosticHandler(
 		tunnelID:        tunnelID,
 		connectorID:     connectorID,
 		tracker:         tracker,
+		flows:           flows,
 		cliFlags:        cliFlags,
 		icmpSources:     icmpSources,
+		effectiveConfig: effectiveConfig,
 	}
 }
 
@@ -57,6 +65,10 @@ func (handler *Handler) InstallEndpoints(router *http.ServeMux) {
 	router.HandleFunc(cliConfigurationEndpoint, handler.ConfigurationHandler)
 	router.HandleFunc(tunnelStateEndpoint, handler.TunnelStateHandler)
 	router.HandleFunc(systemInformationEndpoint, handler.SystemHandler)
+	router.HandleFunc(flowsEndpoint, handler.FlowsHandler)
+	router.HandleFunc(tlsEndpoint, handler.TLSHandler)
+	router.HandleFunc(environmentEndpoint, handler.EnvironmentHandler)
+	router.HandleFunc(effectiveConfigurationEndpoint, handler.EffectiveConfigurationHandler)
 }
 
 type SystemInformationResponse struct {
@@ -117,6 +129,78 @@ func (handler *Handler) TunnelStateHandler(writer http.ResponseWriter, _ *http.R
 	}
 }
 
+type FlowsResponse struct {
+	// Time at which the flows were collected, used to compute the age of each flow
+	CollectedAt time.Time   `json:"collectedAt"`
+	Flows       []flow.Info `json:"flows"`
+}
+
+func (handler *Handler) FlowsHandler(writer http.ResponseWriter, _ *http.Request) {
+	log := handler.log.With().Str(collectorField, flowsCollectorName).Logger()
+	log.Debug().Msg("Collection started")
+
+	defer log.Debug().Msg("Collection finished")
+
+	body := FlowsResponse{
+		CollectedAt: time.Now(),
+		Flows:       handler.flows.Flows(),
+	}
+	if body.Flows == nil {
+		body.Flows = []flow.Info{}
+	}
+	encoder := json.NewEncoder(writer)
+
+	err := encoder.Encode(body)
+	if err != nil {
+		handler.log.Error().Err(err).Msgf("error occurred whilst serializing information")
+		writer.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// TLSResponse are the parameters negotiated by the active TLS connections to the edge and the origins, to audit them
+// against the crypto policy.
+type TLSResponse struct {
+	Edge    []tunnelstate.IndexedConnectionInfo `json:"edge"`
+	Origins []ingress.OriginTLSConnection       `json:"origins"`
+}
+
+func (handler *Handler) TLSHandler(writer http.ResponseWriter, _ *http.Request) {
+	log := handler.log.With().Str(collectorField, tlsCollectorName).Logger()
+	log.Debug().Msg("Collection started")
+
+	defer log.Debug().Msg("Collection finished")
+
+	body := TLSResponse{
+		Edge:    []tunnelstate.IndexedConnectionInfo{},
+		Origins: ingress.ActiveOriginTLSConnections(),
+	}
+	if handler.tracker != nil {
+		body.Edge = handler.tracker.GetActiveConnections()
+	}
+	encoder := json.NewEncoder(writer)
+
+	err := encoder.Encode(body)
+	if err != nil {
+		handler.log.Error().Err(err).Msgf("error occurred whilst serializing information")
+		writer.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (handler *Handler) EnvironmentHandler(writer http.ResponseWriter, _ *http.Request) {
+	log := handler.log.With().Str(collectorField, environmentCollectorName).Logger()
+	log.Info().Msg("Collection started")
+
+	defer log.Info().Msg("Collection finished")
+
+	encoder := json.NewEncoder(writer)
+
+	err := encoder.Encode(collectEnvironment())
+	if err != nil {
+		handler.log.Error().Err(err).Msgf("error occurred whilst serializing information")
+		writer.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 func (handler *Handler) ConfigurationHandler(writer http.ResponseWriter, _ *http.Request) {
 	log := handler.log.With().Str(collectorField, configurationCollectorName).Logger()
 	log.Info().Msg("Collection started")
@@ -134,6 +218,35 @@ func (handler *Handler) ConfigurationHandler(writer http.ResponseWriter, _ *http
 	}
 }
 
+// EffectiveConfigurationHandler reports the configuration the tunnel runs with, merged from the defaults, the
+// configuration file, the environment, the flags and the remote configuration.
+func (handler *Handler) EffectiveConfigurationHandler(writer http.ResponseWriter, _ *http.Request) {
+	log := handler.log.With().Str(collectorField, effectiveConfigurationCollectorName).Logger()
+	log.Info().Msg("Collection started")
+
+	defer log.Info().Msg("Collection finished")
+
+	if handler.effectiveConfig == nil {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	configuration, err := handler.effectiveConfig()
+	if err != nil {
+		log.Error().Err(err).Msg("error occurred whilst merging the configuration")
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(writer)
+
+	err = encoder.Encode(configuration)
+	if err != nil {
+		log.Error().Err(err).Msgf("error occurred whilst serializing information")
+		writer.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 func writeResponse(w http.ResponseWriter, bytes []byte, logger *zerolog.Logger) {
 	bytesWritten, err := w.Write(bytes)
 	if err != nil {
@@ -0,0 +1,132 @@
+package diagnostic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// HealthStatus is the health of a cloudflared instance. Its values are the exit codes of the health check, which
+// follow the convention of the Nagios plugins.
+type HealthStatus int
+
+const (
+	// HealthOK is an instance that has all its connections and whose origins resolve.
+	HealthOK HealthStatus = 0
+	// HealthDegraded is an instance that serves traffic, but has fewer connections than it needs to be ready or
+	// origins that don't resolve.
+	HealthDegraded HealthStatus = 1
+	// HealthCritical is an instance that can't serve traffic, either because a tunnel has no connection or because
+	// it couldn't be reached.
+	HealthCritical HealthStatus = 2
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthOK:
+		return "OK"
+	case HealthDegraded:
+		return "DEGRADED"
+	default:
+		return "CRITICAL"
+	}
+}
+
+// TunnelReadiness is the readiness of one of the tunnels of an instance that runs several.
+type TunnelReadiness struct {
+	ReadyConnections  uint     `json:"readyConnections"`
+	UnresolvedOrigins []string `json:"unresolvedOrigins,omitempty"`
+}
+
+// Readiness is the response of the /ready endpoint of the metrics server. Tunnels is only set when the instance runs
+// several tunnels.
+type Readiness struct {
+	Status            int                        `json:"status"`
+	ReadyConnections  uint                       `json:"readyConnections"`
+	UnresolvedOrigins []string                   `json:"unresolvedOrigins,omitempty"`
+	Tunnels           map[string]TunnelReadiness `json:"tunnels,omitempty"`
+}
+
+// Health is the health of an instance, with the reasons it isn't OK.
+type Health struct {
+	Status  HealthStatus `json:"status"`
+	Reasons []string     `json:"reasons,omitempty"`
+}
+
+func (h *Health) degrade(status HealthStatus, reason string) {
+	if status > h.Status {
+		h.Status = status
+	}
+	h.Reasons = append(h.Reasons, reason)
+}
+
+// evaluateHealth returns the health of an instance from its readiness: critical if a tunnel has no connection,
+// degraded if it isn't ready for another reason.
+func evaluateHealth(readiness *Readiness) Health {
+	var health Health
+	tunnels := readiness.Tunnels
+	if len(tunnels) == 0 {
+		tunnels = map[string]TunnelReadiness{"": {
+			ReadyConnections:  readiness.ReadyConnections,
+			UnresolvedOrigins: readiness.UnresolvedOrigins,
+		}}
+	}
+	names := make([]string, 0, len(tunnels))
+	for name := range tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tunnel := tunnels[name]
+		prefix := ""
+		if name != "" {
+			prefix = fmt.Sprintf("tunnel %s: ", name)
+		}
+		if tunnel.ReadyConnections == 0 {
+			health.degrade(HealthCritical, prefix+"no connection to the edge")
+		}
+		if len(tunnel.UnresolvedOrigins) > 0 {
+			health.degrade(HealthDegraded, prefix+"origins don't resolve: "+strings.Join(tunnel.UnresolvedOrigins, ", "))
+		}
+	}
+	if readiness.Status != http.StatusOK && health.Status == HealthOK {
+		health.degrade(HealthDegraded, "fewer connections to the edge than required to be ready")
+	}
+	return health
+}
+
+// CheckHealth retrieves the readiness of a local cloudflared instance and evaluates its health. The instance is
+// resolved in the same way as RunDiagnostic does.
+func CheckHealth(
+	log *zerolog.Logger,
+	address string,
+	knownAddresses []string,
+	clientOptions ClientOptions,
+) (*Health, []*AddressableTunnelState, error) {
+	client, err := NewHTTPClientWithOptions(clientOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	baseURL, _, foundTunnels, err := resolveInstanceBaseURL(address, log, client, knownAddresses)
+	if err != nil {
+		return nil, foundTunnels, err
+	}
+
+	client.SetBaseURL(baseURL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	readiness, err := client.GetReadiness(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error retrieving readiness from %s: %w", baseURL.String(), err)
+	}
+
+	health := evaluateHealth(readiness)
+	return &health, nil, nil
+}
@@ -0,0 +1,116 @@
+package diagnostic_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/diagnostic"
+	"github.com/cloudflare/cloudflared/metrics"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+func TestCheckHealth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		expected   diagnostic.Health
+	}{
+		{
+			name:       "ready",
+			statusCode: http.StatusOK,
+			body:       `{"status":200,"readyConnections":4}`,
+			expected:   diagnostic.Health{Status: diagnostic.HealthOK},
+		},
+		{
+			name:       "fewer connections than required",
+			statusCode: http.StatusServiceUnavailable,
+			body:       `{"status":503,"readyConnections":1}`,
+			expected: diagnostic.Health{
+				Status:  diagnostic.HealthDegraded,
+				Reasons: []string{"fewer connections to the edge than required to be ready"},
+			},
+		},
+		{
+			name:       "unresolved origins",
+			statusCode: http.StatusServiceUnavailable,
+			body:       `{"status":503,"readyConnections":4,"unresolvedOrigins":["db.internal"]}`,
+			expected: diagnostic.Health{
+				Status:  diagnostic.HealthDegraded,
+				Reasons: []string{"origins don't resolve: db.internal"},
+			},
+		},
+		{
+			name:       "tunnel without connection",
+			statusCode: http.StatusServiceUnavailable,
+			body:       `{"status":503,"tunnels":{"a":{"readyConnections":4},"b":{"readyConnections":0,"unresolvedOrigins":["db.internal"]}}}`,
+			expected: diagnostic.Health{
+				Status:  diagnostic.HealthCritical,
+				Reasons: []string{"tunnel b: no connection to the edge", "tunnel b: origins don't resolve: db.internal"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/ready", r.URL.Path)
+				w.WriteHeader(test.statusCode)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			log := zerolog.Nop()
+			health, _, err := diagnostic.CheckHealth(&log, server.URL, nil, diagnostic.ClientOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, *health)
+		})
+	}
+}
+
+func TestCheckHealthUnreachable(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	log := zerolog.Nop()
+	_, _, err := diagnostic.CheckHealth(&log, server.URL, nil, diagnostic.ClientOptions{})
+	require.Error(t, err)
+}
+
+func TestCheckHealthWithTLSAndCredentials(t *testing.T) {
+	log := zerolog.Nop()
+	tracker := tunnelstate.NewConnTracker(&log)
+	connectorID := uuid.New()
+	address, caFile := helperServeMetricsTLS(t, metrics.Config{
+		ReadyServer:       metrics.NewReadyServer(connectorID, tracker, metrics.ReadinessConfig{MinConnections: 1}),
+		DiagnosticHandler: diagnostic.NewDiagnosticHandler(&log, 0, nil, uuid.New(), connectorID, tracker, nil, map[string]string{}, []string{}, nil),
+	})
+	options := diagnostic.ClientOptions{TLS: true, CAFile: caFile, BearerToken: "token"}
+	expected := diagnostic.Health{Status: diagnostic.HealthCritical, Reasons: []string{"no connection to the edge"}}
+
+	// The instance is found with the credentials, and its readiness is retrieved over TLS
+	health, _, err := diagnostic.CheckHealth(&log, "", []string{address}, options)
+	require.NoError(t, err)
+	assert.Equal(t, expected, *health)
+
+	// The readiness probe doesn't require the credentials
+	health, _, err = diagnostic.CheckHealth(&log, address, nil, diagnostic.ClientOptions{TLS: true, CAFile: caFile})
+	require.NoError(t, err)
+	assert.Equal(t, expected, *health)
+
+	_, _, err = diagnostic.CheckHealth(&log, "", []string{address}, diagnostic.ClientOptions{TLS: true, CAFile: caFile})
+	assert.ErrorIs(t, err, diagnostic.ErrMetricsServerNotFound)
+	_, _, err = diagnostic.CheckHealth(&log, address, nil, diagnostic.ClientOptions{})
+	assert.Error(t, err, "plain HTTP is not served")
+}
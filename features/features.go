@@ -9,6 +9,9 @@ const (
 	FeatureQUICSupportEOF    = "support_quic_eof"
 	FeatureManagementLogs    = "management_logs"
 	FeatureDatagramV3        = "support_datagram_v3"
+	// FeatureDatagramDSCP tells the edge that the DSCP of the eyeball UDP packets can be carried in the datagrams,
+	// so that it's preserved on the packets sent to the origins. The edge doesn't send the DSCP otherwise.
+	FeatureDatagramDSCP = "support_datagram_dscp"
 )
 
 var (
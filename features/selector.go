@@ -26,6 +26,8 @@ const (
 	// If the user passes the --post-quantum flag, we override
 	// CurvePreferences to only support hybrid post-quantum key agreements.
 	PostQuantumStrict
+	// Never offer post quantum key agreements, e.g. when a crypto policy restricts the curves
+	PostQuantumDisabled
 )
 
 // If the TXT record adds other fields, the umarshal logic will ignore those keys
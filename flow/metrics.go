@@ -0,0 +1,85 @@
+package flow
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "cloudflared"
+	subsystem = "flow"
+
+	directionToOrigin   = "to_origin"
+	directionFromOrigin = "from_origin"
+)
+
+var (
+	rttBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+	sessionEdgeRTT = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "session_edge_rtt_seconds",
+		Help:      "Smoothed round trip time to the edge of the QUIC connection that carried each datagram session, observed when the session ends",
+		Buckets:   rttBuckets,
+	}, []string{"protocol"})
+	droppedPackets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "dropped_packets_total",
+		Help:      "Total count of packets dropped by cloudflared while proxying flows",
+	}, []string{"protocol", "direction"})
+	droppedDatagrams = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "dropped_datagrams_total",
+		Help:      "Total count of UDP datagrams and ICMP packets dropped by cloudflared, by the reason they were dropped",
+	}, []string{"protocol", "reason"})
+)
+
+// DropReason is why cloudflared dropped a datagram instead of proxying it.
+type DropReason string
+
+const (
+	// DropOversize is a datagram larger than the payload that the origin socket or the QUIC connection can carry.
+	DropOversize DropReason = "oversize"
+	// DropMalformed is a datagram that couldn't be decoded.
+	DropMalformed DropReason = "malformed"
+	// DropUnknownSession is a datagram of a UDP session that isn't registered, e.g. because it already timed out.
+	DropUnknownSession DropReason = "unknown_session"
+	// DropWriteFailed is a datagram that the origin socket didn't accept.
+	DropWriteFailed DropReason = "write_failed"
+	// DropICMPDisabled is an ICMP packet received while the ICMP proxy isn't running.
+	DropICMPDisabled DropReason = "icmp_disabled"
+	// DropICMPRouteDisabled is an ICMP packet towards a route that has ICMP disabled by the WARP routing configuration.
+	DropICMPRouteDisabled DropReason = "icmp_route_disabled"
+	// DropICMPUnsupportedType is an ICMP packet other than an echo request, or a reply other than an echo reply.
+	DropICMPUnsupportedType DropReason = "icmp_unsupported_type"
+)
+
+func init() {
+	prometheus.MustRegister(
+		sessionEdgeRTT,
+		droppedPackets,
+		droppedDatagrams,
+	)
+}
+
+// observeSessionRTT observes the edge round trip time of a datagram session that ended, unless it isn't measured.
+func observeSessionRTT(info Info) {
+	if info.Protocol == TCP {
+		return
+	}
+	if info.EdgeRTT > 0 {
+		sessionEdgeRTT.WithLabelValues(string(info.Protocol)).Observe(info.EdgeRTT.Seconds())
+	}
+}
+
+func incrementDroppedPackets(protocol Protocol, direction string) {
+	droppedPackets.WithLabelValues(string(protocol), direction).Inc()
+}
+
+// Dropped counts a datagram of the protocol dropped by cloudflared. Unlike the drops recorded on a Flow, it is counted
+// whether flows are tracked or not, including for the datagrams that don't belong to any flow.
+func Dropped(protocol Protocol, reason DropReason) {
+	droppedDatagrams.WithLabelValues(string(protocol), string(reason)).Inc()
+}
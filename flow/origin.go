@@ -0,0 +1,41 @@
+package flow
+
+import "io"
+
+type originConn struct {
+	io.ReadWriteCloser
+	flow *Flow
+}
+
+// WrapOrigin accounts the datagrams read from and written to an origin connection in the provided flow. Closing the
+// returned connection also closes the flow.
+func WrapOrigin(origin io.ReadWriteCloser, flow *Flow) io.ReadWriteCloser {
+	if flow == nil {
+		return origin
+	}
+	return &originConn{
+		ReadWriteCloser: origin,
+		flow:            flow,
+	}
+}
+
+func (c *originConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if err == nil {
+		c.flow.AddPacketFromOrigin(n)
+	}
+	return n, err
+}
+
+func (c *originConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	if err == nil {
+		c.flow.AddPacketToOrigin(n)
+	}
+	return n, err
+}
+
+func (c *originConn) Close() error {
+	c.flow.Close()
+	return c.ReadWriteCloser.Close()
+}
@@ -0,0 +1,373 @@
+// Package flow keeps a table of the TCP, UDP and ICMP flows that are being proxied to origins, so that they can be
+// inspected by operators through the diagnostic endpoints.
+package flow
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Protocol is the transport of a proxied flow.
+type Protocol string
+
+const (
+	TCP  Protocol = "tcp"
+	UDP  Protocol = "udp"
+	ICMP Protocol = "icmp"
+)
+
+// Info is a point-in-time view of a flow that is being proxied to an origin.
+type Info struct {
+	ID              string    `json:"id"`
+	Protocol        Protocol  `json:"protocol"`
+	Src             string    `json:"src,omitempty"`
+	Dst             string    `json:"dst"`
+	ConnIndex       uint8     `json:"connIndex"`
+	StartedAt       time.Time `json:"startedAt"`
+	LastActiveAt    time.Time `json:"lastActiveAt"`
+	BytesToOrigin   uint64    `json:"bytesToOrigin"`
+	BytesFromOrigin uint64    `json:"bytesFromOrigin"`
+
+	// The following are only reported for datagram flows (UDP).
+	PacketsToOrigin   uint64 `json:"packetsToOrigin,omitempty"`
+	PacketsFromOrigin uint64 `json:"packetsFromOrigin,omitempty"`
+	// DropsToOrigin and DropsFromOrigin count the packets that cloudflared dropped, as opposed to packets that
+	// were lost by the origin.
+	DropsToOrigin   uint64 `json:"dropsToOrigin,omitempty"`
+	DropsFromOrigin uint64 `json:"dropsFromOrigin,omitempty"`
+	// EdgeRTT is the smoothed round trip time to the edge of the connection carrying the flow, zero if it isn't
+	// measured.
+	EdgeRTT time.Duration `json:"edgeRTT,omitempty"`
+}
+
+// Age returns how long the flow has been active relative to now.
+func (i Info) Age(now time.Time) time.Duration {
+	return now.Sub(i.StartedAt)
+}
+
+// Flow accounts the activity of a single flow. All methods are safe to call on a nil Flow so that callers don't have
+// to check if flow tracking is enabled.
+type Flow struct {
+	id       string
+	protocol Protocol
+	// src is set once the origin connection of a stream flow is established
+	src       atomic.Pointer[string]
+	dst       string
+	connIndex uint8
+	startedAt time.Time
+
+	// last active unix time in nanoseconds
+	lastActive      atomic.Int64
+	bytesToOrigin   atomic.Uint64
+	bytesFromOrigin atomic.Uint64
+
+	packetsToOrigin   atomic.Uint64
+	packetsFromOrigin atomic.Uint64
+	dropsToOrigin     atomic.Uint64
+	dropsFromOrigin   atomic.Uint64
+	// cut terminates the flow before it ends on its own, e.g. when cloudflared shuts down
+	cut atomic.Pointer[func()]
+
+	table *Table
+}
+
+// AddBytesToOrigin records n bytes proxied from the eyeball to the origin.
+func (f *Flow) AddBytesToOrigin(n int) {
+	if f == nil || n <= 0 {
+		return
+	}
+	f.bytesToOrigin.Add(uint64(n))
+	f.touch()
+}
+
+// AddBytesFromOrigin records n bytes proxied from the origin to the eyeball.
+func (f *Flow) AddBytesFromOrigin(n int) {
+	if f == nil || n <= 0 {
+		return
+	}
+	f.bytesFromOrigin.Add(uint64(n))
+	f.touch()
+}
+
+// AddPacketToOrigin records a datagram of n bytes proxied to the origin.
+func (f *Flow) AddPacketToOrigin(n int) {
+	if f == nil {
+		return
+	}
+	f.packetsToOrigin.Add(1)
+	f.AddBytesToOrigin(n)
+}
+
+// AddPacketFromOrigin records a datagram of n bytes proxied from the origin.
+func (f *Flow) AddPacketFromOrigin(n int) {
+	if f == nil {
+		return
+	}
+	f.packetsFromOrigin.Add(1)
+	f.AddBytesFromOrigin(n)
+}
+
+// DropToOrigin records a packet towards the origin that was dropped by cloudflared.
+func (f *Flow) DropToOrigin() {
+	if f == nil {
+		return
+	}
+	f.dropsToOrigin.Add(1)
+	incrementDroppedPackets(f.protocol, directionToOrigin)
+}
+
+// DropFromOrigin records a packet from the origin that was dropped by cloudflared.
+func (f *Flow) DropFromOrigin() {
+	if f == nil {
+		return
+	}
+	f.dropsFromOrigin.Add(1)
+	incrementDroppedPackets(f.protocol, directionFromOrigin)
+}
+
+// SetSrc sets the source address of a flow that only knows it once it's connected to the origin, e.g. a TCP flow.
+func (f *Flow) SetSrc(src string) {
+	if f == nil {
+		return
+	}
+	f.src.Store(&src)
+}
+
+// OnCut sets the function that terminates the flow when the flows of its protocol are cut.
+func (f *Flow) OnCut(cut func()) {
+	if f == nil {
+		return
+	}
+	f.cut.Store(&cut)
+}
+
+// Close removes the flow from its table.
+func (f *Flow) Close() {
+	if f == nil {
+		return
+	}
+	f.table.remove(f)
+}
+
+func (f *Flow) touch() {
+	f.lastActive.Store(time.Now().UnixNano())
+}
+
+func (f *Flow) info() Info {
+	var src string
+	if p := f.src.Load(); p != nil {
+		src = *p
+	}
+	var edgeRTT time.Duration
+	if f.protocol != TCP {
+		edgeRTT = f.table.edgeRTTOf(f.connIndex)
+	}
+	return Info{
+		ID:              f.id,
+		Protocol:        f.protocol,
+		Src:             src,
+		Dst:             f.dst,
+		ConnIndex:       f.connIndex,
+		StartedAt:       f.startedAt,
+		LastActiveAt:    time.Unix(0, f.lastActive.Load()),
+		BytesToOrigin:   f.bytesToOrigin.Load(),
+		BytesFromOrigin: f.bytesFromOrigin.Load(),
+
+		PacketsToOrigin:   f.packetsToOrigin.Load(),
+		PacketsFromOrigin: f.packetsFromOrigin.Load(),
+		DropsToOrigin:     f.dropsToOrigin.Load(),
+		DropsFromOrigin:   f.dropsFromOrigin.Load(),
+		EdgeRTT:           edgeRTT,
+	}
+}
+
+// Table tracks the active flows of a cloudflared instance. A nil Table is valid and doesn't track anything.
+type Table struct {
+	lock  sync.RWMutex
+	flows map[string]*Flow
+	// nextID is used to generate identifiers for flows that don't provide one
+	nextID atomic.Uint64
+	// closed is told about the flows removed from the table
+	closed atomic.Pointer[func(Info)]
+	// edgeRTT returns the RTT of the connection of the index, false if it isn't measured
+	edgeRTT atomic.Pointer[func(connIndex uint8) (time.Duration, bool)]
+}
+
+func NewTable() *Table {
+	return &Table{
+		flows: make(map[string]*Flow),
+	}
+}
+
+// Open registers a new flow. If id is empty, a unique identifier is generated. If a flow with the same id is
+// already registered, the existing flow is returned so that connectionless flows (e.g. ICMP echoes) can be
+// accounted under the same entry.
+func (t *Table) Open(protocol Protocol, id, src, dst string, connIndex uint8) *Flow {
+	if t == nil {
+		return nil
+	}
+	if id == "" {
+		id = string(protocol) + "-" + strconv.FormatUint(t.nextID.Add(1), 10)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if existing, ok := t.flows[id]; ok {
+		// The flow moved to another connection, keep reporting the most recent one
+		existing.connIndex = connIndex
+		return existing
+	}
+	now := time.Now()
+	f := &Flow{
+		id:        id,
+		protocol:  protocol,
+		dst:       dst,
+		connIndex: connIndex,
+		startedAt: now,
+		table:     t,
+	}
+	if src != "" {
+		f.src.Store(&src)
+	}
+	f.lastActive.Store(now.UnixNano())
+	t.flows[id] = f
+	return f
+}
+
+// OnClose sets the function told about each flow once it is removed from the table, e.g. to log it.
+func (t *Table) OnClose(closed func(Info)) {
+	if t == nil {
+		return
+	}
+	t.closed.Store(&closed)
+}
+
+// SetEdgeRTT sets the function returning the RTT to the edge of the connection of an index, which estimates the
+// RTT of the datagram flows it carries towards the edge.
+func (t *Table) SetEdgeRTT(edgeRTT func(connIndex uint8) (time.Duration, bool)) {
+	if t == nil {
+		return
+	}
+	t.edgeRTT.Store(&edgeRTT)
+}
+
+func (t *Table) edgeRTTOf(connIndex uint8) time.Duration {
+	if edgeRTT := t.edgeRTT.Load(); edgeRTT != nil {
+		if rtt, ok := (*edgeRTT)(connIndex); ok {
+			return rtt
+		}
+	}
+	return 0
+}
+
+// Flows returns a snapshot of all the active flows ordered by start time.
+func (t *Table) Flows() []Info {
+	if t == nil {
+		return nil
+	}
+	t.lock.RLock()
+	flows := make([]Info, 0, len(t.flows))
+	for _, f := range t.flows {
+		flows = append(flows, f.info())
+	}
+	t.lock.RUnlock()
+	sort.Slice(flows, func(i, j int) bool {
+		if flows[i].StartedAt.Equal(flows[j].StartedAt) {
+			return flows[i].ID < flows[j].ID
+		}
+		return flows[i].StartedAt.Before(flows[j].StartedAt)
+	})
+	return flows
+}
+
+// MarshalJSON encodes the snapshot of the active flows, so that they can be served by the management service.
+func (t *Table) MarshalJSON() ([]byte, error) {
+	flows := t.Flows()
+	if flows == nil {
+		flows = []Info{}
+	}
+	return json.Marshal(flows)
+}
+
+// RemoveIdle removes the flows of the given protocol that have not been active for idleTimeout. This is used for
+// connectionless flows that have no explicit close.
+func (t *Table) RemoveIdle(protocol Protocol, idleTimeout time.Duration) {
+	if t == nil {
+		return
+	}
+	deadline := time.Now().Add(-idleTimeout).UnixNano()
+	var removed []*Flow
+	t.lock.Lock()
+	for id, f := range t.flows {
+		if f.protocol == protocol && f.lastActive.Load() < deadline {
+			delete(t.flows, id)
+			removed = append(removed, f)
+		}
+	}
+	t.lock.Unlock()
+	for _, f := range removed {
+		t.notifyClosed(f)
+	}
+}
+
+// Count returns the number of active flows of the given protocol.
+func (t *Table) Count(protocol Protocol) int {
+	if t == nil {
+		return 0
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	count := 0
+	for _, f := range t.flows {
+		if f.protocol == protocol {
+			count++
+		}
+	}
+	return count
+}
+
+// Cut terminates the flows of the given protocol that can be terminated, and returns how many were. The flows are
+// removed from the table when their owners close them.
+func (t *Table) Cut(protocol Protocol) int {
+	if t == nil {
+		return 0
+	}
+	var cuts []func()
+	t.lock.RLock()
+	for _, f := range t.flows {
+		if cut := f.cut.Load(); f.protocol == protocol && cut != nil {
+			cuts = append(cuts, *cut)
+		}
+	}
+	t.lock.RUnlock()
+	// The flows are cut without the lock because they close themselves, which removes them from the table
+	for _, cut := range cuts {
+		cut()
+	}
+	return len(cuts)
+}
+
+func (t *Table) remove(f *Flow) {
+	t.lock.Lock()
+	// Only remove the flow if it hasn't been replaced by another one with the same id
+	current, ok := t.flows[f.id]
+	removed := ok && current == f
+	if removed {
+		delete(t.flows, f.id)
+	}
+	t.lock.Unlock()
+	if removed {
+		t.notifyClosed(f)
+	}
+}
+
+func (t *Table) notifyClosed(f *Flow) {
+	info := f.info()
+	observeSessionRTT(info)
+	if closed := t.closed.Load(); closed != nil {
+		(*closed)(info)
+	}
+}
@@ -0,0 +1,180 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableOpenClose(t *testing.T) {
+	table := NewTable()
+	first := table.Open(TCP, "", "", "localhost:80", 0)
+	second := table.Open(UDP, "session", "127.0.0.1:5000", "1.1.1.1:53", 1)
+	first.AddBytesToOrigin(5)
+	second.AddBytesFromOrigin(7)
+
+	flows := table.Flows()
+	require.Len(t, flows, 2)
+	assert.Equal(t, TCP, flows[0].Protocol)
+	assert.Equal(t, uint64(5), flows[0].BytesToOrigin)
+	assert.Equal(t, "session", flows[1].ID)
+	assert.Equal(t, uint64(7), flows[1].BytesFromOrigin)
+
+	first.Close()
+	flows = table.Flows()
+	require.Len(t, flows, 1)
+	assert.Equal(t, "session", flows[0].ID)
+}
+
+func TestTableOpenExisting(t *testing.T) {
+	table := NewTable()
+	first := table.Open(ICMP, "echo", "10.0.0.1", "1.1.1.1", 0)
+	second := table.Open(ICMP, "echo", "10.0.0.1", "1.1.1.1", 2)
+	assert.Same(t, first, second)
+
+	flows := table.Flows()
+	require.Len(t, flows, 1)
+	assert.Equal(t, uint8(2), flows[0].ConnIndex)
+}
+
+func TestFlowSetSrc(t *testing.T) {
+	table := NewTable()
+	f := table.Open(TCP, "", "", "localhost:80", 0)
+	assert.Empty(t, table.Flows()[0].Src)
+
+	f.SetSrc("127.0.0.1:50000")
+	assert.Equal(t, "127.0.0.1:50000", table.Flows()[0].Src)
+
+	encoded, err := table.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"src":"127.0.0.1:50000"`)
+}
+
+func TestTableRemoveIdle(t *testing.T) {
+	table := NewTable()
+	icmpFlow := table.Open(ICMP, "echo", "10.0.0.1", "1.1.1.1", 0)
+	table.Open(TCP, "", "", "localhost:80", 0)
+	icmpFlow.lastActive.Store(time.Now().Add(-time.Minute).UnixNano())
+
+	table.RemoveIdle(ICMP, time.Second)
+	flows := table.Flows()
+	require.Len(t, flows, 1)
+	assert.Equal(t, TCP, flows[0].Protocol)
+}
+
+func TestTableOnClose(t *testing.T) {
+	table := NewTable()
+	var closed []Info
+	table.OnClose(func(info Info) {
+		closed = append(closed, info)
+	})
+	tcpFlow := table.Open(TCP, "", "", "localhost:80", 0)
+	tcpFlow.AddBytesFromOrigin(3)
+	icmpFlow := table.Open(ICMP, "echo", "10.0.0.1", "1.1.1.1", 0)
+	icmpFlow.lastActive.Store(time.Now().Add(-time.Minute).UnixNano())
+
+	tcpFlow.Close()
+	// A flow is only reported once
+	tcpFlow.Close()
+	table.RemoveIdle(ICMP, time.Second)
+	require.Len(t, closed, 2)
+	assert.Equal(t, TCP, closed[0].Protocol)
+	assert.Equal(t, uint64(3), closed[0].BytesFromOrigin)
+	assert.Equal(t, "echo", closed[1].ID)
+}
+
+func TestTableCut(t *testing.T) {
+	table := NewTable()
+	tcpFlow := table.Open(TCP, "", "", "localhost:80", 0)
+	tcpFlow.OnCut(tcpFlow.Close)
+	// Flows without a way to terminate them are left alone
+	table.Open(TCP, "", "", "localhost:8080", 0)
+	udpFlow := table.Open(UDP, "session", "127.0.0.1:5000", "1.1.1.1:53", 1)
+	udpFlow.OnCut(udpFlow.Close)
+	assert.Equal(t, 2, table.Count(TCP))
+
+	assert.Equal(t, 1, table.Cut(TCP))
+	assert.Equal(t, 1, table.Count(TCP))
+	assert.Equal(t, 1, table.Count(UDP))
+	assert.Equal(t, 0, table.Count(ICMP))
+}
+
+func TestNilTable(t *testing.T) {
+	var table *Table
+	f := table.Open(TCP, "", "", "localhost:80", 0)
+	assert.Nil(t, f)
+	f.AddBytesToOrigin(1)
+	f.OnCut(func() {})
+	f.Close()
+	assert.Empty(t, table.Flows())
+	assert.Zero(t, table.Count(TCP))
+	assert.Zero(t, table.Cut(TCP))
+}
+
+func TestFlowPackets(t *testing.T) {
+	table := NewTable()
+	f := table.Open(UDP, "session", "127.0.0.1:5000", "1.1.1.1:53", 0)
+	f.AddPacketToOrigin(10)
+	f.AddPacketToOrigin(10)
+	f.AddPacketFromOrigin(20)
+	f.DropFromOrigin()
+
+	flows := table.Flows()
+	require.Len(t, flows, 1)
+	assert.Equal(t, uint64(2), flows[0].PacketsToOrigin)
+	assert.Equal(t, uint64(1), flows[0].PacketsFromOrigin)
+	assert.Equal(t, uint64(20), flows[0].BytesToOrigin)
+	assert.Equal(t, uint64(20), flows[0].BytesFromOrigin)
+	assert.Equal(t, uint64(1), flows[0].DropsFromOrigin)
+}
+
+func TestDropped(t *testing.T) {
+	before := droppedCount(t, UDP, DropUnknownSession)
+	Dropped(UDP, DropUnknownSession)
+	Dropped(UDP, DropUnknownSession)
+	Dropped(ICMP, DropICMPUnsupportedType)
+
+	assert.Equal(t, before+2, droppedCount(t, UDP, DropUnknownSession))
+	assert.GreaterOrEqual(t, droppedCount(t, ICMP, DropICMPUnsupportedType), float64(1))
+}
+
+func droppedCount(t *testing.T, protocol Protocol, reason DropReason) float64 {
+	var metric dto.Metric
+	require.NoError(t, droppedDatagrams.WithLabelValues(string(protocol), string(reason)).Write(&metric))
+	return metric.GetCounter().GetValue()
+}
+
+func TestSessionRTT(t *testing.T) {
+	table := NewTable()
+	table.SetEdgeRTT(func(connIndex uint8) (time.Duration, bool) {
+		return time.Duration(connIndex+1) * 10 * time.Millisecond, connIndex != 3
+	})
+	edgeCount := sampleCount(t, sessionEdgeRTT, UDP)
+
+	udp := table.Open(UDP, "session", "127.0.0.1:5000", "1.1.1.1:53", 1)
+	tcp := table.Open(TCP, "", "127.0.0.1:5001", "1.1.1.1:443", 1)
+	icmp := table.Open(ICMP, "", "127.0.0.1", "1.1.1.1", 3)
+
+	flows := table.Flows()
+	require.Len(t, flows, 3)
+	assert.Equal(t, 20*time.Millisecond, flows[0].EdgeRTT)
+	assert.Zero(t, flows[1].EdgeRTT, "the edge RTT is only reported for datagram flows")
+	assert.Zero(t, flows[2].EdgeRTT, "the edge RTT of the connection isn't measured")
+
+	udp.Close()
+	tcp.Close()
+	icmp.Close()
+	assert.Equal(t, edgeCount+1, sampleCount(t, sessionEdgeRTT, UDP))
+	assert.Zero(t, sampleCount(t, sessionEdgeRTT, TCP))
+	assert.Zero(t, sampleCount(t, sessionEdgeRTT, ICMP))
+}
+
+func sampleCount(t *testing.T, histogram *prometheus.HistogramVec, protocol Protocol) uint64 {
+	var metric dto.Metric
+	require.NoError(t, histogram.WithLabelValues(string(protocol)).(prometheus.Histogram).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
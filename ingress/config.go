@@ -2,6 +2,9 @@ package ingress
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -22,6 +25,9 @@ var (
 const (
 	defaultProxyAddress           = "127.0.0.1"
 	defaultKeepAliveConnections   = 100
+	defaultMaxRequestHeaderBytes  = http.DefaultMaxHeaderBytes
+	defaultMaxURLLength           = 64 * 1024
+	defaultMaxRequestHeaderCount  = 1000
 	SSHServerFlag                 = "ssh-server"
 	Socks5Flag                    = "socks5"
 	ProxyConnectTimeoutFlag       = "proxy-connect-timeout"
@@ -38,6 +44,7 @@ const (
 	ProxyAddressFlag              = "proxy-address"
 	ProxyPortFlag                 = "proxy-port"
 	Http2OriginFlag               = "http2-origin"
+	Http3OriginFlag               = "http3-origin"
 )
 
 const (
@@ -47,9 +54,12 @@ const (
 type WarpRoutingConfig struct {
 	ConnectTimeout config.CustomDuration `yaml:"connectTimeout" json:"connectTimeout,omitempty"`
 	TCPKeepAlive   config.CustomDuration `yaml:"tcpKeepAlive" json:"tcpKeepAlive,omitempty"`
+	DisableICMP    []netip.Prefix        `yaml:"disableICMP" json:"disableICMP,omitempty"`
+	// DisableICMPVirtualNetworks are resolved to their routes by the orchestrator
+	DisableICMPVirtualNetworks []string `yaml:"disableICMPVirtualNetworks" json:"disableICMPVirtualNetworks,omitempty"`
 }
 
-func NewWarpRoutingConfig(raw *config.WarpRoutingConfig) WarpRoutingConfig {
+func NewWarpRoutingConfig(raw *config.WarpRoutingConfig) (WarpRoutingConfig, error) {
 	cfg := WarpRoutingConfig{
 		ConnectTimeout: defaultWarpRoutingConnectTimeout,
 		TCPKeepAlive:   defaultTCPKeepAlive,
@@ -60,7 +70,15 @@ func NewWarpRoutingConfig(raw *config.WarpRoutingConfig) WarpRoutingConfig {
 	if raw.TCPKeepAlive != nil {
 		cfg.TCPKeepAlive = *raw.TCPKeepAlive
 	}
-	return cfg
+	for _, route := range raw.DisableICMP {
+		prefix, err := netip.ParsePrefix(route)
+		if err != nil {
+			return WarpRoutingConfig{}, fmt.Errorf("invalid warp-routing disableICMP route %q: %w", route, err)
+		}
+		cfg.DisableICMP = append(cfg.DisableICMP, prefix.Masked())
+	}
+	cfg.DisableICMPVirtualNetworks = raw.DisableICMPVirtualNetworks
+	return cfg, nil
 }
 
 func (c *WarpRoutingConfig) RawConfig() config.WarpRoutingConfig {
@@ -71,6 +89,10 @@ func (c *WarpRoutingConfig) RawConfig() config.WarpRoutingConfig {
 	if c.TCPKeepAlive.Duration != defaultTCPKeepAlive.Duration {
 		raw.TCPKeepAlive = &c.TCPKeepAlive
 	}
+	for _, prefix := range c.DisableICMP {
+		raw.DisableICMP = append(raw.DisableICMP, prefix.String())
+	}
+	raw.DisableICMPVirtualNetworks = c.DisableICMPVirtualNetworks
 	return raw
 }
 
@@ -104,8 +126,13 @@ func (rc *RemoteConfig) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	warpRouting, err := NewWarpRoutingConfig(&rawConfig.WarpRouting)
+	if err != nil {
+		return err
+	}
+
 	rc.Ingress = ingress
-	rc.WarpRouting = NewWarpRoutingConfig(&rawConfig.WarpRouting)
+	rc.WarpRouting = warpRouting
 
 	return nil
 }
@@ -128,6 +155,7 @@ func originRequestFromSingleRule(c *cli.Context) OriginRequestConfig {
 	var proxyPort uint
 	var proxyType string
 	var http2Origin bool
+	var http3Origin string
 	if flag := ProxyConnectTimeoutFlag; c.IsSet(flag) {
 		connectTimeout = config.CustomDuration{Duration: c.Duration(flag)}
 	}
@@ -177,6 +205,9 @@ func originRequestFromSingleRule(c *cli.Context) OriginRequestConfig {
 	if flag := Http2OriginFlag; c.IsSet(flag) {
 		http2Origin = c.Bool(flag)
 	}
+	if flag := Http3OriginFlag; c.IsSet(flag) {
+		http3Origin = c.String(flag)
+	}
 	if c.IsSet(Socks5Flag) {
 		proxyType = socksProxy
 	}
@@ -199,17 +230,24 @@ func originRequestFromSingleRule(c *cli.Context) OriginRequestConfig {
 		ProxyPort:              proxyPort,
 		ProxyType:              proxyType,
 		Http2Origin:            http2Origin,
+		Http3Origin:            http3Origin,
+		MaxRequestHeaderBytes:  defaultMaxRequestHeaderBytes,
+		MaxURLLength:           defaultMaxURLLength,
+		MaxRequestHeaderCount:  defaultMaxRequestHeaderCount,
 	}
 }
 
 func originRequestFromConfig(c config.OriginRequestConfig) OriginRequestConfig {
 	out := OriginRequestConfig{
-		ConnectTimeout:       defaultHTTPConnectTimeout,
-		TLSTimeout:           defaultTLSTimeout,
-		TCPKeepAlive:         defaultTCPKeepAlive,
-		KeepAliveConnections: defaultKeepAliveConnections,
-		KeepAliveTimeout:     defaultKeepAliveTimeout,
-		ProxyAddress:         defaultProxyAddress,
+		ConnectTimeout:        defaultHTTPConnectTimeout,
+		TLSTimeout:            defaultTLSTimeout,
+		TCPKeepAlive:          defaultTCPKeepAlive,
+		KeepAliveConnections:  defaultKeepAliveConnections,
+		KeepAliveTimeout:      defaultKeepAliveTimeout,
+		ProxyAddress:          defaultProxyAddress,
+		MaxRequestHeaderBytes: defaultMaxRequestHeaderBytes,
+		MaxURLLength:          defaultMaxURLLength,
+		MaxRequestHeaderCount: defaultMaxRequestHeaderCount,
 	}
 	if c.ConnectTimeout != nil {
 		out.ConnectTimeout = *c.ConnectTimeout
@@ -270,6 +308,24 @@ func originRequestFromConfig(c config.OriginRequestConfig) OriginRequestConfig {
 	if c.Http2Origin != nil {
 		out.Http2Origin = *c.Http2Origin
 	}
+	if c.Http3Origin != nil {
+		out.Http3Origin = *c.Http3Origin
+	}
+	if c.FlushInterval != nil {
+		out.FlushInterval = *c.FlushInterval
+	}
+	if c.FlushImmediately != nil {
+		out.FlushImmediately = *c.FlushImmediately
+	}
+	if c.MaxRequestHeaderBytes != nil {
+		out.MaxRequestHeaderBytes = *c.MaxRequestHeaderBytes
+	}
+	if c.MaxURLLength != nil {
+		out.MaxURLLength = *c.MaxURLLength
+	}
+	if c.MaxRequestHeaderCount != nil {
+		out.MaxRequestHeaderCount = *c.MaxRequestHeaderCount
+	}
 	if c.Access != nil {
 		out.Access = *c.Access
 	}
@@ -320,9 +376,24 @@ type OriginRequestConfig struct {
 	IPRules []ipaccess.Rule `yaml:"ipRules" json:"ipRules"`
 	// Attempt to connect to origin with HTTP/2
 	Http2Origin bool `yaml:"http2Origin" json:"http2Origin"`
+	// Send the requests to an https origin over HTTP/3, "always" or once it advertises h3 with "alt-svc"
+	Http3Origin string `yaml:"http3Origin" json:"http3Origin"`
+	// Flush the streamed response body to the edge at least this often, 0 leaves it to the connection
+	FlushInterval config.CustomDuration `yaml:"flushInterval" json:"flushInterval"`
+	// Flush the response body to the edge after every write
+	FlushImmediately bool `yaml:"flushImmediately" json:"flushImmediately"`
+	// Maximum size of the request headers in bytes, 0 or less doesn't limit it
+	MaxRequestHeaderBytes int `yaml:"maxRequestHeaderBytes" json:"maxRequestHeaderBytes"`
+	// Maximum length of the request URL, 0 or less doesn't limit it
+	MaxURLLength int `yaml:"maxURLLength" json:"maxURLLength"`
+	// Maximum number of request headers, 0 or less doesn't limit it
+	MaxRequestHeaderCount int `yaml:"maxRequestHeaderCount" json:"maxRequestHeaderCount"`
 
 	// Access holds all access related configs
 	Access config.AccessConfig `yaml:"access" json:"access,omitempty"`
+
+	// cryptoPolicy restricts the TLS connections to the origin, it's set from the Ingress when the origin is started
+	cryptoPolicy *tlsconfig.CryptoPolicy
 }
 
 func (defaults *OriginRequestConfig) setConnectTimeout(overrides config.OriginRequestConfig) {
@@ -440,6 +511,42 @@ func (defaults *OriginRequestConfig) setHttp2Origin(overrides config.OriginReque
 	}
 }
 
+func (defaults *OriginRequestConfig) setHttp3Origin(overrides config.OriginRequestConfig) {
+	if val := overrides.Http3Origin; val != nil {
+		defaults.Http3Origin = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setFlushInterval(overrides config.OriginRequestConfig) {
+	if val := overrides.FlushInterval; val != nil {
+		defaults.FlushInterval = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setFlushImmediately(overrides config.OriginRequestConfig) {
+	if val := overrides.FlushImmediately; val != nil {
+		defaults.FlushImmediately = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setMaxRequestHeaderBytes(overrides config.OriginRequestConfig) {
+	if val := overrides.MaxRequestHeaderBytes; val != nil {
+		defaults.MaxRequestHeaderBytes = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setMaxURLLength(overrides config.OriginRequestConfig) {
+	if val := overrides.MaxURLLength; val != nil {
+		defaults.MaxURLLength = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setMaxRequestHeaderCount(overrides config.OriginRequestConfig) {
+	if val := overrides.MaxRequestHeaderCount; val != nil {
+		defaults.MaxRequestHeaderCount = *val
+	}
+}
+
 func (defaults *OriginRequestConfig) setAccess(overrides config.OriginRequestConfig) {
 	if val := overrides.Access; val != nil {
 		defaults.Access = *val
@@ -474,6 +581,12 @@ func setConfig(defaults OriginRequestConfig, overrides config.OriginRequestConfi
 	cfg.setProxyType(overrides)
 	cfg.setIPRules(overrides)
 	cfg.setHttp2Origin(overrides)
+	cfg.setHttp3Origin(overrides)
+	cfg.setFlushInterval(overrides)
+	cfg.setFlushImmediately(overrides)
+	cfg.setMaxRequestHeaderBytes(overrides)
+	cfg.setMaxURLLength(overrides)
+	cfg.setMaxRequestHeaderCount(overrides)
 	cfg.setAccess(overrides)
 
 	return cfg
@@ -486,6 +599,10 @@ func ConvertToRawOriginConfig(c OriginRequestConfig) config.OriginRequestConfig
 	var keepAliveConnections *int
 	var keepAliveTimeout *config.CustomDuration
 	var proxyAddress *string
+	var flushInterval *config.CustomDuration
+	var maxRequestHeaderBytes *int
+	var maxURLLength *int
+	var maxRequestHeaderCount *int
 	var access *config.AccessConfig
 
 	if c.ConnectTimeout != defaultHTTPConnectTimeout {
@@ -506,6 +623,18 @@ func ConvertToRawOriginConfig(c OriginRequestConfig) config.OriginRequestConfig
 	if c.ProxyAddress != defaultProxyAddress {
 		proxyAddress = &c.ProxyAddress
 	}
+	if c.FlushInterval.Duration != 0 {
+		flushInterval = &c.FlushInterval
+	}
+	if c.MaxRequestHeaderBytes != defaultMaxRequestHeaderBytes {
+		maxRequestHeaderBytes = &c.MaxRequestHeaderBytes
+	}
+	if c.MaxURLLength != defaultMaxURLLength {
+		maxURLLength = &c.MaxURLLength
+	}
+	if c.MaxRequestHeaderCount != defaultMaxRequestHeaderCount {
+		maxRequestHeaderCount = &c.MaxRequestHeaderCount
+	}
 	if c.Access.Required {
 		access = &c.Access
 	}
@@ -529,6 +658,12 @@ func ConvertToRawOriginConfig(c OriginRequestConfig) config.OriginRequestConfig
 		ProxyType:              emptyStringToNil(c.ProxyType),
 		IPRules:                convertToRawIPRules(c.IPRules),
 		Http2Origin:            defaultBoolToNil(c.Http2Origin),
+		Http3Origin:            emptyStringToNil(c.Http3Origin),
+		FlushInterval:          flushInterval,
+		FlushImmediately:       defaultBoolToNil(c.FlushImmediately),
+		MaxRequestHeaderBytes:  maxRequestHeaderBytes,
+		MaxURLLength:           maxURLLength,
+		MaxRequestHeaderCount:  maxRequestHeaderCount,
 		Access:                 access,
 	}
 }
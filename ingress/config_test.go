@@ -3,6 +3,7 @@ package ingress
 import (
 	"encoding/json"
 	"flag"
+	"net/netip"
 	"testing"
 	"time"
 
@@ -68,6 +69,34 @@ func TestUnmarshalRemoteConfigOverridesGlobal(t *testing.T) {
 	require.True(t, remoteConfig.Ingress.Defaults.NoHappyEyeballs)
 }
 
+func TestWarpRoutingDisableICMP(t *testing.T) {
+	raw := config.WarpRoutingConfig{
+		DisableICMP:                []string{"10.1.0.0/16", "2001:db8::1/32"},
+		DisableICMPVirtualNetworks: []string{"staging"},
+	}
+	cfg, err := NewWarpRoutingConfig(&raw)
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.1.0.0/16"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, cfg.DisableICMP)
+	require.Equal(t, []string{"10.1.0.0/16", "2001:db8::/32"}, cfg.RawConfig().DisableICMP)
+	require.Equal(t, []string{"staging"}, cfg.RawConfig().DisableICMPVirtualNetworks)
+
+	raw.DisableICMP = []string{"10.1.0.0"}
+	_, err = NewWarpRoutingConfig(&raw)
+	require.Error(t, err)
+}
+
+func TestICMPRouterDisabledRoutes(t *testing.T) {
+	router := &icmpRouter{}
+	require.False(t, router.isDisabledRoute(netip.MustParseAddr("10.1.2.3")))
+
+	router.SetDisabledRoutes([]netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")})
+	require.True(t, router.isDisabledRoute(netip.MustParseAddr("10.1.2.3")))
+	require.False(t, router.isDisabledRoute(netip.MustParseAddr("10.2.2.3")))
+}
+
 func TestOriginRequestConfigOverrides(t *testing.T) {
 	validate := func(ing Ingress) {
 		// Rule 0 didn't override anything, so it inherits the user-specified
@@ -93,6 +122,9 @@ func TestOriginRequestConfigOverrides(t *testing.T) {
 				newIPRule(t, "10.0.0.0/8", []int{80, 8080}, false),
 				newIPRule(t, "fc00::/7", []int{443, 4443}, true),
 			},
+			MaxRequestHeaderBytes: 1000,
+			MaxURLLength:          100,
+			MaxRequestHeaderCount: 10,
 		}
 		require.Equal(t, expected0, actual0)
 
@@ -118,6 +150,9 @@ func TestOriginRequestConfigOverrides(t *testing.T) {
 				newIPRule(t, "10.0.0.0/16", []int{3000, 3030}, false),
 				newIPRule(t, "192.16.0.0/24", []int{5000, 5050}, true),
 			},
+			MaxRequestHeaderBytes: 2000,
+			MaxURLLength:          200,
+			MaxRequestHeaderCount: 20,
 		}
 		require.Equal(t, expected1, actual1)
 	}
@@ -139,6 +174,9 @@ originRequest:
   proxyAddress: 127.1.2.3
   proxyPort: 100
   proxyType: socks5
+  maxRequestHeaderBytes: 1000
+  maxURLLength: 100
+  maxRequestHeaderCount: 10
   ipRules:
   - prefix: "10.0.0.0/8"
     ports:
@@ -171,6 +209,9 @@ ingress:
     proxyAddress: interface
     proxyPort: 200
     proxyType: ""
+    maxRequestHeaderBytes: 2000
+    maxURLLength: 200
+    maxRequestHeaderCount: 20
     ipRules:
     - prefix: "10.0.0.0/16"
       ports:
@@ -206,6 +247,9 @@ ingress:
 		"proxyAddress": "127.1.2.3",
 		"proxyPort": 100,
 		"proxyType": "socks5",
+		"maxRequestHeaderBytes": 1000,
+		"maxURLLength": 100,
+		"maxRequestHeaderCount": 10,
 		"ipRules": [
 			{
 				"prefix": "10.0.0.0/8",
@@ -243,6 +287,9 @@ ingress:
 				"proxyAddress": "interface",
 				"proxyPort": 200,
 				"proxyType": "",
+				"maxRequestHeaderBytes": 2000,
+				"maxURLLength": 200,
+				"maxRequestHeaderCount": 20,
 				"ipRules": [
 					{
 						"prefix": "10.0.0.0/16",
@@ -274,12 +321,15 @@ func TestOriginRequestConfigDefaults(t *testing.T) {
 		// Rule 0 didn't override anything, so it inherits the cloudflared defaults
 		actual0 := ing.Rules[0].Config
 		expected0 := OriginRequestConfig{
-			ConnectTimeout:       defaultHTTPConnectTimeout,
-			TLSTimeout:           defaultTLSTimeout,
-			TCPKeepAlive:         defaultTCPKeepAlive,
-			KeepAliveConnections: defaultKeepAliveConnections,
-			KeepAliveTimeout:     defaultKeepAliveTimeout,
-			ProxyAddress:         defaultProxyAddress,
+			ConnectTimeout:        defaultHTTPConnectTimeout,
+			TLSTimeout:            defaultTLSTimeout,
+			TCPKeepAlive:          defaultTCPKeepAlive,
+			KeepAliveConnections:  defaultKeepAliveConnections,
+			KeepAliveTimeout:      defaultKeepAliveTimeout,
+			ProxyAddress:          defaultProxyAddress,
+			MaxRequestHeaderBytes: defaultMaxRequestHeaderBytes,
+			MaxURLLength:          defaultMaxURLLength,
+			MaxRequestHeaderCount: defaultMaxRequestHeaderCount,
 		}
 		require.Equal(t, expected0, actual0)
 
@@ -305,6 +355,9 @@ func TestOriginRequestConfigDefaults(t *testing.T) {
 				newIPRule(t, "10.0.0.0/16", []int{3000, 3030}, false),
 				newIPRule(t, "192.16.0.0/24", []int{5000, 5050}, true),
 			},
+			MaxRequestHeaderBytes: 2000,
+			MaxURLLength:          200,
+			MaxRequestHeaderCount: 20,
 		}
 		require.Equal(t, expected1, actual1)
 	}
@@ -331,6 +384,9 @@ ingress:
     proxyAddress: interface
     proxyPort: 200
     proxyType: ""
+    maxRequestHeaderBytes: 2000
+    maxURLLength: 200
+    maxRequestHeaderCount: 20
     ipRules:
     - prefix: "10.0.0.0/16"
       ports:
@@ -375,6 +431,9 @@ ingress:
 				"proxyAddress": "interface",
 				"proxyPort": 200,
 				"proxyType": "",
+				"maxRequestHeaderBytes": 2000,
+				"maxURLLength": 200,
+				"maxRequestHeaderCount": 20,
 				"ipRules": [
 					{
 						"prefix": "10.0.0.0/16",
@@ -404,12 +463,15 @@ func TestDefaultConfigFromCLI(t *testing.T) {
 	c := cli.NewContext(nil, set, nil)
 
 	expected := OriginRequestConfig{
-		ConnectTimeout:       defaultHTTPConnectTimeout,
-		TLSTimeout:           defaultTLSTimeout,
-		TCPKeepAlive:         defaultTCPKeepAlive,
-		KeepAliveConnections: defaultKeepAliveConnections,
-		KeepAliveTimeout:     defaultKeepAliveTimeout,
-		ProxyAddress:         defaultProxyAddress,
+		ConnectTimeout:        defaultHTTPConnectTimeout,
+		TLSTimeout:            defaultTLSTimeout,
+		TCPKeepAlive:          defaultTCPKeepAlive,
+		KeepAliveConnections:  defaultKeepAliveConnections,
+		KeepAliveTimeout:      defaultKeepAliveTimeout,
+		ProxyAddress:          defaultProxyAddress,
+		MaxRequestHeaderBytes: defaultMaxRequestHeaderBytes,
+		MaxURLLength:          defaultMaxURLLength,
+		MaxRequestHeaderCount: defaultMaxRequestHeaderCount,
 	}
 	actual := originRequestFromSingleRule(c)
 	require.Equal(t, expected, actual)
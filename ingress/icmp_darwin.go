@@ -221,6 +221,7 @@ func (ip *icmpProxy) Serve(ctx context.Context) error {
 			continue
 		}
 		if !isEchoReply(reply.msg) {
+			dropNonEchoReply()
 			ip.logger.Debug().Str("dst", from.String()).Msgf("Drop ICMP %s from reply", reply.msg.Type)
 			continue
 		}
@@ -16,6 +16,7 @@ import (
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/ingress/middleware"
 	"github.com/cloudflare/cloudflared/ipaccess"
+	"github.com/cloudflare/cloudflared/tlsconfig"
 )
 
 var (
@@ -81,6 +82,8 @@ type Ingress struct {
 	// Rules that are provided by the user from remote or local configuration
 	Rules    []Rule              `json:"ingress"`
 	Defaults OriginRequestConfig `json:"originRequest"`
+	// CryptoPolicy, if not nil, restricts the TLS connections to the origins of the rules
+	CryptoPolicy *tlsconfig.CryptoPolicy `json:"-"`
 }
 
 // ParseIngress parses ingress rules, but does not send HTTP requests to the origins.
@@ -177,6 +180,9 @@ func parseSingleOriginService(c *cli.Context, allowURLFromArgs bool) (OriginServ
 				url: originURL,
 			}, nil
 		}
+		if originURL.Scheme == "udp" {
+			return newUDPOverWSService(originURL), nil
+		}
 		return newTCPOverWSService(originURL), nil
 	}
 	if c.IsSet("unix-socket") {
@@ -205,13 +211,31 @@ func (ing Ingress) StartOrigins(
 	shutdownC <-chan struct{},
 ) error {
 	for _, rule := range ing.Rules {
-		if err := rule.Service.start(log, shutdownC, rule.Config); err != nil {
+		cfg := rule.Config
+		cfg.cryptoPolicy = ing.CryptoPolicy
+		if err := rule.Service.start(log, shutdownC, cfg); err != nil {
 			return errors.Wrapf(err, "Error starting local service %s", rule.Service)
 		}
 	}
 	return nil
 }
 
+// MaxRequestHeaderBytes returns the largest request header limit of the rules, which the HTTP/2 server of the edge
+// connections must accept for the rules to enforce theirs. It is 0 if a rule doesn't limit the header size.
+func (ing Ingress) MaxRequestHeaderBytes() int {
+	maxBytes := 0
+	for _, rule := range ing.Rules {
+		if rule.Config.MaxRequestHeaderBytes <= 0 {
+			return 0
+		}
+		maxBytes = max(maxBytes, rule.Config.MaxRequestHeaderBytes)
+	}
+	if maxBytes == 0 {
+		return defaultMaxRequestHeaderBytes
+	}
+	return maxBytes
+}
+
 // CatchAll returns the catch-all rule (i.e. the last rule)
 func (ing Ingress) CatchAll() *Rule {
 	return &ing.Rules[len(ing.Rules)-1]
@@ -306,6 +330,8 @@ func validateIngress(ingress []config.UnvalidatedIngressRule, defaults OriginReq
 			}
 			if isHTTPService(u) {
 				service = &httpService{url: u}
+			} else if u.Scheme == "udp" {
+				service = newUDPOverWSService(u)
 			} else {
 				service = newTCPOverWSService(u)
 			}
@@ -329,11 +355,7 @@ func validateIngress(ingress []config.UnvalidatedIngressRule, defaults OriginReq
 		isCatchAllRule := (r.Hostname == "" || r.Hostname == "*") && r.Path == ""
 		punycodeHostname := ""
 		if !isCatchAllRule {
-			punycode, err := idna.Lookup.ToASCII(r.Hostname)
-			// Don't provide the punycode hostname if it is the same as the original hostname
-			if err == nil && punycode != r.Hostname {
-				punycodeHostname = punycode
-			}
+			punycodeHostname = toPunycode(r.Hostname)
 		}
 
 		var pathRegexp *Regexp
@@ -358,6 +380,15 @@ func validateIngress(ingress []config.UnvalidatedIngressRule, defaults OriginReq
 	return Ingress{Rules: rules, Defaults: defaults}, nil
 }
 
+// toPunycode returns hostname converted to punycode, or an empty string if it is the same as hostname.
+func toPunycode(hostname string) string {
+	punycode, err := idna.Lookup.ToASCII(hostname)
+	if err != nil || punycode == hostname {
+		return ""
+	}
+	return punycode
+}
+
 func validateHostname(r config.UnvalidatedIngressRule, ruleIndex, totalRules int) error {
 	// Ensure that the hostname doesn't contain port
 	_, _, err := net.SplitHostPort(r.Hostname)
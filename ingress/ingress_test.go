@@ -348,6 +348,19 @@ ingress:
 				},
 			},
 		},
+		{
+			name: "UDP services",
+			args: args{rawYAML: `
+ingress:
+- service: udp://127.0.0.1:161
+`},
+			want: []Rule{
+				{
+					Service: newUDPOverWSService(MustParseURL(t, "udp://127.0.0.1:161")),
+					Config:  defaultConfig,
+				},
+			},
+		},
 		{
 			name: "Other TCP services",
 			args: args{rawYAML: `
@@ -840,3 +853,12 @@ func MustReadIngress(s string) *config.Configuration {
 	}
 	return &conf
 }
+
+func TestMaxRequestHeaderBytes(t *testing.T) {
+	rule := func(maxBytes int) Rule {
+		return Rule{Config: OriginRequestConfig{MaxRequestHeaderBytes: maxBytes}}
+	}
+	require.Equal(t, defaultMaxRequestHeaderBytes, Ingress{}.MaxRequestHeaderBytes())
+	require.Equal(t, 4<<20, Ingress{Rules: []Rule{rule(4 << 20), rule(defaultMaxRequestHeaderBytes)}}.MaxRequestHeaderBytes())
+	require.Equal(t, 0, Ingress{Rules: []Rule{rule(4 << 20), rule(0)}}.MaxRequestHeaderBytes())
+}
@@ -0,0 +1,154 @@
+package ingress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+// ErrListenerClosed is returned by the Listener once it's closed.
+var ErrListenerClosed = errors.New("listener closed")
+
+// handlerService is an OriginService that serves the requests with an http.Handler of the program embedding cloudflared.
+type handlerService struct {
+	HTTPLocalProxy
+	name string
+}
+
+// NewHandlerRule returns a rule that serves the requests to hostname with handler in process.
+func NewHandlerRule(hostname string, handler http.Handler) (Rule, error) {
+	return newEmbeddedRule(hostname, &handlerService{HTTPLocalProxy: handler, name: hostname})
+}
+
+// newEmbeddedRule returns a rule of hostname to service, with the default origin request configuration. The hostname
+// is validated as in the configuration file, and it can't catch all hostnames.
+func newEmbeddedRule(hostname string, service OriginService) (Rule, error) {
+	// A rule that isn't the last one must not catch all hostnames
+	if err := validateHostname(config.UnvalidatedIngressRule{Hostname: hostname}, 0, 2); err != nil {
+		return Rule{}, err
+	}
+	return Rule{
+		Hostname:         hostname,
+		punycodeHostname: toPunycode(hostname),
+		Service:          service,
+		Config:           originRequestFromConfig(config.OriginRequestConfig{}),
+	}, nil
+}
+
+func (o *handlerService) start(log *zerolog.Logger, _ <-chan struct{}, cfg OriginRequestConfig) error {
+	return nil
+}
+
+func (o *handlerService) String() string {
+	return fmt.Sprintf("handler:%s", o.name)
+}
+
+func (o handlerService) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
+// Listener is an in-memory net.Listener accepting the connections cloudflared opens to proxy requests to it, e.g. for
+// a http.Server of the program embedding cloudflared.
+type Listener struct {
+	addr  listenerAddr
+	conns chan net.Conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewListener returns a Listener whose address is name.
+func NewListener(name string) *Listener {
+	return &Listener{
+		addr:   listenerAddr(name),
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+// Accept waits for cloudflared to open a connection to the listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Close stops accepting connections. The connections already accepted are left open.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// dial opens a connection to the listener, returned to its Accept.
+func (l *Listener) dial(ctx context.Context) (net.Conn, error) {
+	originSide, cloudflaredSide := net.Pipe()
+	select {
+	case l.conns <- originSide:
+		return cloudflaredSide, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type listenerAddr string
+
+func (a listenerAddr) Network() string {
+	return "memory"
+}
+
+func (a listenerAddr) String() string {
+	return string(a)
+}
+
+// listenerService is an OriginService that proxies the requests over HTTP to a Listener.
+type listenerService struct {
+	listener  *Listener
+	transport *http.Transport
+}
+
+// NewListenerRule returns a rule that proxies the requests to hostname to the connections accepted by listener.
+func NewListenerRule(hostname string, listener *Listener) (Rule, error) {
+	return newEmbeddedRule(hostname, &listenerService{listener: listener})
+}
+
+func (o *listenerService) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = "http"
+	req.URL.Host = o.listener.Addr().String()
+	return o.transport.RoundTrip(req)
+}
+
+func (o *listenerService) start(log *zerolog.Logger, _ <-chan struct{}, cfg OriginRequestConfig) error {
+	transport, err := newHTTPTransport(o, cfg, log)
+	if err != nil {
+		return err
+	}
+	o.transport = transport
+	return nil
+}
+
+func (o *listenerService) String() string {
+	return fmt.Sprintf("listener:%s", o.listener.Addr())
+}
+
+func (o listenerService) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
@@ -0,0 +1,76 @@
+package ingress
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerRule(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	})
+	for _, hostname := range []string{"", "*", "app.example.com:443", "app.*.example.com"} {
+		_, err := NewHandlerRule(hostname, handler)
+		assert.Error(t, err, hostname)
+	}
+	rule, err := NewHandlerRule("app.example.com", handler)
+	require.NoError(t, err)
+	assert.True(t, rule.Matches("app.example.com", "/"))
+	assert.False(t, rule.Matches("other.example.com", "/"))
+	assert.Equal(t, "handler:app.example.com", rule.Service.String())
+
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	require.NoError(t, rule.Service.start(TestLogger, shutdownC, rule.Config))
+
+	w := httptest.NewRecorder()
+	rule.Service.(HTTPLocalProxy).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "app.example.com", w.Body.String())
+}
+
+func TestListenerRule(t *testing.T) {
+	listener := NewListener("app")
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host + r.URL.Path))
+	})}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	rule, err := NewListenerRule("app.example.com", listener)
+	require.NoError(t, err)
+	assert.Equal(t, "listener:app", rule.Service.String())
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	require.NoError(t, rule.Service.start(TestLogger, shutdownC, rule.Config))
+	service := rule.Service.(HTTPOriginProxy)
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, "https://app.example.com/path", nil)
+		require.NoError(t, err)
+		resp, err := service.RoundTrip(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "app.example.com/path", string(body))
+	}
+
+	require.NoError(t, listener.Close())
+	_, err = listener.Accept()
+	assert.ErrorIs(t, err, ErrListenerClosed)
+	req, err := http.NewRequest(http.MethodGet, "https://app.example.com/path", nil)
+	require.NoError(t, err)
+	// Only the new connections are refused once the listener is closed
+	rule.Service.(*listenerService).transport.CloseIdleConnections()
+	_, err = service.RoundTrip(req)
+	assert.Error(t, err)
+}
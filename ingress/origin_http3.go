@@ -0,0 +1,296 @@
+package ingress
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Http3OriginAlways sends all the requests to the origin over HTTP/3.
+	Http3OriginAlways = "always"
+	// Http3OriginAltSvc sends the requests to the origin over HTTP/3 once it advertised h3 in an Alt-Svc header.
+	Http3OriginAltSvc = "alt-svc"
+
+	// defaultAltSvcMaxAge is how long an alternative service is used when it's advertised without ma, see RFC 7838
+	defaultAltSvcMaxAge = 24 * time.Hour
+	// brokenAltSvcPeriod is how long an h3 alternative that couldn't be reached isn't used again, even if advertised
+	brokenAltSvcPeriod = 5 * time.Minute
+)
+
+// http3Transport sends the requests to an https origin over HTTP/3. In alt-svc mode, it's only used once the origin
+// advertised h3 on the same host, and the requests go back over TCP when it can't be reached over QUIC. The requests
+// that the TCP transport sends through a proxy stay on TCP, QUIC can't go through it.
+type http3Transport struct {
+	transport *http3.RoundTripper
+	udp       *quic.Transport
+	proxy     func(*http.Request) (*url.URL, error)
+	always    bool
+	log       *zerolog.Logger
+
+	lock sync.Mutex
+	// altPort is the UDP port of the h3 alternative advertised by the origin, used until altExpires
+	altPort    string
+	altExpires time.Time
+	// brokenUntil is when the origin is tried over HTTP/3 again after it couldn't be reached over it
+	brokenUntil time.Time
+}
+
+func newHTTP3Transport(mode string, tcp *http.Transport, cfg OriginRequestConfig, log *zerolog.Logger) (*http3Transport, error) {
+	switch mode {
+	case Http3OriginAlways, Http3OriginAltSvc:
+	default:
+		return nil, fmt.Errorf("%s must be %s or %s, got %q", Http3OriginFlag, Http3OriginAlways, Http3OriginAltSvc, mode)
+	}
+	tlsConfig := tcp.TLSClientConfig.Clone()
+	// The sessions of QUIC carry its transport parameters, so they aren't mixed with the ones over TCP
+	resumeOriginSessions(tlsConfig)
+	cfg.cryptoPolicy.Apply(tlsConfig)
+	udpConn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a UDP socket for HTTP/3: %w", err)
+	}
+	t := &http3Transport{
+		udp:    &quic.Transport{Conn: udpConn},
+		proxy:  tcp.Proxy,
+		always: mode == Http3OriginAlways,
+		log:    log,
+	}
+	t.transport = &http3.RoundTripper{
+		TLSClientConfig: tlsConfig,
+		QUICConfig: &quic.Config{
+			HandshakeIdleTimeout: cfg.ConnectTimeout.Duration + cfg.TLSTimeout.Duration,
+			MaxIdleTimeout:       cfg.KeepAliveTimeout.Duration,
+			KeepAlivePeriod:      cfg.TCPKeepAlive.Duration,
+		},
+		Dial: func(ctx context.Context, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+			return t.dial(ctx, addr, tlsConfig, quicConfig)
+		},
+	}
+	return t, nil
+}
+
+// dial connects to the addresses of the host in turn, like the dialer of the TCP transport, instead of only to the
+// first one. Each one gets the handshake timeout, if it's set.
+func (t *http3Transport) dial(ctx context.Context, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", port, err)
+	}
+	var lastErr error
+	for _, ip := range ips {
+		udpAddr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip.Unmap(), uint16(portNum)))
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if quicConfig.HandshakeIdleTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, quicConfig.HandshakeIdleTimeout)
+		}
+		conn, err := t.udp.DialEarly(attemptCtx, udpAddr, tlsConfig, quicConfig)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// roundTrip sends the request over HTTP/3 if the origin can be reached over it. handled is false when the request
+// should be sent over TCP instead.
+func (t *http3Transport) roundTrip(req *http.Request) (resp *http.Response, handled bool, err error) {
+	if req.URL.Scheme != "https" || req.Header.Get("Upgrade") != "" {
+		// Upgrades like websockets only work over HTTP/1.1
+		return nil, false, nil
+	}
+	if t.proxy != nil {
+		if proxyURL, err := t.proxy(req); err != nil || proxyURL != nil {
+			return nil, false, nil
+		}
+	}
+	h3Req := req.Clone(req.Context())
+	if t.always {
+		resp, err = t.transport.RoundTrip(h3Req)
+		return resp, true, err
+	}
+	port, ok := t.alternative()
+	if !ok {
+		return nil, false, nil
+	}
+	h3Req.URL.Host = net.JoinHostPort(req.URL.Hostname(), port)
+	if h3Req.Host == "" {
+		h3Req.Host = req.URL.Host
+	}
+	body := &unreadBody{ReadCloser: req.Body, held: true}
+	if req.Body != nil && req.Body != http.NoBody {
+		h3Req.Body = body
+	}
+
+	resp, err = t.transport.RoundTrip(h3Req)
+	if err == nil {
+		body.release()
+		return resp, true, nil
+	}
+	t.markBroken()
+	if body.read.Load() {
+		// The request body is partly gone, so it can't be sent again over TCP
+		_ = req.Body.Close()
+		return nil, true, err
+	}
+	t.log.Debug().Err(err).Str("host", req.URL.Host).Msg("Failed to reach the origin over HTTP/3, sending its requests over TCP")
+	return nil, false, nil
+}
+
+// discover records the h3 alternative that the origin advertised in the Alt-Svc header of its response.
+func (t *http3Transport) discover(req *http.Request, resp *http.Response) {
+	if t.always || req.URL.Scheme != "https" {
+		return
+	}
+	values := resp.Header.Values("Alt-Svc")
+	if len(values) == 0 {
+		return
+	}
+	port, maxAge, ok := parseAltSvc(values, req.URL.Hostname())
+	if !ok {
+		return
+	}
+	if port == "" || maxAge <= 0 {
+		t.forget()
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if time.Now().Before(t.brokenUntil) {
+		return
+	}
+	if t.altPort != port {
+		t.log.Debug().Str("host", req.URL.Host).Str("port", port).Msg("Origin advertised HTTP/3, sending its requests over QUIC")
+	}
+	t.altPort = port
+	t.altExpires = time.Now().Add(maxAge)
+}
+
+func (t *http3Transport) alternative() (string, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.altPort == "" || time.Now().After(t.altExpires) {
+		return "", false
+	}
+	return t.altPort, true
+}
+
+func (t *http3Transport) forget() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.altPort = ""
+}
+
+func (t *http3Transport) markBroken() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.altPort = ""
+	t.brokenUntil = time.Now().Add(brokenAltSvcPeriod)
+}
+
+func (t *http3Transport) close() {
+	_ = t.transport.Close()
+	_ = t.udp.Close()
+}
+
+// parseAltSvc returns the port of the first h3 alternative on host in the Alt-Svc header values, see RFC 7838, and
+// how long it can be used for. The port is empty when the origin cleared its alternatives, and ok is false when the
+// header has no h3 alternative on host.
+func parseAltSvc(values []string, host string) (port string, maxAge time.Duration, ok bool) {
+	for _, value := range values {
+		for _, alternative := range strings.Split(value, ",") {
+			params := strings.Split(alternative, ";")
+			protocol, authority, found := strings.Cut(strings.TrimSpace(params[0]), "=")
+			if !found {
+				if protocol == "clear" {
+					return "", 0, true
+				}
+				continue
+			}
+			if protocol != "h3" {
+				continue
+			}
+			altHost, altPort, err := net.SplitHostPort(strings.Trim(authority, `"`))
+			if err != nil || (altHost != "" && altHost != host) {
+				continue
+			}
+			maxAge = defaultAltSvcMaxAge
+			for _, param := range params[1:] {
+				name, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if name != "ma" {
+					continue
+				}
+				if seconds, err := strconv.ParseUint(strings.Trim(val, `"`), 10, 32); err == nil {
+					maxAge = time.Duration(seconds) * time.Second
+				}
+			}
+			return altPort, maxAge, true
+		}
+	}
+	return "", 0, false
+}
+
+// unreadBody records if a request body was read, to know if the request can be sent again after a failure. While the
+// request may still be sent again over TCP, closing an unread body is left to the TCP transport.
+type unreadBody struct {
+	io.ReadCloser
+	read atomic.Bool
+
+	lock   sync.Mutex
+	held   bool
+	closed bool
+}
+
+func (b *unreadBody) Read(p []byte) (int, error) {
+	b.read.Store(true)
+	return b.ReadCloser.Read(p)
+}
+
+func (b *unreadBody) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.held && !b.read.Load() {
+		b.closed = true
+		return nil
+	}
+	return b.ReadCloser.Close()
+}
+
+// release hands the body over to the HTTP/3 transport once the request was sent over it, closing it if the transport
+// already did.
+func (b *unreadBody) release() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.held = false
+	if b.closed {
+		_ = b.ReadCloser.Close()
+	}
+}
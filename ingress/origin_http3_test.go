@@ -0,0 +1,191 @@
+package ingress
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		port   string
+		maxAge time.Duration
+		ok     bool
+	}{
+		{name: "h3", values: []string{`h3=":443"; ma=3600`}, port: "443", maxAge: time.Hour, ok: true},
+		{name: "default max age", values: []string{`h3=":8443"`}, port: "8443", maxAge: defaultAltSvcMaxAge, ok: true},
+		{name: "after other protocols", values: []string{`h2=":443", h3-29=":443"`, `h3=":443"; ma=60; persist=1`}, port: "443", maxAge: time.Minute, ok: true},
+		{name: "same host", values: []string{`h3="origin.example.com:443"`}, port: "443", maxAge: defaultAltSvcMaxAge, ok: true},
+		{name: "other host", values: []string{`h3="alt.example.com:443"`}},
+		{name: "clear", values: []string{"clear"}, ok: true},
+		{name: "no h3", values: []string{`h2=":443"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			port, maxAge, ok := parseAltSvc(test.values, "origin.example.com")
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.port, port)
+			require.Equal(t, test.maxAge, maxAge)
+		})
+	}
+}
+
+func TestHTTPServiceHTTP3Origin(t *testing.T) {
+	var altSvc string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		_, _ = w.Write([]byte(r.Proto))
+	}
+	origin := httptest.NewTLSServer(http.HandlerFunc(handler))
+	defer origin.Close()
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	h3Origin := &http3.Server{
+		Handler:   http.HandlerFunc(handler),
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: origin.TLS.Certificates}),
+	}
+	go func() {
+		_ = h3Origin.Serve(udpConn)
+	}()
+	defer h3Origin.Close()
+	altSvc = fmt.Sprintf(`h3=":%d"; ma=60`, udpConn.LocalAddr().(*net.UDPAddr).Port)
+
+	originURL, err := url.Parse(origin.URL)
+	require.NoError(t, err)
+
+	roundTrip := func(service *httpService) string {
+		req, err := http.NewRequest(http.MethodGet, originURL.String(), nil)
+		require.NoError(t, err)
+		resp, err := service.RoundTrip(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Proto
+	}
+
+	t.Run("alt-svc", func(t *testing.T) {
+		service := &httpService{url: originURL}
+		shutdownC := make(chan struct{})
+		defer close(shutdownC)
+		require.NoError(t, service.start(TestLogger, shutdownC, OriginRequestConfig{NoTLSVerify: true, Http3Origin: Http3OriginAltSvc}))
+
+		// The first request discovers the h3 alternative, the next ones use it
+		require.Equal(t, "HTTP/1.1", roundTrip(service))
+		require.Equal(t, "HTTP/3.0", roundTrip(service))
+		require.Equal(t, "HTTP/3.0", roundTrip(service))
+	})
+
+	t.Run("always", func(t *testing.T) {
+		h3URL := *originURL
+		h3URL.Host = udpConn.LocalAddr().String()
+		service := &httpService{url: &h3URL}
+		shutdownC := make(chan struct{})
+		defer close(shutdownC)
+		require.NoError(t, service.start(TestLogger, shutdownC, OriginRequestConfig{NoTLSVerify: true, Http3Origin: Http3OriginAlways}))
+
+		require.Equal(t, "HTTP/3.0", roundTrip(service))
+	})
+
+	t.Run("fallback to TCP", func(t *testing.T) {
+		unreachable, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		unreachablePort := unreachable.LocalAddr().(*net.UDPAddr).Port
+		require.NoError(t, unreachable.Close())
+
+		service := &httpService{url: originURL}
+		shutdownC := make(chan struct{})
+		defer close(shutdownC)
+		cfg := OriginRequestConfig{
+			NoTLSVerify:    true,
+			Http3Origin:    Http3OriginAltSvc,
+			ConnectTimeout: config.CustomDuration{Duration: 200 * time.Millisecond},
+		}
+		require.NoError(t, service.start(TestLogger, shutdownC, cfg))
+		service.http3.discover(&http.Request{URL: originURL}, &http.Response{
+			Header: http.Header{"Alt-Svc": []string{fmt.Sprintf(`h3=":%d"`, unreachablePort)}},
+		})
+
+		require.Equal(t, "HTTP/1.1", roundTrip(service))
+		_, ok := service.http3.alternative()
+		require.False(t, ok)
+	})
+}
+
+func TestHTTPServiceHTTP3OriginInvalidMode(t *testing.T) {
+	originURL, err := url.Parse("https://origin.example.com")
+	require.NoError(t, err)
+	service := &httpService{url: originURL}
+	err = service.start(TestLogger, make(chan struct{}), OriginRequestConfig{Http3Origin: "sometimes"})
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), Http3OriginFlag))
+}
+
+func TestHTTP3TransportProxy(t *testing.T) {
+	proxyURL, err := url.Parse("http://proxy.example.com:3128")
+	require.NoError(t, err)
+	tcp := &http.Transport{
+		TLSClientConfig: &tls.Config{},
+		Proxy:           http.ProxyURL(proxyURL),
+	}
+	transport, err := newHTTP3Transport(Http3OriginAlways, tcp, OriginRequestConfig{}, TestLogger)
+	require.NoError(t, err)
+	defer transport.close()
+
+	// QUIC can't go through the proxy of the TCP transport
+	req, err := http.NewRequest(http.MethodGet, "https://origin.example.com", nil)
+	require.NoError(t, err)
+	_, handled, err := transport.roundTrip(req)
+	require.NoError(t, err)
+	require.False(t, handled)
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestUnreadBodyClose(t *testing.T) {
+	// An unread body is left to the TCP transport while the request may be sent again
+	recorder := &closeRecorder{Reader: strings.NewReader("body")}
+	body := &unreadBody{ReadCloser: recorder, held: true}
+	require.NoError(t, body.Close())
+	require.False(t, recorder.closed)
+	body.release()
+	require.True(t, recorder.closed)
+
+	// Once released, the HTTP/3 transport closes it
+	recorder = &closeRecorder{Reader: strings.NewReader("body")}
+	body = &unreadBody{ReadCloser: recorder, held: true}
+	body.release()
+	require.False(t, recorder.closed)
+	require.NoError(t, body.Close())
+	require.True(t, recorder.closed)
+
+	// A body that was read can't be sent again
+	recorder = &closeRecorder{Reader: strings.NewReader("body")}
+	body = &unreadBody{ReadCloser: recorder, held: true}
+	_, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	require.True(t, recorder.closed)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/netip"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -13,6 +14,7 @@ import (
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
 
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/packet"
 	"github.com/cloudflare/cloudflared/tracing"
 )
@@ -32,6 +34,8 @@ type ICMPRouterServer interface {
 	ICMPRouter
 	// Serve runs the ICMPRouter proxy origin listeners for any of the IPv4 or IPv6 interfaces configured.
 	Serve(ctx context.Context) error
+	// SetDisabledRoutes replaces the routes towards which ICMP packets are dropped instead of proxied.
+	SetDisabledRoutes(routes []netip.Prefix)
 }
 
 // ICMPRouter manages out-going ICMP requests towards the origin.
@@ -59,12 +63,18 @@ type icmpRouter struct {
 	ipv4Src   netip.Addr
 	ipv6Proxy *icmpProxy
 	ipv6Src   netip.Addr
+
+	flows             *flow.Table
+	funnelIdleTimeout time.Duration
+	disabledRoutes    atomic.Pointer[[]netip.Prefix]
+	logger            *zerolog.Logger
 }
 
 // NewICMPRouter doesn't return an error if either ipv4 proxy or ipv6 proxy can be created. The machine might only
 // support one of them.
 // funnelIdleTimeout controls how long to wait to close a funnel without send/return
-func NewICMPRouter(ipv4Addr, ipv6Addr netip.Addr, logger *zerolog.Logger, funnelIdleTimeout time.Duration) (ICMPRouterServer, error) {
+// flows, if not nil, tracks the echo flows proxied by the router
+func NewICMPRouter(ipv4Addr, ipv6Addr netip.Addr, logger *zerolog.Logger, funnelIdleTimeout time.Duration, flows *flow.Table) (ICMPRouterServer, error) {
 	ipv4Proxy, ipv4Err := newICMPProxy(ipv4Addr, logger, funnelIdleTimeout)
 	ipv6Proxy, ipv6Err := newICMPProxy(ipv6Addr, logger, funnelIdleTimeout)
 	if ipv4Err != nil && ipv6Err != nil {
@@ -81,14 +91,20 @@ func NewICMPRouter(ipv4Addr, ipv6Addr netip.Addr, logger *zerolog.Logger, funnel
 		ipv6Proxy = nil
 	}
 	return &icmpRouter{
-		ipv4Proxy: ipv4Proxy,
-		ipv4Src:   ipv4Addr,
-		ipv6Proxy: ipv6Proxy,
-		ipv6Src:   ipv6Addr,
+		ipv4Proxy:         ipv4Proxy,
+		ipv4Src:           ipv4Addr,
+		ipv6Proxy:         ipv6Proxy,
+		ipv6Src:           ipv6Addr,
+		flows:             flows,
+		funnelIdleTimeout: funnelIdleTimeout,
+		logger:            logger,
 	}, nil
 }
 
 func (ir *icmpRouter) Serve(ctx context.Context) error {
+	if ir.flows != nil {
+		go ir.cleanupFlows(ctx)
+	}
 	if ir.ipv4Proxy != nil && ir.ipv6Proxy != nil {
 		errC := make(chan error, 2)
 		go func() {
@@ -112,6 +128,16 @@ func (ir *icmpRouter) Request(ctx context.Context, pk *packet.ICMP, responder IC
 	if pk == nil {
 		return errPacketNil
 	}
+	if _, err := getICMPEcho(pk.Message); err != nil {
+		flow.Dropped(flow.ICMP, flow.DropICMPUnsupportedType)
+		return err
+	}
+	if ir.isDisabledRoute(pk.Dst) {
+		flow.Dropped(flow.ICMP, flow.DropICMPRouteDisabled)
+		ir.logger.Debug().Str("dst", pk.Dst.String()).Msg("ICMP packet dropped, ICMP is disabled for the route")
+		return nil
+	}
+	responder = ir.trackFlow(pk, responder)
 	if pk.Dst.Is4() {
 		if ir.ipv4Proxy != nil {
 			return ir.ipv4Proxy.Request(ctx, pk, responder)
@@ -134,6 +160,71 @@ func (ir *icmpRouter) ConvertToTTLExceeded(pk *packet.ICMP, rawPacket packet.Raw
 	return packet.NewICMPTTLExceedPacket(pk.IP, rawPacket, srcIP)
 }
 
+func (ir *icmpRouter) SetDisabledRoutes(routes []netip.Prefix) {
+	ir.disabledRoutes.Store(&routes)
+}
+
+func (ir *icmpRouter) isDisabledRoute(dst netip.Addr) bool {
+	routes := ir.disabledRoutes.Load()
+	if routes == nil {
+		return false
+	}
+	for _, route := range *routes {
+		if route.Contains(dst) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackFlow accounts the ICMP echo in the flow table, keyed by the eyeball source, destination and echo ID.
+func (ir *icmpRouter) trackFlow(pk *packet.ICMP, responder ICMPResponder) ICMPResponder {
+	if ir.flows == nil {
+		return responder
+	}
+	echo, err := getICMPEcho(pk.Message)
+	if err != nil {
+		return responder
+	}
+	id := fmt.Sprintf("icmp-%s-%s-%d", pk.Src, pk.Dst, echo.ID)
+	flowEntry := ir.flows.Open(flow.ICMP, id, pk.Src.String(), pk.Dst.String(), responder.ConnectionIndex())
+	flowEntry.AddBytesToOrigin(icmpMessageLen(pk))
+	return &flowResponder{ICMPResponder: responder, flow: flowEntry}
+}
+
+// cleanupFlows removes the echo flows that didn't see any traffic for the funnel idle timeout.
+func (ir *icmpRouter) cleanupFlows(ctx context.Context) {
+	ticker := time.NewTicker(ir.funnelIdleTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ir.flows.RemoveIdle(flow.ICMP, ir.funnelIdleTimeout)
+		}
+	}
+}
+
+// flowResponder accounts the replies returned to the eyeball in the flow of the echo request.
+type flowResponder struct {
+	ICMPResponder
+	flow *flow.Flow
+}
+
+func (fr *flowResponder) ReturnPacket(pk *packet.ICMP) error {
+	fr.flow.AddBytesFromOrigin(icmpMessageLen(pk))
+	return fr.ICMPResponder.ReturnPacket(pk)
+}
+
+func icmpMessageLen(pk *packet.ICMP) int {
+	if pk.Message == nil || pk.Message.Body == nil {
+		return 0
+	}
+	// Type, code and checksum take 4 bytes in front of the message body
+	return 4 + pk.Message.Body.Len(int(pk.Protocol))
+}
+
 func getICMPEcho(msg *icmp.Message) (*icmp.Echo, error) {
 	echo, ok := msg.Body.(*icmp.Echo)
 	if !ok {
@@ -146,6 +237,11 @@ func isEchoReply(msg *icmp.Message) bool {
 	return msg.Type == ipv4.ICMPTypeEchoReply || msg.Type == ipv6.ICMPTypeEchoReply
 }
 
+// dropNonEchoReply counts a reply from the origin that isn't proxied back because it isn't an echo reply.
+func dropNonEchoReply() {
+	flow.Dropped(flow.ICMP, flow.DropICMPUnsupportedType)
+}
+
 func observeICMPRequest(logger *zerolog.Logger, span trace.Span, src string, dst string, echoID int, seq int) {
 	incrementICMPRequest()
 	logger.Debug().
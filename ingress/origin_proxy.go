@@ -6,10 +6,17 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/stream"
 )
 
+// udpOverWSIdleTimeout is how long a UDP origin is streamed to without datagrams in either direction, the client
+// connects again when it has a new datagram to send
+const udpOverWSIdleTimeout = 2 * time.Minute
+
 // HTTPOriginProxy can be implemented by origin services that want to proxy http requests.
 type HTTPOriginProxy interface {
 	// RoundTripper is how cloudflared proxies eyeball requests to the actual origin services
@@ -29,6 +36,9 @@ type HTTPLocalProxy interface {
 
 func (o *unixSocketPath) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.URL.Scheme = o.scheme
+	if req.URL.Scheme == "https" {
+		req = traceOriginTLS(req)
+	}
 	return o.transport.RoundTrip(req)
 }
 
@@ -55,7 +65,21 @@ func (o *httpService) RoundTrip(req *http.Request) (*http.Response, error) {
 		o.SetOriginServerName(req)
 	}
 
-	return o.transport.RoundTrip(req)
+	if req.URL.Scheme == "https" {
+		req = traceOriginTLS(req)
+	}
+
+	if o.http3 == nil {
+		return o.transport.RoundTrip(req)
+	}
+	resp, handled, err := o.http3.roundTrip(req)
+	if !handled {
+		resp, err = o.transport.RoundTrip(req)
+	}
+	if err == nil {
+		o.http3.discover(req, resp)
+	}
+	return resp, err
 }
 
 func (o *httpService) SetOriginServerName(req *http.Request) {
@@ -68,6 +92,11 @@ func (o *httpService) SetOriginServerName(req *http.Request) {
 			RootCAs:            o.transport.TLSClientConfig.RootCAs,
 			InsecureSkipVerify: o.transport.TLSClientConfig.InsecureSkipVerify,
 			ServerName:         req.Host,
+			ClientSessionCache: o.transport.TLSClientConfig.ClientSessionCache,
+			VerifyConnection:   o.transport.TLSClientConfig.VerifyConnection,
+			MinVersion:         o.transport.TLSClientConfig.MinVersion,
+			CipherSuites:       o.transport.TLSClientConfig.CipherSuites,
+			CurvePreferences:   o.transport.TLSClientConfig.CurvePreferences,
 		}), nil
 	}
 }
@@ -117,6 +146,17 @@ func (o *tcpOverWSService) EstablishConnection(ctx context.Context, dest string,
 
 }
 
+func (o *udpOverWSService) EstablishConnection(ctx context.Context, _ string, _ *zerolog.Logger) (OriginConnection, error) {
+	conn, err := o.dialer.DialContext(ctx, "udp", o.dest)
+	if err != nil {
+		return nil, err
+	}
+	return &tcpOverWSConnection{
+		conn:          stream.NewDatagramConn(conn, udpOverWSIdleTimeout),
+		streamHandler: DefaultStreamHandler,
+	}, nil
+}
+
 func (o *socksProxyOverWSService) EstablishConnection(_ context.Context, _ string, _ *zerolog.Logger) (OriginConnection, error) {
 	return o.conn, nil
 }
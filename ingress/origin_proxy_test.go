@@ -2,18 +2,23 @@ package ingress
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"testing"
 
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/tlsconfig"
 	"github.com/cloudflare/cloudflared/websocket"
 )
 
@@ -186,6 +191,115 @@ func TestHTTPServiceUsesIngressRuleScheme(t *testing.T) {
 	}
 }
 
+func TestHTTPServiceResumesTLSSessions(t *testing.T) {
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strconv.FormatBool(r.TLS.DidResume)))
+	}))
+	// Every request needs a new connection, and so a new handshake
+	origin.Config.SetKeepAlivesEnabled(false)
+	origin.StartTLS()
+	defer origin.Close()
+
+	originURL, err := url.Parse(origin.URL)
+	require.NoError(t, err)
+	httpService := &httpService{
+		url: originURL,
+	}
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	require.NoError(t, httpService.start(TestLogger, shutdownC, OriginRequestConfig{NoTLSVerify: true}))
+
+	handshakes := func(resumed bool) float64 {
+		var m dto.Metric
+		require.NoError(t, originTLSHandshakes.WithLabelValues(strconv.FormatBool(resumed)).Write(&m))
+		return m.Counter.GetValue()
+	}
+	full, resumed := handshakes(false), handshakes(true)
+
+	for _, expected := range []string{"false", "true", "true"} {
+		req, err := http.NewRequest(http.MethodGet, originURL.String(), nil)
+		require.NoError(t, err)
+		resp, err := httpService.RoundTrip(req)
+		require.NoError(t, err)
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, expected, string(respBody))
+	}
+	require.Equal(t, full+1, handshakes(false))
+	require.Equal(t, resumed+2, handshakes(true))
+}
+
+func TestHTTPServiceTracksTLSConnections(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+
+	originURL, err := url.Parse(origin.URL)
+	require.NoError(t, err)
+	httpService := &httpService{
+		url: originURL,
+	}
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	require.NoError(t, httpService.start(TestLogger, shutdownC, OriginRequestConfig{NoTLSVerify: true}))
+
+	originConnections := func() []OriginTLSConnection {
+		var connections []OriginTLSConnection
+		for _, conn := range ActiveOriginTLSConnections() {
+			if conn.Origin == origin.URL {
+				connections = append(connections, conn)
+			}
+		}
+		return connections
+	}
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, originURL.String(), nil)
+		require.NoError(t, err)
+		resp, err := httpService.RoundTrip(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	// The connection is reused by the second request
+	connections := originConnections()
+	require.Len(t, connections, 1)
+	assert.Equal(t, origin.Listener.Addr().String(), connections[0].RemoteAddress)
+	assert.Equal(t, "TLS 1.3", connections[0].Version)
+
+	httpService.transport.CloseIdleConnections()
+	assert.Empty(t, originConnections())
+}
+
+func TestHTTPServiceCryptoPolicy(t *testing.T) {
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	origin.TLS = &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA},
+	}
+	origin.StartTLS()
+	defer origin.Close()
+
+	strict, err := tlsconfig.NewCryptoPolicy(tlsconfig.CryptoPolicyStrict)
+	require.NoError(t, err)
+	noTLSVerify := true
+	ing, err := ParseIngress(&config.Configuration{
+		TunnelID: t.Name(),
+		Ingress: []config.UnvalidatedIngressRule{
+			{Service: origin.URL, OriginRequest: config.OriginRequestConfig{NoTLSVerify: &noTLSVerify}},
+		},
+	})
+	require.NoError(t, err)
+	ing.CryptoPolicy = strict
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	require.NoError(t, ing.StartOrigins(TestLogger, shutdownC))
+
+	req, err := http.NewRequest(http.MethodGet, origin.URL, nil)
+	require.NoError(t, err)
+	_, err = ing.Rules[0].Service.(*httpService).RoundTrip(req)
+	assert.Error(t, err)
+}
+
 func tcpListenRoutine(listener net.Listener, closeChan chan struct{}) {
 	go func() {
 		for {
@@ -71,10 +71,11 @@ type httpService struct {
 	url            *url.URL
 	hostHeader     string
 	transport      *http.Transport
+	http3          *http3Transport
 	matchSNIToHost bool
 }
 
-func (o *httpService) start(log *zerolog.Logger, _ <-chan struct{}, cfg OriginRequestConfig) error {
+func (o *httpService) start(log *zerolog.Logger, shutdownC <-chan struct{}, cfg OriginRequestConfig) error {
 	transport, err := newHTTPTransport(o, cfg, log)
 	if err != nil {
 		return err
@@ -82,6 +83,17 @@ func (o *httpService) start(log *zerolog.Logger, _ <-chan struct{}, cfg OriginRe
 	o.hostHeader = cfg.HTTPHostHeader
 	o.transport = transport
 	o.matchSNIToHost = cfg.MatchSNIToHost
+	// The SNI of the HTTP/3 connections can't follow the Host of each request, so matchSNItoHost stays on TCP
+	if cfg.Http3Origin != "" && !cfg.MatchSNIToHost && o.url != nil && (o.url.Scheme == "https" || o.url.Scheme == "wss") {
+		o.http3, err = newHTTP3Transport(cfg.Http3Origin, transport, cfg, log)
+		if err != nil {
+			return err
+		}
+		go func() {
+			<-shutdownC
+			o.http3.close()
+		}()
+	}
 	return nil
 }
 
@@ -124,6 +136,13 @@ type tcpOverWSService struct {
 	dialer        net.Dialer
 }
 
+// udpOverWSService models UDP origins serving eyeballs connecting over websocket with cloudflared access udp, the
+// datagrams are framed with their length on the stream.
+type udpOverWSService struct {
+	dest   string
+	dialer net.Dialer
+}
+
 type socksProxyOverWSService struct {
 	conn *socksProxyOverWSConnection
 }
@@ -145,6 +164,13 @@ func newTCPOverWSService(url *url.URL) *tcpOverWSService {
 	}
 }
 
+func newUDPOverWSService(url *url.URL) *udpOverWSService {
+	addPortIfMissing(url, 7864) // the same random port as tcp
+	return &udpOverWSService{
+		dest: url.Host,
+	}
+}
+
 func newBastionService() *tcpOverWSService {
 	return &tcpOverWSService{
 		isBastion: true,
@@ -196,6 +222,19 @@ func (o tcpOverWSService) MarshalJSON() ([]byte, error) {
 	return json.Marshal(o.String())
 }
 
+func (o *udpOverWSService) String() string {
+	return fmt.Sprintf("udp://%s", o.dest)
+}
+
+func (o *udpOverWSService) start(_ *zerolog.Logger, _ <-chan struct{}, cfg OriginRequestConfig) error {
+	o.dialer.Timeout = cfg.ConnectTimeout.Duration
+	return nil
+}
+
+func (o udpOverWSService) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
 func (o *socksProxyOverWSService) start(log *zerolog.Logger, _ <-chan struct{}, cfg OriginRequestConfig) error {
 	return nil
 }
@@ -362,6 +401,8 @@ func newHTTPTransport(service OriginService, cfg OriginRequestConfig, log *zerol
 	if _, isHelloWorld := service.(*helloWorld); !isHelloWorld && cfg.OriginServerName != "" {
 		httpTransport.TLSClientConfig.ServerName = cfg.OriginServerName
 	}
+	resumeOriginSessions(httpTransport.TLSClientConfig)
+	cfg.cryptoPolicy.Apply(httpTransport.TLSClientConfig)
 
 	dialer := &net.Dialer{
 		Timeout:   cfg.ConnectTimeout.Duration,
@@ -381,10 +422,18 @@ func newHTTPTransport(service OriginService, cfg OriginRequestConfig, log *zerol
 			return dialContext(ctx, "unix", service.path)
 		}
 
+	// If this origin is an in-memory listener, connect to it whatever the address.
+	case *listenerService:
+		httpTransport.Proxy = nil
+		httpTransport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return service.listener.dial(ctx)
+		}
+
 	// Otherwise, use the regular network config.
 	default:
 		httpTransport.DialContext = dialContext
 	}
+	httpTransport.DialContext = trackOriginConns(service, httpTransport.DialContext)
 
 	return &httpTransport, nil
 }
@@ -0,0 +1,99 @@
+package ingress
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+
+	"github.com/cloudflare/cloudflared/tlsconfig"
+)
+
+// originTLSConnections are the open TLS connections to the origins, from their handshake until they are closed
+var originTLSConnections = struct {
+	sync.Mutex
+	conns map[*originConn]struct{}
+}{conns: make(map[*originConn]struct{})}
+
+// OriginTLSConnection is an open TLS connection to an origin and the parameters it negotiated.
+type OriginTLSConnection struct {
+	Origin        string `json:"origin"`
+	RemoteAddress string `json:"remoteAddress"`
+	tlsconfig.ConnectionParameters
+}
+
+// ActiveOriginTLSConnections returns the TLS connections open to the origins over TCP.
+func ActiveOriginTLSConnections() []OriginTLSConnection {
+	originTLSConnections.Lock()
+	defer originTLSConnections.Unlock()
+	connections := make([]OriginTLSConnection, 0, len(originTLSConnections.conns))
+	for conn := range originTLSConnections.conns {
+		connections = append(connections, OriginTLSConnection{
+			Origin:               conn.origin,
+			RemoteAddress:        conn.RemoteAddr().String(),
+			ConnectionParameters: *conn.tlsParams,
+		})
+	}
+	return connections
+}
+
+// originConn is a connection dialed to an origin, tracked in originTLSConnections once TLS is negotiated over it.
+type originConn struct {
+	net.Conn
+	origin string
+
+	lock      sync.Mutex
+	closed    bool
+	tlsParams *tlsconfig.ConnectionParameters
+}
+
+// trackOriginConns wraps the connections of dial to the origin service so that they can be tracked.
+func trackOriginConns(service OriginService, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &originConn{Conn: conn, origin: service.String()}, nil
+	}
+}
+
+func (c *originConn) handshakeDone(state tls.ConnectionState) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed || c.tlsParams != nil {
+		return
+	}
+	c.tlsParams = tlsconfig.NewConnectionParameters(state)
+	originTLSConnections.Lock()
+	originTLSConnections.conns[c] = struct{}{}
+	originTLSConnections.Unlock()
+}
+
+func (c *originConn) Close() error {
+	c.lock.Lock()
+	c.closed = true
+	c.lock.Unlock()
+	originTLSConnections.Lock()
+	delete(originTLSConnections.conns, c)
+	originTLSConnections.Unlock()
+	return c.Conn.Close()
+}
+
+// traceOriginTLS tracks the new TLS connection req gets from the transport, HTTP/1.1 or HTTP/2 alike.
+func traceOriginTLS(req *http.Request) *http.Request {
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				return
+			}
+			if tlsConn, ok := info.Conn.(*tls.Conn); ok {
+				if conn, ok := tlsConn.NetConn().(*originConn); ok {
+					conn.handshakeDone(tlsConn.ConnectionState())
+				}
+			}
+		},
+	}))
+}
@@ -0,0 +1,32 @@
+package ingress
+
+import (
+	"crypto/tls"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// originTLSSessionCacheSize is how many TLS sessions are kept for each origin to resume them, one per server name
+const originTLSSessionCacheSize = 64
+
+var originTLSHandshakes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "origin",
+	Name:      "tls_handshakes_total",
+	Help:      "Total count of TLS handshakes with the origins, by whether they resumed a cached session",
+}, []string{"resumed"})
+
+func init() {
+	prometheus.MustRegister(originTLSHandshakes)
+}
+
+// resumeOriginSessions caches the TLS sessions of the origin in cfg to resume them, sparing the full handshakes of
+// new connections, and counts the handshakes that did.
+func resumeOriginSessions(cfg *tls.Config) {
+	cfg.ClientSessionCache = tls.NewLRUClientSessionCache(originTLSSessionCacheSize)
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		originTLSHandshakes.WithLabelValues(strconv.FormatBool(state.DidResume)).Inc()
+		return nil
+	}
+}
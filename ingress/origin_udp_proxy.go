@@ -5,8 +5,15 @@ import (
 	"io"
 	"net"
 	"net/netip"
+	"sync/atomic"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
+// maxDSCP is the largest differentiated services code point that fits in the 6 DS bits of the IP header.
+const maxDSCP = 0b0011_1111
+
 type UDPProxy interface {
 	io.ReadWriteCloser
 	LocalAddr() net.Addr
@@ -44,3 +51,56 @@ func DialUDPAddrPort(dest netip.AddrPort) (*net.UDPConn, error) {
 
 	return udpConn, nil
 }
+
+// SetDSCP marks all packets written to the origin on the provided connection with the differentiated services code
+// point, so that eyeball traffic keeps its QoS class on the origin network.
+func SetDSCP(conn net.Conn, dscp uint8) error {
+	if dscp > maxDSCP {
+		return fmt.Errorf("dscp value %d exceeds %d", dscp, maxDSCP)
+	}
+	// DSCP occupies the 6 most significant bits of the (IPv4) TOS and (IPv6) traffic class fields; the 2 least
+	// significant bits are used for ECN which we leave to the kernel.
+	tos := int(dscp) << 2
+	if addr, ok := conn.RemoteAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		if err := ipv6.NewConn(conn).SetTrafficClass(tos); err != nil {
+			return fmt.Errorf("unable to set traffic class on udp socket to origin %s: %w", addr, err)
+		}
+		return nil
+	}
+	if err := ipv4.NewConn(conn).SetTOS(tos); err != nil {
+		return fmt.Errorf("unable to set tos on udp socket to origin %s: %w", conn.RemoteAddr(), err)
+	}
+	return nil
+}
+
+// DSCPMarker is implemented by the origins that mark the packets of a flow with the DSCP of its eyeball packets.
+type DSCPMarker interface {
+	MarkDSCP(dscp uint8) error
+}
+
+type dscpOrigin struct {
+	io.ReadWriteCloser
+	conn net.Conn
+	// dscp is the current marking of conn, which sends best effort (0) packets until it's marked
+	dscp atomic.Uint32
+}
+
+// NewDSCPOrigin wraps origin, which writes to conn, into a DSCPMarker. The socket option is only set when the DSCP of
+// the flow changes, so that it can be marked for every packet.
+func NewDSCPOrigin(origin io.ReadWriteCloser, conn net.Conn) io.ReadWriteCloser {
+	return &dscpOrigin{
+		ReadWriteCloser: origin,
+		conn:            conn,
+	}
+}
+
+func (o *dscpOrigin) MarkDSCP(dscp uint8) error {
+	if o.dscp.Load() == uint32(dscp) {
+		return nil
+	}
+	if err := SetDSCP(o.conn, dscp); err != nil {
+		return err
+	}
+	o.dscp.Store(uint32(dscp))
+	return nil
+}
@@ -0,0 +1,46 @@
+package ingress
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+)
+
+func TestSetDSCP(t *testing.T) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	conn, err := DialUDPAddrPort(listener.LocalAddr().(*net.UDPAddr).AddrPort())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, SetDSCP(conn, 46))
+	tos, err := ipv4.NewConn(conn).TOS()
+	require.NoError(t, err)
+	require.Equal(t, 46<<2, tos)
+
+	require.Error(t, SetDSCP(conn, 64))
+}
+
+func TestDSCPOrigin(t *testing.T) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	conn, err := DialUDPAddrPort(listener.LocalAddr().(*net.UDPAddr).AddrPort())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	origin, ok := NewDSCPOrigin(conn, conn).(DSCPMarker)
+	require.True(t, ok)
+	for _, dscp := range []uint8{46, 46, 0} {
+		require.NoError(t, origin.MarkDSCP(dscp))
+		tos, err := ipv4.NewConn(conn).TOS()
+		require.NoError(t, err)
+		require.Equal(t, int(dscp)<<2, tos)
+	}
+	require.Error(t, origin.MarkDSCP(64))
+}
@@ -8,6 +8,7 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/packet"
 	quicpogs "github.com/cloudflare/cloudflared/quic"
 	"github.com/cloudflare/cloudflared/tracing"
@@ -79,11 +80,13 @@ func (r *PacketRouter) nextPacket(ctx context.Context) (packet.RawPacket, ICMPRe
 func (r *PacketRouter) handlePacket(ctx context.Context, rawPacket packet.RawPacket, responder ICMPResponder) {
 	// ICMP Proxy feature is disabled, drop packets
 	if r.icmpRouter == nil {
+		flow.Dropped(flow.ICMP, flow.DropICMPDisabled)
 		return
 	}
 
 	icmpPacket, err := r.decoder.Decode(rawPacket)
 	if err != nil {
+		flow.Dropped(flow.ICMP, flow.DropMalformed)
 		r.logger.Err(err).Msg("Failed to decode ICMP packet from quic datagram")
 		return
 	}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"path/filepath"
+	"regexp"
 )
 
 var defaultConfig = createDefaultConfig()
@@ -11,8 +12,14 @@ type Config struct {
 	ConsoleConfig *ConsoleConfig // If nil, the logger will not log into the console
 	FileConfig    *FileConfig    // If nil, the logger will not use an individual log file
 	RollingConfig *RollingConfig // If nil, the logger will not use a rolling log
+	SyslogConfig  *SyslogConfig  // If nil, the logger will not log to syslog
+	Journald      bool           // If true, the logger will log to the systemd journal
 
 	MinLevel string // debug | info | error | fatal
+
+	RateLimit *RateLimitConfig // If nil, the logger will not rate limit the repeated messages
+
+	Redactions []*regexp.Regexp // If empty, the logger will not redact the log events
 }
 
 type ConsoleConfig struct {
@@ -28,6 +35,11 @@ func (fc *FileConfig) Fullpath() string {
 	return filepath.Join(fc.Dirname, fc.Filename)
 }
 
+type SyslogConfig struct {
+	Address  string // udp://HOST:PORT, tcp://HOST:PORT, unix:///PATH or local
+	Facility string
+}
+
 type RollingConfig struct {
 	Dirname  string
 	Filename string
@@ -124,6 +124,35 @@ func newZerolog(loggerConfig *Config) *zerolog.Logger {
 		writers = append(writers, rollingLogger)
 	}
 
+	if loggerConfig.SyslogConfig != nil {
+		syslogLogger, err := newSyslogWriter(*loggerConfig.SyslogConfig)
+		if err != nil {
+			return fallbackLogger(err)
+		}
+
+		writers = append(writers, syslogLogger)
+	}
+
+	if loggerConfig.Journald {
+		journaldLogger, err := newJournaldWriter()
+		if err != nil {
+			return fallbackLogger(err)
+		}
+
+		writers = append(writers, journaldLogger)
+	}
+
+	if ServiceEventLog != nil {
+		writers = append(writers, eventLogWriter{ServiceEventLog})
+	}
+
+	if loggerConfig.RateLimit != nil {
+		// The management logger is not rate limited so that all the events can be streamed
+		rateLimitedWriter := newRateLimitedWriter(*loggerConfig.RateLimit, writers)
+		go rateLimitedWriter.flushEvery(time.NewTicker(loggerConfig.RateLimit.Period).C)
+		writers = []io.Writer{rateLimitedWriter}
+	}
+
 	var managementWriter zerolog.LevelWriter
 	if features.Contains(features.FeatureManagementLogs) {
 		managementWriter = ManagementLogger
@@ -134,8 +163,12 @@ func newZerolog(loggerConfig *Config) *zerolog.Logger {
 		level = zerolog.InfoLevel
 	}
 
-	multi := resilientMultiWriter{level, writers, managementWriter}
-	log := zerolog.New(multi).With().Timestamp().Logger()
+	var writer zerolog.LevelWriter = resilientMultiWriter{level, writers, managementWriter}
+	if len(loggerConfig.Redactions) > 0 {
+		// The management logger is redacted too since its events are streamed out of the host
+		writer = redactingWriter{loggerConfig.Redactions, writer}
+	}
+	log := zerolog.New(writer).With().Timestamp().Logger()
 	if !levelErrorLogged && levelErr != nil {
 		log.Error().Msgf("Failed to parse log level %q, using %q instead", loggerConfig.MinLevel, level)
 		levelErrorLogged = true
@@ -173,20 +206,63 @@ func createFromContext(
 		logFile,
 	)
 
+	if syslogAddress := c.String(LogSyslogFlag); syslogAddress != "" {
+		facility := c.String(LogSyslogFacilityFlag)
+		if facility == "" {
+			facility = defaultSyslogFacility
+		}
+		loggerConfig.SyslogConfig = &SyslogConfig{Address: syslogAddress, Facility: facility}
+	}
+	loggerConfig.Journald = c.Bool(LogJournaldFlag)
+	rateLimit, rateLimitErr := rateLimitFromContext(c)
+	loggerConfig.RateLimit = rateLimit
+	redactions, redactionsErr := ParseRedactionRules(c.StringSlice(LogRedactFlag))
+	loggerConfig.Redactions = redactions
+
 	log := newZerolog(loggerConfig)
+	if rateLimitErr != nil {
+		log.Error().Err(rateLimitErr).Msgf("Failed to parse --%s, the logs are not rate limited", LogRateLimitFlag)
+	}
+	if redactionsErr != nil {
+		log.Error().Err(redactionsErr).Msgf("Failed to parse --%s, the logs are only redacted by the valid rules", LogRedactFlag)
+	}
 	if incompatibleFlagsSet := logFile != "" && logDirectory != ""; incompatibleFlagsSet {
 		log.Error().Msgf("Your config includes values for both %s (%s) and %s (%s), but they are incompatible. %s takes precedence.", LogFileFlag, logFile, logDirectoryFlagName, logDirectory, LogFileFlag)
 	}
 	return log
 }
 
+func rateLimitFromContext(c *cli.Context) (*RateLimitConfig, error) {
+	if !c.IsSet(LogRateLimitFlag) {
+		return nil, nil
+	}
+	limit, levelLimits, err := ParseRateLimits(c.StringSlice(LogRateLimitFlag))
+	if err != nil {
+		return nil, err
+	}
+	period := c.Duration(LogRateLimitPeriodFlag)
+	if period <= 0 {
+		return nil, fmt.Errorf("--%s must be positive", LogRateLimitPeriodFlag)
+	}
+	return &RateLimitConfig{
+		Limit:       limit,
+		LevelLimits: levelLimits,
+		Period:      period,
+		SampleRate:  c.Int(LogSampleRateFlag),
+	}, nil
+}
+
 func Create(loggerConfig *Config) *zerolog.Logger {
 	if loggerConfig == nil {
 		loggerConfig = &Config{
 			defaultConfig.ConsoleConfig,
 			nil,
 			nil,
+			nil,
+			false,
 			defaultConfig.MinLevel,
+			nil,
+			nil,
 		}
 	}
 	return newZerolog(loggerConfig)
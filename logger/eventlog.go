@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Event IDs of the events written to the event log of the service manager, grouped by hundreds: the lifecycle of the
+// service, the connections of the tunnels and the errors.
+const (
+	EventIDServiceStarting      uint32 = 100
+	EventIDServiceStopped       uint32 = 101
+	EventIDServiceArguments     uint32 = 102
+	EventIDGracefulShutdown     uint32 = 103
+	EventIDImmediateShutdown    uint32 = 104
+	EventIDTerminated           uint32 = 105
+	EventIDConnectionRegistered uint32 = 200
+	EventIDConnectionLost       uint32 = 201
+	EventIDServiceFailed        uint32 = 300
+	EventIDUnexpectedControl    uint32 = 301
+	EventIDErrorLogged          uint32 = 302
+)
+
+// EventLog is the event log of a service manager, e.g. the Windows Event Log.
+type EventLog interface {
+	Info(eventID uint32, msg string) error
+	Warning(eventID uint32, msg string) error
+	Error(eventID uint32, msg string) error
+}
+
+// ServiceEventLog, if not nil, is the event log of the service cloudflared runs as. The loggers created once it is
+// set write the errors they log to it.
+var ServiceEventLog EventLog
+
+// eventLogWriter writes the errors logged to the event log, so that the monitoring of the service manager sees them.
+type eventLogWriter struct {
+	eventLog EventLog
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	var event struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(p, &event); err != nil {
+		return len(p), nil
+	}
+	switch event.Level {
+	case "error", "fatal", "panic":
+	default:
+		return len(p), nil
+	}
+	msg := event.Message
+	if event.Error != "" {
+		if msg != "" {
+			msg = fmt.Sprintf("%s: %s", msg, event.Error)
+		} else {
+			msg = event.Error
+		}
+	}
+	return len(p), w.eventLog.Error(EventIDErrorLogged, msg)
+}
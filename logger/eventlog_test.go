@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type loggedEvent struct {
+	eventID uint32
+	msg     string
+}
+
+type mockEventLog struct {
+	errors []loggedEvent
+}
+
+func (m *mockEventLog) Info(eventID uint32, msg string) error {
+	return nil
+}
+
+func (m *mockEventLog) Warning(eventID uint32, msg string) error {
+	return nil
+}
+
+func (m *mockEventLog) Error(eventID uint32, msg string) error {
+	m.errors = append(m.errors, loggedEvent{eventID, msg})
+	return nil
+}
+
+func TestEventLogWriter(t *testing.T) {
+	eventLog := &mockEventLog{}
+	log := zerolog.New(eventLogWriter{eventLog})
+
+	log.Info().Msg("Registered tunnel connection")
+	log.Warn().Msg("Retrying connection")
+	log.Error().Msg("Failed to serve tunnel connection")
+	log.Err(assert.AnError).Msg("Failed to dial origin")
+
+	require.Len(t, eventLog.errors, 2)
+	assert.Equal(t, loggedEvent{EventIDErrorLogged, "Failed to serve tunnel connection"}, eventLog.errors[0])
+	assert.Equal(t, loggedEvent{EventIDErrorLogged, "Failed to dial origin: " + assert.AnError.Error()}, eventLog.errors[1])
+}
@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldWriter sends the log events to the systemd journal with its native protocol, each field of the event
+// becoming a field of the journal entry, e.g. connIndex becomes CONNINDEX.
+type journaldWriter struct {
+	socket string
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+func newJournaldWriter() (*journaldWriter, error) {
+	if _, err := os.Stat(journaldSocket); err != nil {
+		return nil, fmt.Errorf("the systemd journal is not available: %w", err)
+	}
+	return &journaldWriter{socket: journaldSocket}, nil
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	var event map[string]any
+	if err := json.Unmarshal(p, &event); err != nil {
+		event = map[string]any{zerolog.MessageFieldName: string(bytes.TrimRight(p, "\n"))}
+	}
+	entry := journaldEntry(event)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.conn == nil {
+		conn, err := net.Dial("unixgram", w.socket)
+		if err != nil {
+			return 0, err
+		}
+		w.conn = conn
+	}
+	if _, err := w.conn.Write(entry); err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// journaldEntry encodes the fields of the event in the native protocol of journald.
+func journaldEntry(event map[string]any) []byte {
+	level := zerolog.NoLevel
+	if name, ok := event[zerolog.LevelFieldName].(string); ok {
+		level, _ = zerolog.ParseLevel(name)
+	}
+	message, _ := event[zerolog.MessageFieldName].(string)
+
+	var entry bytes.Buffer
+	writeJournaldField(&entry, "MESSAGE", message)
+	writeJournaldField(&entry, "PRIORITY", fmt.Sprint(syslogSeverity(level)))
+	writeJournaldField(&entry, "SYSLOG_IDENTIFIER", syslogAppName)
+	keys := make([]string, 0, len(event))
+	for key := range event {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch key {
+		case zerolog.LevelFieldName, zerolog.MessageFieldName, zerolog.TimestampFieldName:
+			// The journal records them itself
+			continue
+		}
+		name := journaldFieldName(key)
+		if name == "" {
+			continue
+		}
+		value, ok := event[key].(string)
+		if !ok {
+			encoded, _ := json.Marshal(event[key])
+			value = string(encoded)
+		}
+		writeJournaldField(&entry, name, value)
+	}
+	return entry.Bytes()
+}
+
+// journaldFieldName converts the name of a field to the upper case letters, digits and underscores that journald
+// accepts. The names can't start with an underscore, those are reserved to the journal.
+func journaldFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	switch name {
+	case "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+		return "CLOUDFLARED_" + name
+	}
+	return name
+}
+
+// writeJournaldField writes a field as NAME=VALUE, or in binary form if the value spans several lines.
+func writeJournaldField(entry *bytes.Buffer, name, value string) {
+	entry.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		entry.WriteByte('=')
+		entry.WriteString(value)
+		entry.WriteByte('\n')
+		return
+	}
+	entry.WriteByte('\n')
+	_ = binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	entry.WriteString(value)
+	entry.WriteByte('\n')
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package logger
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournaldWriter(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer server.Close()
+
+	w := &journaldWriter{socket: socket}
+	log := zerolog.New(w).With().Timestamp().Logger()
+	log.Warn().Uint8("connIndex", 2).Str("event", "retry").Str("error", "line 1\nline 2").Msg("Connection failed")
+
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "MESSAGE=Connection failed\n"+
+		"PRIORITY=4\n"+
+		"SYSLOG_IDENTIFIER=cloudflared\n"+
+		"CONNINDEX=2\n"+
+		"ERROR\n\x0d\x00\x00\x00\x00\x00\x00\x00line 1\nline 2\n"+
+		"EVENT=retry\n", string(buf[:n]))
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	assert.Equal(t, "TUNNELID", journaldFieldName("tunnelID"))
+	assert.Equal(t, "CONTENT_LENGTH", journaldFieldName("content-length"))
+	assert.Equal(t, "CLOUDFLARED_MESSAGE", journaldFieldName("_message"))
+	assert.Equal(t, "", journaldFieldName("__"))
+}
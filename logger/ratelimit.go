@@ -0,0 +1,199 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	LogRateLimitFlag       = "log-rate-limit"
+	LogRateLimitPeriodFlag = "log-rate-limit-period"
+	LogSampleRateFlag      = "log-sample-rate"
+
+	// maxRateLimitedMessages bounds the messages tracked by the rate limiter, e.g. when they embed request details
+	maxRateLimitedMessages = 1000
+)
+
+// RateLimitConfig limits how many times the same message can be logged at the same level per period, so that a
+// failure repeated thousands of times per second doesn't fill the disk or hide the other events.
+type RateLimitConfig struct {
+	// Limit applies to the levels that are not in LevelLimits, 0 doesn't limit them
+	Limit       int
+	LevelLimits map[zerolog.Level]int
+	Period      time.Duration
+	// SampleRate still logs 1 out of every SampleRate messages over the limit, 0 logs none of them
+	SampleRate int
+}
+
+// ParseRateLimits parses limits that are either N for all the levels or LEVEL=N for a single level.
+func ParseRateLimits(limits []string) (int, map[zerolog.Level]int, error) {
+	var limit int
+	levelLimits := make(map[zerolog.Level]int)
+	for _, value := range limits {
+		levelName, n, ok := strings.Cut(value, "=")
+		if !ok {
+			n = levelName
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(n))
+		if err != nil || parsed < 0 {
+			return 0, nil, fmt.Errorf("%s is not a rate limit, it must be N or LEVEL=N with N >= 0", value)
+		}
+		if !ok {
+			limit = parsed
+			continue
+		}
+		level, err := zerolog.ParseLevel(strings.TrimSpace(levelName))
+		if err != nil || level == zerolog.NoLevel {
+			return 0, nil, fmt.Errorf("%s is not a rate limit, %q is not a log level", value, levelName)
+		}
+		levelLimits[level] = parsed
+	}
+	return limit, levelLimits, nil
+}
+
+func (c *RateLimitConfig) limit(level zerolog.Level) int {
+	if limit, ok := c.LevelLimits[level]; ok {
+		return limit
+	}
+	return c.Limit
+}
+
+// rateLimitedWriter drops the log events over the rate limit of their message before they reach the writers. The
+// count of dropped events is logged at the first tick after the period of their message is over, or when the message
+// is evicted to keep at most maxRateLimitedMessages.
+type rateLimitedWriter struct {
+	config    RateLimitConfig
+	writers   []io.Writer
+	summaries zerolog.Logger
+	now       func() time.Time
+
+	lock     sync.Mutex
+	messages map[rateLimitKey]*rateLimitedMessage
+}
+
+type rateLimitKey struct {
+	level   zerolog.Level
+	message string
+}
+
+type rateLimitedMessage struct {
+	periodStart time.Time
+	count       int
+	suppressed  int
+}
+
+func newRateLimitedWriter(config RateLimitConfig, writers []io.Writer) *rateLimitedWriter {
+	w := &rateLimitedWriter{
+		config:   config,
+		writers:  writers,
+		now:      time.Now,
+		messages: make(map[rateLimitKey]*rateLimitedMessage),
+	}
+	w.summaries = zerolog.New(writerFunc(w.writeAll)).With().Timestamp().Logger()
+	return w
+}
+
+// flushEvery logs the count of dropped events of the messages whose period is over and forgets them at each tick,
+// so that the count is logged even if the message doesn't come back.
+func (w *rateLimitedWriter) flushEvery(ticks <-chan time.Time) {
+	for now := range ticks {
+		w.flush(now)
+	}
+}
+
+func (w *rateLimitedWriter) flush(now time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for key, message := range w.messages {
+		if now.Sub(message.periodStart) >= w.config.Period {
+			w.summarize(key, message)
+			delete(w.messages, key)
+		}
+	}
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	var event struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(p, &event); err != nil {
+		return w.writeAll(p)
+	}
+	level, err := zerolog.ParseLevel(event.Level)
+	if err != nil {
+		return w.writeAll(p)
+	}
+	limit := w.config.limit(level)
+	if limit <= 0 {
+		return w.writeAll(p)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	now := w.now()
+	key := rateLimitKey{level: level, message: event.Message}
+	message, ok := w.messages[key]
+	if !ok {
+		if len(w.messages) >= maxRateLimitedMessages {
+			w.evictOldest()
+		}
+		message = &rateLimitedMessage{periodStart: now}
+		w.messages[key] = message
+	} else if now.Sub(message.periodStart) >= w.config.Period {
+		w.summarize(key, message)
+		*message = rateLimitedMessage{periodStart: now}
+	}
+
+	message.count++
+	if over := message.count - limit; over > 0 && (w.config.SampleRate <= 0 || over%w.config.SampleRate != 0) {
+		message.suppressed++
+		return len(p), nil
+	}
+	return w.writeAll(p)
+}
+
+// evictOldest forgets the message whose period started first, to make room for a new one.
+func (w *rateLimitedWriter) evictOldest() {
+	var oldestKey rateLimitKey
+	var oldest *rateLimitedMessage
+	for key, message := range w.messages {
+		if oldest == nil || message.periodStart.Before(oldest.periodStart) {
+			oldestKey, oldest = key, message
+		}
+	}
+	if oldest != nil {
+		w.summarize(oldestKey, oldest)
+		delete(w.messages, oldestKey)
+	}
+}
+
+func (w *rateLimitedWriter) summarize(key rateLimitKey, message *rateLimitedMessage) {
+	if message.suppressed == 0 {
+		return
+	}
+	w.summaries.WithLevel(key.level).
+		Int("suppressed", message.suppressed).
+		Str("suppressedMessage", key.message).
+		Msgf("Suppressed %d log messages over the rate limit of %d per %s", message.suppressed, w.config.limit(key.level), w.config.Period)
+}
+
+func (w *rateLimitedWriter) writeAll(p []byte) (int, error) {
+	for _, writer := range w.writers {
+		_, _ = writer.Write(p)
+	}
+	return len(p), nil
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
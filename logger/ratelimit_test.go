@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	limit, levelLimits, err := ParseRateLimits([]string{"10", "debug=0", "error = 5"})
+	require.NoError(t, err)
+	assert.Equal(t, 10, limit)
+	assert.Equal(t, map[zerolog.Level]int{zerolog.DebugLevel: 0, zerolog.ErrorLevel: 5}, levelLimits)
+
+	for _, invalid := range []string{"ten", "-1", "loud=5", "=5", "info=many"} {
+		_, _, err := ParseRateLimits([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRateLimitedWriter(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	w := newRateLimitedWriter(RateLimitConfig{
+		Limit:       2,
+		LevelLimits: map[zerolog.Level]int{zerolog.DebugLevel: 0},
+		Period:      time.Second,
+		SampleRate:  3,
+	}, []io.Writer{&out})
+	w.now = func() time.Time { return now }
+	log := zerolog.New(w)
+
+	for i := 0; i < 10; i++ {
+		log.Error().Msg("origin is down")
+		log.Debug().Msg("origin is down")
+	}
+	log.Error().Msg("another failure")
+	// The count of the suppressed messages is logged with the next message after the period
+	now = now.Add(time.Second)
+	log.Error().Msg("origin is down")
+
+	var messages []string
+	var summary map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		if _, ok := event["suppressed"]; ok {
+			summary = event
+		}
+		messages = append(messages, event["level"].(string)+" "+event["message"].(string))
+	}
+	// 2 errors under the limit, then 1 sampled every 3 over it, the debug messages are not limited
+	assert.Equal(t, 10+2+2+1+2, len(messages))
+	require.NotNil(t, summary)
+	assert.Equal(t, "error", summary["level"])
+	assert.Equal(t, float64(6), summary["suppressed"])
+	assert.Equal(t, "origin is down", summary["suppressedMessage"])
+	assert.Equal(t, "error origin is down", messages[len(messages)-1])
+}
+
+func TestRateLimitedWriterFlush(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	w := newRateLimitedWriter(RateLimitConfig{Limit: 1, Period: time.Second}, []io.Writer{&out})
+	w.now = func() time.Time { return now }
+	log := zerolog.New(w)
+
+	for i := 0; i < 3; i++ {
+		log.Error().Msg("origin is down")
+	}
+	w.flush(now.Add(time.Second / 2))
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+
+	// The message doesn't come back, the count is logged by the tick after its period
+	w.flush(now.Add(time.Second))
+	assert.Contains(t, out.String(), `"suppressed":2`)
+	assert.Empty(t, w.messages)
+}
+
+func TestRateLimitedWriterBound(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	w := newRateLimitedWriter(RateLimitConfig{Limit: 1, Period: time.Hour}, []io.Writer{&out})
+	w.now = func() time.Time { return now }
+	log := zerolog.New(w)
+
+	log.Error().Msg("origin is down")
+	log.Error().Msg("origin is down")
+	for i := 0; i < maxRateLimitedMessages; i++ {
+		now = now.Add(time.Millisecond)
+		log.Error().Msgf("request %d failed", i)
+	}
+	assert.Len(t, w.messages, maxRateLimitedMessages)
+	// The oldest message was evicted with the count of its dropped events
+	assert.NotContains(t, w.messages, rateLimitKey{level: zerolog.ErrorLevel, message: "origin is down"})
+	assert.Contains(t, out.String(), `"suppressed":1`)
+}
@@ -0,0 +1,146 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	LogRedactFlag = "log-redact"
+
+	redactedLogValue = "REDACTED"
+)
+
+// ParseRedactionRules compiles the regular expressions of the redaction rules. The rules that don't compile are
+// reported in the error, the others are still returned so that they are applied.
+func ParseRedactionRules(patterns []string) ([]*regexp.Regexp, error) {
+	var (
+		rules []*regexp.Regexp
+		errs  []error
+	)
+	for _, pattern := range patterns {
+		rule, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q is not a regular expression: %w", pattern, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, errors.Join(errs...)
+}
+
+// redactingWriter replaces what the redaction rules match in the log events before they reach the writer. When a
+// rule has groups, only what they match is replaced, e.g. `token=(\w+)` keeps the name of the token.
+type redactingWriter struct {
+	rules  []*regexp.Regexp
+	writer zerolog.LevelWriter
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	_, err := w.writer.Write(Redact(w.rules, p))
+	return len(p), err
+}
+
+func (w redactingWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	_, err := w.writer.WriteLevel(level, Redact(w.rules, p))
+	return len(p), err
+}
+
+// Redact replaces what the redaction rules match in p, e.g. so that the logs written outside of the logger are
+// redacted too. When p is a JSON event, the rules are matched against each of its decoded string values, so that a
+// match can't run past the end of a value and break the JSON that the writers decode.
+func Redact(rules []*regexp.Regexp, p []byte) []byte {
+	if len(rules) == 0 {
+		return p
+	}
+	if !json.Valid(p) {
+		return redactText(rules, p)
+	}
+	var (
+		redacted []byte
+		last     int
+	)
+	for i := 0; i < len(p); i++ {
+		if p[i] != '"' {
+			continue
+		}
+		end := jsonStringEnd(p, i)
+		if !isJSONKey(p, end) {
+			var value string
+			if err := json.Unmarshal(p[i:end], &value); err == nil {
+				if redactedValue := redactText(rules, []byte(value)); !bytes.Equal(redactedValue, []byte(value)) {
+					redacted = append(redacted, p[last:i]...)
+					redacted = append(redacted, encodeJSONString(string(redactedValue))...)
+					last = end
+				}
+			}
+		}
+		i = end - 1
+	}
+	if redacted == nil {
+		return p
+	}
+	return append(redacted, p[last:]...)
+}
+
+// jsonStringEnd returns the index following the closing quote of the JSON string that starts at start.
+func jsonStringEnd(p []byte, start int) int {
+	i := start + 1
+	for i < len(p) && p[i] != '"' {
+		if p[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	return i + 1
+}
+
+// isJSONKey tells whether the JSON string that ends before end is the key of a field.
+func isJSONKey(p []byte, end int) bool {
+	rest := bytes.TrimLeft(p[end:], " \t\r\n")
+	return len(rest) > 0 && rest[0] == ':'
+}
+
+func encodeJSONString(value string) []byte {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// Like zerolog, the HTML characters are kept as they are
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// redactText replaces what the redaction rules match in p.
+func redactText(rules []*regexp.Regexp, p []byte) []byte {
+	for _, rule := range rules {
+		matches := rule.FindAllSubmatchIndex(p, -1)
+		if matches == nil {
+			continue
+		}
+		redacted := make([]byte, 0, len(p))
+		last := 0
+		for _, match := range matches {
+			// The whole match is redacted if the rule has no group, otherwise each of the groups that matched
+			spans := match[:2]
+			if len(match) > 2 {
+				spans = match[2:]
+			}
+			for i := 0; i < len(spans); i += 2 {
+				start, end := spans[i], spans[i+1]
+				if start < last || start == end {
+					continue
+				}
+				redacted = append(redacted, p[last:start]...)
+				redacted = append(redacted, redactedLogValue...)
+				last = end
+			}
+		}
+		p = append(redacted, p[last:]...)
+	}
+	return p
+}
@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRedactionRules(t *testing.T) {
+	rules, err := ParseRedactionRules([]string{`token=(\w+)`, `(unclosed`, `internal\.example\.com`})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "(unclosed")
+	require.Len(t, rules, 2)
+}
+
+func TestRedactingWriter(t *testing.T) {
+	rules, err := ParseRedactionRules([]string{`token=(\w+)`, `[a-z0-9-]+\.internal\.example\.com`, `(user)=(\w+)`})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	log := zerolog.New(redactingWriter{rules, resilientMultiWriter{zerolog.DebugLevel, []io.Writer{&out}, nil}})
+
+	log.Info().Str("url", "https://db-1.internal.example.com/?token=abc123&user=alice").Msg("token=def456 sent")
+	assert.Equal(t,
+		`{"level":"info","url":"https://REDACTED/?token=REDACTED&REDACTED=REDACTED","message":"token=REDACTED sent"}`+"\n",
+		out.String())
+
+	out.Reset()
+	log.Info().Msg("nothing to hide")
+	assert.Equal(t, `{"level":"info","message":"nothing to hide"}`+"\n", out.String())
+}
+
+func TestRedactKeepsTheJSONValid(t *testing.T) {
+	// The rule would match up to the end of the line in the serialized event, which has no space
+	rules, err := ParseRedactionRules([]string{`Bearer \S+`})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	log := zerolog.New(redactingWriter{rules, resilientMultiWriter{zerolog.DebugLevel, []io.Writer{&out}, nil}})
+
+	log.Info().Str("authorization", "Bearer abc.def").Str("path", `/a"b<c>`).Int("status", 401).Msg("unauthorized")
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &event))
+	assert.Equal(t, map[string]any{
+		"level":         "info",
+		"authorization": "REDACTED",
+		"path":          `/a"b<c>`,
+		"status":        float64(401),
+		"message":       "unauthorized",
+	}, event)
+
+	// The text that isn't JSON is redacted as it is
+	assert.Equal(t, "auth: REDACTED", string(Redact(rules, []byte("auth: Bearer abc"))))
+}
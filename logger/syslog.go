@@ -0,0 +1,212 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/retry"
+)
+
+const (
+	LogSyslogFlag         = "log-syslog"
+	LogSyslogFacilityFlag = "log-syslog-facility"
+	LogJournaldFlag       = "log-journald"
+
+	syslogAppName      = "cloudflared"
+	syslogTimeFormat   = "2006-01-02T15:04:05.000000Z07:00"
+	syslogDialTimeout  = 5 * time.Second
+	syslogWriteTimeout = 5 * time.Second
+	syslogBufferSize   = 1024
+	// syslogMaxRetries caps the backoff between the dials of an unavailable syslog server to about a minute
+	syslogMaxRetries      = 6
+	defaultSyslogFacility = "daemon"
+)
+
+// localSyslogSockets are where the syslog daemons of the different platforms listen for the local messages.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverity maps the levels of zerolog to the severities of syslog, which journald also uses as priorities.
+func syslogSeverity(level zerolog.Level) int {
+	switch level {
+	case zerolog.PanicLevel:
+		return 1 // alert
+	case zerolog.FatalLevel:
+		return 2 // critical
+	case zerolog.ErrorLevel:
+		return 3 // error
+	case zerolog.WarnLevel:
+		return 4 // warning
+	case zerolog.InfoLevel, zerolog.NoLevel:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// syslogWriter sends the log events to a syslog server as RFC 5424 messages, whose MSG is the JSON event. The
+// events are queued and sent in the background, so that a slow or unavailable syslog server never blocks the
+// logging of cloudflared: the connection is only dialed on the first event, dialed again with a backoff after it
+// fails, and the events that don't fit in the queue meanwhile are dropped.
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	pid      int
+
+	messages chan []byte
+	dropped  atomic.Uint64
+
+	// conn and backoff are only used by the goroutine that sends the messages
+	conn    net.Conn
+	backoff retry.BackoffHandler
+}
+
+// newSyslogWriter creates a writer to the syslog server at address, which is udp://HOST:PORT, tcp://HOST:PORT,
+// unix:///PATH or local for the syslog daemon of the host.
+func newSyslogWriter(config SyslogConfig) (*syslogWriter, error) {
+	facility, ok := syslogFacilities[config.Facility]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a syslog facility", config.Facility)
+	}
+	network, address, err := parseSyslogAddress(config.Address)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	w := &syslogWriter{
+		network:  network,
+		address:  address,
+		facility: facility,
+		hostname: hostname,
+		pid:      os.Getpid(),
+		messages: make(chan []byte, syslogBufferSize),
+		backoff:  retry.NewBackoff(syslogMaxRetries, retry.DefaultBaseTime, true),
+	}
+	go w.run()
+	return w, nil
+}
+
+func parseSyslogAddress(address string) (string, string, error) {
+	if address == "local" {
+		for _, socket := range localSyslogSockets {
+			if _, err := os.Stat(socket); err == nil {
+				return "unixgram", socket, nil
+			}
+		}
+		return "", "", fmt.Errorf("there is no local syslog socket in %v", localSyslogSockets)
+	}
+	syslogURL, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("%s is not a syslog address: %w", address, err)
+	}
+	switch syslogURL.Scheme {
+	case "udp", "tcp":
+		if syslogURL.Port() == "" {
+			return "", "", fmt.Errorf("%s is not a syslog address, it has no port", address)
+		}
+		return syslogURL.Scheme, syslogURL.Host, nil
+	case "unix":
+		return "unixgram", syslogURL.Path, nil
+	default:
+		return "", "", fmt.Errorf("%s is not a syslog address, it must be udp://HOST:PORT, tcp://HOST:PORT, unix:///PATH or local", address)
+	}
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	var event struct {
+		Level string `json:"level"`
+	}
+	level := zerolog.NoLevel
+	if err := json.Unmarshal(p, &event); err == nil {
+		level, _ = zerolog.ParseLevel(event.Level)
+	}
+	message := w.format(level, time.Now(), bytes.TrimRight(p, "\n"))
+	select {
+	case w.messages <- message:
+	default:
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// run sends the queued messages in order. A message that can't be sent is retried after a backoff, while the
+// following events queue up, and the count of the events that were dropped is reported once syslog is back.
+func (w *syslogWriter) run() {
+	for message := range w.messages {
+		for w.send(message) != nil {
+			<-w.backoff.BackoffTimer()
+		}
+		w.backoff.ResetNow()
+		if dropped := w.dropped.Swap(0); dropped > 0 {
+			event := fmt.Sprintf(`{"level":"warn","message":"dropped %d log events while syslog at %s was unavailable"}`, dropped, w.address)
+			_ = w.send(w.format(zerolog.WarnLevel, time.Now(), []byte(event)))
+		}
+	}
+}
+
+func (w *syslogWriter) send(message []byte) error {
+	// The message is sent again once if the connection was broken
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			conn, err := net.DialTimeout(w.network, w.address, syslogDialTimeout)
+			if err != nil {
+				return err
+			}
+			w.conn = conn
+		}
+		_ = w.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err := w.conn.Write(message); err == nil {
+			return nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return fmt.Errorf("failed to send the log event to syslog at %s", w.address)
+}
+
+// format builds the RFC 5424 message of the event. Over TCP the message is framed by its length (RFC 6587).
+func (w *syslogWriter) format(level zerolog.Level, now time.Time, event []byte) []byte {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "<%d>1 %s %s %s %d - - ", w.facility*8+syslogSeverity(level), now.UTC().Format(syslogTimeFormat), w.hostname, syslogAppName, w.pid)
+	message.Write(event)
+	if w.network != "tcp" {
+		return message.Bytes()
+	}
+	return append([]byte(strconv.Itoa(message.Len())+" "), message.Bytes()...)
+}
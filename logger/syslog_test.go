@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogWriterUDP(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+
+	w, err := newSyslogWriter(SyslogConfig{Address: "udp://" + server.LocalAddr().String(), Facility: "local0"})
+	require.NoError(t, err)
+	log := zerolog.New(w)
+	log.Error().Uint8("connIndex", 1).Msg("origin is down")
+
+	buf := make([]byte, 1024)
+	n, _, err := server.ReadFrom(buf)
+	require.NoError(t, err)
+	// local0 is 16 and error is 3
+	assert.Regexp(t, regexp.MustCompile(`^<131>1 \S+Z \S+ cloudflared \d+ - - \{"level":"error","connIndex":1,"message":"origin is down"\}$`), string(buf[:n]))
+}
+
+func TestSyslogWriterTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	w, err := newSyslogWriter(SyslogConfig{Address: "tcp://" + listener.Addr().String(), Facility: "daemon"})
+	require.NoError(t, err)
+	log := zerolog.New(w)
+	log.Info().Msg("first")
+	log.Warn().Msg("second")
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{
+		`<30>1 \S+ \S+ cloudflared \d+ - - \{"level":"info","message":"first"\}`,
+		`<28>1 \S+ \S+ cloudflared \d+ - - \{"level":"warn","message":"second"\}`,
+	} {
+		// Each message is prefixed by its length
+		var length int
+		_, err := fmt.Fscanf(reader, "%d ", &length)
+		require.NoError(t, err)
+		message := make([]byte, length)
+		_, err = io.ReadFull(reader, message)
+		require.NoError(t, err)
+		assert.Regexp(t, "^"+expected+"$", string(message))
+	}
+}
+
+func TestSyslogWriterDoesNotBlock(t *testing.T) {
+	// Nothing listens on the address once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	w, err := newSyslogWriter(SyslogConfig{Address: "tcp://" + address, Facility: "daemon"})
+	require.NoError(t, err)
+	log := zerolog.New(w)
+	start := time.Now()
+	for i := 0; i < syslogBufferSize+10; i++ {
+		log.Info().Int("event", i).Msg("syslog is down")
+	}
+	assert.Less(t, time.Since(start), syslogDialTimeout)
+	// At most one event was taken from the queue by the sender, which is retrying it
+	assert.GreaterOrEqual(t, w.dropped.Load(), uint64(9))
+}
+
+func TestParseSyslogAddress(t *testing.T) {
+	network, address, err := parseSyslogAddress("unix:///var/run/syslog.sock")
+	require.NoError(t, err)
+	assert.Equal(t, "unixgram", network)
+	assert.Equal(t, "/var/run/syslog.sock", address)
+
+	for _, invalid := range []string{"syslog.example.com:514", "udp://syslog.example.com", "http://syslog.example.com:514"} {
+		_, _, err := parseSyslogAddress(invalid)
+		assert.Error(t, err, invalid)
+	}
+	_, err = newSyslogWriter(SyslogConfig{Address: "udp://127.0.0.1:514", Facility: "local9"})
+	assert.Error(t, err)
+}
@@ -55,6 +55,14 @@ type StreamingFilters struct {
 	Events   []LogEventType `json:"events,omitempty"`
 	Level    *LogLevel      `json:"level,omitempty"`
 	Sampling float64        `json:"sampling,omitempty"`
+	// Hostnames of the HTTP requests
+	Hostnames []string `json:"hostnames,omitempty"`
+	// StatusClasses of the origin responses, e.g. 5 for 5xx
+	StatusClasses []int `json:"status_classes,omitempty"`
+	// ConnIndexes of the edge connections
+	ConnIndexes []int `json:"conn_indexes,omitempty"`
+	// Message is a regular expression the messages must match
+	Message string `json:"message,omitempty"`
 }
 
 // EventStopStreaming signifies that the client wishes to halt receiving log events.
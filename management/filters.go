@@ -0,0 +1,107 @@
+package management
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// HostKey is the JSON key of the hostname of the request in the HTTP events
+	HostKey = "host"
+	// StatusKey is the JSON key of the status code of the origin response in the HTTP events
+	StatusKey = "status"
+	// ConnIndexKey is the JSON key of the index of the edge connection the event relates to
+	ConnIndexKey = "connIndex"
+)
+
+// FieldFilter matches the log events against the filters of StreamingFilters on the fields of the events. The
+// clients apply it again to the events they receive, as the connectors that predate these filters ignore them.
+type FieldFilter struct {
+	hostnames     []string
+	statusClasses []int
+	connIndexes   []int
+	message       *regexp.Regexp
+}
+
+// NewFieldFilter returns the FieldFilter of the filters, nil if they don't filter on any field.
+func NewFieldFilter(filters *StreamingFilters) (*FieldFilter, error) {
+	if filters == nil || (len(filters.Hostnames) == 0 && len(filters.StatusClasses) == 0 && len(filters.ConnIndexes) == 0 && filters.Message == "") {
+		return nil, nil
+	}
+	f := &FieldFilter{
+		statusClasses: filters.StatusClasses,
+		connIndexes:   filters.ConnIndexes,
+	}
+	for _, hostname := range filters.Hostnames {
+		f.hostnames = append(f.hostnames, strings.ToLower(hostname))
+	}
+	if filters.Message != "" {
+		message, err := regexp.Compile(filters.Message)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message filter %q: %w", filters.Message, err)
+		}
+		f.message = message
+	}
+	return f, nil
+}
+
+// Match returns true if the log event matches all the field filters. The events without the field of a filter
+// don't match it, e.g. only the HTTP responses match a status class.
+func (f *FieldFilter) Match(log *Log) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.hostnames) != 0 {
+		host, _ := log.Fields[HostKey].(string)
+		if !matchHostname(f.hostnames, host) {
+			return false
+		}
+	}
+	if len(f.statusClasses) != 0 {
+		status, ok := log.Fields[StatusKey].(float64)
+		if !ok || !containsInt(f.statusClasses, int(status)/100) {
+			return false
+		}
+	}
+	if len(f.connIndexes) != 0 {
+		connIndex, ok := log.Fields[ConnIndexKey].(float64)
+		if !ok || !containsInt(f.connIndexes, int(connIndex)) {
+			return false
+		}
+	}
+	if f.message != nil && !f.message.MatchString(log.Message) {
+		return false
+	}
+	return true
+}
+
+// matchHostname matches the host, without its port, against the hostnames, which can start with a *. wildcard.
+func matchHostname(hostnames []string, host string) bool {
+	if host == "" {
+		return false
+	}
+	host = strings.ToLower(host)
+	if i := strings.LastIndexByte(host, ':'); i != -1 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	for _, hostname := range hostnames {
+		if suffix, ok := strings.CutPrefix(hostname, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(array []int, value int) bool {
+	for _, v := range array {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package management
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldFilter(t *testing.T) {
+	response := &Log{
+		Event:   HTTP,
+		Message: "502 Bad Gateway",
+		Fields: map[string]interface{}{
+			HostKey:      "App.Example.com:443",
+			StatusKey:    float64(502),
+			ConnIndexKey: float64(2),
+		},
+	}
+	request := &Log{
+		Event:   HTTP,
+		Message: "GET https://app.example.com/ HTTP/1.1",
+		Fields: map[string]interface{}{
+			HostKey:      "app.example.com",
+			ConnIndexKey: float64(0),
+		},
+	}
+	for _, test := range []struct {
+		name          string
+		filters       StreamingFilters
+		matchResponse bool
+		matchRequest  bool
+	}{
+		{
+			name:          "hostname",
+			filters:       StreamingFilters{Hostnames: []string{"app.example.com"}},
+			matchResponse: true,
+			matchRequest:  true,
+		},
+		{
+			name:          "wildcard hostname",
+			filters:       StreamingFilters{Hostnames: []string{"*.example.com"}},
+			matchResponse: true,
+			matchRequest:  true,
+		},
+		{
+			name:    "other hostname",
+			filters: StreamingFilters{Hostnames: []string{"example.com"}},
+		},
+		{
+			name:          "status class",
+			filters:       StreamingFilters{StatusClasses: []int{4, 5}},
+			matchResponse: true,
+		},
+		{
+			name:    "other status class",
+			filters: StreamingFilters{StatusClasses: []int{2}},
+		},
+		{
+			name:         "connection index",
+			filters:      StreamingFilters{ConnIndexes: []int{0, 1}},
+			matchRequest: true,
+		},
+		{
+			name:         "message",
+			filters:      StreamingFilters{Message: "^GET "},
+			matchRequest: true,
+		},
+		{
+			name:          "all",
+			filters:       StreamingFilters{Hostnames: []string{"app.example.com"}, StatusClasses: []int{5}, ConnIndexes: []int{2}, Message: "Bad"},
+			matchResponse: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := NewFieldFilter(&test.filters)
+			require.NoError(t, err)
+			assert.Equal(t, test.matchResponse, filter.Match(response))
+			assert.Equal(t, test.matchRequest, filter.Match(request))
+		})
+	}
+}
+
+func TestFieldFilterNone(t *testing.T) {
+	filter, err := NewFieldFilter(&StreamingFilters{Events: []LogEventType{HTTP}})
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+	assert.True(t, filter.Match(&Log{}))
+}
+
+func TestFieldFilterInvalidMessage(t *testing.T) {
+	_, err := NewFieldFilter(&StreamingFilters{Message: "("})
+	require.Error(t, err)
+}
@@ -42,6 +42,16 @@ var (
 	})
 )
 
+// ConfigHistory encodes the remote configurations applied to the tunnel as JSON.
+type ConfigHistory interface {
+	MarshalJSON() ([]byte, error)
+}
+
+// Flows encodes the flows that are being proxied to origins as JSON.
+type Flows interface {
+	MarshalJSON() ([]byte, error)
+}
+
 type ManagementService struct {
 	// The management tunnel hostname
 	Hostname string
@@ -54,6 +64,11 @@ type ManagementService struct {
 	// Additional Handlers
 	metricsHandler http.Handler
 
+	// configHistory encodes the remote configurations applied to the tunnel
+	configHistory ConfigHistory
+	// flows encodes the flows that are being proxied to origins
+	flows Flows
+
 	log    *zerolog.Logger
 	router chi.Router
 
@@ -69,6 +84,8 @@ func New(managementHostname string,
 	serviceIP string,
 	clientID uuid.UUID,
 	label string,
+	configHistory ConfigHistory,
+	flows Flows,
 	log *zerolog.Logger,
 	logger LoggerListener,
 ) *ManagementService {
@@ -80,6 +97,8 @@ func New(managementHostname string,
 		clientID:       clientID,
 		label:          label,
 		metricsHandler: promhttp.Handler(),
+		configHistory:  configHistory,
+		flows:          flows,
 	}
 	r := chi.NewRouter()
 	r.Use(ValidateAccessTokenQueryMiddleware)
@@ -89,6 +108,9 @@ func New(managementHostname string,
 	r.With(corsHandler).Head("/ping", ping)
 	r.Get("/logs", s.logs)
 	r.With(corsHandler).Get("/host_details", s.getHostDetails)
+	if configHistory != nil {
+		r.With(corsHandler).Get("/config_history", s.getConfigHistory)
+	}
 
 	// Diagnostic management services
 	if enableDiagServices {
@@ -96,6 +118,10 @@ func New(managementHostname string,
 		r.With(corsHandler).Get("/metrics", s.metricsHandler.ServeHTTP)
 		// Supports only heap and goroutine
 		r.With(corsHandler).Get("/debug/pprof/{profile:heap|goroutine}", pprof.Index)
+		// The flows include the addresses of the eyeballs and origins, so they're only served as a diagnostic
+		if flows != nil {
+			r.With(corsHandler).Get("/flows", s.getFlows)
+		}
 	}
 
 	s.router = r
@@ -132,6 +158,32 @@ func (m *ManagementService) getHostDetails(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(getHostDetailsResponse)
 }
 
+// getConfigHistory responds with the remote configurations applied to the tunnel, from the oldest to the latest.
+func (m *ManagementService) getConfigHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := m.configHistory.MarshalJSON()
+	if err != nil {
+		m.log.Err(err).Msg("Failed to encode the configuration history")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_, _ = w.Write(history)
+}
+
+// getFlows responds with the flows that are being proxied to origins, ordered by start time.
+func (m *ManagementService) getFlows(w http.ResponseWriter, r *http.Request) {
+	flows, err := m.flows.MarshalJSON()
+	if err != nil {
+		m.log.Err(err).Msg("Failed to encode the flows")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_, _ = w.Write(flows)
+}
+
 func (m *ManagementService) getLabel() string {
 	if m.label != "" {
 		return fmt.Sprintf("custom:%s", m.label)
@@ -24,7 +24,7 @@ var (
 )
 
 func TestDisableDiagnosticRoutes(t *testing.T) {
-	mgmt := New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", &noopLogger, nil)
+	mgmt := New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", nil, nil, &noopLogger, nil)
 	for _, path := range []string{"/metrics", "/debug/pprof/goroutine", "/debug/pprof/heap"} {
 		t.Run(strings.Replace(path, "/", "_", -1), func(t *testing.T) {
 			req := httptest.NewRequest("GET", managementHostname+path+"?access_token="+validToken, nil)
@@ -36,6 +36,45 @@ func TestDisableDiagnosticRoutes(t *testing.T) {
 	}
 }
 
+type configHistoryMock string
+
+func (h configHistoryMock) MarshalJSON() ([]byte, error) {
+	return []byte(h), nil
+}
+
+func TestConfigHistoryRoute(t *testing.T) {
+	mgmt := New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", nil, nil, &noopLogger, nil)
+	req := httptest.NewRequest("GET", managementHostname+"/config_history?access_token="+validToken, nil)
+	recorder := httptest.NewRecorder()
+	mgmt.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Result().StatusCode)
+
+	mgmt = New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", configHistoryMock(`[{"version":1}]`), nil, &noopLogger, nil)
+	recorder = httptest.NewRecorder()
+	mgmt.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Result().StatusCode)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	require.Equal(t, `[{"version":1}]`, recorder.Body.String())
+}
+
+func TestFlowsRoute(t *testing.T) {
+	flows := configHistoryMock(`[{"id":"tcp-1"}]`)
+	req := httptest.NewRequest("GET", managementHostname+"/flows?access_token="+validToken, nil)
+
+	// The flows are only served with the diagnostic services
+	mgmt := New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", nil, flows, &noopLogger, nil)
+	recorder := httptest.NewRecorder()
+	mgmt.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Result().StatusCode)
+
+	mgmt = New("management.argotunnel.com", true, "1.1.1.1:80", uuid.Nil, "", nil, flows, &noopLogger, nil)
+	recorder = httptest.NewRecorder()
+	mgmt.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Result().StatusCode)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	require.Equal(t, `[{"id":"tcp-1"}]`, recorder.Body.String())
+}
+
 func TestReadEventsLoop(t *testing.T) {
 	sentEvent := EventStartStreaming{
 		ClientEvent: ClientEvent{Type: StartStreaming},
@@ -26,6 +26,8 @@ type session struct {
 	listener chan *Log
 	// Types of log events that this session will provide through the listener
 	filters *StreamingFilters
+	// Filters on the fields of the log events, nil if there are none
+	fieldFilter *FieldFilter
 	// Sampling of the log events this session will send (runs after all other filters if available)
 	sampler *sampler
 }
@@ -60,6 +62,9 @@ func (s *session) Filters(filters *StreamingFilters) {
 				p: int(sampling * 100),
 			}
 		}
+		// The field filters are ignored if the message filter is invalid, the client filters the events it
+		// receives again
+		s.fieldFilter, _ = NewFieldFilter(filters)
 	} else {
 		s.filters = &StreamingFilters{}
 	}
@@ -78,6 +83,10 @@ func (s *session) Insert(log *Log) {
 	if len(s.filters.Events) != 0 && !contains(s.filters.Events, log.Event) {
 		return
 	}
+	// Field filters are optional
+	if !s.fieldFilter.Match(log) {
+		return
+	}
 	// Sampling is also optional
 	if s.sampler != nil && !s.sampler.Sample() {
 		return
@@ -88,6 +88,20 @@ func TestSession_Insert(t *testing.T) {
 			},
 			expectLog: true,
 		},
+		{
+			name: "message",
+			filters: StreamingFilters{
+				Message: "^te",
+			},
+			expectLog: true,
+		},
+		{
+			name: "filtered out hostname",
+			filters: StreamingFilters{
+				Hostnames: []string{"app.example.com"},
+			},
+			expectLog: false,
+		},
 		{
 			name: "filter and event",
 			filters: StreamingFilters{
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Credentials are required by the metrics server to serve its endpoints, either as basic auth or as a bearer token.
+type Credentials struct {
+	Username    string
+	Password    string
+	BearerToken string
+}
+
+// authenticate requires the credentials on every endpoint but the liveness and readiness probes, as the probes of
+// orchestrators like Kubernetes can't send them.
+func (c *Credentials) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isProbe(r.URL.Path) || c.valid(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.Username != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cloudflared", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cloudflared"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func (c *Credentials) valid(r *http.Request) bool {
+	if c.BearerToken != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && equal(token, c.BearerToken) {
+			return true
+		}
+	}
+	if c.Username != "" {
+		if username, password, ok := r.BasicAuth(); ok && equal(username, c.Username) && equal(password, c.Password) {
+			return true
+		}
+	}
+	return false
+}
+
+func isProbe(urlPath string) bool {
+	switch urlPath {
+	case "/healthcheck", "/healthz", "/ready":
+		return true
+	}
+	matched, _ := path.Match("/tunnels/*/ready", urlPath)
+	return matched
+}
+
+// equal compares the hashes of the values so that the time it takes doesn't reveal their content or length.
+func equal(value, expected string) bool {
+	valueHash := sha256.Sum256([]byte(value))
+	expectedHash := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(valueHash[:], expectedHash[:]) == 1
+}
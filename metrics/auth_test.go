@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentials(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name           string
+		path           string
+		credentials    Credentials
+		setAuth        func(r *http.Request)
+		expectedStatus int
+	}{
+		{
+			name:           "missing credentials",
+			path:           "/metrics",
+			credentials:    Credentials{Username: "user", Password: "pass"},
+			setAuth:        func(r *http.Request) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "valid basic auth",
+			path:           "/metrics",
+			credentials:    Credentials{Username: "user", Password: "pass"},
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("user", "pass") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid password",
+			path:           "/metrics",
+			credentials:    Credentials{Username: "user", Password: "pass"},
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("user", "password") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "valid bearer token",
+			path:           "/metrics",
+			credentials:    Credentials{Username: "user", Password: "pass", BearerToken: "token"},
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid bearer token",
+			path:           "/metrics",
+			credentials:    Credentials{BearerToken: "token"},
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer other") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "empty username does not match basic auth without a username",
+			path:           "/metrics",
+			credentials:    Credentials{BearerToken: "token"},
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("", "") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "readiness probe without credentials",
+			path:           "/ready",
+			credentials:    Credentials{BearerToken: "token"},
+			setAuth:        func(r *http.Request) {},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "liveness probe without credentials",
+			path:           "/healthz",
+			credentials:    Credentials{BearerToken: "token"},
+			setAuth:        func(r *http.Request) {},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "readiness probe of a tunnel without credentials",
+			path:           "/tunnels/app/ready",
+			credentials:    Credentials{BearerToken: "token"},
+			setAuth:        func(r *http.Request) {},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "diagnostic of a tunnel without credentials",
+			path:           "/tunnels/app/diag/tunnel",
+			credentials:    Credentials{BearerToken: "token"},
+			setAuth:        func(r *http.Request) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			test.setAuth(req)
+			w := httptest.NewRecorder()
+			test.credentials.authenticate(ok).ServeHTTP(w, req)
+			assert.Equal(t, test.expectedStatus, w.Code)
+			if test.expectedStatus == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestServeMetricsTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	roots := x509.NewCertPool()
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots.AddCert(leaf)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error)
+	go func() {
+		errC <- ServeMetrics(listener, ctx, Config{
+			TLSConfig:   &tls.Config{Certificates: []tls.Certificate{cert}},
+			Credentials: &Credentials{BearerToken: "token"},
+		}, &log)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	req, err := http.NewRequest(http.MethodGet, "https://"+listener.Addr().String()+"/healthcheck", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "OK\n", string(body))
+
+	resp, err = http.Get("http://" + listener.Addr().String() + "/healthcheck")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "plain HTTP is not served")
+	client.CloseIdleConnections()
+	cancel()
+	assert.NoError(t, <-errC)
+}
@@ -2,10 +2,10 @@ package metrics
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
-	_ "net/http/pprof"
 	"runtime"
 	"sync"
 	"time"
@@ -57,10 +57,27 @@ type Config struct {
 	DiagnosticHandler   *diagnostic.Handler
 	QuickTunnelHostname string
 	Orchestrator        orchestrator
+	// Tunnels are the tunnels of a process running several of them, their endpoints are served under
+	// /tunnels/<name>/ and /ready reports whether all of them are connected
+	Tunnels []TunnelEndpoints
+	// TLSConfig, if not nil, serves the endpoints over TLS
+	TLSConfig *tls.Config
+	// Credentials, if not nil, are required to access the endpoints
+	Credentials *Credentials
+	// Pprof exposes all the profiles under /debug/pprof/, otherwise only the heap and goroutine profiles are
+	Pprof bool
 
 	ShutdownTimeout time.Duration
 }
 
+// TunnelEndpoints are the readiness, configuration and diagnostic endpoints of one of the tunnels of the process.
+type TunnelEndpoints struct {
+	Name              string
+	ReadyServer       *ReadyServer
+	DiagnosticHandler *diagnostic.Handler
+	Orchestrator      orchestrator
+}
+
 type orchestrator interface {
 	GetVersionedConfigJSON() ([]byte, error)
 }
@@ -70,35 +87,65 @@ func newMetricsHandler(
 	log *zerolog.Logger,
 ) *http.ServeMux {
 	router := http.NewServeMux()
-	router.Handle("/debug/", http.DefaultServeMux)
-	router.Handle("/metrics", promhttp.Handler())
+	// x/net/trace registers /debug/requests and /debug/events on the default mux
+	router.Handle("/debug/requests", http.DefaultServeMux)
+	router.Handle("/debug/events", http.DefaultServeMux)
+	installPprof(router, config.Pprof)
+	// OpenMetrics is negotiated so that the exemplars of the metrics are exposed to the scrapers supporting them
+	router.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	))
 	router.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = fmt.Fprintf(w, "OK\n")
 	})
+	// /healthz is the liveness of the process, unlike /ready it doesn't depend on the edge connections or the origins
+	router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "OK\n")
+	})
 	if config.ReadyServer != nil {
 		router.Handle("/ready", config.ReadyServer)
+	} else if len(config.Tunnels) > 0 {
+		router.Handle("/ready", allTunnelsReady(config.Tunnels))
 	}
 	router.HandleFunc("/quicktunnel", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = fmt.Fprintf(w, `{"hostname":"%s"}`, config.QuickTunnelHostname)
 	})
 	if config.Orchestrator != nil {
-		router.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
-			json, err := config.Orchestrator.GetVersionedConfigJSON()
-			if err != nil {
-				w.WriteHeader(500)
-				_, _ = fmt.Fprintf(w, "ERR: %v", err)
-				log.Err(err).Msg("Failed to serve config")
-				return
-			}
-			_, _ = w.Write(json)
-		})
+		router.HandleFunc("/config", configHandler(config.Orchestrator, log))
+	}
+
+	if config.DiagnosticHandler != nil {
+		config.DiagnosticHandler.InstallEndpoints(router)
 	}
 
-	config.DiagnosticHandler.InstallEndpoints(router)
+	for _, tunnel := range config.Tunnels {
+		tunnelRouter := http.NewServeMux()
+		tunnelRouter.Handle("/ready", tunnel.ReadyServer)
+		if tunnel.Orchestrator != nil {
+			tunnelRouter.HandleFunc("/config", configHandler(tunnel.Orchestrator, log))
+		}
+		tunnel.DiagnosticHandler.InstallEndpoints(tunnelRouter)
+		prefix := "/tunnels/" + tunnel.Name
+		router.Handle(prefix+"/", http.StripPrefix(prefix, tunnelRouter))
+	}
 
 	return router
 }
 
+func configHandler(orchestrator orchestrator, log *zerolog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json, err := orchestrator.GetVersionedConfigJSON()
+		if err != nil {
+			w.WriteHeader(500)
+			_, _ = fmt.Fprintf(w, "ERR: %v", err)
+			log.Err(err).Msg("Failed to serve config")
+			return
+		}
+		_, _ = w.Write(json)
+	}
+}
+
 // CreateMetricsListener will create a new [net.Listener] by using an
 // known set of ports when the default address is passed with the fallback
 // of choosing a random port when none is available.
@@ -144,9 +191,15 @@ func ServeMetrics(
 	var wg sync.WaitGroup
 	// Metrics port is privileged, so no need for further access control
 	trace.AuthRequest = func(*http.Request) (bool, bool) { return true, true }
-	// TODO: parameterize ReadTimeout and WriteTimeout. The maximum time we can
-	// profile CPU usage depends on WriteTimeout
-	h := newMetricsHandler(config, log)
+	// TODO: parameterize ReadTimeout and WriteTimeout. The CPU profiles and traces extend the WriteTimeout
+	// for their duration
+	var h http.Handler = newMetricsHandler(config, log)
+	if config.Credentials != nil {
+		h = config.Credentials.authenticate(h)
+	}
+	if config.TLSConfig != nil {
+		l = tls.NewListener(l, config.TLSConfig)
+	}
 	server := &http.Server{
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
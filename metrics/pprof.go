@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+const (
+	// mutexProfileFraction and blockProfileRate sample the contention of the mutexes and goroutines once pprof is
+	// enabled, they are not recorded at all otherwise
+	mutexProfileFraction = 10
+	blockProfileRate     = int(10 * time.Microsecond)
+
+	// profileWriteMargin is added to the duration of the CPU profiles and traces to write them out
+	profileWriteMargin = 10 * time.Second
+)
+
+// installPprof serves the heap and goroutine profiles that tunnel diag collects, and all the other profiles (CPU,
+// mutex, block, trace) if enabled.
+func installPprof(router *http.ServeMux, enabled bool) {
+	router.Handle("/debug/pprof/heap", pprof.Handler("heap"))
+	router.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
+	if !enabled {
+		return
+	}
+	runtime.SetMutexProfileFraction(mutexProfileFraction)
+	runtime.SetBlockProfileRate(blockProfileRate)
+	router.HandleFunc("/debug/pprof/", pprof.Index)
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", extendWriteTimeout(pprof.Profile, 30))
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", extendWriteTimeout(pprof.Trace, 1))
+}
+
+// extendWriteTimeout lets the handler write for the seconds of the request, which can be longer than the write
+// timeout of the metrics server.
+func extendWriteTimeout(handler http.HandlerFunc, defaultSeconds float64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seconds, err := strconv.ParseFloat(r.FormValue("seconds"), 64)
+		if err != nil || seconds <= 0 {
+			seconds = defaultSeconds
+		}
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Duration(seconds*float64(time.Second)) + profileWriteMargin))
+		// pprof refuses the profiles longer than the write timeout of the server it finds in the context
+		handler(w, r.WithContext(context.WithValue(r.Context(), http.ServerContextKey, &http.Server{})))
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPprofEndpoints(t *testing.T) {
+	log := zerolog.Nop()
+	tests := []struct {
+		path            string
+		expectedStatus  int
+		expectedEnabled int
+	}{
+		{path: "/debug/pprof/heap", expectedStatus: http.StatusOK, expectedEnabled: http.StatusOK},
+		{path: "/debug/pprof/goroutine", expectedStatus: http.StatusOK, expectedEnabled: http.StatusOK},
+		{path: "/debug/pprof/", expectedStatus: http.StatusNotFound, expectedEnabled: http.StatusOK},
+		{path: "/debug/pprof/mutex", expectedStatus: http.StatusNotFound, expectedEnabled: http.StatusOK},
+		{path: "/debug/pprof/block", expectedStatus: http.StatusNotFound, expectedEnabled: http.StatusOK},
+		{path: "/debug/pprof/cmdline", expectedStatus: http.StatusNotFound, expectedEnabled: http.StatusOK},
+		{path: "/debug/pprof/profile?seconds=1", expectedStatus: http.StatusNotFound, expectedEnabled: http.StatusOK},
+	}
+	for _, enabled := range []bool{false, true} {
+		router := newMetricsHandler(Config{Pprof: enabled}, &log)
+		for _, test := range tests {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if enabled {
+				assert.Equal(t, test.expectedEnabled, w.Code, test.path)
+			} else {
+				assert.Equal(t, test.expectedStatus, w.Code, test.path)
+			}
+		}
+	}
+}
+
+func TestExtendWriteTimeout(t *testing.T) {
+	var writeTimeout time.Duration
+	handler := extendWriteTimeout(func(w http.ResponseWriter, r *http.Request) {
+		server, ok := r.Context().Value(http.ServerContextKey).(*http.Server)
+		require.True(t, ok)
+		writeTimeout = server.WriteTimeout
+	}, 1)
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.WriteTimeout = 10 * time.Second
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?seconds=30")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Zero(t, writeTimeout)
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultPushInterval = 15 * time.Second
+	// lastPushTimeout bounds the push on shutdown
+	lastPushTimeout = 5 * time.Second
+)
+
+// PushConfig configures pushing the metrics, for the hosts whose metrics server can't be scraped, e.g. behind a NAT.
+type PushConfig struct {
+	// URL is the http(s) URL of a Prometheus remote_write endpoint, whose user info is sent as basic auth, or
+	// statsd://HOST:PORT or dogstatsd://HOST:PORT for a statsd server, dogstatsd supporting the labels as tags
+	URL string
+	// Interval between the pushes, 15s if zero
+	Interval time.Duration
+	// Labels are added to all the metrics, job and instance default to cloudflared and the hostname
+	Labels map[string]string
+	// UserAgent identifies cloudflared to the remote_write endpoint
+	UserAgent string
+}
+
+// pushSink sends the samples gathered at a point in time.
+type pushSink interface {
+	push(ctx context.Context, families []*dto.MetricFamily, now time.Time) error
+	close() error
+}
+
+// Pusher pushes the metrics of a gatherer periodically.
+type Pusher struct {
+	interval time.Duration
+	gatherer prometheus.Gatherer
+	sink     pushSink
+	log      *zerolog.Logger
+}
+
+func NewPusher(config PushConfig, gatherer prometheus.Gatherer, log *zerolog.Logger) (*Pusher, error) {
+	pushURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a metrics push URL: %w", config.URL, err)
+	}
+	labels := map[string]string{"job": "cloudflared"}
+	if hostname, err := os.Hostname(); err == nil {
+		labels["instance"] = hostname
+	}
+	for name, value := range config.Labels {
+		labels[name] = value
+	}
+	var sink pushSink
+	switch pushURL.Scheme {
+	case "http", "https":
+		sink = newRemoteWriteSink(pushURL, labels, config.UserAgent)
+	case "statsd", "dogstatsd":
+		if pushURL.Port() == "" {
+			return nil, fmt.Errorf("%s is not a metrics push URL, the statsd server has no port", config.URL)
+		}
+		if sink, err = newStatsdSink(pushURL.Host, labels, pushURL.Scheme == "dogstatsd"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a metrics push URL, it must be a http(s) remote_write URL, statsd://HOST:PORT or dogstatsd://HOST:PORT", config.URL)
+	}
+	interval := config.Interval
+	if interval <= 0 {
+		interval = defaultPushInterval
+	}
+	return &Pusher{interval: interval, gatherer: gatherer, sink: sink, log: log}, nil
+}
+
+// Run pushes the metrics at every interval until the context is cancelled, and a last time then so that the final
+// values of the counters aren't lost.
+func (p *Pusher) Run(ctx context.Context) {
+	defer p.sink.close()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	failing := false
+	for {
+		select {
+		case <-ctx.Done():
+			lastCtx, cancel := context.WithTimeout(context.Background(), lastPushTimeout)
+			_ = p.push(lastCtx)
+			cancel()
+			return
+		case <-ticker.C:
+		}
+		pushCtx, cancel := context.WithTimeout(ctx, p.interval)
+		err := p.push(pushCtx)
+		cancel()
+		// A failure is only reported once until the pushes succeed again
+		if err != nil && !failing {
+			p.log.Err(err).Msg("Failed to push the metrics")
+		} else if err == nil && failing {
+			p.log.Info().Msg("Pushing the metrics again")
+		}
+		failing = err != nil
+	}
+}
+
+func (p *Pusher) push(ctx context.Context) error {
+	families, err := p.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return err
+	}
+	return p.sink.push(ctx, families, time.Now())
+}
+
+// sample is a single value of a metric family, histograms and summaries having one sample per bucket or quantile
+// and for their sum and count like in the Prometheus exposition format.
+type sample struct {
+	name    string
+	labels  []*dto.LabelPair
+	value   float64
+	counter bool
+}
+
+func flatten(family *dto.MetricFamily) []sample {
+	name := family.GetName()
+	var samples []sample
+	for _, m := range family.GetMetric() {
+		labels := m.GetLabel()
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			samples = append(samples, sample{name: name, labels: labels, value: m.GetCounter().GetValue(), counter: true})
+		case dto.MetricType_GAUGE:
+			samples = append(samples, sample{name: name, labels: labels, value: m.GetGauge().GetValue()})
+		case dto.MetricType_UNTYPED:
+			samples = append(samples, sample{name: name, labels: labels, value: m.GetUntyped().GetValue()})
+		case dto.MetricType_HISTOGRAM:
+			histogram := m.GetHistogram()
+			for _, bucket := range histogram.GetBucket() {
+				samples = append(samples, sample{name: name + "_bucket", labels: withLabel(labels, "le", fmt.Sprint(bucket.GetUpperBound())), value: float64(bucket.GetCumulativeCount()), counter: true})
+			}
+			samples = append(samples,
+				sample{name: name + "_bucket", labels: withLabel(labels, "le", "+Inf"), value: float64(histogram.GetSampleCount()), counter: true},
+				sample{name: name + "_sum", labels: labels, value: histogram.GetSampleSum(), counter: true},
+				sample{name: name + "_count", labels: labels, value: float64(histogram.GetSampleCount()), counter: true},
+			)
+		case dto.MetricType_SUMMARY:
+			summary := m.GetSummary()
+			for _, quantile := range summary.GetQuantile() {
+				samples = append(samples, sample{name: name, labels: withLabel(labels, "quantile", fmt.Sprint(quantile.GetQuantile())), value: quantile.GetValue()})
+			}
+			samples = append(samples,
+				sample{name: name + "_sum", labels: labels, value: summary.GetSampleSum(), counter: true},
+				sample{name: name + "_count", labels: labels, value: float64(summary.GetSampleCount()), counter: true},
+			)
+		}
+	}
+	return samples
+}
+
+func withLabel(labels []*dto.LabelPair, name, value string) []*dto.LabelPair {
+	return append(append([]*dto.LabelPair{}, labels...), &dto.LabelPair{Name: &name, Value: &value})
+}
+
+// sortedLabels merges the labels of the sample with the labels added to all the metrics, which they override, and
+// sorts them by name.
+func sortedLabels(labels []*dto.LabelPair, common map[string]string) [][2]string {
+	merged := make(map[string]string, len(labels)+len(common))
+	for name, value := range common {
+		merged[name] = value
+	}
+	for _, label := range labels {
+		merged[label.GetName()] = label.GetValue()
+	}
+	sorted := make([][2]string, 0, len(merged))
+	for name, value := range merged {
+		sorted = append(sorted, [2]string{name, value})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.Compare(sorted[i][0], sorted[j][0]) < 0
+	})
+	return sorted
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func newPushRegistry(t *testing.T) (*prometheus.Registry, prometheus.Counter) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total", ConstLabels: prometheus.Labels{"tunnel": "web"}})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "connections"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{0.1, 1}})
+	registry.MustRegister(counter, gauge, histogram)
+	counter.Add(3)
+	gauge.Set(4)
+	histogram.Observe(0.5)
+	return registry, counter
+}
+
+// snappyDecode decodes the snappy blocks made of literals only.
+func snappyDecode(t *testing.T, encoded []byte) []byte {
+	length, n := binary.Uvarint(encoded)
+	require.Positive(t, n)
+	encoded = encoded[n:]
+	var decoded []byte
+	for len(encoded) > 0 {
+		tag := encoded[0]
+		require.Zero(t, tag&3, "only literals are expected")
+		literal := int(tag >> 2)
+		encoded = encoded[1:]
+		switch literal {
+		case 60:
+			literal, encoded = int(encoded[0]), encoded[1:]
+		case 61:
+			literal, encoded = int(binary.LittleEndian.Uint16(encoded)), encoded[2:]
+		}
+		decoded = append(decoded, encoded[:literal+1]...)
+		encoded = encoded[literal+1:]
+	}
+	require.Equal(t, int(length), len(decoded))
+	return decoded
+}
+
+// parseWriteRequest decodes the series of a WriteRequest as their labels formatted like name{label="value"} and
+// their values.
+func parseWriteRequest(t *testing.T, request []byte) map[string]float64 {
+	fields := func(message []byte, each func(num protowire.Number, typ protowire.Type, value []byte)) {
+		for len(message) > 0 {
+			num, typ, n := protowire.ConsumeTag(message)
+			require.Positive(t, n)
+			message = message[n:]
+			n = protowire.ConsumeFieldValue(num, typ, message)
+			require.Positive(t, n)
+			each(num, typ, message[:n])
+			message = message[n:]
+		}
+	}
+	series := make(map[string]float64)
+	fields(request, func(_ protowire.Number, _ protowire.Type, value []byte) {
+		ts, _ := protowire.ConsumeBytes(value)
+		var name string
+		var labels []string
+		var sample float64
+		fields(ts, func(num protowire.Number, _ protowire.Type, value []byte) {
+			message, _ := protowire.ConsumeBytes(value)
+			switch num {
+			case 1:
+				var label [2]string
+				fields(message, func(num protowire.Number, _ protowire.Type, value []byte) {
+					s, _ := protowire.ConsumeString(value)
+					label[num-1] = s
+				})
+				if label[0] == "__name__" {
+					name = label[1]
+				} else {
+					labels = append(labels, label[0]+"="+`"`+label[1]+`"`)
+				}
+			case 2:
+				fields(message, func(num protowire.Number, _ protowire.Type, value []byte) {
+					if num == 1 {
+						bits, _ := protowire.ConsumeFixed64(value)
+						sample = math.Float64frombits(bits)
+					}
+				})
+			}
+		})
+		sort.Strings(labels)
+		series[name+"{"+strings.Join(labels, ",")+"}"] = sample
+	})
+	return series
+}
+
+func TestPushRemoteWrite(t *testing.T) {
+	registry, _ := newPushRegistry(t)
+	requests := make(chan map[string]float64, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "pass", password)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests <- parseWriteRequest(t, snappyDecode(t, body))
+	}))
+	defer server.Close()
+
+	log := zerolog.Nop()
+	pusher, err := NewPusher(PushConfig{
+		URL:    strings.Replace(server.URL, "http://", "http://user:pass@", 1) + "/api/v1/write",
+		Labels: map[string]string{"instance": "host1"},
+	}, registry, &log)
+	require.NoError(t, err)
+	require.NoError(t, pusher.push(context.Background()))
+
+	series := <-requests
+	assert.Equal(t, 3.0, series[`requests_total{instance="host1",job="cloudflared",tunnel="web"}`])
+	assert.Equal(t, 4.0, series[`connections{instance="host1",job="cloudflared"}`])
+	assert.Equal(t, 0.0, series[`latency_seconds_bucket{instance="host1",job="cloudflared",le="0.1"}`])
+	assert.Equal(t, 1.0, series[`latency_seconds_bucket{instance="host1",job="cloudflared",le="+Inf"}`])
+	assert.Equal(t, 0.5, series[`latency_seconds_sum{instance="host1",job="cloudflared"}`])
+	assert.Len(t, series, 7)
+}
+
+func TestPushRemoteWriteError(t *testing.T) {
+	registry, _ := newPushRegistry(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "too many samples", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	log := zerolog.Nop()
+	pusher, err := NewPusher(PushConfig{URL: server.URL}, registry, &log)
+	require.NoError(t, err)
+	err = pusher.push(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "too many samples")
+}
+
+func TestPushStatsd(t *testing.T) {
+	for _, test := range []struct {
+		scheme   string
+		expected []string
+	}{
+		{
+			scheme: "statsd",
+			expected: []string{
+				"requests_total.web:3|c",
+				"connections:4|g",
+				"latency_seconds_count:1|c",
+			},
+		},
+		{
+			scheme: "dogstatsd",
+			expected: []string{
+				"requests_total:3|c|#instance:host1,job:cloudflared,tunnel:web",
+				"connections:4|g|#instance:host1,job:cloudflared",
+				"latency_seconds_bucket:1|c|#instance:host1,job:cloudflared,le:+Inf",
+			},
+		},
+	} {
+		t.Run(test.scheme, func(t *testing.T) {
+			registry, counter := newPushRegistry(t)
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer conn.Close()
+			read := func() []string {
+				buf := make([]byte, statsdMaxPacket)
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+				n, _, err := conn.ReadFrom(buf)
+				require.NoError(t, err)
+				return strings.Split(string(buf[:n]), "\n")
+			}
+
+			log := zerolog.Nop()
+			pusher, err := NewPusher(PushConfig{
+				URL:    test.scheme + "://" + conn.LocalAddr().String(),
+				Labels: map[string]string{"instance": "host1"},
+			}, registry, &log)
+			require.NoError(t, err)
+			defer pusher.sink.close()
+
+			require.NoError(t, pusher.push(context.Background()))
+			lines := read()
+			for _, line := range test.expected {
+				assert.Contains(t, lines, line)
+			}
+
+			// The counters are pushed as their increments, and not at all when they didn't change
+			counter.Add(2)
+			require.NoError(t, pusher.push(context.Background()))
+			lines = read()
+			assert.Contains(t, lines, strings.Replace(test.expected[0], ":3|", ":2|", 1))
+			assert.NotContains(t, lines, test.expected[2])
+		})
+	}
+}
+
+func TestStatsdLine(t *testing.T) {
+	label := func(name, value string) *dto.LabelPair {
+		return &dto.LabelPair{Name: &name, Value: &value}
+	}
+	sink := &statsdSink{dogstatsd: true, previous: make(map[string]float64)}
+	line := sink.line(sample{name: "requests_total", labels: []*dto.LabelPair{label("path", "/a,b|c:d")}, value: 1})
+	assert.Equal(t, "requests_total:1|g|#path:/a_b_c_d", line)
+
+	// The last tags of a line over the packet size are dropped
+	var labels []*dto.LabelPair
+	for i := 0; i < 100; i++ {
+		labels = append(labels, label(fmt.Sprintf("label%02d", i), strings.Repeat("v", 20)))
+	}
+	line = sink.line(sample{name: "requests_total", labels: labels, value: 1})
+	assert.LessOrEqual(t, len(line), statsdMaxPacket)
+	assert.Contains(t, line, "|#label00:")
+	assert.NotContains(t, line, "label99")
+
+	sink = &statsdSink{previous: make(map[string]float64)}
+	line = sink.line(sample{name: "requests_total", labels: []*dto.LabelPair{label("tunnel", "web.example.com:443")}, value: 1})
+	assert.Equal(t, "requests_total.web_example_com_443:1|g", line)
+}
+
+func TestNewPusherInvalidURL(t *testing.T) {
+	log := zerolog.Nop()
+	for _, pushURL := range []string{"ftp://example.com", "statsd://localhost", "://"} {
+		_, err := NewPusher(PushConfig{URL: pushURL}, prometheus.NewRegistry(), &log)
+		assert.Error(t, err, pushURL)
+	}
+}
@@ -1,46 +1,84 @@
 package metrics
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/cloudflare/cloudflared/tunnelstate"
 )
 
+const (
+	// originCheckInterval is how long the result of resolving the origins is reused, so that frequent readiness
+	// probes don't flood the DNS resolver
+	originCheckInterval = 10 * time.Second
+	originCheckTimeout  = 2 * time.Second
+)
+
 // ReadyServer serves HTTP 200 if the tunnel can serve traffic. Intended for k8s readiness checks.
 type ReadyServer struct {
-	clientID uuid.UUID
-	tracker  *tunnelstate.ConnTracker
+	clientID       uuid.UUID
+	tracker        *tunnelstate.ConnTracker
+	minConnections uint
+	origins        *originResolver
+}
+
+// ReadinessConfig are the conditions the tunnel must meet to be ready. The zero value requires one edge connection.
+type ReadinessConfig struct {
+	// MinConnections is the number of edge connections the tunnel needs to be ready
+	MinConnections uint
+	// Origins, if not nil, are the origins that must all be resolvable for the tunnel to be ready
+	Origins OriginHosts
+}
+
+// OriginHosts returns the hostnames of the origins of a tunnel.
+type OriginHosts interface {
+	OriginHosts() []string
 }
 
 // NewReadyServer initializes a ReadyServer and starts listening for dis/connection events.
 func NewReadyServer(
 	clientID uuid.UUID,
 	tracker *tunnelstate.ConnTracker,
+	config ReadinessConfig,
 ) *ReadyServer {
-	return &ReadyServer{
-		clientID,
-		tracker,
+	minConnections := config.MinConnections
+	if minConnections == 0 {
+		minConnections = 1
 	}
+	rs := &ReadyServer{
+		clientID:       clientID,
+		tracker:        tracker,
+		minConnections: minConnections,
+	}
+	if config.Origins != nil {
+		rs.origins = &originResolver{origins: config.Origins, lookupHost: net.DefaultResolver.LookupHost}
+	}
+	return rs
 }
 
 type body struct {
-	Status           int       `json:"status"`
-	ReadyConnections uint      `json:"readyConnections"`
-	ConnectorID      uuid.UUID `json:"connectorId"`
+	Status            int       `json:"status"`
+	ReadyConnections  uint      `json:"readyConnections"`
+	ConnectorID       uuid.UUID `json:"connectorId"`
+	UnresolvedOrigins []string  `json:"unresolvedOrigins,omitempty"`
 }
 
-// ServeHTTP responds with HTTP 200 if the tunnel is connected to the edge.
+// ServeHTTP responds with HTTP 200 if the tunnel has enough connections to the edge and its origins resolve.
 func (rs *ReadyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	statusCode, readyConnections := rs.makeResponse()
+	statusCode, readyConnections, unresolvedOrigins := rs.makeResponse()
 	w.WriteHeader(statusCode)
 	body := body{
-		Status:           statusCode,
-		ReadyConnections: readyConnections,
-		ConnectorID:      rs.clientID,
+		Status:            statusCode,
+		ReadyConnections:  readyConnections,
+		ConnectorID:       rs.clientID,
+		UnresolvedOrigins: unresolvedOrigins,
 	}
 	msg, err := json.Marshal(body)
 	if err != nil {
@@ -51,11 +89,88 @@ func (rs *ReadyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // This is the bulk of the logic for ServeHTTP, broken into its own pure function
 // to make unit testing easy.
-func (rs *ReadyServer) makeResponse() (statusCode int, readyConnections uint) {
+func (rs *ReadyServer) makeResponse() (statusCode int, readyConnections uint, unresolvedOrigins []string) {
 	readyConnections = rs.tracker.CountActiveConns()
-	if readyConnections > 0 {
-		return http.StatusOK, readyConnections
+	if rs.origins != nil {
+		unresolvedOrigins = rs.origins.unresolved()
+	}
+	if readyConnections >= rs.minConnections && len(unresolvedOrigins) == 0 {
+		return http.StatusOK, readyConnections, unresolvedOrigins
 	} else {
-		return http.StatusServiceUnavailable, readyConnections
+		return http.StatusServiceUnavailable, readyConnections, unresolvedOrigins
+	}
+}
+
+// originResolver resolves the hostnames of the origins, at most once per originCheckInterval.
+type originResolver struct {
+	origins    OriginHosts
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	lock            sync.Mutex
+	checkedAt       time.Time
+	unresolvedHosts []string
+}
+
+func (r *originResolver) unresolved() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.checkedAt.IsZero() && time.Since(r.checkedAt) < originCheckInterval {
+		return r.unresolvedHosts
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), originCheckTimeout)
+	defer cancel()
+	hosts := r.origins.OriginHosts()
+	resolved := make([]bool, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			addrs, err := r.lookupHost(ctx, host)
+			resolved[i] = err == nil && len(addrs) > 0
+		}(i, host)
+	}
+	wg.Wait()
+	r.unresolvedHosts = nil
+	for i, host := range hosts {
+		if !resolved[i] {
+			r.unresolvedHosts = append(r.unresolvedHosts, host)
+		}
+	}
+	r.checkedAt = time.Now()
+	return r.unresolvedHosts
+}
+
+type tunnelReadiness struct {
+	ReadyConnections  uint      `json:"readyConnections"`
+	ConnectorID       uuid.UUID `json:"connectorId"`
+	UnresolvedOrigins []string  `json:"unresolvedOrigins,omitempty"`
+}
+
+// allTunnelsReady responds with HTTP 200 if every tunnel of the process is ready.
+func allTunnelsReady(tunnels []TunnelEndpoints) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statusCode := http.StatusOK
+		readiness := make(map[string]tunnelReadiness, len(tunnels))
+		for _, tunnel := range tunnels {
+			tunnelStatus, readyConnections, unresolvedOrigins := tunnel.ReadyServer.makeResponse()
+			if tunnelStatus != http.StatusOK {
+				statusCode = tunnelStatus
+			}
+			readiness[tunnel.Name] = tunnelReadiness{
+				ReadyConnections:  readyConnections,
+				ConnectorID:       tunnel.ReadyServer.clientID,
+				UnresolvedOrigins: unresolvedOrigins,
+			}
+		}
+		w.WriteHeader(statusCode)
+		msg, err := json.Marshal(struct {
+			Status  int                        `json:"status"`
+			Tunnels map[string]tunnelReadiness `json:"tunnels"`
+		}{statusCode, readiness})
+		if err != nil {
+			_, _ = fmt.Fprintf(w, `{"error": "%s"}`, err)
+		}
+		_, _ = w.Write(msg)
 	}
 }
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+type staticOriginHosts []string
+
+func (h staticOriginHosts) OriginHosts() []string {
+	return h
+}
+
+func TestReadinessUnresolvedOrigins(t *testing.T) {
+	log := zerolog.Nop()
+	tracker := tunnelstate.NewConnTracker(&log)
+	tracker.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	rs := NewReadyServer(uuid.Nil, tracker, ReadinessConfig{Origins: staticOriginHosts{"app.internal", "db.internal"}})
+	var lookups atomic.Int32
+	resolvable := map[string]bool{"app.internal": true}
+	rs.origins.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups.Add(1)
+		if resolvable[host] {
+			return []string{"10.0.0.1"}, nil
+		}
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+
+	rec := httptest.NewRecorder()
+	rs.ServeHTTP(rec, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var response body
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, []string{"db.internal"}, response.UnresolvedOrigins)
+	assert.EqualValues(t, 1, response.ReadyConnections)
+
+	// The origins are only resolved again after the check interval
+	resolvable["db.internal"] = true
+	status, _, unresolved := rs.makeResponse()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, []string{"db.internal"}, unresolved)
+	assert.EqualValues(t, 2, lookups.Load())
+
+	rs.origins.checkedAt = rs.origins.checkedAt.Add(-originCheckInterval)
+	status, _, unresolved = rs.makeResponse()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, unresolved)
+}
@@ -1,10 +1,13 @@
 package metrics_test
 
 import (
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
@@ -12,6 +15,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/diagnostic"
 	"github.com/cloudflare/cloudflared/metrics"
 	"github.com/cloudflare/cloudflared/tunnelstate"
 )
@@ -36,7 +40,7 @@ func mockRequest(t *testing.T, readyServer *metrics.ReadyServer) (int, uint) {
 func TestReadinessEventHandling(t *testing.T) {
 	nopLogger := zerolog.Nop()
 	tracker := tunnelstate.NewConnTracker(&nopLogger)
-	rs := metrics.NewReadyServer(uuid.Nil, tracker)
+	rs := metrics.NewReadyServer(uuid.Nil, tracker, metrics.ReadinessConfig{})
 
 	// start not ok
 	code, readyConnections := mockRequest(t, rs)
@@ -104,3 +108,71 @@ func TestReadinessEventHandling(t *testing.T) {
 	assert.NotEqualValues(t, http.StatusOK, code)
 	assert.Zero(t, readyConnections)
 }
+
+func TestReadinessMinConnections(t *testing.T) {
+	nopLogger := zerolog.Nop()
+	tracker := tunnelstate.NewConnTracker(&nopLogger)
+	rs := metrics.NewReadyServer(uuid.Nil, tracker, metrics.ReadinessConfig{MinConnections: 2})
+
+	tracker.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	code, readyConnections := mockRequest(t, rs)
+	assert.EqualValues(t, http.StatusServiceUnavailable, code)
+	assert.EqualValues(t, 1, readyConnections)
+
+	tracker.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Connected})
+	code, readyConnections = mockRequest(t, rs)
+	assert.EqualValues(t, http.StatusOK, code)
+	assert.EqualValues(t, 2, readyConnections)
+}
+
+func TestReadinessOfSeveralTunnels(t *testing.T) {
+	nopLogger := zerolog.Nop()
+	webTracker := tunnelstate.NewConnTracker(&nopLogger)
+	sshTracker := tunnelstate.NewConnTracker(&nopLogger)
+	newEndpoints := func(name string, tracker *tunnelstate.ConnTracker) metrics.TunnelEndpoints {
+		return metrics.TunnelEndpoints{
+			Name:              name,
+			ReadyServer:       metrics.NewReadyServer(uuid.New(), tracker, metrics.ReadinessConfig{}),
+			DiagnosticHandler: diagnostic.NewDiagnosticHandler(&nopLogger, 0, nil, uuid.New(), uuid.New(), tracker, nil, map[string]string{}, nil, nil),
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = metrics.ServeMetrics(listener, ctx, metrics.Config{
+			Tunnels: []metrics.TunnelEndpoints{newEndpoints("web", webTracker), newEndpoints("ssh", sshTracker)},
+		}, &nopLogger)
+	}()
+
+	get := func(path string) int {
+		resp, err := http.Get("http://" + listener.Addr().String() + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/healthcheck")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	webTracker.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	assert.Equal(t, http.StatusOK, get("/tunnels/web/ready"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/tunnels/ssh/ready"))
+	// The process is ready once all of its tunnels are
+	assert.Equal(t, http.StatusServiceUnavailable, get("/ready"))
+
+	sshTracker.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	assert.Equal(t, http.StatusOK, get("/ready"))
+	assert.Equal(t, http.StatusNotFound, get("/tunnels/db/ready"))
+
+	// The liveness of the process doesn't depend on the tunnels
+	sshTracker.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Disconnected})
+	assert.Equal(t, http.StatusServiceUnavailable, get("/ready"))
+	assert.Equal(t, http.StatusOK, get("/healthz"))
+}
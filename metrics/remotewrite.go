@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	remoteWriteTimeout = 30 * time.Second
+	// snappyMaxLiteral is the longest literal of the snappy blocks that are sent
+	snappyMaxLiteral = 1 << 16
+)
+
+// remoteWriteSink sends the samples to a Prometheus remote_write endpoint, as a snappy compressed protobuf
+// WriteRequest.
+type remoteWriteSink struct {
+	url       string
+	username  string
+	password  string
+	labels    map[string]string
+	userAgent string
+	client    *http.Client
+}
+
+func newRemoteWriteSink(pushURL *url.URL, labels map[string]string, userAgent string) *remoteWriteSink {
+	sink := &remoteWriteSink{
+		labels:    labels,
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: remoteWriteTimeout},
+	}
+	if pushURL.User != nil {
+		sink.username = pushURL.User.Username()
+		sink.password, _ = pushURL.User.Password()
+		withoutUser := *pushURL
+		withoutUser.User = nil
+		pushURL = &withoutUser
+	}
+	sink.url = pushURL.String()
+	return sink
+}
+
+func (s *remoteWriteSink) push(ctx context.Context, families []*dto.MetricFamily, now time.Time) error {
+	body := snappyEncode(s.writeRequest(families, now))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.userAgent != "" {
+		req.Header.Set("User-Agent", s.userAgent)
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote_write endpoint responded with %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+func (s *remoteWriteSink) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// writeRequest encodes the samples as a prometheus.WriteRequest, which has a TimeSeries (field 1) per sample with
+// its Labels (field 1) and a single Sample (field 2).
+func (s *remoteWriteSink) writeRequest(families []*dto.MetricFamily, now time.Time) []byte {
+	timestamp := now.UnixMilli()
+	var request []byte
+	for _, family := range families {
+		for _, sample := range flatten(family) {
+			var series []byte
+			for _, label := range sortedLabels(withLabel(sample.labels, "__name__", sample.name), s.labels) {
+				var l []byte
+				l = protowire.AppendTag(l, 1, protowire.BytesType)
+				l = protowire.AppendString(l, label[0])
+				l = protowire.AppendTag(l, 2, protowire.BytesType)
+				l = protowire.AppendString(l, label[1])
+				series = protowire.AppendTag(series, 1, protowire.BytesType)
+				series = protowire.AppendBytes(series, l)
+			}
+			var value []byte
+			value = protowire.AppendTag(value, 1, protowire.Fixed64Type)
+			value = protowire.AppendFixed64(value, math.Float64bits(sample.value))
+			value = protowire.AppendTag(value, 2, protowire.VarintType)
+			value = protowire.AppendVarint(value, uint64(timestamp))
+			series = protowire.AppendTag(series, 2, protowire.BytesType)
+			series = protowire.AppendBytes(series, value)
+
+			request = protowire.AppendTag(request, 1, protowire.BytesType)
+			request = protowire.AppendBytes(request, series)
+		}
+	}
+	return request
+}
+
+// snappyEncode encodes the data as a snappy block made of literals only. Receivers decode it like any snappy block,
+// it is only larger than a compressed one, which matters little for the size of the metrics of cloudflared.
+func snappyEncode(data []byte) []byte {
+	encoded := binary.AppendUvarint(make([]byte, 0, len(data)+len(data)/snappyMaxLiteral*5+15), uint64(len(data)))
+	for len(data) > 0 {
+		literal := data
+		if len(literal) > snappyMaxLiteral {
+			literal = literal[:snappyMaxLiteral]
+		}
+		data = data[len(literal):]
+		n := len(literal) - 1
+		switch {
+		case n < 60:
+			encoded = append(encoded, byte(n)<<2)
+		case n < 1<<8:
+			encoded = append(encoded, 60<<2, byte(n))
+		default:
+			encoded = append(encoded, 61<<2, byte(n), byte(n>>8))
+		}
+		encoded = append(encoded, literal...)
+	}
+	return encoded
+}
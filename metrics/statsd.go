@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// statsdMaxPacket keeps the datagrams within the MTU of most networks.
+const statsdMaxPacket = 1432
+
+// statsdSink sends the samples to a statsd server over UDP. The counters are sent as the increments since the
+// previous push. Dogstatsd receives the labels as tags, statsd as the last components of the metric names.
+type statsdSink struct {
+	conn      net.Conn
+	labels    map[string]string
+	dogstatsd bool
+	previous  map[string]float64
+}
+
+func newStatsdSink(address string, labels map[string]string, dogstatsd bool) (*statsdSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the statsd server at %s: %w", address, err)
+	}
+	return &statsdSink{conn: conn, labels: labels, dogstatsd: dogstatsd, previous: make(map[string]float64)}, nil
+}
+
+func (s *statsdSink) push(ctx context.Context, families []*dto.MetricFamily, now time.Time) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+	var packet []byte
+	tooLong := 0
+	for _, family := range families {
+		for _, sample := range flatten(family) {
+			line := s.line(sample)
+			if line == "" {
+				continue
+			}
+			if len(line) > statsdMaxPacket {
+				tooLong++
+				continue
+			}
+			if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacket {
+				if _, err := s.conn.Write(packet); err != nil {
+					return err
+				}
+				packet = packet[:0]
+			}
+			if len(packet) > 0 {
+				packet = append(packet, '\n')
+			}
+			packet = append(packet, line...)
+		}
+	}
+	if len(packet) > 0 {
+		if _, err := s.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	if tooLong > 0 {
+		return fmt.Errorf("dropped %d samples with names longer than the statsd packet size", tooLong)
+	}
+	return nil
+}
+
+// line formats the sample, it returns an empty line for a counter that didn't change. The last tags of a dogstatsd
+// line over the packet size are dropped, a line is never split across datagrams.
+func (s *statsdSink) line(sample sample) string {
+	labels := sortedLabels(sample.labels, s.labels)
+	var name strings.Builder
+	name.WriteString(statsdName(sample.name))
+	if !s.dogstatsd {
+		for _, label := range labels {
+			if label[0] == "job" || label[0] == "instance" {
+				// statsd identifies the sender itself
+				continue
+			}
+			name.WriteByte('.')
+			name.WriteString(statsdName(label[1]))
+		}
+	}
+	var tags []string
+	if s.dogstatsd {
+		for _, label := range labels {
+			tags = append(tags, dogstatsdTag(label[0])+":"+dogstatsdTag(label[1]))
+		}
+	}
+
+	value, kind := sample.value, "g"
+	if sample.counter {
+		key := name.String() + "|#" + strings.Join(tags, ",")
+		value = sample.value - s.previous[key]
+		s.previous[key] = sample.value
+		kind = "c"
+		if value == 0 {
+			return ""
+		}
+		if value < 0 {
+			// The counter was reset
+			value = sample.value
+		}
+	}
+	line := name.String() + ":" + strconv.FormatFloat(value, 'g', -1, 64) + "|" + kind
+	for len(tags) > 0 && len(line)+len("|#")+len(strings.Join(tags, ",")) > statsdMaxPacket {
+		tags = tags[:len(tags)-1]
+	}
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// statsdName replaces the characters that statsd treats as separators.
+func statsdName(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', ' ', '.', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// dogstatsdTag replaces the characters that separate the tags, their name and value, and the fields of a line.
+func dogstatsdTag(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', ':', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+func (s *statsdSink) close() error {
+	return s.conn.Close()
+}
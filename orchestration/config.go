@@ -2,10 +2,16 @@ package orchestration
 
 import (
 	"encoding/json"
+	"net/netip"
 	"time"
 
+	"github.com/cloudflare/cloudflared/accesslog"
 	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/overload"
+	"github.com/cloudflare/cloudflared/tlsconfig"
+	"github.com/cloudflare/cloudflared/tracing"
 )
 
 type newRemoteConfig struct {
@@ -23,12 +29,39 @@ type Config struct {
 	Ingress      *ingress.Ingress
 	WarpRouting  ingress.WarpRoutingConfig
 	WriteTimeout time.Duration
+	// Flows tracks the TCP flows proxied for WARP routing
+	Flows *flow.Table
+	// ICMPRouter, if not nil, is updated with the routes that have ICMP disabled in WarpRouting
+	ICMPRouter ingress.ICMPRouterServer
+	// VirtualNetworkRoutes, if not nil, looks up the routes to the tunnel in the virtual networks that have ICMP
+	// disabled in WarpRouting
+	VirtualNetworkRoutes func(vnets []string) ([]netip.Prefix, error)
+	// Reloads, if not nil, is told when the orchestrator starts and finishes applying a remote configuration
+	Reloads ReloadObserver
+	// Traces, if not nil, exports the spans of the proxied HTTP requests
+	Traces *tracing.OTLPExporter
+	// AccessLog, if not nil, is written a line per proxied HTTP request
+	AccessLog *accesslog.Logger
+	// History, if not nil, retains the remote configurations applied
+	History *ConfigHistory
+	// RequestIDHeader, if not empty, is the header the ID of each proxied HTTP request is propagated to the origin in
+	RequestIDHeader string
+	// Limiter, if not nil, caps the requests and flows proxied at once across configuration updates
+	Limiter *overload.Limiter
+	// CryptoPolicy, if not nil, restricts the TLS connections to the origins across configuration updates
+	CryptoPolicy *tlsconfig.CryptoPolicy
 
 	// Extra settings used to configure this instance but that are not eligible for remotely management
 	// ie. (--protocol, --loglevel, ...)
 	ConfigurationFlags map[string]string
 }
 
+// ReloadObserver is notified around the updates of the configuration, e.g. to report them to the event hooks.
+type ReloadObserver interface {
+	Reloading(version int32)
+	Reloaded(version int32)
+}
+
 func (rc *newLocalConfig) MarshalJSON() ([]byte, error) {
 	var r = struct {
 		ConfigurationFlags map[string]string `json:"__configuration_flags,omitempty"`
@@ -0,0 +1,127 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+// ConfigHistory retains the latest remote configurations applied by an orchestrator, to audit them. A nil
+// ConfigHistory retains nothing.
+type ConfigHistory struct {
+	lock    sync.Mutex
+	size    int
+	applied []AppliedConfig
+}
+
+// AppliedConfig is a remote configuration that was applied, with the changes it made to the ingress.
+type AppliedConfig struct {
+	Version   int32       `json:"version"`
+	AppliedAt time.Time   `json:"appliedAt"`
+	Ingress   IngressDiff `json:"ingress"`
+	// WarpRoutingChanged is whether the configuration changed the settings of WARP routing
+	WarpRoutingChanged bool `json:"warpRoutingChanged"`
+}
+
+// IngressDiff is the ingress rules added, removed and changed by a configuration. The rules are identified by their
+// hostname and path.
+type IngressDiff struct {
+	Added   []IngressRuleChange `json:"added,omitempty"`
+	Removed []IngressRuleChange `json:"removed,omitempty"`
+	Changed []IngressRuleChange `json:"changed,omitempty"`
+}
+
+// IngressRuleChange is an ingress rule that was added, removed or changed.
+type IngressRuleChange struct {
+	Hostname string `json:"hostname,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Service  string `json:"service"`
+	// PreviousService is the service of a changed rule before the change, if it changed
+	PreviousService string `json:"previousService,omitempty"`
+}
+
+// NewConfigHistory returns a history retaining the last size configurations applied.
+func NewConfigHistory(size int) *ConfigHistory {
+	return &ConfigHistory{size: size}
+}
+
+func (h *ConfigHistory) record(applied AppliedConfig) {
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.applied = append(h.applied, applied)
+	if len(h.applied) > h.size {
+		h.applied = h.applied[len(h.applied)-h.size:]
+	}
+}
+
+// Applied returns the configurations retained, from the oldest to the latest applied.
+func (h *ConfigHistory) Applied() []AppliedConfig {
+	if h == nil {
+		return nil
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	applied := make([]AppliedConfig, len(h.applied))
+	copy(applied, h.applied)
+	return applied
+}
+
+// MarshalJSON encodes the configurations retained, so that the history can be served without depending on this
+// package.
+func (h *ConfigHistory) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Applied())
+}
+
+type ingressRuleKey struct {
+	hostname string
+	path     string
+}
+
+func ruleKey(rule *ingress.Rule) ingressRuleKey {
+	key := ingressRuleKey{hostname: rule.Hostname}
+	if rule.Path != nil {
+		key.path = rule.Path.String()
+	}
+	return key
+}
+
+// diffIngress returns the rules of next that aren't in previous, those of previous that aren't in next, and those
+// of both with a different service or origin request configuration.
+func diffIngress(previous, next []ingress.Rule) IngressDiff {
+	var diff IngressDiff
+	previousRules := make(map[ingressRuleKey]*ingress.Rule, len(previous))
+	for i := range previous {
+		previousRules[ruleKey(&previous[i])] = &previous[i]
+	}
+	nextKeys := make(map[ingressRuleKey]struct{}, len(next))
+	for i := range next {
+		rule := &next[i]
+		key := ruleKey(rule)
+		nextKeys[key] = struct{}{}
+		change := IngressRuleChange{Hostname: key.hostname, Path: key.path, Service: rule.Service.String()}
+		previousRule, ok := previousRules[key]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, change)
+		case previousRule.Service.String() != change.Service:
+			change.PreviousService = previousRule.Service.String()
+			diff.Changed = append(diff.Changed, change)
+		case !reflect.DeepEqual(previousRule.Config, rule.Config):
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for i := range previous {
+		rule := &previous[i]
+		key := ruleKey(rule)
+		if _, ok := nextKeys[key]; !ok {
+			diff.Removed = append(diff.Removed, IngressRuleChange{Hostname: key.hostname, Path: key.path, Service: rule.Service.String()})
+		}
+	}
+	return diff
+}
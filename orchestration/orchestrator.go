@@ -4,8 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -78,6 +83,10 @@ func (o *Orchestrator) UpdateConfig(version int32, config []byte) *pogs.UpdateCo
 			LastAppliedVersion: o.currentVersion,
 		}
 	}
+	if o.config.Reloads != nil {
+		o.config.Reloads.Reloading(version)
+		defer o.config.Reloads.Reloaded(version)
+	}
 	var newConf newRemoteConfig
 	if err := json.Unmarshal(config, &newConf); err != nil {
 		o.log.Err(err).
@@ -90,6 +99,8 @@ func (o *Orchestrator) UpdateConfig(version int32, config []byte) *pogs.UpdateCo
 		}
 	}
 
+	previousIngress := o.config.Ingress.Rules
+	previousWarpRouting := o.config.WarpRouting.RawConfig()
 	if err := o.updateIngress(newConf.Ingress, newConf.WarpRouting); err != nil {
 		o.log.Err(err).
 			Int32("version", version).
@@ -101,10 +112,21 @@ func (o *Orchestrator) UpdateConfig(version int32, config []byte) *pogs.UpdateCo
 		}
 	}
 	o.currentVersion = version
+	applied := AppliedConfig{
+		Version:            version,
+		AppliedAt:          time.Now(),
+		Ingress:            diffIngress(previousIngress, o.config.Ingress.Rules),
+		WarpRoutingChanged: !reflect.DeepEqual(previousWarpRouting, o.config.WarpRouting.RawConfig()),
+	}
+	o.config.History.record(applied)
 
 	o.log.Info().
 		Int32("version", version).
 		Str("config", string(config)).
+		Int("ingress_rules_added", len(applied.Ingress.Added)).
+		Int("ingress_rules_removed", len(applied.Ingress.Removed)).
+		Int("ingress_rules_changed", len(applied.Ingress.Changed)).
+		Bool("warp_routing_changed", applied.WarpRoutingChanged).
 		Msg("Updated to new configuration")
 	configVersion.Set(float64(version))
 	return &pogs.UpdateConfigurationResponse{
@@ -122,6 +144,7 @@ func (o *Orchestrator) updateIngress(ingressRules ingress.Ingress, warpRouting i
 
 	// Assign the internal ingress rules to the parsed ingress
 	ingressRules.InternalRules = o.internalRules
+	ingressRules.CryptoPolicy = o.config.CryptoPolicy
 
 	// Check if ingress rules are empty, and add the default route if so.
 	if ingressRules.IsEmpty() {
@@ -136,10 +159,13 @@ func (o *Orchestrator) updateIngress(ingressRules ingress.Ingress, warpRouting i
 	if err := ingressRules.StartOrigins(o.log, proxyShutdownC); err != nil {
 		return errors.Wrap(err, "failed to start origin")
 	}
-	proxy := proxy.NewOriginProxy(ingressRules, warpRouting, o.tags, o.config.WriteTimeout, o.log)
+	proxy := proxy.NewOriginProxy(ingressRules, warpRouting, o.tags, o.config.WriteTimeout, o.config.Flows, o.config.Traces, o.config.AccessLog, o.config.RequestIDHeader, o.config.Limiter, o.log)
 	o.proxy.Store(proxy)
 	o.config.Ingress = &ingressRules
 	o.config.WarpRouting = warpRouting
+	if o.config.ICMPRouter != nil {
+		o.config.ICMPRouter.SetDisabledRoutes(o.icmpDisabledRoutes(warpRouting))
+	}
 
 	// If proxyShutdownC is nil, there is no previous running proxy
 	if o.proxyShutdownC != nil {
@@ -149,6 +175,28 @@ func (o *Orchestrator) updateIngress(ingressRules ingress.Ingress, warpRouting i
 	return nil
 }
 
+// icmpDisabledRoutes returns the routes that ICMP is disabled for, including the routes of the virtual networks that
+// it is disabled for. ICMP is disabled for all the routes if those can't be looked up, rather than let it through to
+// the networks that should be unreachable.
+func (o *Orchestrator) icmpDisabledRoutes(warpRouting ingress.WarpRoutingConfig) []netip.Prefix {
+	routes := warpRouting.DisableICMP
+	if len(warpRouting.DisableICMPVirtualNetworks) == 0 {
+		return routes
+	}
+	var (
+		vnetRoutes []netip.Prefix
+		err        = errors.New("the routes of the virtual networks can't be looked up")
+	)
+	if o.config.VirtualNetworkRoutes != nil {
+		vnetRoutes, err = o.config.VirtualNetworkRoutes(warpRouting.DisableICMPVirtualNetworks)
+	}
+	if err != nil {
+		o.log.Err(err).Strs("virtualNetworks", warpRouting.DisableICMPVirtualNetworks).Msg("ICMP is disabled for all the routes, the routes of the virtual networks it is disabled for couldn't be found")
+		return []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+	}
+	return append(append([]netip.Prefix{}, routes...), vnetRoutes...)
+}
+
 // GetConfigJSON returns the current json serialization of the config as the edge understands it
 func (o *Orchestrator) GetConfigJSON() ([]byte, error) {
 	o.lock.RLock()
@@ -191,6 +239,42 @@ func (o *Orchestrator) GetVersionedConfigJSON() ([]byte, error) {
 	return json.Marshal(currentConfiguration)
 }
 
+// ConfigVersion returns the version of the applied configuration, -1 until a remote configuration is applied.
+func (o *Orchestrator) ConfigVersion() int32 {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return o.currentVersion
+}
+
+// OriginHosts returns the hostnames of the origins of the current ingress rules, which are resolved to reach them.
+func (o *Orchestrator) OriginHosts() []string {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, rule := range o.config.Ingress.Rules {
+		serviceURL, err := url.Parse(rule.Service.String())
+		if err != nil {
+			continue
+		}
+		host := serviceURL.Hostname()
+		if host == "" || net.ParseIP(host) != nil || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// MaxRequestHeaderBytes returns the largest request header limit of the current ingress rules, 0 if a rule doesn't
+// limit the header size.
+func (o *Orchestrator) MaxRequestHeaderBytes() int {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return o.config.Ingress.MaxRequestHeaderBytes()
+}
+
 // GetOriginProxy returns an interface to proxy to origin. It satisfies connection.ConfigManager interface
 func (o *Orchestrator) GetOriginProxy() (connection.OriginProxy, error) {
 	val := o.proxy.Load()
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"sync"
 	"testing"
 	"time"
@@ -15,6 +16,7 @@ import (
 	"github.com/gobwas/ws/wsutil"
 	"github.com/google/uuid"
 	gows "github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 
@@ -50,7 +52,7 @@ func TestUpdateConfiguration(t *testing.T) {
 	initConfig := &Config{
 		Ingress: &ingress.Ingress{},
 	}
-	orchestrator, err := NewOrchestrator(context.Background(), initConfig, testTags, []ingress.Rule{ingress.NewManagementRule(management.New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", &testLogger, nil))}, &testLogger)
+	orchestrator, err := NewOrchestrator(context.Background(), initConfig, testTags, []ingress.Rule{ingress.NewManagementRule(management.New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", nil, nil, &testLogger, nil))}, &testLogger)
 	require.NoError(t, err)
 	initOriginProxy, err := orchestrator.GetOriginProxy()
 	require.NoError(t, err)
@@ -222,6 +224,26 @@ func TestUpdateConfiguration_WithoutIngressRule(t *testing.T) {
 	require.Len(t, orchestrator.config.Ingress.Rules, 1)
 }
 
+func TestOriginHosts(t *testing.T) {
+	initConfig := &Config{
+		Ingress: &ingress.Ingress{},
+	}
+	orchestrator, err := NewOrchestrator(context.Background(), initConfig, testTags, []ingress.Rule{}, &testLogger)
+	require.NoError(t, err)
+
+	configBytes := []byte(`{
+	"ingress": [
+		{"hostname": "app.example.com", "service": "http://app.internal:8080"},
+		{"hostname": "api.example.com", "service": "https://app.internal"},
+		{"hostname": "ssh.example.com", "service": "ssh://10.0.0.5:22"},
+		{"hostname": "db.example.com", "service": "tcp://db.internal:5432"},
+		{"service": "http_status:404"}
+	]
+}`)
+	updateWithValidation(t, orchestrator, 1, configBytes)
+	require.Equal(t, []string{"app.internal", "db.internal"}, orchestrator.OriginHosts())
+}
+
 // TestConcurrentUpdateAndRead makes sure orchestrator can receive updates and return origin proxy concurrently
 func TestConcurrentUpdateAndRead(t *testing.T) {
 	const (
@@ -482,6 +504,65 @@ func (vhh *validateHostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 	w.Write([]byte(vhh.body))
 }
 
+func TestUpdateConfigurationHistory(t *testing.T) {
+	initConfig := &Config{
+		Ingress: &ingress.Ingress{},
+		History: NewConfigHistory(2),
+	}
+	orchestrator, err := NewOrchestrator(context.Background(), initConfig, testTags, nil, &testLogger)
+	require.NoError(t, err)
+
+	updateWithValidation(t, orchestrator, 1, []byte(`
+{
+	"ingress": [
+		{"hostname": "app.tunnel.org", "service": "http://127.0.0.1:8080"},
+		{"hostname": "api.tunnel.org", "service": "http://127.0.0.1:8081"},
+		{"service": "http_status:404"}
+	]
+}`))
+	updateWithValidation(t, orchestrator, 2, []byte(`
+{
+	"ingress": [
+		{"hostname": "app.tunnel.org", "service": "http://127.0.0.1:9090"},
+		{"hostname": "new.tunnel.org", "service": "http://127.0.0.1:8082"},
+		{"service": "http_status:404"}
+	],
+	"warp-routing": {"connectTimeout": 10}
+}`))
+	updateWithValidation(t, orchestrator, 3, []byte(`
+{
+	"ingress": [
+		{"hostname": "app.tunnel.org", "service": "http://127.0.0.1:9090", "originRequest": {"noTLSVerify": true}},
+		{"hostname": "new.tunnel.org", "service": "http://127.0.0.1:8082"},
+		{"service": "http_status:404"}
+	],
+	"warp-routing": {"connectTimeout": 10}
+}`))
+
+	applied := initConfig.History.Applied()
+	require.Len(t, applied, 2, "only the last configurations are retained")
+	require.Equal(t, int32(2), applied[0].Version)
+	require.False(t, applied[0].AppliedAt.IsZero())
+	require.Equal(t, IngressDiff{
+		Added:   []IngressRuleChange{{Hostname: "new.tunnel.org", Service: "http://127.0.0.1:8082"}},
+		Removed: []IngressRuleChange{{Hostname: "api.tunnel.org", Service: "http://127.0.0.1:8081"}},
+		Changed: []IngressRuleChange{{Hostname: "app.tunnel.org", Service: "http://127.0.0.1:9090", PreviousService: "http://127.0.0.1:8080"}},
+	}, applied[0].Ingress)
+	require.True(t, applied[0].WarpRoutingChanged)
+
+	require.Equal(t, int32(3), applied[1].Version)
+	require.Equal(t, IngressDiff{
+		Changed: []IngressRuleChange{{Hostname: "app.tunnel.org", Service: "http://127.0.0.1:9090"}},
+	}, applied[1].Ingress)
+	require.False(t, applied[1].WarpRoutingChanged)
+
+	encoded, err := json.Marshal(initConfig.History)
+	require.NoError(t, err)
+	var decoded []AppliedConfig
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	require.Len(t, decoded, 2)
+}
+
 func updateWithValidation(t *testing.T, orchestrator *Orchestrator, version int32, config []byte) {
 	resp := orchestrator.UpdateConfig(version, config)
 	require.NoError(t, resp.Err)
@@ -762,3 +843,27 @@ func (rrw *respReadWriteFlusher) WriteHeader(statusCode int) {
 		close(rrw.hasStatus)
 	})
 }
+
+func TestICMPDisabledRoutes(t *testing.T) {
+	cidr := netip.MustParsePrefix("10.1.0.0/16")
+	staging := netip.MustParsePrefix("10.2.0.0/16")
+	warpRouting := ingress.WarpRoutingConfig{DisableICMP: []netip.Prefix{cidr}}
+	orchestrator := &Orchestrator{config: &Config{}, log: &testLogger}
+	require.Equal(t, []netip.Prefix{cidr}, orchestrator.icmpDisabledRoutes(warpRouting))
+
+	warpRouting.DisableICMPVirtualNetworks = []string{"staging"}
+	orchestrator.config.VirtualNetworkRoutes = func(vnets []string) ([]netip.Prefix, error) {
+		require.Equal(t, []string{"staging"}, vnets)
+		return []netip.Prefix{staging}, nil
+	}
+	require.Equal(t, []netip.Prefix{cidr, staging}, orchestrator.icmpDisabledRoutes(warpRouting))
+
+	// ICMP is disabled everywhere rather than let it through to the virtual network
+	all := []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+	orchestrator.config.VirtualNetworkRoutes = func([]string) ([]netip.Prefix, error) {
+		return nil, errors.New("no origin certificate")
+	}
+	require.Equal(t, all, orchestrator.icmpDisabledRoutes(warpRouting))
+	orchestrator.config.VirtualNetworkRoutes = nil
+	require.Equal(t, all, orchestrator.icmpDisabledRoutes(warpRouting))
+}
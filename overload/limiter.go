@@ -0,0 +1,114 @@
+// Package overload caps how many requests and flows are proxied at once, queueing a bounded number of them and
+// shedding the rest, so that a spike of traffic is answered with errors instead of exhausting the memory of cloudflared.
+package overload
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	shedQueueFull    = "queue_full"
+	shedQueueTimeout = "queue_timeout"
+)
+
+// ErrOverloaded is returned when a request or flow is shed because cloudflared is proxying too many of them.
+var ErrOverloaded = errors.New("cloudflared is proxying too many requests and flows, try again later")
+
+var (
+	inFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cloudflared",
+		Subsystem: "overload",
+		Name:      "in_flight",
+		Help:      "Number of requests and flows being proxied under the concurrency limit",
+	})
+	queued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cloudflared",
+		Subsystem: "overload",
+		Name:      "queued",
+		Help:      "Number of requests and flows waiting for the concurrency limit",
+	})
+	shed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cloudflared",
+		Subsystem: "overload",
+		Name:      "shed_total",
+		Help:      "Total count of requests and flows shed over the concurrency limit, by whether the queue was full or they waited too long",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(inFlight, queued, shed)
+}
+
+// Limiter lets up to a maximum of requests and flows be proxied at once. When they are all taken, up to maxQueued
+// wait for one to end for at most queueTimeout. A nil Limiter doesn't limit anything.
+type Limiter struct {
+	slots        chan struct{}
+	maxQueued    int64
+	queueTimeout time.Duration
+	queued       atomic.Int64
+}
+
+// NewLimiter returns a Limiter of maxInFlight requests and flows, or nil if maxInFlight isn't positive.
+func NewLimiter(maxInFlight, maxQueued int, queueTimeout time.Duration) *Limiter {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	return &Limiter{
+		slots:        make(chan struct{}, maxInFlight),
+		maxQueued:    int64(maxQueued),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire takes a slot for a request or flow, waiting in the queue if they are all taken. The returned function
+// gives it back once the request or flow ends. It returns ErrOverloaded when the queue is full or the wait is over
+// queueTimeout, and the error of ctx if it's done first.
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueued {
+		l.queued.Add(-1)
+		shed.WithLabelValues(shedQueueFull).Inc()
+		return nil, ErrOverloaded
+	}
+	queued.Inc()
+	defer func() {
+		l.queued.Add(-1)
+		queued.Dec()
+	}()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	case <-timer.C:
+		shed.WithLabelValues(shedQueueTimeout).Inc()
+		return nil, ErrOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *Limiter) acquired() func() {
+	inFlight.Inc()
+	var released atomic.Bool
+	return func() {
+		if released.CompareAndSwap(false, true) {
+			<-l.slots
+			inFlight.Dec()
+		}
+	}
+}
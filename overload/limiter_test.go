@@ -0,0 +1,83 @@
+package overload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilLimiter(t *testing.T) {
+	limiter := NewLimiter(0, 10, time.Second)
+	require.Nil(t, limiter)
+	for i := 0; i < 10; i++ {
+		release, err := limiter.Acquire(context.Background())
+		require.NoError(t, err)
+		defer release()
+	}
+}
+
+func TestLimiterQueueFull(t *testing.T) {
+	limiter := NewLimiter(1, 0, time.Second)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	_, err = limiter.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrOverloaded)
+
+	release()
+	release, err = limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	limiter := NewLimiter(1, 1, 10*time.Millisecond)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	_, err = limiter.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrOverloaded)
+	assert.Zero(t, limiter.queued.Load())
+}
+
+func TestLimiterQueued(t *testing.T) {
+	limiter := NewLimiter(1, 1, time.Minute)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	acquired := make(chan error)
+	go func() {
+		release, err := limiter.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	require.Eventually(t, func() bool { return limiter.queued.Load() == 1 }, time.Second, time.Millisecond)
+
+	// The queue of 1 is full
+	_, err = limiter.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrOverloaded)
+
+	// Releasing twice gives the slot back once
+	release()
+	release()
+	require.NoError(t, <-acquired)
+	assert.Empty(t, limiter.slots)
+}
+
+func TestLimiterContextDone(t *testing.T) {
+	limiter := NewLimiter(1, 1, time.Minute)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = limiter.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
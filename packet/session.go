@@ -5,4 +5,7 @@ import "github.com/google/uuid"
 type Session struct {
 	ID      uuid.UUID
 	Payload []byte
+	// DSCP is the differentiated services code point of the eyeball packet, it's only set when Marked is.
+	DSCP   uint8
+	Marked bool
 }
@@ -0,0 +1,76 @@
+package tunnel
+
+import (
+	"net"
+
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+// EventType is the type of a lifecycle event of a connection to the edge.
+type EventType int
+
+const (
+	// Connected means the connection to the edge was established, and it's proxying requests.
+	Connected EventType = iota
+	// Disconnected means the connection to the edge was broken.
+	Disconnected
+	// Reconnecting means the connection to the edge is being re-established.
+	Reconnecting
+	// Unregistering means the connection stops accepting new requests, as the tunnel is stopping.
+	Unregistering
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Connected:
+		return "connected"
+	case Disconnected:
+		return "disconnected"
+	case Reconnecting:
+		return "reconnecting"
+	case Unregistering:
+		return "unregistering"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a lifecycle event of a connection of the tunnel to the edge.
+type Event struct {
+	Type EventType
+	// ConnIndex is the index of the connection among the HA connections of the tunnel
+	ConnIndex uint8
+	// Location is the edge location the connection is connected to, set for Connected events
+	Location string
+	// Protocol is the transport protocol of the connection, set for Connected events
+	Protocol string
+	// EdgeAddress is the address of the edge the connection is connected to, set for Connected events
+	EdgeAddress net.IP
+}
+
+// newEvent returns the Event of a connection event, and false for the events that are not exposed.
+func newEvent(event connection.Event) (Event, bool) {
+	var eventType EventType
+	switch event.EventType {
+	case connection.Connected:
+		eventType = Connected
+	case connection.Disconnected:
+		eventType = Disconnected
+	case connection.Reconnecting:
+		eventType = Reconnecting
+	case connection.Unregistering:
+		eventType = Unregistering
+	default:
+		return Event{}, false
+	}
+	e := Event{
+		Type:        eventType,
+		ConnIndex:   event.Index,
+		Location:    event.Location,
+		EdgeAddress: event.EdgeAddress,
+	}
+	if eventType == Connected {
+		e.Protocol = event.Protocol.String()
+	}
+	return e, true
+}
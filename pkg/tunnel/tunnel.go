@@ -0,0 +1,371 @@
+// Package tunnel runs a Cloudflare Tunnel inside a Go program, proxying the requests to http.Handlers and
+// net.Listeners of the program as well as to the origin services cloudflared can reach.
+//
+// The ingress rules of the tunnel are registered with Handle, Listen and Route before it's started. The tunnel must
+// be locally managed: a configuration managed from the dashboard would replace these rules.
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/edgediscovery"
+	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
+	"github.com/cloudflare/cloudflared/features"
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/orchestration"
+	quicpogs "github.com/cloudflare/cloudflared/quic"
+	"github.com/cloudflare/cloudflared/signal"
+	"github.com/cloudflare/cloudflared/supervisor"
+	"github.com/cloudflare/cloudflared/tlsconfig"
+	"github.com/cloudflare/cloudflared/tunnelrpc/pogs"
+)
+
+const (
+	defaultVersion = "DEV"
+)
+
+var (
+	// ErrStarted is returned when the tunnel is started twice, or when a rule is registered once it's started.
+	ErrStarted = errors.New("tunnel already started")
+	// ErrNotStarted is returned when the tunnel is stopped or waited for before it's started.
+	ErrNotStarted = errors.New("tunnel not started")
+)
+
+// Credentials authenticate the connections of a tunnel to the edge.
+type Credentials struct {
+	AccountTag   string
+	TunnelSecret []byte
+	TunnelID     uuid.UUID
+}
+
+// ParseToken returns the credentials in a tunnel token, as shown in the dashboard or by `cloudflared tunnel token`.
+func ParseToken(token string) (Credentials, error) {
+	content, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "invalid tunnel token")
+	}
+	var tunnelToken connection.TunnelToken
+	if err := json.Unmarshal(content, &tunnelToken); err != nil {
+		return Credentials{}, errors.Wrap(err, "invalid tunnel token")
+	}
+	return Credentials{
+		AccountTag:   tunnelToken.AccountTag,
+		TunnelSecret: tunnelToken.TunnelSecret,
+		TunnelID:     tunnelToken.TunnelID,
+	}, nil
+}
+
+// Config configures a Tunnel. Only the Credentials are required.
+type Config struct {
+	Credentials Credentials
+	// HAConnections is the number of connections to the edge, 4 by default
+	HAConnections int
+	// Protocol is the transport protocol of the connections to the edge: quic, http2, or auto by default
+	Protocol string
+	// Region, if not empty, restricts the edge addresses to the region, e.g. "us"
+	Region string
+	// GracePeriod is how long Stop waits for the in-progress requests, 30 seconds by default
+	GracePeriod time.Duration
+	// Version is the version the connector reports to the edge, DEV by default
+	Version string
+	// Logger logs the events of the tunnel, nothing is logged by default
+	Logger *zerolog.Logger
+	// OnEvent, if not nil, is called with the lifecycle events of the connections to the edge
+	OnEvent func(Event)
+}
+
+// Tunnel is a tunnel run in process. Its rules are registered before it is started, and it can only be started once.
+type Tunnel struct {
+	config Config
+
+	lock           sync.Mutex
+	rules          []ingress.Rule
+	listeners      []*ingress.Listener
+	started        bool
+	connected      chan struct{}
+	graceShutdownC chan struct{}
+	stopOnce       sync.Once
+	done           chan struct{}
+	err            error
+}
+
+// New returns a Tunnel of the config, with the defaults for the fields left empty.
+func New(config Config) (*Tunnel, error) {
+	if config.Credentials.AccountTag == "" || len(config.Credentials.TunnelSecret) == 0 || config.Credentials.TunnelID == uuid.Nil {
+		return nil, errors.New("the account tag, secret and ID of the tunnel are required")
+	}
+	if config.HAConnections <= 0 {
+		config.HAConnections = supervisor.DefaultHAConnections
+	}
+	if config.Protocol == "" {
+		config.Protocol = connection.AutoSelectFlag
+	}
+	if config.GracePeriod == 0 {
+		config.GracePeriod = supervisor.DefaultGracePeriod
+	}
+	if config.GracePeriod > connection.MaxGracePeriod {
+		return nil, fmt.Errorf("the grace period must be equal or less than %v", connection.MaxGracePeriod)
+	}
+	if config.Version == "" {
+		config.Version = defaultVersion
+	}
+	if config.Logger == nil {
+		nop := zerolog.Nop()
+		config.Logger = &nop
+	}
+	return &Tunnel{
+		config:         config,
+		connected:      make(chan struct{}),
+		graceShutdownC: make(chan struct{}),
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// Handle serves the requests to hostname with handler.
+func (t *Tunnel) Handle(hostname string, handler http.Handler) error {
+	rule, err := ingress.NewHandlerRule(hostname, handler)
+	if err != nil {
+		return err
+	}
+	return t.addRule(rule)
+}
+
+// Listen returns a listener accepting the connections over which the requests to hostname are proxied, e.g. to serve
+// them with a http.Server. The listener is closed when the tunnel stops.
+func (t *Tunnel) Listen(hostname string) (net.Listener, error) {
+	listener := ingress.NewListener(hostname)
+	rule, err := ingress.NewListenerRule(hostname, listener)
+	if err != nil {
+		return nil, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.started {
+		return nil, ErrStarted
+	}
+	t.rules = append(t.rules, rule)
+	t.listeners = append(t.listeners, listener)
+	return listener, nil
+}
+
+// Route proxies the requests to hostname to service, as an ingress rule of the configuration file would, e.g.
+// http://localhost:8080 or unix:/run/app.sock.
+func (t *Tunnel) Route(hostname, service string) error {
+	if hostname == "" || hostname == "*" {
+		return fmt.Errorf("hostname %q would catch all the requests", hostname)
+	}
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: hostname, Service: service},
+			{Service: "http_status:404"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return t.addRule(ing.Rules[0])
+}
+
+func (t *Tunnel) addRule(rule ingress.Rule) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.started {
+		return ErrStarted
+	}
+	t.rules = append(t.rules, rule)
+	return nil
+}
+
+// buildIngress returns the rules registered, followed by a rule responding 404 to the other requests.
+func (t *Tunnel) buildIngress() (ingress.Ingress, error) {
+	catchAll, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{{Service: "http_status:404"}},
+	})
+	if err != nil {
+		return ingress.Ingress{}, err
+	}
+	catchAll.Rules = append(append([]ingress.Rule{}, t.rules...), catchAll.Rules...)
+	return catchAll, nil
+}
+
+// Start connects the tunnel to the edge in the background. It returns once the tunnel is set up, without waiting for
+// its connections: use Connected for that. The tunnel runs until Stop is called or ctx is done. If the set up fails,
+// the tunnel is stopped with the error.
+func (t *Tunnel) Start(ctx context.Context) error {
+	t.lock.Lock()
+	if t.started {
+		t.lock.Unlock()
+		return ErrStarted
+	}
+	// The rules can't change once started, so the set up, which looks up the edge in the DNS, runs without the lock
+	t.started = true
+	t.lock.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	tunnelConfig, orchestrator, err := t.prepare(ctx)
+	if err != nil {
+		cancel()
+		t.closeListeners()
+		t.err = err
+		close(t.done)
+		return err
+	}
+
+	go func() {
+		defer close(t.done)
+		defer cancel()
+		defer t.closeListeners()
+		reconnectCh := make(chan supervisor.ReconnectSignal, t.config.HAConnections)
+		t.err = supervisor.StartTunnelDaemon(ctx, tunnelConfig, orchestrator, signal.New(t.connected), reconnectCh, t.graceShutdownC)
+	}()
+	return nil
+}
+
+func (t *Tunnel) prepare(ctx context.Context) (*supervisor.TunnelConfig, *orchestration.Orchestrator, error) {
+	log := t.config.Logger
+	clientID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't generate connector UUID")
+	}
+	credentials := connection.Credentials{
+		AccountTag:   t.config.Credentials.AccountTag,
+		TunnelSecret: t.config.Credentials.TunnelSecret,
+		TunnelID:     t.config.Credentials.TunnelID,
+	}
+	osArch := fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH)
+	namedTunnel := &connection.TunnelProperties{
+		Credentials: credentials,
+		Client: pogs.ClientInfo{
+			ClientID: clientID[:],
+			Features: features.Dedup(features.DefaultFeatures),
+			Version:  t.config.Version,
+			Arch:     osArch,
+		},
+	}
+
+	featureSelector, err := features.NewFeatureSelector(ctx, credentials.AccountTag, features.StaticFeatures{}, log)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to create feature selector")
+	}
+	protocolSelector, err := connection.NewProtocolSelector(t.config.Protocol, credentials.AccountTag, true, false, edgediscovery.ProtocolPercentage, connection.ResolveTTL, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	edgeTLSConfigs, err := supervisor.NewEdgeTLSConfigs(func(serverName string) (*tls.Config, error) {
+		return tlsconfig.NewTunnelConfig(nil, serverName)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	observer := connection.NewObserver(log, log)
+	if t.config.OnEvent != nil {
+		observer.RegisterSink(connection.EventSinkFunc(func(event connection.Event) {
+			if e, ok := newEvent(event); ok {
+				t.config.OnEvent(e)
+			}
+		}))
+	}
+
+	tags := []pogs.Tag{{Name: "ID", Value: clientID.String()}}
+	tunnelConfig := &supervisor.TunnelConfig{
+		GracePeriod:                         t.config.GracePeriod,
+		OSArch:                              osArch,
+		ClientID:                            clientID.String(),
+		Region:                              t.config.Region,
+		EdgeIPVersion:                       allregions.Auto,
+		HAConnections:                       t.config.HAConnections,
+		Tags:                                tags,
+		Log:                                 log,
+		LogTransport:                        log,
+		Observer:                            observer,
+		ReportedVersion:                     t.config.Version,
+		Retries:                             supervisor.DefaultRetries,
+		MaxEdgeAddrRetries:                  supervisor.DefaultMaxEdgeAddrRetries,
+		NamedTunnel:                         namedTunnel,
+		ProtocolSelector:                    protocolSelector,
+		EdgeTLSConfigs:                      edgeTLSConfigs,
+		FeatureSelector:                     featureSelector,
+		RPCTimeout:                          supervisor.DefaultRPCTimeout,
+		QUICConnectionLevelFlowControlLimit: supervisor.DefaultQUICConnectionLevelFlowControlLimit,
+		QUICStreamLevelFlowControlLimit:     supervisor.DefaultQUICStreamLevelFlowControlLimit,
+		Flows:                               flow.NewTable(),
+	}
+	tunnelConfig.Flows.SetEdgeRTT(func(connIndex uint8) (time.Duration, bool) {
+		return quicpogs.SmoothedRTT(namedTunnel.Credentials.TunnelID, connIndex)
+	})
+
+	ingressRules, err := t.buildIngress()
+	if err != nil {
+		return nil, nil, err
+	}
+	warpRoutingConfig, err := ingress.NewWarpRoutingConfig(&config.WarpRoutingConfig{})
+	if err != nil {
+		return nil, nil, err
+	}
+	orchestratorConfig := &orchestration.Config{
+		Ingress:            &ingressRules,
+		WarpRouting:        warpRoutingConfig,
+		ConfigurationFlags: map[string]string{},
+		Flows:              tunnelConfig.Flows,
+	}
+	orchestrator, err := orchestration.NewOrchestrator(ctx, orchestratorConfig, tags, nil, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tunnelConfig, orchestrator, nil
+}
+
+func (t *Tunnel) closeListeners() {
+	for _, listener := range t.listeners {
+		_ = listener.Close()
+	}
+}
+
+// Connected is closed once the tunnel has a connection to the edge.
+func (t *Tunnel) Connected() <-chan struct{} {
+	return t.connected
+}
+
+// Stop stops the tunnel gracefully: its connections stop accepting new requests, and the requests in progress get
+// until the grace period to complete. It returns once the tunnel is stopped, with the error that stopped it if any.
+func (t *Tunnel) Stop() error {
+	t.lock.Lock()
+	started := t.started
+	t.lock.Unlock()
+	if !started {
+		return ErrNotStarted
+	}
+	t.stopOnce.Do(func() {
+		close(t.graceShutdownC)
+	})
+	return t.Wait()
+}
+
+// Wait waits for the tunnel to stop, and returns the error that stopped it if any.
+func (t *Tunnel) Wait() error {
+	t.lock.Lock()
+	started := t.started
+	t.lock.Unlock()
+	if !started {
+		return ErrNotStarted
+	}
+	<-t.done
+	return t.err
+}
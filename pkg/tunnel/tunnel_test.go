@@ -0,0 +1,147 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/supervisor"
+)
+
+var testCredentials = Credentials{
+	AccountTag:   "account",
+	TunnelSecret: []byte("secret"),
+	TunnelID:     uuid.New(),
+}
+
+func TestParseToken(t *testing.T) {
+	token, err := connection.TunnelToken{
+		AccountTag:   testCredentials.AccountTag,
+		TunnelSecret: testCredentials.TunnelSecret,
+		TunnelID:     testCredentials.TunnelID,
+	}.Encode()
+	require.NoError(t, err)
+
+	credentials, err := ParseToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, testCredentials, credentials)
+
+	_, err = ParseToken("not a token")
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+
+	tunnel, err := New(Config{Credentials: testCredentials})
+	require.NoError(t, err)
+	assert.Equal(t, supervisor.DefaultHAConnections, tunnel.config.HAConnections)
+	assert.Equal(t, connection.AutoSelectFlag, tunnel.config.Protocol)
+	assert.Equal(t, supervisor.DefaultGracePeriod, tunnel.config.GracePeriod)
+	assert.Equal(t, defaultVersion, tunnel.config.Version)
+	assert.NotNil(t, tunnel.config.Logger)
+
+	_, err = New(Config{Credentials: testCredentials, GracePeriod: connection.MaxGracePeriod + 1})
+	assert.Error(t, err)
+}
+
+func TestRules(t *testing.T) {
+	tunnel, err := New(Config{Credentials: testCredentials})
+	require.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, tunnel.Handle("handler.example.com", handler))
+	listener, err := tunnel.Listen("listener.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "listener.example.com", listener.Addr().String())
+	require.NoError(t, tunnel.Route("*.example.com", "http://localhost:8080"))
+
+	assert.Error(t, tunnel.Handle("", handler))
+	_, err = tunnel.Listen("listener.example.com:443")
+	assert.Error(t, err)
+	assert.Error(t, tunnel.Route("*", "http://localhost:8080"))
+	assert.Error(t, tunnel.Route("route.example.com", "http://localhost:8080/path"))
+
+	ing, err := tunnel.buildIngress()
+	require.NoError(t, err)
+	tests := []struct {
+		hostname string
+		service  string
+	}{
+		{hostname: "handler.example.com", service: "handler:handler.example.com"},
+		{hostname: "listener.example.com", service: "listener:listener.example.com"},
+		{hostname: "other.example.com", service: "http://localhost:8080"},
+		{hostname: "example.org", service: "http_status:404"},
+	}
+	for _, test := range tests {
+		rule, _ := ing.FindMatchingRule(test.hostname, "/")
+		assert.Equal(t, test.service, rule.Service.String(), test.hostname)
+	}
+
+	tunnel.closeListeners()
+	_, err = listener.Accept()
+	assert.Error(t, err)
+}
+
+func TestNotStarted(t *testing.T) {
+	tunnel, err := New(Config{Credentials: testCredentials})
+	require.NoError(t, err)
+	assert.ErrorIs(t, tunnel.Stop(), ErrNotStarted)
+	assert.ErrorIs(t, tunnel.Wait(), ErrNotStarted)
+
+	// Once started, no rule can be registered
+	tunnel.started = true
+	assert.ErrorIs(t, tunnel.Handle("handler.example.com", http.NotFoundHandler()), ErrStarted)
+	_, err = tunnel.Listen("listener.example.com")
+	assert.ErrorIs(t, err, ErrStarted)
+	assert.ErrorIs(t, tunnel.Route("route.example.com", "http://localhost:8080"), ErrStarted)
+}
+
+func TestStartFailure(t *testing.T) {
+	tunnel, err := New(Config{Credentials: testCredentials, Protocol: "bogus"})
+	require.NoError(t, err)
+	listener, err := tunnel.Listen("listener.example.com")
+	require.NoError(t, err)
+
+	// A tunnel that failed to set up is stopped with the error
+	err = tunnel.Start(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, err, tunnel.Wait())
+	assert.Equal(t, err, tunnel.Stop())
+	assert.ErrorIs(t, tunnel.Start(context.Background()), ErrStarted)
+	_, err = listener.Accept()
+	assert.Error(t, err)
+}
+
+func TestNewEvent(t *testing.T) {
+	edgeAddress := net.ParseIP("198.41.200.13")
+	event, ok := newEvent(connection.Event{
+		Index:       1,
+		EventType:   connection.Connected,
+		Location:    "lhr01",
+		Protocol:    connection.QUIC,
+		EdgeAddress: edgeAddress,
+	})
+	require.True(t, ok)
+	assert.Equal(t, Event{
+		Type:        Connected,
+		ConnIndex:   1,
+		Location:    "lhr01",
+		Protocol:    "quic",
+		EdgeAddress: edgeAddress,
+	}, event)
+
+	event, ok = newEvent(connection.Event{Index: 2, EventType: connection.Unregistering})
+	require.True(t, ok)
+	assert.Equal(t, Event{Type: Unregistering, ConnIndex: 2}, event)
+
+	_, ok = newEvent(connection.Event{EventType: connection.SetURL})
+	assert.False(t, ok)
+}
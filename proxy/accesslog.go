@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/cloudflared/accesslog"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/tracing"
+)
+
+// eyeballIPHeader is set by the edge to the IP of the client of the request
+const eyeballIPHeader = "Cf-Connecting-Ip"
+
+// accessRecord records the response to a request for the access log. A nil accessRecord records nothing.
+type accessRecord struct {
+	connection.ResponseWriter
+	entry         accesslog.Entry
+	start         time.Time
+	bytesReceived atomic.Uint64
+	bytesSent     atomic.Uint64
+}
+
+// recordAccess returns the response writer to use for the request, which records it if there is an access log.
+func (p *Proxy) recordAccess(w connection.ResponseWriter, tr *tracing.TracedHTTPRequest, requestID string) (connection.ResponseWriter, *accessRecord) {
+	if p.accessLog == nil {
+		return w, nil
+	}
+	req := tr.Request
+	record := &accessRecord{
+		ResponseWriter: w,
+		entry: accesslog.Entry{
+			Type:      accesslog.TypeHTTP,
+			ConnIndex: tr.ConnIndex,
+			CFRay:     connection.FindCfRayHeader(req),
+			RequestID: requestID,
+			EyeballIP: req.Header.Get(eyeballIPHeader),
+			Hostname:  req.Host,
+			Method:    req.Method,
+			Path:      req.URL.Path,
+		},
+		start: time.Now(),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingBody{ReadCloser: req.Body, count: &record.bytesReceived}
+	}
+	return record, record
+}
+
+func (r *accessRecord) setRule(rule *ingress.Rule) {
+	if r == nil {
+		return
+	}
+	r.entry.OriginService = rule.Service.String()
+}
+
+// log writes the entry of the request once it is proxied, with the error that failed it if any.
+func (r *accessRecord) log(accessLog *accesslog.Logger, err error) {
+	if r == nil {
+		return
+	}
+	r.entry.Time = r.start
+	r.entry.BytesReceived = r.bytesReceived.Load()
+	r.entry.BytesSent = r.bytesSent.Load()
+	r.entry.DurationMs = accesslog.Milliseconds(time.Since(r.start))
+	if err != nil {
+		r.entry.Error = err.Error()
+	}
+	accessLog.Log(&r.entry)
+}
+
+func (r *accessRecord) responded(status int) {
+	if r.entry.Status == 0 {
+		r.entry.Status = status
+		r.entry.ResponseMs = accesslog.Milliseconds(time.Since(r.start))
+	}
+}
+
+func (r *accessRecord) WriteRespHeaders(status int, header http.Header) error {
+	r.responded(status)
+	return r.ResponseWriter.WriteRespHeaders(status, header)
+}
+
+func (r *accessRecord) WriteHeader(status int) {
+	r.responded(status)
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *accessRecord) Write(p []byte) (int, error) {
+	r.responded(http.StatusOK)
+	n, err := r.ResponseWriter.Write(p)
+	r.bytesSent.Add(uint64(n))
+	return n, err
+}
+
+func (r *accessRecord) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// countingBody counts the bytes of the request body read from the eyeball.
+type countingBody struct {
+	io.ReadCloser
+	count *atomic.Uint64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.count.Add(uint64(n))
+	return n, err
+}
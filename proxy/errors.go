@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+)
+
+// Reasons of the errors of cloudflared proxying to the origins, as opposed to the errors responded by the origins.
+const (
+	tunnelErrorDial     = "dial"
+	tunnelErrorTimeout  = "timeout"
+	tunnelErrorTLS      = "tls"
+	tunnelErrorCanceled = "canceled"
+	tunnelErrorOther    = "other"
+)
+
+// tunnelErrorReason classifies an error reaching the origin. The TLS errors are checked first since they can wrap
+// the network error that failed the handshake.
+func tunnelErrorReason(err error) string {
+	var (
+		recordHeaderErr tls.RecordHeaderError
+		verificationErr *tls.CertificateVerificationError
+		unknownAuthErr  x509.UnknownAuthorityError
+		hostnameErr     x509.HostnameError
+		invalidCertErr  x509.CertificateInvalidError
+		netErr          net.Error
+		opErr           *net.OpError
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return tunnelErrorCanceled
+	case errors.As(err, &recordHeaderErr), errors.As(err, &verificationErr), errors.As(err, &unknownAuthErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidCertErr), strings.Contains(err.Error(), "tls: "):
+		return tunnelErrorTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return tunnelErrorTimeout
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return tunnelErrorDial
+	default:
+		return tunnelErrorOther
+	}
+}
+
+// countTunnelError counts the failure of cloudflared to reach the origin by its reason.
+func countTunnelError(err error) {
+	tunnelErrors.WithLabelValues(tunnelErrorReason(err)).Inc()
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// flushWriter flushes the response body written to the edge after every write, or at least every interval, so that
+// streamed responses like Server-Sent Events and long polls aren't held in the buffers of the connection.
+type flushWriter struct {
+	w         io.Writer
+	flusher   http.Flusher
+	interval  time.Duration
+	immediate bool
+
+	lock sync.Mutex
+	// pending is the timer of the next flush, nil when nothing was written since the last one
+	pending *time.Timer
+	stopped bool
+}
+
+// newFlushWriter returns w as is when flushing is left to the connection, i.e. without interval and immediate.
+// Otherwise, it flushes the headers already written to w, as the first event of a stream can be long to come.
+func newFlushWriter(w io.Writer, interval time.Duration, immediate bool) (io.Writer, func()) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || (interval <= 0 && !immediate) {
+		return w, func() {}
+	}
+	fw := &flushWriter{
+		w:         w,
+		flusher:   flusher,
+		interval:  interval,
+		immediate: immediate,
+	}
+	flusher.Flush()
+	return fw, fw.stop
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+	n, err := fw.w.Write(p)
+	if fw.immediate {
+		fw.flusher.Flush()
+		return n, err
+	}
+	if fw.pending == nil && !fw.stopped {
+		fw.pending = time.AfterFunc(fw.interval, fw.delayedFlush)
+	}
+	return n, err
+}
+
+func (fw *flushWriter) delayedFlush() {
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+	if fw.stopped {
+		return
+	}
+	fw.flusher.Flush()
+	fw.pending = nil
+}
+
+// stop cancels the pending flush, the rest of the response is flushed when it ends.
+func (fw *flushWriter) stop() {
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+	fw.stopped = true
+	if fw.pending != nil {
+		fw.pending.Stop()
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingFlusher struct {
+	bytes.Buffer
+	flushes atomic.Int32
+}
+
+func (f *countingFlusher) Flush() {
+	f.flushes.Add(1)
+}
+
+func TestFlushWriter(t *testing.T) {
+	t.Run("left to the connection", func(t *testing.T) {
+		dst := &countingFlusher{}
+		w, stop := newFlushWriter(dst, 0, false)
+		defer stop()
+		require.Same(t, dst, w)
+		require.Zero(t, dst.flushes.Load())
+	})
+
+	t.Run("immediate", func(t *testing.T) {
+		dst := &countingFlusher{}
+		w, stop := newFlushWriter(dst, 0, true)
+		defer stop()
+		// The headers are flushed before the body
+		require.EqualValues(t, 1, dst.flushes.Load())
+		for i := 0; i < 3; i++ {
+			_, err := w.Write([]byte("data: event\n\n"))
+			require.NoError(t, err)
+		}
+		require.EqualValues(t, 4, dst.flushes.Load())
+		require.Equal(t, "data: event\n\ndata: event\n\ndata: event\n\n", dst.String())
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		dst := &countingFlusher{}
+		w, stop := newFlushWriter(dst, 50*time.Millisecond, false)
+		defer stop()
+		require.EqualValues(t, 1, dst.flushes.Load())
+		// The writes within an interval are flushed together
+		_, err := w.Write([]byte("a"))
+		require.NoError(t, err)
+		_, err = w.Write([]byte("b"))
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return dst.flushes.Load() == 2
+		}, time.Second, 10*time.Millisecond)
+
+		_, err = w.Write([]byte("c"))
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return dst.flushes.Load() == 3
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		dst := &countingFlusher{}
+		w, stop := newFlushWriter(dst, 20*time.Millisecond, false)
+		_, err := w.Write([]byte("a"))
+		require.NoError(t, err)
+		stop()
+		time.Sleep(50 * time.Millisecond)
+		require.EqualValues(t, 1, dst.flushes.Load())
+	})
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+// overRequestLimits returns why the URL or headers of the request are over the limits of the rule, or an empty string
+// if they aren't. Such requests are answered with 431 Request Header Fields Too Large, as an HTTP server would before
+// reading them. A limit of 0 or less isn't enforced.
+func overRequestLimits(cfg ingress.OriginRequestConfig, req *http.Request) string {
+	if urlLength := len(req.URL.RequestURI()); cfg.MaxURLLength > 0 && urlLength > cfg.MaxURLLength {
+		return fmt.Sprintf("URL of %d bytes is over the limit of %d", urlLength, cfg.MaxURLLength)
+	}
+
+	// Counted as they are sent to the origin over HTTP/1.1, i.e. "Name: value\r\n" for each value
+	headerBytes := len("Host: \r\n") + len(req.Host)
+	headerCount := 1
+	for name, values := range req.Header {
+		for _, value := range values {
+			headerBytes += len(name) + len(value) + len(": \r\n")
+		}
+		headerCount += len(values)
+	}
+	if cfg.MaxRequestHeaderCount > 0 && headerCount > cfg.MaxRequestHeaderCount {
+		return fmt.Sprintf("%d headers are over the limit of %d", headerCount, cfg.MaxRequestHeaderCount)
+	}
+	if cfg.MaxRequestHeaderBytes > 0 && headerBytes > cfg.MaxRequestHeaderBytes {
+		return fmt.Sprintf("headers of %d bytes are over the limit of %d", headerBytes, cfg.MaxRequestHeaderBytes)
+	}
+	return ""
+}
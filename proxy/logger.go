@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 
 	"github.com/cloudflare/cloudflared/connection"
@@ -18,6 +19,7 @@ const (
 	logFieldOriginService = "originService"
 	logFieldConnIndex     = "connIndex"
 	logFieldDestAddr      = "destAddr"
+	logFieldRequestID     = "requestID"
 )
 
 var (
@@ -25,11 +27,12 @@ var (
 )
 
 // newHTTPLogger creates a child zerolog.Logger from the provided with added context from the HTTP request, ingress
-// services, and connection index.
-func newHTTPLogger(logger *zerolog.Logger, connIndex uint8, req *http.Request, rule int, serviceName string) zerolog.Logger {
+// services, connection index and request ID.
+func newHTTPLogger(logger *zerolog.Logger, connIndex uint8, req *http.Request, rule int, serviceName, requestID string) zerolog.Logger {
 	ctx := logger.With().
 		Int(management.EventTypeKey, int(management.HTTP)).
-		Uint8(logFieldConnIndex, connIndex)
+		Uint8(logFieldConnIndex, connIndex).
+		Str(management.HostKey, req.Host)
 	cfRay := connection.FindCfRayHeader(req)
 	lbProbe := connection.IsLBProbeRequest(req)
 	if cfRay != "" {
@@ -38,6 +41,9 @@ func newHTTPLogger(logger *zerolog.Logger, connIndex uint8, req *http.Request, r
 	if lbProbe {
 		ctx.Bool(logFieldLBProbe, lbProbe)
 	}
+	if requestID != "" {
+		ctx.Str(logFieldRequestID, requestID)
+	}
 	return ctx.
 		Str(logFieldOriginService, serviceName).
 		Interface(logFieldRule, rule).
@@ -59,17 +65,17 @@ func newTCPLogger(logger *zerolog.Logger, req *connection.TCPRequest) zerolog.Lo
 // logHTTPRequest logs a Debug message with the corresponding HTTP request details from the eyeball.
 func logHTTPRequest(logger *zerolog.Logger, r *http.Request) {
 	logger.Debug().
-		Str("host", r.Host).
 		Str("path", r.URL.Path).
 		Interface("headers", r.Header).
 		Int64("content-length", r.ContentLength).
 		Msgf("%s %s %s", r.Method, r.URL, r.Proto)
 }
 
-// logOriginHTTPResponse logs a Debug message of the origin response.
-func logOriginHTTPResponse(logger *zerolog.Logger, resp *http.Response) {
-	responseByCode.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+// logOriginHTTPResponse logs a Debug message of the origin response, and counts it with the exemplar of the request.
+func logOriginHTTPResponse(logger *zerolog.Logger, resp *http.Response, exemplar prometheus.Labels) {
+	incWithExemplar(responseByCode.WithLabelValues(strconv.Itoa(resp.StatusCode)), exemplar)
 	logger.Debug().
+		Int(management.StatusKey, resp.StatusCode).
 		Int64("content-length", resp.ContentLength).
 		Msgf("%s", resp.Status)
 }
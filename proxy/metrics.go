@@ -1,9 +1,15 @@
 package proxy
 
 import (
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/ingress"
 )
 
 // Metrics uses connection.MetricsNamespace(aka cloudflared) as namespace and connection.TunnelSubsystem
@@ -76,8 +82,57 @@ var (
 			Help:      "Total count of failure to establish and acknowledge connections",
 		},
 	)
+	originErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: "proxy",
+			Name:      "origin_errors",
+			Help:      "Count of 5xx responses generated by the origins, by HTTP status code",
+		},
+		[]string{"status_code"},
+	)
+	tunnelErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: "proxy",
+			Name:      "tunnel_errors",
+			Help:      "Count of failures of cloudflared to reach the origins, by reason: dial, timeout, tls, canceled or other",
+		},
+		[]string{"reason"},
+	)
+	originConnectDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: "proxy",
+			Name:      "origin_connect_seconds",
+			Help:      "Time it takes to open a new connection to the origin, by hostname and service of the ingress rule",
+			Buckets:   originLatencyBuckets,
+		},
+		[]string{"hostname", "service"},
+	)
+	originResponseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: "proxy",
+			Name:      "origin_response_seconds",
+			Help:      "Time it takes the origin to respond with the headers of a HTTP response, by hostname and service of the ingress rule",
+			Buckets:   originLatencyBuckets,
+		},
+		[]string{"hostname", "service"},
+	)
 )
 
+var originLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// inFlightHTTPRequests counts the HTTP requests being proxied by all the tunnels, to report the progress of a
+// graceful shutdown.
+var inFlightHTTPRequests atomic.Int64
+
+// InFlightHTTPRequests returns the number of HTTP requests, including websockets, being proxied to origins.
+func InFlightHTTPRequests() int64 {
+	return inFlightHTTPRequests.Load()
+}
+
 func init() {
 	prometheus.MustRegister(
 		totalRequests,
@@ -88,6 +143,10 @@ func init() {
 		totalTCPSessions,
 		connectLatency,
 		connectStreamErrors,
+		originErrors,
+		tunnelErrors,
+		originConnectDuration,
+		originResponseDuration,
 	)
 }
 
@@ -110,3 +169,56 @@ func decrementTCPConcurrentRequests() {
 	decrementConcurrentRequests()
 	activeTCPSessions.Dec()
 }
+
+// originLatency observes the latencies of the origin of an ingress rule. The hostname of the rule rather than of the
+// request labels them, so that wildcard rules don't create a series per subdomain. Its zero value observes nothing.
+type originLatency struct {
+	connect  prometheus.Observer
+	response prometheus.Observer
+}
+
+func newOriginLatency(rule *ingress.Rule) originLatency {
+	hostname, service := ruleLabels(rule)
+	return originLatency{
+		connect:  originConnectDuration.WithLabelValues(hostname, service),
+		response: originResponseDuration.WithLabelValues(hostname, service),
+	}
+}
+
+// ruleLabels returns the hostname and service that identify the rule in the metrics and stats.
+func ruleLabels(rule *ingress.Rule) (string, string) {
+	hostname := rule.Hostname
+	if hostname == "" {
+		hostname = "*"
+	}
+	return hostname, rule.Service.String()
+}
+
+// traceConnect observes the time it takes to get a new connection to the origin for the request, including its DNS
+// resolution and TLS handshake. Reused connections aren't observed.
+func (l originLatency) traceConnect(req *http.Request) *http.Request {
+	if l.connect == nil {
+		return req
+	}
+	var start time.Time
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GetConn: func(string) { start = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused && !start.IsZero() {
+				l.connect.Observe(time.Since(start).Seconds())
+			}
+		},
+	}))
+}
+
+func (l originLatency) observeConnect(start time.Time) {
+	if l.connect != nil {
+		l.connect.Observe(time.Since(start).Seconds())
+	}
+}
+
+func (l originLatency) observeResponse(start time.Time, exemplar prometheus.Labels) {
+	if l.response != nil {
+		observeWithExemplar(l.response, time.Since(start).Seconds(), exemplar)
+	}
+}
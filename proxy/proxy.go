@@ -4,19 +4,24 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/cloudflare/cloudflared/accesslog"
 	"github.com/cloudflare/cloudflared/carrier"
 	"github.com/cloudflare/cloudflared/cfio"
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/overload"
 	"github.com/cloudflare/cloudflared/stream"
 	"github.com/cloudflare/cloudflared/tracing"
 	"github.com/cloudflare/cloudflared/tunnelrpc/pogs"
@@ -34,7 +39,14 @@ type Proxy struct {
 	warpRouting  *ingress.WarpRoutingService
 	management   *ingress.ManagementService
 	tags         []pogs.Tag
-	log          *zerolog.Logger
+	flows        *flow.Table
+	traces       *tracing.OTLPExporter
+	accessLog    *accesslog.Logger
+	// requestIDHeader, if not empty, is the header carrying the ID of the proxied HTTP requests
+	requestIDHeader string
+	// limiter, if not nil, caps the requests and flows proxied at once
+	limiter *overload.Limiter
+	log     *zerolog.Logger
 }
 
 // NewOriginProxy returns a new instance of the Proxy struct.
@@ -43,12 +55,22 @@ func NewOriginProxy(
 	warpRouting ingress.WarpRoutingConfig,
 	tags []pogs.Tag,
 	writeTimeout time.Duration,
+	flows *flow.Table,
+	traces *tracing.OTLPExporter,
+	accessLog *accesslog.Logger,
+	requestIDHeader string,
+	limiter *overload.Limiter,
 	log *zerolog.Logger,
 ) *Proxy {
 	proxy := &Proxy{
-		ingressRules: ingressRules,
-		tags:         tags,
-		log:          log,
+		ingressRules:    ingressRules,
+		tags:            tags,
+		flows:           flows,
+		traces:          traces,
+		accessLog:       accessLog,
+		requestIDHeader: requestIDHeader,
+		limiter:         limiter,
+		log:             log,
 	}
 
 	proxy.warpRouting = ingress.NewWarpRoutingService(warpRouting, writeTimeout)
@@ -77,11 +99,38 @@ func (p *Proxy) ProxyHTTP(
 	w connection.ResponseWriter,
 	tr *tracing.TracedHTTPRequest,
 	isWebsocket bool,
-) error {
+) (err error) {
 	incrementRequests()
 	defer decrementConcurrentRequests()
+	inFlightHTTPRequests.Add(1)
+	defer inFlightHTTPRequests.Add(-1)
 
 	req := tr.Request
+	requestID := setRequestID(req, p.requestIDHeader)
+	w, access := p.recordAccess(w, tr, requestID)
+	defer func() {
+		access.log(p.accessLog, err)
+	}()
+	release, err := p.limiter.Acquire(req.Context())
+	if errors.Is(err, overload.ErrOverloaded) {
+		// Shed before anything else is done for the request, to spare the resources of cloudflared
+		w.WriteRespHeaders(http.StatusServiceUnavailable, nil)
+		p.log.Debug().Str(logFieldRequestID, requestID).Msg(err.Error())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	traceCtx, requestSpan := p.traces.StartRequest(req)
+	defer func() {
+		if err != nil {
+			tracing.EndWithErrorStatus(requestSpan, err)
+			return
+		}
+		requestSpan.End()
+	}()
 	p.appendTagHeaders(req)
 
 	_, ruleSpan := tr.Tracer().Start(req.Context(), "ingress_match",
@@ -89,7 +138,13 @@ func (p *Proxy) ProxyHTTP(
 	rule, ruleNum := p.ingressRules.FindMatchingRule(req.Host, req.URL.Path)
 	ruleSpan.SetAttributes(attribute.Int("rule-num", ruleNum))
 	ruleSpan.End()
-	logger := newHTTPLogger(p.log, tr.ConnIndex, req, ruleNum, rule.Service.String())
+	requestSpan.SetAttributes(attribute.Int("rule-num", ruleNum))
+	access.setRule(rule)
+	stats := countRuleRequest(rule)
+	defer func() {
+		stats.done(err)
+	}()
+	logger := newHTTPLogger(p.log, tr.ConnIndex, req, ruleNum, rule.Service.String(), requestID)
 	logHTTPRequest(&logger, req)
 	if err, applied := p.applyIngressMiddleware(rule, req, w); err != nil {
 		if applied {
@@ -98,15 +153,23 @@ func (p *Proxy) ProxyHTTP(
 		}
 		return err
 	}
+	if reason := overRequestLimits(rule.Config, req); reason != "" {
+		w.WriteRespHeaders(http.StatusRequestHeaderFieldsTooLarge, nil)
+		logRequestError(&logger, fmt.Errorf("request filtered because its %s", reason))
+		return nil
+	}
 
 	switch originProxy := rule.Service.(type) {
 	case ingress.HTTPOriginProxy:
 		if err := p.proxyHTTPRequest(
 			w,
 			tr,
+			traceCtx,
+			newOriginLatency(rule),
+			requestIDExemplar(requestID),
 			originProxy,
 			isWebsocket,
-			rule.Config.DisableChunkedEncoding,
+			rule.Config,
 			&logger,
 		); err != nil {
 			logRequestError(&logger, err)
@@ -124,7 +187,7 @@ func (p *Proxy) ProxyHTTP(
 		}
 		rws := connection.NewHTTPResponseReadWriterAcker(w, flusher, req)
 		logger := logger.With().Str(logFieldDestAddr, dest).Logger()
-		if err := p.proxyStream(tr.ToTracedContext(), rws, dest, originProxy, &logger); err != nil {
+		if err := p.proxyStream(tr.ToTracedContext(), traceCtx, newOriginLatency(rule), rws, dest, originProxy, nil, &logger); err != nil {
 			logRequestError(&logger, err)
 			return err
 		}
@@ -138,6 +201,9 @@ func (p *Proxy) ProxyHTTP(
 }
 
 // ProxyTCP proxies to a TCP connection between the origin service and cloudflared.
+//
+// The destination is dialed from the network of cloudflared, so it can't be another WARP client: cloudflared has no
+// route back to the WARP clients, the traffic between them is routed by the edge (WARP-to-WARP) without a connector.
 func (p *Proxy) ProxyTCP(
 	ctx context.Context,
 	rwa connection.ReadWriteAcker,
@@ -152,6 +218,12 @@ func (p *Proxy) ProxyTCP(
 		return err
 	}
 
+	release, err := p.limiter.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	serveCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -159,7 +231,12 @@ func (p *Proxy) ProxyTCP(
 	tracedCtx := tracing.NewTracedContext(serveCtx, req.CfTraceID, &logger)
 	logger.Debug().Msg("tcp proxy stream started")
 
-	if err := p.proxyStream(tracedCtx, rwa, req.Dest, p.warpRouting.Proxy, &logger); err != nil {
+	flowEntry := p.flows.Open(flow.TCP, "", "", req.Dest, req.ConnIndex)
+	defer flowEntry.Close()
+	flowEntry.OnCut(cancel)
+	rwa = &flowReadWriteAcker{ReadWriteAcker: rwa, flow: flowEntry}
+
+	if err := p.proxyStream(tracedCtx, context.Background(), originLatency{}, rwa, req.Dest, p.warpRouting.Proxy, flowEntry, &logger); err != nil {
 		logRequestError(&logger, err)
 		return err
 	}
@@ -173,9 +250,12 @@ func (p *Proxy) ProxyTCP(
 func (p *Proxy) proxyHTTPRequest(
 	w connection.ResponseWriter,
 	tr *tracing.TracedHTTPRequest,
+	traceCtx context.Context,
+	latency originLatency,
+	exemplar prometheus.Labels,
 	httpService ingress.HTTPOriginProxy,
 	isWebsocket bool,
-	disableChunkedEncoding bool,
+	cfg ingress.OriginRequestConfig,
 	logger *zerolog.Logger,
 ) error {
 	roundTripReq := tr.Request
@@ -188,7 +268,7 @@ func (p *Proxy) proxyHTTPRequest(
 		roundTripReq.Body = nil
 	} else {
 		// Support for WSGI Servers by switching transfer encoding from chunked to gzip/deflate
-		if disableChunkedEncoding {
+		if cfg.DisableChunkedEncoding {
 			roundTripReq.TransferEncoding = []string{"gzip", "deflate"}
 			cLength, err := strconv.Atoi(tr.Request.Header.Get("Content-Length"))
 			if err == nil {
@@ -204,10 +284,16 @@ func (p *Proxy) proxyHTTPRequest(
 		roundTripReq.Header.Set("User-Agent", "")
 	}
 
+	originCtx, originSpan := p.traces.Start(traceCtx, "origin_response", trace.WithSpanKind(trace.SpanKindClient))
+	roundTripReq = p.traces.TraceOrigin(originCtx, roundTripReq)
+	roundTripReq = latency.traceConnect(roundTripReq)
 	_, ttfbSpan := tr.Tracer().Start(tr.Context(), "ttfb_origin")
+	roundTripStart := time.Now()
 	resp, err := httpService.RoundTrip(roundTripReq)
 	if err != nil {
+		countTunnelError(err)
 		tracing.EndWithErrorStatus(ttfbSpan, err)
+		tracing.EndWithErrorStatus(originSpan, err)
 		if err := roundTripReq.Context().Err(); err != nil {
 			return errors.Wrap(err, "Incoming request ended abruptly")
 		}
@@ -215,6 +301,13 @@ func (p *Proxy) proxyHTTPRequest(
 	}
 
 	tracing.EndWithStatusCode(ttfbSpan, resp.StatusCode)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		originErrors.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	latency.observeResponse(roundTripStart, exemplar)
+	tracing.SetHTTPStatus(originSpan, resp.StatusCode)
+	originSpan.End()
+	tracing.SetHTTPStatus(trace.SpanFromContext(traceCtx), resp.StatusCode)
 	defer resp.Body.Close()
 
 	headers := make(http.Header, len(resp.Header))
@@ -247,39 +340,57 @@ func (p *Proxy) proxyHTTPRequest(
 		return nil
 	}
 
-	if _, err = cfio.Copy(w, resp.Body); err != nil {
+	body, stopFlushing := newFlushWriter(w, cfg.FlushInterval.Duration, cfg.FlushImmediately)
+	defer stopFlushing()
+	if _, err = cfio.CopySized(body, resp.Body, resp.ContentLength); err != nil {
 		return err
 	}
 
 	// copy trailers
 	copyTrailers(w, resp)
 
-	logOriginHTTPResponse(logger, resp)
+	logOriginHTTPResponse(logger, resp, exemplar)
 	return nil
 }
 
 // proxyStream proxies type TCP and other underlying types if the connection is defined as a stream oriented
 // ingress rule.
 // connectedLogger is used to log when the connection is acknowledged
+// flowEntry, if not nil, is told about the local address of the origin connection
 func (p *Proxy) proxyStream(
 	tr *tracing.TracedContext,
+	traceCtx context.Context,
+	latency originLatency,
 	rwa connection.ReadWriteAcker,
 	dest string,
 	connectionProxy ingress.StreamBasedOriginProxy,
+	flowEntry *flow.Flow,
 	logger *zerolog.Logger,
 ) error {
 	ctx := tr.Context
 	_, connectSpan := tr.Tracer().Start(ctx, "stream-connect")
+	_, dialSpan := p.traces.Start(traceCtx, "origin_dial", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("dest", dest)))
 
 	start := time.Now()
 	originConn, err := connectionProxy.EstablishConnection(ctx, dest, logger)
 	if err != nil {
 		connectStreamErrors.Inc()
+		countTunnelError(err)
 		tracing.EndWithErrorStatus(connectSpan, err)
+		tracing.EndWithErrorStatus(dialSpan, err)
 		return err
 	}
 	connectSpan.End()
+	dialSpan.End()
+	latency.observeConnect(start)
 	defer originConn.Close()
+	if conn, ok := originConn.(interface{ LocalAddr() net.Addr }); ok {
+		flowEntry.SetSrc(conn.LocalAddr().String())
+	}
+	// Closing the origin connection ends the stream once the context is done, e.g. when the flow is cut
+	stop := context.AfterFunc(ctx, originConn.Close)
+	defer stop()
 	logger.Debug().Msg("origin connection established")
 
 	encodedSpans := tr.GetSpans()
@@ -307,6 +418,24 @@ func (p *Proxy) proxyLocalRequest(proxy ingress.HTTPLocalProxy, w connection.Res
 	proxy.ServeHTTP(w, req)
 }
 
+// flowReadWriteAcker accounts the bytes exchanged with the eyeball in the flow of the TCP request.
+type flowReadWriteAcker struct {
+	connection.ReadWriteAcker
+	flow *flow.Flow
+}
+
+func (f *flowReadWriteAcker) Read(p []byte) (int, error) {
+	n, err := f.ReadWriteAcker.Read(p)
+	f.flow.AddBytesToOrigin(n)
+	return n, err
+}
+
+func (f *flowReadWriteAcker) Write(p []byte) (int, error) {
+	n, err := f.ReadWriteAcker.Write(p)
+	f.flow.AddBytesFromOrigin(n)
+	return n, err
+}
+
 type bidirectionalStream struct {
 	reader io.Reader
 	writer io.Writer
@@ -4,12 +4,17 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -17,18 +22,22 @@ import (
 
 	"github.com/gobwas/ws/wsutil"
 	gorillaWS "github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/cloudflare/cloudflared/accesslog"
 	"github.com/cloudflare/cloudflared/cfio"
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/connection"
 	"github.com/cloudflare/cloudflared/hello"
 	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/overload"
 	"github.com/cloudflare/cloudflared/tracing"
 	"github.com/cloudflare/cloudflared/tunnelrpc/pogs"
 )
@@ -162,7 +171,7 @@ func TestProxySingleOrigin(t *testing.T) {
 
 	require.NoError(t, ingressRule.StartOrigins(&log, ctx.Done()))
 
-	proxy := NewOriginProxy(ingressRule, noWarpRouting, testTags, time.Duration(0), &log)
+	proxy := NewOriginProxy(ingressRule, noWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", nil, &log)
 	t.Run("testProxyHTTP", testProxyHTTP(proxy))
 	t.Run("testProxyWebsocket", testProxyWebsocket(proxy))
 	t.Run("testProxySSE", testProxySSE(proxy))
@@ -348,6 +357,330 @@ func TestProxyMultipleOrigins(t *testing.T) {
 	runIngressTestScenarios(t, unvalidatedIngress, tests)
 }
 
+func TestProxyOriginLatency(t *testing.T) {
+	api := httptest.NewServer(mockAPI{})
+	defer api.Close()
+	ingress, err := ingress.ParseIngress(&config.Configuration{
+		TunnelID: t.Name(),
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "latency.example.com", Service: api.URL},
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", nil, &log)
+
+	sampleCount := func(histogram *prometheus.HistogramVec, hostname, service string) uint64 {
+		var m dto.Metric
+		require.NoError(t, histogram.WithLabelValues(hostname, service).(prometheus.Metric).Write(&m))
+		return m.Histogram.GetSampleCount()
+	}
+	// The catch-all rule is shared with the other tests
+	catchAll := sampleCount(originResponseDuration, "*", "http_status:404")
+
+	for _, url := range []string{"http://latency.example.com", "http://latency.example.com", "http://other.example.com"} {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		require.NoError(t, proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, 0, &log), false))
+	}
+
+	service := ingress.Rules[0].Service.String()
+	assert.Equal(t, uint64(2), sampleCount(originResponseDuration, "latency.example.com", service))
+	assert.Equal(t, uint64(1), sampleCount(originConnectDuration, "latency.example.com", service), "the connection to the origin is reused")
+	assert.Equal(t, catchAll+1, sampleCount(originResponseDuration, "*", "http_status:404"))
+}
+
+func TestProxyOriginAndTunnelErrors(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer origin.Close()
+	// Nothing listens on the address of a closed listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	ingress, err := ingress.ParseIngress(&config.Configuration{
+		TunnelID: t.Name(),
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "down.example.com", Service: "http://" + listener.Addr().String()},
+			{Service: origin.URL},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", nil, &log)
+
+	count := func(counter *prometheus.CounterVec, label string) float64 {
+		var m dto.Metric
+		require.NoError(t, counter.WithLabelValues(label).Write(&m))
+		return m.Counter.GetValue()
+	}
+	originUnavailable := count(originErrors, "503")
+	dialFailures := count(tunnelErrors, tunnelErrorDial)
+
+	req, err := http.NewRequest(http.MethodGet, "http://app.example.com", nil)
+	require.NoError(t, err)
+	require.NoError(t, proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, 0, &log), false))
+	req, err = http.NewRequest(http.MethodGet, "http://down.example.com", nil)
+	require.NoError(t, err)
+	require.Error(t, proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, 0, &log), false))
+
+	assert.Equal(t, originUnavailable+1, count(originErrors, "503"))
+	assert.Equal(t, dialFailures+1, count(tunnelErrors, tunnelErrorDial))
+}
+
+func TestTunnelErrorReason(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, reason: tunnelErrorDial},
+		{err: fmt.Errorf("dial: %w", context.DeadlineExceeded), reason: tunnelErrorTimeout},
+		{err: fmt.Errorf("request: %w", context.Canceled), reason: tunnelErrorCanceled},
+		{err: &tls.CertificateVerificationError{Err: errors.New("expired")}, reason: tunnelErrorTLS},
+		{err: errors.New("remote error: tls: handshake failure"), reason: tunnelErrorTLS},
+		{err: io.ErrUnexpectedEOF, reason: tunnelErrorOther},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.reason, tunnelErrorReason(test.err), test.err.Error())
+	}
+}
+
+func TestIngressRuleStats(t *testing.T) {
+	api := httptest.NewServer(mockAPI{})
+	defer api.Close()
+	ingress, err := ingress.ParseIngress(&config.Configuration{
+		TunnelID: t.Name(),
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "stats.example.com", Service: api.URL},
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", nil, &log)
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, "http://stats.example.com", nil)
+		require.NoError(t, err)
+		require.NoError(t, proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, 0, &log), false))
+	}
+
+	service := ingress.Rules[0].Service.String()
+	assert.Contains(t, IngressRuleStats(), RuleStats{Hostname: "stats.example.com", Service: service, Requests: 2})
+}
+
+func TestProxyAccessLog(t *testing.T) {
+	api := httptest.NewServer(mockAPI{})
+	defer api.Close()
+	ingress, err := ingress.ParseIngress(&config.Configuration{
+		TunnelID: t.Name(),
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "api.example.com", Service: api.URL},
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
+	path := filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := accesslog.Open(path, nil, &log)
+	require.NoError(t, err)
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), nil, nil, accessLog, "", nil, &log)
+
+	req, err := http.NewRequest(http.MethodPost, "http://api.example.com/items", strings.NewReader("item"))
+	require.NoError(t, err)
+	req.Header.Set("Cf-Connecting-Ip", "203.0.113.1")
+	req.Header.Set("Cf-Ray", "8aeb2b7b4a2c1a2b-LHR")
+	require.NoError(t, proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, 2, &log), false))
+	req, err = http.NewRequest(http.MethodGet, "http://other.example.com/", nil)
+	require.NoError(t, err)
+	require.NoError(t, proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, 0, &log), false))
+	require.NoError(t, accessLog.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	var entry accesslog.Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, accesslog.TypeHTTP, entry.Type)
+	assert.Equal(t, uint8(2), entry.ConnIndex)
+	assert.Equal(t, "8aeb2b7b4a2c1a2b-LHR", entry.CFRay)
+	assert.Equal(t, "203.0.113.1", entry.EyeballIP)
+	assert.Equal(t, "api.example.com", entry.Hostname)
+	assert.Equal(t, http.MethodPost, entry.Method)
+	assert.Equal(t, "/items", entry.Path)
+	assert.Equal(t, ingress.Rules[0].Service.String(), entry.OriginService)
+	assert.Equal(t, http.StatusCreated, entry.Status)
+	assert.Equal(t, uint64(len("item")), entry.BytesReceived)
+	assert.Equal(t, uint64(len("Created")), entry.BytesSent)
+	assert.GreaterOrEqual(t, entry.DurationMs, entry.ResponseMs)
+	assert.False(t, entry.Time.IsZero())
+
+	entry = accesslog.Entry{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "other.example.com", entry.Hostname)
+	assert.Equal(t, "http_status:404", entry.OriginService)
+	assert.Equal(t, http.StatusNotFound, entry.Status)
+}
+
+func TestProxyRequestID(t *testing.T) {
+	const header = "X-Request-Id"
+	received := make(chan string, 2)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(header)
+	}))
+	defer origin.Close()
+	ingress, err := ingress.ParseIngress(&config.Configuration{
+		TunnelID: t.Name(),
+		Ingress:  []config.UnvalidatedIngressRule{{Service: origin.URL}},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
+	path := filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := accesslog.Open(path, nil, &log)
+	require.NoError(t, err)
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), nil, nil, accessLog, header, nil, &log)
+
+	req, err := http.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	require.NoError(t, err)
+	req.Header.Set(header, "eyeball-request-id")
+	require.NoError(t, proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, 0, &log), false))
+	assert.Equal(t, "eyeball-request-id", <-received)
+
+	req, err = http.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	require.NoError(t, err)
+	require.NoError(t, proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, 0, &log), false))
+	generated := <-received
+	assert.NotEmpty(t, generated)
+	assert.NotEqual(t, "eyeball-request-id", generated)
+	require.NoError(t, accessLog.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	for i, expected := range []string{"eyeball-request-id", generated} {
+		var entry accesslog.Entry
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &entry))
+		assert.Equal(t, expected, entry.RequestID)
+	}
+}
+
+func TestProxyRequestLimits(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+	maxHeaderBytes, maxURLLength, maxHeaderCount := 200, 20, 5
+	ingress, err := ingress.ParseIngress(&config.Configuration{
+		TunnelID: t.Name(),
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname: "small.example.com",
+				Service:  origin.URL,
+				OriginRequest: config.OriginRequestConfig{
+					MaxRequestHeaderBytes: &maxHeaderBytes,
+					MaxURLLength:          &maxURLLength,
+					MaxRequestHeaderCount: &maxHeaderCount,
+				},
+			},
+			{Service: origin.URL},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", nil, &log)
+
+	tests := []struct {
+		name   string
+		host   string
+		path   string
+		header http.Header
+		status int
+	}{
+		{name: "under the limits", host: "small.example.com", path: "/", status: http.StatusOK},
+		{name: "long URL", host: "small.example.com", path: "/" + strings.Repeat("a", 20), status: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "large header", host: "small.example.com", path: "/", header: http.Header{"Authorization": {strings.Repeat("a", 200)}}, status: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "many headers", host: "small.example.com", path: "/", header: http.Header{"X-Values": {"1", "2", "3", "4", "5"}}, status: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "default limits", host: "app.example.com", path: "/" + strings.Repeat("a", 20), header: http.Header{"Authorization": {strings.Repeat("a", 200)}}, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://"+test.host+test.path, nil)
+			require.NoError(t, err)
+			for name, values := range test.header {
+				req.Header[name] = values
+			}
+			responseWriter := newMockHTTPRespWriter()
+			require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, 0, &log), false))
+			assert.Equal(t, test.status, responseWriter.Code)
+		})
+	}
+}
+
+func TestProxyOverloaded(t *testing.T) {
+	originReached := make(chan struct{})
+	unblockOrigin := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		originReached <- struct{}{}
+		<-unblockOrigin
+	}))
+	defer origin.Close()
+	ingress, err := ingress.ParseIngress(&config.Configuration{
+		TunnelID: t.Name(),
+		Ingress:  []config.UnvalidatedIngressRule{{Service: origin.URL}},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", overload.NewLimiter(1, 0, time.Second), &log)
+
+	blocked := newMockHTTPRespWriter()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+		assert.NoError(t, proxy.ProxyHTTP(blocked, tracing.NewTracedHTTPRequest(req, 0, &log), false))
+	}()
+	<-originReached
+
+	shed := newMockHTTPRespWriter()
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	require.NoError(t, proxy.ProxyHTTP(shed, tracing.NewTracedHTTPRequest(req, 0, &log), false))
+	assert.Equal(t, http.StatusServiceUnavailable, shed.Code)
+
+	close(unblockOrigin)
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, blocked.Code)
+}
+
+func TestRequestIDExemplar(t *testing.T) {
+	assert.Nil(t, requestIDExemplar(""))
+	assert.Equal(t, prometheus.Labels{requestIDExemplarLabel: "abc"}, requestIDExemplar("abc"))
+	assert.Nil(t, requestIDExemplar(strings.Repeat("a", maxRequestIDLength)))
+}
+
 type MultipleIngressTest struct {
 	url            string
 	expectedStatus int
@@ -366,7 +699,7 @@ func runIngressTestScenarios(t *testing.T, unvalidatedIngress []config.Unvalidat
 	ctx, cancel := context.WithCancel(context.Background())
 	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
 
-	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), &log)
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", nil, &log)
 
 	for _, test := range tests {
 		responseWriter := newMockHTTPRespWriter()
@@ -414,7 +747,7 @@ func TestProxyError(t *testing.T) {
 
 	log := zerolog.Nop()
 
-	proxy := NewOriginProxy(ing, noWarpRouting, testTags, time.Duration(0), &log)
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", nil, &log)
 
 	responseWriter := newMockHTTPRespWriter()
 	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
@@ -675,7 +1008,7 @@ func TestConnections(t *testing.T) {
 
 			ingressRule := createSingleIngressConfig(t, test.args.ingressServiceScheme+ln.Addr().String())
 			ingressRule.StartOrigins(logger, ctx.Done())
-			proxy := NewOriginProxy(ingressRule, testWarpRouting, testTags, time.Duration(0), logger)
+			proxy := NewOriginProxy(ingressRule, testWarpRouting, testTags, time.Duration(0), nil, nil, nil, "", nil, logger)
 			proxy.warpRouting = test.args.warpRoutingService
 
 			dest := ln.Addr().String()
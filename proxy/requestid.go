@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestIDExemplarLabel is the label of the request ID in the exemplars of the metrics
+const requestIDExemplarLabel = "request_id"
+
+// maxRequestIDLength bounds the request IDs propagated from the eyeball, longer IDs are replaced by a generated one.
+const maxRequestIDLength = 128
+
+// setRequestID makes sure the request has an ID in the header, so that the origin receives it. The ID sent by the
+// eyeball is propagated, otherwise a new one is generated. It returns the ID, which is empty if there is no header.
+func setRequestID(req *http.Request, header string) string {
+	if header == "" {
+		return ""
+	}
+	id := req.Header.Get(header)
+	if id == "" || len(id) > maxRequestIDLength || !utf8.ValidString(id) {
+		id = uuid.NewString()
+		req.Header.Set(header, id)
+	}
+	return id
+}
+
+// requestIDExemplar returns the exemplar of the request ID, nil if there is none or it doesn't fit in an exemplar.
+func requestIDExemplar(requestID string) prometheus.Labels {
+	if requestID == "" ||
+		utf8.RuneCountInString(requestIDExemplarLabel)+utf8.RuneCountInString(requestID) > prometheus.ExemplarMaxRunes {
+		return nil
+	}
+	return prometheus.Labels{requestIDExemplarLabel: requestID}
+}
+
+// incWithExemplar increments the counter, with the exemplar if there is one.
+func incWithExemplar(counter prometheus.Counter, exemplar prometheus.Labels) {
+	if adder, ok := counter.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		adder.AddWithExemplar(1, exemplar)
+		return
+	}
+	counter.Inc()
+}
+
+// observeWithExemplar observes the value, with the exemplar if there is one.
+func observeWithExemplar(observer prometheus.Observer, value float64, exemplar prometheus.Labels) {
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		exemplarObserver.ObserveWithExemplar(value, exemplar)
+		return
+	}
+	observer.Observe(value)
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+// RuleStats counts the HTTP requests matched by an ingress rule of all the tunnels since cloudflared started. Like
+// the origin latencies, the rules are identified by their hostname and service, "*" being the hostname of the rules
+// that match any host.
+type RuleStats struct {
+	Hostname string `json:"hostname"`
+	Service  string `json:"service"`
+	Requests uint64 `json:"requests"`
+	Errors   uint64 `json:"errors"`
+	InFlight int64  `json:"inFlight"`
+}
+
+type ruleKey struct {
+	hostname string
+	service  string
+}
+
+type ruleCounters struct {
+	requests atomic.Uint64
+	errors   atomic.Uint64
+	inFlight atomic.Int64
+}
+
+// ruleStats maps the ruleKey of the ingress rules to their *ruleCounters
+var ruleStats sync.Map
+
+// IngressRuleStats returns the stats of the ingress rules that matched requests, ordered by hostname and service.
+func IngressRuleStats() []RuleStats {
+	var stats []RuleStats
+	ruleStats.Range(func(key, value any) bool {
+		rule, counters := key.(ruleKey), value.(*ruleCounters)
+		stats = append(stats, RuleStats{
+			Hostname: rule.hostname,
+			Service:  rule.service,
+			Requests: counters.requests.Load(),
+			Errors:   counters.errors.Load(),
+			InFlight: counters.inFlight.Load(),
+		})
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Hostname == stats[j].Hostname {
+			return stats[i].Service < stats[j].Service
+		}
+		return stats[i].Hostname < stats[j].Hostname
+	})
+	return stats
+}
+
+// countRuleRequest counts a request matched by the rule, which is in flight until done is called.
+func countRuleRequest(rule *ingress.Rule) *ruleCounters {
+	hostname, service := ruleLabels(rule)
+	value, _ := ruleStats.LoadOrStore(ruleKey{hostname: hostname, service: service}, &ruleCounters{})
+	counters := value.(*ruleCounters)
+	counters.requests.Add(1)
+	counters.inFlight.Add(1)
+	return counters
+}
+
+func (c *ruleCounters) done(err error) {
+	c.inFlight.Add(-1)
+	if err != nil {
+		c.errors.Add(1)
+	}
+}
@@ -0,0 +1,265 @@
+// Package qrcode encodes text in QR codes, to show URLs in terminals so that they can be opened on a phone.
+package qrcode
+
+import (
+	"errors"
+	"strings"
+)
+
+// The encoding follows ISO/IEC 18004, with the byte mode and the low error correction level, which fits the most data
+// and is enough to scan a code from a screen.
+const (
+	minVersion = 1
+	maxVersion = 40
+
+	modeByte = 0x4
+	// formatLevelLow are the format bits of the low error correction level
+	formatLevelLow = 0x1
+
+	padByte0 = 0xec
+	padByte1 = 0x11
+
+	// quietZone is the width of the light border that scanners need around the code
+	quietZone = 4
+	// terminalColors draws in black on a bright white background, terminalReset restores the colors of the terminal
+	terminalColors = "\x1b[30;107m"
+	terminalReset  = "\x1b[0m"
+)
+
+// ErrTooLong is returned for texts that don't fit in the largest QR code
+var ErrTooLong = errors.New("text too long for a QR code")
+
+// eccPerBlock and blocks are the error correction codewords per block and the number of blocks, by version
+var (
+	eccPerBlock = [maxVersion + 1]int{-1,
+		7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28,
+		28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30}
+	blocks = [maxVersion + 1]int{-1,
+		1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8,
+		8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25}
+)
+
+// Code is a QR code, a square of dark and light modules.
+type Code struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// Encode returns the smallest QR code holding the text.
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if dataBits(version, len(data)) <= dataCodewords(version)*8 {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, ErrTooLong
+	}
+
+	codewords := addErrorCorrection(version, encodeData(version, data))
+	c := newCode(version)
+	c.drawFunctionPatterns(version)
+	c.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		// Masks are their own inverse
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	return c, nil
+}
+
+// Size is the number of modules on each side of the code.
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Dark returns whether the module at column x and row y is dark, modules outside of the code are light.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.size || y >= c.size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// Terminal renders the code with its quiet zone, two rows of modules per line. The colors are set with escape
+// sequences, dark modules on a white background, so that the code isn't inverted on terminals with a dark background.
+func (c *Code) Terminal() string {
+	var b strings.Builder
+	for y := -quietZone; y < c.size+quietZone; y += 2 {
+		b.WriteString(terminalColors)
+		for x := -quietZone; x < c.size+quietZone; x++ {
+			top, bottom := c.Dark(x, y), c.Dark(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(terminalReset)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func newCode(version int) *Code {
+	size := version*4 + 17
+	c := &Code{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+	return c
+}
+
+// rawDataModules is the number of modules available for the data and the error correction of the version.
+func rawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		alignments := version/7 + 2
+		result -= (25*alignments-10)*alignments - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func dataCodewords(version int) int {
+	return rawDataModules(version)/8 - eccPerBlock[version]*blocks[version]
+}
+
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func dataBits(version, length int) int {
+	return 4 + countBits(version) + 8*length
+}
+
+// encodeData returns the data codewords of the text in byte mode, padded to the capacity of the version.
+func encodeData(version int, data []byte) []byte {
+	var bits bitBuffer
+	bits.append(modeByte, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := dataCodewords(version) * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := padByte0; len(bits) < capacity; pad ^= padByte0 ^ padByte1 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return codewords
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 != 0)
+	}
+}
+
+// addErrorCorrection splits the data in blocks, computes their error correction codewords and interleaves them.
+func addErrorCorrection(version int, data []byte) []byte {
+	numBlocks := blocks[version]
+	eccLen := eccPerBlock[version]
+	rawCodewords := rawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(eccLen)
+	allBlocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range allBlocks {
+		length := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			length++
+		}
+		block := append([]byte{}, data[k:k+length]...)
+		k += length
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			// Placeholder so that all the blocks have the same length, it's skipped when interleaving
+			block = append(block, 0)
+		}
+		allBlocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range allBlocks[0] {
+		for j, block := range allBlocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// reedSolomonDivisor returns the generator polynomial of the degree, without its leading term.
+func reedSolomonDivisor(degree int) []byte {
+	divisor := make([]byte, degree)
+	divisor[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range divisor {
+			divisor[j] = gfMultiply(divisor[j], root)
+			if j+1 < degree {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return divisor
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11d)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
@@ -0,0 +1,231 @@
+package qrcode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD in the version 1 with the medium error correction level, which has 10 error correction codewords
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, reedSolomonRemainder(data, reedSolomonDivisor(10)))
+}
+
+func TestCapacity(t *testing.T) {
+	for version, expected := range map[int]int{1: 19, 2: 34, 6: 136, 10: 274, 14: 461, 27: 1468, 40: 2956} {
+		assert.Equal(t, expected, dataCodewords(version), "version %d", version)
+	}
+	for version := minVersion; version <= maxVersion; version++ {
+		assert.Zero(t, (rawDataModules(version)/8-dataCodewords(version))%blocks[version])
+	}
+}
+
+func readFormatBits(c *Code) int {
+	bits := 0
+	for i := 0; i < 8; i++ {
+		if c.Dark(c.size-1-i, 8) {
+			bits |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if c.Dark(8, c.size-15+i) {
+			bits |= 1 << i
+		}
+	}
+	return bits
+}
+
+func TestFormatBits(t *testing.T) {
+	expected := []int{
+		0b111011111000100, 0b111001011110011, 0b111110110101010, 0b111100010011101,
+		0b110011000101111, 0b110001100011000, 0b110110001000001, 0b110100101110110,
+	}
+	c := newCode(1)
+	for mask, bits := range expected {
+		c.drawFormatBits(mask)
+		assert.Equal(t, bits, readFormatBits(c), "mask %d", mask)
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	c := newCode(7)
+	c.drawVersion(7)
+	bits := 0
+	for i := 0; i < 18; i++ {
+		if c.Dark(i/3, c.size-11+i%3) {
+			bits |= 1 << i
+		}
+	}
+	assert.Equal(t, 0b000111110010010100, bits)
+}
+
+func TestEncodeVersion(t *testing.T) {
+	for length, version := range map[int]int{1: 1, 17: 1, 18: 2, 32: 2, 33: 3, 2953: 40} {
+		c, err := Encode(strings.Repeat("a", length))
+		require.NoError(t, err)
+		assert.Equal(t, version*4+17, c.Size(), "length %d", length)
+	}
+	_, err := Encode(strings.Repeat("a", 2954))
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestEncodePatterns(t *testing.T) {
+	c, err := Encode("https://login.cloudflareaccess.org/device")
+	require.NoError(t, err)
+	// The finder patterns in three corners, with their light separators
+	for _, corner := range [][2]int{{0, 0}, {c.size - 7, 0}, {0, c.size - 7}} {
+		for y := -1; y <= 7; y++ {
+			for x := -1; x <= 7; x++ {
+				distance := max(abs(x-3), abs(y-3))
+				assert.Equal(t, distance != 2 && distance != 4, c.Dark(corner[0]+x, corner[1]+y))
+			}
+		}
+	}
+	for i := 8; i < c.size-8; i++ {
+		assert.Equal(t, i%2 == 0, c.Dark(6, i))
+		assert.Equal(t, i%2 == 0, c.Dark(i, 6))
+	}
+	assert.True(t, c.Dark(8, c.size-8))
+
+	lines := strings.Split(strings.TrimSuffix(c.Terminal(), "\n"), "\n")
+	assert.Len(t, lines, (c.size+2*quietZone+1)/2)
+	for _, line := range lines {
+		assert.True(t, strings.HasPrefix(line, terminalColors))
+		assert.True(t, strings.HasSuffix(line, terminalReset))
+		assert.Equal(t, c.size+2*quietZone, len([]rune(strings.TrimSuffix(strings.TrimPrefix(line, terminalColors), terminalReset))))
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"https://login.cloudflareaccess.org/device?code=ABCD-1234",
+		strings.Repeat("eyJhIjoiNjk5ZDk4NjQyYzU2NGQyZTRlMjVhNWI2YzQ0NWMyZDQ", 4),
+		strings.Repeat("0123456789abcdef", 80),
+		strings.Repeat("\x00\xff", 1476),
+	} {
+		c, err := Encode(text)
+		require.NoError(t, err)
+		modules := parseTerminal(t, c.Terminal())
+		assert.Equal(t, text, decode(t, modules), "version %d", (len(modules)-17)/4)
+	}
+}
+
+// parseTerminal reads the modules of the rendered code back, checking that the quiet zone is light.
+func parseTerminal(t *testing.T, rendered string) [][]bool {
+	var rows [][]bool
+	for _, line := range strings.Split(strings.TrimSuffix(rendered, "\n"), "\n") {
+		line = strings.TrimSuffix(strings.TrimPrefix(line, terminalColors), terminalReset)
+		var top, bottom []bool
+		for _, r := range line {
+			top = append(top, r == '█' || r == '▀')
+			bottom = append(bottom, r == '█' || r == '▄')
+		}
+		rows = append(rows, top, bottom)
+	}
+	size := len(rows[0]) - 2*quietZone
+	modules := make([][]bool, size)
+	for y, row := range rows {
+		for x, dark := range row {
+			inCode := x >= quietZone && x < size+quietZone && y >= quietZone && y < size+quietZone
+			if !inCode {
+				require.False(t, dark, "dark module in the quiet zone at %d,%d", x, y)
+				continue
+			}
+			modules[y-quietZone] = append(modules[y-quietZone], dark)
+		}
+	}
+	return modules
+}
+
+// decode reads the text of a code in byte mode with the low error correction level, checking the error correction
+// codewords of each block.
+func decode(t *testing.T, modules [][]bool) string {
+	size := len(modules)
+	version := (size - 17) / 4
+	format := readFormatBits(&Code{size: size, modules: modules}) ^ 0x5412
+	require.Equal(t, formatLevelLow, format>>13)
+	mask := format >> 10 & 0x7
+
+	functions := newCode(version)
+	functions.drawFunctionPatterns(version)
+	c := &Code{size: size, modules: modules, function: functions.function}
+	c.applyMask(mask)
+
+	var bits bitBuffer
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vertical := 0; vertical < size; vertical++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vertical
+				if (right+1)&2 == 0 {
+					y = size - 1 - vertical
+				}
+				if !c.function[y][x] {
+					bits = append(bits, c.modules[y][x])
+				}
+			}
+		}
+	}
+	rawCodewords := rawDataModules(version) / 8
+	codewords := make([]byte, rawCodewords)
+	for i := range codewords {
+		for _, bit := range bits[i*8 : i*8+8] {
+			codewords[i] <<= 1
+			if bit {
+				codewords[i] |= 1
+			}
+		}
+	}
+
+	numBlocks, eccLen := blocks[version], eccPerBlock[version]
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortDataLen := rawCodewords/numBlocks - eccLen
+	data := make([][]byte, numBlocks)
+	ecc := make([][]byte, numBlocks)
+	next := 0
+	for i := 0; i <= shortDataLen; i++ {
+		for j := range data {
+			if i < shortDataLen || j >= numShortBlocks {
+				data[j] = append(data[j], codewords[next])
+				next++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for j := range ecc {
+			ecc[j] = append(ecc[j], codewords[next])
+			next++
+		}
+	}
+	var dataBits bitBuffer
+	for j := range data {
+		require.Equal(t, reedSolomonRemainder(data[j], reedSolomonDivisor(eccLen)), ecc[j], "block %d", j)
+		for _, b := range data[j] {
+			dataBits.append(int(b), 8)
+		}
+	}
+
+	read := func(length int) int {
+		value := 0
+		for _, bit := range dataBits[:length] {
+			value <<= 1
+			if bit {
+				value |= 1
+			}
+		}
+		dataBits = dataBits[length:]
+		return value
+	}
+	require.Equal(t, modeByte, read(4))
+	text := make([]byte, read(countBits(version)))
+	for i := range text {
+		text[i] = byte(read(8))
+	}
+	return string(text)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/quic-go/quic-go"
 	"github.com/rs/zerolog"
 
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/packet"
 )
 
@@ -47,6 +48,7 @@ func (dm *DatagramMuxer) mtu() int {
 func (dm *DatagramMuxer) SendToSession(session *packet.Session) error {
 	if len(session.Payload) > dm.mtu() {
 		packetTooBigDropped.Inc()
+		flow.Dropped(flow.UDP, flow.DropOversize)
 		return fmt.Errorf("origin UDP payload has %d bytes, which exceeds transport MTU %d", len(session.Payload), dm.mtu())
 	}
 	payloadWithMetadata, err := SuffixSessionID(session.ID, session.Payload)
@@ -80,6 +82,7 @@ func (dm *DatagramMuxer) ServeReceive(ctx context.Context) error {
 func (dm *DatagramMuxer) demux(ctx context.Context, msg []byte) error {
 	sessionID, payload, err := extractSessionID(msg)
 	if err != nil {
+		flow.Dropped(flow.UDP, flow.DropMalformed)
 		return err
 	}
 	sessionDatagram := packet.Session{
@@ -44,6 +44,27 @@ func TestSuffixThenRemoveSessionID(t *testing.T) {
 	require.Equal(t, testSessionID, sessionID)
 }
 
+func TestDemuxSessionWithDSCP(t *testing.T) {
+	sessionDemuxChan := make(chan *packet.Session, 2)
+	log := zerolog.Nop()
+	muxer := NewDatagramMuxerV2(nil, &log, sessionDemuxChan)
+	msg := []byte(t.Name())
+
+	msgWithID, err := SuffixSessionID(testSessionID, append([]byte{}, msg...))
+	require.NoError(t, err)
+	msgWithType, err := SuffixType(msgWithID, DatagramTypeUDP)
+	require.NoError(t, err)
+	require.NoError(t, muxer.demux(context.Background(), msgWithType))
+	require.Equal(t, &packet.Session{ID: testSessionID, Payload: msg}, <-sessionDemuxChan)
+
+	msgWithID, err = SuffixSessionID(testSessionID, append([]byte{}, msg...))
+	require.NoError(t, err)
+	msgWithType, err = SuffixType(append(msgWithID, 46), DatagramTypeUDPWithDSCP)
+	require.NoError(t, err)
+	require.NoError(t, muxer.demux(context.Background(), msgWithType))
+	require.Equal(t, &packet.Session{ID: testSessionID, Payload: msg, DSCP: 46, Marked: true}, <-sessionDemuxChan)
+}
+
 func TestRemoveSessionIDError(t *testing.T) {
 	// message is too short to contain session ID
 	msg := []byte("test")
@@ -23,6 +23,9 @@ const (
 	DatagramTypeIPWithTrace
 	// Tracing spans in protobuf format
 	DatagramTypeTracingSpan
+	// DatagramTypeUDP + DSCP of the eyeball packet, only sent by the edge when the support_datagram_dscp feature is
+	// advertised
+	DatagramTypeUDPWithDSCP
 )
 
 type Packet interface {
@@ -33,6 +36,9 @@ type Packet interface {
 
 const (
 	typeIDLen = 1
+	dscpLen   = 1
+	// dscpMask keeps the 6 bits of the differentiated services code point
+	dscpMask = 0b0011_1111
 	// Same as sessionDemuxChan capacity
 	packetChanCapacity = 128
 )
@@ -144,6 +150,8 @@ func (dm *DatagramMuxerV2) demux(ctx context.Context, msgWithType []byte) error
 	switch msgType {
 	case DatagramTypeUDP:
 		return dm.handleSession(ctx, msg)
+	case DatagramTypeUDPWithDSCP:
+		return dm.handleSessionWithDSCP(ctx, msg)
 	default:
 		return dm.handlePacket(ctx, msg, msgType)
 	}
@@ -166,6 +174,31 @@ func (dm *DatagramMuxerV2) handleSession(ctx context.Context, session []byte) er
 	}
 }
 
+// handleSessionWithDSCP demuxes a session datagram suffixed with the DSCP of the eyeball packet:
+// payload | session ID | DSCP
+func (dm *DatagramMuxerV2) handleSessionWithDSCP(ctx context.Context, session []byte) error {
+	if len(session) < dscpLen {
+		return fmt.Errorf("session datagram with DSCP should have at least %d byte", dscpLen)
+	}
+	dscp := session[len(session)-dscpLen] & dscpMask
+	sessionID, payload, err := extractSessionID(session[:len(session)-dscpLen])
+	if err != nil {
+		return err
+	}
+	sessionDatagram := packet.Session{
+		ID:      sessionID,
+		Payload: payload,
+		DSCP:    dscp,
+		Marked:  true,
+	}
+	select {
+	case dm.sessionDemuxChan <- &sessionDatagram:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (dm *DatagramMuxerV2) handlePacket(ctx context.Context, pk []byte, msgType DatagramV2Type) error {
 	var demuxedPacket Packet
 	switch msgType {
@@ -4,7 +4,9 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/quic-go/quic-go/logging"
 	"github.com/rs/zerolog"
@@ -188,12 +190,31 @@ var (
 	})
 )
 
+// connKey identifies a connection among those of all the tunnels running in the process
+type connKey struct {
+	tunnelID  uuid.UUID
+	connIndex uint8
+}
+
+// smoothedRTTs holds the latest smoothed RTT of each connection by connKey
+var smoothedRTTs sync.Map
+
+// SmoothedRTT returns the smoothed RTT of the QUIC connection of the index of the tunnel, false if there is none.
+func SmoothedRTT(tunnelID uuid.UUID, connIndex uint8) (time.Duration, bool) {
+	rtt, ok := smoothedRTTs.Load(connKey{tunnelID: tunnelID, connIndex: connIndex})
+	if !ok {
+		return 0, false
+	}
+	return rtt.(time.Duration), true
+}
+
 type clientCollector struct {
 	index  string
+	key    connKey
 	logger *zerolog.Logger
 }
 
-func newClientCollector(index string, logger *zerolog.Logger) *clientCollector {
+func newClientCollector(tunnelID uuid.UUID, connIndex uint8, logger *zerolog.Logger) *clientCollector {
 	registerClient.Do(func() {
 		prometheus.MustRegister(
 			clientMetrics.totalConnections,
@@ -217,7 +238,8 @@ func newClientCollector(index string, logger *zerolog.Logger) *clientCollector {
 	})
 
 	return &clientCollector{
-		index:  index,
+		index:  uint8ToString(connIndex),
+		key:    connKey{tunnelID: tunnelID, connIndex: connIndex},
 		logger: logger,
 	}
 }
@@ -228,6 +250,7 @@ func (cc *clientCollector) startedConnection() {
 
 func (cc *clientCollector) closedConnection(error) {
 	clientMetrics.closedConnections.Inc()
+	smoothedRTTs.Delete(cc.key)
 }
 
 func (cc *clientCollector) receivedTransportParameters(params *logging.TransportParameters) {
@@ -263,6 +286,7 @@ func (cc *clientCollector) updatedRTT(rtt *logging.RTTStats) {
 	clientMetrics.minRTT.WithLabelValues(cc.index).Set(durationToPromGauge(rtt.MinRTT()))
 	clientMetrics.latestRTT.WithLabelValues(cc.index).Set(durationToPromGauge(rtt.LatestRTT()))
 	clientMetrics.smoothedRTT.WithLabelValues(cc.index).Set(durationToPromGauge(rtt.SmoothedRTT()))
+	smoothedRTTs.Store(cc.key, rtt.SmoothedRTT())
 }
 
 func (cc *clientCollector) updateCongestionWindow(size logging.ByteCount) {
@@ -4,26 +4,29 @@ import (
 	"context"
 	"net"
 
+	"github.com/google/uuid"
 	"github.com/quic-go/quic-go/logging"
 	"github.com/rs/zerolog"
 )
 
 // QUICTracer is a wrapper to create new quicConnTracer
 type tracer struct {
-	index  string
-	logger *zerolog.Logger
+	tunnelID uuid.UUID
+	index    uint8
+	logger   *zerolog.Logger
 }
 
-func NewClientTracer(logger *zerolog.Logger, index uint8) func(context.Context, logging.Perspective, logging.ConnectionID) *logging.ConnectionTracer {
+func NewClientTracer(logger *zerolog.Logger, tunnelID uuid.UUID, index uint8) func(context.Context, logging.Perspective, logging.ConnectionID) *logging.ConnectionTracer {
 	t := &tracer{
-		index:  uint8ToString(index),
-		logger: logger,
+		tunnelID: tunnelID,
+		index:    index,
+		logger:   logger,
 	}
 	return t.TracerForConnection
 }
 
 func (t *tracer) TracerForConnection(_ctx context.Context, _p logging.Perspective, _odcid logging.ConnectionID) *logging.ConnectionTracer {
-	return newConnTracer(newClientCollector(t.index, t.logger))
+	return newConnTracer(newClientCollector(t.tunnelID, t.index, t.logger))
 }
 
 // connTracer collects connection level metrics
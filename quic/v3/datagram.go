@@ -17,6 +17,8 @@ const (
 	ICMPType DatagramType = 0x2
 	// UDP Session Registration Response
 	UDPSessionRegistrationResponseType DatagramType = 0x3
+	// UDP Session Payload with the DSCP of the eyeball packet
+	UDPSessionPayloadDSCPType DatagramType = 0x4
 )
 
 const (
@@ -40,13 +42,22 @@ type UDPSessionRegistrationDatagram struct {
 	Dest             netip.AddrPort
 	Traced           bool
 	IdleDurationHint time.Duration
-	Payload          []byte
+	// DSCP is the differentiated services code point of the eyeball packet that initiated the session. A value of
+	// zero (best effort) is not encoded in the datagram.
+	DSCP    uint8
+	Payload []byte
 }
 
 const (
 	sessionRegistrationFlagsIPMask      byte = 0b0000_0001
 	sessionRegistrationFlagsTracedMask  byte = 0b0000_0010
 	sessionRegistrationFlagsBundledMask byte = 0b0000_0100
+	sessionRegistrationFlagsDSCPMask    byte = 0b0000_1000
+
+	// The DSCP field occupies the low 6 bits of a single byte appended after the destination address when the
+	// DSCP flag is set.
+	sessionRegistrationDSCPLen      = 1
+	sessionRegistrationDSCPMaxValue = 0b0011_1111
 
 	sessionRegistrationIPv4DatagramHeaderLen = datagramTypeLen +
 		1 + // Flag length
@@ -81,12 +92,16 @@ const (
 //   +                  (extension of IPv4 region)                   +
 // 32|                                                               |
 //   +                               +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// 36|                               |                               |
-//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+                               +
+// 36|                               |  DSCP (opt.)  |               |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+               +
 //   .                                                               .
 //   .                         Bundle Payload                        .
 //   .                                                               .
 //   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// The optional DSCP byte is only present when the DSCP flag is set and directly follows the destination address
+// for either IP family; the bundled payload then starts one byte later. The edge only sets the DSCP flag for
+// connectors that advertise the support_datagram_dscp feature.
 
 func (s *UDPSessionRegistrationDatagram) MarshalBinary() (data []byte, err error) {
 	ipv6 := s.Dest.Addr().Is6()
@@ -98,23 +113,28 @@ func (s *UDPSessionRegistrationDatagram) MarshalBinary() (data []byte, err error
 	if hasPayload {
 		flags |= sessionRegistrationFlagsBundledMask
 	}
-	var maxPayloadLen int
+	if s.DSCP > sessionRegistrationDSCPMaxValue {
+		return nil, wrapMarshalErr(ErrDatagramDSCPInvalid)
+	}
+	hasDSCP := s.DSCP != 0
+	var headerLen int
 	if ipv6 {
-		maxPayloadLen = maxDatagramPayloadLen + sessionRegistrationIPv6DatagramHeaderLen
+		headerLen = sessionRegistrationIPv6DatagramHeaderLen
 		flags |= sessionRegistrationFlagsIPMask
 	} else {
-		maxPayloadLen = maxDatagramPayloadLen + sessionRegistrationIPv4DatagramHeaderLen
+		headerLen = sessionRegistrationIPv4DatagramHeaderLen
+	}
+	if hasDSCP {
+		headerLen += sessionRegistrationDSCPLen
+		flags |= sessionRegistrationFlagsDSCPMask
 	}
+	maxPayloadLen := maxDatagramPayloadLen + headerLen
 	// Make sure that the payload being bundled can actually fit in the payload destination
 	if len(s.Payload) > maxPayloadLen {
 		return nil, wrapMarshalErr(ErrDatagramPayloadTooLarge)
 	}
 	// Allocate the buffer with the right size for the destination IP family
-	if ipv6 {
-		data = make([]byte, sessionRegistrationIPv6DatagramHeaderLen+len(s.Payload))
-	} else {
-		data = make([]byte, sessionRegistrationIPv4DatagramHeaderLen+len(s.Payload))
-	}
+	data = make([]byte, headerLen+len(s.Payload))
 	data[0] = byte(UDPSessionRegistrationType)
 	data[1] = byte(flags)
 	binary.BigEndian.PutUint16(data[2:4], s.Dest.Port())
@@ -131,6 +151,10 @@ func (s *UDPSessionRegistrationDatagram) MarshalBinary() (data []byte, err error
 		copy(data[22:26], s.Dest.Addr().AsSlice())
 		end = 26
 	}
+	if hasDSCP {
+		data[end] = s.DSCP
+		end += sessionRegistrationDSCPLen
+	}
 
 	if hasPayload {
 		copy(data[end:], s.Payload)
@@ -156,6 +180,7 @@ func (s *UDPSessionRegistrationDatagram) UnmarshalBinary(data []byte) error {
 	traced := (data[1] & sessionRegistrationFlagsTracedMask) == sessionRegistrationFlagsTracedMask
 	bundled := (data[1] & sessionRegistrationFlagsBundledMask) == sessionRegistrationFlagsBundledMask
 	ipv6 := (data[1] & sessionRegistrationFlagsIPMask) == sessionRegistrationFlagsIPMask
+	hasDSCP := (data[1] & sessionRegistrationFlagsDSCPMask) == sessionRegistrationFlagsDSCPMask
 
 	port := binary.BigEndian.Uint16(data[2:4])
 	var datagramHeaderSize int
@@ -168,6 +193,15 @@ func (s *UDPSessionRegistrationDatagram) UnmarshalBinary(data []byte) error {
 		dest = netip.AddrPortFrom(netip.AddrFrom4([4]byte(data[22:26])), port)
 	}
 
+	var dscp uint8
+	if hasDSCP {
+		if len(data) < datagramHeaderSize+sessionRegistrationDSCPLen {
+			return wrapUnmarshalErr(ErrDatagramDSCPInvalid)
+		}
+		dscp = data[datagramHeaderSize] & sessionRegistrationDSCPMaxValue
+		datagramHeaderSize += sessionRegistrationDSCPLen
+	}
+
 	idle := time.Duration(binary.BigEndian.Uint16(data[4:6])) * time.Second
 
 	var payload []byte
@@ -180,6 +214,7 @@ func (s *UDPSessionRegistrationDatagram) UnmarshalBinary(data []byte) error {
 		Dest:             dest,
 		Traced:           traced,
 		IdleDurationHint: idle,
+		DSCP:             dscp,
 		Payload:          payload,
 	}
 	return nil
@@ -196,6 +231,11 @@ const (
 
 	// The maximum size that a proxied UDP payload can be in a [UDPSessionPayloadDatagram]
 	maxPayloadPlusHeaderLen = maxDatagramPayloadLen + DatagramPayloadHeaderLen
+
+	// In passthrough mode, encapsulated payloads (e.g. WireGuard or ESP-in-UDP between sites) are allowed up to the
+	// size read from the origin and are only bounded by the datagram size the QUIC connection can carry.
+	maxPassthroughPayloadLen           = maxOriginUDPPacketSize
+	maxPassthroughPayloadPlusHeaderLen = maxPassthroughPayloadLen + DatagramPayloadHeaderLen
 )
 
 // The datagram structure for UDPSessionPayloadDatagram is:
@@ -230,6 +270,11 @@ func MarshalPayloadHeaderTo(requestID RequestID, payload []byte) error {
 }
 
 func (s *UDPSessionPayloadDatagram) UnmarshalBinary(data []byte) error {
+	return s.unmarshalBinary(data, maxPayloadPlusHeaderLen)
+}
+
+// unmarshalBinary parses the datagram allowing for payloads up to maxLen including the header.
+func (s *UDPSessionPayloadDatagram) unmarshalBinary(data []byte, maxLen int) error {
 	datagramType, err := ParseDatagramType(data)
 	if err != nil {
 		return err
@@ -239,7 +284,7 @@ func (s *UDPSessionPayloadDatagram) UnmarshalBinary(data []byte) error {
 	}
 
 	// Make sure that the slice provided is the right size to be parsed.
-	if len(data) < DatagramPayloadHeaderLen || len(data) > maxPayloadPlusHeaderLen {
+	if len(data) < DatagramPayloadHeaderLen || len(data) > maxLen {
 		return wrapUnmarshalErr(ErrDatagramPayloadInvalidSize)
 	}
 
@@ -255,6 +300,88 @@ func (s *UDPSessionPayloadDatagram) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+// UDPSessionPayloadDSCPDatagram provides the payload for a session to be sent to the origin along with the DSCP of the
+// eyeball packet, so that the marking of the origin socket follows the flow. Like the DSCP of the registration, it's
+// only sent by the edge to connectors that advertise the support_datagram_dscp feature.
+type UDPSessionPayloadDSCPDatagram struct {
+	RequestID RequestID
+	DSCP      uint8
+	Payload   []byte
+}
+
+const (
+	DatagramPayloadDSCPHeaderLen = DatagramPayloadHeaderLen + sessionRegistrationDSCPLen
+)
+
+// The datagram structure for UDPSessionPayloadDSCPDatagram is:
+//
+//   0 1 2 3 4 5 6 7 0 1 2 3 4 5 6 7 0 1 2 3 4 5 6 7 0 1 2 3 4 5 6 7
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//  0|      Type     |                                               |
+//   +-+-+-+-+-+-+-+-+                                               +
+//  4|                                                               |
+//   +                                                               +
+//  8|                      Session Identifier                       |
+//   +                           (16 Bytes)                          +
+// 12|                                                               |
+//   +                                               +-+-+-+-+-+-+-+-+
+// 16|                                               |      DSCP     |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// 20|                                                               |
+//   .                                                               .
+//   .                             Payload                           .
+//   .                                                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+func (s *UDPSessionPayloadDSCPDatagram) MarshalBinary() (data []byte, err error) {
+	if s.DSCP > sessionRegistrationDSCPMaxValue {
+		return nil, wrapMarshalErr(ErrDatagramDSCPInvalid)
+	}
+	if len(s.Payload) > maxDatagramPayloadLen {
+		return nil, wrapMarshalErr(ErrDatagramPayloadTooLarge)
+	}
+	data = make([]byte, DatagramPayloadDSCPHeaderLen+len(s.Payload))
+	data[0] = byte(UDPSessionPayloadDSCPType)
+	if err := s.RequestID.MarshalBinaryTo(data[1:DatagramPayloadHeaderLen]); err != nil {
+		return nil, wrapMarshalErr(err)
+	}
+	data[DatagramPayloadHeaderLen] = s.DSCP
+	copy(data[DatagramPayloadDSCPHeaderLen:], s.Payload)
+	return data, nil
+}
+
+func (s *UDPSessionPayloadDSCPDatagram) UnmarshalBinary(data []byte) error {
+	return s.unmarshalBinary(data, maxPayloadPlusHeaderLen+sessionRegistrationDSCPLen)
+}
+
+// unmarshalBinary parses the datagram allowing for payloads up to maxLen including the header.
+func (s *UDPSessionPayloadDSCPDatagram) unmarshalBinary(data []byte, maxLen int) error {
+	datagramType, err := ParseDatagramType(data)
+	if err != nil {
+		return err
+	}
+	if datagramType != UDPSessionPayloadDSCPType {
+		return wrapUnmarshalErr(ErrInvalidDatagramType)
+	}
+
+	// Make sure that the slice provided is the right size to be parsed.
+	if len(data) < DatagramPayloadDSCPHeaderLen || len(data) > maxLen {
+		return wrapUnmarshalErr(ErrDatagramPayloadInvalidSize)
+	}
+
+	requestID, err := RequestIDFromSlice(data[1:DatagramPayloadHeaderLen])
+	if err != nil {
+		return wrapUnmarshalErr(err)
+	}
+
+	*s = UDPSessionPayloadDSCPDatagram{
+		RequestID: requestID,
+		DSCP:      data[DatagramPayloadHeaderLen] & sessionRegistrationDSCPMaxValue,
+		Payload:   data[DatagramPayloadDSCPHeaderLen:],
+	}
+	return nil
+}
+
 // UDPSessionRegistrationResponseDatagram is used to either return a successful registration or error to the client
 // that requested the registration of a UDP session.
 type UDPSessionRegistrationResponseDatagram struct {
@@ -17,6 +17,7 @@ var (
 	ErrDatagramResponseMsgTooLargeDatagram error = fmt.Errorf("datagram response error message length exceeds the length of the provided datagram")
 	ErrDatagramICMPPayloadTooLarge         error = fmt.Errorf("datagram icmp payload exceeds %d bytes", maxICMPPayloadLen)
 	ErrDatagramICMPPayloadMissing          error = errors.New("datagram icmp payload is missing")
+	ErrDatagramDSCPInvalid                 error = fmt.Errorf("datagram dscp value is missing or exceeds %d", sessionRegistrationDSCPMaxValue)
 )
 
 func wrapMarshalErr(err error) error {
@@ -92,6 +92,24 @@ func TestSessionRegistration_MarshalUnmarshal(t *testing.T) {
 			IdleDurationHint: 5 * time.Second,
 			Payload:          payload[:1242],
 		},
+		// DSCP (EF) for IPv4
+		{
+			RequestID:        testRequestID,
+			Dest:             netip.MustParseAddrPort("1.1.1.1:8080"),
+			Traced:           false,
+			IdleDurationHint: 5 * time.Second,
+			DSCP:             46,
+			Payload:          nil,
+		},
+		// DSCP (max) with payload for IPv6
+		{
+			RequestID:        testRequestID,
+			Dest:             netip.MustParseAddrPort("[fc00::0]:8080"),
+			Traced:           true,
+			IdleDurationHint: 5 * time.Second,
+			DSCP:             63,
+			Payload:          []byte{0xff, 0xaa, 0xcc, 0x44},
+		},
 	}
 	for _, tt := range tests {
 		marshaled, err := tt.MarshalBinary()
@@ -141,6 +159,66 @@ func TestSessionRegistration_MarshalBinary(t *testing.T) {
 	})
 }
 
+func TestSessionRegistration_DSCP(t *testing.T) {
+	t.Run("dscp too large", func(t *testing.T) {
+		datagram := &v3.UDPSessionRegistrationDatagram{
+			RequestID: testRequestID,
+			Dest:      netip.MustParseAddrPort("1.1.1.1:8080"),
+			DSCP:      64,
+		}
+		_, err := datagram.MarshalBinary()
+		if !errors.Is(err, v3.ErrDatagramDSCPInvalid) {
+			t.Errorf("expected invalid dscp to throw error: %v", err)
+		}
+	})
+
+	t.Run("dscp flag without value", func(t *testing.T) {
+		datagram := &v3.UDPSessionRegistrationDatagram{
+			RequestID: testRequestID,
+			Dest:      netip.MustParseAddrPort("1.1.1.1:8080"),
+			DSCP:      10,
+		}
+		marshaled, err := datagram.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		unmarshaled := v3.UDPSessionRegistrationDatagram{}
+		err = unmarshaled.UnmarshalBinary(marshaled[:len(marshaled)-1])
+		if !errors.Is(err, v3.ErrDatagramDSCPInvalid) {
+			t.Errorf("expected missing dscp to throw error: %v", err)
+		}
+	})
+}
+
+func TestSessionPayloadDSCP_MarshalUnmarshal(t *testing.T) {
+	datagram := &v3.UDPSessionPayloadDSCPDatagram{
+		RequestID: testRequestID,
+		DSCP:      46,
+		Payload:   []byte{0xff, 0xaa, 0xcc, 0x44},
+	}
+	marshaled, err := datagram.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unmarshaled := v3.UDPSessionPayloadDSCPDatagram{}
+	require.NoError(t, unmarshaled.UnmarshalBinary(marshaled))
+	require.Equal(t, *datagram, unmarshaled)
+
+	datagram.DSCP = 64
+	if _, err := datagram.MarshalBinary(); !errors.Is(err, v3.ErrDatagramDSCPInvalid) {
+		t.Errorf("expected invalid dscp to throw error: %v", err)
+	}
+
+	// The plain payload datagram isn't a DSCP payload datagram
+	plain := make([]byte, v3.DatagramPayloadHeaderLen+4)
+	if err := v3.MarshalPayloadHeaderTo(testRequestID, plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := unmarshaled.UnmarshalBinary(plain); !errors.Is(err, v3.ErrInvalidDatagramType) {
+		t.Errorf("expected invalid datagram type to throw error: %v", err)
+	}
+}
+
 func TestTypeUnmarshalErrors(t *testing.T) {
 	t.Run("invalid length", func(t *testing.T) {
 		d1 := v3.UDPSessionRegistrationDatagram{}
@@ -408,7 +486,8 @@ func compareRegistrationDatagrams(t *testing.T, l *v3.UDPSessionRegistrationData
 	return l.RequestID == r.RequestID &&
 		l.Dest == r.Dest &&
 		l.IdleDurationHint == r.IdleDurationHint &&
-		l.Traced == r.Traced
+		l.Traced == r.Traced &&
+		l.DSCP == r.DSCP
 }
 
 func FuzzRegistrationDatagram(f *testing.F) {
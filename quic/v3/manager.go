@@ -7,6 +7,9 @@ import (
 	"sync"
 
 	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/ingress"
 )
 
 var (
@@ -38,14 +41,24 @@ type sessionManager struct {
 	sessions     map[RequestID]Session
 	mutex        sync.RWMutex
 	originDialer DialUDP
+	flows        *flow.Table
+	passthrough  bool
+	dscp         bool
 	metrics      Metrics
 	log          *zerolog.Logger
 }
 
-func NewSessionManager(metrics Metrics, log *zerolog.Logger, originDialer DialUDP) SessionManager {
+// NewSessionManager creates a [SessionManager] that dials origins with originDialer. Active sessions are reported
+// in flows when it is not nil. When passthrough is set, sessions are created with [NewPassthroughSession] to carry
+// site-to-site encapsulated traffic. When dscp is set, the DSCP of the eyeball packets sent by the edge is preserved
+// on the packets sent to the origins, otherwise it's ignored.
+func NewSessionManager(metrics Metrics, log *zerolog.Logger, originDialer DialUDP, flows *flow.Table, passthrough bool, dscp bool) SessionManager {
 	return &sessionManager{
 		sessions:     make(map[RequestID]Session),
 		originDialer: originDialer,
+		flows:        flows,
+		passthrough:  passthrough,
+		dscp:         dscp,
 		metrics:      metrics,
 		log:          log,
 	}
@@ -66,16 +79,30 @@ func (s *sessionManager) RegisterSession(request *UDPSessionRegistrationDatagram
 	if err != nil {
 		return nil, err
 	}
+	// Account the session in the flow table, the flow is closed with the origin connection.
+	flowEntry := s.flows.Open(flow.UDP, request.RequestID.String(), origin.LocalAddr().String(), request.Dest.String(), conn.ID())
+	flowEntry.OnCut(func() { _ = origin.Close() })
+	originProxy := flow.WrapOrigin(origin, flowEntry)
+	if s.dscp {
+		originProxy = ingress.NewDSCPOrigin(originProxy, origin)
+	}
 	// Create and insert the new session in the map
-	session := NewSession(
+	session := newSession(
 		request.RequestID,
 		request.IdleDurationHint,
-		origin,
+		originProxy,
 		origin.RemoteAddr(),
 		origin.LocalAddr(),
 		conn,
 		s.metrics,
-		s.log)
+		s.log,
+		s.passthrough,
+		flowEntry)
+	// Carry over the QoS marking of the eyeball packets to the origin-facing socket, later payloads of the flow can
+	// change it.
+	if request.DSCP != 0 {
+		session.MarkDSCP(request.DSCP)
+	}
 	s.sessions[request.RequestID] = session
 	return session, nil
 }
@@ -2,12 +2,15 @@ package v3_test
 
 import (
 	"errors"
+	"net"
 	"net/netip"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
 
 	"github.com/cloudflare/cloudflared/ingress"
 	v3 "github.com/cloudflare/cloudflared/quic/v3"
@@ -15,7 +18,7 @@ import (
 
 func TestRegisterSession(t *testing.T) {
 	log := zerolog.Nop()
-	manager := v3.NewSessionManager(&noopMetrics{}, &log, ingress.DialUDPAddrPort)
+	manager := v3.NewSessionManager(&noopMetrics{}, &log, ingress.DialUDPAddrPort, nil, false, false)
 
 	request := v3.UDPSessionRegistrationDatagram{
 		RequestID:        testRequestID,
@@ -71,10 +74,50 @@ func TestRegisterSession(t *testing.T) {
 
 func TestGetSession_Empty(t *testing.T) {
 	log := zerolog.Nop()
-	manager := v3.NewSessionManager(&noopMetrics{}, &log, ingress.DialUDPAddrPort)
+	manager := v3.NewSessionManager(&noopMetrics{}, &log, ingress.DialUDPAddrPort, nil, false, false)
 
 	_, err := manager.GetSession(testRequestID)
 	if !errors.Is(err, v3.ErrSessionNotFound) {
 		t.Fatalf("get session find no session: %v", err)
 	}
 }
+
+func TestRegisterSession_DSCP(t *testing.T) {
+	for _, dscp := range []bool{false, true} {
+		log := zerolog.Nop()
+		var origin *net.UDPConn
+		dialer := func(dest netip.AddrPort) (*net.UDPConn, error) {
+			conn, err := ingress.DialUDPAddrPort(dest)
+			origin = conn
+			return conn, err
+		}
+		manager := v3.NewSessionManager(&noopMetrics{}, &log, dialer, nil, false, dscp)
+
+		request := v3.UDPSessionRegistrationDatagram{
+			RequestID:        testRequestID,
+			Dest:             netip.MustParseAddrPort("127.0.0.1:5000"),
+			IdleDurationHint: 5 * time.Second,
+			DSCP:             46,
+		}
+		session, err := manager.RegisterSession(&request, &noopEyeball{})
+		require.NoError(t, err)
+
+		// The DSCP sent by the edge is only preserved when it was negotiated
+		expected := 0
+		if dscp {
+			expected = 46 << 2
+		}
+		tos, err := ipv4.NewConn(origin).TOS()
+		require.NoError(t, err)
+		require.Equal(t, expected, tos)
+
+		// The marking follows the DSCP of the payloads of the flow
+		if dscp {
+			session.MarkDSCP(10)
+			tos, err = ipv4.NewConn(origin).TOS()
+			require.NoError(t, err)
+			require.Equal(t, 10<<2, tos)
+		}
+		manager.UnregisterSession(request.RequestID)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/rs/zerolog"
 
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/packet"
 )
@@ -208,17 +209,28 @@ func (c *datagramConn) Serve(ctx context.Context) error {
 				c.handleSessionRegistrationDatagram(connCtx, reg, &logger)
 			case UDPSessionPayloadType:
 				payload := &UDPSessionPayloadDatagram{}
-				err := payload.UnmarshalBinary(datagram)
+				// The payload size is enforced by the session since passthrough sessions allow for larger payloads.
+				err := payload.unmarshalBinary(datagram, maxPassthroughPayloadPlusHeaderLen)
 				if err != nil {
+					flow.Dropped(flow.UDP, flow.DropMalformed)
 					c.logger.Err(err).Msgf("unable to unmarshal session payload datagram")
 					return
 				}
-				logger := c.logger.With().Str(logFlowID, payload.RequestID.String()).Logger()
-				c.handleSessionPayloadDatagram(payload, &logger)
+				c.handleSessionPayloadDatagram(payload)
+			case UDPSessionPayloadDSCPType:
+				payload := &UDPSessionPayloadDSCPDatagram{}
+				err := payload.unmarshalBinary(datagram, maxPassthroughPayloadPlusHeaderLen+sessionRegistrationDSCPLen)
+				if err != nil {
+					flow.Dropped(flow.UDP, flow.DropMalformed)
+					c.logger.Err(err).Msgf("unable to unmarshal session payload datagram")
+					return
+				}
+				c.handleSessionPayloadDSCPDatagram(payload)
 			case ICMPType:
 				packet := &ICMPDatagram{}
 				err := packet.UnmarshalBinary(datagram)
 				if err != nil {
+					flow.Dropped(flow.ICMP, flow.DropMalformed)
 					c.logger.Err(err).Msgf("unable to unmarshal icmp datagram")
 					return
 				}
@@ -344,16 +356,35 @@ func (c *datagramConn) handleSessionRegistrationFailure(requestID RequestID, log
 }
 
 // Handles incoming datagrams that need to be sent to a registered session.
-func (c *datagramConn) handleSessionPayloadDatagram(datagram *UDPSessionPayloadDatagram, logger *zerolog.Logger) {
+//
+// This is the hot path of the UDP proxy, so the flow logger is only created when an error needs to be reported.
+func (c *datagramConn) handleSessionPayloadDatagram(datagram *UDPSessionPayloadDatagram) {
 	s, err := c.sessionManager.GetSession(datagram.RequestID)
 	if err != nil {
-		logger.Err(err).Msgf("unable to find flow")
+		flow.Dropped(flow.UDP, flow.DropUnknownSession)
+		c.logger.Err(err).Str(logFlowID, datagram.RequestID.String()).Msgf("unable to find flow")
 		return
 	}
 	// We ignore the bytes written to the socket because any partial write must return an error.
 	_, err = s.Write(datagram.Payload)
 	if err != nil {
-		logger.Err(err).Msgf("unable to write payload for the flow")
+		c.logger.Err(err).Str(logFlowID, datagram.RequestID.String()).Msgf("unable to write payload for the flow")
+		return
+	}
+}
+
+// Handles incoming datagrams that need to be sent to a registered session with the DSCP of the eyeball packet.
+func (c *datagramConn) handleSessionPayloadDSCPDatagram(datagram *UDPSessionPayloadDSCPDatagram) {
+	s, err := c.sessionManager.GetSession(datagram.RequestID)
+	if err != nil {
+		flow.Dropped(flow.UDP, flow.DropUnknownSession)
+		c.logger.Err(err).Str(logFlowID, datagram.RequestID.String()).Msgf("unable to find flow")
+		return
+	}
+	s.MarkDSCP(datagram.DSCP)
+	_, err = s.Write(datagram.Payload)
+	if err != nil {
+		c.logger.Err(err).Str(logFlowID, datagram.RequestID.String()).Msgf("unable to write payload for the flow")
 		return
 	}
 }
@@ -362,6 +393,7 @@ func (c *datagramConn) handleSessionPayloadDatagram(datagram *UDPSessionPayloadD
 func (c *datagramConn) handleICMPPacket(datagram *ICMPDatagram) {
 	if c.icmpRouter == nil {
 		// ICMPRouter is disabled so we drop the current packet and ignore all incoming ICMP packets
+		flow.Dropped(flow.ICMP, flow.DropICMPDisabled)
 		return
 	}
 
@@ -369,6 +401,7 @@ func (c *datagramConn) handleICMPPacket(datagram *ICMPDatagram) {
 	rawPacket := packet.RawPacket{Data: datagram.Payload}
 	icmp, err := c.icmpDecoder.Decode(rawPacket)
 	if err != nil {
+		flow.Dropped(flow.ICMP, flow.DropMalformed)
 		c.logger.Err(err).Msgf("unable to marshal icmp packet")
 		return
 	}
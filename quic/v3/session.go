@@ -10,7 +10,11 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/quic-go/quic-go"
 	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/flow"
+	"github.com/cloudflare/cloudflared/ingress"
 )
 
 const (
@@ -55,6 +59,9 @@ type Session interface {
 	RemoteAddr() net.Addr
 	LocalAddr() net.Addr
 	ResetIdleTimer()
+	// MarkDSCP marks the packets written to the origin with the DSCP of the eyeball packets. It's a no-op when the
+	// origin doesn't support DSCP marking.
+	MarkDSCP(dscp uint8)
 	Migrate(eyeball DatagramConn, ctx context.Context, logger *zerolog.Logger)
 	// Serve starts the event loop for processing UDP packets
 	Serve(ctx context.Context) error
@@ -73,6 +80,11 @@ type session struct {
 	contextChan  chan context.Context
 	metrics      Metrics
 	log          *zerolog.Logger
+	// passthrough sessions carry encapsulated payloads larger than maxDatagramPayloadLen
+	passthrough   bool
+	maxPayloadLen int
+	// flow accounts the packets dropped by the session, it can be nil
+	flow *flow.Flow
 
 	// A special close function that we wrap with sync.Once to make sure it is only called once
 	closeFn func() error
@@ -88,6 +100,40 @@ func NewSession(
 	metrics Metrics,
 	log *zerolog.Logger,
 ) Session {
+	return newSession(id, closeAfterIdle, origin, originAddr, localAddr, eyeball, metrics, log, false, nil)
+}
+
+// NewPassthroughSession creates a [Session] for site-to-site encapsulated traffic. Payloads are proxied up to the size
+// that the QUIC connection can carry, and payloads that don't fit are dropped instead of closing the session.
+func NewPassthroughSession(
+	id RequestID,
+	closeAfterIdle time.Duration,
+	origin io.ReadWriteCloser,
+	originAddr net.Addr,
+	localAddr net.Addr,
+	eyeball DatagramConn,
+	metrics Metrics,
+	log *zerolog.Logger,
+) Session {
+	return newSession(id, closeAfterIdle, origin, originAddr, localAddr, eyeball, metrics, log, true, nil)
+}
+
+func newSession(
+	id RequestID,
+	closeAfterIdle time.Duration,
+	origin io.ReadWriteCloser,
+	originAddr net.Addr,
+	localAddr net.Addr,
+	eyeball DatagramConn,
+	metrics Metrics,
+	log *zerolog.Logger,
+	passthrough bool,
+	flowEntry *flow.Flow,
+) Session {
+	maxPayloadLen := maxDatagramPayloadLen
+	if passthrough {
+		maxPayloadLen = maxPassthroughPayloadLen
+	}
 	logger := log.With().Str(logFlowID, id.String()).Logger()
 	closeChan := make(chan error, 1)
 	session := &session{
@@ -102,9 +148,12 @@ func NewSession(
 		activeAtChan: make(chan time.Time, 1),
 		closeChan:    closeChan,
 		// contextChan is an unbounded channel to help enforce one active migration of a session at a time.
-		contextChan: make(chan context.Context),
-		metrics:     metrics,
-		log:         &logger,
+		contextChan:   make(chan context.Context),
+		metrics:       metrics,
+		log:           &logger,
+		passthrough:   passthrough,
+		maxPayloadLen: maxPayloadLen,
+		flow:          flowEntry,
 		closeFn: sync.OnceValue(func() error {
 			// We don't want to block on sending to the close channel if it is already full
 			select {
@@ -173,8 +222,10 @@ func (s *session) Serve(ctx context.Context) error {
 				s.log.Warn().Int(logPacketSizeKey, n).Msg("flow (origin) packet read was negative and was dropped")
 				continue
 			}
-			if n > maxDatagramPayloadLen {
+			if n > s.maxPayloadLen {
 				s.metrics.PayloadTooLarge()
+				s.flow.DropFromOrigin()
+				flow.Dropped(flow.UDP, flow.DropOversize)
 				s.log.Error().Int(logPacketSizeKey, n).Msg("flow (origin) packet read was too large and was dropped")
 				continue
 			}
@@ -184,6 +235,15 @@ func (s *session) Serve(ctx context.Context) error {
 			// Sending a packet to the session does block on the [quic.Connection], however, this is okay because it
 			// will cause back-pressure to the kernel buffer if the writes are not fast enough to the edge.
 			err = eyeball.SendUDPSessionDatagram(readBuffer[:DatagramPayloadHeaderLen+n])
+			if s.passthrough && errors.Is(err, &quic.DatagramTooLargeError{}) {
+				// The connection can't carry this payload at its current path MTU, the encapsulated protocol is
+				// expected to recover from the loss.
+				s.metrics.PayloadTooLarge()
+				s.flow.DropFromOrigin()
+				flow.Dropped(flow.UDP, flow.DropOversize)
+				s.log.Debug().Int(logPacketSizeKey, n).Msg("flow (origin) packet exceeds the connection datagram size and was dropped")
+				continue
+			}
 			if err != nil {
 				s.closeChan <- err
 				return
@@ -196,8 +256,16 @@ func (s *session) Serve(ctx context.Context) error {
 }
 
 func (s *session) Write(payload []byte) (n int, err error) {
+	if len(payload) > s.maxPayloadLen {
+		s.metrics.PayloadTooLarge()
+		s.flow.DropToOrigin()
+		flow.Dropped(flow.UDP, flow.DropOversize)
+		return 0, ErrDatagramPayloadTooLarge
+	}
 	n, err = s.origin.Write(payload)
 	if err != nil {
+		s.flow.DropToOrigin()
+		flow.Dropped(flow.UDP, flow.DropWriteFailed)
 		s.log.Err(err).Msg("failed to write payload to flow (remote)")
 		return n, err
 	}
@@ -211,6 +279,17 @@ func (s *session) Write(payload []byte) (n int, err error) {
 	return n, err
 }
 
+func (s *session) MarkDSCP(dscp uint8) {
+	marker, ok := s.origin.(ingress.DSCPMarker)
+	if !ok {
+		return
+	}
+	// Failing to mark the socket is not fatal for the flow, the packets are still proxied as best effort.
+	if err := marker.MarkDSCP(dscp); err != nil {
+		s.log.Debug().Err(err).Uint8("dscp", dscp).Msg("unable to preserve dscp marking for flow")
+	}
+}
+
 // ResetIdleTimer will restart the current idle timer.
 //
 // This public method is used to allow operators of sessions the ability to extend the session using information that is
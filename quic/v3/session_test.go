@@ -129,6 +129,44 @@ func TestSessionServe_OriginTooLarge(t *testing.T) {
 	}
 }
 
+func TestSessionWrite_TooLarge(t *testing.T) {
+	log := zerolog.Nop()
+	origin := newTestOrigin(makePayload(1280))
+	session := v3.NewSession(testRequestID, 5*time.Second, &origin, testOriginAddr, testLocalAddr, &noopEyeball{}, &noopMetrics{}, &log)
+	_, err := session.Write(makePayload(1281))
+	if !errors.Is(err, v3.ErrDatagramPayloadTooLarge) {
+		t.Fatal(err)
+	}
+}
+
+func TestPassthroughSessionServe_OriginLarge(t *testing.T) {
+	log := zerolog.Nop()
+	eyeball := newMockEyeball()
+	payload := makePayload(1400)
+	origin := newTestOrigin(payload)
+	session := v3.NewPassthroughSession(testRequestID, 2*time.Second, &origin, testOriginAddr, testLocalAddr, &eyeball, &noopMetrics{}, &log)
+	defer session.Close()
+
+	go session.Serve(context.Background())
+
+	select {
+	case data := <-eyeball.recvData:
+		if !slices.Equal(payload, data[17:]) {
+			t.Fatal("expected datagram did not equal expected")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("passthrough session should proxy payloads larger than 1280 bytes")
+	}
+
+	n, err := session.Write(makePayload(1400))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1400 {
+		t.Fatal("unable to write the whole payload")
+	}
+}
+
 func TestSessionServe_Migrate(t *testing.T) {
 	log := zerolog.Nop()
 	eyeball := newMockEyeball()
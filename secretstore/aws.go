@@ -0,0 +1,182 @@
+package secretstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	awsTimeFormat = "20060102T150405Z"
+
+	awsAccessKeyIDEnv     = "AWS_ACCESS_KEY_ID"
+	awsSecretAccessKeyEnv = "AWS_SECRET_ACCESS_KEY"
+	awsSessionTokenEnv    = "AWS_SESSION_TOKEN"
+	awsRegionEnv          = "AWS_REGION"
+	awsDefaultRegionEnv   = "AWS_DEFAULT_REGION"
+
+	// The credentials of EC2 instances are served on a link-local address
+	awsInstanceMetadataURL = "http://169.254.169.254"
+)
+
+// awsClient calls the JSON APIs of AWS services, such as Secrets Manager and KMS. The credentials come from the
+// default credential chain of the AWS SDKs, see credentials.
+type awsClient struct {
+	client *http.Client
+	// metadataClient has a short timeout, since the metadata services are unreachable outside of AWS
+	metadataClient *http.Client
+	now            func() time.Time
+}
+
+func newAWSClient() *awsClient {
+	return &awsClient{
+		client:         &http.Client{Timeout: DefaultTimeout},
+		metadataClient: &http.Client{Timeout: 2 * time.Second},
+		now:            time.Now,
+	}
+}
+
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"Token"`
+}
+
+type awsError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// awsRegion returns the region of the reference, or of the environment and the AWS profile.
+func awsRegion(ref *Reference) (string, error) {
+	region := ref.Query.Get("region")
+	if region == "" {
+		region = os.Getenv(awsRegionEnv)
+	}
+	if region == "" {
+		region = os.Getenv(awsDefaultRegionEnv)
+	}
+	if region == "" {
+		region = awsProfileRegion()
+	}
+	if region == "" {
+		return "", fmt.Errorf("no AWS region, set it with %s or the region parameter of the reference", awsRegionEnv)
+	}
+	return region, nil
+}
+
+// call sends the request to the JSON API of the service and decodes the response into v. endpointEnv overrides
+// the endpoint of the service, e.g. for a VPC endpoint.
+func (c *awsClient) call(ctx context.Context, service, region, endpointEnv, target string, request, v interface{}) error {
+	creds, err := c.credentials(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	endpoint := os.Getenv(endpointEnv)
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSRequest(req, body, creds, region, service, c.now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr awsError
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Type != "" {
+			// The type is prefixed with a namespace, e.g. com.amazonaws...#ResourceNotFoundException
+			errType := apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:]
+			return fmt.Errorf("%s returned %s: %s", service, errType, apiErr.Message)
+		}
+		return fmt.Errorf("%s returned %s", service, resp.Status)
+	}
+	if err := json.Unmarshal(respBody, v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", service, err)
+	}
+	return nil
+}
+
+// instanceCredentials returns the credentials of the role of the EC2 instance from IMDSv2.
+func (c *awsClient) instanceCredentials(ctx context.Context) (*awsCredentials, error) {
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodPut, awsInstanceMetadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	tokenResp, err := c.metadataClient.Do(tokenReq)
+	if err != nil {
+		return nil, err
+	}
+	defer tokenResp.Body.Close()
+	token, err := io.ReadAll(tokenResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("instance metadata service returned %s", tokenResp.Status)
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": []string{string(token)}}
+
+	const credentialsPath = "/latest/meta-data/iam/security-credentials/"
+	var role []byte
+	if err := c.getMetadata(ctx, awsInstanceMetadataURL+credentialsPath, header, &role); err != nil {
+		return nil, err
+	}
+	// The instance profile has a single role
+	roleName := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	creds := &awsCredentials{}
+	if err := c.getMetadataJSON(ctx, awsInstanceMetadataURL+credentialsPath+roleName, header, creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func (c *awsClient) getMetadataJSON(ctx context.Context, url string, header http.Header, v interface{}) error {
+	var body []byte
+	if err := c.getMetadata(ctx, url, header, &body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (c *awsClient) getMetadata(ctx context.Context, url string, header http.Header, body *[]byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := c.metadataClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("metadata service returned %s", resp.Status)
+	}
+	*body, err = io.ReadAll(resp.Body)
+	return err
+}
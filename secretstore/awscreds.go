@@ -0,0 +1,246 @@
+package secretstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+const (
+	awsProfileEnv               = "AWS_PROFILE"
+	awsSharedCredentialsFileEnv = "AWS_SHARED_CREDENTIALS_FILE"
+	awsConfigFileEnv            = "AWS_CONFIG_FILE"
+	awsSharedCredentialsFile    = "~/.aws/credentials"
+	awsConfigFile               = "~/.aws/config"
+	awsDefaultProfile           = "default"
+
+	// The web identity of IRSA on EKS, or of any OIDC provider trusted by the role
+	awsWebIdentityTokenFileEnv = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	awsRoleARNEnv              = "AWS_ROLE_ARN"
+	awsRoleSessionNameEnv      = "AWS_ROLE_SESSION_NAME"
+	awsSTSEndpointEnv          = "AWS_ENDPOINT_URL_STS"
+	awsDefaultRoleSessionName  = "cloudflared"
+
+	// The credentials of ECS tasks are served on a link-local address, the ones of EKS Pod Identity on a full URI
+	awsContainerCredentialsRelativeURIEnv = "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"
+	awsContainerCredentialsFullURIEnv     = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+	awsContainerAuthorizationTokenEnv     = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+	awsContainerAuthorizationTokenFileEnv = "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"
+	awsContainerCredentialsURL            = "http://169.254.170.2"
+)
+
+// credentials returns the credentials of the first source of the default credential chain of the AWS SDKs that has
+// some: the environment, the web identity of the environment, the AWS profile, the ECS task or EKS pod, and the role
+// of the EC2 instance.
+func (c *awsClient) credentials(ctx context.Context) (*awsCredentials, error) {
+	if accessKeyID := os.Getenv(awsAccessKeyIDEnv); accessKeyID != "" {
+		return &awsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: os.Getenv(awsSecretAccessKeyEnv),
+			SessionToken:    os.Getenv(awsSessionTokenEnv),
+		}, nil
+	}
+	if tokenFile := os.Getenv(awsWebIdentityTokenFileEnv); tokenFile != "" {
+		return c.webIdentityCredentials(ctx, tokenFile, os.Getenv(awsRoleARNEnv), os.Getenv(awsRoleSessionNameEnv))
+	}
+	profile, err := awsProfile()
+	if err != nil {
+		return nil, err
+	}
+	if accessKeyID := profile["aws_access_key_id"]; accessKeyID != "" {
+		return &awsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: profile["aws_secret_access_key"],
+			SessionToken:    profile["aws_session_token"],
+		}, nil
+	}
+	if tokenFile := profile["web_identity_token_file"]; tokenFile != "" {
+		return c.webIdentityCredentials(ctx, tokenFile, profile["role_arn"], profile["role_session_name"])
+	}
+	if creds, ok, err := c.containerCredentials(ctx); ok {
+		return creds, err
+	}
+	creds, err := c.instanceCredentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("no AWS credentials, set %s and %s, use an AWS profile or run with a role: %w", awsAccessKeyIDEnv, awsSecretAccessKeyEnv, err)
+	}
+	return creds, nil
+}
+
+type assumeRoleWithWebIdentityResponse struct {
+	Credentials struct {
+		AccessKeyID     string `xml:"AccessKeyId"`
+		SecretAccessKey string `xml:"SecretAccessKey"`
+		SessionToken    string `xml:"SessionToken"`
+	} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+type stsError struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+// webIdentityCredentials assumes the role with the web identity token of the file. The call to STS isn't signed, the
+// token is the proof of identity.
+func (c *awsClient) webIdentityCredentials(ctx context.Context, tokenFile, roleARN, sessionName string) (*awsCredentials, error) {
+	if roleARN == "" {
+		return nil, fmt.Errorf("%s is set without %s", awsWebIdentityTokenFileEnv, awsRoleARNEnv)
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the web identity token: %w", err)
+	}
+	if sessionName == "" {
+		sessionName = awsDefaultRoleSessionName
+	}
+	form := url.Values{
+		"Action":           []string{"AssumeRoleWithWebIdentity"},
+		"Version":          []string{"2011-06-15"},
+		"RoleArn":          []string{roleARN},
+		"RoleSessionName":  []string{sessionName},
+		"WebIdentityToken": []string{strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, awsSTSEndpoint(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr stsError
+		if xml.Unmarshal(body, &apiErr) == nil && apiErr.Code != "" {
+			return nil, fmt.Errorf("sts returned %s: %s", apiErr.Code, apiErr.Message)
+		}
+		return nil, fmt.Errorf("sts returned %s", resp.Status)
+	}
+	var assumed assumeRoleWithWebIdentityResponse
+	if err := xml.Unmarshal(body, &assumed); err != nil {
+		return nil, fmt.Errorf("invalid response from sts: %w", err)
+	}
+	return &awsCredentials{
+		AccessKeyID:     assumed.Credentials.AccessKeyID,
+		SecretAccessKey: assumed.Credentials.SecretAccessKey,
+		SessionToken:    assumed.Credentials.SessionToken,
+	}, nil
+}
+
+// awsSTSEndpoint returns the regional endpoint of STS when the region is known, and the global one otherwise.
+func awsSTSEndpoint() string {
+	if endpoint := os.Getenv(awsSTSEndpointEnv); endpoint != "" {
+		return endpoint
+	}
+	if region, err := awsRegion(&Reference{}); err == nil {
+		return fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+	}
+	return "https://sts.amazonaws.com/"
+}
+
+// containerCredentials returns the credentials of the ECS task or EKS pod, ok is false outside of them.
+func (c *awsClient) containerCredentials(ctx context.Context) (creds *awsCredentials, ok bool, err error) {
+	endpoint := os.Getenv(awsContainerCredentialsFullURIEnv)
+	if relativeURI := os.Getenv(awsContainerCredentialsRelativeURIEnv); relativeURI != "" {
+		endpoint = awsContainerCredentialsURL + relativeURI
+	}
+	if endpoint == "" {
+		return nil, false, nil
+	}
+	header := http.Header{}
+	token := os.Getenv(awsContainerAuthorizationTokenEnv)
+	if tokenFile := os.Getenv(awsContainerAuthorizationTokenFileEnv); tokenFile != "" {
+		content, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to read the container authorization token: %w", err)
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+	creds = &awsCredentials{}
+	if err := c.getMetadataJSON(ctx, endpoint, header, creds); err != nil {
+		return nil, true, fmt.Errorf("failed to get the credentials of the container: %w", err)
+	}
+	return creds, true, nil
+}
+
+// awsProfile returns the settings of the profile selected by AWS_PROFILE, from the config and the shared credentials
+// files. The credentials file takes precedence, like in the AWS CLI.
+func awsProfile() (map[string]string, error) {
+	name := os.Getenv(awsProfileEnv)
+	if name == "" {
+		name = awsDefaultProfile
+	}
+	configSection := "profile " + name
+	if name == awsDefaultProfile {
+		configSection = awsDefaultProfile
+	}
+	profile := make(map[string]string)
+	if err := readAWSProfile(awsConfigFileEnv, awsConfigFile, configSection, profile); err != nil {
+		return nil, err
+	}
+	if err := readAWSProfile(awsSharedCredentialsFileEnv, awsSharedCredentialsFile, name, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// awsProfileRegion returns the region of the AWS profile, if any.
+func awsProfileRegion() string {
+	profile, err := awsProfile()
+	if err != nil {
+		return ""
+	}
+	return profile["region"]
+}
+
+// readAWSProfile adds the keys of the section of the INI file to profile. A missing file has no keys.
+func readAWSProfile(fileEnv, defaultFile, section string, profile map[string]string) error {
+	path := os.Getenv(fileEnv)
+	if path == "" {
+		var err error
+		if path, err = homedir.Expand(defaultFile); err != nil {
+			return nil
+		}
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	inSection := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == section
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if inSection && ok {
+			profile[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,120 @@
+package secretstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isolateAWSEnv unsets the sources of the credential chain, so that the tests don't depend on the environment.
+func isolateAWSEnv(t *testing.T) string {
+	dir := t.TempDir()
+	for _, env := range []string{
+		awsAccessKeyIDEnv, awsSecretAccessKeyEnv, awsSessionTokenEnv, awsRegionEnv, awsDefaultRegionEnv, awsProfileEnv,
+		awsWebIdentityTokenFileEnv, awsRoleARNEnv, awsRoleSessionNameEnv, awsSTSEndpointEnv,
+		awsContainerCredentialsRelativeURIEnv, awsContainerCredentialsFullURIEnv,
+		awsContainerAuthorizationTokenEnv, awsContainerAuthorizationTokenFileEnv,
+	} {
+		t.Setenv(env, "")
+	}
+	t.Setenv(awsSharedCredentialsFileEnv, filepath.Join(dir, "credentials"))
+	t.Setenv(awsConfigFileEnv, filepath.Join(dir, "config"))
+	return dir
+}
+
+func TestAWSWebIdentityCredentials(t *testing.T) {
+	dir := isolateAWSEnv(t)
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/cloudflared", r.Form.Get("RoleArn"))
+		assert.Equal(t, "cloudflared", r.Form.Get("RoleSessionName"))
+		if r.Form.Get("WebIdentityToken") != "oidc-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<ErrorResponse><Error><Code>InvalidIdentityToken</Code><Message>Token is expired</Message></Error></ErrorResponse>`))
+			return
+		}
+		_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>` +
+			`<AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken>` +
+			`</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer sts.Close()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("oidc-token\n"), 0600))
+	t.Setenv(awsSTSEndpointEnv, sts.URL)
+	t.Setenv(awsWebIdentityTokenFileEnv, tokenFile)
+	t.Setenv(awsRoleARNEnv, "arn:aws:iam::123456789012:role/cloudflared")
+
+	creds, err := newAWSClient().credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &awsCredentials{AccessKeyID: "ASIA", SecretAccessKey: "secret", SessionToken: "session"}, creds)
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("expired"), 0600))
+	_, err = newAWSClient().credentials(context.Background())
+	assert.ErrorContains(t, err, "InvalidIdentityToken: Token is expired")
+}
+
+func TestAWSProfileCredentials(t *testing.T) {
+	dir := isolateAWSEnv(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "credentials"), []byte(`
+[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = default-secret
+
+[tunnels]
+aws_access_key_id = AKIDTUNNELS
+aws_secret_access_key = tunnels-secret
+`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte(`
+[default]
+region = us-east-1
+
+# the config file prefixes the profiles
+[profile tunnels]
+region = eu-west-1
+`), 0600))
+
+	creds, err := newAWSClient().credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &awsCredentials{AccessKeyID: "AKIDDEFAULT", SecretAccessKey: "default-secret"}, creds)
+	assert.Equal(t, "us-east-1", awsProfileRegion())
+
+	t.Setenv(awsProfileEnv, "tunnels")
+	creds, err = newAWSClient().credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &awsCredentials{AccessKeyID: "AKIDTUNNELS", SecretAccessKey: "tunnels-secret"}, creds)
+	region, err := awsRegion(&Reference{})
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+}
+
+func TestAWSContainerCredentials(t *testing.T) {
+	dir := isolateAWSEnv(t)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/credentials", r.URL.Path)
+		if r.Header.Get("Authorization") != "pod-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"AccessKeyId": "ASIA", "SecretAccessKey": "secret", "Token": "session"}`))
+	}))
+	defer agent.Close()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("pod-token"), 0600))
+	t.Setenv(awsContainerCredentialsFullURIEnv, agent.URL+"/v1/credentials")
+	t.Setenv(awsContainerAuthorizationTokenFileEnv, tokenFile)
+
+	creds, err := newAWSClient().credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &awsCredentials{AccessKeyID: "ASIA", SecretAccessKey: "secret", SessionToken: "session"}, creds)
+
+	t.Setenv(awsContainerAuthorizationTokenFileEnv, "")
+	_, err = newAWSClient().credentials(context.Background())
+	assert.ErrorContains(t, err, "401")
+}
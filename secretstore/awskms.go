@@ -0,0 +1,71 @@
+package secretstore
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	awsKMSService            = "kms"
+	awsGenerateDataKeyTarget = "TrentService.GenerateDataKey"
+	awsDecryptTarget         = "TrentService.Decrypt"
+	// awsKMSEndpointEnv overrides the endpoint of KMS, e.g. for a VPC endpoint
+	awsKMSEndpointEnv = "AWS_ENDPOINT_URL_KMS"
+)
+
+// awsKMSKey encrypts files with data keys of an AWS KMS key, only the encrypted data key is kept with the file.
+// References are awskms://<key ID, ARN or alias>, with the optional parameter region.
+type awsKMSKey struct {
+	aws *awsClient
+}
+
+type generateDataKeyRequest struct {
+	KeyID   string `json:"KeyId"`
+	KeySpec string `json:"KeySpec"`
+}
+
+type generateDataKeyResponse struct {
+	KeyID          string `json:"KeyId"`
+	CiphertextBlob []byte `json:"CiphertextBlob"`
+	Plaintext      []byte `json:"Plaintext"`
+}
+
+type kmsDecryptRequest struct {
+	KeyID          string `json:"KeyId"`
+	CiphertextBlob []byte `json:"CiphertextBlob"`
+}
+
+type kmsDecryptResponse struct {
+	Plaintext []byte `json:"Plaintext"`
+}
+
+// generateDataKey returns a new AES-256 key in plaintext and encrypted by the KMS key.
+func (k *awsKMSKey) generateDataKey(ctx context.Context, ref *Reference) (*kmsEnvelope, []byte, error) {
+	region, err := awsRegion(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	var dataKey generateDataKeyResponse
+	request := &generateDataKeyRequest{KeyID: ref.Name, KeySpec: "AES_256"}
+	if err := k.aws.call(ctx, awsKMSService, region, awsKMSEndpointEnv, awsGenerateDataKeyTarget, request, &dataKey); err != nil {
+		return nil, nil, err
+	}
+	if len(dataKey.Plaintext) != dataKeySize {
+		return nil, nil, fmt.Errorf("KMS returned a data key of %d bytes", len(dataKey.Plaintext))
+	}
+	// The ARN of the key is kept rather than an alias, which could be pointed to another key
+	keyID := dataKey.KeyID
+	if keyID == "" {
+		keyID = ref.Name
+	}
+	return &kmsEnvelope{KeyID: keyID, Region: region, EncryptedKey: dataKey.CiphertextBlob}, dataKey.Plaintext, nil
+}
+
+func (k *awsKMSKey) decryptDataKey(ctx context.Context, envelope *kmsEnvelope) ([]byte, error) {
+	var dataKey kmsDecryptResponse
+	request := &kmsDecryptRequest{KeyID: envelope.KeyID, CiphertextBlob: envelope.EncryptedKey}
+	if err := k.aws.call(ctx, awsKMSService, envelope.Region, awsKMSEndpointEnv, awsDecryptTarget, request, &dataKey); err != nil {
+		return nil, err
+	}
+	return dataKey.Plaintext, nil
+}
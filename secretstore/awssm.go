@@ -0,0 +1,60 @@
+package secretstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	awsSecretsManagerService = "secretsmanager"
+	awsGetSecretValueTarget  = "secretsmanager.GetSecretValue"
+	// awsEndpointEnv overrides the endpoint of Secrets Manager, e.g. for a VPC endpoint
+	awsEndpointEnv = "AWS_ENDPOINT_URL_SECRETS_MANAGER"
+)
+
+// AWSSecretsManagerBackend reads secrets from AWS Secrets Manager. References are awssm://<secret name or ARN>, with
+// the optional parameters region, key to pick a key of a JSON secret, and version-stage. The credentials come from
+// the default credential chain of the AWS SDKs, e.g. the environment, IRSA, an AWS profile or the role of the ECS
+// task or EC2 instance cloudflared runs on.
+type AWSSecretsManagerBackend struct {
+	aws *awsClient
+}
+
+func NewAWSSecretsManagerBackend() *AWSSecretsManagerBackend {
+	return &AWSSecretsManagerBackend{aws: newAWSClient()}
+}
+
+type getSecretValueRequest struct {
+	SecretID     string `json:"SecretId"`
+	VersionStage string `json:"VersionStage,omitempty"`
+}
+
+type getSecretValueResponse struct {
+	SecretString *string `json:"SecretString"`
+	SecretBinary []byte  `json:"SecretBinary"`
+}
+
+func (b *AWSSecretsManagerBackend) Fetch(ctx context.Context, ref *Reference) ([]byte, error) {
+	region, err := awsRegion(ref)
+	if err != nil {
+		return nil, err
+	}
+	var secret getSecretValueResponse
+	request := &getSecretValueRequest{SecretID: ref.Name, VersionStage: ref.Query.Get("version-stage")}
+	if err := b.aws.call(ctx, awsSecretsManagerService, region, awsEndpointEnv, awsGetSecretValueTarget, request, &secret); err != nil {
+		return nil, err
+	}
+	if secret.SecretString == nil {
+		return secret.SecretBinary, nil
+	}
+	key := ref.Query.Get("key")
+	if key == "" {
+		return []byte(*secret.SecretString), nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(*secret.SecretString), &fields); err != nil {
+		return nil, fmt.Errorf("the secret isn't a JSON object, it has no key %q", key)
+	}
+	return selectField(fields, key)
+}
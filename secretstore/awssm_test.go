@@ -0,0 +1,59 @@
+package secretstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSSecretsManagerBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, awsGetSecretValueTarget, r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request")
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+
+		var req getSecretValueRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		switch req.SecretID {
+		case "cloudflared/token":
+			_, _ = w.Write([]byte(`{"SecretString": "eyJhIjoi"}`))
+		case "cloudflared/tunnel":
+			assert.Equal(t, "AWSPREVIOUS", req.VersionStage)
+			_, _ = w.Write([]byte(`{"SecretString": "{\"token\": \"eyJhIjoi\"}"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type": "com.amazonaws.secretsmanager#ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv(awsEndpointEnv, server.URL)
+	t.Setenv(awsRegionEnv, "us-east-1")
+	t.Setenv(awsAccessKeyIDEnv, "AKID")
+	t.Setenv(awsSecretAccessKeyEnv, "secret")
+	t.Setenv(awsSessionTokenEnv, "session")
+
+	backend := NewAWSSecretsManagerBackend()
+	fetch := func(s string) ([]byte, error) {
+		ref, err := ParseReference(s)
+		require.NoError(t, err)
+		return backend.Fetch(context.Background(), ref)
+	}
+
+	secret, err := fetch("awssm://cloudflared/token?region=eu-west-1")
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", string(secret))
+
+	secret, err = fetch("awssm://cloudflared/tunnel?region=eu-west-1&key=token&version-stage=AWSPREVIOUS")
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", string(secret))
+
+	_, err = fetch("awssm://cloudflared/missing?region=eu-west-1")
+	assert.ErrorContains(t, err, "ResourceNotFoundException: Secrets Manager can't find the specified secret.")
+}
@@ -0,0 +1,199 @@
+package secretstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	encryptedFileVersion = 1
+	dataKeySize          = 32
+	pbkdf2Iterations     = 600000
+	pbkdf2SaltSize       = 16
+
+	// PassphraseKey encrypts files with a key derived from a passphrase
+	PassphraseKey = "passphrase"
+	awsKMSScheme  = "awskms"
+)
+
+// encryptedFileAAD binds the ciphertext to its use
+var encryptedFileAAD = []byte("cloudflared encrypted file")
+
+// ErrWrongPassphrase is returned when a file can't be decrypted with the passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted file")
+
+// encryptedFile is the JSON of an encrypted file, such as a tunnel credentials file encrypted at rest. The content is
+// encrypted with AES-256-GCM by a data key that is either derived from a passphrase, encrypted by a KMS key or sealed to
+// the TPM of the machine.
+type encryptedFile struct {
+	Version    int                 `json:"cloudflared_encrypted"`
+	Passphrase *passphraseEnvelope `json:"passphrase,omitempty"`
+	KMS        *kmsEnvelope        `json:"awskms,omitempty"`
+	TPM        *tpmEnvelope        `json:"tpm,omitempty"`
+	Nonce      []byte              `json:"nonce"`
+	Ciphertext []byte              `json:"ciphertext"`
+}
+
+type passphraseEnvelope struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+}
+
+type kmsEnvelope struct {
+	KeyID        string `json:"key_id"`
+	Region       string `json:"region"`
+	EncryptedKey []byte `json:"encrypted_key"`
+}
+
+// PassphraseFunc returns the passphrase of a file, confirm is set when the passphrase is chosen to encrypt a file.
+type PassphraseFunc func(confirm bool) (string, error)
+
+// IsEncrypted returns whether the content is an encrypted file.
+func IsEncrypted(content []byte) bool {
+	if !bytes.Contains(content, []byte(`"cloudflared_encrypted"`)) {
+		return false
+	}
+	var file encryptedFile
+	return json.Unmarshal(content, &file) == nil && file.Version > 0
+}
+
+// IsEncryptionKey returns whether key names a key Encrypt supports: passphrase, tpm, or an awskms:// reference.
+func IsEncryptionKey(key string) bool {
+	if key == PassphraseKey || key == TPMKey {
+		return true
+	}
+	ref, err := ParseReference(key)
+	return err == nil && ref.Scheme == awsKMSScheme
+}
+
+// Encrypt encrypts the content with a key derived from a passphrase if key is passphrase, with a data key sealed to the
+// TPM if key is tpm, or with a data key of the AWS KMS key if it's an awskms:// reference.
+func Encrypt(ctx context.Context, content []byte, key string, passphrase PassphraseFunc) ([]byte, error) {
+	file := &encryptedFile{Version: encryptedFileVersion}
+	var dataKey []byte
+	if key == PassphraseKey {
+		p, err := passphrase(true)
+		if err != nil {
+			return nil, err
+		}
+		if p == "" {
+			return nil, errors.New("the passphrase is empty")
+		}
+		file.Passphrase = &passphraseEnvelope{KDF: "pbkdf2-sha256", Iterations: pbkdf2Iterations, Salt: make([]byte, pbkdf2SaltSize)}
+		if _, err := rand.Read(file.Passphrase.Salt); err != nil {
+			return nil, err
+		}
+		dataKey = file.Passphrase.deriveKey(p)
+	} else if key == TPMKey {
+		dataKey = make([]byte, dataKeySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return nil, err
+		}
+		var err error
+		if file.TPM, err = sealDataKey(dataKey); err != nil {
+			return nil, fmt.Errorf("failed to seal the data key to the TPM: %w", err)
+		}
+	} else {
+		ref, err := ParseReference(key)
+		if err != nil || ref.Scheme != awsKMSScheme {
+			return nil, fmt.Errorf("unknown encryption key %q, expected %s, %s or %s://<key>", key, PassphraseKey, TPMKey, awsKMSScheme)
+		}
+		ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+		if file.KMS, dataKey, err = (&awsKMSKey{aws: newAWSClient()}).generateDataKey(ctx, ref); err != nil {
+			return nil, fmt.Errorf("failed to generate a data key with %s: %w", ref, err)
+		}
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return nil, err
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, content, encryptedFileAAD)
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// Decrypt decrypts an encrypted file, asking for the passphrase if it was encrypted with one.
+func Decrypt(ctx context.Context, content []byte, passphrase PassphraseFunc) ([]byte, error) {
+	var file encryptedFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid encrypted file: %w", err)
+	}
+	if file.Version != encryptedFileVersion {
+		return nil, fmt.Errorf("unsupported encrypted file version %d", file.Version)
+	}
+	var dataKey []byte
+	switch {
+	case file.Passphrase != nil:
+		if file.Passphrase.KDF != "pbkdf2-sha256" {
+			return nil, fmt.Errorf("unsupported key derivation %s", file.Passphrase.KDF)
+		}
+		if file.Passphrase.Iterations < 1 || file.Passphrase.Iterations > 100*pbkdf2Iterations {
+			return nil, fmt.Errorf("invalid key derivation iterations %d", file.Passphrase.Iterations)
+		}
+		p, err := passphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		dataKey = file.Passphrase.deriveKey(p)
+	case file.KMS != nil:
+		ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+		var err error
+		if dataKey, err = (&awsKMSKey{aws: newAWSClient()}).decryptDataKey(ctx, file.KMS); err != nil {
+			return nil, fmt.Errorf("failed to decrypt the data key with KMS key %s: %w", file.KMS.KeyID, err)
+		}
+	case file.TPM != nil:
+		var err error
+		if dataKey, err = unsealDataKey(file.TPM); err != nil {
+			return nil, fmt.Errorf("failed to unseal the data key, the file must be decrypted on the machine that encrypted it: %w", err)
+		}
+	default:
+		return nil, errors.New("the encrypted file has no key")
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid encrypted file: bad nonce")
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, encryptedFileAAD)
+	if err != nil {
+		if file.Passphrase != nil {
+			return nil, ErrWrongPassphrase
+		}
+		return nil, errors.New("the encrypted file is corrupted")
+	}
+	return plaintext, nil
+}
+
+func (e *passphraseEnvelope) deriveKey(passphrase string) []byte {
+	return pbkdf2.Key([]byte(passphrase), e.Salt, e.Iterations, dataKeySize, sha256.New)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("invalid data key of %d bytes", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
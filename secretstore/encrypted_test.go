@@ -0,0 +1,83 @@
+package secretstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func staticPassphrase(passphrase string) PassphraseFunc {
+	return func(bool) (string, error) { return passphrase, nil }
+}
+
+func TestEncryptWithPassphrase(t *testing.T) {
+	credentials := []byte(`{"AccountTag":"account","TunnelSecret":"c2VjcmV0","TunnelID":"df5ed608-b8b4-4109-89f3-9f2cf199df64"}`)
+	ctx := context.Background()
+
+	encrypted, err := Encrypt(ctx, credentials, PassphraseKey, staticPassphrase("correct horse"))
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.False(t, IsEncrypted(credentials))
+	assert.NotContains(t, string(encrypted), "c2VjcmV0")
+
+	decrypted, err := Decrypt(ctx, encrypted, staticPassphrase("correct horse"))
+	require.NoError(t, err)
+	assert.Equal(t, credentials, decrypted)
+
+	_, err = Decrypt(ctx, encrypted, staticPassphrase("battery staple"))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = Encrypt(ctx, credentials, PassphraseKey, staticPassphrase(""))
+	assert.Error(t, err)
+	_, err = Encrypt(ctx, credentials, "hsm", staticPassphrase("correct horse"))
+	assert.Error(t, err)
+}
+
+func TestEncryptWithAWSKMS(t *testing.T) {
+	dataKey := bytes.Repeat([]byte{7}, dataKeySize)
+	const keyARN = "arn:aws:kms:eu-west-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Amz-Target") {
+		case awsGenerateDataKeyTarget:
+			var req generateDataKeyRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "alias/cloudflared", req.KeyID)
+			assert.Equal(t, "AES_256", req.KeySpec)
+			_ = json.NewEncoder(w).Encode(&generateDataKeyResponse{KeyID: keyARN, CiphertextBlob: []byte("wrapped"), Plaintext: dataKey})
+		case awsDecryptTarget:
+			var req kmsDecryptRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, keyARN, req.KeyID)
+			assert.Equal(t, []byte("wrapped"), req.CiphertextBlob)
+			_ = json.NewEncoder(w).Encode(&kmsDecryptResponse{Plaintext: dataKey})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	t.Setenv(awsKMSEndpointEnv, server.URL)
+	t.Setenv(awsAccessKeyIDEnv, "AKID")
+	t.Setenv(awsSecretAccessKeyEnv, "secret")
+
+	ctx := context.Background()
+	noPassphrase := func(bool) (string, error) {
+		t.Fatal("the passphrase should not be asked for")
+		return "", nil
+	}
+	assert.True(t, IsEncryptionKey("awskms://alias/cloudflared?region=eu-west-1"))
+	assert.False(t, IsEncryptionKey("vault://secret/cloudflared"))
+
+	encrypted, err := Encrypt(ctx, []byte("credentials"), "awskms://alias/cloudflared?region=eu-west-1", noPassphrase)
+	require.NoError(t, err)
+	assert.Contains(t, string(encrypted), keyARN)
+
+	decrypted, err := Decrypt(ctx, encrypted, noPassphrase)
+	require.NoError(t, err)
+	assert.Equal(t, "credentials", string(decrypted))
+}
@@ -0,0 +1,39 @@
+package secretstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// selectField returns the field of a secret made of key/value pairs. Without a field, a secret with a single field
+// returns its value and other secrets return all their fields as JSON, e.g. a credentials file stored field by field.
+func selectField(fields map[string]interface{}, field string) ([]byte, error) {
+	if field == "" {
+		if len(fields) != 1 {
+			return json.Marshal(fields)
+		}
+		for _, value := range fields {
+			return fieldValue(value)
+		}
+	}
+	value, ok := fields[field]
+	if !ok {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("the secret has no field %q, its fields are %s", field, strings.Join(keys, ", "))
+	}
+	return fieldValue(value)
+}
+
+// fieldValue returns strings as is and other values as JSON.
+func fieldValue(value interface{}) ([]byte, error) {
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(value)
+}
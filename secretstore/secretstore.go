@@ -0,0 +1,129 @@
+// Package secretstore reads secrets, such as the tunnel token or credentials, from external secret stores so that
+// they don't have to be written to disk. Secrets are referenced with URIs whose scheme picks the backend, e.g.
+// vault://secret/cloudflared/tunnel?field=token or awssm://cloudflared/tunnel.
+package secretstore
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the requests made to fetch a secret.
+const DefaultTimeout = 30 * time.Second
+
+// Backend fetches secrets from a secret store.
+type Backend interface {
+	// Fetch returns the secret the reference points to.
+	Fetch(ctx context.Context, ref *Reference) ([]byte, error)
+}
+
+// Reference points to a secret in a backend, it's written scheme://name?query. The name is kept as is, so it can
+// contain characters such as the colons of an ARN.
+type Reference struct {
+	Scheme string
+	Name   string
+	Query  url.Values
+}
+
+func (r *Reference) String() string {
+	// The query is left out since it may contain e.g. a version, but never the secret
+	return r.Scheme + "://" + r.Name
+}
+
+var (
+	backendsLock sync.RWMutex
+	backends     = map[string]Backend{
+		"vault": NewVaultBackend(),
+		"awssm": NewAWSSecretsManagerBackend(),
+	}
+)
+
+// Register makes the backend available for the references with the scheme, replacing the current one if any.
+func Register(scheme string, backend Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	backends[scheme] = backend
+}
+
+func backend(scheme string) (Backend, bool) {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+	b, ok := backends[scheme]
+	return b, ok
+}
+
+// Schemes returns the schemes of the registered backends.
+func Schemes() []string {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// IsReference returns whether s references a secret of a registered backend rather than being a value or a path.
+func IsReference(s string) bool {
+	scheme, _, ok := strings.Cut(s, "://")
+	if !ok {
+		return false
+	}
+	_, ok = backend(scheme)
+	return ok
+}
+
+// ParseReference parses a scheme://name?query reference.
+func ParseReference(s string) (*Reference, error) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || scheme == "" {
+		return nil, fmt.Errorf("%q is not a secret reference, expected scheme://name", s)
+	}
+	name, rawQuery, _ := strings.Cut(rest, "?")
+	if name == "" {
+		return nil, fmt.Errorf("secret reference %s://%s has no name", scheme, rest)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("secret reference %s://%s has an invalid query: %w", scheme, name, err)
+	}
+	return &Reference{Scheme: scheme, Name: name, Query: query}, nil
+}
+
+// Resolve fetches the secret referenced by s from its backend.
+func Resolve(ctx context.Context, s string) ([]byte, error) {
+	ref, err := ParseReference(s)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := backend(ref.Scheme)
+	if !ok {
+		return nil, fmt.Errorf("unknown secret store %q, supported stores are %s", ref.Scheme, strings.Join(Schemes(), ", "))
+	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	secret, err := b.Fetch(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch secret %s: %w", ref, err)
+	}
+	return secret, nil
+}
+
+// ResolveString resolves s if it's a reference, and returns it as is otherwise. Surrounding whitespace, such as the
+// trailing newline of a secret written from a file, is trimmed from resolved secrets.
+func ResolveString(ctx context.Context, s string) (string, error) {
+	if !IsReference(s) {
+		return s, nil
+	}
+	secret, err := Resolve(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
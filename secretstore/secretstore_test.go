@@ -0,0 +1,80 @@
+package secretstore
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticBackend map[string]string
+
+func (b staticBackend) Fetch(_ context.Context, ref *Reference) ([]byte, error) {
+	secret, ok := b[ref.Name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return []byte(secret), nil
+}
+
+func TestParseReference(t *testing.T) {
+	ref, err := ParseReference("awssm://arn:aws:secretsmanager:us-east-1:123456789012:secret:tunnel?region=us-east-1&key=token")
+	require.NoError(t, err)
+	assert.Equal(t, &Reference{
+		Scheme: "awssm",
+		Name:   "arn:aws:secretsmanager:us-east-1:123456789012:secret:tunnel",
+		Query:  url.Values{"region": {"us-east-1"}, "key": {"token"}},
+	}, ref)
+	assert.Equal(t, "awssm://arn:aws:secretsmanager:us-east-1:123456789012:secret:tunnel", ref.String())
+
+	for _, invalid := range []string{"secret/tunnel", "vault://", "://secret", "vault://secret?%zz"} {
+		_, err := ParseReference(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestResolveString(t *testing.T) {
+	Register("test", staticBackend{"tunnel": "token\n"})
+
+	assert.True(t, IsReference("test://tunnel"))
+	assert.True(t, IsReference("vault://secret/tunnel"))
+	assert.False(t, IsReference("https://example.com"))
+	assert.False(t, IsReference("/etc/cloudflared/tunnel.json"))
+
+	token, err := ResolveString(context.Background(), "test://tunnel")
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	token, err = ResolveString(context.Background(), "eyJhIjoi")
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", token)
+
+	_, err = ResolveString(context.Background(), "test://missing")
+	assert.ErrorContains(t, err, "failed to fetch secret test://missing")
+}
+
+func TestSelectField(t *testing.T) {
+	fields := map[string]interface{}{"token": "eyJhIjoi", "credentials": map[string]interface{}{"TunnelID": "id"}}
+
+	value, err := selectField(fields, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", string(value))
+
+	value, err = selectField(fields, "credentials")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"TunnelID": "id"}`, string(value))
+
+	value, err = selectField(fields, "")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"token": "eyJhIjoi", "credentials": {"TunnelID": "id"}}`, string(value))
+
+	value, err = selectField(map[string]interface{}{"token": "eyJhIjoi"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", string(value))
+
+	_, err = selectField(fields, "secret")
+	assert.ErrorContains(t, err, "its fields are credentials, token")
+}
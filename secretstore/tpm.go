@@ -0,0 +1,275 @@
+package secretstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// TPMKey encrypts files with a data key sealed to the TPM of the machine, so that they can only be decrypted on it
+const TPMKey = "tpm"
+
+// The TPM 2.0 commands and structures of the TPM library specification part 2 and 3 that sealing needs
+const (
+	tpmSTNoSessions = 0x8001
+	tpmSTSessions   = 0x8002
+
+	tpmCCCreatePrimary = 0x131
+	tpmCCCreate        = 0x153
+	tpmCCLoad          = 0x157
+	tpmCCUnseal        = 0x15e
+	tpmCCFlushContext  = 0x165
+
+	tpmRHOwner = 0x40000001
+	// tpmRSPW is the password session, the objects are created without authorization values
+	tpmRSPW = 0x40000009
+
+	tpmAlgAES       = 0x0006
+	tpmAlgKeyedHash = 0x0008
+	tpmAlgSHA256    = 0x000b
+	tpmAlgNull      = 0x0010
+	tpmAlgECC       = 0x0023
+	tpmAlgCFB       = 0x0043
+	tpmECCNISTP256  = 0x0003
+
+	tpmAttrFixedTPM            = 1 << 1
+	tpmAttrFixedParent         = 1 << 4
+	tpmAttrSensitiveDataOrigin = 1 << 5
+	tpmAttrUserWithAuth        = 1 << 6
+	tpmAttrNoDA                = 1 << 10
+	tpmAttrRestricted          = 1 << 16
+	tpmAttrDecrypt             = 1 << 17
+
+	tpmMaxResponseSize = 4096
+)
+
+// tpmDevices are the TPM devices of Linux, the resource manager is preferred since it lets other processes use the TPM
+var tpmDevices = []string{"/dev/tpmrm0", "/dev/tpm0"}
+
+// openTPM opens the TPM of the machine, tests replace it with a simulated one.
+var openTPM = func() (io.ReadWriteCloser, error) {
+	for _, device := range tpmDevices {
+		tpm, err := os.OpenFile(device, os.O_RDWR, 0)
+		if err == nil {
+			return tpm, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to open the TPM: %w", err)
+		}
+	}
+	return nil, errors.New("no TPM found, encrypting with a TPM requires /dev/tpmrm0 on Linux")
+}
+
+// tpmEnvelope is the sealed data key, a keyed hash object of the storage primary key of the owner hierarchy. The
+// primary key isn't stored, the TPM derives the same one from its seed every time.
+type tpmEnvelope struct {
+	Public  []byte `json:"public"`
+	Private []byte `json:"private"`
+}
+
+type tpmError struct {
+	command uint32
+	code    uint32
+}
+
+func (e *tpmError) Error() string {
+	return fmt.Sprintf("TPM command 0x%x failed with response code 0x%x", e.command, e.code)
+}
+
+// sealDataKey seals the data key to the TPM.
+func sealDataKey(dataKey []byte) (*tpmEnvelope, error) {
+	tpm, err := openTPM()
+	if err != nil {
+		return nil, err
+	}
+	defer tpm.Close()
+	primary, err := tpmCreatePrimary(tpm)
+	if err != nil {
+		return nil, err
+	}
+	defer tpmFlushContext(tpm, primary)
+
+	var params bytes.Buffer
+	writeTPM2B(&params, tpmSensitiveCreate(dataKey))
+	writeTPM2B(&params, tpmSealedObjectTemplate())
+	writeTPM2B(&params, nil)
+	_ = binary.Write(&params, binary.BigEndian, uint32(0))
+	resp, err := tpmCommand(tpm, tpmCCCreate, []uint32{primary}, params.Bytes(), 0)
+	if err != nil {
+		return nil, err
+	}
+	envelope := &tpmEnvelope{}
+	if envelope.Private, err = readTPM2B(resp); err != nil {
+		return nil, err
+	}
+	if envelope.Public, err = readTPM2B(resp); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+// unsealDataKey unseals the data key with the TPM it was sealed to.
+func unsealDataKey(envelope *tpmEnvelope) ([]byte, error) {
+	tpm, err := openTPM()
+	if err != nil {
+		return nil, err
+	}
+	defer tpm.Close()
+	primary, err := tpmCreatePrimary(tpm)
+	if err != nil {
+		return nil, err
+	}
+	defer tpmFlushContext(tpm, primary)
+
+	var params bytes.Buffer
+	writeTPM2B(&params, envelope.Private)
+	writeTPM2B(&params, envelope.Public)
+	resp, err := tpmCommand(tpm, tpmCCLoad, []uint32{primary}, params.Bytes(), 1)
+	if err != nil {
+		return nil, err
+	}
+	var sealed uint32
+	if err := binary.Read(resp, binary.BigEndian, &sealed); err != nil {
+		return nil, err
+	}
+	defer tpmFlushContext(tpm, sealed)
+
+	if resp, err = tpmCommand(tpm, tpmCCUnseal, []uint32{sealed}, nil, 0); err != nil {
+		return nil, err
+	}
+	return readTPM2B(resp)
+}
+
+// tpmCreatePrimary returns the handle of the storage primary key of the owner hierarchy.
+func tpmCreatePrimary(tpm io.ReadWriter) (uint32, error) {
+	var params bytes.Buffer
+	writeTPM2B(&params, tpmSensitiveCreate(nil))
+	writeTPM2B(&params, tpmStorageKeyTemplate())
+	writeTPM2B(&params, nil)
+	_ = binary.Write(&params, binary.BigEndian, uint32(0))
+	resp, err := tpmCommand(tpm, tpmCCCreatePrimary, []uint32{tpmRHOwner}, params.Bytes(), 1)
+	if err != nil {
+		return 0, err
+	}
+	var handle uint32
+	err = binary.Read(resp, binary.BigEndian, &handle)
+	return handle, err
+}
+
+func tpmFlushContext(tpm io.ReadWriter, handle uint32) {
+	var cmd bytes.Buffer
+	_ = binary.Write(&cmd, binary.BigEndian, handle)
+	_, _ = tpmCommand(tpm, tpmCCFlushContext, nil, cmd.Bytes(), 0)
+}
+
+// tpmCommand sends the command with a password session for each handle, and returns the parameters of the response
+// after its outHandles handles.
+func tpmCommand(tpm io.ReadWriter, code uint32, handles []uint32, params []byte, outHandles int) (*bytes.Reader, error) {
+	var body bytes.Buffer
+	for _, handle := range handles {
+		_ = binary.Write(&body, binary.BigEndian, handle)
+	}
+	tag := uint16(tpmSTNoSessions)
+	if len(handles) > 0 {
+		tag = tpmSTSessions
+		// A password session with an empty password: handle, nonce, attributes and hmac
+		session := []byte{0x40, 0x00, 0x00, 0x09, 0, 0, 0, 0, 0}
+		_ = binary.Write(&body, binary.BigEndian, uint32(len(session)*len(handles)))
+		for range handles {
+			body.Write(session)
+		}
+	}
+	body.Write(params)
+
+	var cmd bytes.Buffer
+	_ = binary.Write(&cmd, binary.BigEndian, tag)
+	_ = binary.Write(&cmd, binary.BigEndian, uint32(10+body.Len()))
+	_ = binary.Write(&cmd, binary.BigEndian, code)
+	cmd.Write(body.Bytes())
+	if _, err := tpm.Write(cmd.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send a command to the TPM: %w", err)
+	}
+	resp := make([]byte, tpmMaxResponseSize)
+	n, err := tpm.Read(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response of the TPM: %w", err)
+	}
+	if n < 10 {
+		return nil, errors.New("truncated response from the TPM")
+	}
+	respTag := binary.BigEndian.Uint16(resp)
+	if size := binary.BigEndian.Uint32(resp[2:]); int(size) != n {
+		return nil, errors.New("truncated response from the TPM")
+	}
+	if rc := binary.BigEndian.Uint32(resp[6:]); rc != 0 {
+		return nil, &tpmError{command: code, code: rc}
+	}
+	r := bytes.NewReader(resp[10:n])
+	if respTag == tpmSTSessions {
+		// The handles come before the size of the parameters, the sessions after them
+		out := make([]byte, 4*outHandles)
+		if _, err := io.ReadFull(r, out); err != nil {
+			return nil, errors.New("truncated response from the TPM")
+		}
+		var paramSize uint32
+		if err := binary.Read(r, binary.BigEndian, &paramSize); err != nil || int(paramSize) > r.Len() {
+			return nil, errors.New("truncated response from the TPM")
+		}
+		rest := resp[n-r.Len() : n-r.Len()+int(paramSize)]
+		return bytes.NewReader(append(out, rest...)), nil
+	}
+	return r, nil
+}
+
+// tpmSensitiveCreate is a TPMS_SENSITIVE_CREATE without authorization value.
+func tpmSensitiveCreate(data []byte) []byte {
+	var b bytes.Buffer
+	writeTPM2B(&b, nil)
+	writeTPM2B(&b, data)
+	return b.Bytes()
+}
+
+// tpmStorageKeyTemplate is the TPMT_PUBLIC of the ECC P-256 storage key of the TCG provisioning guidance.
+func tpmStorageKeyTemplate() []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, []uint16{tpmAlgECC, tpmAlgSHA256})
+	_ = binary.Write(&b, binary.BigEndian, uint32(tpmAttrFixedTPM|tpmAttrFixedParent|tpmAttrSensitiveDataOrigin|
+		tpmAttrUserWithAuth|tpmAttrNoDA|tpmAttrRestricted|tpmAttrDecrypt))
+	writeTPM2B(&b, nil)
+	// AES-128-CFB to protect its children, no signing scheme, the P-256 curve and no KDF
+	_ = binary.Write(&b, binary.BigEndian, []uint16{tpmAlgAES, 128, tpmAlgCFB, tpmAlgNull, tpmECCNISTP256, tpmAlgNull})
+	writeTPM2B(&b, make([]byte, 32))
+	writeTPM2B(&b, make([]byte, 32))
+	return b.Bytes()
+}
+
+// tpmSealedObjectTemplate is the TPMT_PUBLIC of a keyed hash object holding data that only this TPM can unseal.
+func tpmSealedObjectTemplate() []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, []uint16{tpmAlgKeyedHash, tpmAlgSHA256})
+	_ = binary.Write(&b, binary.BigEndian, uint32(tpmAttrFixedTPM|tpmAttrFixedParent|tpmAttrUserWithAuth|tpmAttrNoDA))
+	writeTPM2B(&b, nil)
+	_ = binary.Write(&b, binary.BigEndian, uint16(tpmAlgNull))
+	writeTPM2B(&b, nil)
+	return b.Bytes()
+}
+
+func writeTPM2B(b *bytes.Buffer, data []byte) {
+	_ = binary.Write(b, binary.BigEndian, uint16(len(data)))
+	b.Write(data)
+}
+
+func readTPM2B(r *bytes.Reader) ([]byte, error) {
+	var size uint16
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, errors.New("truncated response from the TPM")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errors.New("truncated response from the TPM")
+	}
+	return data, nil
+}
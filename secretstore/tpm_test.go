@@ -0,0 +1,173 @@
+package secretstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	simulatedPrimaryHandle = 0x80000000
+	simulatedSealedHandle  = 0x80000001
+)
+
+// simulatedTPM answers the commands of sealing like a TPM, the sealed data is only obfuscated.
+type simulatedTPM struct {
+	t        *testing.T
+	loaded   map[uint32][]byte
+	response []byte
+	// rc fails the commands with this response code when set
+	rc uint32
+}
+
+func newSimulatedTPM(t *testing.T) *simulatedTPM {
+	return &simulatedTPM{t: t, loaded: make(map[uint32][]byte)}
+}
+
+func (s *simulatedTPM) Write(cmd []byte) (int, error) {
+	r := bytes.NewReader(cmd)
+	var header struct {
+		Tag  uint16
+		Size uint32
+		Code uint32
+	}
+	require.NoError(s.t, binary.Read(r, binary.BigEndian, &header))
+	require.Equal(s.t, len(cmd), int(header.Size))
+
+	var handle uint32
+	if header.Tag == tpmSTSessions {
+		require.NoError(s.t, binary.Read(r, binary.BigEndian, &handle))
+		var authSize uint32
+		require.NoError(s.t, binary.Read(r, binary.BigEndian, &authSize))
+		session := make([]byte, authSize)
+		_, _ = io.ReadFull(r, session)
+		require.Equal(s.t, []byte{0x40, 0, 0, 9, 0, 0, 0, 0, 0}, session)
+	}
+	if s.rc != 0 {
+		s.respond(tpmSTNoSessions, nil, nil, s.rc)
+		return len(cmd), nil
+	}
+
+	switch header.Code {
+	case tpmCCCreatePrimary:
+		require.Equal(s.t, uint32(tpmRHOwner), handle)
+		_, _ = readTPM2B(r)
+		template, _ := readTPM2B(r)
+		require.Equal(s.t, tpmStorageKeyTemplate(), template)
+		s.loaded[simulatedPrimaryHandle] = nil
+		s.respond(tpmSTSessions, []uint32{simulatedPrimaryHandle}, tpm2B(template), 0)
+	case tpmCCCreate:
+		require.Contains(s.t, s.loaded, handle)
+		sensitive, _ := readTPM2B(r)
+		sr := bytes.NewReader(sensitive)
+		userAuth, _ := readTPM2B(sr)
+		require.Empty(s.t, userAuth)
+		data, _ := readTPM2B(sr)
+		template, _ := readTPM2B(r)
+		require.Equal(s.t, tpmSealedObjectTemplate(), template)
+		s.respond(tpmSTSessions, nil, append(tpm2B(obfuscate(data)), tpm2B(template)...), 0)
+	case tpmCCLoad:
+		require.Contains(s.t, s.loaded, handle)
+		private, _ := readTPM2B(r)
+		s.loaded[simulatedSealedHandle] = obfuscate(private)
+		s.respond(tpmSTSessions, []uint32{simulatedSealedHandle}, nil, 0)
+	case tpmCCUnseal:
+		require.Contains(s.t, s.loaded, handle)
+		s.respond(tpmSTSessions, nil, tpm2B(s.loaded[handle]), 0)
+	case tpmCCFlushContext:
+		require.NoError(s.t, binary.Read(r, binary.BigEndian, &handle))
+		require.Contains(s.t, s.loaded, handle)
+		delete(s.loaded, handle)
+		s.respond(tpmSTNoSessions, nil, nil, 0)
+	default:
+		s.t.Fatalf("unexpected TPM command 0x%x", header.Code)
+	}
+	return len(cmd), nil
+}
+
+func (s *simulatedTPM) respond(tag uint16, handles []uint32, params []byte, rc uint32) {
+	var body bytes.Buffer
+	if rc == 0 {
+		for _, handle := range handles {
+			_ = binary.Write(&body, binary.BigEndian, handle)
+		}
+		if tag == tpmSTSessions {
+			_ = binary.Write(&body, binary.BigEndian, uint32(len(params)))
+			body.Write(params)
+			// The password session: nonce, attributes and hmac
+			body.Write([]byte{0, 0, 1, 0, 0})
+		} else {
+			body.Write(params)
+		}
+	}
+	var resp bytes.Buffer
+	_ = binary.Write(&resp, binary.BigEndian, tag)
+	_ = binary.Write(&resp, binary.BigEndian, uint32(10+body.Len()))
+	_ = binary.Write(&resp, binary.BigEndian, rc)
+	resp.Write(body.Bytes())
+	s.response = resp.Bytes()
+}
+
+func (s *simulatedTPM) Read(p []byte) (int, error) {
+	if s.response == nil {
+		return 0, errors.New("no command sent")
+	}
+	n := copy(p, s.response)
+	s.response = nil
+	return n, nil
+}
+
+func (s *simulatedTPM) Close() error {
+	return nil
+}
+
+func tpm2B(data []byte) []byte {
+	var b bytes.Buffer
+	writeTPM2B(&b, data)
+	return b.Bytes()
+}
+
+func obfuscate(data []byte) []byte {
+	result := make([]byte, len(data))
+	for i, b := range data {
+		result[i] = b ^ 0x5a
+	}
+	return result
+}
+
+func useSimulatedTPM(t *testing.T, tpm *simulatedTPM) {
+	previous := openTPM
+	openTPM = func() (io.ReadWriteCloser, error) { return tpm, nil }
+	t.Cleanup(func() { openTPM = previous })
+}
+
+func TestEncryptWithTPM(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+	useSimulatedTPM(t, tpm)
+	credentials := []byte(`{"AccountTag":"account","TunnelSecret":"c2VjcmV0","TunnelID":"df5ed608-b8b4-4109-89f3-9f2cf199df64"}`)
+	ctx := context.Background()
+
+	assert.True(t, IsEncryptionKey(TPMKey))
+	encrypted, err := Encrypt(ctx, credentials, TPMKey, nil)
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.Contains(t, string(encrypted), `"tpm"`)
+	// The primary key and the sealed object are flushed
+	assert.Empty(t, tpm.loaded)
+
+	decrypted, err := Decrypt(ctx, encrypted, nil)
+	require.NoError(t, err)
+	assert.Equal(t, credentials, decrypted)
+	assert.Empty(t, tpm.loaded)
+
+	// Another TPM, or one whose owner hierarchy requires a password, can't unseal the key
+	tpm.rc = 0x9a2
+	_, err = Decrypt(ctx, encrypted, nil)
+	assert.ErrorContains(t, err, "response code 0x9a2")
+}
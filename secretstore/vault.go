@@ -0,0 +1,181 @@
+package secretstore
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+const (
+	vaultAddrEnv      = "VAULT_ADDR"
+	vaultTokenEnv     = "VAULT_TOKEN"
+	vaultNamespaceEnv = "VAULT_NAMESPACE"
+	vaultCACertEnv    = "VAULT_CACERT"
+	vaultCAPathEnv    = "VAULT_CAPATH"
+	// vaultTokenFile is where the vault CLI keeps the token after vault login
+	vaultTokenFile = "~/.vault-token"
+)
+
+// VaultBackend reads secrets from the key/value secrets engine of HashiCorp Vault. References are
+// vault://<mount>/<path>, with the optional parameters field, version and kv=1 for version 1 of the engine. The
+// address and the token come from VAULT_ADDR and VAULT_TOKEN, or the token file of vault login, like the vault CLI.
+// The server certificate is verified with the CAs of VAULT_CACERT or VAULT_CAPATH when they are set.
+type VaultBackend struct{}
+
+func NewVaultBackend() *VaultBackend {
+	return &VaultBackend{}
+}
+
+type vaultResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []string        `json:"errors"`
+}
+
+func (b *VaultBackend) Fetch(ctx context.Context, ref *Reference) ([]byte, error) {
+	addr := os.Getenv(vaultAddrEnv)
+	if addr == "" {
+		return nil, fmt.Errorf("%s is not set", vaultAddrEnv)
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := vaultEndpoint(addr, ref)
+	if err != nil {
+		return nil, err
+	}
+	client, err := vaultClient()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv(vaultNamespaceEnv); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var parsed vaultResponse
+	if err := json.Unmarshal(body, &parsed); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("invalid response from Vault: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(parsed.Errors) > 0 {
+			return nil, fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(parsed.Errors, ", "))
+		}
+		return nil, fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	data := parsed.Data
+	if ref.Query.Get("kv") != "1" {
+		// Version 2 of the engine nests the secret with its metadata
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &versioned); err != nil {
+			return nil, fmt.Errorf("invalid secret from Vault: %w", err)
+		}
+		data = versioned.Data
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil, fmt.Errorf("the secret has no data, it may have been deleted")
+	}
+	return selectField(fields, ref.Query.Get("field"))
+}
+
+// vaultEndpoint returns the URL of the secret, /v1/<mount>/data/<path> for version 2 of the engine.
+func vaultEndpoint(addr string, ref *Reference) (string, error) {
+	mount, secretPath, ok := strings.Cut(strings.Trim(ref.Name, "/"), "/")
+	if !ok || secretPath == "" {
+		return "", fmt.Errorf("the Vault reference %s should be vault://<mount>/<path>", ref)
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(addr, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %w", vaultAddrEnv, err)
+	}
+	query := url.Values{}
+	if ref.Query.Get("kv") == "1" {
+		endpoint.Path = path.Join(endpoint.Path, "v1", mount, secretPath)
+	} else {
+		endpoint.Path = path.Join(endpoint.Path, "v1", mount, "data", secretPath)
+		if version := ref.Query.Get("version"); version != "" {
+			query.Set("version", version)
+		}
+	}
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// vaultClient returns a client trusting the CAs of the PEM file of VAULT_CACERT, or of the PEM files in the directory
+// of VAULT_CAPATH, instead of the system ones. VAULT_CACERT takes precedence, like in the vault CLI.
+func vaultClient() (*http.Client, error) {
+	var caFiles []string
+	if caCert := os.Getenv(vaultCACertEnv); caCert != "" {
+		caFiles = []string{caCert}
+	} else if caPath := os.Getenv(vaultCAPathEnv); caPath != "" {
+		entries, err := os.ReadDir(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", vaultCAPathEnv, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				caFiles = append(caFiles, filepath.Join(caPath, entry.Name()))
+			}
+		}
+	}
+	if len(caFiles) == 0 {
+		return &http.Client{Timeout: DefaultTimeout}, nil
+	}
+
+	pool := x509.NewCertPool()
+	for _, caFile := range caFiles {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the Vault CA: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificate in the Vault CA %s", caFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Timeout: DefaultTimeout, Transport: transport}, nil
+}
+
+func vaultToken() (string, error) {
+	if token := os.Getenv(vaultTokenEnv); token != "" {
+		return token, nil
+	}
+	tokenFile, err := homedir.Expand(vaultTokenFile)
+	if err != nil {
+		return "", err
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("%s is not set and there is no token in %s, log in with vault login", vaultTokenEnv, vaultTokenFile)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
@@ -0,0 +1,95 @@
+package secretstore
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/cloudflared/tunnel":
+			assert.Equal(t, "2", r.URL.Query().Get("version"))
+			_, _ = w.Write([]byte(`{"data": {"data": {"token": "eyJhIjoi"}, "metadata": {"version": 2}}}`))
+		case "/v1/kv/cloudflared/tunnel":
+			_, _ = w.Write([]byte(`{"data": {"token": "eyJhIjoi", "comment": "v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv(vaultAddrEnv, server.URL)
+	t.Setenv(vaultTokenEnv, "vault-token")
+
+	backend := NewVaultBackend()
+	fetch := func(s string) ([]byte, error) {
+		ref, err := ParseReference(s)
+		require.NoError(t, err)
+		return backend.Fetch(context.Background(), ref)
+	}
+
+	secret, err := fetch("vault://secret/cloudflared/tunnel?version=2")
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", string(secret))
+
+	secret, err = fetch("vault://kv/cloudflared/tunnel?kv=1&field=token")
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", string(secret))
+
+	_, err = fetch("vault://secret/cloudflared/missing")
+	assert.ErrorContains(t, err, "404")
+
+	_, err = fetch("vault://secret")
+	assert.ErrorContains(t, err, "vault://<mount>/<path>")
+
+	t.Setenv(vaultTokenEnv, "expired")
+	_, err = fetch("vault://secret/cloudflared/tunnel")
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestVaultBackendCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": {"data": {"token": "eyJhIjoi"}}}`))
+	}))
+	defer server.Close()
+	caDir := t.TempDir()
+	caFile := filepath.Join(caDir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	t.Setenv(vaultAddrEnv, server.URL)
+	t.Setenv(vaultTokenEnv, "vault-token")
+	t.Setenv(vaultCACertEnv, "")
+	t.Setenv(vaultCAPathEnv, "")
+
+	ref, err := ParseReference("vault://secret/cloudflared/tunnel?field=token")
+	require.NoError(t, err)
+	_, err = NewVaultBackend().Fetch(context.Background(), ref)
+	assert.ErrorContains(t, err, "certificate")
+
+	t.Setenv(vaultCAPathEnv, caDir)
+	secret, err := NewVaultBackend().Fetch(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", string(secret))
+
+	t.Setenv(vaultCACertEnv, caFile)
+	secret, err = NewVaultBackend().Fetch(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "eyJhIjoi", string(secret))
+
+	t.Setenv(vaultCACertEnv, filepath.Join(caDir, "missing.pem"))
+	_, err = NewVaultBackend().Fetch(context.Background(), ref)
+	assert.ErrorContains(t, err, "Vault CA")
+}
@@ -0,0 +1,29 @@
+// Package shellwords splits the commands configured by users, e.g. hooks, into their arguments the way a shell does.
+package shellwords
+
+import (
+	"strings"
+
+	"github.com/flynn/go-shlex"
+)
+
+// Split splits the command line into its arguments, honouring quotes and backslash escapes. Variables and globs are
+// not expanded, since the command isn't run by a shell.
+func Split(command string) ([]string, error) {
+	return shlex.Split(command)
+}
+
+// SplitWithArg splits the command line, then replaces the %s in its arguments with arg, or appends arg if none has it.
+func SplitWithArg(command, arg string) ([]string, error) {
+	args, err := Split(command)
+	if err != nil || len(args) == 0 {
+		return args, err
+	}
+	if !strings.Contains(command, "%s") {
+		return append(args, arg), nil
+	}
+	for i := range args {
+		args[i] = strings.ReplaceAll(args[i], "%s", arg)
+	}
+	return args, nil
+}
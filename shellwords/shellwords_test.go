@@ -0,0 +1,35 @@
+package shellwords
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	args, err := Split(`/usr/bin/notify --title "Tunnel ready" 'it'\''s up' a\ b`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/usr/bin/notify", "--title", "Tunnel ready", "it's up", "a b"}, args)
+
+	args, err = Split("  ")
+	require.NoError(t, err)
+	assert.Empty(t, args)
+
+	_, err = Split(`echo "unterminated`)
+	assert.Error(t, err)
+}
+
+func TestSplitWithArg(t *testing.T) {
+	args, err := SplitWithArg(`open -a "Google Chrome"`, "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"open", "-a", "Google Chrome", "https://example.com"}, args)
+
+	args, err = SplitWithArg(`firefox --new-window "url=%s"`, "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"firefox", "--new-window", "url=https://example.com"}, args)
+
+	args, err = SplitWithArg("", "https://example.com")
+	require.NoError(t, err)
+	assert.Empty(t, args)
+}
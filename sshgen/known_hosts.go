@@ -0,0 +1,145 @@
+package sshgen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// knownHostsComment marks the entries of the known hosts file that cloudflared manages
+	knownHostsComment = "cloudflared-access"
+	certAuthorityMark = "@cert-authority"
+)
+
+var (
+	// ErrHostCAChanged is returned when the CA pinned for a host is not the one that signs its certificates anymore.
+	ErrHostCAChanged = errors.New("the SSH certificate authority of the host changed")
+	// errHostCAFound aborts the SSH handshake once the host certificate is verified, nothing else is needed from the
+	// host.
+	errHostCAFound = errors.New("found the SSH certificate authority of the host")
+)
+
+// hostCertAlgorithms are the host key algorithms asked to the host, so that it presents its certificate instead of
+// its plain host key.
+var hostCertAlgorithms = []string{
+	gossh.CertAlgoED25519v01,
+	gossh.CertAlgoECDSA256v01,
+	gossh.CertAlgoECDSA384v01,
+	gossh.CertAlgoECDSA521v01,
+	gossh.CertAlgoRSASHA512v01,
+	gossh.CertAlgoRSASHA256v01,
+}
+
+// HostCertificateAuthority returns the public key of the CA that signed the host certificate that the SSH server on
+// conn presents for hostname. Only the key exchange happens, the user isn't authenticated. The certificate is checked
+// like ssh does, so its principals must include the hostname.
+func HostCertificateAuthority(conn net.Conn, hostname string) (gossh.PublicKey, error) {
+	var ca gossh.PublicKey
+	config := &gossh.ClientConfig{
+		User:              "cloudflared",
+		HostKeyAlgorithms: hostCertAlgorithms,
+		HostKeyCallback: func(_ string, _ net.Addr, key gossh.PublicKey) error {
+			cert, ok := key.(*gossh.Certificate)
+			if !ok {
+				return errors.New("the host doesn't present an SSH host certificate")
+			}
+			// The CA is being discovered, so the certificate is only checked to be valid and signed by the CA it names
+			var checker gossh.CertChecker
+			if err := checker.CheckCert(hostname, cert); err != nil {
+				return err
+			}
+			if cert.CertType != gossh.HostCert {
+				return errors.New("the host presents an SSH user certificate")
+			}
+			ca = cert.SignatureKey
+			return errHostCAFound
+		},
+	}
+	client, _, _, err := gossh.NewClientConn(conn, hostname, config)
+	if err == nil {
+		// The handshake can't succeed without a host key
+		_ = client.Close()
+	}
+	if ca == nil {
+		return nil, errors.Wrapf(err, "failed to get the SSH host certificate of %s", hostname)
+	}
+	return ca, nil
+}
+
+// PinnedHostCA returns the CA that cloudflared pinned for the hostname in the known hosts file, if any.
+func PinnedHostCA(knownHostsPath, hostname string) (gossh.PublicKey, bool, error) {
+	path, err := homedir.Expand(knownHostsPath)
+	if err != nil {
+		return nil, false, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to read the known hosts file")
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if pinned, ok := pinnedCA(scanner.Text(), hostname); ok {
+			return pinned, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// PinHostCA adds a @cert-authority entry for the hostname to the known hosts file, so that ssh verifies the host
+// certificates signed by the CA instead of asking to accept an unknown host key. It returns whether the entry was
+// added, and ErrHostCAChanged if another CA was pinned for the hostname, which is left for the user to review.
+func PinHostCA(knownHostsPath, hostname string, ca gossh.PublicKey) (bool, error) {
+	path, err := homedir.Expand(knownHostsPath)
+	if err != nil {
+		return false, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, errors.Wrap(err, "failed to read the known hosts file")
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		pinned, ok := pinnedCA(scanner.Text(), hostname)
+		if !ok {
+			continue
+		}
+		if bytes.Equal(pinned.Marshal(), ca.Marshal()) {
+			return false, nil
+		}
+		return false, errors.Wrapf(ErrHostCAChanged, "%s pins %s for %s", path, gossh.FingerprintSHA256(pinned), hostname)
+	}
+
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+	entry := fmt.Sprintf("%s %s %s %s\n", certAuthorityMark, hostname, strings.TrimSpace(string(gossh.MarshalAuthorizedKey(ca))), knownHostsComment)
+	if err := writeKey(path, append(content, entry...)); err != nil {
+		return false, errors.Wrap(err, "failed to write the known hosts file")
+	}
+	return true, nil
+}
+
+// pinnedCA returns the CA of a line if it's a @cert-authority entry that cloudflared added for the hostname.
+func pinnedCA(line, hostname string) (gossh.PublicKey, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 || fields[0] != certAuthorityMark || fields[1] != hostname || fields[4] != knownHostsComment {
+		return nil, false
+	}
+	ca, _, _, _, err := gossh.ParseAuthorizedKey([]byte(fields[2] + " " + fields[3]))
+	if err != nil {
+		return nil, false
+	}
+	return ca, true
+}
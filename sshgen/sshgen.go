@@ -74,6 +74,48 @@ func GenerateShortLivedCertificate(appURL *url.URL, token string) error {
 	return nil
 }
 
+// CertificateValidUntil returns when the short lived certificate stored for the application expires.
+func CertificateValidUntil(appURL *url.URL) (time.Time, error) {
+	cert, err := readCertificate(appURL)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if cert.ValidBefore == gossh.CertTimeInfinity {
+		return time.Unix(1<<62, 0), nil
+	}
+	return time.Unix(int64(cert.ValidBefore), 0), nil
+}
+
+// CertificateFile returns the path of the short lived certificate of the application.
+func CertificateFile(appURL *url.URL) (string, error) {
+	fullName, err := cfpath.GenerateSSHCertFilePathFromURL(appURL, keyName)
+	if err != nil {
+		return "", err
+	}
+	return fullName + "-cert.pub", nil
+}
+
+// readCertificate reads the short lived certificate stored for the application.
+func readCertificate(appURL *url.URL) (*gossh.Certificate, error) {
+	path, err := CertificateFile(appURL)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := gossh.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the short lived certificate")
+	}
+	cert, ok := pub.(*gossh.Certificate)
+	if !ok {
+		return nil, errors.New("the short lived certificate is not an SSH certificate")
+	}
+	return cert, nil
+}
+
 // handleCertificateGeneration takes a JWT and uses it build a signPayload
 // to send to the Sign endpoint with the public key from the keypair it generated
 func handleCertificateGeneration(token, fullName string) (string, error) {
@@ -183,12 +225,21 @@ func generateKeyPair(fullName string) ([]byte, error) {
 	return data, nil
 }
 
-// writeKey will write a key to disk in DER format (it's a standard pem key)
+// writeKey will write a key to disk in DER format (it's a standard pem key). The key is replaced atomically since ssh
+// may read it while a renewed certificate is written.
 func writeKey(filename string, data []byte) error {
 	filepath, err := homedir.Expand(filename)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filepath, data, 0600)
+	tmp := filepath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
 }
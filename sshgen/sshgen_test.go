@@ -3,11 +3,13 @@
 package sshgen
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -19,6 +21,7 @@ import (
 	"github.com/go-jose/go-jose/v4"
 	"github.com/go-jose/go-jose/v4/jwt"
 	"github.com/stretchr/testify/assert"
+	gossh "golang.org/x/crypto/ssh"
 
 	"github.com/cloudflare/cloudflared/config"
 	cfpath "github.com/cloudflare/cloudflared/token"
@@ -121,3 +124,137 @@ func tokenGenerator() string {
 
 	return signedToken
 }
+
+func TestCertificateValidUntil(t *testing.T) {
+	url, _ := url.Parse("https://cf-test-access.com/validity")
+	fullName, err := cfpath.GenerateSSHCertFilePathFromURL(url, keyName)
+	assert.NoError(t, err)
+	certKeyName := fullName + "-cert.pub"
+	defer os.Remove(certKeyName)
+
+	_, err = CertificateValidUntil(url)
+	assert.Error(t, err)
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	signer, err := gossh.NewSignerFromKey(caKey)
+	assert.NoError(t, err)
+	validBefore := time.Now().Add(3 * time.Minute).Truncate(time.Second)
+	cert := &gossh.Certificate{
+		Key:             signer.PublicKey(),
+		CertType:        gossh.UserCert,
+		ValidPrincipals: []string{"dalton"},
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	assert.NoError(t, cert.SignCert(rand.Reader, signer))
+	assert.NoError(t, writeKey(certKeyName, gossh.MarshalAuthorizedKey(cert)))
+
+	validUntil, err := CertificateValidUntil(url)
+	assert.NoError(t, err)
+	assert.True(t, validBefore.Equal(validUntil))
+
+	assert.NoError(t, writeKey(certKeyName, gossh.MarshalAuthorizedKey(signer.PublicKey())))
+	_, err = CertificateValidUntil(url)
+	assert.Error(t, err)
+}
+
+func TestPinHostCA(t *testing.T) {
+	knownHosts := t.TempDir() + "/known_hosts"
+	assert.NoError(t, os.WriteFile(knownHosts, []byte("example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDmV5ejsSO4JP1W2YlOzQyFUvoeZu8IiKfZ9NKTXUtBZ"), 0600))
+
+	newCA := func() gossh.PublicKey {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		signer, err := gossh.NewSignerFromKey(key)
+		assert.NoError(t, err)
+		return signer.PublicKey()
+	}
+	ca := newCA()
+
+	_, ok, err := PinnedHostCA(knownHosts, "ssh.example.com")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	added, err := PinHostCA(knownHosts, "ssh.example.com", ca)
+	assert.NoError(t, err)
+	assert.True(t, added)
+	pinned, ok, err := PinnedHostCA(knownHosts, "ssh.example.com")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, ca.Marshal(), pinned.Marshal())
+	added, err = PinHostCA(knownHosts, "ssh.example.com", ca)
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	content, err := os.ReadFile(knownHosts)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "example.com ssh-ed25519"))
+	marker, hosts, pubKey, _, _, err := gossh.ParseKnownHosts([]byte(lines[1]))
+	assert.NoError(t, err)
+	assert.Equal(t, "cert-authority", marker)
+	assert.Equal(t, []string{"ssh.example.com"}, hosts)
+	assert.Equal(t, ca.Marshal(), pubKey.Marshal())
+
+	_, err = PinHostCA(knownHosts, "ssh.example.com", newCA())
+	assert.ErrorIs(t, err, ErrHostCAChanged)
+	added, err = PinHostCA(knownHosts, "git.example.com", newCA())
+	assert.NoError(t, err)
+	assert.True(t, added)
+}
+
+func TestHostCertificateAuthority(t *testing.T) {
+	newSigner := func() gossh.Signer {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+		signer, err := gossh.NewSignerFromKey(key)
+		assert.NoError(t, err)
+		return signer
+	}
+	ca := newSigner()
+	hostKey := newSigner()
+	hostCertificate := func(certType uint32) gossh.Signer {
+		cert := &gossh.Certificate{
+			Key:             hostKey.PublicKey(),
+			CertType:        certType,
+			ValidPrincipals: []string{"ssh.example.com"},
+			ValidBefore:     gossh.CertTimeInfinity,
+		}
+		assert.NoError(t, cert.SignCert(rand.Reader, ca))
+		signer, err := gossh.NewCertSigner(cert, hostKey)
+		assert.NoError(t, err)
+		return signer
+	}
+	hostCA := func(hostKey gossh.Signer, hostname string) (gossh.PublicKey, error) {
+		config := &gossh.ServerConfig{NoClientAuth: true}
+		config.AddHostKey(hostKey)
+		// Both ends of the handshake write their version first, so they can't be connected with a synchronous pipe
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			serverConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer serverConn.Close()
+			_, _, _, _ = gossh.NewServerConn(serverConn, config)
+		}()
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+		return HostCertificateAuthority(conn, hostname)
+	}
+
+	pinned, err := hostCA(hostCertificate(gossh.HostCert), "ssh.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, ca.PublicKey().Marshal(), pinned.Marshal())
+
+	// The certificate of the host must be a host certificate valid for the hostname, like ssh requires
+	_, err = hostCA(hostCertificate(gossh.HostCert), "git.example.com")
+	assert.Error(t, err)
+	_, err = hostCA(hostCertificate(gossh.UserCert), "ssh.example.com")
+	assert.Error(t, err)
+	_, err = hostCA(hostKey, "ssh.example.com")
+	assert.Error(t, err)
+}
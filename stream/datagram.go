@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxDatagramSize is the largest datagram that can be framed, the length prefix is 2 bytes
+	MaxDatagramSize = 65535
+
+	datagramHeaderLen = 2
+)
+
+var errDatagramTooLarge = errors.New("datagram is too large to be framed")
+
+// EncodeDatagram appends the payload prefixed with its length to dst. Datagrams are carried over streams, such as
+// the WebSocket connections of cloudflared access, in this framing so that their boundaries are kept.
+func EncodeDatagram(dst, payload []byte) ([]byte, error) {
+	if len(payload) > MaxDatagramSize {
+		return dst, errDatagramTooLarge
+	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(payload)))
+	return append(dst, payload...), nil
+}
+
+// DatagramDecoder splits a stream of framed datagrams, which can be read in arbitrary chunks, into datagrams.
+type DatagramDecoder struct {
+	buf []byte
+}
+
+// Feed consumes a chunk of the stream and calls emit for each datagram it completes. The datagram is only valid
+// until emit returns.
+func (d *DatagramDecoder) Feed(p []byte, emit func(datagram []byte) error) error {
+	d.buf = append(d.buf, p...)
+	for len(d.buf) >= datagramHeaderLen {
+		size := int(binary.BigEndian.Uint16(d.buf))
+		if len(d.buf) < datagramHeaderLen+size {
+			break
+		}
+		if err := emit(d.buf[datagramHeaderLen : datagramHeaderLen+size]); err != nil {
+			return err
+		}
+		d.buf = d.buf[datagramHeaderLen+size:]
+	}
+	// Don't keep growing the buffer of a long lived stream
+	if len(d.buf) == 0 {
+		d.buf = d.buf[:0:0]
+	}
+	return nil
+}
+
+// DatagramConn carries the datagrams of a connected UDP socket as a stream of framed datagrams, so that it can be
+// piped to a stream like a TCP connection. Reads return io.EOF once no datagram was sent or received for the idle
+// timeout.
+type DatagramConn struct {
+	net.Conn
+	idleTimeout time.Duration
+
+	readBuf []byte
+	pending []byte
+	decoder DatagramDecoder
+
+	lock         sync.Mutex
+	lastActivity time.Time
+}
+
+// NewDatagramConn wraps a connected UDP socket, it's up to the caller to close it.
+func NewDatagramConn(conn net.Conn, idleTimeout time.Duration) *DatagramConn {
+	return &DatagramConn{
+		Conn:         conn,
+		idleTimeout:  idleTimeout,
+		readBuf:      make([]byte, MaxDatagramSize),
+		lastActivity: time.Now(),
+	}
+}
+
+// Read returns the framed datagrams received on the socket.
+func (c *DatagramConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		_ = c.Conn.SetReadDeadline(c.idleDeadline())
+		n, err := c.Conn.Read(c.readBuf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// The deadline is extended by the datagrams written in the meantime
+			if time.Now().Before(c.idleDeadline()) {
+				continue
+			}
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.touch()
+		c.pending, _ = EncodeDatagram(c.pending[:0], c.readBuf[:n])
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends the datagrams framed in p to the socket, p doesn't need to end on a datagram boundary.
+func (c *DatagramConn) Write(p []byte) (int, error) {
+	err := c.decoder.Feed(p, func(datagram []byte) error {
+		c.touch()
+		_, err := c.Conn.Write(datagram)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *DatagramConn) touch() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lastActivity = time.Now()
+}
+
+func (c *DatagramConn) idleDeadline() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lastActivity.Add(c.idleTimeout)
+}
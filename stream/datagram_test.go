@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatagramDecoder(t *testing.T) {
+	framed, err := EncodeDatagram(nil, []byte("first"))
+	require.NoError(t, err)
+	framed, err = EncodeDatagram(framed, nil)
+	require.NoError(t, err)
+	framed, err = EncodeDatagram(framed, []byte("third"))
+	require.NoError(t, err)
+
+	var decoder DatagramDecoder
+	var datagrams []string
+	// The stream is read in chunks that don't end on datagram boundaries
+	for i := 0; i < len(framed); i += 3 {
+		end := min(i+3, len(framed))
+		require.NoError(t, decoder.Feed(framed[i:end], func(datagram []byte) error {
+			datagrams = append(datagrams, string(datagram))
+			return nil
+		}))
+	}
+	assert.Equal(t, []string{"first", "", "third"}, datagrams)
+
+	_, err = EncodeDatagram(nil, make([]byte, MaxDatagramSize+1))
+	assert.Error(t, err)
+}
+
+func TestDatagramConn(t *testing.T) {
+	origin, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer origin.Close()
+	go func() {
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, addr, err := origin.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = origin.WriteTo(append([]byte("echo "), buf[:n]...), addr)
+		}
+	}()
+
+	udpConn, err := net.Dial("udp", origin.LocalAddr().String())
+	require.NoError(t, err)
+	defer udpConn.Close()
+	conn := NewDatagramConn(udpConn, 200*time.Millisecond)
+
+	framed, err := EncodeDatagram(nil, []byte("ping"))
+	require.NoError(t, err)
+	_, err = conn.Write(framed)
+	require.NoError(t, err)
+
+	expected, err := EncodeDatagram(nil, []byte("echo ping"))
+	require.NoError(t, err)
+	reply := make([]byte, len(expected))
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	assert.Equal(t, expected, reply)
+
+	// Reads end once the socket is idle
+	_, err = conn.Read(reply)
+	assert.Equal(t, io.EOF, err)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"runtime/debug"
 	"sync/atomic"
 	"time"
@@ -131,13 +132,41 @@ func unidirectionalStream(dst WriterCloser, src Reader, dir string, status *bidi
 
 	defer dst.CloseWrite()
 
-	_, err := copyData(dst, src, dir)
+	_, err := copyStream(dst, src, dir)
 	if err != nil {
 		log.Debug().Msgf("%s copy: %v", dir, err)
 	}
 	status.markUniStreamDone()
 }
 
+// copyStream copies src to dst. When both ends are sockets, e.g. TCP connections, the net package splices between
+// them on Linux instead of copying through user space. Otherwise the ends are copied through the pooled buffers of
+// copyData.
+func copyStream(dst WriterCloser, src Reader, dir string) (int64, error) {
+	dstConn, srcConn := unwrap(dst), unwrap(src)
+	if isSocket(dstConn) && isSocket(srcConn) {
+		return io.Copy(dstConn.(io.Writer), srcConn.(io.Reader))
+	}
+	return copyData(dst, src, dir)
+}
+
+// unwrap returns the stream under a nopCloseWriterAdapter.
+func unwrap(stream any) any {
+	if adapter, ok := stream.(*nopCloseWriterAdapter); ok {
+		return adapter.ReadWriter
+	}
+	return stream
+}
+
+func isSocket(stream any) bool {
+	switch stream.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		return true
+	default:
+		return false
+	}
+}
+
 // when set to true, enables logging of content copied to/from origin and tunnel
 const debugCopy = false
 
@@ -3,6 +3,8 @@ package stream
 import (
 	"fmt"
 	"io"
+	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -120,3 +122,77 @@ func (m *mockedStream) closeReader() {
 func (m *mockedStream) writeToReader(content string) {
 	m.readCh <- &content
 }
+
+type readerFromConn struct {
+	io.ReadWriter
+	readFrom bool
+}
+
+func (c *readerFromConn) ReadFrom(r io.Reader) (int64, error) {
+	c.readFrom = true
+	return io.Copy(c.ReadWriter, r)
+}
+
+func TestPipeCopiesThroughBuffer(t *testing.T) {
+	tunnel := &readerFromConn{ReadWriter: &readWriter{reader: strings.NewReader("to origin")}}
+	origin := &readerFromConn{ReadWriter: &readWriter{reader: strings.NewReader("to tunnel")}}
+	log := zerolog.Nop()
+
+	require.NoError(t, PipeBidirectional(NopCloseWriterAdapter(tunnel), NopCloseWriterAdapter(origin), time.Second, &log))
+
+	// Only sockets are copied with their io.ReaderFrom, the other streams use the pooled buffers
+	require.False(t, tunnel.readFrom)
+	require.False(t, origin.readFrom)
+	require.Equal(t, "to tunnel", tunnel.ReadWriter.(*readWriter).written.String())
+	require.Equal(t, "to origin", origin.ReadWriter.(*readWriter).written.String())
+}
+
+func TestPipeBetweenSockets(t *testing.T) {
+	tunnelClient, tunnel := tcpPair(t)
+	origin, originServer := tcpPair(t)
+	require.True(t, isSocket(unwrap(NopCloseWriterAdapter(tunnel))))
+	log := zerolog.Nop()
+	go Pipe(tunnel, origin, &log)
+
+	_, err := tunnelClient.Write([]byte("to origin"))
+	require.NoError(t, err)
+	buf := make([]byte, len("to origin"))
+	_, err = io.ReadFull(originServer, buf)
+	require.NoError(t, err)
+	require.Equal(t, "to origin", string(buf))
+
+	_, err = originServer.Write([]byte("to tunnel"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(tunnelClient, buf)
+	require.NoError(t, err)
+	require.Equal(t, "to tunnel", string(buf))
+}
+
+// tcpPair returns both ends of a TCP connection.
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	server, err := listener.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client.(*net.TCPConn), server.(*net.TCPConn)
+}
+
+type readWriter struct {
+	reader  io.Reader
+	written strings.Builder
+}
+
+func (rw *readWriter) Read(p []byte) (int, error) {
+	return rw.reader.Read(p)
+}
+
+func (rw *readWriter) Write(p []byte) (int, error) {
+	return rw.written.Write(p)
+}
@@ -1,6 +1,7 @@
 package supervisor
 
 import (
+	"sync"
 	"time"
 )
 
@@ -19,3 +20,75 @@ func (r ReconnectSignal) DelayBeforeReconnect() {
 		time.Sleep(r.Delay)
 	}
 }
+
+// ConnectionDrainer drains specific edge connections of a tunnel on demand, e.g. from the control API. A drained
+// connection is unregistered from the edge, serves its in-flight requests for the grace period and reconnects.
+type ConnectionDrainer struct {
+	lock   sync.Mutex
+	drains map[uint8]chan struct{}
+}
+
+func NewConnectionDrainer() *ConnectionDrainer {
+	return &ConnectionDrainer{drains: make(map[uint8]chan struct{})}
+}
+
+// Drain starts draining the connection at the index, it returns false if the connection isn't being served or is
+// already draining.
+func (d *ConnectionDrainer) Drain(connIndex uint8) bool {
+	if d == nil {
+		return false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	drainC, ok := d.drains[connIndex]
+	if !ok {
+		return false
+	}
+	delete(d.drains, connIndex)
+	close(drainC)
+	return true
+}
+
+// watch returns the channel closed when the connection at the index must be gracefully shut down, because it is
+// drained or because the tunnel is shutting down, and the function to call once the connection is served, which
+// returns whether it was drained. A nil ConnectionDrainer only shuts the connections down with the tunnel.
+func (d *ConnectionDrainer) watch(connIndex uint8, gracefulShutdownC <-chan struct{}) (<-chan struct{}, func() bool) {
+	if d == nil {
+		return gracefulShutdownC, func() bool { return false }
+	}
+	drainC := make(chan struct{})
+	d.lock.Lock()
+	d.drains[connIndex] = drainC
+	d.lock.Unlock()
+
+	shutdownC := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-gracefulShutdownC:
+		case <-drainC:
+		case <-done:
+			return
+		}
+		close(shutdownC)
+	}()
+	return shutdownC, func() bool {
+		close(done)
+		d.lock.Lock()
+		if d.drains[connIndex] == drainC {
+			delete(d.drains, connIndex)
+		}
+		d.lock.Unlock()
+		select {
+		case <-gracefulShutdownC:
+			return false
+		default:
+		}
+		select {
+		case <-drainC:
+			return true
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionDrainer(t *testing.T) {
+	drainer := NewConnectionDrainer()
+	gracefulShutdownC := make(chan struct{})
+	assert.False(t, drainer.Drain(0), "the connection isn't served")
+
+	shutdownC, drained := drainer.watch(0, gracefulShutdownC)
+	assert.False(t, drainer.Drain(1))
+	require.True(t, drainer.Drain(0))
+	assert.False(t, drainer.Drain(0), "the connection is already draining")
+	select {
+	case <-shutdownC:
+	case <-time.After(time.Second):
+		require.Fail(t, "the connection wasn't shut down")
+	}
+	assert.True(t, drained())
+}
+
+func TestConnectionDrainerShutdown(t *testing.T) {
+	drainer := NewConnectionDrainer()
+	gracefulShutdownC := make(chan struct{})
+
+	shutdownC, drained := drainer.watch(0, gracefulShutdownC)
+	close(gracefulShutdownC)
+	select {
+	case <-shutdownC:
+	case <-time.After(time.Second):
+		require.Fail(t, "the connection wasn't shut down")
+	}
+	assert.False(t, drained(), "the connection is shut down with the tunnel")
+	assert.False(t, drainer.Drain(0), "the connection is no longer served")
+}
+
+func TestNilConnectionDrainer(t *testing.T) {
+	var drainer *ConnectionDrainer
+	gracefulShutdownC := make(chan struct{})
+	shutdownC, drained := drainer.watch(0, gracefulShutdownC)
+	assert.Equal(t, (<-chan struct{})(gracefulShutdownC), shutdownC)
+	assert.False(t, drained())
+}
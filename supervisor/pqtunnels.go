@@ -3,6 +3,7 @@ package supervisor
 import (
 	"crypto/tls"
 	"fmt"
+	"slices"
 
 	"github.com/cloudflare/cloudflared/features"
 )
@@ -31,6 +32,10 @@ func curvePreference(pqMode features.PostQuantumMode, currentCurve []tls.CurveID
 			return append([]tls.CurveID{PQKex}, currentCurve...), nil
 		}
 		return currentCurve, nil
+	case features.PostQuantumDisabled:
+		return slices.DeleteFunc(slices.Clone(currentCurve), func(curve tls.CurveID) bool {
+			return curve == PQKex
+		}), nil
 	default:
 		return nil, fmt.Errorf("Unexpected post quantum mode")
 	}
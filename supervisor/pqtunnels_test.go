@@ -0,0 +1,35 @@
+package supervisor
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/features"
+)
+
+func TestCurvePreference(t *testing.T) {
+	fipsCurves := []tls.CurveID{tls.CurveP256, tls.CurveP384}
+	tests := []struct {
+		name     string
+		pqMode   features.PostQuantumMode
+		curves   []tls.CurveID
+		expected []tls.CurveID
+	}{
+		{name: "strict", pqMode: features.PostQuantumStrict, curves: fipsCurves, expected: []tls.CurveID{PQKex}},
+		{name: "prefer", pqMode: features.PostQuantumPrefer, curves: fipsCurves, expected: []tls.CurveID{PQKex, tls.CurveP256, tls.CurveP384}},
+		{name: "prefer without curves", pqMode: features.PostQuantumPrefer, expected: []tls.CurveID{PQKex}},
+		{name: "disabled", pqMode: features.PostQuantumDisabled, curves: fipsCurves, expected: fipsCurves},
+		// The post-quantum curve of a previous connection is removed
+		{name: "disabled after prefer", pqMode: features.PostQuantumDisabled, curves: []tls.CurveID{PQKex, tls.CurveP256}, expected: []tls.CurveID{tls.CurveP256}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			curves, err := curvePreference(test.pqMode, test.curves)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, curves)
+		})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"net"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/cloudflare/cloudflared/connection"
 	"github.com/cloudflare/cloudflared/edgediscovery"
+	"github.com/cloudflare/cloudflared/features"
 	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/orchestration"
 	v3 "github.com/cloudflare/cloudflared/quic/v3"
@@ -21,6 +24,11 @@ import (
 	"github.com/cloudflare/cloudflared/tunnelstate"
 )
 
+// sharedDatagramMetrics registers the datagram metrics once, since a process can supervise several tunnels.
+var sharedDatagramMetrics = sync.OnceValue(func() v3.Metrics {
+	return v3.NewMetrics(prometheus.DefaultRegisterer)
+})
+
 const (
 	// Waiting time before retrying a failed tunnel connection
 	tunnelRetryDuration = time.Second * 10
@@ -83,8 +91,9 @@ func NewSupervisor(config *TunnelConfig, orchestrator *orchestration.Orchestrato
 	edgeAddrHandler := NewIPAddrFallback(config.MaxEdgeAddrRetries)
 	edgeBindAddr := config.EdgeBindAddr
 
-	datagramMetrics := v3.NewMetrics(prometheus.DefaultRegisterer)
-	sessionManager := v3.NewSessionManager(datagramMetrics, config.Log, ingress.DialUDPAddrPort)
+	datagramMetrics := sharedDatagramMetrics()
+	dscp := config.NamedTunnel != nil && slices.Contains(config.NamedTunnel.Client.Features, features.FeatureDatagramDSCP)
+	sessionManager := v3.NewSessionManager(datagramMetrics, config.Log, ingress.DialUDPAddrPort, config.Flows, config.UDPPassthrough, dscp)
 
 	edgeTunnelServer := EdgeTunnelServer{
 		config:            config,
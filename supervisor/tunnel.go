@@ -21,6 +21,7 @@ import (
 	"github.com/cloudflare/cloudflared/edgediscovery"
 	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
 	"github.com/cloudflare/cloudflared/features"
+	"github.com/cloudflare/cloudflared/flow"
 	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/management"
 	"github.com/cloudflare/cloudflared/orchestration"
@@ -36,6 +37,38 @@ const (
 	dialTimeout = 15 * time.Second
 )
 
+// The defaults of the TunnelConfig, shared by the flags of cloudflared and the tunnels embedded with pkg/tunnel.
+const (
+	DefaultHAConnections                       = 4
+	DefaultGracePeriod                         = 30 * time.Second
+	DefaultRetries                             = 5
+	DefaultMaxEdgeAddrRetries                  = 8
+	DefaultRPCTimeout                          = 5 * time.Second
+	DefaultQUICConnectionLevelFlowControlLimit = 30 * (1 << 20) // 30 MB
+	DefaultQUICStreamLevelFlowControlLimit     = 6 * (1 << 20)  // 6 MB
+)
+
+// NewEdgeTLSConfigs returns the TLS config to connect to the edge with each protocol, as created by newConfig for the
+// server name of the protocol.
+func NewEdgeTLSConfigs(newConfig func(serverName string) (*tls.Config, error)) (map[connection.Protocol]*tls.Config, error) {
+	edgeTLSConfigs := make(map[connection.Protocol]*tls.Config, len(connection.ProtocolList))
+	for _, p := range connection.ProtocolList {
+		tlsSettings := p.TLSSettings()
+		if tlsSettings == nil {
+			return nil, fmt.Errorf("%s has unknown TLS settings", p)
+		}
+		edgeTLSConfig, err := newConfig(tlsSettings.ServerName)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create TLS config to connect with edge")
+		}
+		if len(tlsSettings.NextProtos) > 0 {
+			edgeTLSConfig.NextProtos = tlsSettings.NextProtos
+		}
+		edgeTLSConfigs[p] = edgeTLSConfig
+	}
+	return edgeTLSConfigs, nil
+}
+
 type TunnelConfig struct {
 	GracePeriod        time.Duration
 	ReplaceExisting    bool
@@ -64,11 +97,18 @@ type TunnelConfig struct {
 	ProtocolSelector connection.ProtocolSelector
 	EdgeTLSConfigs   map[connection.Protocol]*tls.Config
 	ICMPRouterServer ingress.ICMPRouterServer
+	// Flows tracks the flows proxied to origins for the diagnostic endpoints
+	Flows *flow.Table
+	// ConnectionDrainer drains specific connections on demand. If nil, the connections are only drained when the
+	// tunnel shuts down
+	ConnectionDrainer *ConnectionDrainer
 
 	RPCTimeout         time.Duration
 	WriteStreamTimeout time.Duration
 
-	DisableQUICPathMTUDiscovery         bool
+	DisableQUICPathMTUDiscovery bool
+	// UDPPassthrough proxies UDP sessions in site-to-site passthrough mode
+	UDPPassthrough                      bool
 	QUICConnectionLevelFlowControlLimit uint64
 	QUICStreamLevelFlowControlLimit     uint64
 
@@ -277,6 +317,7 @@ func (e *EdgeTunnelServer) Serve(ctx context.Context, connIndex uint8, protocolF
 			return err
 		}
 
+		inFallback := protocolFallback.inFallback
 		if !selectNextProtocol(
 			connLog.Logger(),
 			protocolFallback,
@@ -285,6 +326,9 @@ func (e *EdgeTunnelServer) Serve(ctx context.Context, connIndex uint8, protocolF
 		) {
 			return err
 		}
+		if protocolFallback.inFallback && !inFallback {
+			e.config.Observer.SendProtocolFallback(connIndex, protocolFallback.protocol)
+		}
 	}
 
 	return err
@@ -445,6 +489,13 @@ func (e *EdgeTunnelServer) serveConnection(
 		fuse:    fuse,
 		backoff: backoff,
 	}
+	shutdownC, drained := e.config.ConnectionDrainer.watch(connIndex, e.gracefulShutdownC)
+	defer func() {
+		// A drained connection reconnects right away, unlike a connection shut down with the tunnel
+		if drained() && err == nil {
+			err, recoverable = ReconnectSignal{}, true
+		}
+	}()
 	controlStream := connection.NewControlStream(
 		e.config.Observer,
 		connectedFuse,
@@ -453,7 +504,7 @@ func (e *EdgeTunnelServer) serveConnection(
 		addr.UDP.IP,
 		nil,
 		e.config.RPCTimeout,
-		e.gracefulShutdownC,
+		shutdownC,
 		e.config.GracePeriod,
 		protocol,
 	)
@@ -466,7 +517,8 @@ func (e *EdgeTunnelServer) serveConnection(
 			connLog,
 			connOptions,
 			controlStream,
-			connIndex)
+			connIndex,
+			shutdownC)
 
 	case connection.HTTP2:
 		edgeConn, err := edgediscovery.DialEdge(ctx, dialTimeout, e.config.EdgeTLSConfigs[protocol], addr.TCP, e.edgeBindAddr)
@@ -483,6 +535,7 @@ func (e *EdgeTunnelServer) serveConnection(
 			connOptions,
 			controlStream,
 			connIndex,
+			shutdownC,
 		); err != nil {
 			return err, false
 		}
@@ -508,6 +561,7 @@ func (e *EdgeTunnelServer) serveHTTP2(
 	connOptions *pogs.ConnectionOptions,
 	controlStreamHandler connection.ControlStreamHandler,
 	connIndex uint8,
+	shutdownC <-chan struct{},
 ) error {
 	pqMode := e.config.FeatureSelector.PostQuantumMode()
 	if pqMode == features.PostQuantumStrict {
@@ -531,7 +585,7 @@ func (e *EdgeTunnelServer) serveHTTP2(
 	})
 
 	errGroup.Go(func() error {
-		err := listenReconnect(serveCtx, e.reconnectCh, e.gracefulShutdownC)
+		err := listenReconnect(serveCtx, e.reconnectCh, shutdownC)
 		if err != nil {
 			// forcefully break the connection (this is only used for testing)
 			// errgroup will return context canceled for the h2conn.Serve
@@ -550,6 +604,7 @@ func (e *EdgeTunnelServer) serveQUIC(
 	connOptions *pogs.ConnectionOptions,
 	controlStreamHandler connection.ControlStreamHandler,
 	connIndex uint8,
+	shutdownC <-chan struct{},
 ) (err error, recoverable bool) {
 	tlsConfig := e.config.EdgeTLSConfigs[connection.QUIC]
 
@@ -579,7 +634,7 @@ func (e *EdgeTunnelServer) serveQUIC(
 		MaxIncomingStreams:         quicpogs.MaxIncomingStreams,
 		MaxIncomingUniStreams:      quicpogs.MaxIncomingStreams,
 		EnableDatagrams:            true,
-		Tracer:                     quicpogs.NewClientTracer(connLogger.Logger(), connIndex),
+		Tracer:                     quicpogs.NewClientTracer(connLogger.Logger(), e.config.NamedTunnel.Credentials.TunnelID, connIndex),
 		DisablePathMTUDiscovery:    e.config.DisableQUICPathMTUDiscovery,
 		MaxConnectionReceiveWindow: e.config.QUICConnectionLevelFlowControlLimit,
 		MaxStreamReceiveWindow:     e.config.QUICStreamLevelFlowControlLimit,
@@ -620,6 +675,8 @@ func (e *EdgeTunnelServer) serveQUIC(
 			connIndex,
 			e.config.RPCTimeout,
 			e.config.WriteStreamTimeout,
+			e.config.Flows,
+			slices.Contains(connOptions.Client.Features, features.FeatureDatagramDSCP),
 			connLogger.Logger(),
 		)
 	}
@@ -654,7 +711,7 @@ func (e *EdgeTunnelServer) serveQUIC(
 	})
 
 	errGroup.Go(func() error {
-		err := listenReconnect(serveCtx, e.reconnectCh, e.gracefulShutdownC)
+		err := listenReconnect(serveCtx, e.reconnectCh, shutdownC)
 		if err != nil {
 			// forcefully break the connection (this is only used for testing)
 			// errgroup will return context canceled for the tunnelConn.Serve
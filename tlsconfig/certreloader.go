@@ -132,7 +132,12 @@ func CreateTunnelConfig(c *cli.Context, serverName string) (*tls.Config, error)
 	if c.String(CaCertFlag) != "" {
 		rootCAs = append(rootCAs, c.String(CaCertFlag))
 	}
+	return NewTunnelConfig(rootCAs, serverName)
+}
 
+// NewTunnelConfig returns the TLS configuration to connect to the edge as serverName. It trusts the rootCAs files, or
+// the system and Cloudflare root CAs if there are none.
+func NewTunnelConfig(rootCAs []string, serverName string) (*tls.Config, error) {
 	userConfig := &TLSParameters{RootCAs: rootCAs, ServerName: serverName}
 	tlsConfig, err := GetConfig(userConfig)
 	if err != nil {
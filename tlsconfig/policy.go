@@ -0,0 +1,145 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+)
+
+const (
+	// CryptoPolicyNone doesn't restrict the defaults of the TLS connections
+	CryptoPolicyNone = "none"
+	// CryptoPolicyStrict allows TLS 1.2 and up with forward secret AEAD cipher suites only
+	CryptoPolicyStrict = "strict"
+	// CryptoPolicyFIPS further restricts the strict policy to the AES-GCM cipher suites and the P-256 and P-384 curves
+	// approved by FIPS 140
+	CryptoPolicyFIPS = "fips"
+)
+
+// CryptoPolicy restricts the TLS versions, cipher suites and curves negotiated with the edge and the origins.
+type CryptoPolicy struct {
+	Name       string
+	MinVersion uint16
+	// CipherSuites are the TLS 1.2 cipher suites allowed
+	CipherSuites []uint16
+	// TLS13CipherSuites are the TLS 1.3 cipher suites allowed. They can't be configured in crypto/tls, so the
+	// connections negotiating another one are rejected after the handshake.
+	TLS13CipherSuites []uint16
+	// CurvePreferences, if not empty, are the only curves allowed for the key exchange. They are enforced by only
+	// offering them, so the post-quantum key agreements must be disabled along with the policy.
+	CurvePreferences []tls.CurveID
+}
+
+// NewCryptoPolicy returns the CryptoPolicy of the name, or nil for CryptoPolicyNone and an empty name.
+func NewCryptoPolicy(name string) (*CryptoPolicy, error) {
+	switch name {
+	case "", CryptoPolicyNone:
+		return nil, nil
+	case CryptoPolicyStrict:
+		return &CryptoPolicy{
+			Name:       CryptoPolicyStrict,
+			MinVersion: tls.VersionTLS12,
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			},
+			TLS13CipherSuites: []uint16{
+				tls.TLS_AES_128_GCM_SHA256,
+				tls.TLS_AES_256_GCM_SHA384,
+				tls.TLS_CHACHA20_POLY1305_SHA256,
+			},
+		}, nil
+	case CryptoPolicyFIPS:
+		return &CryptoPolicy{
+			Name:       CryptoPolicyFIPS,
+			MinVersion: tls.VersionTLS12,
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			},
+			TLS13CipherSuites: []uint16{
+				tls.TLS_AES_128_GCM_SHA256,
+				tls.TLS_AES_256_GCM_SHA384,
+			},
+			CurvePreferences: []tls.CurveID{tls.CurveP256, tls.CurveP384},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown crypto policy %q, expected one of %s, %s or %s", name, CryptoPolicyNone, CryptoPolicyStrict, CryptoPolicyFIPS)
+	}
+}
+
+// Apply restricts cfg to the policy, and rejects the connections that negotiate parameters outside of it. A nil
+// CryptoPolicy leaves cfg as is. It must be called after the VerifyConnection of cfg is set, as it wraps it.
+func (p *CryptoPolicy) Apply(cfg *tls.Config) {
+	if p == nil {
+		return
+	}
+	if cfg.MinVersion < p.MinVersion {
+		cfg.MinVersion = p.MinVersion
+	}
+	cfg.CipherSuites = p.CipherSuites
+	if len(p.CurvePreferences) > 0 {
+		// Keep the preferred order of cfg among the curves the policy allows
+		curves := slices.DeleteFunc(slices.Clone(cfg.CurvePreferences), func(curve tls.CurveID) bool {
+			return !slices.Contains(p.CurvePreferences, curve)
+		})
+		if len(curves) == 0 {
+			curves = p.CurvePreferences
+		}
+		cfg.CurvePreferences = curves
+	}
+	verifyConnection := cfg.VerifyConnection
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		if err := p.Check(state); err != nil {
+			return err
+		}
+		if verifyConnection != nil {
+			return verifyConnection(state)
+		}
+		return nil
+	}
+}
+
+// Check returns an error if the version or cipher suite negotiated in state are outside of the policy.
+func (p *CryptoPolicy) Check(state tls.ConnectionState) error {
+	if p == nil {
+		return nil
+	}
+	if state.Version < p.MinVersion {
+		return fmt.Errorf("%s is not allowed by the %s crypto policy", tls.VersionName(state.Version), p.Name)
+	}
+	allowed := p.CipherSuites
+	if state.Version >= tls.VersionTLS13 {
+		allowed = p.TLS13CipherSuites
+	}
+	if !slices.Contains(allowed, state.CipherSuite) {
+		return fmt.Errorf("cipher suite %s is not allowed by the %s crypto policy", tls.CipherSuiteName(state.CipherSuite), p.Name)
+	}
+	return nil
+}
+
+// ConnectionParameters are the parameters negotiated by a TLS connection, as reported for audits.
+type ConnectionParameters struct {
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipherSuite"`
+	ServerName         string `json:"serverName,omitempty"`
+	NegotiatedProtocol string `json:"negotiatedProtocol,omitempty"`
+	DidResume          bool   `json:"didResume,omitempty"`
+}
+
+// NewConnectionParameters returns the parameters negotiated in state.
+func NewConnectionParameters(state tls.ConnectionState) *ConnectionParameters {
+	return &ConnectionParameters{
+		Version:            tls.VersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		ServerName:         state.ServerName,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		DidResume:          state.DidResume,
+	}
+}
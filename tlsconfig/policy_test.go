@@ -0,0 +1,150 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCryptoPolicy(t *testing.T) {
+	for _, name := range []string{"", CryptoPolicyNone} {
+		policy, err := NewCryptoPolicy(name)
+		require.NoError(t, err)
+		assert.Nil(t, policy)
+	}
+	for _, name := range []string{CryptoPolicyStrict, CryptoPolicyFIPS} {
+		policy, err := NewCryptoPolicy(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, policy.Name)
+	}
+	_, err := NewCryptoPolicy("weak")
+	assert.Error(t, err)
+}
+
+func TestCryptoPolicyApply(t *testing.T) {
+	policy, err := NewCryptoPolicy(CryptoPolicyFIPS)
+	require.NoError(t, err)
+
+	var verified bool
+	cfg := &tls.Config{
+		MinVersion:       tls.VersionTLS10,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP384, tls.CurveP256},
+		VerifyConnection: func(tls.ConnectionState) error {
+			verified = true
+			return nil
+		},
+	}
+	policy.Apply(cfg)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.Equal(t, policy.CipherSuites, cfg.CipherSuites)
+	assert.Equal(t, []tls.CurveID{tls.CurveP384, tls.CurveP256}, cfg.CurvePreferences)
+
+	require.NoError(t, cfg.VerifyConnection(tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256}))
+	assert.True(t, verified)
+
+	verified = false
+	assert.Error(t, cfg.VerifyConnection(tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_CHACHA20_POLY1305_SHA256}))
+	assert.False(t, verified)
+
+	// The policy curves are used when cfg has none of them
+	cfg = &tls.Config{CurvePreferences: []tls.CurveID{tls.X25519}}
+	policy.Apply(cfg)
+	assert.Equal(t, policy.CurvePreferences, cfg.CurvePreferences)
+
+	// A nil policy leaves the configuration as is
+	cfg = &tls.Config{}
+	(*CryptoPolicy)(nil).Apply(cfg)
+	assert.Equal(t, &tls.Config{}, cfg)
+}
+
+func TestCryptoPolicyCheck(t *testing.T) {
+	strict, err := NewCryptoPolicy(CryptoPolicyStrict)
+	require.NoError(t, err)
+	fips, err := NewCryptoPolicy(CryptoPolicyFIPS)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		state       tls.ConnectionState
+		strictError bool
+		fipsError   bool
+	}{
+		{
+			name:  "TLS 1.3 AES-GCM",
+			state: tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_256_GCM_SHA384},
+		},
+		{
+			name:      "TLS 1.3 ChaCha20",
+			state:     tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_CHACHA20_POLY1305_SHA256},
+			fipsError: true,
+		},
+		{
+			name:  "TLS 1.2 ECDHE AES-GCM",
+			state: tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		},
+		{
+			name:        "TLS 1.2 RSA key exchange",
+			state:       tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_RSA_WITH_AES_128_GCM_SHA256},
+			strictError: true,
+			fipsError:   true,
+		},
+		{
+			name:        "TLS 1.1",
+			state:       tls.ConnectionState{Version: tls.VersionTLS11, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA},
+			strictError: true,
+			fipsError:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.strictError, strict.Check(test.state) != nil)
+			assert.Equal(t, test.fipsError, fips.Check(test.state) != nil)
+			assert.NoError(t, (*CryptoPolicy)(nil).Check(test.state))
+		})
+	}
+}
+
+func TestCryptoPolicyRejectsServer(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.CipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	policy, err := NewCryptoPolicy(CryptoPolicyStrict)
+	require.NoError(t, err)
+	transport.CloseIdleConnections()
+	policy.Apply(transport.TLSClientConfig)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+}
+
+func TestNewConnectionParameters(t *testing.T) {
+	params := NewConnectionParameters(tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		ServerName:         "example.com",
+		NegotiatedProtocol: "h2",
+		DidResume:          true,
+	})
+	assert.Equal(t, &ConnectionParameters{
+		Version:            "TLS 1.3",
+		CipherSuite:        "TLS_AES_128_GCM_SHA256",
+		ServerName:         "example.com",
+		NegotiatedProtocol: "h2",
+		DidResume:          true,
+	}, params)
+}
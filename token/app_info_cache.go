@@ -0,0 +1,55 @@
+package token
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const appInfoSuffix = "app-info"
+
+// GetCachedAppInfo returns the app info of the URL stored by a previous lookup less than maxAge ago, or looks it up
+// with GetAppInfo and stores it. Commands that run in loops, like access curl, use it to skip a request to the edge.
+func GetCachedAppInfo(reqURL *url.URL, maxAge time.Duration, tlsConfig *tls.Config) (*AppInfo, error) {
+	path, err := GenerateSSHCertFilePathFromURL(reqURL, appInfoSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < maxAge {
+		if content, err := os.ReadFile(path); err == nil {
+			var appInfo AppInfo
+			if err := json.Unmarshal(content, &appInfo); err == nil && appInfo.AppAUD != "" {
+				return &appInfo, nil
+			}
+		}
+	}
+
+	appInfo, err := GetAppInfo(reqURL, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(appInfo)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to store app info")
+	}
+	return appInfo, nil
+}
+
+// RemoveCachedAppInfo removes the app info stored by GetCachedAppInfo, e.g. when it turned out to be outdated.
+func RemoveCachedAppInfo(reqURL *url.URL) error {
+	path, err := GenerateSSHCertFilePathFromURL(reqURL, appInfoSuffix)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
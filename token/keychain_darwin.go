@@ -0,0 +1,51 @@
+//go:build darwin
+
+package token
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// securityItemNotFound is the exit code of the security command when there is no matching item
+const securityItemNotFound = 44
+
+// macKeychain stores the secrets in the login keychain with the security command
+type macKeychain struct{}
+
+func newSystemKeychain() keychain {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil
+	}
+	return macKeychain{}
+}
+
+func (macKeychain) get(account string) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", account, "-w").Output()
+	if err != nil {
+		return nil, securityError(err)
+	}
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
+
+func (macKeychain) set(account string, secret []byte) error {
+	// The secret is written to the interactive mode of the command so that it doesn't show in the process list
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n", keychainService, account, secret))
+	return securityError(cmd.Run())
+}
+
+func (macKeychain) remove(account string) error {
+	return securityError(exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", account).Run())
+}
+
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == securityItemNotFound {
+		return errKeychainItemNotFound
+	}
+	return err
+}
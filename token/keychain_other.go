@@ -0,0 +1,7 @@
+//go:build !windows && !darwin && !linux && !netbsd && !freebsd && !openbsd
+
+package token
+
+func newSystemKeychain() keychain {
+	return nil
+}
@@ -0,0 +1,45 @@
+//go:build linux || freebsd || openbsd || netbsd
+
+package token
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+)
+
+// secretServiceKeychain stores the secrets with the Secret Service of the desktop session (e.g. GNOME Keyring or
+// KWallet) using secret-tool
+type secretServiceKeychain struct{}
+
+func newSystemKeychain() keychain {
+	// Headless systems usually have neither secret-tool nor a session bus
+	if _, err := exec.LookPath("secret-tool"); err != nil || os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil
+	}
+	return secretServiceKeychain{}
+}
+
+func (secretServiceKeychain) get(account string) ([]byte, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keychainService, "account", account).Output()
+	if len(out) == 0 {
+		// secret-tool exits with an error without output when there is no matching item
+		return nil, errKeychainItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (secretServiceKeychain) set(account string, secret []byte) error {
+	cmd := exec.Command("secret-tool", "store", "--label=cloudflared "+account, "service", keychainService, "account", account)
+	cmd.Stdin = bytes.NewReader(secret)
+	return cmd.Run()
+}
+
+func (secretServiceKeychain) remove(account string) error {
+	// secret-tool exits with an error when there is no matching item, which can't be told apart from other errors
+	_ = exec.Command("secret-tool", "clear", "service", keychainService, "account", account).Run()
+	return nil
+}
@@ -0,0 +1,111 @@
+//go:build windows
+
+package token
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+var (
+	advapi32       = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// credential is the CREDENTIALW structure of wincred.h
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credentialManager stores the secrets as generic credentials of the Windows Credential Manager
+type credentialManager struct{}
+
+func newSystemKeychain() keychain {
+	if err := procCredReadW.Find(); err != nil {
+		return nil
+	}
+	return credentialManager{}
+}
+
+func credentialTarget(account string) (*uint16, error) {
+	return windows.UTF16PtrFromString(keychainService + ":" + account)
+}
+
+func (credentialManager) get(account string) ([]byte, error) {
+	target, err := credentialTarget(account)
+	if err != nil {
+		return nil, err
+	}
+	var cred *credential
+	if ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ret == 0 {
+		return nil, credentialError(err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	secret := make([]byte, cred.CredentialBlobSize)
+	copy(secret, unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+	return secret, nil
+}
+
+func (credentialManager) set(account string, secret []byte) error {
+	target, err := credentialTarget(account)
+	if err != nil {
+		return err
+	}
+	user, err := windows.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		UserName:           user,
+		CredentialBlobSize: uint32(len(secret)),
+		Persist:            credPersistLocalMachine,
+	}
+	if len(secret) > 0 {
+		cred.CredentialBlob = &secret[0]
+	}
+	if ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return credentialError(err)
+	}
+	return nil
+}
+
+func (credentialManager) remove(account string) error {
+	target, err := credentialTarget(account)
+	if err != nil {
+		return err
+	}
+	if ret, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); ret == 0 {
+		return credentialError(err)
+	}
+	return nil
+}
+
+func credentialError(err error) error {
+	if errors.Is(err, windows.ERROR_NOT_FOUND) {
+		return errKeychainItemNotFound
+	}
+	return err
+}
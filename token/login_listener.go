@@ -0,0 +1,58 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	loginListenerShutdownTimeout = 5 * time.Second
+	// loginCallbackPath is where the browser comes back to the listener once the login completed
+	loginCallbackPath = "/callback"
+)
+
+// loginCallbackPage tells the user that the browser isn't needed anymore, the token is downloaded by cloudflared
+const loginCallbackPage = `<!DOCTYPE html>
+<html><head><title>cloudflared</title></head>
+<body><p>You have logged in, cloudflared is downloading the %s. You can close this window.</p></body></html>
+`
+
+// loginCallbackURL returns the URL of the listener the browser is redirected to once the login completed, with the
+// query of the login request.
+func loginCallbackURL(address, rawQuery string) string {
+	return fmt.Sprintf("http://%s%s?%s", address, loginCallbackPath, rawQuery)
+}
+
+// serveLoginRedirect redirects the requests to the address to the login URL until the returned function is called.
+// The browser coming back to the callback path is told that the login completed, since the application it would
+// otherwise be redirected to may not be reachable from the machine forwarding the listener.
+func serveLoginRedirect(address, loginURL, resourceName string) (func(), error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+			switch r.URL.Path {
+			case "/":
+				http.Redirect(w, r, loginURL, http.StatusFound)
+			case loginCallbackPath:
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				fmt.Fprintf(w, loginCallbackPage, resourceName)
+			default:
+				http.NotFound(w, r)
+			}
+		}),
+		ReadHeaderTimeout: loginListenerShutdownTimeout,
+	}
+	go func() { _ = server.Serve(listener) }()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), loginListenerShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
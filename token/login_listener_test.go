@@ -0,0 +1,66 @@
+package token
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeLoginRedirect(t *testing.T) {
+	const loginURL = "https://app.example.com/cdn-cgi/access/cli?aud=123&token=abc"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	stop, err := serveLoginRedirect(address, loginURL, "token")
+	require.NoError(t, err)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("http://" + address + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, loginURL, resp.Header.Get("Location"))
+
+	resp, err = client.Get(loginCallbackURL(address, "token=abc"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "cloudflared is downloading the token")
+
+	resp, err = client.Get("http://" + address + "/favicon.ico")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	stop()
+	_, err = client.Get("http://" + address + "/")
+	assert.Error(t, err)
+}
+
+func TestBuildRequestURLWithListener(t *testing.T) {
+	appURL, err := url.Parse("https://app.example.com/path")
+	require.NoError(t, err)
+	requestURL, err := buildRequestURL(appURL, "aud", "token", "pubkey", true, true, "localhost:8099")
+	require.NoError(t, err)
+	parsed, err := url.Parse(requestURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/cdn-cgi/access/cli", parsed.Path)
+	redirectURL, err := url.Parse(parsed.Query().Get("redirect_url"))
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:8099", redirectURL.Host)
+	assert.Equal(t, loginCallbackPath, redirectURL.Path)
+	assert.Equal(t, "pubkey", redirectURL.Query().Get("token"))
+}
@@ -0,0 +1,37 @@
+package token
+
+import (
+	"crypto/tls"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// RefreshAppToken exchanges the org token of the organization of the application for a new app token, and stores it
+// in place of the current one. Unlike FetchToken it never prompts the user, so it fails once the org token expired.
+// It's used to renew the app tokens before they expire.
+func RefreshAppToken(appURL *url.URL, appInfo *AppInfo, tlsConfig *tls.Config) (string, error) {
+	orgToken, err := GetOrgTokenIfExists(appInfo.AuthDomain)
+	if err != nil {
+		return "", errors.Wrap(err, "no valid org token to refresh the app token with")
+	}
+
+	appTokenPath, err := GenerateAppTokenFilePathFromURL(appInfo.AppDomain, appInfo.AppAUD, keyName)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate app token file path")
+	}
+	fileLockAppToken := newLock(appTokenPath)
+	if err := fileLockAppToken.Acquire(); err != nil {
+		return "", errors.Wrap(err, "failed to acquire app token lock")
+	}
+	defer fileLockAppToken.Release()
+
+	appToken, err := exchangeOrgToken(appURL, orgToken, tlsConfig)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to exchange org token for app token")
+	}
+	if err := writeToken(appTokenPath, []byte(appToken)); err != nil {
+		return "", errors.Wrap(err, "failed to store app token")
+	}
+	return appToken, nil
+}
@@ -0,0 +1,139 @@
+package token
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AccessClientIDHeader     = "Cf-Access-Client-Id"
+	AccessClientSecretHeader = "Cf-Access-Client-Secret"
+
+	serviceTokenSuffix = "service-token"
+	// serviceTokenRenewMargin renews the app token of a service token before it expires so that it stays valid for
+	// the command using it
+	serviceTokenRenewMargin = time.Minute
+)
+
+// ServiceToken is the client ID and secret of an Access service token, used by non-interactive clients such as CI jobs
+// instead of logging in with a browser.
+type ServiceToken struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// IsSet returns whether both the client ID and the secret are provided
+func (s ServiceToken) IsSet() bool {
+	return s.ClientID != "" && s.ClientSecret != ""
+}
+
+// LoadServiceTokenFile reads a service token from a file with the Cf-Access-Client-Id and Cf-Access-Client-Secret
+// headers, as shown when the token is created, or with the client ID and the secret on two lines.
+func LoadServiceTokenFile(path string) (ServiceToken, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ServiceToken{}, errors.Wrap(err, "failed to open service token file")
+	}
+	defer file.Close()
+
+	var serviceToken ServiceToken
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			switch http.CanonicalHeaderKey(strings.TrimSpace(name)) {
+			case AccessClientIDHeader:
+				serviceToken.ClientID = strings.TrimSpace(value)
+				continue
+			case AccessClientSecretHeader:
+				serviceToken.ClientSecret = strings.TrimSpace(value)
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return ServiceToken{}, errors.Wrap(err, "failed to read service token file")
+	}
+	if !serviceToken.IsSet() && len(lines) == 2 {
+		serviceToken = ServiceToken{ClientID: lines[0], ClientSecret: lines[1]}
+	}
+	if !serviceToken.IsSet() {
+		return ServiceToken{}, fmt.Errorf("service token file %s must contain the %s and %s headers", path, AccessClientIDHeader, AccessClientSecretHeader)
+	}
+	return serviceToken, nil
+}
+
+// SetHeaders adds the client ID and the secret to the headers of a request to an Access application
+func (s ServiceToken) SetHeaders(header http.Header) {
+	header.Set(AccessClientIDHeader, s.ClientID)
+	header.Set(AccessClientSecretHeader, s.ClientSecret)
+}
+
+// FetchServiceToken returns an app token for the service token: the stored one if it is still valid, or a new one
+// issued by Access in exchange for the service token. tlsConfig holds the client certificate of applications that
+// require mTLS, it can be nil.
+func FetchServiceToken(appURL *url.URL, appInfo *AppInfo, serviceToken ServiceToken, tlsConfig *tls.Config) (string, error) {
+	path, err := GenerateAppTokenFilePathFromURL(appInfo.AppDomain, appInfo.AppAUD, serviceToken.ClientID+"-"+serviceTokenSuffix)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate service token file path")
+	}
+	if token, err := getTokenIfExists(path); err == nil {
+		var payload jwtPayload
+		if err := json.Unmarshal(token.UnsafePayloadWithoutVerification(), &payload); err == nil &&
+			time.Now().Add(serviceTokenRenewMargin).Unix() < int64(payload.Exp) {
+			return token.CompactSerialize()
+		}
+	}
+
+	appToken, err := exchangeServiceToken(appURL, serviceToken, tlsConfig)
+	if err != nil {
+		return "", err
+	}
+	if err := writeToken(path, []byte(appToken)); err != nil {
+		return "", errors.Wrap(err, "failed to store service app token")
+	}
+	return appToken, nil
+}
+
+// exchangeServiceToken sends the service token to the application, Access answers with the app token in a cookie.
+func exchangeServiceToken(appURL *url.URL, serviceToken ServiceToken, tlsConfig *tls.Config) (string, error) {
+	client := &http.Client{
+		Transport: appTransport(tlsConfig),
+		// The response of Access is enough, the application doesn't need to answer
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: time.Second * 7,
+	}
+	req, err := http.NewRequest("HEAD", appURL.String(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create service token request")
+	}
+	req.Header.Add("User-Agent", userAgent)
+	serviceToken.SetHeaders(req.Header)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to exchange service token")
+	}
+	resp.Body.Close()
+	for _, c := range resp.Cookies() {
+		if c.Name == tokenCookie && c.Value != "" {
+			return c.Value, nil
+		}
+	}
+	return "", fmt.Errorf("Access did not accept the service token %s for %s: %s", serviceToken.ClientID, appURL.Host, resp.Status)
+}
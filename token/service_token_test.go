@@ -0,0 +1,108 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadServiceTokenFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected ServiceToken
+		err      bool
+	}{
+		{
+			name:     "headers",
+			content:  "CF-Access-Client-Id: id.access\nCF-Access-Client-Secret: secret\n",
+			expected: ServiceToken{ClientID: "id.access", ClientSecret: "secret"},
+		},
+		{
+			name:     "lines",
+			content:  "# CI token\nid.access\nsecret\n",
+			expected: ServiceToken{ClientID: "id.access", ClientSecret: "secret"},
+		},
+		{name: "missing secret", content: "CF-Access-Client-Id: id.access\n", err: true},
+		{name: "empty", content: "", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "service-token")
+			require.NoError(t, os.WriteFile(path, []byte(test.content), 0600))
+			serviceToken, err := LoadServiceTokenFile(path)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, serviceToken)
+		})
+	}
+}
+
+func TestExchangeServiceToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(AccessClientIDHeader) != "id.access" || r.Header.Get(AccessClientSecretHeader) != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: tokenCookie, Value: "app-token"})
+	}))
+	defer server.Close()
+	appURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	appToken, err := exchangeServiceToken(appURL, ServiceToken{ClientID: "id.access", ClientSecret: "secret"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "app-token", appToken)
+
+	_, err = exchangeServiceToken(appURL, ServiceToken{ClientID: "id.access", ClientSecret: "wrong"}, nil)
+	require.Error(t, err)
+}
+
+func TestExchangeServiceTokenClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: tokenCookie, Value: "app-token"})
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	appURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	serverTLS := server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	_, err = exchangeServiceToken(appURL, ServiceToken{ClientID: "id.access", ClientSecret: "secret"}, serverTLS)
+	require.Error(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "laptop"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	tlsConfig := serverTLS.Clone()
+	tlsConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}
+
+	appToken, err := exchangeServiceToken(appURL, ServiceToken{ClientID: "id.access", ClientSecret: "secret"}, tlsConfig)
+	require.NoError(t, err)
+	require.Equal(t, "app-token", appToken)
+}
@@ -1,6 +1,74 @@
 package token
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/cloudflare/cloudflared/qrcode"
+	"github.com/cloudflare/cloudflared/shellwords"
+)
+
+var errNoBrowser = errors.New("no browser available")
+
 // OpenBrowser opens the specified URL in the default browser of the user
 func OpenBrowser(url string) error {
-	return getBrowserCmd(url).Start()
+	return openBrowser(url, "")
+}
+
+// openBrowser opens the URL with the command if set, or in the default browser of the user.
+func openBrowser(url, command string) error {
+	var cmd *exec.Cmd
+	if command != "" {
+		var err error
+		if cmd, err = customBrowserCmd(command, url); err != nil {
+			return err
+		}
+	} else {
+		cmd = getBrowserCmd(url)
+	}
+	if cmd == nil {
+		return errNoBrowser
+	}
+	return cmd.Start()
+}
+
+func customBrowserCmd(command, url string) (*exec.Cmd, error) {
+	args, err := shellwords.SplitWithArg(command, url)
+	if err != nil || len(args) == 0 {
+		return nil, err
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// printLoginURL prints the URL with a QR code, the QR code is left out if the URL doesn't fit in one.
+func printLoginURL(requestURL, resourceName string) {
+	fmt.Fprintf(os.Stderr, "Please open the following URL and log in with your Cloudflare account:\n\n%s\n\n", requestURL)
+	if code, err := qrcode.Encode(requestURL); err == nil {
+		fmt.Fprintf(os.Stderr, "Or scan this QR code:\n\n%s\n", code.Terminal())
+	}
+	fmt.Fprintf(os.Stderr, "Leave cloudflared running to download the %s automatically.\n", resourceName)
+}
+
+// startLogin gets the user to the login URL: through the login listener if enabled, or by opening it in a browser. It
+// returns a function to call once the login completed.
+func startLogin(requestURL, resourceName string, options *LoginOptions) func() {
+	// See AUTH-1423 for why we use stderr (the way git wraps ssh)
+	if options.ListenerAddress != "" {
+		stop, err := serveLoginRedirect(options.ListenerAddress, requestURL, resourceName)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Please open the following URL in a browser where your security key is available, e.g. on the machine forwarding it with ssh -L:\n\nhttp://%s\n\nLeave cloudflared running to download the %s automatically.\n", options.ListenerAddress, resourceName)
+			return stop
+		}
+		fmt.Fprintf(os.Stderr, "Failed to listen on %s for the login: %v\n\n", options.ListenerAddress, err)
+	} else if options.NoBrowser {
+		printLoginURL(requestURL, resourceName)
+		return func() {}
+	} else if err := openBrowser(requestURL, options.BrowserCommand); err == nil {
+		fmt.Fprintf(os.Stderr, "A browser window should have opened at the following URL:\n\n%s\n\nIf the browser failed to open, please visit the URL above directly in your browser.\n", requestURL)
+		return func() {}
+	}
+	fmt.Fprintf(os.Stderr, "Please open the following URL and log in with your Cloudflare account:\n\n%s\n\nLeave cloudflared running to download the %s automatically.\n", requestURL, resourceName)
+	return func() {}
 }
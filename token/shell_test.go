@@ -0,0 +1,27 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomBrowserCmd(t *testing.T) {
+	const url = "https://example.com/cdn-cgi/access/cli?token=abc"
+	cmd, err := customBrowserCmd("firefox -P work", url)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"firefox", "-P", "work", url}, cmd.Args)
+
+	cmd, err = customBrowserCmd("chromium --app=%s --new-window", url)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chromium", "--app=" + url, "--new-window"}, cmd.Args)
+
+	cmd, err = customBrowserCmd(`"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome" --incognito`, url)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome", "--incognito", url}, cmd.Args)
+
+	cmd, err = customBrowserCmd("  ", url)
+	require.NoError(t, err)
+	assert.Nil(t, cmd)
+}
@@ -0,0 +1,118 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const keychainService = "cloudflared"
+
+var (
+	errKeychainItemNotFound = errors.New("item not found in the keychain")
+	errNoKeychain           = errors.New("this system has no keychain that cloudflared can use")
+
+	// systemKeychain is nil if the OS has no keychain that cloudflared can use
+	systemKeychain  = newSystemKeychain()
+	keychainEnabled = true
+)
+
+// keychain stores secrets in the credential store of the OS: the macOS Keychain, the Windows Credential Manager or
+// the Secret Service on Linux.
+type keychain interface {
+	get(account string) ([]byte, error)
+	set(account string, secret []byte) error
+	remove(account string) error
+}
+
+// UseKeychain selects whether the tokens are stored in the keychain of the OS, when there is one, or in files under
+// the configuration directory. Tokens that were stored in files are moved to the keychain when they are read.
+func UseKeychain(enabled bool) {
+	keychainEnabled = enabled
+}
+
+func activeKeychain() keychain {
+	if !keychainEnabled {
+		return nil
+	}
+	return systemKeychain
+}
+
+// keychainAccount names the keychain item of a token after its file
+func keychainAccount(path string) string {
+	return filepath.Base(path)
+}
+
+// readToken returns the token stored for the path, in the keychain or in the file.
+func readToken(path string) ([]byte, error) {
+	kc := activeKeychain()
+	if kc == nil {
+		return os.ReadFile(path)
+	}
+	if token, err := kc.get(keychainAccount(path)); err == nil {
+		return token, nil
+	}
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Migrate the tokens stored by previous versions, the file is kept if the keychain can't be written to
+	if err := kc.set(keychainAccount(path), token); err == nil {
+		_ = os.Remove(path)
+	}
+	return token, nil
+}
+
+// writeToken stores the token for the path, in the file if the keychain can't be written to.
+func writeToken(path string, token []byte) error {
+	if kc := activeKeychain(); kc != nil {
+		if err := kc.set(keychainAccount(path), token); err == nil {
+			// Don't leave an outdated token behind
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+	}
+	return os.WriteFile(path, token, 0600)
+}
+
+// removeToken removes the token stored for the path, it is not an error if there is none.
+func removeToken(path string) error {
+	if kc := activeKeychain(); kc != nil {
+		if err := kc.remove(keychainAccount(path)); err != nil && !errors.Is(err, errKeychainItemNotFound) {
+			return err
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ReadKeychainSecret returns the secret stored under the name by WriteKeychainSecret, e.g. a client certificate.
+func ReadKeychainSecret(name string) ([]byte, error) {
+	if systemKeychain == nil {
+		return nil, errNoKeychain
+	}
+	encoded, err := systemKeychain.get(keychainSecretAccount(name))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(string(encoded))
+}
+
+// WriteKeychainSecret stores the secret under the name in the keychain of the OS. Secrets are stored in base64, the
+// keychains of some systems only hold a line of text.
+func WriteKeychainSecret(name string, secret []byte) error {
+	if systemKeychain == nil {
+		return errNoKeychain
+	}
+	return systemKeychain.set(keychainSecretAccount(name), []byte(base64.StdEncoding.EncodeToString(secret)))
+}
+
+// keychainSecretAccount keeps the names of the secrets apart from the token files
+func keychainSecretAccount(name string) string {
+	return "secret-" + name
+}
@@ -0,0 +1,108 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeKeychain map[string][]byte
+
+func (k fakeKeychain) get(account string) ([]byte, error) {
+	secret, ok := k[account]
+	if !ok {
+		return nil, errKeychainItemNotFound
+	}
+	return secret, nil
+}
+
+func (k fakeKeychain) set(account string, secret []byte) error {
+	k[account] = secret
+	return nil
+}
+
+func (k fakeKeychain) remove(account string) error {
+	if _, ok := k[account]; !ok {
+		return errKeychainItemNotFound
+	}
+	delete(k, account)
+	return nil
+}
+
+func withKeychain(t *testing.T, kc keychain) {
+	previous := systemKeychain
+	systemKeychain = kc
+	t.Cleanup(func() { systemKeychain = previous })
+}
+
+func TestTokenStoreKeychain(t *testing.T) {
+	kc := fakeKeychain{}
+	withKeychain(t, kc)
+	path := filepath.Join(t.TempDir(), "app.example.com-aud-token")
+
+	require.NoError(t, writeToken(path, []byte("jwt")))
+	require.Equal(t, []byte("jwt"), kc["app.example.com-aud-token"])
+	require.NoFileExists(t, path)
+
+	token, err := readToken(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte("jwt"), token)
+
+	require.NoError(t, removeToken(path))
+	require.Empty(t, kc)
+	require.NoError(t, removeToken(path))
+	_, err = readToken(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestTokenStoreMigration(t *testing.T) {
+	kc := fakeKeychain{}
+	withKeychain(t, kc)
+	path := filepath.Join(t.TempDir(), "app.example.com-aud-token")
+	require.NoError(t, os.WriteFile(path, []byte("jwt"), 0600))
+
+	token, err := readToken(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte("jwt"), token)
+	// The token moved to the keychain
+	require.Equal(t, []byte("jwt"), kc["app.example.com-aud-token"])
+	require.NoFileExists(t, path)
+}
+
+func TestTokenStoreWithoutKeychain(t *testing.T) {
+	kc := fakeKeychain{}
+	withKeychain(t, kc)
+	UseKeychain(false)
+	t.Cleanup(func() { UseKeychain(true) })
+	path := filepath.Join(t.TempDir(), "app.example.com-aud-token")
+
+	require.NoError(t, writeToken(path, []byte("jwt")))
+	require.Empty(t, kc)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte("jwt"), content)
+
+	require.NoError(t, removeToken(path))
+	require.NoFileExists(t, path)
+}
+
+func TestKeychainSecret(t *testing.T) {
+	kc := fakeKeychain{}
+	withKeychain(t, kc)
+	secret := []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")
+
+	require.NoError(t, WriteKeychainSecret("laptop", secret))
+	require.NotContains(t, string(kc["secret-laptop"]), "\n")
+	stored, err := ReadKeychainSecret("laptop")
+	require.NoError(t, err)
+	require.Equal(t, secret, stored)
+
+	_, err = ReadKeychainSecret("other")
+	require.ErrorIs(t, err, errKeychainItemNotFound)
+
+	withKeychain(t, nil)
+	_, err = ReadKeychainSecret("laptop")
+	require.ErrorIs(t, err, errNoKeychain)
+}
@@ -2,6 +2,7 @@ package token
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -72,6 +73,32 @@ func (p jwtPayload) isExpired() bool {
 	return int(time.Now().Unix()) > p.Exp
 }
 
+// Claims are the claims of an Access token that tools rely on.
+type Claims struct {
+	Email     string
+	Audience  []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// ParseClaims reads the claims of a token without verifying its signature, which is up to the edge.
+func ParseClaims(rawToken string) (Claims, error) {
+	tok, err := jose.ParseSigned(rawToken, signatureAlgs)
+	if err != nil {
+		return Claims{}, errors.Wrap(err, "failed to parse the token")
+	}
+	var payload jwtPayload
+	if err := json.Unmarshal(tok.UnsafePayloadWithoutVerification(), &payload); err != nil {
+		return Claims{}, errors.Wrap(err, "failed to parse the claims of the token")
+	}
+	return Claims{
+		Email:     payload.Email,
+		Audience:  payload.Aud,
+		IssuedAt:  time.Unix(int64(payload.Iat), 0),
+		ExpiresAt: time.Unix(int64(payload.Exp), 0),
+	}, nil
+}
+
 func (s *signalHandler) register(handler func()) {
 	s.sigChannel = make(chan os.Signal, 1)
 	signal.Notify(s.sigChannel, s.signals...)
@@ -157,18 +184,18 @@ func Init(version string) {
 
 // FetchTokenWithRedirect will either load a stored token or generate a new one
 // it appends the full url as the redirect URL to the access cli request if opening the browser
-func FetchTokenWithRedirect(appURL *url.URL, appInfo *AppInfo, log *zerolog.Logger) (string, error) {
-	return getToken(appURL, appInfo, false, log)
+func FetchTokenWithRedirect(appURL *url.URL, appInfo *AppInfo, options *LoginOptions, log *zerolog.Logger) (string, error) {
+	return getToken(appURL, appInfo, false, options, log)
 }
 
 // FetchToken will either load a stored token or generate a new one
 // it appends the host of the appURL as the redirect URL to the access cli request if opening the browser
-func FetchToken(appURL *url.URL, appInfo *AppInfo, log *zerolog.Logger) (string, error) {
-	return getToken(appURL, appInfo, true, log)
+func FetchToken(appURL *url.URL, appInfo *AppInfo, options *LoginOptions, log *zerolog.Logger) (string, error) {
+	return getToken(appURL, appInfo, true, options, log)
 }
 
 // getToken will either load a stored token or generate a new one
-func getToken(appURL *url.URL, appInfo *AppInfo, useHostOnly bool, log *zerolog.Logger) (string, error) {
+func getToken(appURL *url.URL, appInfo *AppInfo, useHostOnly bool, options *LoginOptions, log *zerolog.Logger) (string, error) {
 	if token, err := GetAppTokenIfExists(appInfo); token != "" && err == nil {
 		return token, nil
 	}
@@ -207,29 +234,29 @@ func getToken(appURL *url.URL, appInfo *AppInfo, useHostOnly bool, log *zerolog.
 		orgToken, err = GetOrgTokenIfExists(appInfo.AuthDomain)
 	}
 	if err == nil {
-		if appToken, err := exchangeOrgToken(appURL, orgToken); err != nil {
+		if appToken, err := exchangeOrgToken(appURL, orgToken, options.tlsClientConfig()); err != nil {
 			log.Debug().Msgf("failed to exchange org token for app token: %s", err)
 		} else {
 			// generate app path
-			if err := os.WriteFile(appTokenPath, []byte(appToken), 0600); err != nil {
-				return "", errors.Wrap(err, "failed to write app token to disk")
+			if err := writeToken(appTokenPath, []byte(appToken)); err != nil {
+				return "", errors.Wrap(err, "failed to store app token")
 			}
 			return appToken, nil
 		}
 	}
-	return getTokensFromEdge(appURL, appInfo.AppAUD, appTokenPath, orgTokenPath, useHostOnly, log)
+	return getTokensFromEdge(appURL, appInfo.AppAUD, appTokenPath, orgTokenPath, useHostOnly, options, log)
 
 }
 
-// getTokensFromEdge will attempt to use the transfer service to retrieve an app and org token, save them to disk,
+// getTokensFromEdge will attempt to use the transfer service to retrieve an app and org token, store them,
 // and return the app token.
-func getTokensFromEdge(appURL *url.URL, appAUD, appTokenPath, orgTokenPath string, useHostOnly bool, log *zerolog.Logger) (string, error) {
+func getTokensFromEdge(appURL *url.URL, appAUD, appTokenPath, orgTokenPath string, useHostOnly bool, options *LoginOptions, log *zerolog.Logger) (string, error) {
 	// If no org token exists or if it couldn't be exchanged for an app token, then run the transfer service flow.
 
 	// this weird parameter is the resource name (token) and the key/value
 	// we want to send to the transfer service. the key is token and the value
 	// is blank (basically just the id generated in the transfer service)
-	resourceData, err := RunTransfer(appURL, appAUD, keyName, keyName, "", true, useHostOnly, log)
+	resourceData, err := RunTransfer(appURL, appAUD, keyName, keyName, "", true, useHostOnly, options, log)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to run transfer service")
 	}
@@ -238,15 +265,15 @@ func getTokensFromEdge(appURL *url.URL, appAUD, appTokenPath, orgTokenPath strin
 		return "", errors.Wrap(err, "failed to marshal transfer service response")
 	}
 
-	// If we were able to get the auth domain and generate an org token path, lets write it to disk.
+	// If we were able to get the auth domain and generate an org token path, lets store it.
 	if orgTokenPath != "" {
-		if err := os.WriteFile(orgTokenPath, []byte(resp.OrgToken), 0600); err != nil {
-			return "", errors.Wrap(err, "failed to write org token to disk")
+		if err := writeToken(orgTokenPath, []byte(resp.OrgToken)); err != nil {
+			return "", errors.Wrap(err, "failed to store org token")
 		}
 	}
 
-	if err := os.WriteFile(appTokenPath, []byte(resp.AppToken), 0600); err != nil {
-		return "", errors.Wrap(err, "failed to write app token to disk")
+	if err := writeToken(appTokenPath, []byte(resp.AppToken)); err != nil {
+		return "", errors.Wrap(err, "failed to store app token")
 	}
 
 	return resp.AppToken, nil
@@ -254,9 +281,10 @@ func getTokensFromEdge(appURL *url.URL, appAUD, appTokenPath, orgTokenPath strin
 }
 
 // GetAppInfo makes a request to the appURL and stops at the first redirect. The 302 location header will contain the
-// auth domain
-func GetAppInfo(reqURL *url.URL) (*AppInfo, error) {
+// auth domain. tlsConfig holds the client certificate of applications that require mTLS, it can be nil.
+func GetAppInfo(reqURL *url.URL, tlsConfig *tls.Config) (*AppInfo, error) {
 	client := &http.Client{
+		Transport: appTransport(tlsConfig),
 		// do not follow redirects
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// stop after hitting login endpoint since it will contain app path
@@ -301,6 +329,16 @@ func GetAppInfo(reqURL *url.URL) (*AppInfo, error) {
 	return &AppInfo{location.Hostname(), aud, domain}, nil
 }
 
+// appTransport returns the transport of the requests to an application, nil uses the default one.
+func appTransport(tlsConfig *tls.Config) http.RoundTripper {
+	if tlsConfig == nil {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport
+}
+
 func handleRedirects(req *http.Request, via []*http.Request, orgToken string) error {
 	// attach org token to login request
 	if strings.Contains(req.URL.Path, AccessLoginWorkerPath) {
@@ -332,8 +370,9 @@ func handleRedirects(req *http.Request, via []*http.Request, orgToken string) er
 
 // exchangeOrgToken attaches an org token to a request to the appURL and returns an app token. This uses the Access SSO
 // flow to automatically generate and return an app token without the login page.
-func exchangeOrgToken(appURL *url.URL, orgToken string) (string, error) {
+func exchangeOrgToken(appURL *url.URL, orgToken string, tlsConfig *tls.Config) (string, error) {
 	client := &http.Client{
+		Transport: appTransport(tlsConfig),
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return handleRedirects(req, via, orgToken)
 		},
@@ -382,7 +421,7 @@ func GetOrgTokenIfExists(authDomain string) (string, error) {
 	}
 
 	if payload.isExpired() {
-		err := os.Remove(path)
+		err := removeToken(path)
 		return "", err
 	}
 	return token.CompactSerialize()
@@ -404,7 +443,7 @@ func GetAppTokenIfExists(appInfo *AppInfo) (string, error) {
 	}
 
 	if payload.isExpired() {
-		err := os.Remove(path)
+		err := removeToken(path)
 		return "", err
 	}
 	return token.CompactSerialize()
@@ -413,7 +452,7 @@ func GetAppTokenIfExists(appInfo *AppInfo) (string, error) {
 
 // GetTokenIfExists will return the token from local storage if it exists and not expired
 func getTokenIfExists(path string) (*jose.JSONWebSignature, error) {
-	content, err := os.ReadFile(path)
+	content, err := readToken(path)
 	if err != nil {
 		return nil, err
 	}
@@ -430,9 +469,5 @@ func RemoveTokenIfExists(appInfo *AppInfo) error {
 	if err != nil {
 		return err
 	}
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-		return err
-	}
-
-	return nil
+	return removeToken(path)
 }
@@ -1,9 +1,17 @@
 package token
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"net/http"
 	"net/url"
 	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHandleRedirects_AttachOrgToken(t *testing.T) {
@@ -80,3 +88,30 @@ func TestHandleRedirects_StopAtAuthorizedEndpoint(t *testing.T) {
 		t.Errorf("Expected ErrUseLastResponse, got %v", err)
 	}
 }
+
+func TestParseClaims(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(t, err)
+
+	iat := time.Now().Truncate(time.Second)
+	exp := iat.Add(time.Hour)
+	rawToken, err := jwt.Signed(signer).Claims(map[string]interface{}{
+		"aud":   []string{"app-aud"},
+		"email": "alice@example.com",
+		"iat":   iat.Unix(),
+		"exp":   exp.Unix(),
+	}).Serialize()
+	require.NoError(t, err)
+
+	claims, err := ParseClaims(rawToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", claims.Email)
+	assert.Equal(t, []string{"app-aud"}, claims.Audience)
+	assert.True(t, iat.Equal(claims.IssuedAt))
+	assert.True(t, exp.Equal(claims.ExpiresAt))
+
+	_, err = ParseClaims("not a token")
+	assert.Error(t, err)
+}
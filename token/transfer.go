@@ -2,12 +2,12 @@ package token
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"time"
 
 	"github.com/pkg/errors"
@@ -19,29 +19,51 @@ const (
 	clientTimeout = time.Second * 60
 )
 
+// LoginOptions selects how the login flows get the user to the login URL, nil opens it in a browser.
+type LoginOptions struct {
+	// ListenerAddress is a local address, e.g. localhost:8099 forwarded with ssh -L, that redirects to the login URL
+	// instead of opening a browser. On headless machines, it lets the login complete in a full browser with access to
+	// the hardware security keys that the WebAuthn challenges of the identity provider require. The browser is
+	// redirected back to the listener once the login completed.
+	ListenerAddress string
+	// NoBrowser prints the login URL along with a QR code to scan it with a phone, instead of opening a browser
+	NoBrowser bool
+	// BrowserCommand opens the login URL instead of the default browser of the user, e.g. to pick a browser profile.
+	// The URL replaces the %s of the command, or is appended to it.
+	BrowserCommand string
+	// TLSClientConfig is used for the requests to the application, it holds the client certificate of applications
+	// that require mTLS
+	TLSClientConfig *tls.Config
+}
+
+func (o *LoginOptions) tlsClientConfig() *tls.Config {
+	if o == nil {
+		return nil
+	}
+	return o.TLSClientConfig
+}
+
 // RunTransfer does the transfer "dance" with the end result downloading the supported resource.
 // The expanded description is run is encapsulation of shared business logic needed
 // to request a resource (token/cert/etc) from the transfer service (loginhelper).
 // The "dance" we refer to is building a HTTP request, opening that in a browser waiting for
 // the user to complete an action, while it long polls in the background waiting for an
 // action to be completed to download the resource.
-func RunTransfer(transferURL *url.URL, appAUD, resourceName, key, value string, shouldEncrypt bool, useHostOnly bool, log *zerolog.Logger) ([]byte, error) {
+func RunTransfer(transferURL *url.URL, appAUD, resourceName, key, value string, shouldEncrypt bool, useHostOnly bool, options *LoginOptions, log *zerolog.Logger) ([]byte, error) {
+	if options == nil {
+		options = &LoginOptions{}
+	}
 	encrypterClient, err := NewEncrypter("cloudflared_priv.pem", "cloudflared_pub.pem")
 	if err != nil {
 		return nil, err
 	}
-	requestURL, err := buildRequestURL(transferURL, appAUD, key, value+encrypterClient.PublicKey(), shouldEncrypt, useHostOnly)
+	requestURL, err := buildRequestURL(transferURL, appAUD, key, value+encrypterClient.PublicKey(), shouldEncrypt, useHostOnly, options.ListenerAddress)
 	if err != nil {
 		return nil, err
 	}
 
-	// See AUTH-1423 for why we use stderr (the way git wraps ssh)
-	err = OpenBrowser(requestURL)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Please open the following URL and log in with your Cloudflare account:\n\n%s\n\nLeave cloudflared running to download the %s automatically.\n", requestURL, resourceName)
-	} else {
-		fmt.Fprintf(os.Stderr, "A browser window should have opened at the following URL:\n\n%s\n\nIf the browser failed to open, please visit the URL above directly in your browser.\n", requestURL)
-	}
+	stopLogin := startLogin(requestURL, resourceName, options)
+	defer stopLogin()
 
 	var resourceData []byte
 
@@ -75,8 +97,9 @@ func RunTransfer(transferURL *url.URL, appAUD, resourceName, key, value string,
 
 // BuildRequestURL creates a request suitable for a resource transfer.
 // it will return a constructed url based off the base url and query key/value provided.
-// cli will build a url for cli transfer request.
-func buildRequestURL(baseURL *url.URL, appAUD string, key, value string, cli, useHostOnly bool) (string, error) {
+// cli will build a url for cli transfer request, redirecting the browser to the login listener at listenerAddress
+// once the login completed if it is set.
+func buildRequestURL(baseURL *url.URL, appAUD string, key, value string, cli, useHostOnly bool, listenerAddress string) (string, error) {
 	q := baseURL.Query()
 	q.Set(key, value)
 	q.Set("aud", appAUD)
@@ -88,10 +111,14 @@ func buildRequestURL(baseURL *url.URL, appAUD string, key, value string, cli, us
 	if !cli {
 		return baseURL.String(), nil
 	}
-	q.Set("redirect_url", baseURL.String()) // we add the token as a query param on both the redirect_url and the main url
-	q.Set("send_org_token", "true")         // indicates that the cli endpoint should return both the org and app token
-	q.Set("edge_token_transfer", "true")    // use new LoginHelper service built on workers
-	baseURL.RawQuery = q.Encode()           // and this actual baseURL.
+	redirectURL := baseURL.String()
+	if listenerAddress != "" {
+		redirectURL = loginCallbackURL(listenerAddress, baseURL.RawQuery)
+	}
+	q.Set("redirect_url", redirectURL)   // we add the token as a query param on both the redirect_url and the main url
+	q.Set("send_org_token", "true")      // indicates that the cli endpoint should return both the org and app token
+	q.Set("edge_token_transfer", "true") // use new LoginHelper service built on workers
+	baseURL.RawQuery = q.Encode()        // and this actual baseURL.
 	baseURL.Path = "cdn-cgi/access/cli"
 	return baseURL.String(), nil
 }
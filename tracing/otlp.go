@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	otlpTracerInstrumentName = "proxy"
+	otlpTracesPath           = "/v1/traces"
+	otlpExportTimeout        = 10 * time.Second
+)
+
+// w3cPropagator propagates the traces exported with OTLP in the traceparent and tracestate headers, unlike the traces
+// sent back to the edge that use the jaeger format.
+var w3cPropagator = propagation.TraceContext{}
+
+// OTLPExporter exports spans of the proxied requests to an OpenTelemetry collector with OTLP over HTTP. These traces
+// are independent of those cloudflared returns to the edge. A nil OTLPExporter records nothing.
+type OTLPExporter struct {
+	provider *tracesdk.TracerProvider
+	tracer   trace.Tracer
+}
+
+// NewOTLPExporter creates an exporter sending a sampleRatio of the traces to the collector at endpoint, with headers
+// e.g. to authenticate. The path of the endpoint defaults to /v1/traces. The requests continue the trace of their
+// traceparent header, but since anyone can send one, its sampling decision is only followed if trustTraceparent.
+func NewOTLPExporter(endpoint string, headers map[string]string, sampleRatio float64, trustTraceparent bool) (*OTLPExporter, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || (endpointURL.Scheme != "http" && endpointURL.Scheme != "https") || endpointURL.Host == "" {
+		return nil, fmt.Errorf("the OTLP endpoint %s must be a http:// or https:// URL", endpoint)
+	}
+	if endpointURL.Path == "" || endpointURL.Path == "/" {
+		endpointURL.Path = otlpTracesPath
+	}
+	client := &otlpHTTPClient{
+		endpoint: endpointURL.String(),
+		headers:  headers,
+		client:   &http.Client{Timeout: otlpExportTimeout},
+	}
+	exporter, err := otlptrace.New(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	sampler := tracesdk.TraceIDRatioBased(sampleRatio)
+	var parentOptions []tracesdk.ParentBasedSamplerOption
+	if !trustTraceparent {
+		parentOptions = append(parentOptions,
+			tracesdk.WithRemoteParentSampled(sampler),
+			tracesdk.WithRemoteParentNotSampled(sampler),
+		)
+	}
+	provider := tracesdk.NewTracerProvider(
+		tracesdk.WithBatcher(exporter),
+		tracesdk.WithSampler(tracesdk.ParentBased(sampler, parentOptions...)),
+		tracesdk.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			serviceAttribute,
+			hostnameAttribute,
+			cloudflaredVersionAttribute,
+			HostOSAttribute,
+			HostArchAttribute,
+		)),
+	)
+	return &OTLPExporter{provider: provider, tracer: provider.Tracer(otlpTracerInstrumentName)}, nil
+}
+
+// Shutdown exports the spans not exported yet.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	return e.provider.Shutdown(ctx)
+}
+
+// StartRequest starts the span of a request received from the edge, in the trace of its traceparent header if it has
+// one.
+func (e *OTLPExporter) StartRequest(req *http.Request) (context.Context, trace.Span) {
+	if e == nil {
+		return context.Background(), NewNoopSpan()
+	}
+	ctx := w3cPropagator.Extract(context.Background(), propagation.HeaderCarrier(req.Header))
+	return e.tracer.Start(ctx, "proxy_request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPHostKey.String(req.Host),
+			semconv.HTTPTargetKey.String(req.URL.RequestURI()),
+		),
+	)
+}
+
+// Start starts a span, if ctx is in a trace of the exporter.
+func (e *OTLPExporter) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if e == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, NewNoopSpan()
+	}
+	return e.tracer.Start(ctx, name, opts...)
+}
+
+// TraceOrigin propagates the trace of ctx to the request to the origin in its traceparent header, and records the
+// dials of the origin made for it.
+func (e *OTLPExporter) TraceOrigin(ctx context.Context, req *http.Request) *http.Request {
+	if e == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return req
+	}
+	w3cPropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	dials := &originDials{exporter: e, ctx: ctx, spans: make(map[string]trace.Span)}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		ConnectStart: dials.start,
+		ConnectDone:  dials.done,
+	}))
+}
+
+// originDials records a span for each connection dialed to the origin, there can be several with happy eyeballs.
+type originDials struct {
+	exporter *OTLPExporter
+	ctx      context.Context
+	lock     sync.Mutex
+	spans    map[string]trace.Span
+}
+
+func (d *originDials) start(network, addr string) {
+	_, span := d.exporter.tracer.Start(d.ctx, "origin_dial",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("net.transport", network), semconv.NetPeerNameKey.String(addr)),
+	)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.spans[network+addr] = span
+}
+
+func (d *originDials) done(network, addr string, err error) {
+	d.lock.Lock()
+	span, ok := d.spans[network+addr]
+	delete(d.spans, network+addr)
+	d.lock.Unlock()
+	if !ok {
+		return
+	}
+	if err != nil {
+		EndWithErrorStatus(span, err)
+		return
+	}
+	End(span)
+}
+
+// SetHTTPStatus sets the status code of the response on the span, failing it for server errors.
+func SetHTTPStatus(span trace.Span, statusCode int) {
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(statusCode))
+	if statusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+}
+
+// otlpHTTPClient uploads the spans to a collector with the binary protobuf encoding of OTLP over HTTP.
+type otlpHTTPClient struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func (c *otlpHTTPClient) Start(_ context.Context) error {
+	return nil
+}
+
+func (c *otlpHTTPClient) Stop(_ context.Context) error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *otlpHTTPClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	body, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("the OTLP collector responded with %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
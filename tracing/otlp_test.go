@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	var lock sync.Mutex
+	spans := make(map[string]string)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var export coltracepb.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &export))
+		lock.Lock()
+		defer lock.Unlock()
+		for _, resourceSpans := range export.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					spans[span.Name] = hex.EncodeToString(span.TraceId)
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	exporter, err := NewOTLPExporter(collector.URL, map[string]string{"Authorization": "secret"}, 1, false)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/path", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, requestSpan := exporter.StartRequest(req)
+	originCtx, originSpan := exporter.Start(ctx, "origin_response")
+	originReq := exporter.TraceOrigin(originCtx, httptest.NewRequest(http.MethodGet, "http://localhost:8080/path", nil))
+	assert.Regexp(t, "^00-4bf92f3577b34da6a3ce929d0e0e4736-"+trace.SpanContextFromContext(originCtx).SpanID().String()+"-01$", originReq.Header.Get("traceparent"))
+	SetHTTPStatus(originSpan, http.StatusOK)
+	originSpan.End()
+	requestSpan.End()
+
+	require.NoError(t, exporter.Shutdown(context.Background()))
+	assert.Equal(t, map[string]string{
+		"proxy_request":   "4bf92f3577b34da6a3ce929d0e0e4736",
+		"origin_response": "4bf92f3577b34da6a3ce929d0e0e4736",
+	}, spans)
+}
+
+func TestOTLPExporterTraceparentSampling(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/path", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// The sampled flag of an untrusted traceparent doesn't override the sample ratio
+	exporter, err := NewOTLPExporter(collector.URL, nil, 0, false)
+	require.NoError(t, err)
+	_, span := exporter.StartRequest(req)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.False(t, span.SpanContext().IsSampled())
+	span.End()
+	require.NoError(t, exporter.Shutdown(context.Background()))
+
+	exporter, err = NewOTLPExporter(collector.URL, nil, 0, true)
+	require.NoError(t, err)
+	_, span = exporter.StartRequest(req)
+	assert.True(t, span.SpanContext().IsSampled())
+	span.End()
+	require.NoError(t, exporter.Shutdown(context.Background()))
+}
+
+func TestNilOTLPExporter(t *testing.T) {
+	var exporter *OTLPExporter
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/path", nil)
+	ctx, span := exporter.StartRequest(req)
+	assert.False(t, span.SpanContext().IsValid())
+	_, span = exporter.Start(ctx, "origin_response")
+	assert.False(t, span.SpanContext().IsValid())
+	assert.Equal(t, req, exporter.TraceOrigin(ctx, req))
+	assert.Empty(t, req.Header.Get("traceparent"))
+	assert.NoError(t, exporter.Shutdown(context.Background()))
+
+	_, err := NewOTLPExporter("localhost:4318", nil, 1, false)
+	assert.Error(t, err, "the endpoint must be a URL")
+}
@@ -0,0 +1,275 @@
+package tunneldns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultBlocklistRefresh = 24 * time.Hour
+
+	// blockedTTL is the TTL of the answers to blocked names
+	blockedTTL           = 300
+	blocklistHTTPTimeout = 30 * time.Second
+)
+
+// BlockAnswer is how queries for blocked names are answered
+type BlockAnswer string
+
+const (
+	// BlockNXDomain answers that blocked names don't exist
+	BlockNXDomain BlockAnswer = "nxdomain"
+	// BlockNull answers the unspecified address (0.0.0.0 and ::) for blocked names
+	BlockNull BlockAnswer = "null"
+)
+
+// BlocklistConfig configures the lists of names that are answered locally instead of being resolved.
+type BlocklistConfig struct {
+	// Sources are files or http(s) URLs in the hosts format, the adblock format (||example.com^) or with one domain
+	// per line
+	Sources []string
+	// Refresh is how often the lists are reloaded, DefaultBlocklistRefresh if zero
+	Refresh time.Duration
+	// Answer is BlockNXDomain if empty
+	Answer BlockAnswer
+}
+
+type blocklist struct {
+	source string
+	// exact are the blocked names, suffixes are the names blocked along with their subdomains
+	exact    map[string]struct{}
+	suffixes map[string]struct{}
+}
+
+// BlocklistPlugin answers the queries for the names of the blocklists, other queries are passed to the next plugin.
+type BlocklistPlugin struct {
+	Next plugin.Handler
+
+	config BlocklistConfig
+	client *http.Client
+	log    *zerolog.Logger
+	lists  atomic.Pointer[[]*blocklist]
+}
+
+// NewBlocklistPlugin creates a plugin and loads its lists. Failing to load a file is an error, while failing to
+// download a list is logged and retried on the next refresh. It's up to the caller to set the Next handler.
+func NewBlocklistPlugin(config BlocklistConfig, log *zerolog.Logger) (*BlocklistPlugin, error) {
+	switch config.Answer {
+	case "":
+		config.Answer = BlockNXDomain
+	case BlockNXDomain, BlockNull:
+	default:
+		return nil, fmt.Errorf("invalid blocklist answer %q, expected %s or %s", config.Answer, BlockNXDomain, BlockNull)
+	}
+	if config.Refresh <= 0 {
+		config.Refresh = DefaultBlocklistRefresh
+	}
+	p := &BlocklistPlugin{
+		config: config,
+		client: &http.Client{Timeout: blocklistHTTPTimeout},
+		log:    log,
+	}
+
+	lists := make([]*blocklist, 0, len(config.Sources))
+	for _, source := range config.Sources {
+		list, err := p.load(context.Background(), source)
+		if err != nil {
+			if isURL(source) {
+				log.Err(err).Str("blocklist", source).Msg("Failed to download the blocklist, retrying on the next refresh")
+				list = &blocklist{source: source}
+			} else {
+				return nil, err
+			}
+		}
+		lists = append(lists, list)
+	}
+	p.setLists(lists)
+	return p, nil
+}
+
+// Run reloads the lists periodically until the context is cancelled. A list that fails to reload is kept as is.
+func (p *BlocklistPlugin) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.config.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := *p.lists.Load()
+		lists := make([]*blocklist, 0, len(current))
+		for _, list := range current {
+			reloaded, err := p.load(ctx, list.source)
+			if err != nil {
+				p.log.Err(err).Str("blocklist", list.source).Msg("Failed to reload the blocklist, keeping the previous one")
+				reloaded = list
+			}
+			lists = append(lists, reloaded)
+		}
+		p.setLists(lists)
+	}
+}
+
+func (p *BlocklistPlugin) setLists(lists []*blocklist) {
+	for _, list := range lists {
+		setBlocklistEntries(list.source, len(list.exact)+len(list.suffixes))
+	}
+	p.lists.Store(&lists)
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *BlocklistPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if len(r.Question) != 1 {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+	q := r.Question[0]
+	list := p.match(dns.CanonicalName(q.Name))
+	if list == nil {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+	incrementBlocked(list.source)
+	setAnsweredBy(ctx, answeredByBlocklist)
+
+	reply := new(dns.Msg)
+	reply.SetReply(r)
+	reply.Authoritative = true
+	if p.config.Answer == BlockNXDomain {
+		reply.Rcode = dns.RcodeNameError
+	} else {
+		header := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: blockedTTL}
+		switch q.Qtype {
+		case dns.TypeA:
+			reply.Answer = []dns.RR{&dns.A{Hdr: header, A: net.IPv4zero}}
+		case dns.TypeAAAA:
+			reply.Answer = []dns.RR{&dns.AAAA{Hdr: header, AAAA: net.IPv6zero}}
+		}
+	}
+	if err := w.WriteMsg(reply); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *BlocklistPlugin) Name() string { return "blocklist" }
+
+// match returns the first list blocking the name, nil if it is not blocked.
+func (p *BlocklistPlugin) match(name string) *blocklist {
+	for _, list := range *p.lists.Load() {
+		if _, ok := list.exact[name]; ok {
+			return list
+		}
+		for suffix, end := name, false; !end; suffix, end = nextParent(suffix) {
+			if _, ok := list.suffixes[suffix]; ok {
+				return list
+			}
+		}
+	}
+	return nil
+}
+
+// nextParent returns the parent domain of the name, and true when it reached the root.
+func nextParent(name string) (string, bool) {
+	i, end := dns.NextLabel(name, 0)
+	if end {
+		return "", true
+	}
+	return name[i:], name[i:] == "."
+}
+
+func (p *BlocklistPlugin) load(ctx context.Context, source string) (*blocklist, error) {
+	var reader io.ReadCloser
+	if isURL(source) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to download blocklist")
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to download blocklist %s: %s", source, resp.Status)
+		}
+		reader = resp.Body
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open blocklist")
+		}
+		reader = file
+	}
+	defer reader.Close()
+
+	list, err := parseBlocklist(source, reader)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Info().Str("blocklist", source).Int("entries", len(list.exact)+len(list.suffixes)).Msg("Loaded DNS blocklist")
+	return list, nil
+}
+
+// parseBlocklist reads a list in the hosts format, the adblock format or with one domain per line. Invalid lines are
+// skipped since public lists often contain rules that don't apply to DNS.
+func parseBlocklist(source string, reader io.Reader) (*blocklist, error) {
+	list := &blocklist{
+		source:   source,
+		exact:    make(map[string]struct{}),
+		suffixes: make(map[string]struct{}),
+	}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+			continue
+		}
+		if rule, ok := strings.CutPrefix(line, "||"); ok {
+			// Only the domain rules apply, e.g. ||example.com^ but not ||example.com/ads^ or ||example.com^$third-party
+			domain, ok := strings.CutSuffix(rule, "^")
+			if ok && isBlockableName(domain) {
+				list.suffixes[dns.CanonicalName(domain)] = struct{}{}
+			}
+			continue
+		}
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 1 && isBlockableName(fields[0]):
+			list.suffixes[dns.CanonicalName(fields[0])] = struct{}{}
+		case len(fields) >= 2 && net.ParseIP(fields[0]) != nil:
+			for _, name := range fields[1:] {
+				if isBlockableName(name) && name != "localhost" {
+					list.exact[dns.CanonicalName(name)] = struct{}{}
+				}
+			}
+		}
+	}
+	return list, errors.Wrapf(scanner.Err(), "failed to read blocklist %s", source)
+}
+
+func isBlockableName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "/*$|^ ") || net.ParseIP(name) != nil {
+		return false
+	}
+	_, ok := dns.IsDomainName(name)
+	return ok
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
@@ -0,0 +1,108 @@
+package tunneldns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	list, err := parseBlocklist("test", strings.NewReader(`
+# hosts format
+0.0.0.0 ads.example.com tracker.example.com # trailing comment
+127.0.0.1 localhost
+::1 ip6-localhost
+! adblock format
+[Adblock Plus 2.0]
+||Ads.Example.NET^
+||example.org/banner^
+||example.org^$third-party
+# domain per line
+malware.example
+*.wildcard.example
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{
+		"ads.example.com.":     {},
+		"tracker.example.com.": {},
+		"ip6-localhost.":       {},
+	}, list.exact)
+	require.Equal(t, map[string]struct{}{
+		"ads.example.net.": {},
+		"malware.example.": {},
+	}, list.suffixes)
+}
+
+func TestBlocklistPlugin(t *testing.T) {
+	hostsFile := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(hostsFile, []byte("0.0.0.0 ads.example.com\n"), 0o600))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("||tracker.example^\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		answer BlockAnswer
+		check  func(t *testing.T, reply *dns.Msg)
+	}{
+		{
+			answer: BlockNXDomain,
+			check: func(t *testing.T, reply *dns.Msg) {
+				require.Equal(t, dns.RcodeNameError, reply.Rcode)
+				require.Empty(t, reply.Answer)
+			},
+		},
+		{
+			answer: BlockNull,
+			check: func(t *testing.T, reply *dns.Msg) {
+				require.Equal(t, dns.RcodeSuccess, reply.Rcode)
+				require.Equal(t, "0.0.0.0", reply.Answer[0].(*dns.A).A.String())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.answer), func(t *testing.T) {
+			log := zerolog.Nop()
+			next := &countingHandler{reply: answerWithTTL(300)}
+			p, err := NewBlocklistPlugin(BlocklistConfig{Sources: []string{hostsFile, server.URL}, Answer: test.answer}, &log)
+			require.NoError(t, err)
+			p.Next = next
+
+			for _, name := range []string{"ads.example.com.", "tracker.example.", "www.tracker.example."} {
+				query := new(dns.Msg)
+				query.SetQuestion(name, dns.TypeA)
+				rec := dnstest.NewRecorder(&testResponseWriter{})
+				_, err := p.ServeDNS(context.Background(), rec, query)
+				require.NoError(t, err)
+				test.check(t, rec.Msg)
+			}
+			require.Equal(t, int32(0), next.queries.Load())
+
+			// Subdomains of the hosts entries are not blocked
+			queryCache(t, p, "www.ads.example.com.")
+			queryCache(t, p, "example.com.")
+			require.Equal(t, int32(2), next.queries.Load())
+		})
+	}
+}
+
+func TestBlocklistPluginUnavailable(t *testing.T) {
+	log := zerolog.Nop()
+	_, err := NewBlocklistPlugin(BlocklistConfig{Sources: []string{filepath.Join(t.TempDir(), "missing")}}, &log)
+	require.Error(t, err)
+
+	// Lists that can't be downloaded are retried later
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	_, err = NewBlocklistPlugin(BlocklistConfig{Sources: []string{server.URL}}, &log)
+	require.NoError(t, err)
+}
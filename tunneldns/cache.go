@@ -0,0 +1,347 @@
+package tunneldns
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+)
+
+const (
+	DefaultCacheSize        = 10000
+	DefaultCacheMaxTTL      = time.Hour
+	DefaultCacheNegativeTTL = 30 * time.Minute
+
+	// An entry is prefetched when less than prefetchThreshold of its TTL remains
+	prefetchThreshold = 10
+	prefetchTimeout   = defaultTimeout
+)
+
+// CacheConfig configures the cache in front of the upstreams. The zero value caches with the defaults.
+type CacheConfig struct {
+	// Disabled sends every query upstream
+	Disabled bool
+	// Size is the maximum number of cached responses
+	Size int
+	// MinTTL and MaxTTL clamp the TTL of cached positive responses
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// NegativeTTL is the maximum TTL of cached NXDOMAIN and NODATA responses, negative responses are not cached
+	// if it is negative
+	NegativeTTL time.Duration
+	// Prefetch is the number of hits after which an entry is refreshed before it expires, zero disables prefetching
+	Prefetch int
+}
+
+func (c CacheConfig) withDefaults() CacheConfig {
+	if c.Size <= 0 {
+		c.Size = DefaultCacheSize
+	}
+	if c.MaxTTL <= 0 {
+		c.MaxTTL = DefaultCacheMaxTTL
+	}
+	if c.MinTTL > c.MaxTTL {
+		c.MinTTL = c.MaxTTL
+	}
+	if c.NegativeTTL == 0 {
+		c.NegativeTTL = DefaultCacheNegativeTTL
+	}
+	return c
+}
+
+type cacheEntry struct {
+	key         string
+	msg         *dns.Msg
+	storedAt    time.Time
+	ttl         time.Duration
+	hits        int
+	prefetching bool
+}
+
+func (e *cacheEntry) remaining(now time.Time) time.Duration {
+	return e.ttl - now.Sub(e.storedAt)
+}
+
+// CachePlugin caches the responses of the next plugin, it replaces the CoreDNS cache plugin so that TTL clamping,
+// negative caching and prefetching can be configured. The least recently used entry is evicted when the cache is
+// full.
+type CachePlugin struct {
+	Next plugin.Handler
+
+	config CacheConfig
+	// name labels the metrics of the cache
+	name string
+	lock sync.Mutex
+	// entries are the elements of lru, whose values are the *cacheEntry from the most to the least recently used
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+// NewCachePlugin creates a cache with the provided configuration, it's up to the caller to set the Next handler. The
+// name labels its metrics, as each client policy has its own cache.
+func NewCachePlugin(name string, config CacheConfig) *CachePlugin {
+	return &CachePlugin{
+		config:  config.withDefaults(),
+		name:    name,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (c *CachePlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	key, ok := cacheKey(r)
+	if c.config.Disabled || !ok {
+		return plugin.NextOrFailure(c.Name(), c.Next, ctx, w, r)
+	}
+
+	if reply, prefetch := c.get(key, r); reply != nil {
+		incrementCacheHit()
+		setAnsweredBy(ctx, answeredByCache)
+		if prefetch {
+			// w can't be used once ServeDNS returns, the prefetch only keeps the addresses of the query
+			go c.prefetch(key, r.Copy(), &prefetchWriter{local: w.LocalAddr(), remote: w.RemoteAddr()})
+		}
+		if err := w.WriteMsg(reply); err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		return dns.RcodeSuccess, nil
+	}
+	incrementCacheMiss()
+
+	rw := dnstest.NewRecorder(w)
+	status, err := plugin.NextOrFailure(c.Name(), c.Next, ctx, rw, r)
+	if err == nil && rw.Msg != nil {
+		c.set(key, rw.Msg)
+	}
+	return status, err
+}
+
+// Name implements the CoreDNS plugin interface
+func (c *CachePlugin) Name() string { return "cache" }
+
+// get returns a reply for the query if it is cached, and if the entry should be prefetched.
+func (c *CachePlugin) get(key string, r *dns.Msg) (*dns.Msg, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	now := c.now()
+	remaining := entry.remaining(now)
+	if remaining <= 0 {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	entry.hits++
+
+	prefetch := c.config.Prefetch > 0 && !entry.prefetching &&
+		entry.hits >= c.config.Prefetch && remaining < entry.ttl/prefetchThreshold
+	if prefetch {
+		entry.prefetching = true
+	}
+
+	reply := entry.msg.Copy()
+	reply.Id = r.Id
+	decrementTTLs(reply, uint32(now.Sub(entry.storedAt)/time.Second))
+	return reply, prefetch
+}
+
+func (c *CachePlugin) set(key string, msg *dns.Msg) {
+	ttl, ok := c.responseTTL(msg)
+	if !ok {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stored := msg.Copy()
+	// Clients shouldn't cache the response for longer than the cache does
+	capTTLs(stored, ttl)
+	entry := &cacheEntry{
+		key:      key,
+		msg:      stored,
+		storedAt: c.now(),
+		ttl:      ttl,
+	}
+	if element, exists := c.entries[key]; exists {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	if c.lru.Len() >= c.config.Size {
+		c.remove(c.lru.Back())
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	setCacheEntries(c.name, c.lru.Len())
+}
+
+// remove removes the entry of the element from the cache. The caller must hold the lock.
+func (c *CachePlugin) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+	setCacheEntries(c.name, c.lru.Len())
+}
+
+// prefetch refreshes an entry in the background so that popular names don't expire from the cache.
+func (c *CachePlugin) prefetch(key string, r *dns.Msg, w *prefetchWriter) {
+	incrementCachePrefetch()
+	ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+	defer cancel()
+
+	_, err := plugin.NextOrFailure(c.Name(), c.Next, ctx, w, r)
+	if err == nil && w.msg != nil {
+		c.set(key, w.msg)
+		return
+	}
+
+	// Allow another prefetch of the entry since this one failed
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).prefetching = false
+	}
+}
+
+// prefetchWriter is the dns.ResponseWriter of a prefetch, which isn't tied to the connection of the query that
+// triggered it. It captures the response instead of writing it.
+type prefetchWriter struct {
+	local  net.Addr
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (w *prefetchWriter) LocalAddr() net.Addr  { return w.local }
+func (w *prefetchWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *prefetchWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+	return nil
+}
+
+func (w *prefetchWriter) Write(buf []byte) (int, error) { return len(buf), nil }
+func (w *prefetchWriter) Close() error                  { return nil }
+func (w *prefetchWriter) TsigStatus() error             { return nil }
+func (w *prefetchWriter) TsigTimersOnly(bool)           {}
+func (w *prefetchWriter) Hijack()                       {}
+
+// responseTTL returns how long the response can be cached for, and false if it can't be cached.
+func (c *CachePlugin) responseTTL(msg *dns.Msg) (time.Duration, bool) {
+	if msg.Truncated {
+		return 0, false
+	}
+	switch {
+	case msg.Rcode == dns.RcodeSuccess && len(msg.Answer) > 0:
+		ttl := clamp(minTTL(msg.Answer, msg.Ns, msg.Extra), c.config.MinTTL, c.config.MaxTTL)
+		return ttl, ttl > 0
+	case msg.Rcode == dns.RcodeNameError || msg.Rcode == dns.RcodeSuccess:
+		// Negative responses are cached for the SOA minimum https://www.rfc-editor.org/rfc/rfc2308#section-5
+		if c.config.NegativeTTL < 0 {
+			return 0, false
+		}
+		for _, rr := range msg.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl := time.Duration(min(soa.Hdr.Ttl, soa.Minttl)) * time.Second
+				ttl = min(ttl, c.config.NegativeTTL)
+				return ttl, ttl > 0
+			}
+		}
+		return 0, false
+	default:
+		return 0, false
+	}
+}
+
+func cacheKey(r *dns.Msg) (string, bool) {
+	if len(r.Question) != 1 || r.Opcode != dns.OpcodeQuery {
+		return "", false
+	}
+	q := r.Question[0]
+	var b strings.Builder
+	b.WriteString(strings.ToLower(q.Name))
+	b.WriteByte('/')
+	b.WriteString(strconv.Itoa(int(q.Qtype)))
+	b.WriteByte('/')
+	b.WriteString(strconv.Itoa(int(q.Qclass)))
+	// Responses differ depending on the DNSSEC bits of the query
+	if opt := r.IsEdns0(); opt != nil && opt.Do() {
+		b.WriteString("/do")
+	}
+	if r.CheckingDisabled {
+		b.WriteString("/cd")
+	}
+	// Upstreams can answer differently depending on the client subnet
+	if subnet := clientSubnet(r); subnet != nil {
+		b.WriteString("/ecs=")
+		b.WriteString(subnet.String())
+	}
+	return b.String(), true
+}
+
+func minTTL(sections ...[]dns.RR) time.Duration {
+	var ttl uint32
+	found := false
+	for _, section := range sections {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if !found || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				found = true
+			}
+		}
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+func clamp(ttl, minimum, maximum time.Duration) time.Duration {
+	if ttl < minimum {
+		return minimum
+	}
+	if ttl > maximum {
+		return maximum
+	}
+	return ttl
+}
+
+func capTTLs(msg *dns.Msg, ttl time.Duration) {
+	maximum := uint32(ttl / time.Second)
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if header := rr.Header(); header.Rrtype != dns.TypeOPT && header.Ttl > maximum {
+				header.Ttl = maximum
+			}
+		}
+	}
+}
+
+func decrementTTLs(msg *dns.Msg, elapsed uint32) {
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			header := rr.Header()
+			if header.Rrtype == dns.TypeOPT {
+				continue
+			}
+			if header.Ttl > elapsed {
+				header.Ttl -= elapsed
+			} else {
+				header.Ttl = 0
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package tunneldns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+// countingHandler answers queries with a fixed reply and counts how many queries reached it.
+type countingHandler struct {
+	reply   func(r *dns.Msg) *dns.Msg
+	queries atomic.Int32
+}
+
+func (h *countingHandler) ServeDNS(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	h.queries.Add(1)
+	reply := h.reply(r)
+	return reply.Rcode, w.WriteMsg(reply)
+}
+
+func (h *countingHandler) Name() string { return "counting" }
+
+type testResponseWriter struct {
+	dns.ResponseWriter
+}
+
+func (w *testResponseWriter) WriteMsg(*dns.Msg) error { return nil }
+
+func (w *testResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+func (w *testResponseWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 53000}
+}
+
+func answerWithTTL(ttl uint32) func(r *dns.Msg) *dns.Msg {
+	return func(r *dns.Msg) *dns.Msg {
+		reply := new(dns.Msg)
+		reply.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " A 192.0.2.1")
+		rr.Header().Ttl = ttl
+		reply.Answer = []dns.RR{rr}
+		return reply
+	}
+}
+
+func queryCache(t *testing.T, c plugin.Handler, name string) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion(name, dns.TypeA)
+	rec := dnstest.NewRecorder(&testResponseWriter{})
+	_, err := c.ServeDNS(context.Background(), rec, query)
+	require.NoError(t, err)
+	require.Equal(t, query.Id, rec.Msg.Id)
+	return rec.Msg
+}
+
+func TestCacheHit(t *testing.T) {
+	next := &countingHandler{reply: answerWithTTL(300)}
+	c := NewCachePlugin("test", CacheConfig{})
+	c.Next = next
+
+	queryCache(t, c, "example.com.")
+	queryCache(t, c, "EXAMPLE.com.")
+	require.Equal(t, int32(1), next.queries.Load())
+
+	queryCache(t, c, "other.example.com.")
+	require.Equal(t, int32(2), next.queries.Load())
+}
+
+func TestCacheEviction(t *testing.T) {
+	next := &countingHandler{reply: answerWithTTL(300)}
+	c := NewCachePlugin("eviction", CacheConfig{Size: 2})
+	c.Next = next
+	other := NewCachePlugin("other", CacheConfig{})
+	other.Next = next
+	queryCache(t, other, "example.com.")
+
+	queryCache(t, c, "a.example.com.")
+	queryCache(t, c, "b.example.com.")
+	// a is used more recently than b, which is evicted
+	queryCache(t, c, "a.example.com.")
+	queryCache(t, c, "c.example.com.")
+	require.Equal(t, int32(4), next.queries.Load())
+
+	queryCache(t, c, "a.example.com.")
+	queryCache(t, c, "c.example.com.")
+	require.Equal(t, int32(4), next.queries.Load())
+	queryCache(t, c, "b.example.com.")
+	require.Equal(t, int32(5), next.queries.Load())
+
+	// Each cache reports its own entries
+	for cache, expected := range map[string]float64{"eviction": 2, "other": 1} {
+		var metric dto.Metric
+		require.NoError(t, cacheEntries.WithLabelValues(cache).Write(&metric))
+		require.Equal(t, expected, metric.GetGauge().GetValue(), cache)
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	next := &countingHandler{reply: answerWithTTL(300)}
+	c := NewCachePlugin("test", CacheConfig{Disabled: true})
+	c.Next = next
+
+	queryCache(t, c, "example.com.")
+	queryCache(t, c, "example.com.")
+	require.Equal(t, int32(2), next.queries.Load())
+}
+
+func TestCacheTTLClamping(t *testing.T) {
+	now := time.Now()
+	next := &countingHandler{reply: answerWithTTL(5)}
+	c := NewCachePlugin("test", CacheConfig{MinTTL: time.Minute, MaxTTL: 10 * time.Minute})
+	c.Next = next
+	c.now = func() time.Time { return now }
+
+	// The TTL of 5s is raised to the minimum
+	queryCache(t, c, "short.example.com.")
+	now = now.Add(30 * time.Second)
+	reply := queryCache(t, c, "short.example.com.")
+	require.Equal(t, int32(1), next.queries.Load())
+	require.Equal(t, uint32(0), reply.Answer[0].Header().Ttl)
+
+	// The TTL of a day is lowered to the maximum
+	next.reply = answerWithTTL(86400)
+	queryCache(t, c, "long.example.com.")
+	reply = queryCache(t, c, "long.example.com.")
+	require.Equal(t, uint32(600), reply.Answer[0].Header().Ttl)
+	now = now.Add(11 * time.Minute)
+	queryCache(t, c, "long.example.com.")
+	require.Equal(t, int32(3), next.queries.Load())
+}
+
+func TestCacheNegative(t *testing.T) {
+	nxdomain := func(r *dns.Msg) *dns.Msg {
+		reply := new(dns.Msg)
+		reply.SetRcode(r, dns.RcodeNameError)
+		soa, _ := dns.NewRR("example.com. 3600 IN SOA ns.example.com. admin.example.com. 1 7200 3600 1209600 60")
+		reply.Ns = []dns.RR{soa}
+		return reply
+	}
+
+	tests := []struct {
+		name        string
+		negativeTTL time.Duration
+		queries     int32
+	}{
+		{name: "cached", negativeTTL: DefaultCacheNegativeTTL, queries: 1},
+		{name: "disabled", negativeTTL: -1, queries: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := &countingHandler{reply: nxdomain}
+			c := NewCachePlugin("test", CacheConfig{NegativeTTL: test.negativeTTL})
+			c.Next = next
+
+			queryCache(t, c, "missing.example.com.")
+			reply := queryCache(t, c, "missing.example.com.")
+			require.Equal(t, dns.RcodeNameError, reply.Rcode)
+			require.Equal(t, test.queries, next.queries.Load())
+		})
+	}
+}
+
+func TestCachePrefetch(t *testing.T) {
+	now := time.Now()
+	next := &countingHandler{reply: answerWithTTL(100)}
+	c := NewCachePlugin("test", CacheConfig{Prefetch: 2})
+	c.Next = next
+	c.now = func() time.Time { return now }
+
+	queryCache(t, c, "popular.example.com.")
+	queryCache(t, c, "popular.example.com.")
+	require.Equal(t, int32(1), next.queries.Load())
+
+	// Close to expiry, the next hit is answered from the cache and refreshes the entry in the background
+	now = now.Add(95 * time.Second)
+	queryCache(t, c, "popular.example.com.")
+	require.Eventually(t, func() bool {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.entries["popular.example.com./1/1"].Value.(*cacheEntry).storedAt.Equal(now)
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), next.queries.Load())
+
+	// The refreshed entry outlives the original one
+	now = now.Add(50 * time.Second)
+	queryCache(t, c, "popular.example.com.")
+	require.Equal(t, int32(2), next.queries.Load())
+}
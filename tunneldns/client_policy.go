@@ -0,0 +1,158 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+// ClientPolicyConfig resolves the queries of a set of clients with their own upstreams or blocklists, e.g. so that
+// the devices of a network segment use a filtering resolver.
+type ClientPolicyConfig struct {
+	// Name identifies the policy in the logs, the first client prefix if empty
+	Name    string
+	Clients []netip.Prefix
+	// Upstreams replace the default upstreams for the clients, the default upstreams are used if empty
+	Upstreams []string
+	// Blocklists are applied to the clients on top of the default blocklists, see BlocklistConfig
+	Blocklists []string
+}
+
+// ParseClientPolicyConfig parses a policy in the clients=client[,client...];upstreams=upstream[,upstream...];
+// blocklists=source[,source...];name=name format. Only the clients are required, along with upstreams or blocklists.
+// Clients are prefixes or addresses, and upstreams without a scheme are plain DNS resolvers, e.g.
+// clients=10.0.1.0/24;upstreams=10.0.0.53 is the same as clients=10.0.1.0/24;upstreams=dns://10.0.0.53:53.
+func ParseClientPolicyConfig(s string) (ClientPolicyConfig, error) {
+	var config ClientPolicyConfig
+	for _, field := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return ClientPolicyConfig{}, fmt.Errorf("invalid client policy %q, expected key=value fields separated by ;", s)
+		}
+		switch strings.TrimSpace(key) {
+		case "name":
+			config.Name = strings.TrimSpace(value)
+		case "clients":
+			for _, client := range splitList(value) {
+				prefix, err := parseClientPrefix(client)
+				if err != nil {
+					return ClientPolicyConfig{}, fmt.Errorf("invalid client policy %q, %q is not an address or a prefix", s, client)
+				}
+				config.Clients = append(config.Clients, prefix)
+			}
+		case "upstreams":
+			for _, upstream := range splitList(value) {
+				config.Upstreams = append(config.Upstreams, withDefaultScheme(upstream))
+			}
+		case "blocklists":
+			config.Blocklists = append(config.Blocklists, splitList(value)...)
+		default:
+			return ClientPolicyConfig{}, fmt.Errorf("invalid client policy %q, unknown field %q", s, key)
+		}
+	}
+	if len(config.Clients) == 0 {
+		return ClientPolicyConfig{}, fmt.Errorf("invalid client policy %q, no clients", s)
+	}
+	if len(config.Upstreams) == 0 && len(config.Blocklists) == 0 {
+		return ClientPolicyConfig{}, fmt.Errorf("invalid client policy %q, expected upstreams or blocklists", s)
+	}
+	if config.Name == "" {
+		config.Name = config.Clients[0].String()
+	}
+	return config, nil
+}
+
+// ParseClientPolicyConfigs parses a list of client policies, see ParseClientPolicyConfig.
+func ParseClientPolicyConfigs(policies []string) ([]ClientPolicyConfig, error) {
+	configs := make([]ClientPolicyConfig, 0, len(policies))
+	for _, policy := range policies {
+		config, err := ParseClientPolicyConfig(policy)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseClientPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ClientPolicy is a client policy with the handler resolving the queries of its clients
+type ClientPolicy struct {
+	Name    string
+	Clients []netip.Prefix
+	Handler plugin.Handler
+}
+
+// ClientPolicyPlugin passes the queries to the handler of the most specific policy matching the client, or to the
+// next plugin if none matches.
+type ClientPolicyPlugin struct {
+	Next     plugin.Handler
+	Policies []ClientPolicy
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *ClientPolicyPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if policy := p.match(clientAddr(w.RemoteAddr())); policy != nil {
+		return policy.Handler.ServeDNS(ctx, w, r)
+	}
+	return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *ClientPolicyPlugin) Name() string { return "clientpolicy" }
+
+// match returns the policy with the longest prefix containing the address, nil if there is none.
+func (p *ClientPolicyPlugin) match(addr netip.Addr) *ClientPolicy {
+	if !addr.IsValid() {
+		return nil
+	}
+	var matched *ClientPolicy
+	bits := -1
+	for i := range p.Policies {
+		for _, prefix := range p.Policies[i].Clients {
+			if prefix.Bits() > bits && prefix.Contains(addr) {
+				matched = &p.Policies[i]
+				bits = prefix.Bits()
+			}
+		}
+	}
+	return matched
+}
+
+// clientAddr returns the address of the client, which is invalid if it can't be parsed.
+func clientAddr(addr net.Addr) netip.Addr {
+	if addr == nil {
+		return netip.Addr{}
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().WithZone("").Unmap()
+}
@@ -0,0 +1,106 @@
+package tunneldns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClientPolicyConfig(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ClientPolicyConfig
+		err      bool
+	}{
+		{
+			input: "clients=10.0.1.0/24;upstreams=10.0.0.53",
+			expected: ClientPolicyConfig{
+				Name:      "10.0.1.0/24",
+				Clients:   []netip.Prefix{netip.MustParsePrefix("10.0.1.0/24")},
+				Upstreams: []string{"dns://10.0.0.53:53"},
+			},
+		},
+		{
+			input: "name=kids; clients=10.0.1.5, 2001:db8::/64 ;blocklists=/etc/kids.txt,https://lists.example/kids.txt",
+			expected: ClientPolicyConfig{
+				Name:       "kids",
+				Clients:    []netip.Prefix{netip.MustParsePrefix("10.0.1.5/32"), netip.MustParsePrefix("2001:db8::/64")},
+				Blocklists: []string{"/etc/kids.txt", "https://lists.example/kids.txt"},
+			},
+		},
+		{
+			input: "clients=10.0.1.1/24;upstreams=https://doh.example/dns-query",
+			expected: ClientPolicyConfig{
+				Name:      "10.0.1.0/24",
+				Clients:   []netip.Prefix{netip.MustParsePrefix("10.0.1.0/24")},
+				Upstreams: []string{"https://doh.example/dns-query"},
+			},
+		},
+		{input: "upstreams=10.0.0.53", err: true},
+		{input: "clients=10.0.1.0/24", err: true},
+		{input: "clients=kids;upstreams=10.0.0.53", err: true},
+		{input: "clients=10.0.1.0/24;upstream=10.0.0.53", err: true},
+		{input: "clients=10.0.1.0/24;10.0.0.53", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			config, err := ParseClientPolicyConfig(test.input)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, config)
+		})
+	}
+}
+
+type clientResponseWriter struct {
+	testResponseWriter
+	addr net.Addr
+}
+
+func (w *clientResponseWriter) RemoteAddr() net.Addr { return w.addr }
+
+func TestClientPolicyPlugin(t *testing.T) {
+	p := &ClientPolicyPlugin{
+		Next: ProxyPlugin{Upstreams: []Upstream{namedUpstream("default")}},
+		Policies: []ClientPolicy{
+			{
+				Name:    "office",
+				Clients: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/16")},
+				Handler: ProxyPlugin{Upstreams: []Upstream{namedUpstream("office")}},
+			},
+			{
+				Name:    "kids",
+				Clients: []netip.Prefix{netip.MustParsePrefix("10.0.1.0/24"), netip.MustParsePrefix("2001:db8::/64")},
+				Handler: ProxyPlugin{Upstreams: []Upstream{namedUpstream("kids")}},
+			},
+		},
+	}
+
+	tests := []struct {
+		addr     net.Addr
+		expected string
+	}{
+		{addr: &net.UDPAddr{IP: net.ParseIP("10.0.2.1"), Port: 53000}, expected: "office"},
+		{addr: &net.UDPAddr{IP: net.ParseIP("10.0.1.1"), Port: 53000}, expected: "kids"},
+		{addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53000}, expected: "kids"},
+		{addr: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}, expected: "default"},
+	}
+	for _, test := range tests {
+		t.Run(test.addr.String(), func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeTXT)
+			rec := dnstest.NewRecorder(&clientResponseWriter{addr: test.addr})
+			_, err := p.ServeDNS(context.Background(), rec, query)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, rec.Msg.Answer[0].(*dns.TXT).Txt[0])
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+// DefaultDNS64Prefix is the well-known NAT64 prefix https://www.rfc-editor.org/rfc/rfc6052#section-2.1
+const DefaultDNS64Prefix = "64:ff9b::/96"
+
+// DNS64Config configures the synthesis of AAAA records from A records for IPv6-only networks.
+type DNS64Config struct {
+	Enabled bool
+	// Prefix is the NAT64 prefix, DefaultDNS64Prefix if empty. It must be one of the lengths of RFC 6052.
+	Prefix string
+}
+
+// DNS64Plugin synthesizes AAAA records from the A records of names that don't have any AAAA record, as defined in
+// https://www.rfc-editor.org/rfc/rfc6147.
+type DNS64Plugin struct {
+	Next plugin.Handler
+
+	prefix netip.Prefix
+}
+
+// NewDNS64Plugin creates a plugin synthesizing addresses in the configured prefix, it's up to the caller to set the Next
+// handler.
+func NewDNS64Plugin(config DNS64Config) (*DNS64Plugin, error) {
+	prefixConfig := config.Prefix
+	if prefixConfig == "" {
+		prefixConfig = DefaultDNS64Prefix
+	}
+	prefix, err := netip.ParsePrefix(prefixConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS64 prefix %q: %v", prefixConfig, err)
+	}
+	if !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+		return nil, fmt.Errorf("invalid DNS64 prefix %q, it must be an IPv6 prefix", prefixConfig)
+	}
+	switch prefix.Bits() {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return nil, fmt.Errorf("invalid DNS64 prefix %q, the length must be 32, 40, 48, 56, 64 or 96", prefixConfig)
+	}
+	return &DNS64Plugin{prefix: prefix.Masked()}, nil
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *DNS64Plugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	// Clients that validate DNSSEC themselves would reject synthesized records
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeAAAA || r.Question[0].Qclass != dns.ClassINET || r.CheckingDisabled {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	rw := &captureWriter{ResponseWriter: w}
+	status, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, rw, r)
+	if err != nil || rw.msg == nil {
+		return status, err
+	}
+	response := rw.msg
+	if response.Rcode != dns.RcodeSuccess || hasAnswer(response, dns.TypeAAAA) {
+		return status, w.WriteMsg(response)
+	}
+
+	query := r.Copy()
+	query.Question[0].Qtype = dns.TypeA
+	rw = &captureWriter{ResponseWriter: w}
+	if _, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, rw, query); err != nil || rw.msg == nil || rw.msg.Rcode != dns.RcodeSuccess {
+		// Keep the original answer if the A records can't be resolved
+		return status, w.WriteMsg(response)
+	}
+	return dns.RcodeSuccess, w.WriteMsg(p.synthesize(r, rw.msg))
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *DNS64Plugin) Name() string { return "dns64" }
+
+// synthesize builds the AAAA response from the A response. CNAMEs are kept so that the answer chain stays valid.
+func (p *DNS64Plugin) synthesize(r *dns.Msg, aResponse *dns.Msg) *dns.Msg {
+	response := aResponse.Copy()
+	response.Id = r.Id
+	response.Question = r.Question
+	response.AuthenticatedData = false
+	response.Answer = make([]dns.RR, 0, len(aResponse.Answer))
+	for _, rr := range aResponse.Answer {
+		switch record := rr.(type) {
+		case *dns.A:
+			addr, ok := netip.AddrFromSlice(record.A.To4())
+			if !ok {
+				continue
+			}
+			header := record.Hdr
+			header.Rrtype = dns.TypeAAAA
+			response.Answer = append(response.Answer, &dns.AAAA{Hdr: header, AAAA: p.embed(addr).AsSlice()})
+		case *dns.RRSIG:
+			// The signatures can't cover the synthesized records
+		default:
+			response.Answer = append(response.Answer, dns.Copy(rr))
+		}
+	}
+	return response
+}
+
+// embed returns the IPv4 address embedded in the prefix as defined in https://www.rfc-editor.org/rfc/rfc6052#section-2.2
+func (p *DNS64Plugin) embed(ipv4 netip.Addr) netip.Addr {
+	addr := p.prefix.Addr().As16()
+	v4 := ipv4.As4()
+	offset := p.prefix.Bits() / 8
+	for _, b := range v4 {
+		// Bits 64 to 71 must be zero
+		if offset == 8 {
+			offset++
+		}
+		addr[offset] = b
+		offset++
+	}
+	return netip.AddrFrom16(addr)
+}
+
+func hasAnswer(response *dns.Msg, rrtype uint16) bool {
+	for _, rr := range response.Answer {
+		if rr.Header().Rrtype == rrtype {
+			return true
+		}
+	}
+	return false
+}
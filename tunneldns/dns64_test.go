@@ -0,0 +1,81 @@
+package tunneldns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNS64Embed(t *testing.T) {
+	ipv4 := netip.MustParseAddr("192.0.2.33")
+	// https://www.rfc-editor.org/rfc/rfc6052#section-2.4
+	tests := map[string]string{
+		"2001:db8::/32":         "2001:db8:c000:221::",
+		"2001:db8:100::/40":     "2001:db8:1c0:2:21::",
+		"2001:db8:122::/48":     "2001:db8:122:c000:2:2100::",
+		"2001:db8:122:300::/56": "2001:db8:122:3c0:0:221::",
+		"2001:db8:122:344::/64": "2001:db8:122:344:c0:2:2100:0",
+		"2001:db8:122:344::/96": "2001:db8:122:344::c000:221",
+		DefaultDNS64Prefix:      "64:ff9b::c000:221",
+	}
+	for prefix, expected := range tests {
+		p, err := NewDNS64Plugin(DNS64Config{Prefix: prefix})
+		require.NoError(t, err)
+		require.Equal(t, netip.MustParseAddr(expected), p.embed(ipv4), prefix)
+	}
+
+	for _, invalid := range []string{"2001:db8::/33", "10.0.0.0/8", "not a prefix"} {
+		_, err := NewDNS64Plugin(DNS64Config{Prefix: invalid})
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestDNS64Plugin(t *testing.T) {
+	next := &countingHandler{reply: func(r *dns.Msg) *dns.Msg {
+		reply := new(dns.Msg)
+		reply.SetReply(r)
+		q := r.Question[0]
+		switch {
+		case q.Name == "v4only.example." && q.Qtype == dns.TypeA:
+			reply.Answer = []dns.RR{
+				mustRR(t, "v4only.example. 300 IN CNAME www.v4only.example."),
+				mustRR(t, "www.v4only.example. 300 IN A 192.0.2.1"),
+			}
+		case q.Name == "dualstack.example." && q.Qtype == dns.TypeAAAA:
+			reply.Answer = []dns.RR{mustRR(t, "dualstack.example. 300 IN AAAA 2001:db8::1")}
+		}
+		return reply
+	}}
+	p, err := NewDNS64Plugin(DNS64Config{})
+	require.NoError(t, err)
+	p.Next = next
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		q := new(dns.Msg)
+		q.SetQuestion(name, qtype)
+		rec := dnstest.NewRecorder(&testResponseWriter{})
+		_, err := p.ServeDNS(context.Background(), rec, q)
+		require.NoError(t, err)
+		require.Equal(t, q.Id, rec.Msg.Id)
+		require.Equal(t, q.Question, rec.Msg.Question)
+		return rec.Msg
+	}
+
+	reply := query("v4only.example.", dns.TypeAAAA)
+	require.Len(t, reply.Answer, 2)
+	require.Equal(t, dns.TypeCNAME, reply.Answer[0].Header().Rrtype)
+	require.Equal(t, "64:ff9b::c000:201", reply.Answer[1].(*dns.AAAA).AAAA.String())
+
+	reply = query("dualstack.example.", dns.TypeAAAA)
+	require.Len(t, reply.Answer, 1)
+	require.Equal(t, "2001:db8::1", reply.Answer[0].(*dns.AAAA).AAAA.String())
+
+	// A queries are not changed
+	reply = query("v4only.example.", dns.TypeA)
+	require.Len(t, reply.Answer, 2)
+	require.Equal(t, dns.TypeA, reply.Answer[1].Header().Rrtype)
+}
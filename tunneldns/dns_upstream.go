@@ -0,0 +1,62 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DNSScheme is the URL scheme of plain DNS upstreams, e.g. dns://10.0.0.53:53
+	DNSScheme = "dns"
+
+	dnsDefaultPort = "53"
+)
+
+// UpstreamDNS is the upstream implementation for plain DNS, typically an internal resolver of a forwarding zone.
+// Queries are sent over UDP and retried over TCP when the response is truncated.
+type UpstreamDNS struct {
+	address   string
+	udpClient *dns.Client
+	tcpClient *dns.Client
+	log       *zerolog.Logger
+}
+
+// NewUpstreamDNS creates a new plain DNS upstream from endpoint
+func NewUpstreamDNS(endpoint string, log *zerolog.Logger) (Upstream, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != DNSScheme {
+		return nil, fmt.Errorf("DNS endpoint %s must use the %s scheme", endpoint, DNSScheme)
+	}
+	port := u.Port()
+	if port == "" {
+		port = dnsDefaultPort
+	}
+	return &UpstreamDNS{
+		address:   net.JoinHostPort(u.Hostname(), port),
+		udpClient: &dns.Client{Net: "udp", Timeout: defaultTimeout},
+		tcpClient: &dns.Client{Net: "tcp", Timeout: defaultTimeout},
+		log:       log,
+	}, nil
+}
+
+// Exchange provides an implementation for the Upstream interface
+func (u *UpstreamDNS) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	response, _, err := u.udpClient.ExchangeContext(ctx, query, u.address)
+	if err == nil && response.Truncated {
+		response, _, err = u.tcpClient.ExchangeContext(ctx, query, u.address)
+	}
+	if err != nil {
+		u.log.Err(err).Msgf("failed to exchange with a DNS backend %q", u.address)
+		return nil, errors.Wrap(err, "failed to exchange with the DNS upstream")
+	}
+	return response, nil
+}
@@ -0,0 +1,616 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// maxKeyCacheTTL bounds how long validated zone keys are cached, regardless of their TTL
+	maxKeyCacheTTL = time.Hour
+	// dnssecUDPSize is the EDNS buffer size advertised to the upstreams, DNSSEC responses are larger
+	dnssecUDPSize = 4096
+)
+
+// DefaultTrustAnchors are the DS records of the IANA root zone key signing keys (KSK-2017 and KSK-2024).
+var DefaultTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+var errDNSSECBogus = errors.New("DNSSEC validation failed")
+
+// DNSSECResult is the outcome of the validation of a response
+type DNSSECResult string
+
+const (
+	// DNSSECSecure responses have a chain of trust up to a trust anchor
+	DNSSECSecure DNSSECResult = "secure"
+	// DNSSECInsecure responses are proven to come from an unsigned zone
+	DNSSECInsecure DNSSECResult = "insecure"
+	// DNSSECBogus responses should be signed but their signatures are missing or invalid
+	DNSSECBogus DNSSECResult = "bogus"
+	// DNSSECIndeterminate responses couldn't be validated, e.g. the keys of the zone couldn't be fetched
+	DNSSECIndeterminate DNSSECResult = "indeterminate"
+)
+
+// DNSSECConfig configures the local validation of DNSSEC signatures.
+type DNSSECConfig struct {
+	Enabled bool
+	// TrustAnchors are the DS records of the root zone keys, DefaultTrustAnchors if empty
+	TrustAnchors []string
+}
+
+type zoneStatus int
+
+const (
+	zoneSecure zoneStatus = iota
+	zoneInsecure
+	// zoneNoCut is the status of names that are not the apex of a zone
+	zoneNoCut
+)
+
+type zoneKeys struct {
+	status  zoneStatus
+	keys    []*dns.DNSKEY
+	expires time.Time
+}
+
+// ValidatorPlugin validates the DNSSEC signatures of the responses of the next plugin. Bogus responses are replaced
+// by SERVFAIL, and secure responses have the AD bit set. Queries with the CD bit set are not validated.
+//
+// The keys of the zones are fetched through the next plugin. Negative responses are secure once their NSEC or NSEC3
+// records prove the denial of existence, and the answers must only have the records of the query name and of the
+// CNAME targets it leads to.
+type ValidatorPlugin struct {
+	Next plugin.Handler
+
+	anchors []*dns.DS
+	log     *zerolog.Logger
+	now     func() time.Time
+
+	lock sync.Mutex
+	keys map[string]zoneKeys
+}
+
+// NewValidatorPlugin creates a validator trusting the configured anchors, it's up to the caller to set the Next
+// handler.
+func NewValidatorPlugin(config DNSSECConfig, log *zerolog.Logger) (*ValidatorPlugin, error) {
+	anchors := config.TrustAnchors
+	if len(anchors) == 0 {
+		anchors = DefaultTrustAnchors
+	}
+	v := &ValidatorPlugin{
+		log:  log,
+		now:  time.Now,
+		keys: make(map[string]zoneKeys),
+	}
+	for _, anchor := range anchors {
+		rr, err := dns.NewRR(anchor)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trust anchor %q", anchor)
+		}
+		ds, ok := rr.(*dns.DS)
+		if !ok || ds.Hdr.Name != "." {
+			return nil, fmt.Errorf("invalid trust anchor %q, expected a DS record of the root zone", anchor)
+		}
+		v.anchors = append(v.anchors, ds)
+	}
+	return v, nil
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (v *ValidatorPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if r.CheckingDisabled || len(r.Question) != 1 {
+		return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
+	}
+
+	query := r.Copy()
+	setDNSSECOK(query)
+	response, err := v.exchangeNext(ctx, w, query)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+		// Failures don't carry data to validate
+		response.Id = r.Id
+		return response.Rcode, w.WriteMsg(response)
+	}
+
+	result, err := v.validate(ctx, w, response)
+	incrementDNSSECValidation(result)
+	if err != nil {
+		v.log.Debug().Err(err).Str("name", r.Question[0].Name).Str("result", string(result)).Msg("DNSSEC validation failed")
+		servfail := new(dns.Msg)
+		servfail.SetRcode(r, dns.RcodeServerFailure)
+		if opt := r.IsEdns0(); opt != nil {
+			code := dns.ExtendedErrorCodeDNSBogus
+			if result == DNSSECIndeterminate {
+				code = dns.ExtendedErrorCodeDNSSECIndeterminate
+			}
+			servfail.SetEdns0(opt.UDPSize(), opt.Do())
+			servfail.IsEdns0().Option = append(servfail.IsEdns0().Option, &dns.EDNS0_EDE{InfoCode: code})
+		}
+		if err := w.WriteMsg(servfail); err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		// The SERVFAIL was written to the client, the server must not write another one
+		return dns.RcodeSuccess, nil
+	}
+
+	response.Id = r.Id
+	response.CheckingDisabled = false
+	response.AuthenticatedData = result == DNSSECSecure
+	restoreDNSSECOK(r, response)
+	if err := w.WriteMsg(response); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	return response.Rcode, nil
+}
+
+// Name implements the CoreDNS plugin interface
+func (v *ValidatorPlugin) Name() string { return "dnssec" }
+
+// validate returns the DNSSEC status of a response, and an error if it is bogus or indeterminate.
+func (v *ValidatorPlugin) validate(ctx context.Context, w dns.ResponseWriter, response *dns.Msg) (DNSSECResult, error) {
+	if len(response.Question) != 1 {
+		return DNSSECBogus, errors.Wrap(errDNSSECBogus, "response without question")
+	}
+	q := response.Question[0]
+
+	chain, err := answerChain(response.Answer, q)
+	if err != nil {
+		return DNSSECBogus, err
+	}
+	target := chain[len(chain)-1]
+	negative := response.Rcode == dns.RcodeNameError || !answers(response.Answer, target, q.Qtype)
+	section := response.Answer
+	if negative {
+		section = append(slices.Clone(response.Answer), response.Ns...)
+	}
+
+	result := DNSSECSecure
+	if negative && len(rrsets(response.Ns)) == 0 {
+		// A negative response without authority can't be attributed to a zone, it's only valid in unsigned zones
+		if res, err := v.validateUnsigned(ctx, w, target); err != nil {
+			return res, err
+		}
+		result = DNSSECInsecure
+	}
+	for _, set := range rrsets(section) {
+		name := set[0].Header().Name
+		sigs := signatures(section, name, set[0].Header().Rrtype)
+		if len(sigs) == 0 {
+			if res, err := v.validateUnsigned(ctx, w, name); err != nil {
+				return res, err
+			}
+			result = DNSSECInsecure
+			continue
+		}
+		if len(matching(response.Answer, name, set[0].Header().Rrtype)) > 0 && !inChain(chain, set[0].Header()) {
+			return DNSSECBogus, errors.Wrapf(errDNSSECBogus, "answer for %s has signed records of the unrelated name %s", q.Name, name)
+		}
+		insecure, err := v.verifyRRSet(ctx, w, set, sigs)
+		if err != nil {
+			return resultOf(err), err
+		}
+		if insecure {
+			result = DNSSECInsecure
+		}
+	}
+
+	if negative && result == DNSSECSecure {
+		return proveDenial(response.Ns, target, q.Qtype, response.Rcode == dns.RcodeNameError)
+	}
+	return result, nil
+}
+
+// answerChain returns the query name followed by the targets of the CNAME records of the answer it leads to.
+func answerChain(answer []dns.RR, q dns.Question) ([]string, error) {
+	chain := []string{dns.CanonicalName(q.Name)}
+	if q.Qtype == dns.TypeCNAME {
+		return chain, nil
+	}
+	for range answer {
+		cnames := matching(answer, chain[len(chain)-1], dns.TypeCNAME)
+		if len(cnames) == 0 {
+			break
+		}
+		target := dns.CanonicalName(cnames[0].(*dns.CNAME).Target)
+		if slices.Contains(chain, target) {
+			return nil, errors.Wrapf(errDNSSECBogus, "answer for %s has a CNAME loop", q.Name)
+		}
+		chain = append(chain, target)
+	}
+	return chain, nil
+}
+
+// inChain returns true if the record is owned by a name of the chain, or is a DNAME record above one.
+func inChain(chain []string, header *dns.RR_Header) bool {
+	owner := dns.CanonicalName(header.Name)
+	if header.Rrtype == dns.TypeDNAME {
+		return slices.ContainsFunc(chain, func(name string) bool {
+			return dns.IsSubDomain(owner, name) && owner != name
+		})
+	}
+	return slices.Contains(chain, owner)
+}
+
+// answers returns true if the answer has records of the type for the name.
+func answers(answer []dns.RR, name string, qtype uint16) bool {
+	if qtype != dns.TypeANY {
+		return len(matching(answer, name, qtype)) > 0
+	}
+	for _, rr := range answer {
+		if header := rr.Header(); header.Rrtype != dns.TypeRRSIG && dns.CanonicalName(header.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateUnsigned returns insecure if the name is proven to be in an unsigned zone, an error otherwise.
+func (v *ValidatorPlugin) validateUnsigned(ctx context.Context, w dns.ResponseWriter, name string) (DNSSECResult, error) {
+	insecure, err := v.provenInsecure(ctx, w, name)
+	if err != nil {
+		return resultOf(err), err
+	}
+	if !insecure {
+		return DNSSECBogus, errors.Wrapf(errDNSSECBogus, "missing signatures for %s in a signed zone", name)
+	}
+	return DNSSECInsecure, nil
+}
+
+// provenInsecure walks the chain of trust from the root down to the name and returns true if it reaches an unsigned
+// delegation.
+func (v *ValidatorPlugin) provenInsecure(ctx context.Context, w dns.ResponseWriter, name string) (bool, error) {
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - 1; i >= 0; i-- {
+		zone := dns.Fqdn(strings.Join(labels[i:], "."))
+		keys, err := v.zoneKeys(ctx, w, zone)
+		if err != nil {
+			return false, err
+		}
+		if keys.status == zoneInsecure {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// verifyRRSet verifies the signatures of a RRset. It returns true if the signer is proven to be an unsigned zone.
+func (v *ValidatorPlugin) verifyRRSet(ctx context.Context, w dns.ResponseWriter, set []dns.RR, sigs []*dns.RRSIG) (bool, error) {
+	name := set[0].Header().Name
+	var lastErr error = errors.Wrapf(errDNSSECBogus, "no valid signature for %s %s", name, dns.TypeToString[set[0].Header().Rrtype])
+	for _, sig := range sigs {
+		signer := dns.CanonicalName(sig.SignerName)
+		if !dns.IsSubDomain(signer, name) {
+			continue
+		}
+		// The DS records are signed by the parent zone, anything else would loop
+		if set[0].Header().Rrtype == dns.TypeDS && signer == dns.CanonicalName(name) {
+			continue
+		}
+		keys, err := v.zoneKeys(ctx, w, signer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch keys.status {
+		case zoneInsecure:
+			return true, nil
+		case zoneNoCut:
+			lastErr = errors.Wrapf(errDNSSECBogus, "signer %s of %s is not a zone", signer, name)
+			continue
+		}
+		if lastErr = v.verifySignature(sig, keys.keys, set); lastErr == nil {
+			return false, nil
+		}
+	}
+	return false, lastErr
+}
+
+func (v *ValidatorPlugin) verifySignature(sig *dns.RRSIG, keys []*dns.DNSKEY, set []dns.RR) error {
+	if !sig.ValidityPeriod(v.now()) {
+		return errors.Wrapf(errDNSSECBogus, "signature of %s by %s is expired or not yet valid", set[0].Header().Name, sig.SignerName)
+	}
+	for _, key := range keys {
+		if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+			continue
+		}
+		if err := sig.Verify(key, set); err == nil {
+			return nil
+		}
+	}
+	return errors.Wrapf(errDNSSECBogus, "invalid signature of %s by %s", set[0].Header().Name, sig.SignerName)
+}
+
+// zoneKeys returns the validated keys of the zone, following the chain of trust up to the root.
+func (v *ValidatorPlugin) zoneKeys(ctx context.Context, w dns.ResponseWriter, zone string) (zoneKeys, error) {
+	zone = dns.CanonicalName(zone)
+	v.lock.Lock()
+	cached, ok := v.keys[zone]
+	v.lock.Unlock()
+	if ok && v.now().Before(cached.expires) {
+		return cached, nil
+	}
+
+	var ds []*dns.DS
+	var ttl uint32
+	if zone == "." {
+		ds = v.anchors
+		ttl = uint32(maxKeyCacheTTL / time.Second)
+	} else {
+		response, err := v.exchange(ctx, w, zone, dns.TypeDS)
+		if err != nil {
+			return zoneKeys{}, err
+		}
+		set := matching(response.Answer, zone, dns.TypeDS)
+		if len(set) == 0 {
+			status, ttl, err := v.verifyDSDenial(ctx, w, response, zone)
+			if err != nil {
+				return zoneKeys{}, err
+			}
+			return v.cacheKeys(zone, zoneKeys{status: status}, ttl), nil
+		}
+		insecure, err := v.verifyRRSet(ctx, w, set, signatures(response.Answer, zone, dns.TypeDS))
+		if err != nil {
+			return zoneKeys{}, err
+		}
+		if insecure {
+			return v.cacheKeys(zone, zoneKeys{status: zoneInsecure}, minTTLOf(set)), nil
+		}
+		for _, rr := range set {
+			ds = append(ds, rr.(*dns.DS))
+		}
+		ttl = minTTLOf(set)
+	}
+
+	response, err := v.exchange(ctx, w, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return zoneKeys{}, err
+	}
+	set := matching(response.Answer, zone, dns.TypeDNSKEY)
+	keys := make([]*dns.DNSKEY, 0, len(set))
+	for _, rr := range set {
+		keys = append(keys, rr.(*dns.DNSKEY))
+	}
+	// The key set must be signed by a key matching a DS record of the parent
+	sigs := signatures(response.Answer, zone, dns.TypeDNSKEY)
+	var verifyErr error = errors.Wrapf(errDNSSECBogus, "no DNSKEY of %s matches its DS records", zone)
+	for _, sig := range sigs {
+		ksk := keyMatchingDS(keys, ds, sig.KeyTag)
+		if ksk == nil {
+			continue
+		}
+		if verifyErr = v.verifySignature(sig, []*dns.DNSKEY{ksk}, set); verifyErr == nil {
+			break
+		}
+	}
+	if verifyErr != nil {
+		return zoneKeys{}, verifyErr
+	}
+	return v.cacheKeys(zone, zoneKeys{status: zoneSecure, keys: keys}, min(ttl, minTTLOf(set))), nil
+}
+
+// verifyDSDenial validates a response without DS records. The name is an unsigned zone if it's a delegation, or not a
+// zone cut at all.
+func (v *ValidatorPlugin) verifyDSDenial(ctx context.Context, w dns.ResponseWriter, response *dns.Msg, zone string) (zoneStatus, uint32, error) {
+	sets := rrsets(response.Ns)
+	if len(sets) == 0 {
+		return zoneNoCut, 0, errors.Wrapf(errDNSSECBogus, "response without DS records for %s has no authority", zone)
+	}
+	for _, set := range sets {
+		header := set[0].Header()
+		insecure, err := v.verifyRRSet(ctx, w, set, signatures(response.Ns, header.Name, header.Rrtype))
+		if err != nil {
+			return zoneNoCut, 0, err
+		}
+		if insecure {
+			// The parent zone is unsigned, so is the child
+			return zoneInsecure, minTTLOf(set), nil
+		}
+	}
+
+	ttl := minTTLOf(response.Ns)
+	for _, rr := range response.Ns {
+		switch denial := rr.(type) {
+		case *dns.NSEC:
+			if dns.CanonicalName(denial.Hdr.Name) == zone && hasType(denial.TypeBitMap, dns.TypeNS) && !hasType(denial.TypeBitMap, dns.TypeDS) {
+				return zoneInsecure, ttl, nil
+			}
+		case *dns.NSEC3:
+			if denial.Match(zone) && hasType(denial.TypeBitMap, dns.TypeNS) && !hasType(denial.TypeBitMap, dns.TypeDS) {
+				return zoneInsecure, ttl, nil
+			}
+			// Unsigned delegations might not have their own NSEC3 record with opt-out
+			if denial.Flags&1 == 1 && denial.Cover(zone) {
+				return zoneInsecure, ttl, nil
+			}
+		}
+	}
+	// The name isn't a delegation, it's under the same zone as its parent
+	return zoneNoCut, ttl, nil
+}
+
+func (v *ValidatorPlugin) cacheKeys(zone string, keys zoneKeys, ttl uint32) zoneKeys {
+	keys.expires = v.now().Add(min(time.Duration(ttl)*time.Second, maxKeyCacheTTL))
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.keys[zone] = keys
+	return keys
+}
+
+// exchange sends a DNSSEC query for the name through the next plugin.
+func (v *ValidatorPlugin) exchange(ctx context.Context, w dns.ResponseWriter, name string, qtype uint16) (*dns.Msg, error) {
+	query := new(dns.Msg)
+	query.SetQuestion(name, qtype)
+	setDNSSECOK(query)
+	response, err := v.exchangeNext(ctx, w, query)
+	if err != nil {
+		return nil, err
+	}
+	if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("failed to query %s %s: %s", name, dns.TypeToString[qtype], dns.RcodeToString[response.Rcode])
+	}
+	return response, nil
+}
+
+func (v *ValidatorPlugin) exchangeNext(ctx context.Context, w dns.ResponseWriter, query *dns.Msg) (*dns.Msg, error) {
+	rw := &captureWriter{ResponseWriter: w}
+	if _, err := plugin.NextOrFailure(v.Name(), v.Next, ctx, rw, query); err != nil {
+		return nil, err
+	}
+	if rw.msg == nil {
+		return nil, fmt.Errorf("no response to %s", query.Question[0].Name)
+	}
+	return rw.msg, nil
+}
+
+func resultOf(err error) DNSSECResult {
+	if errors.Is(err, errDNSSECBogus) {
+		return DNSSECBogus
+	}
+	return DNSSECIndeterminate
+}
+
+// setDNSSECOK asks the upstream for the DNSSEC records, and to not validate them itself.
+func setDNSSECOK(query *dns.Msg) {
+	query.CheckingDisabled = true
+	if opt := query.IsEdns0(); opt != nil {
+		opt.SetDo()
+		opt.SetUDPSize(max(opt.UDPSize(), dnssecUDPSize))
+		return
+	}
+	query.SetEdns0(dnssecUDPSize, true)
+}
+
+// restoreDNSSECOK removes the DNSSEC records the client didn't ask for from the response.
+func restoreDNSSECOK(query, response *dns.Msg) {
+	opt := query.IsEdns0()
+	if opt != nil && opt.Do() {
+		return
+	}
+	qtype := query.Question[0].Qtype
+	response.Answer = withoutDNSSEC(response.Answer, qtype)
+	response.Ns = withoutDNSSEC(response.Ns, qtype)
+	extra := make([]dns.RR, 0, len(response.Extra))
+	for _, rr := range withoutDNSSEC(response.Extra, qtype) {
+		if responseOpt, ok := rr.(*dns.OPT); ok {
+			if opt == nil {
+				continue
+			}
+			responseOpt.SetDo(false)
+		}
+		extra = append(extra, rr)
+	}
+	response.Extra = extra
+}
+
+func withoutDNSSEC(section []dns.RR, qtype uint16) []dns.RR {
+	filtered := make([]dns.RR, 0, len(section))
+	for _, rr := range section {
+		switch rrtype := rr.Header().Rrtype; rrtype {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			if rrtype != qtype {
+				continue
+			}
+		}
+		filtered = append(filtered, rr)
+	}
+	return filtered
+}
+
+// rrsets groups the records of a section by name and type, leaving out the signatures.
+func rrsets(section []dns.RR) [][]dns.RR {
+	var sets [][]dns.RR
+	index := make(map[string]int)
+	for _, rr := range section {
+		header := rr.Header()
+		if header.Rrtype == dns.TypeRRSIG || header.Rrtype == dns.TypeOPT {
+			continue
+		}
+		key := dns.CanonicalName(header.Name) + "/" + dns.TypeToString[header.Rrtype]
+		if i, ok := index[key]; ok {
+			sets[i] = append(sets[i], rr)
+			continue
+		}
+		index[key] = len(sets)
+		sets = append(sets, []dns.RR{rr})
+	}
+	return sets
+}
+
+func matching(section []dns.RR, name string, rrtype uint16) []dns.RR {
+	var set []dns.RR
+	for _, rr := range section {
+		if header := rr.Header(); header.Rrtype == rrtype && dns.CanonicalName(header.Name) == dns.CanonicalName(name) {
+			set = append(set, rr)
+		}
+	}
+	return set
+}
+
+func signatures(section []dns.RR, name string, covered uint16) []*dns.RRSIG {
+	var sigs []*dns.RRSIG
+	for _, rr := range section {
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == covered && dns.CanonicalName(sig.Hdr.Name) == dns.CanonicalName(name) {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+func keyMatchingDS(keys []*dns.DNSKEY, ds []*dns.DS, keyTag uint16) *dns.DNSKEY {
+	for _, key := range keys {
+		if key.KeyTag() != keyTag {
+			continue
+		}
+		for _, d := range ds {
+			if d.KeyTag != keyTag || d.Algorithm != key.Algorithm {
+				continue
+			}
+			if digest := key.ToDS(d.DigestType); digest != nil && strings.EqualFold(digest.Digest, d.Digest) {
+				return key
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(bitmap []uint16, rrtype uint16) bool {
+	for _, t := range bitmap {
+		if t == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+func minTTLOf(set []dns.RR) uint32 {
+	return uint32(minTTL(set) / time.Second)
+}
+
+// captureWriter captures the response of the next plugin instead of writing it to the client.
+type captureWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *captureWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+	return nil
+}
+
+func (w *captureWriter) Write(buf []byte) (int, error) {
+	return len(buf), nil
+}
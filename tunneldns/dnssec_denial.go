@@ -0,0 +1,225 @@
+package tunneldns
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// proveDenial checks that the NSEC or NSEC3 records of a validated authority section prove that the name doesn't
+// exist, or that it has no record of the type, as described in RFC 4035 section 5.4 and RFC 5155 section 8. It
+// returns insecure if the name is in an opt-out span of an NSEC3 chain, as it could be an unsigned delegation.
+func proveDenial(section []dns.RR, name string, qtype uint16, nxdomain bool) (DNSSECResult, error) {
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+	for _, rr := range section {
+		switch denial := rr.(type) {
+		case *dns.NSEC:
+			nsecs = append(nsecs, denial)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, denial)
+		}
+	}
+
+	var err error
+	switch {
+	case len(nsecs) > 0:
+		if err = proveNSECDenial(nsecs, name, qtype, nxdomain); err == nil {
+			return DNSSECSecure, nil
+		}
+	case len(nsec3s) > 0:
+		var result DNSSECResult
+		if result, err = proveNSEC3Denial(nsec3s, name, qtype, nxdomain); err == nil {
+			return result, nil
+		}
+	default:
+		err = errors.New("no NSEC or NSEC3 records")
+	}
+	return DNSSECBogus, errors.Wrapf(errDNSSECBogus, "negative response for %s %s: %s", name, dns.TypeToString[qtype], err)
+}
+
+func proveNSECDenial(nsecs []*dns.NSEC, name string, qtype uint16, nxdomain bool) error {
+	if nsec := nsecMatching(nsecs, name); nsec != nil {
+		if nxdomain {
+			return fmt.Errorf("the NSEC record of %s proves that it exists", name)
+		}
+		if !typeDenied(nsec.TypeBitMap, qtype) {
+			return fmt.Errorf("the NSEC record of %s has the type", name)
+		}
+		return nil
+	}
+
+	cover := nsecCovering(nsecs, name)
+	if cover == nil {
+		return fmt.Errorf("no NSEC record covers %s", name)
+	}
+	// The next name is under the name, so the name is an empty non-terminal
+	if dns.IsSubDomain(name, cover.NextDomain) {
+		if nxdomain {
+			return fmt.Errorf("the NSEC record of %s proves that %s exists", cover.Hdr.Name, name)
+		}
+		return nil
+	}
+
+	ce := closestEncloser(name, cover.Hdr.Name, cover.NextDomain)
+	wildcard := wildcardOf(ce)
+	if nxdomain {
+		if nsecCovering(nsecs, wildcard) == nil {
+			return fmt.Errorf("no NSEC record covers the wildcard %s", wildcard)
+		}
+		return nil
+	}
+	// The name is synthesized from a wildcard that doesn't have the type
+	if nsec := nsecMatching(nsecs, wildcard); nsec == nil || !typeDenied(nsec.TypeBitMap, qtype) {
+		return fmt.Errorf("no NSEC record proves that %s exists without the type", wildcard)
+	}
+	return nil
+}
+
+func proveNSEC3Denial(nsec3s []*dns.NSEC3, name string, qtype uint16, nxdomain bool) (DNSSECResult, error) {
+	if nsec3 := nsec3Matching(nsec3s, name); nsec3 != nil {
+		if nxdomain {
+			return DNSSECBogus, fmt.Errorf("the NSEC3 record of %s proves that it exists", name)
+		}
+		if !typeDenied(nsec3.TypeBitMap, qtype) {
+			return DNSSECBogus, fmt.Errorf("the NSEC3 record of %s has the type", name)
+		}
+		return DNSSECSecure, nil
+	}
+
+	ce, optOut, err := closestEncloserNSEC3(nsec3s, name)
+	if err != nil {
+		return DNSSECBogus, err
+	}
+	wildcard := wildcardOf(ce)
+	if nxdomain {
+		if nsec3Covering(nsec3s, wildcard) == nil {
+			return DNSSECBogus, fmt.Errorf("no NSEC3 record covers the wildcard %s", wildcard)
+		}
+		if optOut {
+			return DNSSECInsecure, nil
+		}
+		return DNSSECSecure, nil
+	}
+	if nsec3 := nsec3Matching(nsec3s, wildcard); nsec3 != nil {
+		if !typeDenied(nsec3.TypeBitMap, qtype) {
+			return DNSSECBogus, fmt.Errorf("the NSEC3 record of %s has the type", wildcard)
+		}
+		return DNSSECSecure, nil
+	}
+	// The DS records of an unsigned delegation in an opt-out span are not denied by their own NSEC3 record
+	if qtype == dns.TypeDS && optOut {
+		return DNSSECInsecure, nil
+	}
+	return DNSSECBogus, fmt.Errorf("no NSEC3 record proves that %s exists without the type", name)
+}
+
+// closestEncloserNSEC3 returns the closest encloser of the name proven by the NSEC3 records, and whether the NSEC3
+// record covering the next closer name has the opt-out flag.
+func closestEncloserNSEC3(nsec3s []*dns.NSEC3, name string) (string, bool, error) {
+	labels := dns.SplitDomainName(name)
+	for i := 1; i <= len(labels); i++ {
+		ce := dns.Fqdn(strings.Join(labels[i:], "."))
+		nsec3 := nsec3Matching(nsec3s, ce)
+		if nsec3 == nil {
+			continue
+		}
+		if hasType(nsec3.TypeBitMap, dns.TypeDNAME) || (hasType(nsec3.TypeBitMap, dns.TypeNS) && !hasType(nsec3.TypeBitMap, dns.TypeSOA)) {
+			return "", false, fmt.Errorf("the closest encloser %s is a delegation", ce)
+		}
+		nextCloser := dns.Fqdn(strings.Join(labels[i-1:], "."))
+		cover := nsec3Covering(nsec3s, nextCloser)
+		if cover == nil {
+			return "", false, fmt.Errorf("no NSEC3 record covers the next closer name %s", nextCloser)
+		}
+		return ce, cover.Flags&1 == 1, nil
+	}
+	return "", false, fmt.Errorf("no NSEC3 record matches an ancestor of %s", name)
+}
+
+// typeDenied returns true if the type bitmap of a matching NSEC or NSEC3 record proves that the name has no record of
+// the type. The bitmap of a delegation only proves the absence of DS records, the parent isn't authoritative for
+// the other types.
+func typeDenied(bitmap []uint16, qtype uint16) bool {
+	if hasType(bitmap, qtype) || hasType(bitmap, dns.TypeCNAME) {
+		return false
+	}
+	delegation := hasType(bitmap, dns.TypeNS) && !hasType(bitmap, dns.TypeSOA)
+	return !delegation || qtype == dns.TypeDS
+}
+
+func nsecMatching(nsecs []*dns.NSEC, name string) *dns.NSEC {
+	for _, nsec := range nsecs {
+		if canonicalCompare(nsec.Hdr.Name, name) == 0 {
+			return nsec
+		}
+	}
+	return nil
+}
+
+// nsecCovering returns the NSEC record whose owner is before the name and whose next name is after it.
+func nsecCovering(nsecs []*dns.NSEC, name string) *dns.NSEC {
+	for _, nsec := range nsecs {
+		afterOwner := canonicalCompare(nsec.Hdr.Name, name) < 0
+		beforeNext := canonicalCompare(name, nsec.NextDomain) < 0
+		if canonicalCompare(nsec.Hdr.Name, nsec.NextDomain) < 0 {
+			if afterOwner && beforeNext {
+				return nsec
+			}
+			continue
+		}
+		// The last NSEC record of the zone points back to the apex, it covers the names of the zone after its owner
+		if afterOwner && dns.IsSubDomain(nsec.NextDomain, name) {
+			return nsec
+		}
+	}
+	return nil
+}
+
+func nsec3Matching(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range nsec3s {
+		if nsec3.Match(name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+func nsec3Covering(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range nsec3s {
+		if nsec3.Cover(name) && !nsec3.Match(name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+// closestEncloser returns the longest ancestor of the name shared with the owner or the next name of the NSEC record
+// covering it.
+func closestEncloser(name, owner, next string) string {
+	common := max(dns.CompareDomainName(name, owner), dns.CompareDomainName(name, next))
+	labels := dns.SplitDomainName(name)
+	return dns.Fqdn(strings.Join(labels[len(labels)-common:], "."))
+}
+
+func wildcardOf(name string) string {
+	if name == "." {
+		return "*."
+	}
+	return "*." + name
+}
+
+// canonicalCompare compares the names in the canonical order of RFC 4034 section 6.1, label by label from the root.
+func canonicalCompare(a, b string) int {
+	labelsA := dns.SplitDomainName(dns.CanonicalName(a))
+	labelsB := dns.SplitDomainName(dns.CanonicalName(b))
+	for i, j := len(labelsA)-1, len(labelsB)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(labelsA[i], labelsB[j]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(labelsA), len(labelsB))
+}
@@ -0,0 +1,250 @@
+package tunneldns
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+type testZone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestZone(t *testing.T, name string) *testZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	require.NoError(t, err)
+	return &testZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+func (z *testZone) sign(t *testing.T, set ...dns.RR) []dns.RR {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: set[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: set[0].Header().Ttl},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.name,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	require.NoError(t, sig.Sign(z.priv, set))
+	return append(set, sig)
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return rr
+}
+
+// signedUpstream serves the records of a small signed hierarchy: the root zone, the signed example. zone and the
+// unsigned insecure.example. zone.
+type signedUpstream struct {
+	answers     map[string][]dns.RR
+	authorities map[string][]dns.RR
+	rcodes      map[string]int
+}
+
+func (u *signedUpstream) ServeDNS(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	q := r.Question[0]
+	key := dns.CanonicalName(q.Name) + "/" + dns.TypeToString[q.Qtype]
+	reply := new(dns.Msg)
+	reply.SetReply(r)
+	reply.Rcode = u.rcodes[key]
+	reply.Answer = u.answers[key]
+	reply.Ns = u.authorities[key]
+	return dns.RcodeSuccess, w.WriteMsg(reply)
+}
+
+func (u *signedUpstream) Name() string { return "signed" }
+
+func newSignedUpstream(t *testing.T) (*signedUpstream, *dns.DS) {
+	root := newTestZone(t, ".")
+	example := newTestZone(t, "example.")
+	soa := mustRR(t, "example. 300 IN SOA ns.example. admin.example. 1 7200 3600 1209600 300")
+	// The NSEC records of the example. zone
+	apexNSEC := example.sign(t, mustRR(t, "example. 300 IN NSEC insecure.example. NS SOA RRSIG NSEC DNSKEY"))
+	insecureNSEC := example.sign(t, mustRR(t, "insecure.example. 300 IN NSEC stripped.example. NS RRSIG NSEC"))
+	denial := func(nsecs ...[]dns.RR) []dns.RR {
+		records := example.sign(t, soa)
+		for _, nsec := range nsecs {
+			records = append(records, nsec...)
+		}
+		return records
+	}
+	nsec3 := func(name, next string, optOut bool, types string) []dns.RR {
+		hash := dns.HashName(name, dns.SHA1, 0, "")
+		if next == "" {
+			next = hash
+		}
+		flags := 0
+		if optOut {
+			flags = 1
+		}
+		return example.sign(t, mustRR(t, fmt.Sprintf("%s.example. 300 IN NSEC3 1 %d 0 - %s %s", hash, flags, next, types)))
+	}
+	// An NSEC3 record of the apex with an empty interval covers all the other names
+	apexNSEC3 := nsec3("example.", "", false, "NS SOA RRSIG DNSKEY NSEC3PARAM")
+
+	u := &signedUpstream{
+		answers: map[string][]dns.RR{
+			"./DNSKEY":        root.sign(t, root.key),
+			"example./DS":     root.sign(t, example.key.ToDS(dns.SHA256)),
+			"example./DNSKEY": example.sign(t, example.key),
+			"www.example./A":  example.sign(t, mustRR(t, "www.example. 300 IN A 192.0.2.1")),
+			// The signature is valid for another address
+			"forged.example./A": append(
+				[]dns.RR{mustRR(t, "forged.example. 300 IN A 192.0.2.66")},
+				example.sign(t, mustRR(t, "forged.example. 300 IN A 192.0.2.2"))[1],
+			),
+			"stripped.example./A":      {mustRR(t, "stripped.example. 300 IN A 192.0.2.3")},
+			"host.insecure.example./A": {mustRR(t, "host.insecure.example. 300 IN A 192.0.2.4")},
+		},
+		authorities: map[string][]dns.RR{
+			// insecure.example. is a delegation without DS records
+			"insecure.example./DS": append(
+				example.sign(t, soa),
+				example.sign(t, mustRR(t, "insecure.example. 300 IN NSEC stripped.example. NS RRSIG NSEC"))...,
+			),
+			"stripped.example./DS": append(
+				example.sign(t, soa),
+				example.sign(t, mustRR(t, "stripped.example. 300 IN NSEC www.example. A RRSIG NSEC"))...,
+			),
+			"missing.example./A": denial(insecureNSEC, apexNSEC),
+			// The wildcard isn't proven absent
+			"nowildcard.example./A": denial(insecureNSEC),
+			// A name that doesn't exist isn't proof that it has no record of the type
+			"other.example./A": denial(insecureNSEC),
+			// The NSEC record doesn't cover the name
+			"zzz.example./A":        denial(insecureNSEC, apexNSEC),
+			"txt.example./A":        denial(example.sign(t, mustRR(t, "txt.example. 300 IN NSEC www.example. TXT RRSIG NSEC"))),
+			"hasa.example./A":       denial(example.sign(t, mustRR(t, "hasa.example. 300 IN NSEC www.example. A RRSIG NSEC"))),
+			"ent.example./A":        denial(example.sign(t, mustRR(t, "dummy.example. 300 IN NSEC host.ent.example. A RRSIG NSEC"))),
+			"dangling.example./A":   denial(apexNSEC),
+			"gone3.example./A":      denial(apexNSEC3),
+			"nodata3.example./A":    denial(apexNSEC3, nsec3("nodata3.example.", "", false, "TXT RRSIG")),
+			"hasa3.example./A":      denial(apexNSEC3, nsec3("hasa3.example.", "", false, "A RRSIG")),
+			"unsigned3.example./DS": denial(nsec3("example.", "", true, "NS SOA RRSIG DNSKEY NSEC3PARAM")),
+		},
+		rcodes: map[string]int{
+			"missing.example./A":    dns.RcodeNameError,
+			"nowildcard.example./A": dns.RcodeNameError,
+			"zzz.example./A":        dns.RcodeNameError,
+			"dangling.example./A":   dns.RcodeNameError,
+			"gone3.example./A":      dns.RcodeNameError,
+		},
+	}
+	u.answers["alias.example./A"] = append(
+		example.sign(t, mustRR(t, "alias.example. 300 IN CNAME www.example.")),
+		u.answers["www.example./A"]...,
+	)
+	u.answers["extra.example./A"] = append(
+		example.sign(t, mustRR(t, "extra.example. 300 IN A 192.0.2.5")),
+		u.answers["www.example./A"]...,
+	)
+	u.answers["dangling.example./A"] = example.sign(t, mustRR(t, "dangling.example. 300 IN CNAME gone.example."))
+	return u, root.key.ToDS(dns.SHA256)
+}
+
+func TestValidatorPlugin(t *testing.T) {
+	upstream, anchor := newSignedUpstream(t)
+	log := zerolog.Nop()
+	validator, err := NewValidatorPlugin(DNSSECConfig{TrustAnchors: []string{anchor.String()}}, &log)
+	require.NoError(t, err)
+	validator.Next = upstream
+
+	tests := []struct {
+		name  string
+		qtype uint16
+		rcode int
+		ad    bool
+	}{
+		{name: "www.example.", rcode: dns.RcodeSuccess, ad: true},
+		{name: "host.insecure.example.", rcode: dns.RcodeSuccess, ad: false},
+		{name: "forged.example.", rcode: dns.RcodeServerFailure},
+		{name: "stripped.example.", rcode: dns.RcodeServerFailure},
+		{name: "alias.example.", rcode: dns.RcodeSuccess, ad: true},
+		{name: "extra.example.", rcode: dns.RcodeServerFailure},
+		{name: "missing.example.", rcode: dns.RcodeNameError, ad: true},
+		{name: "nowildcard.example.", rcode: dns.RcodeServerFailure},
+		{name: "other.example.", rcode: dns.RcodeServerFailure},
+		{name: "zzz.example.", rcode: dns.RcodeServerFailure},
+		{name: "txt.example.", rcode: dns.RcodeSuccess, ad: true},
+		{name: "hasa.example.", rcode: dns.RcodeServerFailure},
+		{name: "ent.example.", rcode: dns.RcodeSuccess, ad: true},
+		{name: "dangling.example.", rcode: dns.RcodeNameError, ad: true},
+		{name: "gone3.example.", rcode: dns.RcodeNameError, ad: true},
+		{name: "nodata3.example.", rcode: dns.RcodeSuccess, ad: true},
+		{name: "hasa3.example.", rcode: dns.RcodeServerFailure},
+		{name: "unsigned3.example.", qtype: dns.TypeDS, rcode: dns.RcodeSuccess, ad: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			qtype := test.qtype
+			if qtype == 0 {
+				qtype = dns.TypeA
+			}
+			query := new(dns.Msg)
+			query.SetQuestion(test.name, qtype)
+			rec := dnstest.NewRecorder(&testResponseWriter{})
+			_, err := validator.ServeDNS(context.Background(), rec, query)
+			require.NoError(t, err)
+			require.Equal(t, query.Id, rec.Msg.Id)
+			require.Equal(t, test.rcode, rec.Msg.Rcode)
+			require.Equal(t, test.ad, rec.Msg.AuthenticatedData)
+			// The client didn't ask for the DNSSEC records
+			for _, rr := range append(rec.Msg.Answer, rec.Msg.Ns...) {
+				require.NotEqual(t, dns.TypeRRSIG, rr.Header().Rrtype)
+			}
+			require.Nil(t, rec.Msg.IsEdns0())
+		})
+	}
+}
+
+func TestValidatorPluginCheckingDisabled(t *testing.T) {
+	upstream, anchor := newSignedUpstream(t)
+	log := zerolog.Nop()
+	validator, err := NewValidatorPlugin(DNSSECConfig{TrustAnchors: []string{anchor.String()}}, &log)
+	require.NoError(t, err)
+	validator.Next = upstream
+
+	query := new(dns.Msg)
+	query.SetQuestion("forged.example.", dns.TypeA)
+	query.CheckingDisabled = true
+	rec := dnstest.NewRecorder(&testResponseWriter{})
+	_, err = validator.ServeDNS(context.Background(), rec, query)
+	require.NoError(t, err)
+	require.Equal(t, dns.RcodeSuccess, rec.Msg.Rcode)
+}
+
+func TestValidatorPluginWrongAnchor(t *testing.T) {
+	upstream, _ := newSignedUpstream(t)
+	log := zerolog.Nop()
+	validator, err := NewValidatorPlugin(DNSSECConfig{}, &log)
+	require.NoError(t, err)
+	validator.Next = upstream
+
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.", dns.TypeA)
+	query.SetEdns0(1232, true)
+	rec := dnstest.NewRecorder(&testResponseWriter{})
+	_, err = validator.ServeDNS(context.Background(), rec, query)
+	require.NoError(t, err)
+	require.Equal(t, dns.RcodeServerFailure, rec.Msg.Rcode)
+	ede, ok := rec.Msg.IsEdns0().Option[0].(*dns.EDNS0_EDE)
+	require.True(t, ok)
+	require.Equal(t, dns.ExtendedErrorCodeDNSBogus, ede.InfoCode)
+}
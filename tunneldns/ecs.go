@@ -0,0 +1,137 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+// ECSMode controls the EDNS Client Subnet option (RFC 7871) of the queries sent upstream
+type ECSMode string
+
+const (
+	// ECSForward sends the option of the client query upstream as is
+	ECSForward ECSMode = "forward"
+	// ECSStrip removes the option from the queries, so the upstream only sees the address of cloudflared
+	ECSStrip ECSMode = "strip"
+	// ECSSet replaces the option of the queries with a fixed prefix
+	ECSSet ECSMode = "set"
+)
+
+// ECSConfig configures the EDNS Client Subnet option of the queries sent upstream.
+type ECSConfig struct {
+	// Mode is ECSForward if empty
+	Mode ECSMode
+	// Prefix is the subnet sent upstream in the ECSSet mode, e.g. 203.0.113.0/24
+	Prefix string
+}
+
+// ECSPlugin rewrites the EDNS Client Subnet option of the queries passed to the next plugin.
+type ECSPlugin struct {
+	Next plugin.Handler
+
+	mode   ECSMode
+	subnet *dns.EDNS0_SUBNET
+}
+
+// NewECSPlugin creates a plugin for the configuration, it returns nil if the queries don't need to be rewritten.
+// It's up to the caller to set the Next handler.
+func NewECSPlugin(config ECSConfig) (*ECSPlugin, error) {
+	switch config.Mode {
+	case "", ECSForward:
+		return nil, nil
+	case ECSStrip:
+		return &ECSPlugin{mode: ECSStrip}, nil
+	case ECSSet:
+		prefix, err := netip.ParsePrefix(config.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECS prefix %q: %v", config.Prefix, err)
+		}
+		prefix = prefix.Masked()
+		subnet := &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			SourceNetmask: uint8(prefix.Bits()),
+			Address:       prefix.Addr().AsSlice(),
+		}
+		if prefix.Addr().Is4() {
+			subnet.Family = 1
+		} else {
+			subnet.Family = 2
+		}
+		return &ECSPlugin{mode: ECSSet, subnet: subnet}, nil
+	default:
+		return nil, fmt.Errorf("invalid ECS mode %q, expected %s, %s or %s", config.Mode, ECSForward, ECSStrip, ECSSet)
+	}
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *ECSPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	query := r.Copy()
+	opt := query.IsEdns0()
+	if opt != nil {
+		opt.Option = withoutECS(opt.Option)
+	}
+	if p.mode == ECSSet {
+		if opt == nil {
+			query.SetEdns0(dns.DefaultMsgSize, false)
+			opt = query.IsEdns0()
+		}
+		opt.Option = append(opt.Option, p.subnet)
+	}
+
+	rw := &captureWriter{ResponseWriter: w}
+	status, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, rw, query)
+	if err != nil || rw.msg == nil {
+		return status, err
+	}
+
+	// The client shouldn't see an option it didn't send
+	response := rw.msg
+	if responseOpt := response.IsEdns0(); responseOpt != nil {
+		responseOpt.Option = withoutECS(responseOpt.Option)
+		if r.IsEdns0() == nil {
+			response.Extra = withoutOPT(response.Extra)
+		}
+	}
+	return status, w.WriteMsg(response)
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *ECSPlugin) Name() string { return "ecs" }
+
+// clientSubnet returns the EDNS Client Subnet option of a query, nil if there is none.
+func clientSubnet(r *dns.Msg) *dns.EDNS0_SUBNET {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, option := range opt.Option {
+		if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+			return subnet
+		}
+	}
+	return nil
+}
+
+func withoutECS(options []dns.EDNS0) []dns.EDNS0 {
+	filtered := make([]dns.EDNS0, 0, len(options))
+	for _, option := range options {
+		if option.Option() != dns.EDNS0SUBNET {
+			filtered = append(filtered, option)
+		}
+	}
+	return filtered
+}
+
+func withoutOPT(section []dns.RR) []dns.RR {
+	filtered := make([]dns.RR, 0, len(section))
+	for _, rr := range section {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			filtered = append(filtered, rr)
+		}
+	}
+	return filtered
+}
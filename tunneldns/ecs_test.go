@@ -0,0 +1,75 @@
+package tunneldns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestECSPlugin(t *testing.T) {
+	clientSubnetOption := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("198.51.100.0").To4()}
+
+	tests := []struct {
+		name      string
+		config    ECSConfig
+		clientECS bool
+		upstream  string
+	}{
+		{name: "strip", config: ECSConfig{Mode: ECSStrip}, clientECS: true, upstream: ""},
+		{name: "set replaces", config: ECSConfig{Mode: ECSSet, Prefix: "203.0.113.7/24"}, clientECS: true, upstream: "203.0.113.0/24/0"},
+		{name: "set adds", config: ECSConfig{Mode: ECSSet, Prefix: "2001:db8::/56"}, upstream: "[2001:db8::]/56/0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var upstreamECS string
+			next := &countingHandler{reply: func(r *dns.Msg) *dns.Msg {
+				upstreamECS = ""
+				if subnet := clientSubnet(r); subnet != nil {
+					upstreamECS = subnet.String()
+				}
+				reply := new(dns.Msg)
+				reply.SetReply(r)
+				if opt := r.IsEdns0(); opt != nil {
+					reply.Extra = append(reply.Extra, dns.Copy(opt))
+				}
+				return reply
+			}}
+			p, err := NewECSPlugin(test.config)
+			require.NoError(t, err)
+			p.Next = next
+
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeA)
+			if test.clientECS {
+				query.SetEdns0(dns.DefaultMsgSize, false)
+				query.IsEdns0().Option = append(query.IsEdns0().Option, clientSubnetOption)
+			}
+			rec := dnstest.NewRecorder(&testResponseWriter{})
+			_, err = p.ServeDNS(context.Background(), rec, query)
+			require.NoError(t, err)
+			require.Equal(t, test.upstream, upstreamECS)
+			require.Nil(t, clientSubnet(rec.Msg))
+			require.Equal(t, test.clientECS, rec.Msg.IsEdns0() != nil)
+			// The client query is not modified
+			require.Equal(t, test.clientECS, clientSubnet(query) != nil)
+		})
+	}
+}
+
+func TestNewECSPlugin(t *testing.T) {
+	p, err := NewECSPlugin(ECSConfig{})
+	require.NoError(t, err)
+	require.Nil(t, p)
+	p, err = NewECSPlugin(ECSConfig{Mode: ECSForward})
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	_, err = NewECSPlugin(ECSConfig{Mode: ECSSet})
+	require.Error(t, err)
+	_, err = NewECSPlugin(ECSConfig{Mode: "geo"})
+	require.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package tunneldns
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/pkg/errors"
+)
+
+// EncryptedListenerConfig configures DNS over TLS and DNS over HTTPS listeners, in addition to the plain DNS one, so
+// that clients such as Android private DNS and browsers can use proxy-dns directly.
+type EncryptedListenerConfig struct {
+	CertFile string
+	KeyFile  string
+	// DoTPort is the port of the DNS over TLS listener, it is disabled if zero
+	DoTPort uint16
+	// DoHPort is the port of the DNS over HTTPS listener serving /dns-query, it is disabled if zero
+	DoHPort uint16
+}
+
+func (c EncryptedListenerConfig) enabled() bool {
+	return c.DoTPort != 0 || c.DoHPort != 0
+}
+
+// encryptedServer is implemented by the CoreDNS TLS and HTTPS servers, that only listen on TCP
+type encryptedServer interface {
+	Listen() (net.Listener, error)
+	Serve(net.Listener) error
+	Stop() error
+	Address() string
+}
+
+func newEncryptedServers(address string, config EncryptedListenerConfig, p plugin.Handler) ([]encryptedServer, error) {
+	if !config.enabled() {
+		return nil, nil
+	}
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("a certificate and a key are required to serve DNS over TLS or DNS over HTTPS")
+	}
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the DNS listener certificate")
+	}
+
+	var servers []encryptedServer
+	if config.DoTPort != 0 {
+		c := createConfig(address, config.DoTPort, p)
+		c.Transport = transport.TLS
+		c.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		server, err := dnsserver.NewServerTLS(transport.TLS+"://"+net.JoinHostPort(address, strconv.FormatUint(uint64(config.DoTPort), 10)), []*dnsserver.Config{c})
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	if config.DoHPort != 0 {
+		c := createConfig(address, config.DoHPort, p)
+		c.Transport = transport.HTTPS
+		c.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		server, err := dnsserver.NewServerHTTPS(transport.HTTPS+"://"+net.JoinHostPort(address, strconv.FormatUint(uint64(config.DoHPort), 10)), []*dnsserver.Config{c})
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
@@ -0,0 +1,97 @@
+package tunneldns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCertificate(t *testing.T) (string, string) {
+	cert := serverTLSConfig(t).Certificates[0]
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func freePort(t *testing.T) uint16 {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return uint16(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestEncryptedListeners(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+	log := zerolog.Nop()
+	dotPort, dohPort := freePort(t), freePort(t)
+	listener, err := CreateListener(ListenerConfig{
+		Address: "127.0.0.1",
+		Port:    freePort(t),
+		Local:   LocalConfig{Records: []string{"host.lab. 300 IN A 10.0.0.1"}},
+		Encrypted: EncryptedListenerConfig{
+			CertFile: certFile,
+			KeyFile:  keyFile,
+			DoTPort:  dotPort,
+			DoHPort:  dohPort,
+		},
+		Selection: SelectionConfig{HealthCheckInterval: -1},
+	}, &log)
+	require.NoError(t, err)
+	require.NoError(t, listener.Start(make(chan struct{})))
+	defer listener.Stop()
+
+	query := new(dns.Msg)
+	query.SetQuestion("host.lab.", dns.TypeA)
+
+	// DNS over TLS
+	client := &dns.Client{Net: "tcp-tls", TLSConfig: &tls.Config{InsecureSkipVerify: true}, Timeout: 5 * time.Second}
+	response, _, err := client.Exchange(query, net.JoinHostPort("127.0.0.1", itoa(dotPort)))
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1", response.Answer[0].(*dns.A).A.String())
+
+	// DNS over HTTPS
+	buf, err := query.Pack()
+	require.NoError(t, err)
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, Timeout: 5 * time.Second}
+	resp, err := httpClient.Post("https://"+net.JoinHostPort("127.0.0.1", itoa(dohPort))+"/dns-query", "application/dns-message", bytes.NewReader(buf))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	response = new(dns.Msg)
+	require.NoError(t, response.Unpack(body))
+	require.Equal(t, "10.0.0.1", response.Answer[0].(*dns.A).A.String())
+}
+
+func TestEncryptedListenersRequireCertificate(t *testing.T) {
+	log := zerolog.Nop()
+	_, err := CreateListener(ListenerConfig{
+		Address:   "127.0.0.1",
+		Port:      freePort(t),
+		Encrypted: EncryptedListenerConfig{DoTPort: freePort(t)},
+	}, &log)
+	require.Error(t, err)
+}
+
+func itoa(port uint16) string {
+	return strconv.FormatUint(uint64(port), 10)
+}
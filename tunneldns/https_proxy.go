@@ -16,7 +16,9 @@ type Upstream interface {
 // ProxyPlugin is a simplified DNS proxy using a generic upstream interface
 type ProxyPlugin struct {
 	Upstreams []Upstream
-	Next      plugin.Handler
+	// Zones are forwarded to their own upstreams, ordered from the most to the least specific
+	Zones []Zone
+	Next  plugin.Handler
 }
 
 // ServeDNS implements interface for CoreDNS plugin
@@ -24,7 +26,7 @@ func (p ProxyPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.
 	var reply *dns.Msg
 	var backendErr error
 
-	for _, upstream := range p.Upstreams {
+	for _, upstream := range p.upstreams(r) {
 		reply, backendErr = upstream.Exchange(ctx, r)
 		if backendErr == nil {
 			w.WriteMsg(reply)
@@ -35,5 +37,18 @@ func (p ProxyPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.
 	return dns.RcodeServerFailure, errors.Wrap(backendErr, "failed to contact any of the upstreams")
 }
 
+// upstreams returns the upstreams of the most specific zone matching the query, or the default upstreams.
+func (p ProxyPlugin) upstreams(r *dns.Msg) []Upstream {
+	if len(r.Question) == 0 {
+		return p.Upstreams
+	}
+	for _, zone := range p.Zones {
+		if dns.IsSubDomain(zone.Name, r.Question[0].Name) {
+			return zone.Upstreams
+		}
+	}
+	return p.Upstreams
+}
+
 // Name implements interface for CoreDNS plugin
 func (p ProxyPlugin) Name() string { return "proxy" }
@@ -0,0 +1,174 @@
+package tunneldns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+const (
+	// hostsTTL is the TTL of the records read from hosts files
+	hostsTTL = 3600
+	// maxCNAMEChain limits how many local CNAMEs are followed to answer a query
+	maxCNAMEChain = 8
+)
+
+// LocalConfig configures static records that are answered authoritatively instead of being sent upstream.
+type LocalConfig struct {
+	// Records are A, AAAA, CNAME and TXT records in the zone file format, e.g. "host.lab. 300 IN A 10.0.0.1"
+	Records []string
+	// HostsFiles are files in the /etc/hosts format
+	HostsFiles []string
+}
+
+// LocalPlugin answers the queries for names that have local records, other queries are passed to the next plugin.
+type LocalPlugin struct {
+	Next plugin.Handler
+
+	// records by canonical name
+	records map[string][]dns.RR
+}
+
+// NewLocalPlugin creates a plugin answering the records of the configuration, it's up to the caller to set the Next
+// handler.
+func NewLocalPlugin(config LocalConfig) (*LocalPlugin, error) {
+	p := &LocalPlugin{records: make(map[string][]dns.RR)}
+	for _, record := range config.Records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid local record %q", record)
+		}
+		if rr == nil {
+			return nil, fmt.Errorf("invalid local record %q", record)
+		}
+		if err := p.add(rr); err != nil {
+			return nil, errors.Wrapf(err, "invalid local record %q", record)
+		}
+	}
+	for _, path := range config.HostsFiles {
+		if err := p.addHostsFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Empty returns true if there are no local records
+func (p *LocalPlugin) Empty() bool {
+	return len(p.records) == 0
+}
+
+func (p *LocalPlugin) add(rr dns.RR) error {
+	header := rr.Header()
+	switch header.Rrtype {
+	case dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeTXT:
+	default:
+		return fmt.Errorf("unsupported record type %s, only A, AAAA, CNAME and TXT are supported", dns.TypeToString[header.Rrtype])
+	}
+	header.Name = dns.CanonicalName(header.Name)
+	p.records[header.Name] = append(p.records[header.Name], rr)
+	return nil
+}
+
+func (p *LocalPlugin) addHostsFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open hosts file")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid entry in hosts file %s at line %d: missing host name", path, line)
+		}
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid entry in hosts file %s at line %d: %v", path, line, err)
+		}
+		// Zones are dropped, they don't mean anything to the client of the resolver
+		addr = addr.WithZone("").Unmap()
+		for _, name := range fields[1:] {
+			header := dns.RR_Header{Name: dns.Fqdn(name), Class: dns.ClassINET, Ttl: hostsTTL}
+			var rr dns.RR
+			if addr.Is4() {
+				header.Rrtype = dns.TypeA
+				rr = &dns.A{Hdr: header, A: addr.AsSlice()}
+			} else {
+				header.Rrtype = dns.TypeAAAA
+				rr = &dns.AAAA{Hdr: header, AAAA: addr.AsSlice()}
+			}
+			if err := p.add(rr); err != nil {
+				return err
+			}
+		}
+	}
+	return errors.Wrap(scanner.Err(), "failed to read hosts file")
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *LocalPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if len(r.Question) != 1 {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+	q := r.Question[0]
+	answer, ok := p.answer(dns.CanonicalName(q.Name), q.Qtype)
+	if !ok || q.Qclass != dns.ClassINET {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	setAnsweredBy(ctx, answeredByLocal)
+	reply := new(dns.Msg)
+	reply.SetReply(r)
+	reply.Authoritative = true
+	reply.Answer = answer
+	if err := w.WriteMsg(reply); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// answer returns the local records answering the query, following local CNAMEs. It returns false if the name has no
+// local records. A name with local records but none of the queried type is answered with NODATA, so that local names
+// never leak upstream.
+func (p *LocalPlugin) answer(name string, qtype uint16) ([]dns.RR, bool) {
+	var answer []dns.RR
+	for i := 0; i < maxCNAMEChain; i++ {
+		records, ok := p.records[name]
+		if !ok {
+			// A CNAME to a name without local records is returned as is, the client resolves the target
+			return answer, i > 0
+		}
+		var cname *dns.CNAME
+		matched := false
+		for _, rr := range records {
+			if rr.Header().Rrtype == qtype || qtype == dns.TypeANY {
+				answer = append(answer, dns.Copy(rr))
+				matched = true
+			} else if c, ok := rr.(*dns.CNAME); ok {
+				cname = c
+			}
+		}
+		if matched || cname == nil {
+			return answer, true
+		}
+		answer = append(answer, dns.Copy(cname))
+		name = dns.CanonicalName(cname.Target)
+	}
+	return answer, true
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *LocalPlugin) Name() string { return "local" }
@@ -0,0 +1,75 @@
+package tunneldns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalPlugin(t *testing.T) {
+	hostsFile := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(hostsFile, []byte(`
+# lab hosts
+10.0.0.2   nas.lab nas-alias.lab
+fe80::1%eth0 router.lab # link local
+`), 0o600))
+
+	next := &countingHandler{reply: answerWithTTL(300)}
+	local, err := NewLocalPlugin(LocalConfig{
+		Records: []string{
+			"Host.Lab. 300 IN A 10.0.0.1",
+			"host.lab. 300 IN TXT \"lab host\"",
+			"www.lab. 300 IN CNAME host.lab.",
+			"docs.lab. 300 IN CNAME docs.example.com.",
+		},
+		HostsFiles: []string{hostsFile},
+	})
+	require.NoError(t, err)
+	local.Next = next
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		answers []string
+	}{
+		{name: "host.lab.", qtype: dns.TypeA, answers: []string{"host.lab.\t300\tIN\tA\t10.0.0.1"}},
+		{name: "HOST.lab.", qtype: dns.TypeTXT, answers: []string{"host.lab.\t300\tIN\tTXT\t\"lab host\""}},
+		{name: "host.lab.", qtype: dns.TypeAAAA, answers: nil},
+		{name: "www.lab.", qtype: dns.TypeA, answers: []string{"www.lab.\t300\tIN\tCNAME\thost.lab.", "host.lab.\t300\tIN\tA\t10.0.0.1"}},
+		{name: "www.lab.", qtype: dns.TypeCNAME, answers: []string{"www.lab.\t300\tIN\tCNAME\thost.lab."}},
+		{name: "docs.lab.", qtype: dns.TypeA, answers: []string{"docs.lab.\t300\tIN\tCNAME\tdocs.example.com."}},
+		{name: "nas-alias.lab.", qtype: dns.TypeA, answers: []string{"nas-alias.lab.\t3600\tIN\tA\t10.0.0.2"}},
+		{name: "router.lab.", qtype: dns.TypeAAAA, answers: []string{"router.lab.\t3600\tIN\tAAAA\tfe80::1"}},
+	}
+	for _, test := range tests {
+		query := new(dns.Msg)
+		query.SetQuestion(test.name, test.qtype)
+		rec := dnstest.NewRecorder(&testResponseWriter{})
+		_, err := local.ServeDNS(context.Background(), rec, query)
+		require.NoError(t, err)
+		require.True(t, rec.Msg.Authoritative)
+		require.Equal(t, dns.RcodeSuccess, rec.Msg.Rcode)
+		var answers []string
+		for _, rr := range rec.Msg.Answer {
+			answers = append(answers, rr.String())
+		}
+		require.Equal(t, test.answers, answers, test.name)
+	}
+	require.Equal(t, int32(0), next.queries.Load())
+
+	// Names without local records are resolved upstream
+	queryCache(t, local, "example.com.")
+	require.Equal(t, int32(1), next.queries.Load())
+}
+
+func TestLocalPluginInvalidRecord(t *testing.T) {
+	_, err := NewLocalPlugin(LocalConfig{Records: []string{"host.lab. 300 IN MX 10 mail.lab."}})
+	require.Error(t, err)
+	_, err = NewLocalPlugin(LocalConfig{Records: []string{"host.lab. IN A not-an-ip"}})
+	require.Error(t, err)
+}
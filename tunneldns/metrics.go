@@ -2,6 +2,9 @@ package tunneldns
 
 import (
 	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
@@ -14,8 +17,176 @@ import (
 
 const (
 	pluginName = "cloudflared"
+
+	metricsNamespace   = "cloudflared"
+	cacheSubsystem     = "dns_cache"
+	dnssecSubsystem    = "dns_dnssec"
+	upstreamSubsystem  = "dns_upstream"
+	blocklistSubsystem = "dns_blocklist"
 )
 
+var (
+	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: cacheSubsystem,
+		Name:      "hits_total",
+		Help:      "Total count of DNS queries answered from the cache",
+	})
+	cacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: cacheSubsystem,
+		Name:      "misses_total",
+		Help:      "Total count of DNS queries that were not found in the cache",
+	})
+	cachePrefetches = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: cacheSubsystem,
+		Name:      "prefetches_total",
+		Help:      "Total count of cached DNS responses refreshed before they expired",
+	})
+	cacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: cacheSubsystem,
+		Name:      "entries",
+		Help:      "Number of DNS responses in each cache, the default one or the one of a client policy",
+	}, []string{"cache"})
+	dnssecValidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: dnssecSubsystem,
+		Name:      "validations_total",
+		Help:      "Total count of DNS responses validated locally, by result (secure, insecure, bogus, indeterminate)",
+	}, []string{"result"})
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: upstreamSubsystem,
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the DNS exchanges with each upstream",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"upstream"})
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: upstreamSubsystem,
+		Name:      "errors_total",
+		Help:      "Total count of failed DNS exchanges with each upstream",
+	}, []string{"upstream"})
+	blockedQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: blocklistSubsystem,
+		Name:      "blocked_total",
+		Help:      "Total count of DNS queries blocked by each blocklist",
+	}, []string{"list"})
+	blocklistEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: blocklistSubsystem,
+		Name:      "entries",
+		Help:      "Number of names in each blocklist",
+	}, []string{"list"})
+	upstreamHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: upstreamSubsystem,
+		Name:      "healthy",
+		Help:      "Whether each upstream is healthy (1) or failed its last exchanges (0)",
+	}, []string{"upstream"})
+	hedgedQueries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: upstreamSubsystem,
+		Name:      "hedged_total",
+		Help:      "Total count of DNS queries sent to another upstream because the first one was late",
+	})
+	rescuedQueries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: upstreamSubsystem,
+		Name:      "rescued_total",
+		Help:      "Total count of DNS queries answered by another upstream after the first one failed or answered SERVFAIL",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		cacheHits,
+		cacheMisses,
+		cachePrefetches,
+		cacheEntries,
+		dnssecValidations,
+		upstreamDuration,
+		upstreamErrors,
+		upstreamHealthy,
+		blockedQueries,
+		blocklistEntries,
+		hedgedQueries,
+		rescuedQueries,
+	)
+}
+
+func incrementCacheHit() {
+	cacheHits.Inc()
+}
+
+func incrementCacheMiss() {
+	cacheMisses.Inc()
+}
+
+func incrementCachePrefetch() {
+	cachePrefetches.Inc()
+}
+
+func setCacheEntries(cache string, n int) {
+	cacheEntries.WithLabelValues(cache).Set(float64(n))
+}
+
+func incrementDNSSECValidation(result DNSSECResult) {
+	dnssecValidations.WithLabelValues(string(result)).Inc()
+}
+
+func incrementBlocked(list string) {
+	blockedQueries.WithLabelValues(list).Inc()
+}
+
+func setBlocklistEntries(list string, n int) {
+	blocklistEntries.WithLabelValues(list).Set(float64(n))
+}
+
+func observeUpstreamExchange(upstream string, duration time.Duration, err error) {
+	upstreamDuration.WithLabelValues(upstream).Observe(duration.Seconds())
+	if err != nil {
+		upstreamErrors.WithLabelValues(upstream).Inc()
+	}
+}
+
+func setUpstreamHealthy(upstream string, healthy bool) {
+	if healthy {
+		upstreamHealthy.WithLabelValues(upstream).Set(1)
+	} else {
+		upstreamHealthy.WithLabelValues(upstream).Set(0)
+	}
+}
+
+func incrementHedgedQuery() {
+	hedgedQueries.Inc()
+}
+
+func incrementRescuedQuery() {
+	rescuedQueries.Inc()
+}
+
+// instrumentedUpstream reports the latency and health of an upstream, labelled by its endpoint.
+type instrumentedUpstream struct {
+	Upstream
+	endpoint string
+}
+
+func newInstrumentedUpstream(upstream Upstream, endpoint string) Upstream {
+	return &instrumentedUpstream{Upstream: upstream, endpoint: endpoint}
+}
+
+// Exchange provides an implementation for the Upstream interface
+func (u *instrumentedUpstream) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	start := time.Now()
+	response, err := u.Upstream.Exchange(ctx, query)
+	observeUpstreamExchange(u.endpoint, time.Since(start), err)
+	return response, err
+}
+
 // MetricsPlugin is an adapter for CoreDNS and built-in metrics
 type MetricsPlugin struct {
 	Next plugin.Handler
@@ -0,0 +1,131 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/rcode"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	DefaultQueryLogMaxSize    = 100 // megabytes
+	DefaultQueryLogMaxBackups = 5
+
+	// The sources of the answers that are not an upstream
+	answeredByCache     = "cache"
+	answeredByLocal     = "local"
+	answeredByBlocklist = "blocklist"
+)
+
+// QueryLogConfig configures the structured log of the queries.
+type QueryLogConfig struct {
+	// File is the path of the log, the queries are not logged if it is empty
+	File string
+	// SampleRatio is the ratio of queries that are logged, between 0 and 1. Every query is logged if it is zero.
+	SampleRatio float64
+	// MaxSize is the size in megabytes after which the log is rotated, DefaultQueryLogMaxSize if zero
+	MaxSize int
+	// MaxBackups is the number of rotated logs that are kept, DefaultQueryLogMaxBackups if zero
+	MaxBackups int
+	// MaxAge is the number of days after which rotated logs are removed, they are never removed if zero
+	MaxAge int
+}
+
+type answeredByKey struct{}
+
+// withAnsweredBy returns a context in which the plugins can record what answered the query.
+func withAnsweredBy(ctx context.Context) (context.Context, *string) {
+	source := new(string)
+	return context.WithValue(ctx, answeredByKey{}, source), source
+}
+
+// setAnsweredBy records the upstream, or the plugin, that answered the query if it is logged.
+func setAnsweredBy(ctx context.Context, source string) {
+	if answeredBy, ok := ctx.Value(answeredByKey{}).(*string); ok {
+		*answeredBy = source
+	}
+}
+
+// QueryLogPlugin logs a sample of the queries along with their response.
+type QueryLogPlugin struct {
+	Next plugin.Handler
+
+	log         zerolog.Logger
+	writer      io.Closer
+	sampleRatio float64
+	sample      func() float64
+}
+
+// NewQueryLogPlugin creates a plugin logging to the file of the configuration, it's up to the caller to set the Next
+// handler.
+func NewQueryLogPlugin(config QueryLogConfig) (*QueryLogPlugin, error) {
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid query log sample ratio %v, it must be greater than 0 and at most 1", config.SampleRatio)
+	}
+	if config.SampleRatio == 0 {
+		config.SampleRatio = 1
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultQueryLogMaxSize
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = DefaultQueryLogMaxBackups
+	}
+	writer := &lumberjack.Logger{
+		Filename:   config.File,
+		MaxSize:    config.MaxSize,
+		MaxBackups: config.MaxBackups,
+		MaxAge:     config.MaxAge,
+	}
+	return &QueryLogPlugin{
+		log:         zerolog.New(writer).With().Timestamp().Logger(),
+		writer:      writer,
+		sampleRatio: config.SampleRatio,
+		sample:      rand.Float64,
+	}, nil
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *QueryLogPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if p.sampleRatio < 1 && p.sample() >= p.sampleRatio {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	ctx, answeredBy := withAnsweredBy(ctx)
+	rw := dnstest.NewRecorder(w)
+	status, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, rw, r)
+
+	event := p.log.Log().
+		Str("client", w.RemoteAddr().String()).
+		Dur("latency", time.Since(rw.Start)).
+		Str("rcode", rcode.ToString(rw.Rcode))
+	if len(r.Question) > 0 {
+		event = event.
+			Str("qname", r.Question[0].Name).
+			Str("qtype", dns.TypeToString[r.Question[0].Qtype])
+	}
+	if *answeredBy != "" {
+		event = event.Str("upstream", *answeredBy)
+	}
+	if err != nil {
+		event = event.Err(err)
+	}
+	event.Send()
+	return status, err
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *QueryLogPlugin) Name() string { return "querylog" }
+
+// Close closes the log file
+func (p *QueryLogPlugin) Close() error {
+	return p.writer.Close()
+}
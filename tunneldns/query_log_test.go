@@ -0,0 +1,87 @@
+package tunneldns
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func readQueryLog(t *testing.T, path string) []map[string]any {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestQueryLogPlugin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	queryLog, err := NewQueryLogPlugin(QueryLogConfig{File: path})
+	require.NoError(t, err)
+	defer queryLog.Close()
+
+	cache := NewCachePlugin("test", CacheConfig{})
+	cache.Next = ProxyPlugin{Upstreams: []Upstream{newTestPool(t, SelectionConfig{}, &fakeUpstream{name: "a"})}}
+	queryLog.Next = cache
+
+	for i := 0; i < 2; i++ {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", dns.TypeTXT)
+		_, err := queryLog.ServeDNS(context.Background(), dnstest.NewRecorder(&testResponseWriter{}), query)
+		require.NoError(t, err)
+	}
+
+	lines := readQueryLog(t, path)
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		require.Equal(t, "192.0.2.10:53000", line["client"])
+		require.Equal(t, "example.com.", line["qname"])
+		require.Equal(t, "TXT", line["qtype"])
+		require.Equal(t, "NOERROR", line["rcode"])
+		require.Contains(t, line, "latency")
+	}
+	require.Equal(t, "test://a", lines[0]["upstream"])
+	require.Equal(t, answeredByCache, lines[1]["upstream"])
+}
+
+func TestQueryLogPluginSampling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	queryLog, err := NewQueryLogPlugin(QueryLogConfig{File: path, SampleRatio: 0.5})
+	require.NoError(t, err)
+	defer queryLog.Close()
+	queryLog.Next = ProxyPlugin{Upstreams: []Upstream{namedUpstream("a")}}
+
+	samples := []float64{0.1, 0.7, 0.4, 0.9}
+	queryLog.sample = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+	for range samples {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", dns.TypeTXT)
+		_, err := queryLog.ServeDNS(context.Background(), dnstest.NewRecorder(&testResponseWriter{}), query)
+		require.NoError(t, err)
+	}
+	require.Len(t, readQueryLog(t, path), 2)
+}
+
+func TestQueryLogPluginInvalidSampleRatio(t *testing.T) {
+	_, err := NewQueryLogPlugin(QueryLogConfig{File: "queries.log", SampleRatio: 1.5})
+	require.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package tunneldns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// QUICScheme is the URL scheme of DNS over QUIC upstreams, e.g. quic://dns.example:853
+	QUICScheme = "quic"
+
+	doqALPN        = "doq"
+	doqDefaultPort = "853"
+	// https://www.rfc-editor.org/rfc/rfc9250#section-4.3 DOQ_NO_ERROR is used when closing the connection
+	doqNoError = 0x0
+	// doqUnavailableBackoff is how long a DoQ upstream is skipped after failing to connect, so that queries fall back
+	// to the next upstream (e.g. DoH) right away when UDP/853 is blocked.
+	doqUnavailableBackoff = time.Minute
+)
+
+var errUpstreamUnavailable = errors.New("upstream is unavailable")
+
+// UpstreamQUIC is the upstream implementation for DNS over QUIC (RFC 9250) service. A single QUIC connection is reused
+// for all the queries, each query being sent on its own stream.
+type UpstreamQUIC struct {
+	address   string
+	tlsConfig *tls.Config
+	log       *zerolog.Logger
+
+	lock             sync.Mutex
+	conn             quic.Connection
+	unavailableUntil time.Time
+}
+
+// NewUpstreamQUIC creates a new DNS over QUIC upstream from endpoint
+func NewUpstreamQUIC(endpoint string, log *zerolog.Logger) (Upstream, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != QUICScheme {
+		return nil, fmt.Errorf("DNS over QUIC endpoint %s must use the %s scheme", endpoint, QUICScheme)
+	}
+	port := u.Port()
+	if port == "" {
+		port = doqDefaultPort
+	}
+	return &UpstreamQUIC{
+		address: net.JoinHostPort(u.Hostname(), port),
+		tlsConfig: &tls.Config{
+			ServerName: u.Hostname(),
+			NextProtos: []string{doqALPN},
+			MinVersion: tls.VersionTLS13,
+		},
+		log: log,
+	}, nil
+}
+
+// Exchange provides an implementation for the Upstream interface
+func (u *UpstreamQUIC) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+
+	conn, err := u.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	response, err := exchangeStream(ctx, conn, query)
+	if err != nil {
+		// The server might have closed the connection while it was idle, retry once on a new one
+		u.closeConnection(conn)
+		if conn, err = u.connection(ctx); err != nil {
+			return nil, err
+		}
+		if response, err = exchangeStream(ctx, conn, query); err != nil {
+			u.closeConnection(conn)
+			u.log.Err(err).Msgf("failed to exchange with a QUIC backend %q", u.address)
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// connection returns the current connection to the upstream, dialing a new one if needed.
+func (u *UpstreamQUIC) connection(ctx context.Context) (quic.Connection, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.conn != nil && u.conn.Context().Err() == nil {
+		return u.conn, nil
+	}
+	if time.Now().Before(u.unavailableUntil) {
+		return nil, errUpstreamUnavailable
+	}
+
+	conn, err := quic.DialAddr(ctx, u.address, u.tlsConfig, &quic.Config{
+		HandshakeIdleTimeout: defaultTimeout,
+	})
+	if err != nil {
+		u.unavailableUntil = time.Now().Add(doqUnavailableBackoff)
+		u.log.Err(err).Msgf("failed to connect to a QUIC backend %q, skipping it for %s", u.address, doqUnavailableBackoff)
+		return nil, errors.Wrap(err, "failed to dial the QUIC upstream")
+	}
+	u.conn = conn
+	return conn, nil
+}
+
+func (u *UpstreamQUIC) closeConnection(conn quic.Connection) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	_ = conn.CloseWithError(doqNoError, "")
+	if u.conn == conn {
+		u.conn = nil
+	}
+}
+
+// exchangeStream sends the query on a new stream of the connection as defined in
+// https://www.rfc-editor.org/rfc/rfc9250#section-4.2
+func exchangeStream(ctx context.Context, conn quic.Connection, query *dns.Msg) (*dns.Msg, error) {
+	// The DNS Message ID must be set to 0 on DoQ
+	wireQuery := query.Copy()
+	wireQuery.Id = 0
+	queryBuf, err := wireQuery.Pack()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack DNS query")
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open a QUIC stream")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	buf := make([]byte, 2+len(queryBuf))
+	binary.BigEndian.PutUint16(buf, uint16(len(queryBuf)))
+	copy(buf[2:], queryBuf)
+	if _, err := stream.Write(buf); err != nil {
+		stream.CancelRead(doqNoError)
+		return nil, errors.Wrap(err, "failed to write the DNS query")
+	}
+	// The client must indicate that no more data will be sent on the stream
+	if err := stream.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to close the QUIC stream")
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(stream, length[:]); err != nil {
+		return nil, errors.Wrap(err, "failed to read the DNS response length")
+	}
+	responseBuf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(stream, responseBuf); err != nil {
+		return nil, errors.Wrap(err, "failed to read the DNS response")
+	}
+
+	response := &dns.Msg{}
+	if err := response.Unpack(responseBuf); err != nil {
+		return nil, errors.Wrap(err, "failed to unpack DNS response")
+	}
+	response.Id = query.Id
+	return response, nil
+}
@@ -0,0 +1,117 @@
+package tunneldns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamQUICExchange(t *testing.T) {
+	listener, err := quic.ListenAddr("127.0.0.1:0", serverTLSConfig(t), nil)
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveDoQ(listener)
+
+	log := zerolog.Nop()
+	upstream, err := NewUpstreamQUIC("quic://"+listener.Addr().String(), &log)
+	require.NoError(t, err)
+	upstream.(*UpstreamQUIC).tlsConfig.InsecureSkipVerify = true
+
+	// Both queries share the same connection
+	for i := 0; i < 2; i++ {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", dns.TypeA)
+		response, err := upstream.Exchange(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, query.Id, response.Id)
+		require.Len(t, response.Answer, 1)
+	}
+}
+
+func TestUpstreamQUICUnavailable(t *testing.T) {
+	// Nothing is listening on this address, the upstream should be skipped after the first failure
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := conn.LocalAddr().String()
+	require.NoError(t, conn.Close())
+
+	log := zerolog.Nop()
+	upstream, err := NewUpstreamQUIC("quic://"+address, &log)
+	require.NoError(t, err)
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = upstream.Exchange(ctx, query)
+	require.Error(t, err)
+	_, err = upstream.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, errUpstreamUnavailable)
+}
+
+func serveDoQ(listener *quic.Listener) {
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				var length [2]byte
+				if _, err := io.ReadFull(stream, length[:]); err != nil {
+					return
+				}
+				buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(stream, buf); err != nil {
+					return
+				}
+				query := new(dns.Msg)
+				if err := query.Unpack(buf); err != nil || query.Id != 0 {
+					return
+				}
+				response := new(dns.Msg)
+				response.SetReply(query)
+				response.Answer = append(response.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: query.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.IPv4(192, 0, 2, 1),
+				})
+				responseBuf, _ := response.Pack()
+				out := make([]byte, 2+len(responseBuf))
+				binary.BigEndian.PutUint16(out, uint16(len(responseBuf)))
+				copy(out[2:], responseBuf)
+				_, _ = stream.Write(out)
+				_ = stream.Close()
+			}
+		}()
+	}
+}
+
+func serverTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{SerialNumber: big.NewInt(1)}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certDER}, PrivateKey: key}},
+		NextProtos:   []string{doqALPN},
+	}
+}
@@ -0,0 +1,101 @@
+package tunneldns
+
+import (
+	"net"
+	"os"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/pkg/errors"
+)
+
+// SocketConfig configures the sockets serving plain DNS other than the UDP and TCP sockets of Address and Port, e.g. so
+// that a container sidecar can use proxy-dns without a port exposed on localhost.
+type SocketConfig struct {
+	// UnixSocket is the path of a Unix domain socket serving DNS with the TCP framing, it is disabled if empty
+	UnixSocket string
+	// SystemdActivation serves the sockets passed by systemd socket activation instead of listening on Address and
+	// Port
+	SystemdActivation bool
+}
+
+// socketServer serves DNS on a single socket, which is either a stream or a datagram socket
+type socketServer struct {
+	server   *dnsserver.Server
+	address  string
+	listener net.Listener
+	conn     net.PacketConn
+	// path of the Unix socket that is listened on when started
+	path string
+}
+
+func (s *socketServer) listen() error {
+	if s.path == "" {
+		return nil
+	}
+	// A socket left behind by a previous run would make the listener fail
+	if info, err := os.Stat(s.path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(s.path)
+	}
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create a listener for %s", s.path)
+	}
+	s.listener = listener
+	return nil
+}
+
+func (s *socketServer) serve() error {
+	if s.conn != nil {
+		return s.server.ServePacket(s.conn)
+	}
+	return s.server.Serve(s.listener)
+}
+
+// newSocketServers creates the servers of the Unix socket and of the sockets passed by systemd. It returns false if
+// the plain DNS server of Address and Port shouldn't be started because the sockets were passed by systemd.
+func newSocketServers(config SocketConfig, p plugin.Handler) ([]*socketServer, bool, error) {
+	var servers []*socketServer
+	newServer := func(address string) (*socketServer, error) {
+		server, err := dnsserver.NewServer(address, []*dnsserver.Config{createConfig("", 0, p)})
+		if err != nil {
+			return nil, err
+		}
+		return &socketServer{server: server, address: address}, nil
+	}
+
+	if config.UnixSocket != "" {
+		server, err := newServer("unix://" + config.UnixSocket)
+		if err != nil {
+			return nil, false, err
+		}
+		server.path = config.UnixSocket
+		servers = append(servers, server)
+	}
+
+	if !config.SystemdActivation {
+		return servers, true, nil
+	}
+	files := activation.Files(true)
+	if len(files) == 0 {
+		return nil, false, errors.New("systemd socket activation is enabled but no sockets were passed to the process")
+	}
+	for _, file := range files {
+		server, err := newServer("systemd://" + file.Name())
+		if err != nil {
+			return nil, false, err
+		}
+		// Stream sockets are served like TCP and datagram sockets like UDP
+		if listener, err := net.FileListener(file); err == nil {
+			server.listener = listener
+		} else if conn, err := net.FilePacketConn(file); err == nil {
+			server.conn = conn
+		} else {
+			return nil, false, errors.Wrapf(err, "unsupported socket %s passed by systemd", file.Name())
+		}
+		file.Close()
+		servers = append(servers, server)
+	}
+	return servers, false, nil
+}
@@ -0,0 +1,52 @@
+package tunneldns
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocketListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dns.sock")
+	log := zerolog.Nop()
+	listener, err := CreateListener(ListenerConfig{
+		Address:   "127.0.0.1",
+		Port:      freePort(t),
+		Local:     LocalConfig{Records: []string{"host.lab. 300 IN A 10.0.0.1"}},
+		Socket:    SocketConfig{UnixSocket: path},
+		Selection: SelectionConfig{HealthCheckInterval: -1},
+	}, &log)
+	require.NoError(t, err)
+	require.NoError(t, listener.Start(make(chan struct{})))
+	defer listener.Stop()
+
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	require.NoError(t, err)
+	co := &dns.Conn{Conn: conn}
+	defer co.Close()
+	require.NoError(t, co.SetDeadline(time.Now().Add(5*time.Second)))
+
+	query := new(dns.Msg)
+	query.SetQuestion("host.lab.", dns.TypeA)
+	require.NoError(t, co.WriteMsg(query))
+	response, err := co.ReadMsg()
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1", response.Answer[0].(*dns.A).A.String())
+}
+
+func TestSystemdActivationRequiresSockets(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	log := zerolog.Nop()
+	_, err := CreateListener(ListenerConfig{
+		Address: "127.0.0.1",
+		Port:    freePort(t),
+		Socket:  SocketConfig{SystemdActivation: true},
+	}, &log)
+	require.Error(t, err)
+}
@@ -1,13 +1,15 @@
 package tunneldns
 
 import (
+	"context"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
-	"github.com/coredns/coredns/plugin/cache"
+	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 )
@@ -15,14 +17,26 @@ import (
 const (
 	LogFieldAddress         = "address"
 	LogFieldURL             = "url"
+	LogFieldZone            = "zone"
 	MaxUpstreamConnsDefault = 5
+
+	// defaultCacheName labels the metrics of the cache of the clients without a policy
+	defaultCacheName = "default"
 )
 
 // Listener is an adapter between CoreDNS server and Warp runnable
 type Listener struct {
+	// server listens on Address and Port, it is nil if the sockets are passed by systemd
 	server *dnsserver.Server
-	wg     sync.WaitGroup
-	log    *zerolog.Logger
+	// encrypted are the DNS over TLS and DNS over HTTPS servers, if enabled
+	encrypted []encryptedServer
+	// sockets are the Unix socket and the sockets passed by systemd, if enabled
+	sockets []*socketServer
+	wg      sync.WaitGroup
+	log     *zerolog.Logger
+	// background tasks run while the server is started, e.g. refreshing the blocklists
+	background []func(ctx context.Context)
+	cancel     context.CancelFunc
 }
 
 // Create a CoreDNS server plugin from configuration
@@ -41,17 +55,58 @@ func createConfig(address string, port uint16, p plugin.Handler) *dnsserver.Conf
 // Start blocks for serving requests
 func (l *Listener) Start(readySignal chan struct{}) error {
 	defer close(readySignal)
-	l.log.Info().Str(LogFieldAddress, l.server.Address()).Msg("Starting DNS over HTTPS proxy server")
+	if l.server != nil {
+		l.log.Info().Str(LogFieldAddress, l.server.Address()).Msg("Starting DNS over HTTPS proxy server")
+
+		// Start UDP listener
+		if udp, err := l.server.ListenPacket(); err == nil {
+			l.wg.Add(1)
+			go func() {
+				_ = l.server.ServePacket(udp)
+				l.wg.Done()
+			}()
+		} else {
+			return errors.Wrap(err, "failed to create a UDP listener")
+		}
+	}
 
-	// Start UDP listener
-	if udp, err := l.server.ListenPacket(); err == nil {
+	var ctx context.Context
+	ctx, l.cancel = context.WithCancel(context.Background())
+	for _, run := range l.background {
 		l.wg.Add(1)
-		go func() {
-			_ = l.server.ServePacket(udp)
+		go func(run func(ctx context.Context)) {
+			run(ctx)
 			l.wg.Done()
-		}()
-	} else {
-		return errors.Wrap(err, "failed to create a UDP listener")
+		}(run)
+	}
+
+	for _, server := range l.encrypted {
+		listener, err := server.Listen()
+		if err != nil {
+			return errors.Wrapf(err, "failed to create a listener for %s", server.Address())
+		}
+		l.log.Info().Str(LogFieldAddress, server.Address()).Msg("Starting encrypted DNS proxy server")
+		l.wg.Add(1)
+		go func(server encryptedServer) {
+			_ = server.Serve(listener)
+			l.wg.Done()
+		}(server)
+	}
+
+	for _, socket := range l.sockets {
+		if err := socket.listen(); err != nil {
+			return err
+		}
+		l.log.Info().Str(LogFieldAddress, socket.address).Msg("Starting DNS proxy server")
+		l.wg.Add(1)
+		go func(socket *socketServer) {
+			_ = socket.serve()
+			l.wg.Done()
+		}(socket)
+	}
+
+	if l.server == nil {
+		return nil
 	}
 
 	// Start TCP listener
@@ -69,41 +124,265 @@ func (l *Listener) Start(readySignal chan struct{}) error {
 
 // Stop signals server shutdown and blocks until completed
 func (l *Listener) Stop() error {
-	if err := l.server.Stop(); err != nil {
-		return err
+	if l.cancel != nil {
+		l.cancel()
+	}
+	for _, server := range l.encrypted {
+		if err := server.Stop(); err != nil {
+			return err
+		}
+	}
+	for _, socket := range l.sockets {
+		if err := socket.server.Stop(); err != nil {
+			return err
+		}
+	}
+	if l.server != nil {
+		if err := l.server.Stop(); err != nil {
+			return err
+		}
 	}
 
 	l.wg.Wait()
 	return nil
 }
 
+// newUpstream creates a DNS over QUIC upstream for quic:// endpoints, a plain DNS upstream for dns:// endpoints and a
+// DNS over HTTPS upstream otherwise.
+func newUpstream(endpoint string, bootstraps []string, maxUpstreamConnections int, log *zerolog.Logger) (Upstream, error) {
+	if strings.HasPrefix(endpoint, DNSScheme+"://") {
+		upstream, err := NewUpstreamDNS(endpoint, log)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create DNS upstream")
+		}
+		return upstream, nil
+	}
+	if strings.HasPrefix(endpoint, QUICScheme+"://") {
+		upstream, err := NewUpstreamQUIC(endpoint, log)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create QUIC upstream")
+		}
+		return upstream, nil
+	}
+	upstream, err := NewUpstreamHTTPS(endpoint, bootstraps, maxUpstreamConnections, log)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create HTTPS upstream")
+	}
+	return upstream, nil
+}
+
+// ListenerConfig configures the DNS proxy server
+type ListenerConfig struct {
+	Address                string
+	Port                   uint16
+	Upstreams              []string
+	Bootstraps             []string
+	MaxUpstreamConnections int
+	Cache                  CacheConfig
+	// Zones are forwarded to their own upstreams instead of Upstreams (split-horizon)
+	Zones     []ZoneConfig
+	Local     LocalConfig
+	DNSSEC    DNSSECConfig
+	DNS64     DNS64Config
+	ECS       ECSConfig
+	Blocklist BlocklistConfig
+	Selection SelectionConfig
+	// ClientPolicies resolve the queries of some clients with their own upstreams or blocklists
+	ClientPolicies []ClientPolicyConfig
+	Encrypted      EncryptedListenerConfig
+	Socket         SocketConfig
+	QueryLog       QueryLogConfig
+}
+
 // CreateListener configures the server and bound sockets
-func CreateListener(address string, port uint16, upstreams []string, bootstraps []string, maxUpstreamConnections int, log *zerolog.Logger) (*Listener, error) {
-	// Build the list of upstreams
-	upstreamList := make([]Upstream, 0)
-	for _, url := range upstreams {
-		log.Info().Str(LogFieldURL, url).Msg("Adding DNS upstream")
-		upstream, err := NewUpstreamHTTPS(url, bootstraps, maxUpstreamConnections, log)
+func CreateListener(config ListenerConfig, log *zerolog.Logger) (*Listener, error) {
+	var background []func(ctx context.Context)
+
+	// Build the pool of upstreams, a listener without upstreams only answers from its local records and zones
+	var upstreams []Upstream
+	if len(config.Upstreams) > 0 {
+		upstreamPool, err := newUpstreamPool(config.Upstreams, config, log)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create HTTPS upstream")
+			return nil, err
 		}
-		upstreamList = append(upstreamList, upstream)
+		background = append(background, upstreamPool.Run)
+		upstreams = append(upstreams, upstreamPool)
 	}
 
-	// Create a local cache with HTTPS proxy plugin
-	chain := cache.New()
-	chain.Next = ProxyPlugin{
-		Upstreams: upstreamList,
+	zones := make([]Zone, 0, len(config.Zones))
+	for _, zoneConfig := range config.Zones {
+		log.Info().Str(LogFieldZone, zoneConfig.Zone).Msg("Adding DNS forwarding zone")
+		zonePool, err := newUpstreamPool(zoneConfig.Upstreams, config, log)
+		if err != nil {
+			return nil, err
+		}
+		background = append(background, zonePool.Run)
+		zones = append(zones, Zone{Name: dns.CanonicalName(zoneConfig.Zone), Upstreams: []Upstream{zonePool}})
+	}
+	sortZones(zones)
+
+	// The plugins are chained from the upstreams up to the client
+	chain, err := newResolverChain(defaultCacheName, upstreams, zones, config, log)
+	if err != nil {
+		return nil, err
+	}
+	if config.DNSSEC.Enabled {
+		log.Info().Msg("Enabling DNSSEC validation")
+	}
+	if config.ECS.Mode != "" && config.ECS.Mode != ECSForward {
+		log.Info().Str("mode", string(config.ECS.Mode)).Msg("Rewriting the EDNS Client Subnet of the DNS queries")
+	}
+
+	// The clients of a policy have their own resolvers, which share the forwarding zones and the default blocklists
+	if len(config.ClientPolicies) > 0 {
+		policies := make([]ClientPolicy, 0, len(config.ClientPolicies))
+		for _, policyConfig := range config.ClientPolicies {
+			log.Info().Str("policy", policyConfig.Name).Msg("Adding DNS client policy")
+			handler := chain
+			if len(policyConfig.Upstreams) > 0 {
+				policyPool, err := newUpstreamPool(policyConfig.Upstreams, config, log)
+				if err != nil {
+					return nil, err
+				}
+				background = append(background, policyPool.Run)
+				if handler, err = newResolverChain(policyConfig.Name, []Upstream{policyPool}, zones, config, log); err != nil {
+					return nil, err
+				}
+			}
+			if len(policyConfig.Blocklists) > 0 {
+				blocklist, err := NewBlocklistPlugin(BlocklistConfig{
+					Sources: policyConfig.Blocklists,
+					Refresh: config.Blocklist.Refresh,
+					Answer:  config.Blocklist.Answer,
+				}, log)
+				if err != nil {
+					return nil, err
+				}
+				background = append(background, blocklist.Run)
+				blocklist.Next = handler
+				handler = blocklist
+			}
+			policies = append(policies, ClientPolicy{Name: policyConfig.Name, Clients: policyConfig.Clients, Handler: handler})
+		}
+		chain = &ClientPolicyPlugin{Next: chain, Policies: policies}
+	}
+
+	// Blocked names are answered before the cache so that a refreshed list applies right away
+	if len(config.Blocklist.Sources) > 0 {
+		blocklist, err := NewBlocklistPlugin(config.Blocklist, log)
+		if err != nil {
+			return nil, err
+		}
+		background = append(background, blocklist.Run)
+		blocklist.Next = chain
+		chain = blocklist
+	}
+
+	// Local records are answered before the blocklists and the cache so that they are never sent upstream
+	local, err := NewLocalPlugin(config.Local)
+	if err != nil {
+		return nil, err
+	}
+	if !local.Empty() {
+		log.Info().Msgf("Adding %d local DNS names", len(local.records))
+		local.Next = chain
+		chain = local
+	}
+
+	// AAAA records are synthesized from the cached and local A records
+	if config.DNS64.Enabled {
+		dns64, err := NewDNS64Plugin(config.DNS64)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("prefix", dns64.prefix.String()).Msg("Enabling DNS64")
+		dns64.Next = chain
+		chain = dns64
+	}
+
+	// The queries are logged with the response written to the client
+	if config.QueryLog.File != "" {
+		queryLog, err := NewQueryLogPlugin(config.QueryLog)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("file", config.QueryLog.File).Float64("sampleRatio", config.QueryLog.SampleRatio).Msg("Logging DNS queries")
+		background = append(background, func(ctx context.Context) {
+			<-ctx.Done()
+			_ = queryLog.Close()
+		})
+		queryLog.Next = chain
+		chain = queryLog
 	}
 
 	// Format an endpoint
-	endpoint := "dns://" + net.JoinHostPort(address, strconv.FormatUint(uint64(port), 10))
+	endpoint := "dns://" + net.JoinHostPort(config.Address, strconv.FormatUint(uint64(config.Port), 10))
+
+	sockets, listenAddress, err := newSocketServers(config.Socket, NewMetricsPlugin(chain))
+	if err != nil {
+		return nil, err
+	}
 
 	// Create the actual middleware server
-	server, err := dnsserver.NewServer(endpoint, []*dnsserver.Config{createConfig(address, port, NewMetricsPlugin(chain))})
+	var server *dnsserver.Server
+	if listenAddress {
+		server, err = dnsserver.NewServer(endpoint, []*dnsserver.Config{createConfig(config.Address, config.Port, NewMetricsPlugin(chain))})
+		if err != nil {
+			return nil, err
+		}
+	}
+	encrypted, err := newEncryptedServers(config.Address, config.Encrypted, NewMetricsPlugin(chain))
 	if err != nil {
 		return nil, err
 	}
 
-	return &Listener{server: server, log: log}, nil
+	return &Listener{server: server, encrypted: encrypted, sockets: sockets, log: log, background: background}, nil
+}
+
+// newResolverChain chains the plugins resolving the queries with the upstreams: the ECS rewriting, the cache and the
+// DNSSEC validation. The name labels the metrics of the cache.
+func newResolverChain(name string, upstreams []Upstream, zones []Zone, config ListenerConfig, log *zerolog.Logger) (plugin.Handler, error) {
+	var chain plugin.Handler = ProxyPlugin{
+		Upstreams: upstreams,
+		Zones:     zones,
+	}
+
+	// Responses are validated before being cached, the keys of the zones are fetched from the upstreams directly
+	if config.DNSSEC.Enabled {
+		validator, err := NewValidatorPlugin(config.DNSSEC, log)
+		if err != nil {
+			return nil, err
+		}
+		validator.Next = chain
+		chain = validator
+	}
+
+	// Create a local cache in front of the upstreams
+	cache := NewCachePlugin(name, config.Cache)
+	cache.Next = chain
+	chain = cache
+
+	// The client subnet is rewritten before the cache, which keys the responses by subnet
+	ecs, err := NewECSPlugin(config.ECS)
+	if err != nil {
+		return nil, err
+	}
+	if ecs != nil {
+		ecs.Next = chain
+		chain = ecs
+	}
+	return chain, nil
+}
+
+func newUpstreamPool(endpoints []string, config ListenerConfig, log *zerolog.Logger) (*UpstreamPool, error) {
+	upstreams := make([]Upstream, 0, len(endpoints))
+	for _, url := range endpoints {
+		log.Info().Str(LogFieldURL, url).Msg("Adding DNS upstream")
+		upstream, err := newUpstream(url, config.Bootstraps, config.MaxUpstreamConnections, log)
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, newInstrumentedUpstream(upstream, url))
+	}
+	return NewUpstreamPool(upstreams, endpoints, config.Selection, log)
 }
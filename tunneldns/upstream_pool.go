@@ -0,0 +1,258 @@
+package tunneldns
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultHealthCheckInterval and DefaultHedgeDelay are the defaults of the flags of the proxy-dns command
+	DefaultHealthCheckInterval = 30 * time.Second
+	DefaultHedgeDelay          = 250 * time.Millisecond
+
+	// unhealthyThreshold is the number of consecutive failures after which an upstream is considered unhealthy
+	unhealthyThreshold = 3
+	// latencyWeight is the weight of a new sample in the moving average of the latency of an upstream
+	latencyWeight = 0.25
+)
+
+var errNoUpstream = errors.New("no DNS upstream")
+
+// SelectionConfig configures how the upstreams are chosen for each query.
+type SelectionConfig struct {
+	// Ordered tries the upstreams in the configured order instead of the fastest first. Unhealthy upstreams are
+	// still tried last.
+	Ordered bool
+	// HealthCheckInterval is how often the upstreams are probed, the probes are disabled if it isn't positive
+	HealthCheckInterval time.Duration
+	// HedgeDelay is how long to wait for an upstream before sending the query to the next one as well, the first
+	// response wins. Hedging is disabled if it isn't positive.
+	HedgeDelay time.Duration
+}
+
+type pooledUpstream struct {
+	upstream Upstream
+	endpoint string
+	index    int
+
+	lock     sync.Mutex
+	latency  time.Duration
+	failures int
+}
+
+func (u *pooledUpstream) observe(latency time.Duration, err error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if err != nil {
+		u.failures++
+		setUpstreamHealthy(u.endpoint, u.failures < unhealthyThreshold)
+		return
+	}
+	u.failures = 0
+	setUpstreamHealthy(u.endpoint, true)
+	if u.latency == 0 {
+		u.latency = latency
+		return
+	}
+	u.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(u.latency))
+}
+
+func (u *pooledUpstream) state() (time.Duration, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.latency, u.failures < unhealthyThreshold
+}
+
+// UpstreamPool sends the queries to the fastest healthy upstream of a set, hedging with the next upstreams when the
+// response is late. Queries that fail or are answered with SERVFAIL are retried with the next upstream before
+// answering. The upstreams are probed periodically so that an upstream recovers from being unhealthy even if it's not
+// chosen for queries.
+type UpstreamPool struct {
+	upstreams []*pooledUpstream
+	config    SelectionConfig
+	log       *zerolog.Logger
+}
+
+type exchangeResult struct {
+	response *dns.Msg
+	endpoint string
+	err      error
+}
+
+// NewUpstreamPool creates a pool of upstreams, the endpoints are only used for logging.
+func NewUpstreamPool(upstreams []Upstream, endpoints []string, config SelectionConfig, log *zerolog.Logger) (*UpstreamPool, error) {
+	if len(upstreams) == 0 {
+		return nil, errNoUpstream
+	}
+	if len(endpoints) != len(upstreams) {
+		return nil, errors.Errorf("%d endpoints for %d DNS upstreams", len(endpoints), len(upstreams))
+	}
+	pool := &UpstreamPool{
+		config: config,
+		log:    log,
+	}
+	for i, upstream := range upstreams {
+		pool.upstreams = append(pool.upstreams, &pooledUpstream{upstream: upstream, endpoint: endpoints[i], index: i})
+		setUpstreamHealthy(endpoints[i], true)
+	}
+	return pool, nil
+}
+
+// Exchange provides an implementation for the Upstream interface
+func (p *UpstreamPool) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	candidates := p.candidates()
+	if len(candidates) == 0 {
+		return nil, errNoUpstream
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan exchangeResult, len(candidates))
+	next, inflight := 0, 0
+	launch := func() {
+		u := candidates[next]
+		next++
+		inflight++
+		go func() {
+			start := time.Now()
+			response, err := u.upstream.Exchange(ctx, query.Copy())
+			// Exchanges that are cancelled because another upstream answered don't count as failures
+			if ctx.Err() == nil {
+				u.observe(time.Since(start), err)
+			}
+			results <- exchangeResult{response: response, endpoint: u.endpoint, err: err}
+		}()
+	}
+
+	launch()
+	var lastErr error
+	// servFail is the last SERVFAIL response, which is answered if no upstream does better
+	var servFail *exchangeResult
+	for inflight > 0 {
+		var hedge <-chan time.Time
+		var timer *time.Timer
+		if p.config.HedgeDelay > 0 && next < len(candidates) {
+			timer = time.NewTimer(p.config.HedgeDelay)
+			hedge = timer.C
+		}
+		select {
+		case result := <-results:
+			inflight--
+			if result.err == nil && result.response.Rcode != dns.RcodeServerFailure {
+				if timer != nil {
+					timer.Stop()
+				}
+				if lastErr != nil || servFail != nil {
+					incrementRescuedQuery()
+				}
+				setAnsweredBy(ctx, result.endpoint)
+				return result.response, nil
+			}
+			if result.err == nil {
+				servFail = &result
+			} else {
+				lastErr = result.err
+			}
+			// Try the next upstream right away instead of waiting for the hedge delay
+			if next < len(candidates) {
+				launch()
+			}
+		case <-hedge:
+			incrementHedgedQuery()
+			launch()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	if servFail != nil {
+		setAnsweredBy(ctx, servFail.endpoint)
+		return servFail.response, nil
+	}
+	return nil, lastErr
+}
+
+// candidates returns the upstreams in the order they should be tried: the healthy ones first, ordered by latency
+// unless the pool is ordered.
+func (p *UpstreamPool) candidates() []*pooledUpstream {
+	type candidate struct {
+		upstream *pooledUpstream
+		latency  time.Duration
+		healthy  bool
+	}
+	candidates := make([]candidate, len(p.upstreams))
+	for i, u := range p.upstreams {
+		latency, healthy := u.state()
+		candidates[i] = candidate{upstream: u, latency: latency, healthy: healthy}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].healthy != candidates[j].healthy {
+			return candidates[i].healthy
+		}
+		if p.config.Ordered {
+			return candidates[i].upstream.index < candidates[j].upstream.index
+		}
+		return candidates[i].latency < candidates[j].latency
+	})
+	upstreams := make([]*pooledUpstream, len(candidates))
+	for i, c := range candidates {
+		upstreams[i] = c.upstream
+	}
+	return upstreams
+}
+
+// Run probes the upstreams periodically until the context is cancelled.
+func (p *UpstreamPool) Run(ctx context.Context) {
+	if p.config.HealthCheckInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var wg sync.WaitGroup
+		for _, u := range p.upstreams {
+			wg.Add(1)
+			go func(u *pooledUpstream) {
+				defer wg.Done()
+				p.probe(ctx, u)
+			}(u)
+		}
+		wg.Wait()
+	}
+}
+
+func (p *UpstreamPool) probe(ctx context.Context, u *pooledUpstream) {
+	query := new(dns.Msg)
+	query.SetQuestion(".", dns.TypeNS)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	_, wasHealthy := u.state()
+	start := time.Now()
+	_, err := u.upstream.Exchange(ctx, query)
+	if ctx.Err() == context.Canceled {
+		return
+	}
+	// The probe resets the failures so that an unhealthy upstream is tried again as soon as it recovers
+	u.observe(time.Since(start), err)
+	if _, healthy := u.state(); healthy != wasHealthy {
+		if healthy {
+			p.log.Info().Str(LogFieldURL, u.endpoint).Msg("DNS upstream is healthy again")
+		} else {
+			p.log.Warn().Err(err).Str(LogFieldURL, u.endpoint).Msg("DNS upstream is unhealthy")
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUpstream struct {
+	name     string
+	delay    time.Duration
+	fail     atomic.Bool
+	servFail atomic.Bool
+	queries  atomic.Int32
+}
+
+func (u *fakeUpstream) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	u.queries.Add(1)
+	select {
+	case <-time.After(u.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if u.fail.Load() {
+		return nil, fmt.Errorf("%s failed", u.name)
+	}
+	response, err := namedUpstream(u.name).Exchange(ctx, query)
+	if u.servFail.Load() {
+		response.Rcode = dns.RcodeServerFailure
+	}
+	return response, err
+}
+
+func exchangePool(t *testing.T, pool *UpstreamPool) (string, error) {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeTXT)
+	response, err := pool.Exchange(context.Background(), query)
+	if err != nil {
+		return "", err
+	}
+	return response.Answer[0].(*dns.TXT).Txt[0], nil
+}
+
+func newTestPool(t *testing.T, config SelectionConfig, upstreams ...*fakeUpstream) *UpstreamPool {
+	log := zerolog.Nop()
+	var list []Upstream
+	var endpoints []string
+	for _, u := range upstreams {
+		list = append(list, u)
+		endpoints = append(endpoints, "test://"+u.name)
+	}
+	pool, err := NewUpstreamPool(list, endpoints, config, &log)
+	require.NoError(t, err)
+	return pool
+}
+
+func TestUpstreamPoolHedging(t *testing.T) {
+	slow := &fakeUpstream{name: "slow", delay: time.Second}
+	fast := &fakeUpstream{name: "fast"}
+	pool := newTestPool(t, SelectionConfig{Ordered: true, HedgeDelay: 10 * time.Millisecond}, slow, fast)
+
+	start := time.Now()
+	name, err := exchangePool(t, pool)
+	require.NoError(t, err)
+	require.Equal(t, "fast", name)
+	require.Less(t, time.Since(start), slow.delay)
+	// The cancelled exchange doesn't count against the slow upstream
+	_, healthy := pool.upstreams[0].state()
+	require.True(t, healthy)
+}
+
+func TestUpstreamPoolNoHedgingByDefault(t *testing.T) {
+	slow := &fakeUpstream{name: "slow", delay: 50 * time.Millisecond}
+	fast := &fakeUpstream{name: "fast"}
+	pool := newTestPool(t, SelectionConfig{Ordered: true}, slow, fast)
+
+	name, err := exchangePool(t, pool)
+	require.NoError(t, err)
+	require.Equal(t, "slow", name)
+	require.Zero(t, fast.queries.Load())
+}
+
+func TestUpstreamPoolWithoutUpstreams(t *testing.T) {
+	log := zerolog.Nop()
+	_, err := NewUpstreamPool(nil, nil, SelectionConfig{}, &log)
+	require.Error(t, err)
+
+	// An empty pool fails the queries instead of panicking
+	_, err = exchangePool(t, &UpstreamPool{log: &log})
+	require.ErrorIs(t, err, errNoUpstream)
+}
+
+func TestUpstreamPoolFailover(t *testing.T) {
+	broken := &fakeUpstream{name: "broken"}
+	broken.fail.Store(true)
+	working := &fakeUpstream{name: "working"}
+	pool := newTestPool(t, SelectionConfig{Ordered: true, HedgeDelay: -1}, broken, working)
+
+	for i := 0; i < unhealthyThreshold; i++ {
+		name, err := exchangePool(t, pool)
+		require.NoError(t, err)
+		require.Equal(t, "working", name)
+	}
+	require.Equal(t, int32(unhealthyThreshold), broken.queries.Load())
+
+	// The unhealthy upstream is tried last
+	_, err := exchangePool(t, pool)
+	require.NoError(t, err)
+	require.Equal(t, int32(unhealthyThreshold), broken.queries.Load())
+
+	// A successful probe makes it healthy again
+	broken.fail.Store(false)
+	pool.probe(context.Background(), pool.upstreams[0])
+	name, err := exchangePool(t, pool)
+	require.NoError(t, err)
+	require.Equal(t, "broken", name)
+
+	working.fail.Store(true)
+	broken.fail.Store(true)
+	_, err = exchangePool(t, pool)
+	require.Error(t, err)
+}
+
+func TestUpstreamPoolServFail(t *testing.T) {
+	failing := &fakeUpstream{name: "failing"}
+	failing.servFail.Store(true)
+	working := &fakeUpstream{name: "working"}
+	pool := newTestPool(t, SelectionConfig{Ordered: true, HedgeDelay: -1}, failing, working)
+
+	name, err := exchangePool(t, pool)
+	require.NoError(t, err)
+	require.Equal(t, "working", name)
+	require.Equal(t, int32(1), failing.queries.Load())
+	// SERVFAIL is an answer, it doesn't make the upstream unhealthy
+	_, healthy := pool.upstreams[0].state()
+	require.True(t, healthy)
+
+	// The SERVFAIL is answered when no upstream does better
+	working.fail.Store(true)
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeTXT)
+	response, err := pool.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	require.Equal(t, dns.RcodeServerFailure, response.Rcode)
+}
+
+func TestUpstreamPoolLatency(t *testing.T) {
+	slower := &fakeUpstream{name: "slower", delay: 20 * time.Millisecond}
+	faster := &fakeUpstream{name: "faster", delay: time.Millisecond}
+	pool := newTestPool(t, SelectionConfig{HedgeDelay: -1}, slower, faster)
+
+	// Both upstreams are measured by the probes
+	pool.probe(context.Background(), pool.upstreams[0])
+	pool.probe(context.Background(), pool.upstreams[1])
+	for i := 0; i < 3; i++ {
+		name, err := exchangePool(t, pool)
+		require.NoError(t, err)
+		require.Equal(t, "faster", name)
+	}
+}
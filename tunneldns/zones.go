@@ -0,0 +1,81 @@
+package tunneldns
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneConfig forwards the queries for a zone and its subdomains to dedicated upstreams instead of the default ones,
+// e.g. so that an internal zone is resolved by the internal resolver.
+type ZoneConfig struct {
+	Zone      string
+	Upstreams []string
+}
+
+// ParseZoneConfig parses a forwarding zone in the zone=upstream[,upstream...] format. Upstreams without a scheme are
+// plain DNS resolvers, e.g. corp.example=10.0.0.53 is the same as corp.example=dns://10.0.0.53:53.
+func ParseZoneConfig(s string) (ZoneConfig, error) {
+	zone, upstreams, ok := strings.Cut(s, "=")
+	zone = strings.TrimSpace(zone)
+	if !ok || zone == "" || upstreams == "" {
+		return ZoneConfig{}, fmt.Errorf("invalid forwarding zone %q, expected zone=upstream[,upstream...]", s)
+	}
+	if _, ok := dns.IsDomainName(zone); !ok {
+		return ZoneConfig{}, fmt.Errorf("invalid forwarding zone %q, %q is not a domain name", s, zone)
+	}
+	config := ZoneConfig{Zone: dns.CanonicalName(zone)}
+	for _, upstream := range strings.Split(upstreams, ",") {
+		upstream = strings.TrimSpace(upstream)
+		if upstream == "" {
+			continue
+		}
+		config.Upstreams = append(config.Upstreams, withDefaultScheme(upstream))
+	}
+	if len(config.Upstreams) == 0 {
+		return ZoneConfig{}, fmt.Errorf("invalid forwarding zone %q, no upstream", s)
+	}
+	return config, nil
+}
+
+// withDefaultScheme makes upstreams without a scheme plain DNS resolvers, on the default port unless they have one.
+// IPv6 addresses may be bracketed, e.g. [fd00::53]:5353, or bare without a port, e.g. fd00::53.
+func withDefaultScheme(upstream string) string {
+	if strings.Contains(upstream, "://") {
+		return upstream
+	}
+	host, port, err := net.SplitHostPort(upstream)
+	if err != nil {
+		host, port = strings.TrimSuffix(strings.TrimPrefix(upstream, "["), "]"), dnsDefaultPort
+	}
+	return DNSScheme + "://" + net.JoinHostPort(host, port)
+}
+
+// ParseZoneConfigs parses a list of forwarding zones, see ParseZoneConfig.
+func ParseZoneConfigs(zones []string) ([]ZoneConfig, error) {
+	configs := make([]ZoneConfig, 0, len(zones))
+	for _, zone := range zones {
+		config, err := ParseZoneConfig(zone)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// Zone is a forwarding zone with its upstreams
+type Zone struct {
+	Name      string
+	Upstreams []Upstream
+}
+
+// sortZones orders the zones from the most to the least specific, so that the first matching zone is the longest one.
+func sortZones(zones []Zone) {
+	sort.SliceStable(zones, func(i, j int) bool {
+		return dns.CountLabel(zones[i].Name) > dns.CountLabel(zones[j].Name)
+	})
+}
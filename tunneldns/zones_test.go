@@ -0,0 +1,93 @@
+package tunneldns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseZoneConfig(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ZoneConfig
+		err      bool
+	}{
+		{
+			input:    "corp.example=10.0.0.53",
+			expected: ZoneConfig{Zone: "corp.example.", Upstreams: []string{"dns://10.0.0.53:53"}},
+		},
+		{
+			input:    "Corp.Example.=10.0.0.53:5353, https://doh.corp.example/dns-query",
+			expected: ZoneConfig{Zone: "corp.example.", Upstreams: []string{"dns://10.0.0.53:5353", "https://doh.corp.example/dns-query"}},
+		},
+		{
+			input:    "corp.example=fd00::53, [fd00::54]:5353",
+			expected: ZoneConfig{Zone: "corp.example.", Upstreams: []string{"dns://[fd00::53]:53", "dns://[fd00::54]:5353"}},
+		},
+		{input: "corp.example", err: true},
+		{input: "=10.0.0.53", err: true},
+		{input: "corp.example=", err: true},
+		{input: "corp.example= , ", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			config, err := ParseZoneConfig(test.input)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, config)
+		})
+	}
+}
+
+type namedUpstream string
+
+func (u namedUpstream) Exchange(_ context.Context, query *dns.Msg) (*dns.Msg, error) {
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	rr, _ := dns.NewRR(query.Question[0].Name + " TXT " + string(u))
+	reply.Answer = []dns.RR{rr}
+	return reply, nil
+}
+
+func TestProxyPluginZones(t *testing.T) {
+	zones := []Zone{
+		{Name: "example.", Upstreams: []Upstream{namedUpstream("example")}},
+		{Name: "corp.example.", Upstreams: []Upstream{namedUpstream("corp")}},
+	}
+	sortZones(zones)
+	proxy := ProxyPlugin{
+		Upstreams: []Upstream{namedUpstream("default")},
+		Zones:     zones,
+	}
+
+	tests := map[string]string{
+		"corp.example.":       "corp",
+		"host.CORP.example.":  "corp",
+		"www.example.":        "example",
+		"notcorp.example.":    "example",
+		"cloudflare.com.":     "default",
+		"example.cloudflare.": "default",
+	}
+	for name, expected := range tests {
+		query := new(dns.Msg)
+		query.SetQuestion(name, dns.TypeTXT)
+		rec := dnstest.NewRecorder(&testResponseWriter{})
+		_, err := proxy.ServeDNS(context.Background(), rec, query)
+		require.NoError(t, err)
+		require.Equal(t, []string{expected}, rec.Msg.Answer[0].(*dns.TXT).Txt, name)
+	}
+}
+
+func TestNewUpstreamDNSIPv6(t *testing.T) {
+	config, err := ParseZoneConfig("corp.example=fd00::53")
+	require.NoError(t, err)
+	upstream, err := NewUpstreamDNS(config.Upstreams[0], nil)
+	require.NoError(t, err)
+	require.Equal(t, "[fd00::53]:53", upstream.(*UpstreamDNS).address)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/tlsconfig"
 )
 
 type ConnTracker struct {
@@ -20,6 +21,8 @@ type ConnectionInfo struct {
 	IsConnected bool                `json:"isConnected,omitempty"`
 	Protocol    connection.Protocol `json:"protocol,omitempty"`
 	EdgeAddress net.IP              `json:"edgeAddress,omitempty"`
+	// TLS are the parameters negotiated with the edge
+	TLS *tlsconfig.ConnectionParameters `json:"tls,omitempty"`
 }
 
 // Convinience struct to extend the connection with its index.
@@ -45,6 +48,7 @@ func (ct *ConnTracker) OnTunnelEvent(c connection.Event) {
 			IsConnected: true,
 			Protocol:    c.Protocol,
 			EdgeAddress: c.EdgeAddress,
+			TLS:         c.TLS,
 		}
 		ct.connectionInfo[c.Index] = ci
 		ct.mutex.Unlock()
@@ -54,6 +58,8 @@ func (ct *ConnTracker) OnTunnelEvent(c connection.Event) {
 		ci.IsConnected = false
 		ct.connectionInfo[c.Index] = ci
 		ct.mutex.Unlock()
+	case connection.ProtocolFallback:
+		// The connection isn't up yet, it will report Connected with the fallback protocol
 	default:
 		ct.log.Error().Msgf("Unknown connection event case %v", c)
 	}